@@ -19,15 +19,18 @@ import (
 	"github.com/OpenNSW/nsw/backend/internal/database"
 	"github.com/OpenNSW/nsw/backend/internal/hscode"
 	"github.com/OpenNSW/nsw/backend/internal/middleware"
-	"github.com/OpenNSW/nsw/backend/internal/payments"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
 	"github.com/OpenNSW/nsw/backend/internal/profile/cha"
 	"github.com/OpenNSW/nsw/backend/internal/profile/company"
 	"github.com/OpenNSW/nsw/backend/internal/profile/user"
 	"github.com/OpenNSW/nsw/backend/internal/taskv2"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/fees"
 	taskv2plugins "github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
 	"github.com/OpenNSW/nsw/backend/internal/taskv2/registry"
 	taskrenderer "github.com/OpenNSW/nsw/backend/internal/taskv2/renderer"
 	"github.com/OpenNSW/nsw/backend/internal/temporal"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/service"
 	"github.com/OpenNSW/nsw/backend/pkg/remote"
 	"github.com/OpenNSW/nsw/backend/pkg/storage"
@@ -77,12 +80,18 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("database health check failed: %w", err)
 	}
 
-	paymentRepo := payments.NewPaymentRepository(db)
-	paymentService, err := payments.NewPaymentService(paymentRepo, cfg.Server.PaymentMethodsConfigPath)
+	// Each configured payment method is backed by the gateway factory of the
+	// same ID; methods without one are listed but cannot be checked out.
+	paymentRegistry, err := paymentsv2.NewRegistry(cfg.Server.PaymentMethodsConfigPath, map[string]gateways.Factory{
+		"govpay":   gateways.NewGovPayGateway,
+		"lankapay": gateways.NewLankaPayGateway,
+	})
 	if err != nil {
 		_ = database.Close(db)
-		return nil, fmt.Errorf("failed to initialize payment service: %w", err)
+		return nil, fmt.Errorf("failed to initialize payment gateway registry: %w", err)
 	}
+	paymentService := paymentsv2.NewPaymentService(paymentsv2.NewPaymentRepository(db), paymentRegistry)
+	reconciliationService := paymentsv2.NewReconciliationService(paymentsv2.NewReconciliationRepository(db), paymentRegistry)
 
 	templateRegistry := registry.NewInMemRegistry()
 	if err := registry.LoadConfigsInto(templateRegistry, "configs/fcau"); err != nil {
@@ -102,17 +111,31 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("failed to create temporal client: %w", err)
 	}
 
-	// parentRunner is forward-declared so the taskv2 completion callback can
-	// close over it. It is assigned below after WireParentRunner returns.
-	// WireTaskV2 starts a Temporal worker synchronously, so the callback can
-	// in principle fire before that assignment — e.g. a workflow that was
-	// already complete when the worker resumed polling. The nil check turns
-	// that race from a panic into a typed error the engine can retry.
+	// parentRunner and consignmentService are forward-declared so the taskv2
+	// completion callback can close over them. They are assigned below, after
+	// WireTaskV2 returns. WireTaskV2 starts a Temporal worker synchronously, so
+	// the callback can in principle fire before that assignment — e.g. a
+	// workflow that was already complete when the worker resumed polling. The
+	// nil check turns that race from a panic into a typed error the engine can
+	// retry.
+	//
+	// The consignment service records the task's outputs in the consignment's
+	// global context first. The outcome of a task re-opened by an amendment is
+	// signalled to the parent workflow by the service instead: the workflow
+	// completed its node already.
 	var parentRunner engine.TemporalManager
+	var consignmentService *consignment.Service
 	onTaskCompleted := func(parentWorkflowID, parentRunID, parentNodeID string, finalVariables map[string]any) error {
-		if parentRunner == nil {
+		if parentRunner == nil || consignmentService == nil {
 			return fmt.Errorf("task completion arrived before parent runner was wired")
 		}
+		revised, err := consignmentService.RecordTaskCompletion(context.Background(), parentWorkflowID, parentNodeID, finalVariables)
+		if err != nil {
+			return err
+		}
+		if revised {
+			return nil
+		}
 		return parentRunner.TaskDone(context.Background(), parentWorkflowID, parentRunID, parentNodeID, finalVariables)
 	}
 
@@ -124,7 +147,7 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 	}
 
 	pluginsRegistry := flowplugins.NewRegistry()
-	if err := taskv2plugins.Register(pluginsRegistry, remoteManager, paymentService, cfg.Server.ServiceURL, cfg.Server.Debug); err != nil {
+	if err := taskv2plugins.Register(pluginsRegistry, remoteManager, paymentService, templateRegistry.FeeSchedule(), cfg.Server.ServiceURL, cfg.Server.Debug); err != nil {
 		temporalClient.Close()
 		_ = database.Close(db)
 		return nil, fmt.Errorf("failed to register taskv2 plugins: %w", err)
@@ -141,10 +164,16 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 
 	paymentService.SetTaskCompleter(tm)
 
-	consignmentService := consignment.NewService(db, templateService, chaService, companyService, userProfileService, hsCodeService, taskV2.Store)
+	consignmentService = consignment.NewService(db, templateService, chaService, companyService, userProfileService, hsCodeService, taskV2.Store)
+	paymentService.SetPartyResolver(taskv2.NewPaymentPartyResolver(taskV2.Store, consignmentService, templateRegistry, remoteManager))
+	consignmentService.SetWorkflowCanceller(workflow.NewCanceller(temporalClient))
+	consignmentService.SetOGANotifier(remoteManager)
+	consignmentService.SetWorkflowSupervisor(workflow.NewSupervisor(temporalClient, cfg.Temporal.Namespace))
+	consignmentService.SetTaskActivator(tm)
+	consignmentService.SetWorkflowSignaller(workflow.NewSignaller(temporalClient))
 	consignmentRouter := consignment.NewRouter(consignmentService, chaService, companyService)
 
-	pr, stopParentRunner, err := workflow.WireParentRunner(temporalClient, tm, consignmentService)
+	pr, stopParentRunner, err := workflow.WireParentRunner(temporalClient, consignmentService, consignmentService)
 	if err != nil {
 		_ = stopTaskV2()
 		temporalClient.Close()
@@ -174,9 +203,19 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 	storageService := storage.NewService(storageDriver)
+	storageService.Uploads = storage.NewGormUploadRegistry(db)
 	storageHandler := storage.NewHTTPHandler(storageService)
+	consignmentService.SetImportFiles(storageService)
+
+	paymentService.SetReceipts(paymentsv2.ReceiptConfig{
+		Storage:       storageDriver,
+		VerifyBaseURL: cfg.Server.ServiceURL,
+		Payers:        consignmentService,
+	})
 
-	paymentHandler := payments.NewHTTPHandler(paymentService)
+	paymentHandler := paymentsv2.NewHTTPHandler(paymentService)
+	reconciliationHandler := paymentsv2.NewReconciliationHandler(reconciliationService)
+	feeHandler := fees.NewHTTPHandler(templateRegistry.FeeSchedule())
 
 	authManager, err := auth.NewManager(userProfileService, cfg.Auth)
 	if err != nil {
@@ -196,21 +235,20 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("auth system health check failed: %w", err)
 	}
 
-	taskV2Handler := taskv2.NewHTTPHandler(tm, taskV2.Store, taskV2.Assembler)
-
 	// withAuth wraps an individual handler with the authentication middleware.
 	withAuth := authManager.RequireAuthMiddleware()
 
 	// authzr gates routes by the OAuth2 scopes carried on the token.
 	// The extractor bridges the authn layer (auth.GetAuthContext) into the
 	// generic authz.Principal interface — authz imports nothing from internal/auth.
-	authzr, err := authz.New(func(ctx context.Context) (authz.Principal, bool) {
+	extractPrincipal := func(ctx context.Context) (authz.Principal, bool) {
 		ac := auth.GetAuthContext(ctx)
 		if ac == nil || ac.Type() == "" {
 			return nil, false
 		}
 		return ac, true
-	})
+	}
+	authzr, err := authz.New(extractPrincipal)
 	if err != nil {
 		_ = stopParentRunner()
 		_ = stopTaskV2()
@@ -219,6 +257,44 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 		_ = database.Close(db)
 		return nil, fmt.Errorf("failed to create authz: %w", err)
 	}
+
+	// taskPolicy scopes task reads/completions to the owning trader/CHA
+	// companies, and OGA machine clients to tasks dispatched to their service.
+	taskPolicy, err := authz.NewTaskPolicy(
+		extractPrincipal,
+		taskv2.NewOwnershipResolver(taskV2.Store, consignmentService),
+		cfg.Authz.ClientServiceIDs,
+	)
+	if err != nil {
+		_ = stopParentRunner()
+		_ = stopTaskV2()
+		temporalClient.Close()
+		_ = authManager.Close()
+		_ = database.Close(db)
+		return nil, fmt.Errorf("failed to create task policy: %w", err)
+	}
+
+	// consignmentPolicy is enforced inside the consignment service; it admits the
+	// owning companies, the assigned CHA and OGAs with a task on the consignment.
+	consignmentPolicy, err := authz.NewConsignmentPolicy(cfg.Authz.ClientServiceIDs)
+	if err == nil {
+		err = consignmentService.RegisterAccessPolicy(consignmentPolicy)
+	}
+	if err != nil {
+		_ = stopParentRunner()
+		_ = stopTaskV2()
+		temporalClient.Close()
+		_ = authManager.Close()
+		_ = database.Close(db)
+		return nil, fmt.Errorf("failed to register consignment access policy: %w", err)
+	}
+
+	taskV2Handler := taskv2.NewHTTPHandler(tm, taskV2.Store, taskV2.Assembler, taskPolicy)
+	taskV2Handler.Events = timeline.NewRecorder(db)
+	taskV2Handler.Inbox = taskv2.NewInbox(taskV2.Store, taskPolicy, consignmentService, taskV2.Assembler)
+	taskV2Handler.Queue = taskv2.NewReviewQueue(taskV2.Store, taskPolicy)
+	// A payment cart is visible to whoever may act on every task in it.
+	cartHandler := paymentsv2.NewCartHandler(paymentService, taskPolicy)
 	// withScope returns a middleware requiring the given scope; compose after withAuth
 	// so the auth context is already injected when the scope check runs.
 	withScope := func(scope string) func(http.Handler) http.Handler {
@@ -258,8 +334,14 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 	// API routes. Each handler is wrapped with auth (JWT validation) then a
 	// scope gate. Order matters: withAuth injects the AuthContext; withScope
 	// reads it. Public routes (payments, local-dev storage) are below.
+	mux.Handle("GET /api/v1/tasks", withAuth(withScope(scopes.TaskRead)(http.HandlerFunc(taskV2Handler.HandleListTasks))))
 	mux.Handle("GET /api/v1/tasks/{id}", withAuth(withScope(scopes.TaskRead)(http.HandlerFunc(taskV2Handler.HandleGetTask))))
 	mux.Handle("POST /api/v1/tasks/{id}", withAuth(withScope(scopes.TaskWrite)(http.HandlerFunc(taskV2Handler.HandleCompleteTaskStep))))
+	mux.Handle("POST /api/v1/tasks/{id}/claim", withAuth(withScope(scopes.TaskWrite)(http.HandlerFunc(taskV2Handler.HandleClaimTask))))
+	mux.Handle("POST /api/v1/tasks/{id}/unclaim", withAuth(withScope(scopes.TaskWrite)(http.HandlerFunc(taskV2Handler.HandleUnclaimTask))))
+	mux.Handle("PUT /api/v1/tasks/{id}/assignment", withAuth(withScope(scopes.TaskWrite)(http.HandlerFunc(taskV2Handler.HandleAssignTask))))
+	mux.Handle("GET /api/v1/review-queue", withAuth(withScope(scopes.TaskRead)(http.HandlerFunc(taskV2Handler.HandleListQueue))))
+	mux.Handle("GET /api/v1/review-queue/workload", withAuth(withScope(scopes.TaskRead)(http.HandlerFunc(taskV2Handler.HandleGetWorkload))))
 	// TODO(oga-callback): remove once OGA POSTs directly to /api/v1/tasks/{id}
 	// with the bare reviewer payload. This legacy route accepts OGA's
 	// {task_id, workflow_id, payload:{action, content}} envelope and the
@@ -269,19 +351,48 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 	mux.Handle("GET /api/v1/chas", withAuth(withScope(scopes.CHARead)(http.HandlerFunc(chaHandler.HandleGetCHAs))))
 	mux.Handle("GET /api/v1/companies", withAuth(withScope(scopes.CompanyRead)(http.HandlerFunc(companyHandler.HandleGetCompanies))))
 	mux.Handle("POST /api/v1/consignments", withAuth(withScope(scopes.ConsignmentWrite)(http.HandlerFunc(consignmentRouter.HandleCreateConsignment))))
+	mux.Handle("POST /api/v1/consignments:start", withAuth(withScope(scopes.ConsignmentWrite)(http.HandlerFunc(consignmentRouter.HandleStartConsignment))))
 	mux.Handle("GET /api/v1/consignments/{id}", withAuth(withScope(scopes.ConsignmentRead)(http.HandlerFunc(consignmentRouter.HandleGetConsignmentByID))))
 	mux.Handle("PUT /api/v1/consignments/{id}", withAuth(withScope(scopes.ConsignmentWrite)(http.HandlerFunc(consignmentRouter.HandleInitializeConsignment))))
+	mux.Handle("POST /api/v1/consignments/{id}/cancel", withAuth(withScope(scopes.ConsignmentWrite)(http.HandlerFunc(consignmentRouter.HandleCancelConsignment))))
+	mux.Handle("POST /api/v1/consignments/{id}/amendments", withAuth(withScope(scopes.ConsignmentWrite)(http.HandlerFunc(consignmentRouter.HandleAmendConsignment))))
+	mux.Handle("GET /api/v1/consignments/{id}/amendments", withAuth(withScope(scopes.ConsignmentRead)(http.HandlerFunc(consignmentRouter.HandleListAmendments))))
+	mux.Handle("GET /api/v1/consignments/{id}/timeline", withAuth(withScope(scopes.ConsignmentRead)(http.HandlerFunc(consignmentRouter.HandleGetTimeline))))
 	mux.Handle("GET /api/v1/consignments", withAuth(withScope(scopes.ConsignmentRead)(http.HandlerFunc(consignmentRouter.HandleGetConsignments))))
+	mux.Handle("GET /api/v1/consignments/export", withAuth(withScope(scopes.ConsignmentRead)(http.HandlerFunc(consignmentRouter.HandleExportConsignments))))
+	mux.Handle("POST /api/v1/consignment-imports", withAuth(withScope(scopes.ConsignmentWrite)(http.HandlerFunc(consignmentRouter.HandleCreateImport))))
+	mux.Handle("GET /api/v1/consignment-imports/{id}", withAuth(withScope(scopes.ConsignmentRead)(http.HandlerFunc(consignmentRouter.HandleGetImport))))
+	mux.Handle("GET /api/v1/admin/consignments", withAuth(withScope(scopes.ConsignmentSupport)(http.HandlerFunc(consignmentRouter.HandleListAllConsignments))))
+	mux.Handle("GET /api/v1/admin/consignments/export", withAuth(withScope(scopes.ConsignmentSupport)(http.HandlerFunc(consignmentRouter.HandleExportAllConsignments))))
+	mux.Handle("POST /api/v1/admin/consignments/{id}/retry", withAuth(withScope(scopes.ConsignmentSupport)(http.HandlerFunc(consignmentRouter.HandleRetryConsignment))))
+	mux.Handle("GET /api/v1/admin/consignments/{id}/timeline", withAuth(withScope(scopes.ConsignmentSupport)(http.HandlerFunc(consignmentRouter.HandleGetTimelineForSupport))))
+	mux.Handle("GET /api/v1/payments/methods", withAuth(withScope(scopes.TaskRead)(http.HandlerFunc(paymentHandler.HandleListMethods))))
+	mux.Handle("GET /api/v1/payments/carts/{consignmentId}", withAuth(withScope(scopes.TaskRead)(http.HandlerFunc(cartHandler.HandleGetCart))))
+	mux.Handle("POST /api/v1/payments/carts/{consignmentId}/checkout", withAuth(withScope(scopes.TaskWrite)(http.HandlerFunc(cartHandler.HandleCheckoutCart))))
+	mux.Handle("POST /api/v1/admin/fees/{tableId}/preview", withAuth(withScope(scopes.FeePreview)(http.HandlerFunc(feeHandler.HandlePreview))))
+	mux.Handle("POST /api/v1/admin/payments/reconciliations", withAuth(withScope(scopes.PaymentReconcile)(http.HandlerFunc(reconciliationHandler.HandleReconcile))))
+	mux.Handle("GET /api/v1/admin/payments/reconciliations", withAuth(withScope(scopes.PaymentReconcile)(http.HandlerFunc(reconciliationHandler.HandleListRuns))))
+	mux.Handle("GET /api/v1/admin/payments/reconciliations/{runId}", withAuth(withScope(scopes.PaymentReconcile)(http.HandlerFunc(reconciliationHandler.HandleGetRun))))
+	mux.Handle("GET /api/v1/admin/payments/reconciliations/{runId}/export", withAuth(withScope(scopes.PaymentReconcile)(http.HandlerFunc(reconciliationHandler.HandleExportRun))))
+	mux.Handle("GET /api/v1/admin/payments/refunds", withAuth(withScope(scopes.PaymentRefund)(http.HandlerFunc(paymentHandler.HandleListRefunds))))
+	mux.Handle("POST /api/v1/admin/payments/refunds/{refundId}/complete", withAuth(withScope(scopes.PaymentRefund)(http.HandlerFunc(paymentHandler.HandleCompleteRefund))))
+	mux.Handle("POST /api/v1/admin/payments/{reference}/refunds", withAuth(withScope(scopes.PaymentRefund)(http.HandlerFunc(paymentHandler.HandleRequestRefund))))
 
 	// Storage
 	mux.Handle("POST /api/v1/storage", withAuth(withScope(scopes.StorageWrite)(http.HandlerFunc(storageHandler.Upload))))
 	mux.Handle("GET /api/v1/storage/{key}", withAuth(withScope(scopes.StorageRead)(http.HandlerFunc(storageHandler.Download))))
 	mux.Handle("DELETE /api/v1/storage/{key}", withAuth(withScope(scopes.StorageDelete)(http.HandlerFunc(storageHandler.Delete))))
 
-	// External Webhooks bypass standard JWT auth.
-	// They should use webhook signatures, implemented in the handler directly or via specialized middleware.
-	mux.Handle("POST /api/v1/payments/webhook", http.HandlerFunc(paymentHandler.HandleWebhook))
-	mux.Handle("POST /api/v1/payments/validate", http.HandlerFunc(paymentHandler.HandleValidateReference))
+	// External webhooks bypass standard JWT auth. Each gateway authenticates its
+	// own deliveries (HMAC signature, timestamp, nonce, optional IP allowlist)
+	// via its webhook_security config; the validate route stays public.
+	mux.Handle("POST /api/v1/payments/{gatewayId}/webhook", http.HandlerFunc(paymentHandler.HandleWebhook))
+	mux.Handle("POST /api/v1/payments/{gatewayId}/validate", http.HandlerFunc(paymentHandler.HandleValidateReference))
+	// The payer's browser returns here from a hosted checkout without a bearer
+	// token; the gateway signs the query string instead.
+	mux.Handle("GET /api/v1/payments/returns/{gatewayId}", http.HandlerFunc(paymentHandler.HandleReturn))
+	// Anyone holding a receipt can confirm it from the code printed on it.
+	mux.Handle("GET /api/v1/payments/receipts/{code}/verify", http.HandlerFunc(paymentHandler.HandleVerifyReceipt))
 
 	// When using local storage, these endpoints serve as mocks for S3.
 	if _, ok := storageDriver.(*drivers.LocalFSDriver); ok {
@@ -296,9 +407,31 @@ func Build(ctx context.Context, cfg *config.Config) (*App, error) {
 		Handler: handler,
 	}
 
+	// Started last: nothing after this point can fail, so no failure path
+	// needs to stop it.
+	expirySweeper := paymentsv2.NewExpirySweeper(paymentService, paymentsv2.ExpiryConfig{
+		Interval:  cfg.PaymentExpiry.Interval,
+		Grace:     cfg.PaymentExpiry.Grace,
+		BatchSize: cfg.PaymentExpiry.BatchSize,
+	})
+	expirySweeper.Start(context.WithoutCancel(ctx))
+	workflowMonitor := consignment.NewMonitor(consignmentService, consignment.MonitorConfig{
+		Interval:  cfg.WorkflowMonitor.Interval,
+		BatchSize: cfg.WorkflowMonitor.BatchSize,
+	})
+	workflowMonitor.Start(context.WithoutCancel(ctx))
+	importer := consignment.NewImporter(consignmentService, consignment.ImportConfig{
+		Interval: cfg.ConsignmentImport.Interval,
+		MaxRows:  cfg.ConsignmentImport.MaxRows,
+	})
+	importer.Start(context.WithoutCancel(ctx))
+
 	closeFn := func() error {
 		var closeErrs []error
 
+		expirySweeper.Stop()
+		workflowMonitor.Stop()
+		importer.Stop()
 		if err := stopParentRunner(); err != nil {
 			closeErrs = append(closeErrs, fmt.Errorf("failed to stop parent runner: %w", err))
 		}
@@ -15,6 +15,10 @@ const (
 	ConsignmentRead  = "nsw:consignment:read"
 	ConsignmentWrite = "nsw:consignment:write"
 
+	// Consignment support: list consignments across companies and retry stuck
+	// workflows. Not granted to traders.
+	ConsignmentSupport = "nsw:consignment:support"
+
 	// Task resource.
 	TaskRead  = "nsw:task:read"
 	TaskWrite = "nsw:task:write"
@@ -28,4 +32,11 @@ const (
 	StorageRead   = "nsw:storage:read"
 	StorageWrite  = "nsw:storage:write"
 	StorageDelete = "nsw:storage:delete"
+
+	// Fee administration. Not granted to traders.
+	FeePreview = "nsw:fee:preview"
+
+	// Payment administration. Not granted to traders.
+	PaymentReconcile = "nsw:payment:reconcile"
+	PaymentRefund    = "nsw:payment:refund"
 )
@@ -170,3 +170,21 @@ func (a *AuthContext) Scopes() []string {
 		return nil
 	}
 }
+
+// OUHandle returns the organisation unit handle for user principals, or "" for
+// clients and unauthenticated contexts.
+func (a *AuthContext) OUHandle() string {
+	if a == nil || a.User == nil {
+		return ""
+	}
+	return a.User.OUHandle
+}
+
+// Email returns the e-mail address for user principals, or "" for clients and
+// unauthenticated contexts.
+func (a *AuthContext) Email() string {
+	if a == nil || a.User == nil {
+		return ""
+	}
+	return a.User.Email
+}
@@ -129,10 +129,12 @@ var _ interface {
 	Subject() string
 	Roles() []string
 	Scopes() []string
+	OUHandle() string
+	Email() string
 } = (*AuthContext)(nil)
 
 func TestAuthContext_AccessorSeam(t *testing.T) {
-	user := &AuthContext{User: &UserContext{ID: "u1", IDPUserID: "idp1", Roles: []string{"Trader"}, Scopes: []string{"nsw:task:read"}}}
+	user := &AuthContext{User: &UserContext{ID: "u1", IDPUserID: "idp1", Email: "u1@acme.test", OUHandle: "acme", Roles: []string{"Trader"}, Scopes: []string{"nsw:task:read"}}}
 	if user.Type() != UserPrincipalType {
 		t.Fatalf("user Type = %q", user.Type())
 	}
@@ -142,6 +144,9 @@ func TestAuthContext_AccessorSeam(t *testing.T) {
 	if !sameScopes(user.Roles(), []string{"Trader"}) || !sameScopes(user.Scopes(), []string{"nsw:task:read"}) {
 		t.Fatalf("user roles/scopes = %v / %v", user.Roles(), user.Scopes())
 	}
+	if user.OUHandle() != "acme" || user.Email() != "u1@acme.test" {
+		t.Fatalf("user OUHandle/Email = %q / %q", user.OUHandle(), user.Email())
+	}
 
 	// Subject falls back to IdP user ID when resolved ID is empty.
 	if got := (&AuthContext{User: &UserContext{IDPUserID: "idp2"}}).Subject(); got != "idp2" {
@@ -149,7 +154,7 @@ func TestAuthContext_AccessorSeam(t *testing.T) {
 	}
 
 	client := &AuthContext{Client: &ClientContext{ClientID: "NPQS_TO_NSW", Roles: []string{"AgencyM2M"}, Scopes: []string{"nsw:task:write"}}}
-	if client.Type() != ClientPrincipalType || client.Subject() != "NPQS_TO_NSW" {
+	if client.Type() != ClientPrincipalType || client.Subject() != "NPQS_TO_NSW" || client.OUHandle() != "" || client.Email() != "" {
 		t.Fatalf("client Type/Subject = %q / %q", client.Type(), client.Subject())
 	}
 	if !sameScopes(client.Roles(), []string{"AgencyM2M"}) || !sameScopes(client.Scopes(), []string{"nsw:task:write"}) {
@@ -158,7 +163,7 @@ func TestAuthContext_AccessorSeam(t *testing.T) {
 
 	// Nil-safe: empty context and nil receiver return zero values.
 	for _, a := range []*AuthContext{{}, nil} {
-		if a.Type() != "" || a.Subject() != "" || a.Roles() != nil || a.Scopes() != nil {
+		if a.Type() != "" || a.Subject() != "" || a.Roles() != nil || a.Scopes() != nil || a.OUHandle() != "" || a.Email() != "" {
 			t.Fatalf("expected zero values for %#v", a)
 		}
 	}
@@ -0,0 +1,99 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeContact is an organisation member that also carries an e-mail address.
+type fakeContact struct {
+	fakeMember
+	email string
+}
+
+func (f *fakeContact) Email() string { return f.email }
+
+var _ Contactable = (*fakeContact)(nil)
+
+func TestConsignmentPolicy_Authorize(t *testing.T) {
+	policy, err := NewConsignmentPolicy(map[string]string{
+		"FCAU_TO_NSW": "fcau",
+		"NPQS_TO_NSW": "npqs",
+	})
+	if err != nil {
+		t.Fatalf("NewConsignmentPolicy: %v", err)
+	}
+	resource := &ConsignmentResource{
+		ConsignmentID:  "c1",
+		OwnerOUHandles: []string{"trader-ou", "cha-ou"},
+		AssigneeEmails: []string{"agent@broker.test"},
+		TaskServiceIDs: []string{"npqs"},
+	}
+	member := func(ou, email string) Principal {
+		return &fakeContact{fakeMember: fakeMember{fakePrincipal: fakePrincipal{subject: "u1"}, ouHandle: ou}, email: email}
+	}
+
+	cases := []struct {
+		name      string
+		principal Principal
+		want      error
+	}{
+		{"trader company", member("trader-ou", ""), nil},
+		{"claimed CHA company", member("cha-ou", ""), nil},
+		{"assigned CHA by e-mail", member("elsewhere-ou", "agent@broker.test"), nil},
+		{"other company", member("other-ou", "someone@other.test"), ErrForbidden},
+		{"OGA with a task", &fakePrincipal{subject: "NPQS_TO_NSW"}, nil},
+		{"OGA without a task", &fakePrincipal{subject: "FCAU_TO_NSW"}, ErrForbidden},
+		{"unmapped client", &fakePrincipal{subject: "OTHER"}, ErrForbidden},
+		// An org member whose subject happens to match a client mapping must not
+		// be admitted through the client path.
+		{"member spoofing client subject", &fakeMember{fakePrincipal: fakePrincipal{subject: "NPQS_TO_NSW"}, ouHandle: "other-ou"}, ErrForbidden},
+		{"unauthenticated", nil, ErrUnauthenticated},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Authorize(tc.principal, resource)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Authorize() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	if err := policy.Authorize(member("trader-ou", ""), nil); err == nil {
+		t.Fatal("expected error for nil resource")
+	}
+}
+
+func TestConsignmentPolicy_ServiceIDFor(t *testing.T) {
+	policy, err := NewConsignmentPolicy(map[string]string{"NPQS_TO_NSW": "npqs"})
+	if err != nil {
+		t.Fatalf("NewConsignmentPolicy: %v", err)
+	}
+	if got := policy.ServiceIDFor(&fakePrincipal{subject: "NPQS_TO_NSW"}); got != "npqs" {
+		t.Fatalf("client ServiceIDFor = %q, want npqs", got)
+	}
+	if got := policy.ServiceIDFor(&fakeMember{fakePrincipal: fakePrincipal{subject: "NPQS_TO_NSW"}, ouHandle: "ou"}); got != "" {
+		t.Fatalf("member ServiceIDFor = %q, want empty", got)
+	}
+	if got := policy.ServiceIDFor(nil); got != "" {
+		t.Fatalf("nil ServiceIDFor = %q, want empty", got)
+	}
+}
+
+func TestNewConsignmentPolicy_RejectsEmptyMapping(t *testing.T) {
+	if _, err := NewConsignmentPolicy(map[string]string{"FCAU_TO_NSW": ""}); err == nil {
+		t.Fatal("expected error for empty service ID")
+	}
+}
+
+func TestEmailOf(t *testing.T) {
+	if got := EmailOf(nil); got != "" {
+		t.Fatalf("EmailOf(nil) = %q", got)
+	}
+	if got := EmailOf(&fakePrincipal{subject: "c"}); got != "" {
+		t.Fatalf("EmailOf(non-contact) = %q", got)
+	}
+	if got := EmailOf(&fakeContact{email: "a@b.test"}); got != "a@b.test" {
+		t.Fatalf("EmailOf(contact) = %q", got)
+	}
+}
@@ -0,0 +1,51 @@
+package authz
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// ErrNotFound is returned by resource policies when the resource being
+// authorized does not exist. Handlers translate it into 404 so a missing
+// resource and a denied one are reported distinctly to legitimate callers.
+var ErrNotFound = errors.New("authz: resource not found")
+
+// OrgMember is implemented by principals that belong to an organisation unit
+// (a trader or CHA company in this codebase). It is optional: machine clients
+// do not implement it, or return "". *auth.AuthContext satisfies it
+// structurally, so this package still imports nothing from the authn layer.
+type OrgMember interface {
+	OUHandle() string
+}
+
+// OUHandleOf returns the organisation unit handle of p, or "" when p is nil or
+// does not belong to an organisation unit.
+func OUHandleOf(p Principal) string {
+	if p == nil {
+		return ""
+	}
+	m, ok := p.(OrgMember)
+	if !ok {
+		return ""
+	}
+	return m.OUHandle()
+}
+
+// WriteError writes the JSON error body for an error returned by a resource
+// policy, using the same {"error","message"} shape as the scope middleware:
+// 401 for ErrUnauthenticated, 403 for ErrForbidden, 404 for ErrNotFound and
+// 500 for anything else (the underlying error is logged, never echoed).
+func WriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+	case errors.Is(err, ErrForbidden):
+		writeError(w, http.StatusForbidden, "forbidden", "access to this resource is not permitted")
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "resource not found")
+	default:
+		slog.Error("authz: resource policy evaluation failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to evaluate access")
+	}
+}
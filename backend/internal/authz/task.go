@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// TaskResource is the ownership view of a task that TaskPolicy decides on. It
+// is produced by a TaskResolver, which owns the lookups (task record → root
+// consignment → owning companies); this package only evaluates the result.
+type TaskResource struct {
+	// TaskID is the task being accessed.
+	TaskID string
+	// ConsignmentID is the root workflow (consignment) the task belongs to.
+	ConsignmentID string
+	// OwnerOUHandles are the OU handles of the companies that own the root
+	// consignment: the trader's company and, once selected, the CHA company.
+	OwnerOUHandles []string
+	// AssigneeEmails are the e-mail addresses of principals individually
+	// assigned to the root consignment (the CHA who claimed it at Stage 2).
+	AssigneeEmails []string
+	// DispatchedServiceID is the remote service the task was last dispatched
+	// to for external review, or "" if it was never dispatched.
+	DispatchedServiceID string
+}
+
+// TaskResolver loads the ownership view of a task. It must return an error
+// wrapping ErrNotFound when the task does not exist.
+type TaskResolver interface {
+	ResolveTask(ctx context.Context, taskID string) (*TaskResource, error)
+}
+
+// TaskPolicy is the resource-level policy for task endpoints. It complements
+// the coarse scope gate: a principal holding nsw:task:read/write may still
+// only touch tasks it owns.
+//
+//   - User principals are admitted when their OU handle matches one of the
+//     companies owning the task's root consignment, or when they are the CHA
+//     individually assigned to it (by e-mail), as ConsignmentPolicy admits them.
+//   - Machine clients listed in the client→service map (the OGA M2M clients)
+//     are admitted only for tasks dispatched to their mapped service_id.
+//
+// Everything else is denied with ErrForbidden.
+type TaskPolicy struct {
+	extract        Extractor
+	resolver       TaskResolver
+	clientServices map[string]string
+}
+
+// NewTaskPolicy constructs a TaskPolicy. extract supplies the principal (the
+// same Extractor given to New), resolver loads task ownership and
+// clientServices maps machine client IDs (e.g. "FCAU_TO_NSW") to the
+// service_id their tasks are dispatched to (e.g. "fcau").
+func NewTaskPolicy(extract Extractor, resolver TaskResolver, clientServices map[string]string) (*TaskPolicy, error) {
+	if extract == nil {
+		return nil, errors.New("authz: NewTaskPolicy requires a non-nil Extractor")
+	}
+	if resolver == nil {
+		return nil, errors.New("authz: NewTaskPolicy requires a non-nil TaskResolver")
+	}
+	services, err := copyClientServices(clientServices)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskPolicy{extract: extract, resolver: resolver, clientServices: services}, nil
+}
+
+// AuthorizeTask authorizes the principal on ctx against taskID. It returns nil
+// when access is allowed, ErrUnauthenticated, ErrForbidden, an error wrapping
+// ErrNotFound, or a resolver error.
+func (p *TaskPolicy) AuthorizeTask(ctx context.Context, taskID string) error {
+	principal, ok := p.extract(ctx)
+	if !ok || principal == nil {
+		return ErrUnauthenticated
+	}
+	return p.Authorize(ctx, principal, taskID)
+}
+
+// Authorize evaluates the policy for an already-resolved principal.
+func (p *TaskPolicy) Authorize(ctx context.Context, principal Principal, taskID string) error {
+	if principal == nil {
+		return ErrUnauthenticated
+	}
+	task, err := p.resolver.ResolveTask(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	if allowed, reason := p.allows(principal, task); !allowed {
+		slog.Warn("authz: task access denied",
+			"subject", principal.Subject(),
+			"taskId", task.TaskID,
+			"consignmentId", task.ConsignmentID,
+			"reason", reason,
+		)
+		return ErrForbidden
+	}
+	return nil
+}
+
+// TaskAudience is the set of tasks a principal may act on, as a listing
+// scopes them: those of the consignments its organisation owns, or those
+// dispatched to the service its machine client is mapped to. Exactly one of
+// OUHandle and ServiceID is set. Subject is the principal itself; for a
+// service, the officer its client authenticates.
+type TaskAudience struct {
+	OUHandle  string
+	ServiceID string
+	Subject   string
+}
+
+// Audience resolves the principal on ctx to the tasks it may act on, by the
+// same rules AuthorizeTask applies to a single task. It returns
+// ErrUnauthenticated, or ErrForbidden for a principal with neither an
+// organisation nor a service mapping.
+func (p *TaskPolicy) Audience(ctx context.Context) (TaskAudience, error) {
+	principal, ok := p.extract(ctx)
+	if !ok || principal == nil {
+		return TaskAudience{}, ErrUnauthenticated
+	}
+	if ouHandle := OUHandleOf(principal); ouHandle != "" {
+		return TaskAudience{OUHandle: ouHandle, Subject: principal.Subject()}, nil
+	}
+	if serviceID, ok := p.clientServices[principal.Subject()]; ok {
+		return TaskAudience{ServiceID: serviceID, Subject: principal.Subject()}, nil
+	}
+	slog.Warn("authz: task listing denied",
+		"subject", principal.Subject(),
+		"reason", "principal has no organisation or service mapping",
+	)
+	return TaskAudience{}, ErrForbidden
+}
+
+// allows reports whether principal may access task and, when not, why.
+func (p *TaskPolicy) allows(principal Principal, task *TaskResource) (bool, string) {
+	if email := EmailOf(principal); email != "" && slices.Contains(task.AssigneeEmails, email) {
+		return true, ""
+	}
+	if ouHandle := OUHandleOf(principal); ouHandle != "" {
+		if slices.Contains(task.OwnerOUHandles, ouHandle) {
+			return true, ""
+		}
+		return false, "organisation does not own the consignment"
+	}
+
+	serviceID, ok := p.clientServices[principal.Subject()]
+	if !ok {
+		return false, "principal has no organisation or service mapping"
+	}
+	if task.DispatchedServiceID == "" || task.DispatchedServiceID != serviceID {
+		return false, "task was not dispatched to the client's service"
+	}
+	return true, ""
+}
+
+// copyClientServices validates and copies a machine client → service_id map.
+func copyClientServices(clientServices map[string]string) (map[string]string, error) {
+	services := make(map[string]string, len(clientServices))
+	for clientID, serviceID := range clientServices {
+		if clientID == "" || serviceID == "" {
+			return nil, fmt.Errorf("authz: invalid client service mapping %q=%q", clientID, serviceID)
+		}
+		services[clientID] = serviceID
+	}
+	return services, nil
+}
@@ -0,0 +1,201 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeMember is a user principal that belongs to an organisation unit.
+type fakeMember struct {
+	fakePrincipal
+	ouHandle string
+}
+
+func (f *fakeMember) OUHandle() string { return f.ouHandle }
+
+var _ OrgMember = (*fakeMember)(nil)
+
+// fakeTaskResolver serves TaskResources from a map; unknown IDs are not found.
+type fakeTaskResolver struct {
+	tasks map[string]*TaskResource
+	err   error
+}
+
+func (f *fakeTaskResolver) ResolveTask(_ context.Context, taskID string) (*TaskResource, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	t, ok := f.tasks[taskID]
+	if !ok {
+		return nil, fmt.Errorf("task %s: %w", taskID, ErrNotFound)
+	}
+	return t, nil
+}
+
+func newTestTaskPolicy(t *testing.T, p Principal) *TaskPolicy {
+	t.Helper()
+	resolver := &fakeTaskResolver{tasks: map[string]*TaskResource{
+		"task-review": {
+			TaskID:              "task-review",
+			ConsignmentID:       "c1",
+			OwnerOUHandles:      []string{"trader-ou", "cha-ou"},
+			AssigneeEmails:      []string{"agent@broker.test"},
+			DispatchedServiceID: "fcau",
+		},
+		"task-input": {
+			TaskID:         "task-input",
+			ConsignmentID:  "c1",
+			OwnerOUHandles: []string{"trader-ou"},
+		},
+	}}
+	policy, err := NewTaskPolicy(staticExtractor(p), resolver, map[string]string{
+		"FCAU_TO_NSW": "fcau",
+		"NPQS_TO_NSW": "npqs",
+	})
+	if err != nil {
+		t.Fatalf("NewTaskPolicy: %v", err)
+	}
+	return policy
+}
+
+func TestTaskPolicy_AuthorizeTask(t *testing.T) {
+	trader := &fakeMember{fakePrincipal: fakePrincipal{subject: "u-trader"}, ouHandle: "trader-ou"}
+	cha := &fakeMember{fakePrincipal: fakePrincipal{subject: "u-cha"}, ouHandle: "cha-ou"}
+	otherTrader := &fakeMember{fakePrincipal: fakePrincipal{subject: "u-other"}, ouHandle: "other-ou"}
+	noOU := &fakePrincipal{subject: "u-no-ou"}
+	assigned := &fakeContact{fakeMember: fakeMember{fakePrincipal: fakePrincipal{subject: "u-agent"}, ouHandle: "freelance-ou"}, email: "agent@broker.test"}
+	fcau := &fakePrincipal{subject: "FCAU_TO_NSW"}
+	npqs := &fakePrincipal{subject: "NPQS_TO_NSW"}
+	unmapped := &fakePrincipal{subject: "IRD_TO_NSW"}
+
+	cases := []struct {
+		name      string
+		principal Principal
+		taskID    string
+		want      error
+	}{
+		{"owning trader", trader, "task-review", nil},
+		{"owning CHA", cha, "task-review", nil},
+		{"CHA not owning this task's consignment", cha, "task-input", ErrForbidden},
+		{"other company's trader", otherTrader, "task-review", ErrForbidden},
+		{"user without OU handle", noOU, "task-review", ErrForbidden},
+		{"assigned CHA by e-mail", assigned, "task-review", nil},
+		{"assigned CHA on another consignment's task", assigned, "task-input", ErrForbidden},
+		{"OGA client on its dispatched task", fcau, "task-review", nil},
+		{"OGA client on another service's task", npqs, "task-review", ErrForbidden},
+		{"OGA client on undispatched task", fcau, "task-input", ErrForbidden},
+		{"unmapped client", unmapped, "task-review", ErrForbidden},
+		{"unknown task", trader, "missing", ErrNotFound},
+		{"unauthenticated", nil, "task-review", ErrUnauthenticated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := newTestTaskPolicy(t, c.principal).AuthorizeTask(context.Background(), c.taskID)
+			if c.want == nil {
+				if err != nil {
+					t.Fatalf("expected access, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, c.want) {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestTaskPolicy_Audience(t *testing.T) {
+	cases := []struct {
+		name      string
+		principal Principal
+		want      TaskAudience
+		wantErr   error
+	}{
+		{"trader", &fakeMember{fakePrincipal: fakePrincipal{subject: "u-trader"}, ouHandle: "trader-ou"}, TaskAudience{OUHandle: "trader-ou", Subject: "u-trader"}, nil},
+		{"OGA client", &fakePrincipal{subject: "FCAU_TO_NSW"}, TaskAudience{ServiceID: "fcau", Subject: "FCAU_TO_NSW"}, nil},
+		{"unmapped client", &fakePrincipal{subject: "IRD_TO_NSW"}, TaskAudience{}, ErrForbidden},
+		{"unauthenticated", nil, TaskAudience{}, ErrUnauthenticated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := newTestTaskPolicy(t, c.principal).Audience(context.Background())
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("got error %v, want %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Fatalf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTaskPolicy_ResolverErrorPropagates(t *testing.T) {
+	boom := errors.New("db down")
+	policy, err := NewTaskPolicy(staticExtractor(&fakePrincipal{subject: "x"}), &fakeTaskResolver{err: boom}, nil)
+	if err != nil {
+		t.Fatalf("NewTaskPolicy: %v", err)
+	}
+	if err := policy.AuthorizeTask(context.Background(), "t1"); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want resolver error", err)
+	}
+}
+
+func TestNewTaskPolicy_Validation(t *testing.T) {
+	resolver := &fakeTaskResolver{}
+	if _, err := NewTaskPolicy(nil, resolver, nil); err == nil {
+		t.Fatal("expected error for nil extractor")
+	}
+	if _, err := NewTaskPolicy(staticExtractor(nil), nil, nil); err == nil {
+		t.Fatal("expected error for nil resolver")
+	}
+	if _, err := NewTaskPolicy(staticExtractor(nil), resolver, map[string]string{"FCAU_TO_NSW": ""}); err == nil {
+		t.Fatal("expected error for empty service mapping")
+	}
+}
+
+func TestWriteError_Shape(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrUnauthenticated, http.StatusUnauthorized, "unauthorized"},
+		{ErrForbidden, http.StatusForbidden, "forbidden"},
+		{fmt.Errorf("task x: %w", ErrNotFound), http.StatusNotFound, "not_found"},
+		{errors.New("boom"), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		WriteError(rec, c.err)
+		if rec.Code != c.status {
+			t.Fatalf("%v: status = %d, want %d", c.err, rec.Code, c.status)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("%v: content-type = %q", c.err, ct)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%v: decode body: %v", c.err, err)
+		}
+		if body["error"] != c.code || body["message"] == "" {
+			t.Fatalf("%v: body = %v", c.err, body)
+		}
+	}
+}
+
+func TestOUHandleOf(t *testing.T) {
+	if got := OUHandleOf(&fakeMember{ouHandle: "acme"}); got != "acme" {
+		t.Fatalf("member OU = %q", got)
+	}
+	if got := OUHandleOf(&fakePrincipal{subject: "client"}); got != "" {
+		t.Fatalf("non-member OU = %q", got)
+	}
+	if got := OUHandleOf(nil); got != "" {
+		t.Fatalf("nil OU = %q", got)
+	}
+}
@@ -18,14 +18,18 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Database     database.Config
-	Server       ServerConfig
-	CORS         CORSConfig
-	Storage      storage.Config
-	Auth         auth.Config
-	Notification NotificationConfig
-	Temporal     temporal.Config
-	BlobSource   blobsource.Config
+	Database          database.Config
+	Server            ServerConfig
+	CORS              CORSConfig
+	Storage           storage.Config
+	Auth              auth.Config
+	Authz             AuthzConfig
+	Notification      NotificationConfig
+	Temporal          temporal.Config
+	BlobSource        blobsource.Config
+	PaymentExpiry     PaymentExpiryConfig
+	WorkflowMonitor   ConsignmentMonitorConfig
+	ConsignmentImport ConsignmentImportConfig
 }
 
 // ServerConfig holds server configuration
@@ -47,6 +51,72 @@ type CORSConfig struct {
 	MaxAge           int
 }
 
+// AuthzConfig holds resource-level authorization configuration
+type AuthzConfig struct {
+	// ClientServiceIDs maps an OGA machine client ID to the remote service_id
+	// (see services.json) its tasks are dispatched to. A client may only read
+	// or complete tasks dispatched to its mapped service.
+	ClientServiceIDs map[string]string
+}
+
+// PaymentExpiryConfig holds the payment expiry sweeper configuration; see
+// paymentsv2.ExpiryConfig
+type PaymentExpiryConfig struct {
+	Interval  time.Duration // PAYMENT_EXPIRY_SWEEP_INTERVAL
+	Grace     time.Duration // PAYMENT_EXPIRY_GRACE
+	BatchSize int           // PAYMENT_EXPIRY_BATCH_SIZE
+}
+
+// Validate checks the sweeper configuration.
+func (c PaymentExpiryConfig) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("PAYMENT_EXPIRY_SWEEP_INTERVAL must not be negative")
+	}
+	if c.Grace < 0 {
+		return fmt.Errorf("PAYMENT_EXPIRY_GRACE must not be negative")
+	}
+	if c.Interval > 0 && c.BatchSize <= 0 {
+		return fmt.Errorf("PAYMENT_EXPIRY_BATCH_SIZE must be positive")
+	}
+	return nil
+}
+
+// ConsignmentMonitorConfig holds the consignment workflow monitor configuration; see
+// consignment.MonitorConfig
+type ConsignmentMonitorConfig struct {
+	Interval  time.Duration // CONSIGNMENT_MONITOR_INTERVAL
+	BatchSize int           // CONSIGNMENT_MONITOR_BATCH_SIZE
+}
+
+// Validate checks the monitor configuration.
+func (c ConsignmentMonitorConfig) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("CONSIGNMENT_MONITOR_INTERVAL must not be negative")
+	}
+	if c.Interval > 0 && c.BatchSize <= 0 {
+		return fmt.Errorf("CONSIGNMENT_MONITOR_BATCH_SIZE must be positive")
+	}
+	return nil
+}
+
+// ConsignmentImportConfig holds the consignment bulk import configuration; see
+// consignment.ImportConfig
+type ConsignmentImportConfig struct {
+	Interval time.Duration // CONSIGNMENT_IMPORT_INTERVAL
+	MaxRows  int           // CONSIGNMENT_IMPORT_MAX_ROWS
+}
+
+// Validate checks the importer configuration.
+func (c ConsignmentImportConfig) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("CONSIGNMENT_IMPORT_INTERVAL must not be negative")
+	}
+	if c.Interval > 0 && c.MaxRows <= 0 {
+		return fmt.Errorf("CONSIGNMENT_IMPORT_MAX_ROWS must be positive")
+	}
+	return nil
+}
+
 type NotificationConfig struct {
 	ConfigPath   string
 	SMTPHost     string
@@ -109,6 +179,9 @@ func Load() (*Config, error) {
 			ClientIDs:             parseCommaSeparated(getEnvOrDefault("AUTH_CLIENT_IDS", "TRADER_PORTAL_APP,FCAU_TO_NSW,NPQS_TO_NSW,IRD_TO_NSW")),
 			InsecureSkipTLSVerify: getBoolOrDefault("AUTH_JWKS_INSECURE_SKIP_VERIFY", false),
 		},
+		Authz: AuthzConfig{
+			ClientServiceIDs: parseKeyValuePairs(getEnvOrDefault("AUTHZ_CLIENT_SERVICE_IDS", "FCAU_TO_NSW=fcau,NPQS_TO_NSW=npqs")),
+		},
 		Notification: NotificationConfig{
 			ConfigPath:   getEnvOrDefault("NOTIFICATIONS_CONFIG_PATH", "configs/notifications.json"),
 			SMTPHost:     getEnvOrDefault("EMAIL_SMTP_HOST", "localhost"),
@@ -131,6 +204,19 @@ func Load() (*Config, error) {
 			GitHubBaseURL:         getEnvOrDefault("BLOBSOURCE_GITHUB_BASE_URL", ""),
 			GitHubRefreshInterval: getDurationOrDefault("BLOBSOURCE_GITHUB_REFRESH_INTERVAL", 0),
 		},
+		PaymentExpiry: PaymentExpiryConfig{
+			Interval:  getDurationOrDefault("PAYMENT_EXPIRY_SWEEP_INTERVAL", time.Minute),
+			Grace:     getDurationOrDefault("PAYMENT_EXPIRY_GRACE", 15*time.Minute),
+			BatchSize: getIntEnvOrDefault("PAYMENT_EXPIRY_BATCH_SIZE", 100),
+		},
+		WorkflowMonitor: ConsignmentMonitorConfig{
+			Interval:  getDurationOrDefault("CONSIGNMENT_MONITOR_INTERVAL", 5*time.Minute),
+			BatchSize: getIntEnvOrDefault("CONSIGNMENT_MONITOR_BATCH_SIZE", 100),
+		},
+		ConsignmentImport: ConsignmentImportConfig{
+			Interval: getDurationOrDefault("CONSIGNMENT_IMPORT_INTERVAL", 5*time.Second),
+			MaxRows:  getIntEnvOrDefault("CONSIGNMENT_IMPORT_MAX_ROWS", 1000),
+		},
 	}
 
 	// Validate required fields
@@ -164,6 +250,15 @@ func (c *Config) Validate() error {
 	if err := c.BlobSource.Validate(); err != nil {
 		return fmt.Errorf("invalid blobsource configuration: %w", err)
 	}
+	if err := c.PaymentExpiry.Validate(); err != nil {
+		return fmt.Errorf("invalid payment expiry configuration: %w", err)
+	}
+	if err := c.WorkflowMonitor.Validate(); err != nil {
+		return fmt.Errorf("invalid workflow monitor configuration: %w", err)
+	}
+	if err := c.ConsignmentImport.Validate(); err != nil {
+		return fmt.Errorf("invalid consignment import configuration: %w", err)
+	}
 	if len(c.CORS.AllowedOrigins) == 0 {
 		return fmt.Errorf("CORS_ALLOWED_ORIGINS is required")
 	}
@@ -238,6 +333,21 @@ func parseCommaSeparated(value string) []string {
 	return result
 }
 
+// parseKeyValuePairs parses a comma-separated list of key=value pairs into a map.
+// Entries without a '=' or with an empty key or value are ignored.
+func parseKeyValuePairs(value string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range parseCommaSeparated(value) {
+		key, val, ok := strings.Cut(pair, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !ok || key == "" || val == "" {
+			continue
+		}
+		result[key] = val
+	}
+	return result
+}
+
 func parseLogLevel(level string) slog.Level {
 	switch strings.ToLower(level) {
 	case "debug":
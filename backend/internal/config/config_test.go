@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestLoadTemporalDefaults(t *testing.T) {
@@ -60,3 +61,95 @@ func TestLoadTemporalInvalidPortFallsBackToDefault(t *testing.T) {
 		t.Fatalf("Port = %d, want default %d", cfg.Temporal.Port, 7233)
 	}
 }
+
+func TestLoadAuthzClientServiceIDs(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "test")
+	t.Setenv("AUTHZ_CLIENT_SERVICE_IDS", " FCAU_TO_NSW = fcau ,NPQS_TO_NSW=npqs,broken,=x")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	got := cfg.Authz.ClientServiceIDs
+	if len(got) != 2 || got["FCAU_TO_NSW"] != "fcau" || got["NPQS_TO_NSW"] != "npqs" {
+		t.Fatalf("ClientServiceIDs = %v", got)
+	}
+}
+
+func TestLoadPaymentExpiry(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "test")
+	t.Setenv("PAYMENT_EXPIRY_SWEEP_INTERVAL", "")
+	t.Setenv("PAYMENT_EXPIRY_GRACE", "")
+	t.Setenv("PAYMENT_EXPIRY_BATCH_SIZE", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.PaymentExpiry.Interval != time.Minute {
+		t.Fatalf("Interval default = %v, want %v", cfg.PaymentExpiry.Interval, time.Minute)
+	}
+	if cfg.PaymentExpiry.Grace != 15*time.Minute {
+		t.Fatalf("Grace default = %v, want %v", cfg.PaymentExpiry.Grace, 15*time.Minute)
+	}
+	if cfg.PaymentExpiry.BatchSize != 100 {
+		t.Fatalf("BatchSize default = %d, want %d", cfg.PaymentExpiry.BatchSize, 100)
+	}
+
+	t.Setenv("PAYMENT_EXPIRY_GRACE", "-1m")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load() accepted a negative PAYMENT_EXPIRY_GRACE")
+	}
+}
+
+func TestPaymentExpiryConfigValidate(t *testing.T) {
+	if err := (PaymentExpiryConfig{}).Validate(); err != nil {
+		t.Fatalf("zero interval should disable the sweeper, got %v", err)
+	}
+	if err := (PaymentExpiryConfig{Interval: time.Minute, Grace: time.Minute, BatchSize: 10}).Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	for _, c := range []PaymentExpiryConfig{
+		{Interval: -time.Second},
+		{Grace: -time.Second},
+		{Interval: time.Minute},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) accepted an invalid configuration", c)
+		}
+	}
+}
+
+func TestConsignmentMonitorConfigValidate(t *testing.T) {
+	if err := (ConsignmentMonitorConfig{}).Validate(); err != nil {
+		t.Fatalf("zero interval should disable the monitor, got %v", err)
+	}
+	if err := (ConsignmentMonitorConfig{Interval: time.Minute, BatchSize: 10}).Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	for _, c := range []ConsignmentMonitorConfig{
+		{Interval: -time.Second},
+		{Interval: time.Minute},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) accepted an invalid configuration", c)
+		}
+	}
+}
+
+func TestConsignmentImportConfigValidate(t *testing.T) {
+	if err := (ConsignmentImportConfig{}).Validate(); err != nil {
+		t.Fatalf("zero interval should disable imports, got %v", err)
+	}
+	if err := (ConsignmentImportConfig{Interval: time.Second, MaxRows: 1000}).Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	for _, c := range []ConsignmentImportConfig{
+		{Interval: -time.Second},
+		{Interval: time.Second},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) accepted an invalid configuration", c)
+		}
+	}
+}
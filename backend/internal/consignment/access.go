@@ -0,0 +1,176 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+// IdP role names that select the consignment list perspective. They must match
+// the roles provisioned for TraderApp users in the identity provider.
+const (
+	RoleTrader = "Trader"
+	RoleCHA    = "CHA"
+)
+
+// List perspectives accepted by GET /api/v1/consignments?role=.
+const (
+	listRoleTrader = "trader"
+	listRoleCHA    = "cha"
+)
+
+// ErrRoleNotHeld is returned when a caller asks for a list perspective backed by
+// an IdP role they do not hold.
+var ErrRoleNotHeld = errors.New("caller does not hold the role required for this view")
+
+// Accessor is the caller a consignment operation is performed for. The router
+// derives it from the authenticated principal; the service evaluates it against
+// the consignment access policy. It satisfies authz.Principal, authz.OrgMember
+// and authz.Contactable.
+type Accessor struct {
+	subject  string
+	email    string
+	ouHandle string
+	roles    []string
+}
+
+// NewUserAccessor builds an Accessor for a TraderApp user.
+func NewUserAccessor(userID, email, ouHandle string, roles []string) *Accessor {
+	return &Accessor{subject: userID, email: email, ouHandle: ouHandle, roles: roles}
+}
+
+// NewClientAccessor builds an Accessor for a machine client (e.g. an OGA M2M
+// client). Clients carry no OU handle or e-mail.
+func NewClientAccessor(clientID string, roles []string) *Accessor {
+	return &Accessor{subject: clientID, roles: roles}
+}
+
+func (a *Accessor) Subject() string  { return a.subject }
+func (a *Accessor) Roles() []string  { return a.roles }
+func (a *Accessor) OUHandle() string { return a.ouHandle }
+func (a *Accessor) Email() string    { return a.email }
+
+// Scopes returns nil: scopes are enforced by the route-level gate before a
+// request reaches this package, and consignment access is decided on ownership.
+func (a *Accessor) Scopes() []string { return nil }
+
+// HasRole reports whether the accessor was granted the IdP role.
+func (a *Accessor) HasRole(role string) bool {
+	return a != nil && slices.Contains(a.roles, role)
+}
+
+// listRole resolves the list perspective (trader or cha) from the caller's IdP
+// roles. requested, taken from the optional role query parameter, only selects
+// between roles the caller actually holds; when empty the trader view is
+// preferred. Returns ErrRoleNotHeld if the caller holds no matching role.
+func listRole(a *Accessor, requested string) (string, error) {
+	switch requested {
+	case listRoleTrader:
+		if a.HasRole(RoleTrader) {
+			return listRoleTrader, nil
+		}
+		return "", ErrRoleNotHeld
+	case listRoleCHA:
+		if a.HasRole(RoleCHA) {
+			return listRoleCHA, nil
+		}
+		return "", ErrRoleNotHeld
+	case "":
+		if a.HasRole(RoleTrader) {
+			return listRoleTrader, nil
+		}
+		if a.HasRole(RoleCHA) {
+			return listRoleCHA, nil
+		}
+		return "", ErrRoleNotHeld
+	default:
+		return "", fmt.Errorf("unknown role %q: must be trader or cha", requested)
+	}
+}
+
+// RegisterAccessPolicy installs the policy used to authorize access to individual
+// consignments. Until one is registered a policy without machine-client mappings
+// is used, so only the owning trader/CHA users are admitted.
+func (s *Service) RegisterAccessPolicy(policy *authz.ConsignmentPolicy) error {
+	if policy == nil {
+		return fmt.Errorf("access policy cannot be nil")
+	}
+	s.accessPolicy = policy
+	return nil
+}
+
+// authorizeAccess enforces the consignment access policy for principal. A denied
+// or unauthenticated principal gets ErrConsignmentNotFound, so consignment IDs
+// cannot be probed; lookup failures are returned as-is.
+func (s *Service) authorizeAccess(ctx context.Context, principal authz.Principal, consignment *Consignment) error {
+	if principal == nil {
+		return ErrConsignmentNotFound
+	}
+	resource, err := s.consignmentResource(ctx, principal, consignment)
+	if err != nil {
+		return err
+	}
+	if err := s.accessPolicy.Authorize(principal, resource); err != nil {
+		if errors.Is(err, authz.ErrForbidden) || errors.Is(err, authz.ErrUnauthenticated) {
+			return ErrConsignmentNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// consignmentResource builds the ownership view the access policy evaluates. The
+// assigned CHA and the task dispatch targets are only looked up for principals
+// that could match on them (users with an e-mail, mapped machine clients).
+func (s *Service) consignmentResource(ctx context.Context, principal authz.Principal, consignment *Consignment) (*authz.ConsignmentResource, error) {
+	resource := &authz.ConsignmentResource{ConsignmentID: consignment.ID}
+
+	if authz.OUHandleOf(principal) != "" {
+		owners, err := s.ownerOUHandles(ctx, consignment)
+		if err != nil {
+			return nil, err
+		}
+		resource.OwnerOUHandles = owners
+	}
+
+	if authz.EmailOf(principal) != "" && consignment.CHAID != nil && *consignment.CHAID != "" {
+		chaRecord, err := s.chaService.GetByID(ctx, *consignment.CHAID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve assigned CHA of consignment %s: %w", consignment.ID, err)
+		}
+		resource.AssigneeEmails = []string{chaRecord.Email}
+	}
+
+	if s.accessPolicy.ServiceIDFor(principal) != "" && s.taskStore != nil {
+		for _, t := range s.taskStore.GetAllTasks(ctx, consignment.ID) {
+			if serviceID, ok := t.Data[plugins.DispatchedServiceIDKey].(string); ok && serviceID != "" {
+				resource.TaskServiceIDs = append(resource.TaskServiceIDs, serviceID)
+			}
+		}
+	}
+
+	return resource, nil
+}
+
+// ownerOUHandles resolves the OU handles of the trader company and, once
+// selected, the CHA company of consignment.
+func (s *Service) ownerOUHandles(ctx context.Context, consignment *Consignment) ([]string, error) {
+	companyIDs := []string{consignment.TraderCompanyID}
+	if consignment.CHACompanyID != nil && *consignment.CHACompanyID != "" {
+		companyIDs = append(companyIDs, *consignment.CHACompanyID)
+	}
+
+	handles := make([]string, 0, len(companyIDs))
+	for _, companyID := range companyIDs {
+		record, err := s.companyService.GetCompanyByID(ctx, companyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve owning company %s of consignment %s: %w", companyID, consignment.ID, err)
+		}
+		handles = append(handles, record.OUHandle)
+	}
+	return handles, nil
+}
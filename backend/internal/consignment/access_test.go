@@ -0,0 +1,227 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/profile/cha"
+	"github.com/OpenNSW/nsw/backend/internal/profile/company"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+func traderAccessor() *Accessor {
+	return NewUserAccessor("trader1", "trader@acme.test", "trader-ou", []string{RoleTrader})
+}
+
+func chaAccessor() *Accessor {
+	return NewUserAccessor("cha-user", "", "cha-ou", []string{RoleCHA})
+}
+
+// expectOwnerCompanies mocks the owner lookups of a consignment: the trader company resolves
+// to "trader-ou" and, when chaCompanyID is set, the CHA company to "cha-ou".
+func expectOwnerCompanies(m *MockCompanyService, traderCompanyID, chaCompanyID string) {
+	m.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, OUHandle: "trader-ou"}, nil)
+	if chaCompanyID != "" {
+		m.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
+	}
+}
+
+func TestListRole(t *testing.T) {
+	both := NewUserAccessor("u1", "", "ou", []string{RoleTrader, RoleCHA})
+	chaOnly := NewUserAccessor("u2", "", "ou", []string{RoleCHA})
+	none := NewUserAccessor("u3", "", "ou", nil)
+
+	cases := []struct {
+		name      string
+		accessor  *Accessor
+		requested string
+		want      string
+		wantErr   error
+	}{
+		{"default prefers trader", both, "", listRoleTrader, nil},
+		{"explicit cha when held", both, "cha", listRoleCHA, nil},
+		{"cha-only defaults to cha", chaOnly, "", listRoleCHA, nil},
+		{"trader not held", chaOnly, "trader", "", ErrRoleNotHeld},
+		{"cha not held", traderAccessor(), "cha", "", ErrRoleNotHeld},
+		{"no roles", none, "", "", ErrRoleNotHeld},
+		{"nil accessor", nil, "", "", ErrRoleNotHeld},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := listRole(tc.accessor, tc.requested)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := listRole(both, "admin")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRoleNotHeld)
+}
+
+func TestAccessor_SatisfiesAuthzSeams(t *testing.T) {
+	var p authz.Principal = traderAccessor()
+	assert.Equal(t, "trader-ou", authz.OUHandleOf(p))
+	assert.Equal(t, "trader@acme.test", authz.EmailOf(p))
+	assert.Nil(t, p.Scopes())
+
+	client := NewClientAccessor("NPQS_TO_NSW", []string{"AgencyM2M"})
+	assert.Equal(t, "NPQS_TO_NSW", client.Subject())
+	assert.Empty(t, authz.OUHandleOf(client))
+	assert.Empty(t, authz.EmailOf(client))
+}
+
+func TestConsignmentService_RegisterAccessPolicy_Nil(t *testing.T) {
+	svc := NewService(nil, nil, nil, nil, nil, nil, nil)
+	assert.Error(t, svc.RegisterAccessPolicy(nil))
+}
+
+func TestConsignmentService_GetConsignmentByID_OtherCompanyGetsNotFound(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockWM := new(MockWMV2)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+	require.NoError(t, svc.RegisterWorkflowManager(mockWM))
+
+	id := uuid.NewString()
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id"}).AddRow(id, "IN_PROGRESS", "company-trader"))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
+
+	outsider := NewUserAccessor("u9", "", "other-ou", []string{RoleTrader})
+	_, err := svc.GetConsignmentByID(context.Background(), outsider, id)
+	assert.ErrorIs(t, err, ErrConsignmentNotFound)
+	// The workflow must not be touched for a denied caller.
+	mockWM.AssertNotCalled(t, "GetStatus", mock.Anything, mock.Anything)
+}
+
+func TestConsignmentService_GetConsignmentByID_MissingIsNotFound(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := svc.GetConsignmentByID(context.Background(), traderAccessor(), "missing")
+	assert.ErrorIs(t, err, ErrConsignmentNotFound)
+}
+
+func TestConsignmentService_GetConsignmentByID_DBError(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WillReturnError(errors.New("connection reset"))
+
+	_, err := svc.GetConsignmentByID(context.Background(), traderAccessor(), "id")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrConsignmentNotFound)
+}
+
+func TestConsignmentService_GetConsignmentByID_AssignedCHAByEmail(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	mockCHA := new(MockCHAService)
+	mockTaskStore := new(MockTaskStore)
+	svc := NewService(db, nil, mockCHA, mockCompany, nil, nil, mockTaskStore)
+
+	id := uuid.NewString()
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id", "cha_id", "items"}).
+			AddRow(id, "INITIALIZED", "company-trader", "cha1", []byte("[]")))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
+	mockCHA.On("GetByID", mock.Anything, "cha1").Return(&cha.Record{ID: "cha1", Email: "agent@broker.test"}, nil)
+	mockTaskStore.On("GetAllTasks", mock.Anything, id).Return(([]tfstore.TaskRecord)(nil))
+
+	// Not an owning company member, but the individually assigned CHA.
+	assigned := NewUserAccessor("u7", "agent@broker.test", "freelance-ou", []string{RoleCHA})
+	result, err := svc.GetConsignmentByID(context.Background(), assigned, id)
+	require.NoError(t, err)
+	assert.Equal(t, id, result.ID)
+	mockCHA.AssertExpectations(t)
+}
+
+func TestConsignmentService_GetConsignmentByID_OGAClient(t *testing.T) {
+	policy, err := authz.NewConsignmentPolicy(map[string]string{"NPQS_TO_NSW": "npqs", "FCAU_TO_NSW": "fcau"})
+	require.NoError(t, err)
+
+	rows := func(id string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "state", "trader_company_id", "items"}).
+			AddRow(id, "INITIALIZED", "company-trader", []byte("[]"))
+	}
+	tasks := []tfstore.TaskRecord{
+		{TaskID: "t1", Data: map[string]any{plugins.DispatchedServiceIDKey: "npqs"}},
+		{TaskID: "t2", Data: map[string]any{}},
+	}
+
+	t.Run("service with a task is admitted", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		mockTaskStore := new(MockTaskStore)
+		svc := NewService(db, nil, nil, nil, nil, nil, mockTaskStore)
+		require.NoError(t, svc.RegisterAccessPolicy(policy))
+		id := uuid.NewString()
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).WithArgs(id, 1).WillReturnRows(rows(id))
+		mockTaskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+
+		_, err := svc.GetConsignmentByID(context.Background(), NewClientAccessor("NPQS_TO_NSW", nil), id)
+		assert.NoError(t, err)
+	})
+
+	t.Run("service without a task gets not found", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		mockTaskStore := new(MockTaskStore)
+		svc := NewService(db, nil, nil, nil, nil, nil, mockTaskStore)
+		require.NoError(t, svc.RegisterAccessPolicy(policy))
+		id := uuid.NewString()
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).WithArgs(id, 1).WillReturnRows(rows(id))
+		mockTaskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+
+		_, err := svc.GetConsignmentByID(context.Background(), NewClientAccessor("FCAU_TO_NSW", nil), id)
+		assert.ErrorIs(t, err, ErrConsignmentNotFound)
+	})
+
+	t.Run("unmapped client gets not found without a task lookup", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		mockTaskStore := new(MockTaskStore)
+		svc := NewService(db, nil, nil, nil, nil, nil, mockTaskStore)
+		require.NoError(t, svc.RegisterAccessPolicy(policy))
+		id := uuid.NewString()
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).WithArgs(id, 1).WillReturnRows(rows(id))
+
+		_, err := svc.GetConsignmentByID(context.Background(), NewClientAccessor("UNKNOWN", nil), id)
+		assert.ErrorIs(t, err, ErrConsignmentNotFound)
+		mockTaskStore.AssertNotCalled(t, "GetAllTasks", mock.Anything, mock.Anything)
+	})
+}
+
+func TestConsignmentService_InitializeConsignmentByID_OtherCompanyGetsNotFound(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	mockCHA := new(MockCHAService)
+	svc := NewService(db, nil, mockCHA, mockCompany, nil, nil, nil)
+
+	id := uuid.NewString()
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id", "cha_company_id"}).AddRow(id, "INITIALIZED", "company-trader", "company-cha"))
+	expectOwnerCompanies(mockCompany, "company-trader", "company-cha")
+
+	outsider := NewUserAccessor("u9", "", "other-ou", []string{RoleCHA})
+	_, err := svc.InitializeConsignmentByID(context.Background(), outsider, id, []string{"hs1"}, "cha1")
+	assert.ErrorIs(t, err, ErrConsignmentNotFound)
+	mockCHA.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,404 @@
+package consignment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+
+	workflowmanager "github.com/OpenNSW/go-temporal-workflow"
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+	taskstore "github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+)
+
+// TaskActivator starts the task of a parent workflow node. taskv2's
+// orchestrator.TaskManager satisfies it.
+type TaskActivator interface {
+	StartTask(payload workflowmanager.TaskPayload) (map[string]any, error)
+}
+
+// WorkflowSignaller tells a parent workflow that the task at a node it already completed
+// was run again. workflow.Signaller satisfies it on the shared Temporal client.
+type WorkflowSignaller interface {
+	SignalTaskRevised(ctx context.Context, workflowID, nodeID string, outputs map[string]any) error
+}
+
+// SetTaskActivator installs the task manager that StartTask and AmendConsignment start
+// tasks through.
+func (s *Service) SetTaskActivator(activator TaskActivator) {
+	s.activator = activator
+}
+
+// SetWorkflowSignaller installs the signaller RecordTaskCompletion passes the outcomes of
+// re-opened tasks on with.
+func (s *Service) SetWorkflowSignaller(signaller WorkflowSignaller) {
+	s.signaller = signaller
+}
+
+// StartTask starts the task of a parent workflow node, as the parent runner's TaskActivator.
+// Once a consignment has been amended, the inputs a node maps from its global context are
+// taken from the consignment's copy, which only differs from the workflow's where the
+// trader amended it, so tasks reached after an amendment see the corrected values. Tasks
+// of consignments never amended, of SPLIT_TASK child workflows and of workflows that are
+// not consignments are started unchanged.
+func (s *Service) StartTask(payload workflowmanager.TaskPayload) (map[string]any, error) {
+	if s.activator == nil {
+		return nil, fmt.Errorf("no task activator registered for ConsignmentService")
+	}
+	var consignment Consignment
+	err := s.db.Select("id", "global_context", "workflow_definition").
+		Where("EXISTS (SELECT 1 FROM consignment_amendments WHERE consignment_id = consignments.id)").
+		First(&consignment, "id = ?", payload.WorkflowID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", payload.WorkflowID, err)
+	}
+	if node, ok := consignment.node(payload.NodeID); ok {
+		inputs := make(map[string]any, len(payload.Inputs))
+		for k, v := range payload.Inputs {
+			inputs[k] = v
+		}
+		for k, v := range nodeInputs(node, consignment.GlobalContext) {
+			inputs[k] = v
+		}
+		payload.Inputs = inputs
+	}
+	return s.activator.StartTask(payload)
+}
+
+// RecordTaskCompletion copies the outputs of the task completed at parentNodeID into the
+// global context of the consignment run by parentWorkflowID, through the node's output
+// mapping, as the parent workflow does with them. A task at a node an amendment re-opened
+// completes after the parent workflow moved past that node, so its outcome, an OGA's
+// re-review decision for instance, is signalled to the workflow instead of completing the
+// node again. RecordTaskCompletion reports whether it did so; other completions are left
+// to the caller to pass on. Workflows that are not consignments, SPLIT_TASK children
+// among them, are not looked at further.
+func (s *Service) RecordTaskCompletion(ctx context.Context, parentWorkflowID, parentNodeID string, outputs map[string]any) (bool, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).Select("id", "workflow_definition").
+		First(&consignment, "id = ?", parentWorkflowID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to retrieve consignment %s: %w", parentWorkflowID, err)
+	}
+	node, ok := consignment.node(parentNodeID)
+	if !ok {
+		return false, nil
+	}
+
+	mapped := make(map[string]any, len(node.OutputMapping))
+	for outputKey, globalKey := range node.OutputMapping {
+		if v, ok := outputs[outputKey]; ok {
+			mapped[globalKey] = v
+		}
+	}
+	if len(mapped) > 0 {
+		values, err := json.Marshal(mapped)
+		if err != nil {
+			return false, fmt.Errorf("failed to encode outputs of node %s: %w", parentNodeID, err)
+		}
+		// Merged in place, so no lock is needed against an amendment writing other keys.
+		if err := s.db.WithContext(ctx).Model(&Consignment{}).Where("id = ?", parentWorkflowID).
+			UpdateColumn("global_context", gorm.Expr("global_context || ?::jsonb", string(values))).Error; err != nil {
+			return false, fmt.Errorf("failed to record outputs of node %s: %w", parentNodeID, err)
+		}
+	}
+
+	amended, err := s.nodeAmended(ctx, parentWorkflowID, parentNodeID)
+	if err != nil || !amended {
+		return false, err
+	}
+	if s.signaller == nil {
+		return false, fmt.Errorf("no workflow signaller registered for ConsignmentService")
+	}
+	if err := s.signaller.SignalTaskRevised(ctx, parentWorkflowID, parentNodeID, outputs); err != nil {
+		return false, fmt.Errorf("failed to pass on the revised outcome of node %s: %w", parentNodeID, err)
+	}
+	return true, nil
+}
+
+// nodeAmended reports whether an amendment of the consignment re-opened the task at nodeID.
+func (s *Service) nodeAmended(ctx context.Context, consignmentID, nodeID string) (bool, error) {
+	pattern, err := json.Marshal([]map[string]string{{"nodeId": nodeID}})
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&Amendment{}).
+		Where("consignment_id = ? AND tasks @> ?::jsonb", consignmentID, string(pattern)).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to look up amendments of consignment %s: %w", consignmentID, err)
+	}
+	return count > 0, nil
+}
+
+// AmendConsignment changes global context values of an IN_PROGRESS consignment on behalf of
+// its trader. Completed tasks whose nodes map a changed key as input are superseded and
+// their nodes activated again with the new values: a task that went to an OGA is sent back
+// for review, any other is re-opened, returning to the trader where it takes input. The
+// changes, with the values before and after, and the tasks affected are kept as an
+// Amendment. Only keys the context already holds and the trader owns can be changed (see
+// traderOwned), and not while a task that consumed one of them is still running.
+func (s *Service) AmendConsignment(ctx context.Context, principal authz.Principal, consignmentID string, req AmendConsignmentDTO) (*AmendmentDTO, error) {
+	if s.taskStore == nil {
+		return nil, fmt.Errorf("task store not initialized")
+	}
+	if s.activator == nil {
+		return nil, fmt.Errorf("no task activator registered for ConsignmentService")
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	var consignment Consignment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+	if err := s.authorizeAccess(ctx, principal, &consignment); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTrader(ctx, principal, &consignment); err != nil {
+		return nil, err
+	}
+	if consignment.State != InProgress {
+		return nil, fmt.Errorf("%w (current state: %s)", ErrConsignmentNotAmendable, consignment.State)
+	}
+	if consignment.WorkflowDefinition == nil {
+		return nil, fmt.Errorf("%w: its workflow context was not recorded when it started", ErrConsignmentNotAmendable)
+	}
+
+	tasks := s.taskStore.GetAllTasks(ctx, consignment.ID)
+	changes, err := contextChanges(consignment.GlobalContext, req.Changes, traderOwned(&consignment, tasks))
+	if err != nil {
+		return nil, err
+	}
+	reopen, err := consumingTasks(&consignment, tasks, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	amendment := Amendment{
+		ID:            uuid.NewString(),
+		ConsignmentID: consignment.ID,
+		AmendedBy:     principal.Subject(),
+		Reason:        req.Reason,
+		Changes:       changes,
+		Tasks:         make([]AmendedTask, len(reopen)),
+	}
+	reopenIDs := make([]string, len(reopen))
+	for i, t := range reopen {
+		reopenIDs[i] = t.TaskID
+		action := AmendmentReopened
+		if serviceID, _ := t.Data[plugins.DispatchedServiceIDKey].(string); serviceID != "" {
+			action = AmendmentOGARereview
+		}
+		amendment.Tasks[i] = AmendedTask{TaskID: t.TaskID, NodeID: t.ParentNodeID, Action: action}
+	}
+
+	for _, c := range changes {
+		consignment.GlobalContext[c.Key] = c.After
+	}
+	if err := tx.Model(&consignment).Select("global_context").Updates(&consignment).Error; err != nil {
+		return nil, fmt.Errorf("failed to update consignment: %w", err)
+	}
+	if err := s.taskStore.SupersedeTasks(ctx, tx, reopenIDs); err != nil {
+		return nil, fmt.Errorf("failed to supersede tasks: %w", err)
+	}
+	if err := tx.Create(&amendment).Error; err != nil {
+		return nil, fmt.Errorf("failed to record amendment: %w", err)
+	}
+	keys := make([]string, len(changes))
+	for i, c := range changes {
+		keys[i] = c.Key
+	}
+	if err := timeline.Append(ctx, tx, timeline.Event{
+		ConsignmentID: consignment.ID,
+		Type:          timeline.ConsignmentAmended,
+		Actor:         amendment.AmendedBy,
+		Details:       map[string]any{"amendmentId": amendment.ID, "keys": keys, "reopenedTasks": reopenIDs},
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	// The amendment is committed before its nodes run again, so that RecordTaskCompletion
+	// signals the new tasks' outcomes to the parent workflow rather than completing the
+	// nodes a second time.
+	var errs []error
+	for _, t := range reopen {
+		node, _ := consignment.node(t.ParentNodeID)
+		if _, err := s.activator.StartTask(workflowmanager.TaskPayload{
+			WorkflowID:     t.ParentWorkflowID,
+			RunID:          t.ParentRunID,
+			NodeID:         t.ParentNodeID,
+			TaskTemplateID: node.TaskTemplateID,
+			Inputs:         nodeInputs(node, consignment.GlobalContext),
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("task %s: %w", t.TaskID, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("amendment %s was recorded but its tasks could not all be re-opened: %w", amendment.ID, err)
+	}
+
+	slog.InfoContext(ctx, "consignment amended", "consignmentId", consignment.ID,
+		"amendmentId", amendment.ID, "amendedBy", amendment.AmendedBy, "tasks", reopenIDs)
+	dto := amendment.toDTO()
+	return &dto, nil
+}
+
+// ListAmendments returns the amendment history of a consignment, oldest first, on behalf of
+// principal.
+func (s *Service) ListAmendments(ctx context.Context, principal authz.Principal, consignmentID string) ([]AmendmentDTO, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+	if err := s.authorizeAccess(ctx, principal, &consignment); err != nil {
+		return nil, err
+	}
+
+	var amendments []Amendment
+	if err := s.db.WithContext(ctx).
+		Where("consignment_id = ?", consignmentID).
+		Order("created_at").
+		Find(&amendments).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve amendments: %w", err)
+	}
+	dtos := make([]AmendmentDTO, len(amendments))
+	for i := range amendments {
+		dtos[i] = amendments[i].toDTO()
+	}
+	return dtos, nil
+}
+
+// node returns the parent workflow node nodeID of the consignment's recorded definition.
+func (c *Consignment) node(nodeID string) (workflowmanager.Node, bool) {
+	if c.WorkflowDefinition == nil {
+		return workflowmanager.Node{}, false
+	}
+	for _, n := range c.WorkflowDefinition.Nodes {
+		if n.ID == nodeID {
+			return n, true
+		}
+	}
+	return workflowmanager.Node{}, false
+}
+
+// nodeInputs resolves the inputs node maps from the global context.
+func nodeInputs(node workflowmanager.Node, globalContext map[string]any) map[string]any {
+	inputs := make(map[string]any, len(node.InputMapping))
+	for globalKey, inputKey := range node.InputMapping {
+		if v, ok := globalContext[globalKey]; ok {
+			inputs[inputKey] = v
+		}
+	}
+	return inputs
+}
+
+// contextChanges lists, by key, the values of requested that differ from the global
+// context. Every key must already be in the context and be owned by the trader.
+func contextChanges(globalContext, requested map[string]any, owned func(key string) bool) ([]ContextChange, error) {
+	changes := make([]ContextChange, 0, len(requested))
+	for key, after := range requested {
+		before, ok := globalContext[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownContextKey, key)
+		}
+		if !owned(key) {
+			return nil, fmt.Errorf("%w: %s", ErrContextKeyNotAmendable, key)
+		}
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, ContextChange{Key: key, Before: before, After: after})
+		}
+	}
+	if len(changes) == 0 {
+		return nil, ErrNothingToAmend
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+// traderOwned reports whether the trader owns a global context key of the consignment:
+// one no node of its workflow writes, so that it came with the submission, or one only
+// USER_INPUT tasks write through their nodes' output mappings. Keys an OGA review, a
+// payment or any other task writes are the workflow's record of what happened and cannot
+// be amended, nor can keys of nodes no task has run for yet.
+func traderOwned(consignment *Consignment, tasks []tfstore.TaskRecord) func(key string) bool {
+	nodeTypes := make(map[string]string)
+	for _, t := range tasks {
+		if t.ParentWorkflowID == consignment.ID {
+			nodeTypes[t.ParentNodeID] = t.TaskType
+		}
+	}
+	writers := make(map[string][]string)
+	for _, n := range consignment.WorkflowDefinition.Nodes {
+		for _, key := range n.OutputMapping {
+			writers[key] = append(writers[key], nodeTypes[n.ID])
+		}
+		if n.SplitTask != nil && n.SplitTask.ResultsVariable != "" {
+			writers[n.SplitTask.ResultsVariable] = append(writers[n.SplitTask.ResultsVariable], "")
+		}
+	}
+	return func(key string) bool {
+		for _, taskType := range writers[key] {
+			if taskType != plugins.TaskTypeUserInput {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// consumingTasks lists the completed tasks of the parent workflow whose nodes map one of
+// the changed keys as input. It returns ErrAmendmentConflict when such a task is still
+// running. Tasks of SPLIT_TASK child workflows take their inputs from their item, not the
+// global context, and are not considered.
+func consumingTasks(consignment *Consignment, tasks []tfstore.TaskRecord, changes []ContextChange) ([]tfstore.TaskRecord, error) {
+	var consuming []tfstore.TaskRecord
+	for _, t := range tasks {
+		if t.ParentWorkflowID != consignment.ID {
+			continue
+		}
+		node, ok := consignment.node(t.ParentNodeID)
+		if !ok || !mapsAny(node.InputMapping, changes) {
+			continue
+		}
+		switch t.State {
+		case "COMPLETED":
+			consuming = append(consuming, t)
+		case taskstore.StateSuperseded, taskstore.StateFailed, taskstore.StateCancelled:
+		default:
+			return nil, fmt.Errorf("%w: task %s (%s)", ErrAmendmentConflict, t.TaskID, t.State)
+		}
+	}
+	return consuming, nil
+}
+
+func mapsAny(inputMapping map[string]string, changes []ContextChange) bool {
+	for _, c := range changes {
+		if _, ok := inputMapping[c.Key]; ok {
+			return true
+		}
+	}
+	return false
+}
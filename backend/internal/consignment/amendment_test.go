@@ -0,0 +1,383 @@
+package consignment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	workflowmanager "github.com/OpenNSW/go-temporal-workflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+)
+
+// recordingActivator records the task payloads started, failing on failOn.
+type recordingActivator struct {
+	started []workflowmanager.TaskPayload
+	failOn  string
+}
+
+func (a *recordingActivator) StartTask(payload workflowmanager.TaskPayload) (map[string]any, error) {
+	if payload.NodeID == a.failOn {
+		return nil, errors.New("task manager unavailable")
+	}
+	a.started = append(a.started, payload)
+	return nil, nil
+}
+
+// The general information form writes the consignee; the FCAU review reads it and records
+// its outcome, and the customs declaration reads the destination.
+const amendableDefinition = `{"id":"wt-1","nodes":[` +
+	`{"id":"node_gi","type":"TASK","task_template_id":"tt-gi","output_mapping":{"consignee:name":"gi:consignee:name","destination":"gi:destination"}},` +
+	`{"id":"node_review","type":"TASK","task_template_id":"tt-review","input_mapping":{"gi:consignee:name":"consignee_name"},"output_mapping":{"outcome":"fcau.application_review_outcome"}},` +
+	`{"id":"node_cusdec","type":"TASK","task_template_id":"tt-cusdec","input_mapping":{"gi:destination":"destination"}}]}`
+
+func expectAmendableConsignment(sqlMock sqlmock.Sqlmock, id string, state State, definition string) {
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1 ORDER BY "consignments"."id" LIMIT \$2 FOR UPDATE`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_id", "trader_company_id", "cha_company_id", "items", "global_context", "workflow_definition"}).
+			AddRow(id, state, "trader1", "company-trader", "company-cha", []byte(`[]`),
+				[]byte(`{"fcau.application_review_outcome":"approve","gi:consignee:name":"Acme Ltd","gi:destination":"LK","items":[]}`), definition))
+}
+
+func amendService(t *testing.T) (*Service, sqlmock.Sqlmock, *MockTaskStore, *recordingActivator) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	expectOwnerCompanies(mockCompany, "company-trader", "company-cha")
+	mockTaskStore := new(MockTaskStore)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, mockTaskStore)
+	activator := &recordingActivator{}
+	svc.SetTaskActivator(activator)
+	return svc, sqlMock, mockTaskStore, activator
+}
+
+func TestConsignmentService_AmendConsignment(t *testing.T) {
+	const id = "cons-1"
+	req := AmendConsignmentDTO{Changes: map[string]any{"gi:consignee:name": "Acme Holdings Ltd"}, Reason: "Consignee renamed"}
+
+	t.Run("sends the consuming review back to its OGA", func(t *testing.T) {
+		svc, sqlMock, taskStore, activator := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, amendableDefinition)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord{
+			{TaskID: "t-gi", TaskType: "USER_INPUT", State: "COMPLETED", ParentWorkflowID: id, ParentNodeID: "node_gi"},
+			{TaskID: "t-review", TaskType: "EXTERNAL_REVIEW", State: "COMPLETED", ParentWorkflowID: id, ParentRunID: "run-1", ParentNodeID: "node_review",
+				Data: map[string]any{"dispatched_service_id": "fcau"}},
+			{TaskID: "t-cusdec", State: "PENDING_USER", ParentWorkflowID: id, ParentNodeID: "node_cusdec"},
+		})
+		sqlMock.ExpectExec(`UPDATE "consignments" SET "updated_at"=\$1,"global_context"=\$2 WHERE "id" = \$3`).
+			WithArgs(sqlmock.AnyArg(), `{"fcau.application_review_outcome":"approve","gi:consignee:name":"Acme Holdings Ltd","gi:destination":"LK","items":[]}`, id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		taskStore.On("SupersedeTasks", mock.Anything, mock.Anything, []string{"t-review"}).Return(nil)
+		sqlMock.ExpectExec(`INSERT INTO "consignment_amendments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentAmended, "", "")
+		sqlMock.ExpectCommit()
+
+		amendment, err := svc.AmendConsignment(context.Background(), traderAccessor(), id, req)
+		require.NoError(t, err)
+		assert.Equal(t, "trader1", amendment.AmendedBy)
+		assert.Equal(t, []ContextChange{{Key: "gi:consignee:name", Before: "Acme Ltd", After: "Acme Holdings Ltd"}}, amendment.Changes)
+		assert.Equal(t, []AmendedTask{{TaskID: "t-review", NodeID: "node_review", Action: AmendmentOGARereview}}, amendment.Tasks)
+		assert.Equal(t, []workflowmanager.TaskPayload{{
+			WorkflowID: id, RunID: "run-1", NodeID: "node_review", TaskTemplateID: "tt-review",
+			Inputs: map[string]any{"consignee_name": "Acme Holdings Ltd"},
+		}}, activator.started)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("refused while a consuming task runs", func(t *testing.T) {
+		svc, sqlMock, taskStore, activator := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, amendableDefinition)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord{
+			{TaskID: "t-gi", TaskType: "USER_INPUT", State: "COMPLETED", ParentWorkflowID: id, ParentNodeID: "node_gi"},
+			{TaskID: "t-cusdec", State: "PENDING_USER", ParentWorkflowID: id, ParentNodeID: "node_cusdec"},
+		})
+		sqlMock.ExpectRollback()
+
+		_, err := svc.AmendConsignment(context.Background(), traderAccessor(), id,
+			AmendConsignmentDTO{Changes: map[string]any{"gi:destination": "IN"}, Reason: "Rerouted"})
+		assert.ErrorIs(t, err, ErrAmendmentConflict)
+		assert.Empty(t, activator.started)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		svc, sqlMock, taskStore, _ := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, amendableDefinition)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord(nil))
+
+		_, err := svc.AmendConsignment(context.Background(), traderAccessor(), id,
+			AmendConsignmentDTO{Changes: map[string]any{"gi:quantity": 10}, Reason: "Typo"})
+		assert.ErrorIs(t, err, ErrUnknownContextKey)
+	})
+
+	t.Run("review outcome written by the OGA", func(t *testing.T) {
+		svc, sqlMock, taskStore, activator := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, amendableDefinition)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord{
+			{TaskID: "t-gi", TaskType: "USER_INPUT", State: "COMPLETED", ParentWorkflowID: id, ParentNodeID: "node_gi"},
+			{TaskID: "t-review", TaskType: "EXTERNAL_REVIEW", State: "COMPLETED", ParentWorkflowID: id, ParentNodeID: "node_review"},
+		})
+
+		_, err := svc.AmendConsignment(context.Background(), traderAccessor(), id,
+			AmendConsignmentDTO{Changes: map[string]any{"fcau.application_review_outcome": "approve", "gi:destination": "IN"}, Reason: "Rerouted"})
+		assert.ErrorIs(t, err, ErrContextKeyNotAmendable)
+		assert.Empty(t, activator.started)
+	})
+
+	t.Run("finished consignment", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, Finished, amendableDefinition)
+
+		_, err := svc.AmendConsignment(context.Background(), traderAccessor(), id, req)
+		assert.ErrorIs(t, err, ErrConsignmentNotAmendable)
+	})
+
+	t.Run("consignment started without a recorded definition", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, "")
+
+		_, err := svc.AmendConsignment(context.Background(), traderAccessor(), id, req)
+		assert.ErrorIs(t, err, ErrConsignmentNotAmendable)
+	})
+
+	t.Run("only the trader may amend", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, amendableDefinition)
+
+		_, err := svc.AmendConsignment(context.Background(), chaAccessor(), id, req)
+		assert.ErrorIs(t, err, ErrNotConsignmentTrader)
+	})
+}
+
+func TestTraderOwned(t *testing.T) {
+	const id = "cons-1"
+	consignment := &Consignment{ID: id, WorkflowDefinition: &workflowmanager.WorkflowDefinition{Nodes: []workflowmanager.Node{
+		{ID: "node_gi", OutputMapping: map[string]string{"consignee": "gi:consignee"}},
+		{ID: "node_review", OutputMapping: map[string]string{"decision": "fcau.application_review_outcome"}},
+		{ID: "node_fee", OutputMapping: map[string]string{"status": "fcau.app_fee_payment_status"}},
+		{ID: "node_cusdec", OutputMapping: map[string]string{"reference": "cusdec:reference"}},
+	}}}
+	owned := traderOwned(consignment, []tfstore.TaskRecord{
+		{TaskType: "USER_INPUT", ParentWorkflowID: id, ParentNodeID: "node_gi"},
+		{TaskType: "EXTERNAL_REVIEW", ParentWorkflowID: id, ParentNodeID: "node_review"},
+		{TaskType: "PAYMENT", ParentWorkflowID: id, ParentNodeID: "node_fee"},
+	})
+
+	assert.True(t, owned("gi:consignee"), "written by the trader's form")
+	assert.True(t, owned("exporter:tin"), "submitted with the consignment")
+	assert.False(t, owned("fcau.application_review_outcome"))
+	assert.False(t, owned("fcau.app_fee_payment_status"))
+	assert.False(t, owned("cusdec:reference"), "no task has run for the node yet")
+}
+
+func TestContextChanges(t *testing.T) {
+	current := map[string]any{"a": "x", "b": float64(2), "c": map[string]any{"d": true}}
+	owned := func(string) bool { return true }
+
+	changes, err := contextChanges(current, map[string]any{"c": map[string]any{"d": false}, "a": "x", "b": float64(3)}, owned)
+	require.NoError(t, err)
+	assert.Equal(t, []ContextChange{
+		{Key: "b", Before: float64(2), After: float64(3)},
+		{Key: "c", Before: map[string]any{"d": true}, After: map[string]any{"d": false}},
+	}, changes)
+
+	_, err = contextChanges(current, map[string]any{"a": "x"}, owned)
+	assert.ErrorIs(t, err, ErrNothingToAmend)
+
+	_, err = contextChanges(current, map[string]any{"b": float64(3)}, func(key string) bool { return key != "b" })
+	assert.ErrorIs(t, err, ErrContextKeyNotAmendable)
+}
+
+func TestConsignmentService_StartTask(t *testing.T) {
+	const id = "cons-1"
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+	activator := &recordingActivator{}
+	svc.SetTaskActivator(activator)
+
+	amended := `SELECT "id","global_context","workflow_definition" FROM "consignments" WHERE ` +
+		`EXISTS \(SELECT 1 FROM consignment_amendments WHERE consignment_id = consignments.id\) AND id = \$1`
+	sqlMock.ExpectQuery(amended).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "global_context", "workflow_definition"}).
+			AddRow(id, []byte(`{"gi:consignee:name":"Acme Holdings Ltd"}`), amendableDefinition))
+	_, err := svc.StartTask(workflowmanager.TaskPayload{WorkflowID: id, NodeID: "node_review",
+		Inputs: map[string]any{"consignee_name": "Acme Ltd", "other": 1}})
+	require.NoError(t, err)
+
+	// Consignments never amended and SPLIT_TASK children are started as they come.
+	sqlMock.ExpectQuery(amended).
+		WithArgs(id+"--split--b1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "global_context", "workflow_definition"}))
+	_, err = svc.StartTask(workflowmanager.TaskPayload{WorkflowID: id + "--split--b1", NodeID: "node_review",
+		Inputs: map[string]any{"consignee_name": "Acme Ltd"}})
+	require.NoError(t, err)
+
+	require.Len(t, activator.started, 2)
+	assert.Equal(t, map[string]any{"consignee_name": "Acme Holdings Ltd", "other": 1}, activator.started[0].Inputs)
+	assert.Equal(t, map[string]any{"consignee_name": "Acme Ltd"}, activator.started[1].Inputs)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+// recordingSignaller records the revised task outcomes signalled, failing with err.
+type recordingSignaller struct {
+	revised []map[string]any
+	err     error
+}
+
+func (r *recordingSignaller) SignalTaskRevised(_ context.Context, workflowID, nodeID string, outputs map[string]any) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.revised = append(r.revised, map[string]any{"workflowId": workflowID, "nodeId": nodeID, "outputs": outputs})
+	return nil
+}
+
+func TestConsignmentService_RecordTaskCompletion(t *testing.T) {
+	const id = "cons-1"
+	setup := func(t *testing.T) (*Service, sqlmock.Sqlmock, *recordingSignaller) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, nil, nil)
+		signaller := &recordingSignaller{}
+		svc.SetWorkflowSignaller(signaller)
+		return svc, sqlMock, signaller
+	}
+	expectDefinition := func(sqlMock sqlmock.Sqlmock) {
+		sqlMock.ExpectQuery(`SELECT "id","workflow_definition" FROM "consignments" WHERE id = \$1`).
+			WithArgs(id, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_definition"}).AddRow(id, amendableDefinition))
+	}
+	expectAmendedNode := func(sqlMock sqlmock.Sqlmock, node string, count int) {
+		sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "consignment_amendments" WHERE consignment_id = \$1 AND tasks @> \$2::jsonb`).
+			WithArgs(id, `[{"nodeId":"`+node+`"}]`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+
+	t.Run("records outputs through the output mapping", func(t *testing.T) {
+		svc, sqlMock, signaller := setup(t)
+		expectDefinition(sqlMock)
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`UPDATE "consignments" SET "global_context"=global_context \|\| \$1::jsonb WHERE id = \$2`).
+			WithArgs(`{"gi:consignee:name":"Acme Ltd"}`, id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+		expectAmendedNode(sqlMock, "node_gi", 0)
+
+		revised, err := svc.RecordTaskCompletion(context.Background(), id, "node_gi", map[string]any{"consignee:name": "Acme Ltd", "draft": true})
+		require.NoError(t, err)
+		assert.False(t, revised)
+		assert.Empty(t, signaller.revised)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("re-review outcome is signalled to the workflow", func(t *testing.T) {
+		svc, sqlMock, signaller := setup(t)
+		expectDefinition(sqlMock)
+		expectAmendedNode(sqlMock, "node_review", 1)
+
+		revised, err := svc.RecordTaskCompletion(context.Background(), id, "node_review", map[string]any{"decision": "REJECTED"})
+		require.NoError(t, err)
+		assert.True(t, revised)
+		assert.Equal(t, []map[string]any{{"workflowId": id, "nodeId": "node_review",
+			"outputs": map[string]any{"decision": "REJECTED"}}}, signaller.revised)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("a failed signal is retried with the completion", func(t *testing.T) {
+		svc, sqlMock, signaller := setup(t)
+		signaller.err = errors.New("temporal unavailable")
+		expectDefinition(sqlMock)
+		expectAmendedNode(sqlMock, "node_review", 1)
+
+		_, err := svc.RecordTaskCompletion(context.Background(), id, "node_review", map[string]any{"decision": "REJECTED"})
+		assert.ErrorContains(t, err, "temporal unavailable")
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("workflows that are not consignments", func(t *testing.T) {
+		svc, sqlMock, _ := setup(t)
+		sqlMock.ExpectQuery(`SELECT "id","workflow_definition" FROM "consignments" WHERE id = \$1`).
+			WithArgs(id+"--split--b1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_definition"}))
+
+		revised, err := svc.RecordTaskCompletion(context.Background(), id+"--split--b1", "node_review", nil)
+		require.NoError(t, err)
+		assert.False(t, revised)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestConsignmentRouter_HandleAmendConsignment(t *testing.T) {
+	const id = "cons-1"
+
+	t.Run("reserved key", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v1/consignments/"+id+"/amendments",
+			bytes.NewBufferString(`{"changes":{"items":[]},"reason":"Wrong items"}`))
+		req.SetPathValue("id", id)
+		req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+		w := httptest.NewRecorder()
+		NewRouter(NewService(nil, nil, nil, nil, nil, nil, nil), nil, nil).HandleAmendConsignment(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"items" cannot be amended`)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		svc, sqlMock, taskStore, _ := amendService(t)
+		sqlMock.ExpectBegin()
+		expectAmendableConsignment(sqlMock, id, InProgress, amendableDefinition)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord{
+			{TaskID: "t-gi", TaskType: "USER_INPUT", State: "COMPLETED", ParentWorkflowID: id, ParentNodeID: "node_gi"},
+			{TaskID: "t-review", State: "QUEUED_EXTERNALLY", ParentWorkflowID: id, ParentNodeID: "node_review"},
+		})
+
+		req, _ := http.NewRequest("POST", "/api/v1/consignments/"+id+"/amendments",
+			bytes.NewBufferString(`{"changes":{"gi:consignee:name":"Acme Holdings Ltd"},"reason":"Consignee renamed"}`))
+		req.SetPathValue("id", id)
+		req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+		w := httptest.NewRecorder()
+		NewRouter(svc, nil, nil).HandleAmendConsignment(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "t-review")
+	})
+}
+
+func TestConsignmentRouter_HandleListAmendments(t *testing.T) {
+	const id = "cons-1"
+	svc, sqlMock, _, _ := amendService(t)
+	expectConsignment(sqlMock, id, InProgress)
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignment_amendments" WHERE consignment_id = \$1 ORDER BY created_at`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "consignment_id", "amended_by", "reason", "changes", "tasks", "created_at"}).
+			AddRow("am-1", id, "trader1", "Consignee renamed",
+				[]byte(`[{"key":"gi:consignee:name","before":"Acme Ltd","after":"Acme Holdings Ltd"}]`),
+				[]byte(`[{"taskId":"t-review","nodeId":"node_review","action":"OGA_REREVIEW"}]`), time.Now()))
+
+	req, _ := http.NewRequest("GET", "/api/v1/consignments/"+id+"/amendments", nil)
+	req.SetPathValue("id", id)
+	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+	w := httptest.NewRecorder()
+	NewRouter(svc, nil, nil).HandleListAmendments(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"before":"Acme Ltd","after":"Acme Holdings Ltd"`)
+	assert.Contains(t, w.Body.String(), `"action":"OGA_REREVIEW"`)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
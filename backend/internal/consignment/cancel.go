@@ -0,0 +1,294 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+	taskstore "github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/pkg/remote"
+)
+
+// WorkflowCanceller requests cancellation of running workflows by ID.
+// workflow.Canceller satisfies it on the shared Temporal client.
+// Cancelling a workflow that has already closed must succeed.
+type WorkflowCanceller interface {
+	CancelWorkflow(ctx context.Context, workflowID string) error
+}
+
+// OGANotifier calls an OGA service. remote.Manager satisfies it.
+type OGANotifier interface {
+	Call(ctx context.Context, serviceID string, req remote.Request, response interface{}) error
+}
+
+// SetWorkflowCanceller installs the canceller used by CancelConsignment.
+func (s *Service) SetWorkflowCanceller(canceller WorkflowCanceller) {
+	s.canceller = canceller
+}
+
+// SetOGANotifier installs the client used to tell OGAs about cancelled consignments.
+func (s *Service) SetOGANotifier(notifier OGANotifier) {
+	s.ogaNotifier = notifier
+}
+
+// closedTaskStates are task record states that need no cancelling.
+var closedTaskStates = map[string]bool{
+	"COMPLETED":               true,
+	taskstore.StateFailed:     true,
+	taskstore.StateCancelled:  true,
+	taskstore.StateSuperseded: true,
+}
+
+// consignmentCancelledEvent is the event name OGAs receive at their cancel_path.
+const consignmentCancelledEvent = "CONSIGNMENT_CANCELLED"
+
+// CancelConsignment withdraws a consignment on behalf of its trader, in three steps so
+// that no workflow is cancelled while a database transaction is open:
+//
+//  1. Under the consignment's row lock, the OGA decisions are checked and the
+//     consignment is moved to CANCELLING with the reason. Once any OGA has decided on
+//     a dispatched review, ErrOGADecisionIssued is returned and nothing is changed.
+//     The decision path does not share the lock, so a decision recorded just after
+//     the check is not caught.
+//  2. The parent workflow, its SPLIT_TASK children and the open task workflows are
+//     cancelled. Cancelling a closed workflow succeeds, so this step can be repeated.
+//  3. The open tasks and the consignment are marked CANCELLED.
+//
+// A failure in step 2 or 3 leaves the consignment CANCELLING; cancelling it again
+// resumes from step 2 with the reason first given. OGAs with an outstanding review are
+// then notified. A consignment never started is cancelled in step 1.
+func (s *Service) CancelConsignment(ctx context.Context, principal authz.Principal, consignmentID, reason string) (*DetailDTO, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+	if err := s.authorizeAccess(ctx, principal, &consignment); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTrader(ctx, principal, &consignment); err != nil {
+		return nil, err
+	}
+	if !cancellable(consignment.State) {
+		return nil, fmt.Errorf("%w (current state: %s)", ErrConsignmentNotCancellable, consignment.State)
+	}
+	if consignment.State != Initialized {
+		if s.taskStore == nil {
+			return nil, fmt.Errorf("task store not initialized")
+		}
+		if s.canceller == nil {
+			return nil, fmt.Errorf("no workflow canceller registered for ConsignmentService")
+		}
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockConsignment(tx, &consignment); err != nil {
+			return err
+		}
+		previousState := consignment.State
+		switch previousState {
+		case Initialized:
+			consignment.State = Cancelled
+		case InProgress:
+			// A decision that lands after this check does not advance the
+			// consignment: the parent workflow is still cancelled in step 2.
+			if decided := decidedReviews(s.taskStore.GetAllTasks(ctx, consignment.ID)); len(decided) > 0 {
+				return fmt.Errorf("%w: task %s", ErrOGADecisionIssued, decided[0])
+			}
+			consignment.State = Cancelling
+		case Cancelling:
+			return nil
+		default:
+			return fmt.Errorf("%w (current state: %s)", ErrConsignmentNotCancellable, consignment.State)
+		}
+		now := time.Now()
+		consignment.CancelReason = reason
+		consignment.CancelledBy = principal.Subject()
+		consignment.CancelledAt = &now
+		if err := tx.Save(&consignment).Error; err != nil {
+			return fmt.Errorf("failed to update consignment: %w", err)
+		}
+		return timeline.Append(ctx, tx, stateChanged(&consignment, previousState, principal.Subject(), map[string]any{"reason": reason}))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if consignment.State == Cancelling {
+		open, err := s.finishCancellation(ctx, principal, &consignment)
+		if err != nil {
+			return nil, err
+		}
+		s.notifyOGAsOfCancellation(ctx, &consignment, open)
+	}
+
+	hsCodeMap, err := s.getHSCodeMap(ctx, consignment.Items)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildConsignmentDetailDTO(ctx, &consignment, hsCodeMap)
+}
+
+// finishCancellation cancels the workflows of a CANCELLING consignment and then marks
+// its open tasks and the consignment CANCELLED. It returns the tasks it cancelled.
+func (s *Service) finishCancellation(ctx context.Context, principal authz.Principal, consignment *Consignment) ([]tfstore.TaskRecord, error) {
+	for _, workflowID := range workflowsToCancel(consignment.ID, openTasks(s.taskStore.GetAllTasks(ctx, consignment.ID))) {
+		if err := s.canceller.CancelWorkflow(ctx, workflowID); err != nil {
+			return nil, fmt.Errorf("failed to cancel workflow %s: %w", workflowID, err)
+		}
+	}
+
+	var open []tfstore.TaskRecord
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockConsignment(tx, consignment); err != nil {
+			return err
+		}
+		if consignment.State != Cancelling {
+			return nil // finished by a concurrent request
+		}
+		// Read again now the workflows are stopped: a task started meanwhile is
+		// cancelled too.
+		open = openTasks(s.taskStore.GetAllTasks(ctx, consignment.ID))
+		if len(open) > 0 {
+			openIDs := make([]string, len(open))
+			for i, t := range open {
+				openIDs[i] = t.TaskID
+			}
+			if err := s.taskStore.CancelTasks(ctx, tx, openIDs); err != nil {
+				return fmt.Errorf("failed to cancel tasks: %w", err)
+			}
+		}
+		consignment.State = Cancelled
+		if err := tx.Save(consignment).Error; err != nil {
+			return fmt.Errorf("failed to update consignment: %w", err)
+		}
+		return timeline.Append(ctx, tx, stateChanged(consignment, Cancelling, principal.Subject(), nil))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return open, nil
+}
+
+// cancellable reports whether a consignment in state st may be withdrawn, or its
+// withdrawal resumed.
+func cancellable(st State) bool {
+	return st == Initialized || st == InProgress || st == Cancelling
+}
+
+// lockConsignment reloads consignment inside tx holding its row lock.
+func lockConsignment(tx *gorm.DB, consignment *Consignment) error {
+	var locked Consignment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ?", consignment.ID).Error; err != nil {
+		return fmt.Errorf("failed to lock consignment %s: %w", consignment.ID, err)
+	}
+	*consignment = locked
+	return nil
+}
+
+// authorizeTrader admits only members of the consignment's trader company; the CHA may
+// see the consignment but not withdraw it.
+func (s *Service) authorizeTrader(ctx context.Context, principal authz.Principal, consignment *Consignment) error {
+	ouHandle := authz.OUHandleOf(principal)
+	if ouHandle == "" {
+		return ErrNotConsignmentTrader
+	}
+	traderCompany, err := s.companyService.GetCompanyByID(ctx, consignment.TraderCompanyID)
+	if err != nil {
+		return fmt.Errorf("trader company lookup failed: %w", err)
+	}
+	if traderCompany.OUHandle != ouHandle {
+		return ErrNotConsignmentTrader
+	}
+	return nil
+}
+
+// decidedReviews lists the tasks an OGA has already acted on: dispatched for external
+// review and since moved on from awaiting the decision.
+func decidedReviews(tasks []tfstore.TaskRecord) []string {
+	var ids []string
+	for _, t := range tasks {
+		serviceID, _ := t.Data[plugins.DispatchedServiceIDKey].(string)
+		if serviceID != "" && t.State != plugins.StateQueuedExternally && t.State != taskstore.StateCancelled {
+			ids = append(ids, t.TaskID)
+		}
+	}
+	return ids
+}
+
+func openTasks(tasks []tfstore.TaskRecord) []tfstore.TaskRecord {
+	var open []tfstore.TaskRecord
+	for _, t := range tasks {
+		if !closedTaskStates[t.State] {
+			open = append(open, t)
+		}
+	}
+	return open
+}
+
+// workflowsToCancel lists the workflows of a consignment that may still be running,
+// innermost first: the open tasks' own workflows, the SPLIT_TASK child workflows they
+// were started from, then the parent workflow (the consignment ID).
+func workflowsToCancel(consignmentID string, open []tfstore.TaskRecord) []string {
+	seen := map[string]bool{consignmentID: true}
+	var ids []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, t := range open {
+		add(t.TaskWorkflowID)
+	}
+	for _, t := range open {
+		add(t.ParentWorkflowID)
+	}
+	return append(ids, consignmentID)
+}
+
+// notifyOGAsOfCancellation tells each OGA with an outstanding review that the consignment
+// was withdrawn, at the cancel_path recorded when the review was dispatched. The
+// cancellation has already been committed, so failures are logged rather than returned.
+func (s *Service) notifyOGAsOfCancellation(ctx context.Context, consignment *Consignment, open []tfstore.TaskRecord) {
+	for _, t := range open {
+		if t.State != plugins.StateQueuedExternally {
+			continue
+		}
+		serviceID, _ := t.Data[plugins.DispatchedServiceIDKey].(string)
+		path, _ := t.Data[plugins.DispatchedCancelPathKey].(string)
+		if serviceID == "" {
+			continue
+		}
+		if path == "" || s.ogaNotifier == nil {
+			slog.WarnContext(ctx, "consignment cancelled with a review outstanding at a service without a cancel_path",
+				"consignmentId", consignment.ID, "taskId", t.TaskID, "serviceId", serviceID)
+			continue
+		}
+		req := remote.Request{
+			Method: "POST",
+			Path:   path,
+			Body: map[string]any{
+				"event":         consignmentCancelledEvent,
+				"taskId":        t.TaskID,
+				"consignmentId": consignment.ID,
+				"reason":        consignment.CancelReason,
+			},
+		}
+		if err := s.ogaNotifier.Call(ctx, serviceID, req, nil); err != nil {
+			slog.ErrorContext(ctx, "failed to notify OGA of consignment cancellation",
+				"consignmentId", consignment.ID, "taskId", t.TaskID, "serviceId", serviceID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package consignment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/pkg/remote"
+)
+
+// recordingCanceller records the workflows cancelled, failing on failOn.
+type recordingCanceller struct {
+	cancelled []string
+	failOn    string
+}
+
+func (c *recordingCanceller) CancelWorkflow(_ context.Context, workflowID string) error {
+	if workflowID == c.failOn {
+		return errors.New("temporal unavailable")
+	}
+	c.cancelled = append(c.cancelled, workflowID)
+	return nil
+}
+
+type recordingNotifier struct {
+	calls []remote.Request
+	to    []string
+}
+
+func (n *recordingNotifier) Call(_ context.Context, serviceID string, req remote.Request, _ interface{}) error {
+	n.to = append(n.to, serviceID)
+	n.calls = append(n.calls, req)
+	return nil
+}
+
+func expectConsignment(sqlMock sqlmock.Sqlmock, id string, state State) {
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_id", "trader_company_id", "cha_company_id", "items", "created_at", "updated_at"}).
+			AddRow(id, state, "EXPORT", "trader1", "company-trader", "company-cha", []byte(`[]`), time.Now(), time.Now()))
+}
+
+// expectCancellingConsignment expects the consignment to be read, locked, as
+// left CANCELLING with reason.
+func expectCancellingConsignment(sqlMock sqlmock.Sqlmock, id, reason string) {
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1 .*FOR UPDATE`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_id", "trader_company_id", "cha_company_id", "items", "cancel_reason", "cancelled_by", "cancelled_at", "created_at", "updated_at"}).
+			AddRow(id, Cancelling, "EXPORT", "trader1", "company-trader", "company-cha", []byte(`[]`), reason, "trader1", time.Now(), time.Now(), time.Now()))
+}
+
+func cancelService(t *testing.T) (*Service, sqlmock.Sqlmock, *MockTaskStore, *recordingCanceller, *recordingNotifier) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	expectOwnerCompanies(mockCompany, "company-trader", "company-cha")
+	mockTaskStore := new(MockTaskStore)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, mockTaskStore)
+	canceller := &recordingCanceller{}
+	notifier := &recordingNotifier{}
+	svc.SetWorkflowCanceller(canceller)
+	svc.SetOGANotifier(notifier)
+	return svc, sqlMock, mockTaskStore, canceller, notifier
+}
+
+// A consignment with a review queued at FCAU, a finished form and a split branch
+// still in progress.
+func inFlightTasks(id string) []tfstore.TaskRecord {
+	return []tfstore.TaskRecord{
+		{TaskID: "t-review", TaskType: "FORM", State: "QUEUED_EXTERNALLY", ParentWorkflowID: id, TaskWorkflowID: "tw-review",
+			Data: map[string]any{"dispatched_service_id": "fcau", "dispatched_cancel_path": "/api/oga/cancellations"}},
+		{TaskID: "t-form", TaskType: "FORM", State: "COMPLETED", ParentWorkflowID: id, TaskWorkflowID: "tw-form"},
+		{TaskID: "t-branch", TaskType: "FORM", State: "IN_PROGRESS", ParentWorkflowID: id + "--split--b1", TaskWorkflowID: "tw-branch"},
+	}
+}
+
+func TestConsignmentService_CancelConsignment(t *testing.T) {
+	const id = "cons-1"
+
+	t.Run("withdraws an in-progress consignment", func(t *testing.T) {
+		svc, sqlMock, taskStore, canceller, notifier := cancelService(t)
+		expectConsignment(sqlMock, id, InProgress)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(inFlightTasks(id))
+		// The withdrawal is committed before any workflow is touched.
+		sqlMock.ExpectBegin()
+		expectConsignment(sqlMock, id, InProgress)
+		sqlMock.ExpectExec(`UPDATE "consignments" SET .*"state"=\$\d+.*"cancel_reason"=\$\d+,"cancelled_by"=\$\d+`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "IN_PROGRESS", "CANCELLING")
+		sqlMock.ExpectCommit()
+		sqlMock.ExpectBegin()
+		expectCancellingConsignment(sqlMock, id, "Buyer withdrew the order")
+		taskStore.On("CancelTasks", mock.Anything, mock.Anything, []string{"t-review", "t-branch"}).Return(nil)
+		sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "CANCELLING", "CANCELLED")
+		sqlMock.ExpectCommit()
+
+		result, err := svc.CancelConsignment(context.Background(), traderAccessor(), id, "Buyer withdrew the order")
+		require.NoError(t, err)
+		assert.Equal(t, Cancelled, result.State)
+		assert.Equal(t, "Buyer withdrew the order", result.CancelReason)
+		assert.NotEmpty(t, result.CancelledAt)
+		assert.Equal(t, []string{"tw-review", "tw-branch", id + "--split--b1", id}, canceller.cancelled)
+
+		require.Len(t, notifier.calls, 1)
+		assert.Equal(t, "fcau", notifier.to[0])
+		assert.Equal(t, "/api/oga/cancellations", notifier.calls[0].Path)
+		assert.Equal(t, map[string]any{
+			"event": "CONSIGNMENT_CANCELLED", "taskId": "t-review", "consignmentId": id, "reason": "Buyer withdrew the order",
+		}, notifier.calls[0].Body)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("withdraws a consignment not yet started", func(t *testing.T) {
+		svc, sqlMock, taskStore, canceller, _ := cancelService(t)
+		expectConsignment(sqlMock, id, Initialized)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(([]tfstore.TaskRecord)(nil))
+		sqlMock.ExpectBegin()
+		expectConsignment(sqlMock, id, Initialized)
+		sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "INITIALIZED", "CANCELLED")
+		sqlMock.ExpectCommit()
+
+		result, err := svc.CancelConsignment(context.Background(), traderAccessor(), id, "Duplicate")
+		require.NoError(t, err)
+		assert.Equal(t, Cancelled, result.State)
+		assert.Empty(t, canceller.cancelled)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("refused once an OGA has decided", func(t *testing.T) {
+		svc, sqlMock, taskStore, canceller, notifier := cancelService(t)
+		expectConsignment(sqlMock, id, InProgress)
+		tasks := inFlightTasks(id)
+		tasks[0].State = "COMPLETED"
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1 .*FOR UPDATE`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(id, InProgress))
+		sqlMock.ExpectRollback()
+
+		_, err := svc.CancelConsignment(context.Background(), traderAccessor(), id, "Too late")
+		assert.ErrorIs(t, err, ErrOGADecisionIssued)
+		assert.Empty(t, canceller.cancelled)
+		assert.Empty(t, notifier.calls)
+		taskStore.AssertNotCalled(t, "CancelTasks", mock.Anything, mock.Anything, mock.Anything)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("workflow cancellation failure leaves it cancelling", func(t *testing.T) {
+		svc, sqlMock, taskStore, canceller, notifier := cancelService(t)
+		canceller.failOn = id
+		expectConsignment(sqlMock, id, InProgress)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(inFlightTasks(id))
+		sqlMock.ExpectBegin()
+		expectConsignment(sqlMock, id, InProgress)
+		sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "IN_PROGRESS", "CANCELLING")
+		sqlMock.ExpectCommit()
+
+		_, err := svc.CancelConsignment(context.Background(), traderAccessor(), id, "Buyer withdrew the order")
+		assert.ErrorContains(t, err, "failed to cancel workflow cons-1")
+		assert.Empty(t, notifier.calls)
+		taskStore.AssertNotCalled(t, "CancelTasks", mock.Anything, mock.Anything, mock.Anything)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("cancelling again resumes", func(t *testing.T) {
+		svc, sqlMock, taskStore, canceller, notifier := cancelService(t)
+		expectConsignment(sqlMock, id, Cancelling)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(inFlightTasks(id))
+		sqlMock.ExpectBegin()
+		expectCancellingConsignment(sqlMock, id, "Buyer withdrew the order")
+		sqlMock.ExpectCommit()
+		sqlMock.ExpectBegin()
+		expectCancellingConsignment(sqlMock, id, "Buyer withdrew the order")
+		taskStore.On("CancelTasks", mock.Anything, mock.Anything, []string{"t-review", "t-branch"}).Return(nil)
+		sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "CANCELLING", "CANCELLED")
+		sqlMock.ExpectCommit()
+
+		result, err := svc.CancelConsignment(context.Background(), traderAccessor(), id, "Again")
+		require.NoError(t, err)
+		assert.Equal(t, Cancelled, result.State)
+		assert.Equal(t, []string{"tw-review", "tw-branch", id + "--split--b1", id}, canceller.cancelled,
+			"workflows already closed are cancelled again harmlessly")
+		assert.Equal(t, "Buyer withdrew the order", result.CancelReason, "the first reason stands")
+		require.Len(t, notifier.calls, 1)
+		assert.Equal(t, "Buyer withdrew the order", notifier.calls[0].Body.(map[string]any)["reason"])
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("CHA may not cancel", func(t *testing.T) {
+		svc, sqlMock, _, _, _ := cancelService(t)
+		expectConsignment(sqlMock, id, InProgress)
+
+		_, err := svc.CancelConsignment(context.Background(), chaAccessor(), id, "Not mine")
+		assert.ErrorIs(t, err, ErrNotConsignmentTrader)
+	})
+
+	t.Run("finished consignment", func(t *testing.T) {
+		svc, sqlMock, _, _, _ := cancelService(t)
+		expectConsignment(sqlMock, id, Finished)
+
+		_, err := svc.CancelConsignment(context.Background(), traderAccessor(), id, "Too late")
+		assert.ErrorIs(t, err, ErrConsignmentNotCancellable)
+	})
+}
+
+func TestConsignmentRouter_HandleCancelConsignment(t *testing.T) {
+	const id = "cons-1"
+	cancel := func(svc *Service, body string, roles ...string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/consignments/"+id+"/cancel", bytes.NewBufferString(body))
+		req.SetPathValue("id", id)
+		req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", roles...))
+		w := httptest.NewRecorder()
+		NewRouter(svc, nil, nil).HandleCancelConsignment(w, req)
+		return w
+	}
+
+	t.Run("reason is required", func(t *testing.T) {
+		svc := NewService(nil, nil, nil, nil, nil, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, cancel(svc, `{"reason":"  "}`, RoleTrader).Code)
+	})
+
+	t.Run("conflict once an OGA has decided", func(t *testing.T) {
+		svc, sqlMock, taskStore, _, _ := cancelService(t)
+		expectConsignment(sqlMock, id, InProgress)
+		tasks := inFlightTasks(id)
+		tasks[0].State = "COMPLETED"
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+		sqlMock.ExpectBegin()
+		expectConsignment(sqlMock, id, InProgress)
+		sqlMock.ExpectRollback()
+
+		w := cancel(svc, `{"reason":"Buyer withdrew the order"}`, RoleTrader)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "already issued a decision")
+	})
+}
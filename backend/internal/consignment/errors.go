@@ -9,4 +9,69 @@ var (
 	// ErrCHACompanyMismatch is returned at Stage 2 when the CHA attempting to claim a
 	// consignment does not belong to the CHA company chosen by the trader at Stage 1.
 	ErrCHACompanyMismatch = errors.New("CHA does not belong to the consignment's CHA company")
+
+	// ErrConsignmentNotFound is returned when no consignment exists with the requested ID.
+	ErrConsignmentNotFound = errors.New("consignment not found")
+
+	// ErrNoWorkflowTemplate is returned when WorkflowTemplateMap has no template for an HS code
+	// in the consignment's flow.
+	ErrNoWorkflowTemplate = errors.New("no workflow template found")
+
+	// ErrTemplateNotInFlow is returned when an explicitly requested workflow template is not
+	// mapped to the consignment's flow in WorkflowTemplateMap.
+	ErrTemplateNotInFlow = errors.New("workflow template is not available for the consignment flow")
+
+	// ErrTemplateNotForHSCode is returned when a direct start names both a workflow template
+	// and an HS code that WorkflowTemplateMap does not map to that template in the flow.
+	ErrTemplateNotForHSCode = errors.New("workflow template is not mapped to the HS code")
+
+	// ErrContextKeyWorkflowOwned is returned when a direct start passes a context key that a
+	// node of the workflow writes.
+	ErrContextKeyWorkflowOwned = errors.New("context key is set by the workflow")
+
+	// ErrNotConsignmentTrader is returned when someone other than a member of the consignment's
+	// trader company attempts a trader-only action such as cancelling it.
+	ErrNotConsignmentTrader = errors.New("only the consignment's trader may perform this action")
+
+	// ErrConsignmentNotCancellable is returned when cancelling a consignment that has already
+	// finished or been cancelled.
+	ErrConsignmentNotCancellable = errors.New("consignment can no longer be cancelled")
+
+	// ErrOGADecisionIssued is returned when cancelling a consignment on which an OGA has already
+	// issued a decision.
+	ErrOGADecisionIssued = errors.New("an OGA has already issued a decision on the consignment")
+
+	// ErrConsignmentNotRetryable is returned when retrying a consignment that is neither FAILED
+	// nor STALLED.
+	ErrConsignmentNotRetryable = errors.New("only FAILED or STALLED consignments can be retried")
+
+	// ErrConsignmentNotAmendable is returned when amending a consignment that is not
+	// IN_PROGRESS, or whose workflow context was not recorded when it started.
+	ErrConsignmentNotAmendable = errors.New("consignment cannot be amended")
+
+	// ErrUnknownContextKey is returned when an amendment names a key the consignment's global
+	// context does not hold.
+	ErrUnknownContextKey = errors.New("unknown global context key")
+
+	// ErrContextKeyNotAmendable is returned when an amendment names a key the trader does not
+	// own, such as an OGA review outcome or a payment status.
+	ErrContextKeyNotAmendable = errors.New("global context key cannot be amended by the trader")
+
+	// ErrNothingToAmend is returned when every value of an amendment equals the current one.
+	ErrNothingToAmend = errors.New("the amendment changes no value")
+
+	// ErrAmendmentConflict is returned when a task that consumed an amended key is still
+	// running; the amendment can be made once it completes.
+	ErrAmendmentConflict = errors.New("a task using the amended values is still in progress")
+
+	// ErrInvalidCursor is returned when a list cursor was not issued for the requested sort.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrImportNotFound is returned when no bulk import the caller may see exists with the
+	// requested ID.
+	ErrImportNotFound = errors.New("consignment import not found")
+
+	// ErrImportFileNotFound is returned when a bulk import names a file that was not uploaded
+	// by the trader's company.
+	ErrImportFileNotFound = errors.New("import file was not uploaded by the trader's company")
 )
@@ -0,0 +1,139 @@
+package consignment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+// exportPaidStatuses are the payment statuses whose amounts count towards a consignment's
+// paid total. Keep in sync with paymentsv2.paidStatuses; the payments package is not
+// imported here.
+var exportPaidStatuses = []string{"SUCCESS", "REFUND_REQUIRED", "REFUND_PENDING", "REFUNDED"}
+
+// exportColumns is the header row of a consignment export.
+var exportColumns = []string{
+	"id", "flow", "state", "traderReference", "traderCompanyId", "chaCompanyId", "chaId",
+	"hsCodes", "tasksCompleted", "tasksTotal", "ogaTasks", "paidTotal",
+	"failureReason", "createdAt", "updatedAt", "finishedAt",
+}
+
+// exportRow is one consignment of an export as selected by exportSelect.
+type exportRow struct {
+	ID              string     `gorm:"column:id"`
+	Flow            Flow       `gorm:"column:flow"`
+	State           State      `gorm:"column:state"`
+	TraderReference string     `gorm:"column:trader_reference"`
+	TraderCompanyID string     `gorm:"column:trader_company_id"`
+	CHACompanyID    *string    `gorm:"column:cha_company_id"`
+	CHAID           *string    `gorm:"column:cha_id"`
+	HSCodes         *string    `gorm:"column:hs_codes"`
+	TasksCompleted  int        `gorm:"column:tasks_completed"`
+	TasksTotal      int        `gorm:"column:tasks_total"`
+	OGATasks        *string    `gorm:"column:oga_tasks"`
+	PaidTotal       *string    `gorm:"column:paid_total"`
+	FailureReason   string     `gorm:"column:failure_reason"`
+	CreatedAt       time.Time  `gorm:"column:created_at"`
+	UpdatedAt       time.Time  `gorm:"column:updated_at"`
+	FinishedAt      *time.Time `gorm:"column:finished_at"`
+}
+
+func (r *exportRow) record() []string {
+	finishedAt := ""
+	if r.FinishedAt != nil {
+		finishedAt = r.FinishedAt.Format(time.RFC3339)
+	}
+	return []string{
+		r.ID, string(r.Flow), string(r.State), r.TraderReference, r.TraderCompanyID, deref(r.CHACompanyID), deref(r.CHAID),
+		deref(r.HSCodes), strconv.Itoa(r.TasksCompleted), strconv.Itoa(r.TasksTotal), deref(r.OGATasks), deref(r.PaidTotal),
+		r.FailureReason, r.CreatedAt.Format(time.RFC3339), r.UpdatedAt.Format(time.RFC3339), finishedAt,
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// exportSelect adds the export columns to a consignment query. HS codes, the latest task
+// of each OGA (service: state) and the amounts paid per currency are aggregated by
+// correlated subqueries, so every consignment is a single row of the result.
+func exportSelect(q *gorm.DB) *gorm.DB {
+	return q.Select(fmt.Sprintf(`consignments.id, consignments.flow, consignments.state, consignments.trader_reference,
+		consignments.trader_company_id, consignments.cha_company_id, consignments.cha_id,
+		consignments.failure_reason, consignments.created_at, consignments.updated_at, consignments.finished_at,
+		COALESCE(task_progress.completed, 0) AS tasks_completed, COALESCE(task_progress.total, 0) AS tasks_total,
+		(SELECT string_agg(h.hs_code, '; ' ORDER BY h.hs_code) FROM hs_codes h
+			WHERE consignments.items @> jsonb_build_array(jsonb_build_object('hsCodeId', h.id))) AS hs_codes,
+		(SELECT string_agg(t.service_id || ': ' || t.state, '; ' ORDER BY t.service_id) FROM (
+			SELECT DISTINCT ON (r.data->>'%[1]s') r.data->>'%[1]s' AS service_id, r.state FROM task_records_v2 r
+			WHERE r.root_workflow_id = consignments.id AND r.data->>'%[1]s' <> ''
+			ORDER BY r.data->>'%[1]s', r.created_at DESC) t) AS oga_tasks,
+		(SELECT string_agg(p.currency || ' ' || p.total, '; ' ORDER BY p.currency) FROM (
+			SELECT pt.currency, sum(pt.amount) AS total FROM payment_transactions pt
+			WHERE pt.status IN ? AND (pt.consignment_id = consignments.id
+				OR pt.task_id IN (SELECT r.task_id FROM task_records_v2 r WHERE r.root_workflow_id = consignments.id))
+			GROUP BY pt.currency) p) AS paid_total`, plugins.DispatchedServiceIDKey), exportPaidStatuses).
+		Joins("LEFT JOIN task_progress ON task_progress.root_workflow_id = consignments.id")
+}
+
+// ExportConsignments writes every consignment of the company filter is scoped to that
+// matches its filters, in its sort order, to w as a format ("csv" or "xlsx") file.
+// Pagination is ignored. Rows are streamed from the open result set as they are read, so
+// exports of any size are never held in memory. Nothing is written to w when the query
+// fails, so the error can still be reported to the caller.
+func (s *Service) ExportConsignments(ctx context.Context, filter Filter, format string, w io.Writer) error {
+	baseQuery, err := s.companyQuery(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return s.exportConsignments(baseQuery, filter, format, w)
+}
+
+// ExportAllConsignments exports consignments across all companies for support staff, as
+// ExportConsignments does. Company filters are ignored.
+func (s *Service) ExportAllConsignments(ctx context.Context, filter Filter, format string, w io.Writer) error {
+	return s.exportConsignments(s.db.WithContext(ctx).Model(&Consignment{}), filter, format, w)
+}
+
+func (s *Service) exportConsignments(baseQuery *gorm.DB, filter Filter, format string, w io.Writer) error {
+	if filter.Sort == "" {
+		filter.Sort = SortCreatedDesc
+	}
+	rows, err := exportSelect(applyListFilters(baseQuery, filter)).
+		Order(filter.Sort.orderBy()).
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to export consignments: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out, err := newExportWriter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := out.Write(exportColumns); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var row exportRow
+		if err := s.db.ScanRows(rows, &row); err != nil {
+			return fmt.Errorf("failed to read exported consignment: %w", err)
+		}
+		if err := out.Write(row.record()); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export consignments: %w", err)
+	}
+	return out.Close()
+}
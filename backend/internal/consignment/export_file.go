@@ -0,0 +1,147 @@
+package consignment
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// exportContentTypes maps the formats consignments can be exported in to their content
+// types.
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportWriter writes the rows of an export as they are read. Close completes the file
+// and flushes what is still buffered.
+type exportWriter interface {
+	Write(record []string) error
+	Close() error
+}
+
+// newExportWriter returns an exportWriter of format over w.
+func newExportWriter(format string, w io.Writer) (exportWriter, error) {
+	switch format {
+	case "csv":
+		return &csvExport{w: csv.NewWriter(w)}, nil
+	case "xlsx":
+		return newXLSXExport(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (e *csvExport) Write(record []string) error {
+	return e.w.Write(record)
+}
+
+func (e *csvExport) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// The fixed parts of the workbook written by xlsxExport. The worksheet, written last, is
+// streamed row by row with inline strings, so no shared string table is needed.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Consignments" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+type xlsxExport struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXLSXExport(w io.Writer) (*xlsxExport, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(xlsxSheetStart); err != nil {
+		return nil, err
+	}
+	return &xlsxExport{zw: zw, sheet: sheet}, nil
+}
+
+func (e *xlsxExport) Write(record []string) error {
+	e.rows++
+	row := strconv.Itoa(e.rows)
+	_, _ = e.sheet.WriteString(`<row r="` + row + `">`)
+	for i, value := range record {
+		if value == "" {
+			continue
+		}
+		_, _ = e.sheet.WriteString(`<c r="` + xlsxColumnName(i) + row + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(e.sheet, []byte(value)); err != nil {
+			return err
+		}
+		_, _ = e.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := e.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (e *xlsxExport) Close() error {
+	if _, err := e.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
+
+// xlsxColumnName returns the letters of the zero-based column col, the inverse of
+// xlsxColumn.
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
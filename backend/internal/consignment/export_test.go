@@ -0,0 +1,144 @@
+package consignment
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/profile/company"
+)
+
+var exportRowColumns = []string{
+	"id", "flow", "state", "trader_reference", "trader_company_id", "cha_company_id", "cha_id",
+	"failure_reason", "created_at", "updated_at", "finished_at",
+	"tasks_completed", "tasks_total", "hs_codes", "oga_tasks", "paid_total",
+}
+
+func expectExportRows(sqlMock sqlmock.Sqlmock, companyID string) {
+	created := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	sqlMock.ExpectQuery(`SELECT consignments.id, .* AS paid_total FROM "consignments" LEFT JOIN task_progress ON task_progress.root_workflow_id = consignments.id `+
+		`WHERE trader_company_id = \$\d+ AND state = \$\d+ ORDER BY consignments.created_at DESC, consignments.id DESC`).
+		WithArgs("SUCCESS", "REFUND_REQUIRED", "REFUND_PENDING", "REFUNDED", companyID, InProgress).
+		WillReturnRows(sqlmock.NewRows(exportRowColumns).
+			AddRow("cons-1", FlowImport, InProgress, "PO-1", companyID, "company-cha", nil, "", created, created, nil,
+				2, 5, "0901.11; 0902.10", "fcau: COMPLETED; npqs: QUEUED_EXTERNALLY", "LKR 1500.00").
+			AddRow("cons-2", FlowImport, InProgress, "", companyID, nil, nil, "", created, created, nil,
+				0, 0, nil, nil, nil))
+}
+
+func TestConsignmentService_ExportConsignments(t *testing.T) {
+	companyID := "company-trader"
+	state := InProgress
+	filter := Filter{TraderCompanyID: &companyID, State: &state}
+
+	t.Run("csv", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, nil, nil)
+		expectExportRows(sqlMock, companyID)
+
+		var buf bytes.Buffer
+		require.NoError(t, svc.ExportConsignments(context.Background(), filter, "csv", &buf))
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, exportColumns, records[0])
+		assert.Equal(t, []string{"cons-1", "IMPORT", "IN_PROGRESS", "PO-1", companyID, "company-cha", "",
+			"0901.11; 0902.10", "2", "5", "fcau: COMPLETED; npqs: QUEUED_EXTERNALLY", "LKR 1500.00",
+			"", "2026-03-01T09:30:00Z", "2026-03-01T09:30:00Z", ""}, records[1])
+		assert.Equal(t, "cons-2", records[2][0])
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, nil, nil)
+		expectExportRows(sqlMock, companyID)
+
+		var buf bytes.Buffer
+		require.NoError(t, svc.ExportConsignments(context.Background(), filter, "xlsx", &buf))
+		records, err := readXLSX(buf.Bytes())
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, exportColumns, records[0])
+		assert.Equal(t, "fcau: COMPLETED; npqs: QUEUED_EXTERNALLY", records[1][10])
+		assert.Equal(t, []string{"cons-2", "IMPORT", "IN_PROGRESS"}, records[2][:3])
+	})
+
+	t.Run("requires a company", func(t *testing.T) {
+		db, _ := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, nil, nil)
+		err := svc.ExportConsignments(context.Background(), Filter{}, "csv", &bytes.Buffer{})
+		assert.Error(t, err)
+	})
+}
+
+func TestXLSXExport(t *testing.T) {
+	var buf bytes.Buffer
+	out, err := newExportWriter("xlsx", &buf)
+	require.NoError(t, err)
+	require.NoError(t, out.Write([]string{"a & b", "", "<c>"}))
+	require.NoError(t, out.Write([]string{"  padded  "}))
+	require.NoError(t, out.Close())
+
+	records, err := readXLSX(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a & b", "", "<c>"}, {"  padded  "}}, records)
+
+	for col, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, want, xlsxColumnName(col))
+	}
+}
+
+func TestConsignmentRouter_HandleExportConsignments(t *testing.T) {
+	newRouter := func(t *testing.T) (*Router, sqlmock.Sqlmock) {
+		db, sqlMock := setupTestDB(t)
+		mockCompany := new(MockCompanyService)
+		mockCompany.On("GetCompanyByOUHandle", mock.Anything, "trader-ou").Return(&company.Record{ID: "company-trader", OUHandle: "trader-ou"}, nil)
+		return NewRouter(NewService(db, nil, nil, mockCompany, nil, nil, nil), nil, mockCompany), sqlMock
+	}
+	request := func(query string) *http.Request {
+		req, _ := http.NewRequest("GET", "/api/v1/consignments/export?"+query, nil)
+		return req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+	}
+
+	t.Run("streams the trader company's consignments", func(t *testing.T) {
+		r, sqlMock := newRouter(t)
+		expectExportRows(sqlMock, "company-trader")
+
+		w := httptest.NewRecorder()
+		r.HandleExportConsignments(w, request("state=IN_PROGRESS"))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Regexp(t, `^attachment; filename="consignments-\d{8}-\d{6}\.csv"$`, w.Header().Get("Content-Disposition"))
+		assert.Contains(t, w.Body.String(), "cons-1,IMPORT,IN_PROGRESS,PO-1")
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("rejects an unknown format", func(t *testing.T) {
+		r, _ := newRouter(t)
+		w := httptest.NewRecorder()
+		r.HandleExportConsignments(w, request("format=pdf"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("reports a failed query", func(t *testing.T) {
+		r, sqlMock := newRouter(t)
+		sqlMock.ExpectQuery(`SELECT consignments.id`).WillReturnError(errors.New("connection reset"))
+
+		w := httptest.NewRecorder()
+		r.HandleExportConsignments(w, request("format=xlsx"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+	})
+}
@@ -0,0 +1,316 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"gorm.io/gorm"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	taskstore "github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
+)
+
+// WorkflowSupervisor reports on and repairs workflows by ID.
+// workflow.Supervisor satisfies it on the shared Temporal client.
+type WorkflowSupervisor interface {
+	// DescribeWorkflow reports the status of the latest run; a run that closed
+	// without completing is model.WorkflowStatusFailed, with the reason.
+	DescribeWorkflow(ctx context.Context, workflowID string) (model.WorkflowStatus, string, error)
+	// ResetWorkflow resumes the workflow from its last completed workflow task.
+	ResetWorkflow(ctx context.Context, workflowID, reason string) error
+}
+
+// SetWorkflowSupervisor installs the supervisor used by CheckWorkflows and RetryConsignment.
+func (s *Service) SetWorkflowSupervisor(supervisor WorkflowSupervisor) {
+	s.supervisor = supervisor
+}
+
+// MonitorConfig configures the workflow monitor.
+type MonitorConfig struct {
+	// Interval between checks. Zero disables the monitor.
+	Interval time.Duration
+	// BatchSize is how many consignments are loaded per query; every running
+	// consignment is checked on each pass.
+	BatchSize int
+}
+
+// CheckWorkflows looks at the workflow of every IN_PROGRESS or STALLED consignment and
+// records the ones that stopped progressing: FAILED when the parent workflow closed
+// without completing, STALLED when it is running but one of its tasks failed. A STALLED
+// consignment whose failed tasks have since recovered goes back to IN_PROGRESS. The
+// parent runtime only reports completions, so this is how failures reach the consignment.
+// It returns the number of consignments whose state changed.
+func (s *Service) CheckWorkflows(ctx context.Context, batchSize int) (int, error) {
+	if s.supervisor == nil {
+		return 0, fmt.Errorf("no workflow supervisor registered for ConsignmentService")
+	}
+	if s.taskStore == nil {
+		return 0, fmt.Errorf("task store not initialized")
+	}
+
+	changed := 0
+	var errs []error
+	lastID := ""
+	for {
+		var batch []Consignment
+		if err := s.db.WithContext(ctx).
+			Where("state IN ? AND id > ?", []State{InProgress, Stalled}, lastID).
+			Order("id").
+			Limit(batchSize).
+			Find(&batch).Error; err != nil {
+			return changed, fmt.Errorf("failed to list running consignments: %w", err)
+		}
+		for i := range batch {
+			ok, err := s.checkWorkflow(ctx, &batch[i])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if ok {
+				changed++
+			}
+		}
+		if len(batch) < batchSize {
+			return changed, errors.Join(errs...)
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// checkWorkflow brings one consignment's state in line with its workflow and reports
+// whether it changed.
+func (s *Service) checkWorkflow(ctx context.Context, consignment *Consignment) (bool, error) {
+	status, reason, err := s.supervisor.DescribeWorkflow(ctx, consignment.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check workflow of consignment %s: %w", consignment.ID, err)
+	}
+
+	state := InProgress
+	switch status {
+	case model.WorkflowStatusFailed:
+		state = Failed
+	case model.WorkflowStatusInProgress:
+		if failed := failedTasks(s.taskStore.GetAllTasks(ctx, consignment.ID)); len(failed) > 0 {
+			state = Stalled
+			reason = fmt.Sprintf("task %s (%s) failed", failed[0].TaskID, failed[0].ActiveTaskTemplateID)
+		}
+	default:
+		// Completed workflows are finished through CompletionHandler.
+		return false, nil
+	}
+
+	if state == consignment.State && reason == consignment.FailureReason {
+		return false, nil
+	}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.recordWorkflowState(tx, consignment.ID, state, reason)
+	}); err != nil {
+		return false, err
+	}
+	if state.NeedsAttention() {
+		slog.WarnContext(ctx, "consignment workflow stopped progressing",
+			"consignmentId", consignment.ID, "state", state, "reason", reason)
+	}
+	return true, nil
+}
+
+// recordWorkflowState moves a running consignment to state with reason, stamping FailedAt
+// when it first needs attention and clearing both when it is back IN_PROGRESS. The
+// consignment is re-read under its row lock on tx so a concurrent finish or
+// cancellation stands.
+func (s *Service) recordWorkflowState(tx *gorm.DB, consignmentID string, state State, reason string) error {
+	consignment := Consignment{ID: consignmentID}
+	if err := lockConsignment(tx, &consignment); err != nil {
+		return err
+	}
+	if consignment.State != InProgress && !consignment.State.NeedsAttention() {
+		return nil
+	}
+
+	if !state.NeedsAttention() {
+		reason = ""
+		consignment.FailedAt = nil
+	} else if consignment.FailedAt == nil {
+		now := time.Now()
+		consignment.FailedAt = &now
+	}
+	previousState := consignment.State
+	consignment.State = state
+	consignment.FailureReason = reason
+	if err := tx.Save(&consignment).Error; err != nil {
+		return fmt.Errorf("failed to update consignment %s state to %s: %w", consignmentID, state, err)
+	}
+	if previousState == state {
+		return nil
+	}
+	var details map[string]any
+	if reason != "" {
+		details = map[string]any{"reason": reason}
+	}
+	return timeline.Append(tx.Statement.Context, tx, stateChanged(&consignment, previousState, "", details))
+}
+
+// failedTasks lists the tasks whose workflow failed.
+func failedTasks(tasks []tfstore.TaskRecord) []tfstore.TaskRecord {
+	var failed []tfstore.TaskRecord
+	for _, t := range tasks {
+		if t.State == taskstore.StateFailed {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// RetryConsignment resumes a FAILED or STALLED consignment for support staff. The
+// workflows of its failed tasks, and for a FAILED consignment the parent workflow, are
+// reset to their last completed workflow task so the failed step runs again. Resets run
+// before anything is recorded and skip workflows no longer failed, so when a reset is
+// refused part-way the retry can simply be repeated: the workflows reset the first time
+// are left running. Once all are reset, the failed tasks are marked RETRYING and the
+// consignment put back IN_PROGRESS in one transaction.
+func (s *Service) RetryConsignment(ctx context.Context, principal authz.Principal, consignmentID string) (*DetailDTO, error) {
+	if s.supervisor == nil {
+		return nil, fmt.Errorf("no workflow supervisor registered for ConsignmentService")
+	}
+	if s.taskStore == nil {
+		return nil, fmt.Errorf("task store not initialized")
+	}
+
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+	if !consignment.State.NeedsAttention() {
+		return nil, fmt.Errorf("%w (current state: %s)", ErrConsignmentNotRetryable, consignment.State)
+	}
+
+	failed := failedTasks(s.taskStore.GetAllTasks(ctx, consignment.ID))
+	failedIDs := make([]string, len(failed))
+	for i, t := range failed {
+		failedIDs[i] = t.TaskID
+	}
+
+	reason := "retried by " + principal.Subject()
+	for _, t := range failed {
+		if err := s.resetIfFailed(ctx, t.TaskWorkflowID, reason); err != nil {
+			return nil, fmt.Errorf("failed to reset task %s: %w", t.TaskID, err)
+		}
+	}
+	if consignment.State == Failed {
+		if err := s.resetIfFailed(ctx, consignment.ID, reason); err != nil {
+			return nil, fmt.Errorf("failed to reset workflow %s: %w", consignment.ID, err)
+		}
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockConsignment(tx, &consignment); err != nil {
+			return err
+		}
+		if !consignment.State.NeedsAttention() {
+			return nil // recorded by a concurrent retry
+		}
+		if err := s.taskStore.RetryTasks(ctx, tx, failedIDs); err != nil {
+			return fmt.Errorf("failed to reopen tasks: %w", err)
+		}
+		previousState := consignment.State
+		consignment.State = InProgress
+		consignment.FailureReason = ""
+		consignment.FailedAt = nil
+		if err := tx.Save(&consignment).Error; err != nil {
+			return fmt.Errorf("failed to update consignment: %w", err)
+		}
+		return timeline.Append(ctx, tx, stateChanged(&consignment, previousState, principal.Subject(), nil))
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "consignment retried", "consignmentId", consignment.ID,
+		"retriedBy", principal.Subject(), "tasks", failedIDs)
+
+	hsCodeMap, err := s.getHSCodeMap(ctx, consignment.Items)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildConsignmentDetailDTO(ctx, &consignment, hsCodeMap)
+}
+
+// resetIfFailed resets a workflow whose latest run failed. ResetWorkflow starts a new run
+// every time it is called, so a workflow already running again is left alone.
+func (s *Service) resetIfFailed(ctx context.Context, workflowID, reason string) error {
+	status, _, err := s.supervisor.DescribeWorkflow(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	if status != model.WorkflowStatusFailed {
+		return nil
+	}
+	return s.supervisor.ResetWorkflow(ctx, workflowID, reason)
+}
+
+// Monitor periodically runs CheckWorkflows. Every replica may run one: the checks are
+// idempotent, so overlapping passes only repeat work.
+type Monitor struct {
+	service *Service
+	cfg     MonitorConfig
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMonitor creates a monitor; call Start to run it.
+func NewMonitor(service *Service, cfg MonitorConfig) *Monitor {
+	return &Monitor{service: service, cfg: cfg}
+}
+
+// Start runs the check loop in the background until Stop is called. It is a no-op when
+// the configured interval is zero.
+func (m *Monitor) Start(ctx context.Context) {
+	if m.cfg.Interval <= 0 {
+		slog.Info("consignment: workflow monitor disabled")
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends the check loop and waits for an in-flight pass to finish.
+func (m *Monitor) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
+
+func (m *Monitor) check(ctx context.Context) {
+	n, err := m.service.CheckWorkflows(ctx, m.cfg.BatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "consignment: workflow check failed", "changed", n, "error", err)
+		return
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "consignment: updated consignments from their workflows", "count", n)
+	}
+}
@@ -0,0 +1,241 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
+)
+
+// fakeSupervisor reports workflows from statuses and records the workflows reset,
+// failing on failOn.
+type fakeSupervisor struct {
+	statuses map[string]model.WorkflowStatus
+	reasons  map[string]string
+	reset    []string
+	failOn   string
+}
+
+func (f *fakeSupervisor) DescribeWorkflow(_ context.Context, workflowID string) (model.WorkflowStatus, string, error) {
+	status, ok := f.statuses[workflowID]
+	if !ok {
+		return "", "", errors.New("workflow not found")
+	}
+	return status, f.reasons[workflowID], nil
+}
+
+func (f *fakeSupervisor) ResetWorkflow(_ context.Context, workflowID, _ string) error {
+	if workflowID == f.failOn {
+		return errors.New("temporal unavailable")
+	}
+	f.reset = append(f.reset, workflowID)
+	f.statuses[workflowID] = model.WorkflowStatusInProgress
+	return nil
+}
+
+func supervisedService(t *testing.T) (*Service, sqlmock.Sqlmock, *MockTaskStore, *fakeSupervisor) {
+	db, sqlMock := setupTestDB(t)
+	mockTaskStore := new(MockTaskStore)
+	svc := NewService(db, nil, nil, nil, nil, nil, mockTaskStore)
+	supervisor := &fakeSupervisor{statuses: map[string]model.WorkflowStatus{}, reasons: map[string]string{}}
+	svc.SetWorkflowSupervisor(supervisor)
+	return svc, sqlMock, mockTaskStore, supervisor
+}
+
+// expectLockedConsignment expects the consignment to be re-read under its row lock.
+func expectLockedConsignment(sqlMock sqlmock.Sqlmock, id string, state State) {
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1 .*FOR UPDATE`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_id", "trader_company_id", "cha_company_id", "items", "created_at", "updated_at"}).
+			AddRow(id, state, "EXPORT", "trader1", "company-trader", "company-cha", []byte(`[]`), time.Now(), time.Now()))
+}
+
+func expectStateUpdate(sqlMock sqlmock.Sqlmock, id string, from, to State) {
+	sqlMock.ExpectBegin()
+	expectLockedConsignment(sqlMock, id, from)
+	sqlMock.ExpectExec(`UPDATE "consignments" SET .*"state"=\$\d+.*"failure_reason"=\$\d+,"failed_at"=\$\d+`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, string(from), string(to))
+	sqlMock.ExpectCommit()
+}
+
+func TestConsignmentService_CheckWorkflows(t *testing.T) {
+	svc, sqlMock, taskStore, supervisor := supervisedService(t)
+	supervisor.statuses = map[string]model.WorkflowStatus{
+		"c-failed":    model.WorkflowStatusFailed,
+		"c-stalled":   model.WorkflowStatusInProgress,
+		"c-healthy":   model.WorkflowStatusInProgress,
+		"c-recovered": model.WorkflowStatusInProgress,
+		"c-done":      model.WorkflowStatusCompleted,
+	}
+	supervisor.reasons["c-failed"] = "workflow timed out"
+	taskStore.On("GetAllTasks", mock.Anything, "c-stalled").Return([]tfstore.TaskRecord{
+		{TaskID: "t-1", State: "COMPLETED"},
+		{TaskID: "t-2", State: "FAILED", ActiveTaskTemplateID: "fcau_review"},
+	})
+	taskStore.On("GetAllTasks", mock.Anything, mock.Anything).Return([]tfstore.TaskRecord{{TaskID: "t-3", State: "RETRYING"}})
+
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE state IN \(\$1,\$2\) AND id > \$3 ORDER BY id LIMIT \$4`).
+		WithArgs(InProgress, Stalled, "", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "failure_reason", "items"}).
+			AddRow("c-done", InProgress, "", []byte(`[]`)).
+			AddRow("c-failed", InProgress, "", []byte(`[]`)).
+			AddRow("c-healthy", InProgress, "", []byte(`[]`)).
+			AddRow("c-recovered", Stalled, "task t-3 (fcau_review) failed", []byte(`[]`)).
+			AddRow("c-stalled", InProgress, "", []byte(`[]`)))
+	expectStateUpdate(sqlMock, "c-failed", InProgress, Failed)
+	expectStateUpdate(sqlMock, "c-recovered", Stalled, InProgress)
+	expectStateUpdate(sqlMock, "c-stalled", InProgress, Stalled)
+
+	changed, err := svc.CheckWorkflows(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, changed)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+
+	t.Run("unknown workflow is reported and the rest still checked", func(t *testing.T) {
+		svc, sqlMock, _, supervisor := supervisedService(t)
+		supervisor.statuses["c-failed"] = model.WorkflowStatusFailed
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignments"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow("c-missing", InProgress).AddRow("c-failed", InProgress))
+		expectStateUpdate(sqlMock, "c-failed", InProgress, Failed)
+
+		changed, err := svc.CheckWorkflows(context.Background(), 10)
+		assert.ErrorContains(t, err, "c-missing")
+		assert.Equal(t, 1, changed)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestConsignmentService_RetryConsignment(t *testing.T) {
+	const id = "cons-1"
+	tasks := []tfstore.TaskRecord{
+		{TaskID: "t-form", State: "COMPLETED", ParentWorkflowID: id, TaskWorkflowID: "tw-form"},
+		{TaskID: "t-review", State: "FAILED", ParentWorkflowID: id, TaskWorkflowID: "tw-review"},
+	}
+
+	failedWorkflows := func(supervisor *fakeSupervisor) {
+		supervisor.statuses["tw-review"] = model.WorkflowStatusFailed
+		supervisor.statuses[id] = model.WorkflowStatusFailed
+	}
+	expectRetryRecorded := func(sqlMock sqlmock.Sqlmock, taskStore *MockTaskStore, from State) {
+		sqlMock.ExpectBegin()
+		expectConsignment(sqlMock, id, from)
+		taskStore.On("RetryTasks", mock.Anything, mock.Anything, []string{"t-review"}).Return(nil)
+		sqlMock.ExpectExec(`UPDATE "consignments" SET .*"state"=\$\d+.*"failure_reason"=\$\d+,"failed_at"=\$\d+`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, string(from), "IN_PROGRESS")
+		sqlMock.ExpectCommit()
+	}
+
+	t.Run("stalled consignment resets the failed task", func(t *testing.T) {
+		svc, sqlMock, taskStore, supervisor := supervisedService(t)
+		failedWorkflows(supervisor)
+		supervisor.statuses[id] = model.WorkflowStatusInProgress
+		expectConsignment(sqlMock, id, Stalled)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+		expectRetryRecorded(sqlMock, taskStore, Stalled)
+
+		result, err := svc.RetryConsignment(context.Background(), traderAccessor(), id)
+		require.NoError(t, err)
+		assert.Equal(t, InProgress, result.State)
+		assert.Empty(t, result.FailureReason)
+		assert.Equal(t, []string{"tw-review"}, supervisor.reset)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("failed consignment also resets the parent workflow", func(t *testing.T) {
+		svc, sqlMock, taskStore, supervisor := supervisedService(t)
+		failedWorkflows(supervisor)
+		expectConsignment(sqlMock, id, Failed)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+		expectRetryRecorded(sqlMock, taskStore, Failed)
+
+		_, err := svc.RetryConsignment(context.Background(), traderAccessor(), id)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tw-review", id}, supervisor.reset)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("refused reset records nothing and can be repeated", func(t *testing.T) {
+		svc, sqlMock, taskStore, supervisor := supervisedService(t)
+		failedWorkflows(supervisor)
+		supervisor.failOn = id
+		expectConsignment(sqlMock, id, Failed)
+		taskStore.On("GetAllTasks", mock.Anything, id).Return(tasks)
+
+		_, err := svc.RetryConsignment(context.Background(), traderAccessor(), id)
+		assert.ErrorContains(t, err, "temporal unavailable")
+		taskStore.AssertNotCalled(t, "RetryTasks", mock.Anything, mock.Anything, mock.Anything)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+
+		// The task workflow already runs again; only the parent is reset now.
+		supervisor.failOn = ""
+		expectConsignment(sqlMock, id, Failed)
+		expectRetryRecorded(sqlMock, taskStore, Failed)
+		_, err = svc.RetryConsignment(context.Background(), traderAccessor(), id)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tw-review", id}, supervisor.reset, "each workflow is reset once")
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("running consignment", func(t *testing.T) {
+		svc, sqlMock, _, _ := supervisedService(t)
+		expectConsignment(sqlMock, id, InProgress)
+
+		_, err := svc.RetryConsignment(context.Background(), traderAccessor(), id)
+		assert.ErrorIs(t, err, ErrConsignmentNotRetryable)
+	})
+}
+
+func TestConsignmentRouter_HandleRetryConsignment(t *testing.T) {
+	const id = "cons-1"
+	svc, sqlMock, _, _ := supervisedService(t)
+	expectConsignment(sqlMock, id, Finished)
+
+	req, _ := http.NewRequest("POST", "/api/v1/admin/consignments/"+id+"/retry", nil)
+	req.SetPathValue("id", id)
+	req = req.WithContext(withAuthContextOU(req.Context(), "support1", "support-ou"))
+	w := httptest.NewRecorder()
+	NewRouter(svc, nil, nil).HandleRetryConsignment(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "FAILED or STALLED")
+}
+
+func TestConsignmentRouter_HandleListAllConsignments(t *testing.T) {
+	t.Run("alert filter", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, nil, nil)
+		sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" .* WHERE state IN \(\$1,\$2\) ORDER BY consignments.created_at DESC, consignments.id DESC LIMIT \$3`).
+			WithArgs(Failed, Stalled, 50).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "state", "failure_reason", "items", "created_at", "updated_at"}).
+				AddRow("cons-1", Stalled, "task t-2 (fcau_review) failed", []byte(`[]`), time.Now(), time.Now()))
+
+		req, _ := http.NewRequest("GET", "/api/v1/admin/consignments?alert=true", nil)
+		w := httptest.NewRecorder()
+		NewRouter(svc, nil, nil).HandleListAllConsignments(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"alert":true`)
+		assert.Contains(t, w.Body.String(), `"failureReason":"task t-2 (fcau_review) failed"`)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid alert", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v1/admin/consignments?alert=maybe", nil)
+		w := httptest.NewRecorder()
+		NewRouter(NewService(nil, nil, nil, nil, nil, nil, nil), nil, nil).HandleListAllConsignments(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,646 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/hscode"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/pkg/storage"
+)
+
+// ImportFileStore reads uploaded files. *storage.Service satisfies it.
+type ImportFileStore interface {
+	Download(ctx context.Context, key string) (io.ReadCloser, string, error)
+	// UploadOwner returns the OU handle of the organisation that uploaded key, or
+	// storage.ErrUploadNotRecorded.
+	UploadOwner(ctx context.Context, key string) (string, error)
+}
+
+// SetImportFiles installs the file store bulk imports read their files from.
+func (s *Service) SetImportFiles(files ImportFileStore) {
+	s.importFiles = files
+}
+
+// ImportStatus is the state of a bulk import job.
+type ImportStatus string
+
+const (
+	ImportPending   ImportStatus = "PENDING"
+	ImportRunning   ImportStatus = "RUNNING"
+	ImportCompleted ImportStatus = "COMPLETED"
+	// ImportFailed: the file could not be imported at all; no consignment was created.
+	ImportFailed ImportStatus = "FAILED"
+)
+
+// ImportRowStatus is the outcome of one row of a bulk import.
+type ImportRowStatus string
+
+const (
+	ImportRowCreated ImportRowStatus = "CREATED"
+	ImportRowStarted ImportRowStatus = "STARTED"
+	ImportRowFailed  ImportRowStatus = "FAILED"
+)
+
+// importColumns are the columns of an import file, matched case-insensitively against its
+// header row. traderReference is optional, and chaId is only needed to start the
+// consignments.
+var importColumns = []string{"flow", "chaCompanyId", "hsCode", "traderReference", "chaId"}
+
+// importStaleAfter is how long a job may run before it is taken to have been interrupted.
+const importStaleAfter = time.Hour
+
+// ImportRow is the outcome of one row of a bulk import file. Row is its row number in the
+// file, the header being row 1.
+type ImportRow struct {
+	Row             int             `json:"row"`
+	TraderReference string          `json:"traderReference,omitempty"`
+	Status          ImportRowStatus `json:"status"`
+	ConsignmentID   string          `json:"consignmentId,omitempty"`
+	Errors          []string        `json:"errors,omitempty"`
+}
+
+// ImportJob is a bulk import of consignment shells from an uploaded CSV or XLSX file,
+// run in the background by the Importer.
+type ImportJob struct {
+	ID              string       `gorm:"type:text;column:id;primaryKey"`
+	TraderID        string       `gorm:"type:text;column:trader_id;not null"`
+	TraderCompanyID string       `gorm:"type:text;column:trader_company_id;not null"`
+	FileKey         string       `gorm:"type:text;column:file_key;not null"`
+	AutoStart       bool         `gorm:"column:auto_start;not null"`
+	Status          ImportStatus `gorm:"type:varchar(20);column:status;not null"`
+	TotalRows       int          `gorm:"column:total_rows;not null"`
+	CreatedCount    int          `gorm:"column:created_count;not null"`
+	StartedCount    int          `gorm:"column:started_count;not null"`
+	FailedCount     int          `gorm:"column:failed_count;not null"`
+	Rows            []ImportRow  `gorm:"type:jsonb;column:rows;serializer:json"`
+	Error           string       `gorm:"type:text;column:error;not null;default:''"`
+	CreatedAt       time.Time    `gorm:"type:timestamptz;column:created_at;not null;autoCreateTime"`
+	StartedAt       *time.Time   `gorm:"type:timestamptz;column:started_at"`
+	FinishedAt      *time.Time   `gorm:"type:timestamptz;column:finished_at"`
+}
+
+func (ImportJob) TableName() string {
+	return "consignment_imports"
+}
+
+// CreateImportDTO is the request body for POST /consignment-imports: the storage key of a
+// file uploaded through POST /storage, and whether to start the workflow of every
+// consignment created.
+type CreateImportDTO struct {
+	FileKey   string `json:"fileKey"`
+	AutoStart bool   `json:"autoStart,omitempty"`
+}
+
+func (d *CreateImportDTO) Validate() error {
+	if d.FileKey == "" {
+		return fmt.Errorf("fileKey is required")
+	}
+	_, err := importFileFormat(d.FileKey)
+	return err
+}
+
+// ImportDTO is a bulk import job in responses.
+type ImportDTO struct {
+	ID           string       `json:"id"`
+	FileKey      string       `json:"fileKey"`
+	AutoStart    bool         `json:"autoStart"`
+	Status       ImportStatus `json:"status"`
+	TotalRows    int          `json:"totalRows"`
+	CreatedCount int          `json:"createdCount"`
+	StartedCount int          `json:"startedCount"`
+	FailedCount  int          `json:"failedCount"`
+	Rows         []ImportRow  `json:"rows"`
+	Error        string       `json:"error,omitempty"`
+	CreatedAt    string       `json:"createdAt"`
+	StartedAt    string       `json:"startedAt,omitempty"`
+	FinishedAt   string       `json:"finishedAt,omitempty"`
+}
+
+func (j *ImportJob) toDTO() ImportDTO {
+	startedAt := ""
+	if j.StartedAt != nil {
+		startedAt = j.StartedAt.Format(time.RFC3339)
+	}
+	finishedAt := ""
+	if j.FinishedAt != nil {
+		finishedAt = j.FinishedAt.Format(time.RFC3339)
+	}
+	rows := j.Rows
+	if rows == nil {
+		rows = []ImportRow{}
+	}
+	return ImportDTO{
+		ID:           j.ID,
+		FileKey:      j.FileKey,
+		AutoStart:    j.AutoStart,
+		Status:       j.Status,
+		TotalRows:    j.TotalRows,
+		CreatedCount: j.CreatedCount,
+		StartedCount: j.StartedCount,
+		FailedCount:  j.FailedCount,
+		Rows:         rows,
+		Error:        j.Error,
+		CreatedAt:    j.CreatedAt.Format(time.RFC3339),
+		StartedAt:    startedAt,
+		FinishedAt:   finishedAt,
+	}
+}
+
+// ImportConfig configures the Importer.
+type ImportConfig struct {
+	// Interval between looks for pending jobs. Zero disables bulk imports.
+	Interval time.Duration
+	// MaxRows is the most data rows an import file may have.
+	MaxRows int
+}
+
+// SubmitImport queues a bulk import of the file at req.FileKey on behalf of the trader
+// traderID. The rows become consignments of the trader's company when the Importer runs
+// the job. The file must have been uploaded by the trader's company; otherwise
+// ErrImportFileNotFound is returned.
+func (s *Service) SubmitImport(ctx context.Context, traderID string, req CreateImportDTO) (*ImportDTO, error) {
+	traderUser, err := s.userService.GetUser(traderID)
+	if err != nil {
+		return nil, fmt.Errorf("trader user lookup failed: %w", err)
+	}
+	traderCompany, err := s.companyService.GetCompanyByOUHandle(ctx, traderUser.OUHandle)
+	if err != nil {
+		return nil, fmt.Errorf("trader company lookup failed: %w", err)
+	}
+	if err := s.checkImportFileOwner(ctx, req.FileKey, traderUser.OUHandle, traderCompany.ID); err != nil {
+		return nil, err
+	}
+
+	job := ImportJob{
+		ID:              uuid.NewString(),
+		TraderID:        traderID,
+		TraderCompanyID: traderCompany.ID,
+		FileKey:         req.FileKey,
+		AutoStart:       req.AutoStart,
+		Status:          ImportPending,
+	}
+	if err := s.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create import job: %w", err)
+	}
+	dto := job.toDTO()
+	return &dto, nil
+}
+
+// checkImportFileOwner checks that fileKey was uploaded by the company companyID, whose
+// trader belongs to ouHandle.
+func (s *Service) checkImportFileOwner(ctx context.Context, fileKey, ouHandle, companyID string) error {
+	if s.importFiles == nil {
+		return errors.New("bulk imports are not configured")
+	}
+	owner, err := s.importFiles.UploadOwner(ctx, fileKey)
+	if errors.Is(err, storage.ErrUploadNotRecorded) {
+		return ErrImportFileNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("upload lookup failed: %w", err)
+	}
+	if owner == ouHandle {
+		return nil
+	}
+	ownerCompany, err := s.companyService.GetCompanyByOUHandle(ctx, owner)
+	if err != nil || ownerCompany.ID != companyID {
+		return ErrImportFileNotFound
+	}
+	return nil
+}
+
+// GetImport returns a bulk import job with its row report on behalf of principal. Jobs are
+// visible to the members of the trader company that submitted them; for anyone else
+// ErrImportNotFound is returned.
+func (s *Service) GetImport(ctx context.Context, principal authz.Principal, importID string) (*ImportDTO, error) {
+	var job ImportJob
+	if err := s.db.WithContext(ctx).First(&job, "id = ?", importID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve import job %s: %w", importID, err)
+	}
+	ouHandle := authz.OUHandleOf(principal)
+	if ouHandle == "" {
+		return nil, ErrImportNotFound
+	}
+	traderCompany, err := s.companyService.GetCompanyByID(ctx, job.TraderCompanyID)
+	if err != nil {
+		return nil, fmt.Errorf("trader company lookup failed: %w", err)
+	}
+	if traderCompany.OUHandle != ouHandle {
+		return nil, ErrImportNotFound
+	}
+	dto := job.toDTO()
+	return &dto, nil
+}
+
+// RunImports runs the pending import jobs one at a time until none is left, and returns
+// how many it ran. Jobs left RUNNING for longer than importStaleAfter, by a replica that
+// stopped, are marked FAILED first; the shells they created stay, as their report shows.
+func (s *Service) RunImports(ctx context.Context, maxRows int) (int, error) {
+	if s.importFiles == nil {
+		return 0, fmt.Errorf("no import file store registered for ConsignmentService")
+	}
+	if err := s.db.WithContext(ctx).Model(&ImportJob{}).
+		Where("status = ? AND started_at < ?", ImportRunning, time.Now().Add(-importStaleAfter)).
+		Updates(map[string]any{"status": ImportFailed, "error": "the import was interrupted", "finished_at": time.Now()}).Error; err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted import jobs: %w", err)
+	}
+
+	ran := 0
+	for {
+		job, err := s.claimImport(ctx)
+		if err != nil || job == nil {
+			return ran, err
+		}
+		ran++
+		if err := s.runImport(ctx, job, maxRows); err != nil {
+			slog.ErrorContext(ctx, "consignment: import failed", "importId", job.ID, "error", err)
+			s.finishImport(ctx, job, err)
+		}
+	}
+}
+
+// claimImport marks the oldest pending job RUNNING and returns it, or nil when there is
+// none. Jobs another replica is claiming are skipped.
+func (s *Service) claimImport(ctx context.Context) (*ImportJob, error) {
+	var job ImportJob
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", ImportPending).
+			Order("created_at").
+			First(&job).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		job.Status = ImportRunning
+		job.StartedAt = &now
+		return tx.Model(&job).Select("status", "started_at").Updates(&job).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim import job: %w", err)
+	}
+	return &job, nil
+}
+
+// finishImport records the end of job: COMPLETED, or FAILED with cause.
+func (s *Service) finishImport(ctx context.Context, job *ImportJob, cause error) {
+	now := time.Now()
+	job.Status = ImportCompleted
+	if cause != nil {
+		job.Status = ImportFailed
+		job.Error = cause.Error()
+	}
+	job.FinishedAt = &now
+	if err := s.db.WithContext(ctx).Save(job).Error; err != nil {
+		slog.ErrorContext(ctx, "consignment: failed to record the end of an import", "importId", job.ID, "error", err)
+	}
+}
+
+// importRecord is a valid row of an import file, ready to become a consignment.
+type importRecord struct {
+	report       *ImportRow
+	flow         Flow
+	chaCompanyID string
+	chaID        string
+	hsCodeID     string
+	templateID   string
+}
+
+// runImport validates the rows of job's file and creates a consignment shell for each
+// valid row, in one transaction that also records the row report. With AutoStart, the
+// workflow of each shell is then started; a shell that fails to start stays INITIALIZED.
+// An error means the file could not be imported at all.
+func (s *Service) runImport(ctx context.Context, job *ImportJob, maxRows int) error {
+	format, err := importFileFormat(job.FileKey)
+	if err != nil {
+		return err
+	}
+	body, _, err := s.importFiles.Download(ctx, job.FileKey)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", job.FileKey, err)
+	}
+	records, err := readImportFile(format, body)
+	_ = body.Close()
+	if err != nil {
+		return err
+	}
+	if len(records) < 2 {
+		return errors.New("the file has no rows below its header")
+	}
+	if len(records)-1 > maxRows {
+		return fmt.Errorf("the file has %d rows; at most %d can be imported at once", len(records)-1, maxRows)
+	}
+
+	rows, valid, err := s.validateImportRows(ctx, records, job.AutoStart)
+	if err != nil {
+		return err
+	}
+	job.Rows = rows
+	job.TotalRows = len(rows)
+
+	consignments := make([]*Consignment, len(valid))
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		events := make([]timeline.Event, 0, len(valid))
+		for i, r := range valid {
+			chaCompanyID := r.chaCompanyID
+			consignments[i] = &Consignment{
+				ID:              uuid.NewString(),
+				Flow:            r.flow,
+				TraderID:        job.TraderID,
+				TraderCompanyID: job.TraderCompanyID,
+				TraderReference: r.report.TraderReference,
+				CHACompanyID:    &chaCompanyID,
+				State:           Initialized,
+				Items:           []Item{{HSCodeID: r.hsCodeID, WorkflowTemplateID: r.templateID}},
+			}
+			r.report.Status = ImportRowCreated
+			r.report.ConsignmentID = consignments[i].ID
+			events = append(events, stateChanged(consignments[i], "", job.TraderID, map[string]any{"importId": job.ID}))
+		}
+		if len(consignments) > 0 {
+			if err := tx.Create(&consignments).Error; err != nil {
+				return fmt.Errorf("failed to create consignments: %w", err)
+			}
+		}
+		if err := timeline.Append(ctx, tx, events...); err != nil {
+			return err
+		}
+		job.CreatedCount = len(valid)
+		job.FailedCount = len(rows) - len(valid)
+		return tx.Model(job).Select("rows", "total_rows", "created_count", "failed_count").Updates(job).Error
+	}); err != nil {
+		job.Rows, job.CreatedCount, job.FailedCount = nil, 0, 0
+		return err
+	}
+
+	if job.AutoStart {
+		for i, r := range valid {
+			if err := s.startImported(ctx, consignments[i], r.templateID, r.chaID); err != nil {
+				r.report.Errors = append(r.report.Errors, "created but not started: "+err.Error())
+				continue
+			}
+			r.report.Status = ImportRowStarted
+			job.StartedCount++
+		}
+	}
+	s.finishImport(ctx, job, nil)
+	slog.InfoContext(ctx, "consignment: import completed", "importId", job.ID,
+		"rows", job.TotalRows, "created", job.CreatedCount, "started", job.StartedCount, "failed", job.FailedCount)
+	return nil
+}
+
+// validateImportRows checks every data row of records: the flow, a CHA company, an HS code
+// mapped to a workflow template of the flow, the trader reference and, when the rows are
+// to be started, a CHA of the CHA company. It returns the report of every row and the
+// valid ones, which point into the report.
+func (s *Service) validateImportRows(ctx context.Context, records [][]string, autoStart bool) ([]ImportRow, []importRecord, error) {
+	columns := make(map[string]int, len(importColumns))
+	for i, name := range records[0] {
+		for _, column := range importColumns {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				columns[column] = i
+			}
+		}
+	}
+	for _, column := range importColumns[:3] {
+		if _, ok := columns[column]; !ok {
+			return nil, nil, fmt.Errorf("the header row has no %s column", column)
+		}
+	}
+	cell := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	codes := make([]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		if code := cell(record, "hsCode"); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	hsCodes, templates, err := s.importHSCodes(ctx, codes)
+	if err != nil {
+		return nil, nil, err
+	}
+	chaCompanies := map[string]error{}
+	chaMembers := map[string]string{}
+
+	rows := make([]ImportRow, len(records)-1)
+	var valid []importRecord
+	for i, record := range records[1:] {
+		row := &rows[i]
+		row.Row = i + 2
+		row.Status = ImportRowFailed
+		row.TraderReference = cell(record, "traderReference")
+		r := importRecord{report: row, flow: Flow(strings.ToUpper(cell(record, "flow"))), chaCompanyID: cell(record, "chaCompanyId"), chaID: cell(record, "chaId")}
+
+		if r.flow != FlowImport && r.flow != FlowExport {
+			row.Errors = append(row.Errors, "flow must be IMPORT or EXPORT")
+		}
+		if r.chaCompanyID == "" {
+			row.Errors = append(row.Errors, "chaCompanyId is required")
+		} else {
+			chaErr, checked := chaCompanies[r.chaCompanyID]
+			if !checked {
+				chaErr = s.checkCHACompany(ctx, r.chaCompanyID)
+				chaCompanies[r.chaCompanyID] = chaErr
+			}
+			if chaErr != nil {
+				row.Errors = append(row.Errors, chaErr.Error())
+			}
+		}
+		if autoStart && r.chaID == "" {
+			row.Errors = append(row.Errors, "chaId is required to start the consignment")
+		} else if r.chaID != "" {
+			chaCompanyID, checked := chaMembers[r.chaID]
+			if !checked {
+				if chaRecord, err := s.chaService.GetByID(ctx, r.chaID); err == nil {
+					chaCompanyID = chaRecord.CompanyID
+				}
+				chaMembers[r.chaID] = chaCompanyID
+			}
+			if chaCompanyID == "" {
+				row.Errors = append(row.Errors, fmt.Sprintf("CHA %s not found", r.chaID))
+			} else if r.chaCompanyID != "" && chaCompanyID != r.chaCompanyID {
+				row.Errors = append(row.Errors, fmt.Sprintf("CHA %s is not of CHA company %s", r.chaID, r.chaCompanyID))
+			}
+		}
+		if code := cell(record, "hsCode"); code == "" {
+			row.Errors = append(row.Errors, "hsCode is required")
+		} else if hsCode, ok := hsCodes[code]; !ok {
+			row.Errors = append(row.Errors, fmt.Sprintf("unknown HS code %s", code))
+		} else {
+			r.hsCodeID = hsCode.ID
+			r.templateID = templates[hsCode.ID][r.flow]
+			if r.templateID == "" && (r.flow == FlowImport || r.flow == FlowExport) {
+				row.Errors = append(row.Errors, fmt.Sprintf("HS code %s has no workflow for %s", code, r.flow))
+			}
+		}
+		if err := validateTraderReference(&row.TraderReference); err != nil {
+			row.Errors = append(row.Errors, err.Error())
+		}
+		if len(row.Errors) == 0 {
+			valid = append(valid, r)
+		}
+	}
+	return rows, valid, nil
+}
+
+// checkCHACompany reports why chaCompanyID cannot be a consignment's CHA company, or nil.
+func (s *Service) checkCHACompany(ctx context.Context, chaCompanyID string) error {
+	chaCompany, err := s.companyService.GetCompanyByID(ctx, chaCompanyID)
+	if err != nil {
+		return fmt.Errorf("CHA company %s not found", chaCompanyID)
+	}
+	if !chaCompany.HasCHA {
+		return fmt.Errorf("company %s is not a CHA company", chaCompanyID)
+	}
+	return nil
+}
+
+// importHSCodes looks up codes, returning the HS codes by code and, by HS code ID and
+// flow, the workflow templates they map to.
+func (s *Service) importHSCodes(ctx context.Context, codes []string) (map[string]hscode.HSCode, map[string]map[Flow]string, error) {
+	byCode := make(map[string]hscode.HSCode)
+	templates := make(map[string]map[Flow]string)
+	if len(codes) == 0 {
+		return byCode, templates, nil
+	}
+	var found []hscode.HSCode
+	if err := s.db.WithContext(ctx).Where("hs_code IN ?", codes).Find(&found).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to look up HS codes: %w", err)
+	}
+	ids := make([]string, len(found))
+	for i, h := range found {
+		byCode[h.HSCode] = h
+		ids[i] = h.ID
+	}
+	if len(ids) == 0 {
+		return byCode, templates, nil
+	}
+	var mappings []WorkflowTemplateMap
+	if err := s.db.WithContext(ctx).Where("hs_code_id IN ?", ids).Find(&mappings).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to look up workflow templates: %w", err)
+	}
+	for _, m := range mappings {
+		if templates[m.HSCodeID] == nil {
+			templates[m.HSCodeID] = make(map[Flow]string)
+		}
+		templates[m.HSCodeID][Flow(m.ConsignmentFlow)] = m.WorkflowTemplateID
+	}
+	return byCode, templates, nil
+}
+
+// startImported starts the workflow of an imported shell from templateID, as
+// CreateAndStartConsignment does, and moves it to IN_PROGRESS with chaID as its CHA, as
+// InitializeConsignmentByID does.
+func (s *Service) startImported(ctx context.Context, consignment *Consignment, templateID, chaID string) error {
+	traderCompany, err := s.companyService.GetCompanyByID(ctx, consignment.TraderCompanyID)
+	if err != nil {
+		return fmt.Errorf("trader company lookup failed: %w", err)
+	}
+	traderCompanyVars, err := companyRecordToMap(traderCompany)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trader company: %w", err)
+	}
+	wt, err := s.templateProvider.GetWorkflowTemplateByIDV2(ctx, templateID)
+	if err != nil {
+		return fmt.Errorf("failed to get workflow template: %w", err)
+	}
+	initialVars := map[string]any{"traderCompany": traderCompanyVars, "items": itemVars(consignment.Items)}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer tx.Rollback()
+
+	consignment.State = InProgress
+	consignment.CHAID = &chaID
+	consignment.GlobalContext = initialVars
+	consignment.WorkflowDefinition = &wt.WorkflowDefinition
+	if err := tx.Model(consignment).Select("state", "cha_id", "global_context", "workflow_definition").Updates(consignment).Error; err != nil {
+		return fmt.Errorf("failed to update consignment: %w", err)
+	}
+	if err := timeline.Append(ctx, tx, stateChanged(consignment, Initialized, consignment.TraderID, nil)); err != nil {
+		return err
+	}
+	if err := s.startWorkflow(ctx, consignment.ID, wt.WorkflowDefinition, initialVars); err != nil {
+		return fmt.Errorf("failed to register workflow: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// Importer periodically runs the pending bulk import jobs. Every replica may run one:
+// jobs are claimed with SKIP LOCKED, so each runs once.
+type Importer struct {
+	service *Service
+	cfg     ImportConfig
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewImporter creates an importer; call Start to run it.
+func NewImporter(service *Service, cfg ImportConfig) *Importer {
+	return &Importer{service: service, cfg: cfg}
+}
+
+// Start runs the import loop in the background until Stop is called. It is a no-op when
+// the configured interval is zero.
+func (m *Importer) Start(ctx context.Context) {
+	if m.cfg.Interval <= 0 {
+		slog.Info("consignment: bulk importer disabled")
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.run(ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends the import loop and waits for an in-flight job to finish.
+func (m *Importer) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
+
+func (m *Importer) run(ctx context.Context) {
+	n, err := m.service.RunImports(ctx, m.cfg.MaxRows)
+	if err != nil {
+		slog.ErrorContext(ctx, "consignment: bulk import pass failed", "ran", n, "error", err)
+	}
+}
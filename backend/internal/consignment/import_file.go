@@ -0,0 +1,212 @@
+package consignment
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxImportFileSize bounds the files read by bulk imports.
+const maxImportFileSize = 10 << 20
+
+// errImportFileTooLarge is reported when an import file exceeds maxImportFileSize.
+var errImportFileTooLarge = fmt.Errorf("file exceeds %d MiB", maxImportFileSize>>20)
+
+// importFileFormat returns the format of an import file from its name: "csv" or "xlsx".
+func importFileFormat(name string) (string, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return "csv", nil
+	case ".xlsx":
+		return "xlsx", nil
+	default:
+		return "", fmt.Errorf("import file must be a .csv or .xlsx file")
+	}
+}
+
+// readImportFile reads the records of an import file of the given format: every row of a
+// CSV file or of the first worksheet of an XLSX workbook, header included.
+func readImportFile(format string, r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxImportFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(data) > maxImportFileSize {
+		return nil, errImportFileTooLarge
+	}
+	switch format {
+	case "csv":
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV file: %w", err)
+		}
+		return records, nil
+	case "xlsx":
+		return readXLSX(data)
+	default:
+		return nil, fmt.Errorf("unsupported import file format %q", format)
+	}
+}
+
+// The parts of SpreadsheetML read by readXLSX.
+type (
+	xlsxWorkbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xlsxRelationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	xlsxText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	xlsxSharedStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	xlsxWorksheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+)
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// readXLSX returns the cell text of the first worksheet of an XLSX workbook. Numeric cells
+// are returned as stored, so codes with leading zeros must be formatted as text.
+func readXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v any) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("invalid XLSX file: %s is missing", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("invalid XLSX file: %w", err)
+		}
+		defer func() { _ = rc.Close() }()
+		if err := xml.NewDecoder(rc).Decode(v); err != nil {
+			return fmt.Errorf("invalid XLSX file: %s: %w", name, err)
+		}
+		return nil
+	}
+
+	var workbook xlsxWorkbook
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("invalid XLSX file: the workbook has no worksheet")
+	}
+	var rels xlsxRelationships
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetName := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RelID {
+			sheetName = path.Join("xl", rel.Target)
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetName = strings.TrimPrefix(rel.Target, "/")
+			}
+		}
+	}
+	if sheetName == "" {
+		return nil, errors.New("invalid XLSX file: the first worksheet is missing")
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxWorksheet
+	if err := decode(sheetName, &sheet); err != nil {
+		return nil, err
+	}
+
+	records := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var record []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				if col, err = xlsxColumn(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(record) <= col {
+				record = append(record, "")
+			}
+			switch cell.Type {
+			case "s":
+				n, err := strconv.Atoi(cell.Value)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid XLSX file: cell %s refers to a missing string", cell.Ref)
+				}
+				record[col] = shared.Items[n].String()
+			case "inlineStr":
+				record[col] = cell.Inline.String()
+			default:
+				record[col] = cell.Value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as "C12".
+func xlsxColumn(ref string) (int, error) {
+	col := 0
+	for i, r := range ref {
+		if r < 'A' || r > 'Z' {
+			if i == 0 {
+				break
+			}
+			return col - 1, nil
+		}
+		col = col*26 + int(r-'A') + 1
+	}
+	return 0, fmt.Errorf("invalid XLSX file: invalid cell reference %q", ref)
+}
@@ -0,0 +1,90 @@
+package consignment
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildXLSX zips the parts of a minimal workbook whose first worksheet holds sheetData.
+func buildXLSX(t *testing.T, sheetData, sharedStrings string) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Consignments" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	if sharedStrings != "" {
+		parts["xl/sharedStrings.xml"] = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sharedStrings + `</sst>`
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestImportFileFormat(t *testing.T) {
+	format, err := importFileFormat("uploads/batch.CSV")
+	require.NoError(t, err)
+	assert.Equal(t, "csv", format)
+
+	format, err = importFileFormat("batch.xlsx")
+	require.NoError(t, err)
+	assert.Equal(t, "xlsx", format)
+
+	_, err = importFileFormat("batch.xls")
+	assert.Error(t, err)
+}
+
+func TestReadImportFile(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		records, err := readImportFile("csv", strings.NewReader("\xef\xbb\xbfflow,hsCode\nIMPORT, 0901\nEXPORT\n"))
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"flow", "hsCode"}, {"IMPORT", "0901"}, {"EXPORT"}}, records)
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		data := buildXLSX(t,
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>hsCode</t></is></c></row>`+
+				`<row r="2"><c r="A2" t="s"><v>1</v></c><c r="C2"><v>901</v></c></row>`,
+			`<si><t>flow</t></si><si><r><t>IMP</t></r><r><t>ORT</t></r></si>`)
+
+		records, err := readImportFile("xlsx", bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"flow", "", "hsCode"}, {"IMPORT", "", "901"}}, records)
+	})
+
+	t.Run("not a workbook", func(t *testing.T) {
+		_, err := readImportFile("xlsx", strings.NewReader("flow,hsCode"))
+		assert.ErrorContains(t, err, "invalid XLSX file")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		_, err := readImportFile("csv", strings.NewReader(strings.Repeat("x", maxImportFileSize+1)))
+		assert.ErrorIs(t, err, errImportFileTooLarge)
+	})
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "C12": 2, "Z3": 25, "AA7": 26, "AB10": 27} {
+		col, err := xlsxColumn(ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, want, col, ref)
+	}
+	_, err := xlsxColumn("12")
+	assert.Error(t, err)
+}
@@ -0,0 +1,248 @@
+package consignment
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/profile/cha"
+	"github.com/OpenNSW/nsw/backend/internal/profile/company"
+	"github.com/OpenNSW/nsw/backend/internal/profile/user"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/pkg/storage"
+)
+
+type fakeImportFiles map[string]string
+
+func (f fakeImportFiles) Download(_ context.Context, key string) (io.ReadCloser, string, error) {
+	return io.NopCloser(strings.NewReader(f[key])), "text/csv", nil
+}
+
+// UploadOwner takes the files to be uploaded by trader-ou, and keys starting with
+// "other/" by other-ou.
+func (f fakeImportFiles) UploadOwner(_ context.Context, key string) (string, error) {
+	if strings.HasPrefix(key, "other/") {
+		return "other-ou", nil
+	}
+	if _, ok := f[key]; !ok {
+		return "", storage.ErrUploadNotRecorded
+	}
+	return "trader-ou", nil
+}
+
+var importJobColumns = []string{"id", "trader_id", "trader_company_id", "file_key", "auto_start", "status", "created_at"}
+
+// expectImportClaim expects the stale-job sweep and the claim of a pending job reading
+// fileKey; the claim that follows finds no job left.
+func expectImportClaim(sqlMock sqlmock.Sqlmock, id, fileKey string) {
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(`UPDATE "consignment_imports" SET .* WHERE status = \$\d+ AND started_at < \$\d+`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignment_imports" WHERE status = \$1 ORDER BY created_at,"consignment_imports"."id" LIMIT \$2 FOR UPDATE SKIP LOCKED`).
+		WithArgs(ImportPending, 1).
+		WillReturnRows(sqlmock.NewRows(importJobColumns).
+			AddRow(id, "trader1", "company-trader", fileKey, false, ImportPending, nil))
+	sqlMock.ExpectExec(`UPDATE "consignment_imports" SET "status"=\$1,"started_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(ImportRunning, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+}
+
+func expectNoPendingImport(sqlMock sqlmock.Sqlmock) {
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignment_imports" WHERE status = \$1`).
+		WillReturnRows(sqlmock.NewRows(importJobColumns))
+	sqlMock.ExpectRollback()
+}
+
+func TestConsignmentService_RunImports(t *testing.T) {
+	const importID = "import-1"
+
+	t.Run("creates the valid rows and reports the rest", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		mockCompany := new(MockCompanyService)
+		mockCompany.On("GetCompanyByID", mock.Anything, "company-cha").Return(&company.Record{ID: "company-cha", HasCHA: true}, nil)
+		mockCompany.On("GetCompanyByID", mock.Anything, "company-other").Return(&company.Record{ID: "company-other"}, nil)
+		svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+		svc.SetImportFiles(fakeImportFiles{"batch.csv": "Flow,chaCompanyId,hsCode,traderReference\n" +
+			"import,company-cha,0901,PO-1\n" +
+			"EXPORT,company-other,9999,PO-2\n"})
+
+		expectImportClaim(sqlMock, importID, "batch.csv")
+		sqlMock.ExpectQuery(`SELECT \* FROM "hs_codes" WHERE hs_code IN \(\$1,\$2\)`).
+			WithArgs("0901", "9999").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code"}).AddRow("hs-coffee", "0901"))
+		sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map" WHERE hs_code_id IN \(\$1\)`).
+			WithArgs("hs-coffee").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
+				AddRow("map-1", "hs-coffee", FlowImport, "wt-import"))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`INSERT INTO "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "", string(Initialized))
+		sqlMock.ExpectExec(`UPDATE "consignment_imports" SET "total_rows"=\$1,"created_count"=\$2,"failed_count"=\$3,"rows"=\$4 WHERE "id" = \$5`).
+			WithArgs(2, 1, 1, sqlmock.AnyArg(), importID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`UPDATE "consignment_imports" SET .*"status"=\$\d+`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+		expectNoPendingImport(sqlMock)
+
+		ran, err := svc.RunImports(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, ran)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("fails a file with too many rows", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, new(MockCompanyService), nil, nil, nil)
+		svc.SetImportFiles(fakeImportFiles{"batch.csv": "flow,chaCompanyId,hsCode\nIMPORT,c,1\nIMPORT,c,2\n"})
+
+		expectImportClaim(sqlMock, importID, "batch.csv")
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`UPDATE "consignment_imports" SET .*"status"=\$\d+`).
+			WithArgs("trader1", "company-trader", "batch.csv", false, ImportFailed,
+				0, 0, 0, 0, sqlmock.AnyArg(), "the file has 2 rows; at most 1 can be imported at once",
+				sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), importID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+		expectNoPendingImport(sqlMock)
+
+		ran, err := svc.RunImports(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, ran)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestConsignmentService_ValidateImportRows(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	mockCompany.On("GetCompanyByID", mock.Anything, "company-cha").Return(&company.Record{ID: "company-cha", HasCHA: true}, nil).Once()
+	mockCHA := new(MockCHAService)
+	mockCHA.On("GetByID", mock.Anything, "cha-1").Return(&cha.Record{ID: "cha-1", CompanyID: "company-cha"}, nil).Once()
+	mockCHA.On("GetByID", mock.Anything, "cha-9").Return(&cha.Record{ID: "cha-9", CompanyID: "company-other"}, nil).Once()
+	svc := NewService(db, nil, mockCHA, mockCompany, nil, nil, nil)
+
+	sqlMock.ExpectQuery(`SELECT \* FROM "hs_codes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code"}).AddRow("hs-coffee", "0901"))
+	sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
+			AddRow("map-1", "hs-coffee", FlowImport, "wt-import"))
+
+	rows, valid, err := svc.validateImportRows(context.Background(), [][]string{
+		{"hsCode", "FLOW", "chaCompanyId", "chaId"},
+		{"0901", "IMPORT", "company-cha", "cha-1"},
+		{"0901", "EXPORT", "company-cha", "cha-1"},
+		{"", "TRANSIT", "", ""},
+		{"0901", "IMPORT", "company-cha", "cha-9"},
+	}, true)
+	require.NoError(t, err)
+	require.Len(t, valid, 1)
+	assert.Equal(t, "wt-import", valid[0].templateID)
+	assert.Equal(t, "cha-1", valid[0].chaID)
+	assert.Equal(t, 2, rows[0].Row)
+	assert.Empty(t, rows[0].Errors)
+	assert.Equal(t, []string{"HS code 0901 has no workflow for EXPORT"}, rows[1].Errors)
+	assert.Equal(t, ImportRowFailed, rows[2].Status)
+	assert.Equal(t, []string{"flow must be IMPORT or EXPORT", "chaCompanyId is required",
+		"chaId is required to start the consignment", "hsCode is required"}, rows[2].Errors)
+	assert.Equal(t, []string{"CHA cha-9 is not of CHA company company-cha"}, rows[3].Errors)
+	mockCompany.AssertExpectations(t)
+	mockCHA.AssertExpectations(t)
+
+	_, _, err = svc.validateImportRows(context.Background(), [][]string{{"flow", "hsCode"}}, false)
+	assert.ErrorContains(t, err, "no chaCompanyId column")
+}
+
+func TestConsignmentService_GetImport(t *testing.T) {
+	const importID = "import-1"
+	expectJob := func(sqlMock sqlmock.Sqlmock) {
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignment_imports" WHERE id = \$1`).
+			WithArgs(importID, 1).
+			WillReturnRows(sqlmock.NewRows(append(importJobColumns, "total_rows", "rows")).
+				AddRow(importID, "trader1", "company-trader", "batch.csv", false, ImportCompleted, nil, 1,
+					[]byte(`[{"row":2,"status":"CREATED","consignmentId":"cons-1"}]`)))
+	}
+
+	t.Run("visible to the trader company", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		expectJob(sqlMock)
+
+		job, err := svc.GetImport(context.Background(), traderAccessor(), importID)
+		require.NoError(t, err)
+		assert.Equal(t, ImportCompleted, job.Status)
+		assert.Equal(t, []ImportRow{{Row: 2, Status: ImportRowCreated, ConsignmentID: "cons-1"}}, job.Rows)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("hidden from other companies", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		expectJob(sqlMock)
+
+		_, err := svc.GetImport(context.Background(), chaAccessor(), importID)
+		assert.ErrorIs(t, err, ErrImportNotFound)
+	})
+}
+
+func TestConsignmentRouter_HandleCreateImport(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	mockUser := new(MockUserService)
+	mockUser.On("GetUser", "trader1").Return(&user.Record{ID: "trader1", OUHandle: "trader-ou"}, nil)
+	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "trader-ou").Return(&company.Record{ID: "company-trader"}, nil)
+	svc := NewService(db, nil, nil, mockCompany, mockUser, nil, nil)
+	svc.SetImportFiles(fakeImportFiles{"uploads/batch.xlsx": ""})
+	r := NewRouter(svc, nil, nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(`INSERT INTO "consignment_imports"`).
+		WithArgs(sqlmock.AnyArg(), "trader1", "company-trader", "uploads/batch.xlsx", true, ImportPending,
+			0, 0, 0, 0, nil, "", sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "/api/v1/consignment-imports", bytes.NewBufferString(`{"fileKey":"uploads/batch.xlsx","autoStart":true}`))
+	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+	w := httptest.NewRecorder()
+	r.HandleCreateImport(w, req)
+
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"PENDING"`)
+	assert.Contains(t, w.Body.String(), `"rows":[]`)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+
+	t.Run("rejects other file types", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v1/consignment-imports", bytes.NewBufferString(`{"fileKey":"uploads/batch.pdf"}`))
+		req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+		w := httptest.NewRecorder()
+		r.HandleCreateImport(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	for name, fileKey := range map[string]string{"rejects files of other companies": "other/batch.csv", "rejects unknown files": "uploads/nope.csv"} {
+		t.Run(name, func(t *testing.T) {
+			mockCompany.On("GetCompanyByOUHandle", mock.Anything, "other-ou").Return(&company.Record{ID: "company-other"}, nil)
+			req, _ := http.NewRequest("POST", "/api/v1/consignment-imports", bytes.NewBufferString(`{"fileKey":"`+fileKey+`"}`))
+			req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+			w := httptest.NewRecorder()
+			r.HandleCreateImport(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), ErrImportFileNotFound.Error())
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
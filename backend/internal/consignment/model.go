@@ -2,9 +2,15 @@ package consignment
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	workflowmanager "github.com/OpenNSW/go-temporal-workflow"
+	"gorm.io/gorm"
+
 	"github.com/OpenNSW/nsw/backend/internal/hscode"
+	taskstore "github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
 	"github.com/OpenNSW/nsw/backend/pkg/pagination"
 )
@@ -26,8 +32,18 @@ const (
 	Initialized State = "INITIALIZED"
 	InProgress  State = "IN_PROGRESS"
 	Finished    State = "FINISHED"
+	Cancelling  State = "CANCELLING" // Withdrawn by the trader; its workflows are being cancelled
+	Cancelled   State = "CANCELLED"
+	Failed      State = "FAILED"  // The parent workflow failed, timed out or was terminated
+	Stalled     State = "STALLED" // The parent workflow runs but waits on a failed task
 )
 
+// NeedsAttention reports whether a consignment in state s is stuck until support
+// staff retry it.
+func (s State) NeedsAttention() bool {
+	return s == Failed || s == Stalled
+}
+
 // Consignment represents a consignment in the system.
 type Consignment struct {
 	ID        string    `gorm:"type:text;column:id;primaryKey;not null" json:"id"`
@@ -36,12 +52,13 @@ type Consignment struct {
 
 	// Core attributes
 	Flow  Flow   `gorm:"type:varchar(50);column:flow;not null" json:"flow"`             // IMPORT or EXPORT
-	State State  `gorm:"type:varchar(50);column:state;not null" json:"state"`           // INITIALIZED → IN_PROGRESS → FINISHED
+	State State  `gorm:"type:varchar(50);column:state;not null" json:"state"`           // INITIALIZED → IN_PROGRESS → FINISHED, or CANCELLED, FAILED, STALLED
 	Items []Item `gorm:"type:jsonb;column:items;serializer:json;not null" json:"items"` // Items in the consignment
 
 	// Trader (set at Stage 1)
-	TraderID        string `gorm:"type:varchar(100);column:trader_id;not null" json:"traderId"`                // Trader user who created the consignment
-	TraderCompanyID string `gorm:"type:varchar(100);column:trader_company_id;not null" json:"traderCompanyId"` // Company the trader belongs to
+	TraderID        string `gorm:"type:varchar(100);column:trader_id;not null" json:"traderId"`                                    // Trader user who created the consignment
+	TraderCompanyID string `gorm:"type:varchar(100);column:trader_company_id;not null" json:"traderCompanyId"`                     // Company the trader belongs to
+	TraderReference string `gorm:"type:varchar(100);column:trader_reference;not null;default:''" json:"traderReference,omitempty"` // Trader's own reference number (optional)
 
 	// CHA (company chosen at Stage 1; specific CHA assigned at Stage 2). Both are nil for
 	// direct-start consignments (e.g. trade-export-v1), where CHA selection happens inside
@@ -49,22 +66,54 @@ type Consignment struct {
 	CHACompanyID *string `gorm:"type:varchar(100);column:cha_company_id" json:"chaCompanyId,omitempty"` // CHA company selected by the trader at Stage 1
 	CHAID        *string `gorm:"type:varchar(100);column:cha_id" json:"chaId,omitempty"`                // CHA who claimed the consignment at Stage 2
 
+	// Cancellation (set when the trader withdraws the consignment)
+	CancelReason string     `gorm:"type:text;column:cancel_reason;not null;default:''" json:"cancelReason,omitempty"`       // Reason given by the trader
+	CancelledBy  string     `gorm:"type:varchar(100);column:cancelled_by;not null;default:''" json:"cancelledBy,omitempty"` // Trader user who cancelled
+	CancelledAt  *time.Time `gorm:"type:timestamptz;column:cancelled_at" json:"cancelledAt,omitempty"`                      // When the consignment was cancelled
+
+	// Failure (set when the workflow stops progressing; cleared by a retry)
+	FailureReason string     `gorm:"type:text;column:failure_reason;not null;default:''" json:"failureReason,omitempty"` // Why the workflow stopped
+	FailedAt      *time.Time `gorm:"type:timestamptz;column:failed_at" json:"failedAt,omitempty"`                        // When it was found FAILED or STALLED
+
+	FinishedAt *time.Time `gorm:"type:timestamptz;column:finished_at" json:"finishedAt,omitempty"` // When the workflow completed
+
+	// Workflow context (set when the workflow starts). GlobalContext mirrors the workflow's
+	// global variables: the start variables, what tasks write through their output mappings
+	// and what the trader amends. Amendments find the tasks consuming a key through the
+	// input mappings of WorkflowDefinition.
+	GlobalContext      map[string]any                      `gorm:"type:jsonb;column:global_context;serializer:json" json:"globalContext,omitempty"`
+	WorkflowDefinition *workflowmanager.WorkflowDefinition `gorm:"type:jsonb;column:workflow_definition;serializer:json" json:"-"`
+
 	// Relationships
-	Workflow *model.Workflow `gorm:"foreignKey:ID;references:ID" json:"-"` // Associated Workflow (1:1, same ID)
+	Workflow *model.Workflow         `gorm:"foreignKey:ID;references:ID" json:"-"`             // Associated Workflow (1:1, same ID)
+	Progress *taskstore.TaskProgress `gorm:"foreignKey:RootWorkflowID;references:ID" json:"-"` // Task progress projection (1:1), joined by listings
 }
 
 func (c *Consignment) TableName() string {
 	return "consignments"
 }
 
+// BeforeSave stores an empty global context, rather than NULL, for consignments whose
+// workflow has not started.
+func (c *Consignment) BeforeSave(*gorm.DB) error {
+	if c.GlobalContext == nil {
+		c.GlobalContext = map[string]any{}
+	}
+	return nil
+}
+
 // Item represents an individual item within a consignment.
 type Item struct {
-	HSCodeID string `gorm:"type:text;column:hs_code_id;not null" json:"hsCodeId"` // HS Code ID
+	HSCodeID           string `gorm:"type:text;column:hs_code_id;not null" json:"hsCodeId"` // HS Code ID
+	WorkflowTemplateID string `json:"workflowTemplateId,omitempty"`                         // Workflow template the HS code maps to
+	SubFlow            string `json:"subFlow,omitempty"`                                    // Sub-flow of the parent workflow covering this item
 }
 
 // ItemResponseDTO represents an individual item in the consignment response.
 type ItemResponseDTO struct {
-	HSCode hscode.ResponseDTO `json:"hsCode"` // Full HS Code details
+	HSCode             hscode.ResponseDTO `json:"hsCode"`                       // Full HS Code details
+	WorkflowTemplateID string             `json:"workflowTemplateId,omitempty"` // Workflow template the HS code maps to
+	SubFlow            string             `json:"subFlow,omitempty"`            // Sub-flow of the parent workflow covering this item
 }
 
 // InitializeConsignmentDTO is the request body for PUT /consignments/{id}/initialize (Stage 2 – CHA selects HS Code(s)).
@@ -72,13 +121,64 @@ type InitializeConsignmentDTO struct {
 	HSCodeIDs []string `json:"hsCodeIds" binding:"required,min=1"`
 }
 
+// StartConsignmentDTO is the request body for POST /consignments:start, which creates a
+// consignment and starts its workflow in one step. The workflow template is either resolved
+// from Flow and HSCodeID through WorkflowTemplateMap or named explicitly by TemplateID, which
+// must be mapped to Flow. Context seeds the workflow's global variables.
+type StartConsignmentDTO struct {
+	Flow       Flow           `json:"flow"`
+	HSCodeID   string         `json:"hsCodeId,omitempty"`
+	TemplateID string         `json:"templateId,omitempty"`
+	Context    map[string]any `json:"context,omitempty"`
+
+	TraderReference string `json:"traderReference,omitempty"`
+}
+
+// reservedContextKeys are workflow variables set by the service itself.
+var reservedContextKeys = []string{"traderCompany", "items"}
+
+func (d *StartConsignmentDTO) Validate() error {
+	if d.Flow != FlowImport && d.Flow != FlowExport {
+		return fmt.Errorf("flow must be IMPORT or EXPORT")
+	}
+	if d.HSCodeID == "" && d.TemplateID == "" {
+		return fmt.Errorf("hsCodeId or templateId is required")
+	}
+	for _, key := range reservedContextKeys {
+		if _, ok := d.Context[key]; ok {
+			return fmt.Errorf("context key %q is reserved", key)
+		}
+	}
+	return validateTraderReference(&d.TraderReference)
+}
+
+// CancelConsignmentDTO is the request body for POST /consignments/{id}/cancel.
+type CancelConsignmentDTO struct {
+	Reason string `json:"reason"`
+}
+
+// maxCancelReasonLength bounds the reason forwarded to OGAs.
+const maxCancelReasonLength = 1000
+
+func (d *CancelConsignmentDTO) Validate() error {
+	d.Reason = strings.TrimSpace(d.Reason)
+	if d.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	if len(d.Reason) > maxCancelReasonLength {
+		return fmt.Errorf("reason must be at most %d characters", maxCancelReasonLength)
+	}
+	return nil
+}
+
 // CreateConsignmentDTO represents the data required to create a consignment.
 // Stage 1 (two-stage flow): provide flow + chaCompanyId → creates shell with state INITIALIZED.
 // HS codes are not provided here; they are supplied at Stage 2 via InitializeConsignmentDTO
 // when a CHA from chaCompanyId claims the consignment.
 type CreateConsignmentDTO struct {
-	Flow         Flow   `json:"flow"`
-	ChaCompanyID string `json:"chaCompanyId"`
+	Flow            Flow   `json:"flow"`
+	ChaCompanyID    string `json:"chaCompanyId"`
+	TraderReference string `json:"traderReference,omitempty"`
 }
 
 func (d *CreateConsignmentDTO) Validate() error {
@@ -88,6 +188,18 @@ func (d *CreateConsignmentDTO) Validate() error {
 	if d.Flow != FlowImport && d.Flow != FlowExport {
 		return fmt.Errorf("flow must be IMPORT or EXPORT")
 	}
+	return validateTraderReference(&d.TraderReference)
+}
+
+// maxTraderReferenceLength matches the trader_reference column.
+const maxTraderReferenceLength = 100
+
+// validateTraderReference trims the optional trader reference and checks its length.
+func validateTraderReference(ref *string) error {
+	*ref = strings.TrimSpace(*ref)
+	if len(*ref) > maxTraderReferenceLength {
+		return fmt.Errorf("traderReference must be at most %d characters", maxTraderReferenceLength)
+	}
 	return nil
 }
 
@@ -100,17 +212,25 @@ type UpdateDTO struct {
 
 // DetailDTO represents the full consignment data returned in detailed responses.
 type DetailDTO struct {
-	ID              string                          `json:"id"`              // Consignment ID
-	Flow            Flow                            `json:"flow"`            // e.g., IMPORT, EXPORT
-	State           State                           `json:"state"`           // State of the consignment
-	TraderID        string                          `json:"traderId"`        // Trader user who created the consignment
-	TraderCompanyID string                          `json:"traderCompanyId"` // Company the trader belongs to
-	ChaCompanyID    string                          `json:"chaCompanyId"`    // CHA company selected at Stage 1
-	ChaID           string                          `json:"chaId,omitempty"` // CHA assigned at Stage 2 (empty until claimed)
-	Items           []ItemResponseDTO               `json:"items"`           // Items in the consignment with full HS Code details
-	CreatedAt       string                          `json:"createdAt"`       // Timestamp of consignment creation
-	UpdatedAt       string                          `json:"updatedAt"`       // Timestamp of last consignment update
-	WorkflowNodes   []model.WorkflowNodeResponseDTO `json:"workflowNodes"`   // Associated workflow nodes with template details
+	ID              string                          `json:"id"`                        // Consignment ID
+	Flow            Flow                            `json:"flow"`                      // e.g., IMPORT, EXPORT
+	State           State                           `json:"state"`                     // State of the consignment
+	TraderID        string                          `json:"traderId"`                  // Trader user who created the consignment
+	TraderCompanyID string                          `json:"traderCompanyId"`           // Company the trader belongs to
+	TraderReference string                          `json:"traderReference,omitempty"` // Trader's own reference number
+	ChaCompanyID    string                          `json:"chaCompanyId"`              // CHA company selected at Stage 1
+	ChaID           string                          `json:"chaId,omitempty"`           // CHA assigned at Stage 2 (empty until claimed)
+	Items           []ItemResponseDTO               `json:"items"`                     // Items in the consignment with full HS Code details
+	CreatedAt       string                          `json:"createdAt"`                 // Timestamp of consignment creation
+	UpdatedAt       string                          `json:"updatedAt"`                 // Timestamp of last consignment update
+	WorkflowNodes   []model.WorkflowNodeResponseDTO `json:"workflowNodes"`             // Associated workflow nodes with template details
+	CancelReason    string                          `json:"cancelReason,omitempty"`    // Reason given when the consignment was cancelled
+	CancelledAt     string                          `json:"cancelledAt,omitempty"`     // Timestamp of cancellation
+	FailureReason   string                          `json:"failureReason,omitempty"`   // Why the workflow stopped progressing (FAILED or STALLED)
+	FailedAt        string                          `json:"failedAt,omitempty"`        // Timestamp the consignment was found FAILED or STALLED
+	FinishedAt      string                          `json:"finishedAt,omitempty"`      // Timestamp the workflow completed (FINISHED only)
+	Progress        ProgressDTO                     `json:"progress"`                  // Task counts, as in list responses
+	GlobalContext   map[string]any                  `json:"globalContext,omitempty"`   // Workflow global variables, the base of amendments
 }
 
 // SummaryDTO represents the consignment data returned in list responses.
@@ -120,18 +240,136 @@ type SummaryDTO struct {
 	State                      State             `json:"state"`                      // State of the consignment
 	TraderID                   string            `json:"traderId"`                   // Trader user who created the consignment
 	TraderCompanyID            string            `json:"traderCompanyId"`            // Company the trader belongs to
+	TraderReference            string            `json:"traderReference,omitempty"`  // Trader's own reference number
 	ChaCompanyID               string            `json:"chaCompanyId"`               // CHA company selected at Stage 1
 	ChaID                      string            `json:"chaId,omitempty"`            // CHA assigned at Stage 2 (empty until claimed)
 	Items                      []ItemResponseDTO `json:"items"`                      // Items in the consignment with full HS Code details
 	CreatedAt                  string            `json:"createdAt"`                  // Timestamp of consignment creation
 	UpdatedAt                  string            `json:"updatedAt"`                  // Timestamp of last consignment update
+	FinishedAt                 string            `json:"finishedAt,omitempty"`       // Timestamp the workflow completed (FINISHED only)
 	WorkflowNodeCount          int               `json:"workflowNodeCount"`          // Total number of workflow nodes
 	CompletedWorkflowNodeCount int               `json:"completedWorkflowNodeCount"` // Number of completed workflow nodes
+	Progress                   ProgressDTO       `json:"progress"`                   // Task counts, as in the detail response
+	Alert                      bool              `json:"alert"`                      // The consignment is FAILED or STALLED and needs support
+	FailureReason              string            `json:"failureReason,omitempty"`    // Why the workflow stopped progressing
+}
+
+// ProgressDTO counts a consignment's tasks by where they stand. Tasks that failed or were
+// cancelled count towards Total only.
+type ProgressDTO struct {
+	Total          int `json:"total"`          // Tasks shown as workflow nodes
+	Completed      int `json:"completed"`      // Completed tasks
+	InProgress     int `json:"inProgress"`     // Open tasks waiting on neither party
+	AwaitingTrader int `json:"awaitingTrader"` // Tasks waiting for the trader's input or payment
+	AwaitingOGA    int `json:"awaitingOga"`    // Reviews dispatched to an OGA, awaiting its decision
+}
+
+func progressDTO(p taskstore.TaskProgress) ProgressDTO {
+	return ProgressDTO{
+		Total:          p.Total,
+		Completed:      p.Completed,
+		InProgress:     p.InProgress,
+		AwaitingTrader: p.AwaitingTrader,
+		AwaitingOGA:    p.AwaitingOGA,
+	}
+}
+
+// AmendConsignmentDTO is the request body for POST /consignments/{id}/amendments: the new
+// values of global context keys, and why they are changed.
+type AmendConsignmentDTO struct {
+	Changes map[string]any `json:"changes"`
+	Reason  string         `json:"reason"`
+}
+
+// maxAmendReasonLength bounds the reason kept in the amendment history.
+const maxAmendReasonLength = 1000
+
+func (d *AmendConsignmentDTO) Validate() error {
+	if len(d.Changes) == 0 {
+		return fmt.Errorf("changes are required")
+	}
+	for _, key := range reservedContextKeys {
+		if _, ok := d.Changes[key]; ok {
+			return fmt.Errorf("context key %q cannot be amended", key)
+		}
+	}
+	d.Reason = strings.TrimSpace(d.Reason)
+	if d.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	if len(d.Reason) > maxAmendReasonLength {
+		return fmt.Errorf("reason must be at most %d characters", maxAmendReasonLength)
+	}
+	return nil
+}
+
+// AmendmentAction is what an amendment did with a completed task that consumed a changed key.
+type AmendmentAction string
+
+const (
+	AmendmentReopened    AmendmentAction = "REOPENED"     // Run again, returning to the trader where it takes input
+	AmendmentOGARereview AmendmentAction = "OGA_REREVIEW" // Sent back to the OGA that reviewed it
+)
+
+// ContextChange is one global context key changed by an amendment.
+type ContextChange struct {
+	Key    string `json:"key"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// AmendedTask is a completed task an amendment superseded. A new task for the same
+// workflow node replaces it.
+type AmendedTask struct {
+	TaskID string          `json:"taskId"`
+	NodeID string          `json:"nodeId"`
+	Action AmendmentAction `json:"action"`
+}
+
+// Amendment is one entry of a consignment's amendment history.
+type Amendment struct {
+	ID            string          `gorm:"type:text;column:id;primaryKey;not null"`
+	ConsignmentID string          `gorm:"type:text;column:consignment_id;not null"`
+	AmendedBy     string          `gorm:"type:varchar(100);column:amended_by;not null"`
+	Reason        string          `gorm:"type:text;column:reason;not null"`
+	Changes       []ContextChange `gorm:"type:jsonb;column:changes;serializer:json;not null"`
+	Tasks         []AmendedTask   `gorm:"type:jsonb;column:tasks;serializer:json;not null"`
+	CreatedAt     time.Time       `gorm:"type:timestamptz;column:created_at;not null;autoCreateTime"`
+}
+
+func (a *Amendment) TableName() string {
+	return "consignment_amendments"
+}
+
+// AmendmentDTO represents an amendment in responses.
+type AmendmentDTO struct {
+	ID            string          `json:"id"`
+	ConsignmentID string          `json:"consignmentId"`
+	AmendedBy     string          `json:"amendedBy"` // Trader user who amended the consignment
+	Reason        string          `json:"reason"`
+	Changes       []ContextChange `json:"changes"` // Keys changed, with their values before and after
+	Tasks         []AmendedTask   `json:"tasks"`   // Completed tasks re-opened or sent back for OGA review
+	CreatedAt     string          `json:"createdAt"`
+}
+
+func (a *Amendment) toDTO() AmendmentDTO {
+	return AmendmentDTO{
+		ID:            a.ID,
+		ConsignmentID: a.ConsignmentID,
+		AmendedBy:     a.AmendedBy,
+		Reason:        a.Reason,
+		Changes:       a.Changes,
+		Tasks:         a.Tasks,
+		CreatedAt:     a.CreatedAt.Format(time.RFC3339),
+	}
 }
 
 // ListResult is the pagination envelope returned by the list consignments endpoint.
 type ListResult = pagination.Page[SummaryDTO]
 
+// TimelineResult is the pagination envelope returned by the consignment timeline endpoints.
+type TimelineResult = pagination.Page[timeline.EventDTO]
+
 // Filter will be used when querying consignments as batch.
 // For GET /consignments?role=trader use TraderCompanyID; for role=cha use CHACompanyID.
 // Scoping is company-based so colleagues at the same company see each other's consignments.
@@ -140,8 +378,23 @@ type Filter struct {
 	CHACompanyID    *string `json:"chaCompanyId,omitempty"`
 	Flow            *Flow   `json:"flow,omitempty"`
 	State           *State  `json:"state,omitempty"`
-	Offset          *int    `json:"offset,omitempty"`
-	Limit           *int    `json:"limit,omitempty"`
+	Alert           *bool   `json:"alert,omitempty"`  // Only consignments that do (or do not) need attention
+	CHAID           *string `json:"chaId,omitempty"`  // Only consignments claimed by this CHA
+	HSCode          *string `json:"hsCode,omitempty"` // Only consignments with an item whose HS code starts with this
+	Query           *string `json:"q,omitempty"`      // Consignment ID or trader reference prefix, case-insensitive
+
+	// Date ranges; From is inclusive and To exclusive.
+	CreatedFrom  *time.Time `json:"createdFrom,omitempty"`
+	CreatedTo    *time.Time `json:"createdTo,omitempty"`
+	FinishedFrom *time.Time `json:"finishedFrom,omitempty"`
+	FinishedTo   *time.Time `json:"finishedTo,omitempty"`
+
+	// Sort defaults to SortCreatedDesc. Pages are addressed by Offset or, for large
+	// result sets, by the Cursor of the previous page; not both.
+	Sort   ListSort `json:"sort,omitempty"`
+	Cursor string   `json:"cursor,omitempty"`
+	Offset *int     `json:"offset,omitempty"`
+	Limit  *int     `json:"limit,omitempty"`
 }
 
 // WorkflowTemplateMap represents the mapping between HSCode and Workflow.
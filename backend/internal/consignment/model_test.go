@@ -56,3 +56,29 @@ func TestCreateConsignmentDTO_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestStartConsignmentDTO_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dto     StartConsignmentDTO
+		wantErr bool
+	}{
+		{name: "by HS code", dto: StartConsignmentDTO{Flow: FlowExport, HSCodeID: "hs1"}},
+		{name: "by template", dto: StartConsignmentDTO{Flow: FlowImport, TemplateID: "trade-export-v1", Context: map[string]any{"port": "CMB"}}},
+		{name: "invalid flow", dto: StartConsignmentDTO{Flow: "INVALID", HSCodeID: "hs1"}, wantErr: true},
+		{name: "neither HS code nor template", dto: StartConsignmentDTO{Flow: FlowExport}, wantErr: true},
+		{name: "both HS code and template", dto: StartConsignmentDTO{Flow: FlowExport, HSCodeID: "hs1", TemplateID: "trade-export-v1"}},
+		{name: "reserved context key", dto: StartConsignmentDTO{Flow: FlowExport, HSCodeID: "hs1", Context: map[string]any{"traderCompany": "x"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dto.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -3,8 +3,12 @@ package consignment
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/OpenNSW/core/authn"
 	"github.com/OpenNSW/core/pagination"
@@ -48,7 +52,7 @@ func (c *Router) HandleCreateConsignment(w http.ResponseWriter, r *http.Request)
 
 	traderID := authCtx.User.ID
 	// Stage 1: create shell only
-	consignment, err := c.cs.CreateConsignmentShell(r.Context(), req.Flow, req.ChaCompanyID, traderID)
+	consignment, err := c.cs.CreateConsignmentShell(r.Context(), req.Flow, req.ChaCompanyID, traderID, req.TraderReference)
 	if err != nil {
 		if errors.Is(err, company.ErrCompanyNotFound) {
 			http.Error(w, "CHA company not found", http.StatusNotFound)
@@ -71,9 +75,10 @@ func (c *Router) HandleCreateConsignment(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// HandleStartConsignment handles POST /api/v1/consignments/start
-// Creates an export consignment and starts its workflow directly — no CHA company or HS code
-// is collected up front; the workflow's own tasks collect those later. Response: DetailDTO.
+// HandleStartConsignment handles POST /api/v1/consignments:start
+// Body: StartConsignmentDTO { flow, hsCodeId and/or templateId, context }. Creates a consignment and
+// starts its workflow directly — no CHA company is collected up front; the workflow's own tasks
+// collect it later. Response: DetailDTO.
 func (c *Router) HandleStartConsignment(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	authCtx := authn.GetAuthContext(ctx)
@@ -81,10 +86,26 @@ func (c *Router) HandleStartConsignment(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	defer func() { _ = r.Body.Close() }()
+
+	var req StartConsignmentDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	traderID := authCtx.User.ID
-	consignment, err := c.cs.CreateAndStartConsignment(ctx, traderID)
+	consignment, err := c.cs.CreateAndStartConsignment(ctx, traderID, req)
 	if err != nil {
+		if errors.Is(err, ErrNoWorkflowTemplate) || errors.Is(err, ErrTemplateNotInFlow) ||
+			errors.Is(err, ErrTemplateNotForHSCode) || errors.Is(err, ErrContextKeyWorkflowOwned) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		slog.Error("failed to create and start consignment", "error", err)
 		http.Error(w, "failed to create consignment: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -98,10 +119,27 @@ func (c *Router) HandleStartConsignment(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// accessorFromAuthContext derives the consignment Accessor for the authenticated principal.
+// Returns nil when the request carries no principal.
+func accessorFromAuthContext(authCtx *authn.AuthContext) *Accessor {
+	switch {
+	case authCtx == nil:
+		return nil
+	case authCtx.User != nil:
+		u := authCtx.User
+		return NewUserAccessor(u.ID, u.Email, u.OUHandle, u.Roles)
+	case authCtx.Client != nil:
+		return NewClientAccessor(authCtx.Client.ClientID, authCtx.Client.Roles)
+	default:
+		return nil
+	}
+}
+
 // HandleGetConsignments handles GET /api/v1/consignments
-// Query params: role=trader | role=cha (defaults to trader).
-// When role=cha the CHA is resolved from the authenticated user's email.
-// Pagination: offset, limit. Optional filters: state, flow.
+// The list perspective is derived from the user's IdP roles: Trader lists the company's
+// consignments as trader, CHA as CHA company. Users holding both may pick one with
+// role=trader | role=cha (defaults to trader); asking for a role not held is rejected.
+// Pagination: offset or cursor, limit. Optional filters: see parseListFilters.
 func (c *Router) HandleGetConsignments(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	authCtx := authn.GetAuthContext(ctx)
@@ -110,11 +148,6 @@ func (c *Router) HandleGetConsignments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Proper AuthZ need to be implemented.
-	role := r.URL.Query().Get("role")
-	if role == "" {
-		role = "trader"
-	}
 	offset, limit, err := pagination.ParsePaginationParams(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -124,43 +157,159 @@ func (c *Router) HandleGetConsignments(w http.ResponseWriter, r *http.Request) {
 		Offset: offset,
 		Limit:  limit,
 	}
-
-	// Optional Filters
-	if stateStr := r.URL.Query().Get("state"); stateStr != "" {
-		state := State(stateStr)
-		filter.State = &state
+	if err := parseListFilters(r, &filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if flowStr := r.URL.Query().Get("flow"); flowStr != "" {
-		flow := Flow(flowStr)
-		filter.Flow = &flow
+	if !c.scopeToUserCompany(w, r, authCtx, &filter) {
+		return
 	}
-
-	// Role-based identity resolution. Both roles scope to the requesting user's company,
-	// resolved from the OU handle that the auth middleware copied off the JWT.
-	if role != "trader" && role != "cha" {
-		http.Error(w, "query param role must be trader or cha", http.StatusBadRequest)
+	consignments, err := c.cs.ListConsignments(ctx, filter)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to retrieve consignments", "error", err)
+		http.Error(w, "failed to retrieve consignments", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(consignments); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// scopeToUserCompany scopes filter to the company of the requesting user, as trader or as
+// CHA company depending on the role query parameter (see HandleGetConsignments). It writes
+// the error response and returns false when the user's list role or company cannot be
+// resolved.
+func (c *Router) scopeToUserCompany(w http.ResponseWriter, r *http.Request, authCtx *authn.AuthContext, filter *Filter) bool {
+	role, err := listRole(accessorFromAuthContext(authCtx), r.URL.Query().Get("role"))
+	if err != nil {
+		if errors.Is(err, ErrRoleNotHeld) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return false
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
 
-	userCompany, err := c.company.GetCompanyByOUHandle(ctx, authCtx.User.OUHandle)
+	// Both roles scope to the requesting user's company, resolved from the OU handle that
+	// the auth middleware copied off the JWT.
+	userCompany, err := c.company.GetCompanyByOUHandle(r.Context(), authCtx.User.OUHandle)
 	if err != nil {
 		if errors.Is(err, company.ErrCompanyNotFound) {
 			http.Error(w, "company profile not found for user", http.StatusForbidden)
-			return
+			return false
 		}
 		slog.Error("failed to resolve user company", "ouHandle", authCtx.User.OUHandle, "error", err)
 		http.Error(w, "failed to resolve user company", http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	switch role {
-	case "cha":
+	case listRoleCHA:
 		filter.CHACompanyID = &userCompany.ID
-	case "trader":
+	case listRoleTrader:
 		filter.TraderCompanyID = &userCompany.ID
 	}
-	consignments, err := c.cs.ListConsignments(ctx, filter)
+	return true
+}
+
+// parseListFilters reads the optional list filters state, flow, alert (true lists the
+// FAILED and STALLED consignments, false the rest), chaId, hsCode (a prefix), q (an ID or
+// trader reference prefix) and the createdFrom, createdTo, finishedFrom and finishedTo
+// ranges, plus the sort and cursor.
+func parseListFilters(r *http.Request, filter *Filter) error {
+	query := r.URL.Query()
+	if stateStr := query.Get("state"); stateStr != "" {
+		state := State(stateStr)
+		filter.State = &state
+	}
+	if flowStr := query.Get("flow"); flowStr != "" {
+		flow := Flow(flowStr)
+		filter.Flow = &flow
+	}
+	if alertStr := query.Get("alert"); alertStr != "" {
+		alert, err := strconv.ParseBool(alertStr)
+		if err != nil {
+			return fmt.Errorf("alert must be true or false")
+		}
+		filter.Alert = &alert
+	}
+	for _, p := range []struct {
+		name  string
+		field **string
+	}{{"chaId", &filter.CHAID}, {"hsCode", &filter.HSCode}, {"q", &filter.Query}} {
+		if value := query.Get(p.name); value != "" {
+			*p.field = &value
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		field **time.Time
+	}{
+		{"createdFrom", &filter.CreatedFrom}, {"createdTo", &filter.CreatedTo},
+		{"finishedFrom", &filter.FinishedFrom}, {"finishedTo", &filter.FinishedTo},
+	} {
+		value := query.Get(p.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", p.name)
+		}
+		*p.field = &t
+	}
+
+	sort, err := ParseListSort(query.Get("sort"))
+	if err != nil {
+		return err
+	}
+	filter.Sort = sort
+	filter.Cursor = query.Get("cursor")
+	if filter.Cursor != "" && filter.Offset != nil {
+		return fmt.Errorf("cursor and offset cannot be combined")
+	}
+	return nil
+}
+
+// parseTimeParam reads an RFC 3339 timestamp or a date, which is midnight UTC.
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// HandleListAllConsignments handles GET /api/v1/admin/consignments
+// Support staff list consignments across all companies; alert=true finds the FAILED and
+// STALLED ones. Pagination: offset or cursor, limit. Optional filters: see parseListFilters.
+func (c *Router) HandleListAllConsignments(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := pagination.ParsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := Filter{
+		Offset: offset,
+		Limit:  limit,
+	}
+	if err := parseListFilters(r, &filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	consignments, err := c.cs.ListAllConsignments(r.Context(), filter)
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		slog.Error("failed to retrieve consignments", "error", err)
 		http.Error(w, "failed to retrieve consignments", http.StatusInternalServerError)
 		return
@@ -173,6 +322,99 @@ func (c *Router) HandleGetConsignments(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleExportConsignments handles GET /api/v1/consignments/export
+// Streams the consignments HandleGetConsignments would list, with the same role and
+// filters, as a spreadsheet of every match rather than a page: format=csv (default) or
+// format=xlsx. Each row carries the consignment's HS codes, state, task progress, the
+// latest task status per OGA and the amounts paid.
+func (c *Router) HandleExportConsignments(w http.ResponseWriter, r *http.Request) {
+	authCtx := authn.GetAuthContext(r.Context())
+	if authCtx == nil || authCtx.User == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var filter Filter
+	if err := parseExportFilters(r, &filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !c.scopeToUserCompany(w, r, authCtx, &filter) {
+		return
+	}
+	writeExport(w, r, func(format string, out io.Writer) error {
+		return c.cs.ExportConsignments(r.Context(), filter, format, out)
+	})
+}
+
+// HandleExportAllConsignments handles GET /api/v1/admin/consignments/export
+// Support staff export consignments across all companies, with the filters and formats of
+// HandleExportConsignments.
+func (c *Router) HandleExportAllConsignments(w http.ResponseWriter, r *http.Request) {
+	var filter Filter
+	if err := parseExportFilters(r, &filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeExport(w, r, func(format string, out io.Writer) error {
+		return c.cs.ExportAllConsignments(r.Context(), filter, format, out)
+	})
+}
+
+// parseExportFilters reads the list filters of an export; exports are not paginated.
+func parseExportFilters(r *http.Request, filter *Filter) error {
+	if err := parseListFilters(r, filter); err != nil {
+		return err
+	}
+	if filter.Cursor != "" {
+		return fmt.Errorf("exports are not paginated; cursor is not accepted")
+	}
+	return nil
+}
+
+// writeExport validates the format query parameter and streams the export written by
+// export as an attachment. Errors met once rows have been sent can only be logged.
+func writeExport(w http.ResponseWriter, r *http.Request, export func(format string, out io.Writer) error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	out := &exportResponse{w: w, contentType: contentType,
+		filename: fmt.Sprintf("consignments-%s.%s", time.Now().UTC().Format("20060102-150405"), format)}
+	if err := export(format, out); err != nil {
+		if out.started {
+			slog.Error("consignment export aborted", "error", err)
+			return
+		}
+		slog.Error("failed to export consignments", "error", err)
+		http.Error(w, "failed to export consignments", http.StatusInternalServerError)
+	}
+}
+
+// exportResponse sends the export headers with the first bytes of the file, so a failure
+// before any row is written can still be answered with an error status.
+type exportResponse struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.contentType)
+		e.w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename+`"`)
+		e.w.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(p)
+}
+
 // HandleInitializeConsignment handles PUT /api/v1/consignments/{id} (Stage 2: CHA selects HS Codes).
 // Body: InitializeConsignmentDTO { hsCodeIds: []uuid }. Response: DetailDTO.
 func (c *Router) HandleInitializeConsignment(w http.ResponseWriter, r *http.Request) {
@@ -213,8 +455,12 @@ func (c *Router) HandleInitializeConsignment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	consignment, err := c.cs.InitializeConsignmentByID(r.Context(), consignmentID, req.HSCodeIDs, chaRecord.ID)
+	consignment, err := c.cs.InitializeConsignmentByID(r.Context(), accessorFromAuthContext(authCtx), consignmentID, req.HSCodeIDs, chaRecord.ID)
 	if err != nil {
+		if errors.Is(err, ErrConsignmentNotFound) {
+			http.Error(w, "consignment not found", http.StatusNotFound)
+			return
+		}
 		if errors.Is(err, ErrCHACompanyMismatch) {
 			http.Error(w, "CHA does not belong to the consignment's CHA company", http.StatusForbidden)
 			return
@@ -233,13 +479,198 @@ func (c *Router) HandleInitializeConsignment(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// HandleCancelConsignment handles POST /api/v1/consignments/{id}/cancel
+// Body: CancelConsignmentDTO { reason }. The consignment's trader withdraws it: its workflows
+// are cancelled, open tasks closed and OGAs with outstanding reviews notified. Refused with
+// 409 once an OGA has issued a decision or the consignment is no longer open. Response: DetailDTO.
+func (c *Router) HandleCancelConsignment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	consignmentID := r.PathValue("id")
+	if consignmentID == "" {
+		http.Error(w, "consignment ID is required", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = r.Body.Close() }()
+
+	var req CancelConsignmentDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	consignment, err := c.cs.CancelConsignment(ctx, accessor, consignmentID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrConsignmentNotFound):
+			http.Error(w, "consignment not found", http.StatusNotFound)
+		case errors.Is(err, ErrNotConsignmentTrader):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrConsignmentNotCancellable), errors.Is(err, ErrOGADecisionIssued):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error("failed to cancel consignment", "consignmentId", consignmentID, "error", err)
+			http.Error(w, "failed to cancel consignment: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(consignment); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleAmendConsignment handles POST /api/v1/consignments/{id}/amendments
+// Body: AmendConsignmentDTO { changes, reason }. The consignment's trader corrects global
+// context values of a running consignment; completed tasks that used them are re-opened or
+// sent back for OGA review. Refused with 409 unless the consignment is IN_PROGRESS or while
+// a task using the values is running. Response: AmendmentDTO (201).
+func (c *Router) HandleAmendConsignment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	consignmentID := r.PathValue("id")
+	if consignmentID == "" {
+		http.Error(w, "consignment ID is required", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = r.Body.Close() }()
+
+	var req AmendConsignmentDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amendment, err := c.cs.AmendConsignment(ctx, accessor, consignmentID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrConsignmentNotFound):
+			http.Error(w, "consignment not found", http.StatusNotFound)
+		case errors.Is(err, ErrNotConsignmentTrader):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrUnknownContextKey), errors.Is(err, ErrContextKeyNotAmendable), errors.Is(err, ErrNothingToAmend):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrConsignmentNotAmendable), errors.Is(err, ErrAmendmentConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error("failed to amend consignment", "consignmentId", consignmentID, "error", err)
+			http.Error(w, "failed to amend consignment: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(amendment); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleListAmendments handles GET /api/v1/consignments/{id}/amendments
+// Response: the consignment's amendments, oldest first ([]AmendmentDTO).
+func (c *Router) HandleListAmendments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	consignmentID := r.PathValue("id")
+	if consignmentID == "" {
+		http.Error(w, "consignment ID is required", http.StatusBadRequest)
+		return
+	}
+
+	amendments, err := c.cs.ListAmendments(ctx, accessor, consignmentID)
+	if err != nil {
+		if errors.Is(err, ErrConsignmentNotFound) {
+			http.Error(w, "consignment not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to list amendments", "consignmentId", consignmentID, "error", err)
+		http.Error(w, "failed to list amendments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(amendments); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleRetryConsignment handles POST /api/v1/admin/consignments/{id}/retry
+// Support staff resume a FAILED or STALLED consignment: its failed task workflows, and the
+// parent workflow if it failed, are reset to their last completed step. Refused with 409
+// for consignments in any other state. Response: DetailDTO.
+func (c *Router) HandleRetryConsignment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	consignmentID := r.PathValue("id")
+	if consignmentID == "" {
+		http.Error(w, "consignment ID is required", http.StatusBadRequest)
+		return
+	}
+
+	consignment, err := c.cs.RetryConsignment(ctx, accessor, consignmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrConsignmentNotFound):
+			http.Error(w, "consignment not found", http.StatusNotFound)
+		case errors.Is(err, ErrConsignmentNotRetryable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error("failed to retry consignment", "consignmentId", consignmentID, "error", err)
+			http.Error(w, "failed to retry consignment: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(consignment); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
 // HandleGetConsignmentByID handles GET /api/v1/consignments/{id}
 // Path param: id (required)
-// Response: DetailDTO
+// Response: DetailDTO. Consignments the caller may not access are reported as 404.
+// OGA machine clients are admitted when a task on the consignment was dispatched to them.
 func (c *Router) HandleGetConsignmentByID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	authCtx := authn.GetAuthContext(ctx)
-	if authCtx == nil || authCtx.User == nil {
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -254,8 +685,12 @@ func (c *Router) HandleGetConsignmentByID(w http.ResponseWriter, r *http.Request
 	consignmentID := consignmentIDStr
 
 	// Get consignment from service
-	consignment, err := c.cs.GetConsignmentByID(r.Context(), consignmentID)
+	consignment, err := c.cs.GetConsignmentByID(r.Context(), accessor, consignmentID)
 	if err != nil {
+		if errors.Is(err, ErrConsignmentNotFound) {
+			http.Error(w, "consignment not found", http.StatusNotFound)
+			return
+		}
 		slog.Error("failed to retrieve consignment", "error", err)
 		http.Error(w, "failed to retrieve consignment: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -270,3 +705,137 @@ func (c *Router) HandleGetConsignmentByID(w http.ResponseWriter, r *http.Request
 		return
 	}
 }
+
+// HandleGetTimeline handles GET /api/v1/consignments/{id}/timeline
+// Response: a page of the consignment's events, oldest first (TimelineResult).
+// Pagination: offset, limit.
+func (c *Router) HandleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c.writeTimeline(w, r, func(consignmentID string, offset, limit *int) (*TimelineResult, error) {
+		return c.cs.GetTimeline(ctx, accessor, consignmentID, offset, limit)
+	})
+}
+
+// HandleGetTimelineForSupport handles GET /api/v1/admin/consignments/{id}/timeline
+// Support staff read the timeline of any consignment. Response and pagination as for
+// HandleGetTimeline.
+func (c *Router) HandleGetTimelineForSupport(w http.ResponseWriter, r *http.Request) {
+	c.writeTimeline(w, r, func(consignmentID string, offset, limit *int) (*TimelineResult, error) {
+		return c.cs.GetTimelineForSupport(r.Context(), consignmentID, offset, limit)
+	})
+}
+
+func (c *Router) writeTimeline(w http.ResponseWriter, r *http.Request, get func(consignmentID string, offset, limit *int) (*TimelineResult, error)) {
+	consignmentID := r.PathValue("id")
+	if consignmentID == "" {
+		http.Error(w, "consignment ID is required", http.StatusBadRequest)
+		return
+	}
+	offset, limit, err := pagination.ParsePaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := get(consignmentID, offset, limit)
+	if err != nil {
+		if errors.Is(err, ErrConsignmentNotFound) {
+			http.Error(w, "consignment not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get consignment timeline", "consignmentId", consignmentID, "error", err)
+		http.Error(w, "failed to get consignment timeline: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleCreateImport handles POST /api/v1/consignment-imports
+// Body: CreateImportDTO { fileKey, autoStart }. Queues a bulk import of the CSV or XLSX file
+// uploaded through POST /api/v1/storage; its rows become consignment shells of the trader's
+// company, started when autoStart is set. Response: ImportDTO (202), to be polled through
+// HandleGetImport for the per-row report.
+func (c *Router) HandleCreateImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	authCtx := authn.GetAuthContext(ctx)
+	if authCtx == nil || authCtx.User == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer func() { _ = r.Body.Close() }()
+
+	var req CreateImportDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := c.cs.SubmitImport(ctx, authCtx.User.ID, req)
+	if err != nil {
+		if errors.Is(err, ErrImportFileNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to submit consignment import", "error", err)
+		http.Error(w, "failed to submit import: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGetImport handles GET /api/v1/consignment-imports/{id}
+// Response: ImportDTO with the outcome of every row once the import has run. Imports of
+// other companies are reported as 404.
+func (c *Router) HandleGetImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accessor := accessorFromAuthContext(authn.GetAuthContext(ctx))
+	if accessor == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	importID := r.PathValue("id")
+	if importID == "" {
+		http.Error(w, "import ID is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := c.cs.GetImport(ctx, accessor, importID)
+	if err != nil {
+		if errors.Is(err, ErrImportNotFound) {
+			http.Error(w, "consignment import not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get consignment import", "importId", importID, "error", err)
+		http.Error(w, "failed to get import: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		slog.Error("failed to encode response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
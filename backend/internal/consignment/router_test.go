@@ -23,6 +23,7 @@ import (
 	"github.com/OpenNSW/nsw/backend/internal/profile/cha"
 	"github.com/OpenNSW/nsw/backend/internal/profile/company"
 	"github.com/OpenNSW/nsw/backend/internal/profile/user"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
 )
 
@@ -31,33 +32,44 @@ func withAuthContext(ctx context.Context, userID string) context.Context {
 		User: &authn.UserContext{
 			ID:    userID,
 			Email: userID + "@example.com",
+			Roles: []string{RoleTrader, RoleCHA},
 		},
 	}
 	return context.WithValue(ctx, authn.AuthContextKey, authCtx)
 }
 
-func withAuthContextOU(ctx context.Context, userID, ouHandle string) context.Context {
+func withAuthContextOU(ctx context.Context, userID, ouHandle string, roles ...string) context.Context {
 	authCtx := &authn.AuthContext{
 		User: &authn.UserContext{
 			ID:       userID,
 			Email:    userID + "@example.com",
 			OUHandle: ouHandle,
+			Roles:    roles,
 		},
 	}
 	return context.WithValue(ctx, authn.AuthContextKey, authCtx)
 }
 
+func withClientAuthContext(ctx context.Context, clientID string) context.Context {
+	authCtx := &authn.AuthContext{
+		Client: &authn.ClientContext{ClientID: clientID},
+	}
+	return context.WithValue(ctx, authn.AuthContextKey, authCtx)
+}
+
 func TestConsignmentRouter_HandleGetConsignmentByID(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
 	mockWM := new(MockWMV2)
 	mockTaskStore := new(MockTaskStore)
-	svc := NewService(db, nil, nil, nil, nil, nil, mockTaskStore)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, mockTaskStore)
 	require.NoError(t, svc.RegisterWorkflowManager(mockWM))
 	r := NewRouter(svc, nil, nil)
 
 	consignmentID := uuid.NewString()
 	sqlMock.MatchExpectationsInOrder(false)
-	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(consignmentID, "IN_PROGRESS"))
+	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id"}).AddRow(consignmentID, "IN_PROGRESS", "company-trader"))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
 
 	mockWM.On("GetStatus", mock.Anything, consignmentID).Return((*workflowManagerV2.WorkflowInstance)(nil), nil)
 
@@ -67,7 +79,7 @@ func TestConsignmentRouter_HandleGetConsignmentByID(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/api/v1/consignments/"+consignmentID, nil)
 	req.SetPathValue("id", consignmentID)
-	req = req.WithContext(withAuthContext(req.Context(), "trader1"))
+	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
 
 	w := httptest.NewRecorder()
 	r.HandleGetConsignmentByID(w, req)
@@ -88,11 +100,9 @@ func TestConsignmentRouter_HandleGetConsignments(t *testing.T) {
 	sqlMock.MatchExpectationsInOrder(false)
 	sqlMock.ExpectQuery("(?i)SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id", "trader_id", "trader_company_id"}).AddRow(uuid.NewString(), traderID, companyID))
-	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"workflow_nodes\"").WillReturnRows(sqlmock.NewRows([]string{"workflow_id", "total", "completed"}).AddRow(uuid.NewString(), 1, 0))
-	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"workflows\"").WillReturnRows(sqlmock.NewRows([]string{"id", "end_node_id"}))
 
 	req, _ := http.NewRequest("GET", "/api/v1/consignments?role=trader&state=IN_PROGRESS&flow=IMPORT", nil)
-	req = req.WithContext(withAuthContextOU(req.Context(), traderID, "trader-ou"))
+	req = req.WithContext(withAuthContextOU(req.Context(), traderID, "trader-ou", RoleTrader))
 	w := httptest.NewRecorder()
 	r.HandleGetConsignments(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -111,7 +121,7 @@ func TestConsignmentRouter_HandleGetConsignments_RoleCHA(t *testing.T) {
 	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 	req, _ := http.NewRequest("GET", "/api/v1/consignments?role=cha", nil)
-	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou"))
+	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou", RoleCHA))
 	w := httptest.NewRecorder()
 	r.HandleGetConsignments(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -145,6 +155,7 @@ func TestConsignmentRouter_HandleCreateConsignment(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectExec("(?i)INSERT INTO \"consignments\"").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "", "INITIALIZED")
 	sqlMock.ExpectCommit()
 
 	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(
@@ -186,17 +197,18 @@ func TestConsignmentRouter_HandleInitializeConsignment(t *testing.T) {
 	mockCHA.On("GetByEmail", mock.Anything, chaEmail).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
 	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
 	mockCompany.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, OUHandle: "trader-ou", Data: []byte(`{}`)}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
 
 	payload := InitializeConsignmentDTO{HSCodeIDs: []string{hsID}}
 	body, _ := json.Marshal(payload)
 
 	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id", "trader_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", chaCompanyID, traderCompanyID))
 	sqlMock.ExpectBegin()
-	sqlMock.ExpectExec("(?i)UPDATE \"consignments\"").WillReturnResult(sqlmock.NewResult(1, 1))
-
 	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"workflow_template_map\"").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
 			AddRow(uuid.NewString(), hsID, "IMPORT", wtID))
+	sqlMock.ExpectExec("(?i)UPDATE \"consignments\"").WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "INITIALIZED", "IN_PROGRESS")
 
 	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, wtID).Return(&model.WorkflowTemplateV2{
 		WorkflowDefinition: workflowManagerV2.WorkflowDefinition{ID: "template1"},
@@ -213,7 +225,7 @@ func TestConsignmentRouter_HandleInitializeConsignment(t *testing.T) {
 
 	req, _ := http.NewRequest("PUT", "/api/v1/consignments/"+id, bytes.NewBuffer(body))
 	req.SetPathValue("id", id)
-	req = req.WithContext(withAuthContext(req.Context(), "cha1"))
+	req = req.WithContext(withAuthContextOU(req.Context(), "cha1", "cha-ou", RoleCHA))
 
 	w := httptest.NewRecorder()
 	r.HandleInitializeConsignment(w, req)
@@ -306,7 +318,7 @@ func TestConsignmentRouter_HandleGetConsignments_ServiceError(t *testing.T) {
 	sqlMock.ExpectQuery("(?i)SELECT count").WillReturnError(fmt.Errorf("db error"))
 
 	req, _ := http.NewRequest("GET", "/api/v1/consignments", nil)
-	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou"))
+	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
 	w := httptest.NewRecorder()
 	r.HandleGetConsignments(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
@@ -362,7 +374,7 @@ func TestConsignmentRouter_HandleGetConsignments_CompanyNotFound(t *testing.T) {
 	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "cha-ou").Return(nil, company.ErrCompanyNotFound)
 
 	req, _ := http.NewRequest("GET", "/api/v1/consignments?role=cha", nil)
-	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou"))
+	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou", RoleCHA))
 
 	w := httptest.NewRecorder()
 	r.HandleGetConsignments(w, req)
@@ -428,8 +440,109 @@ func TestConsignmentRouter_HandleGetConsignments_CompanyLookupError(t *testing.T
 	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "cha-ou").Return(nil, fmt.Errorf("db down"))
 
 	req, _ := http.NewRequest("GET", "/api/v1/consignments?role=cha", nil)
-	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou"))
+	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou", RoleCHA))
 	w := httptest.NewRecorder()
 	r.HandleGetConsignments(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
+
+func TestConsignmentRouter_HandleGetConsignmentByID_NotOwnerGets404(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+	r := NewRouter(svc, nil, nil)
+
+	id := uuid.NewString()
+	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id"}).AddRow(id, "IN_PROGRESS", "company-trader"))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
+
+	req, _ := http.NewRequest("GET", "/api/v1/consignments/"+id, nil)
+	req.SetPathValue("id", id)
+	req = req.WithContext(withAuthContextOU(req.Context(), "intruder", "other-ou", RoleTrader))
+	w := httptest.NewRecorder()
+	r.HandleGetConsignmentByID(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConsignmentRouter_HandleGetConsignmentByID_ClientWithoutTaskGets404(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+	r := NewRouter(svc, nil, nil)
+
+	id := uuid.NewString()
+	sqlMock.ExpectQuery("(?i)SELECT .* FROM \"consignments\"").WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id"}).AddRow(id, "IN_PROGRESS", "company-trader"))
+
+	req, _ := http.NewRequest("GET", "/api/v1/consignments/"+id, nil)
+	req.SetPathValue("id", id)
+	req = req.WithContext(withClientAuthContext(req.Context(), "NPQS_TO_NSW"))
+	w := httptest.NewRecorder()
+	r.HandleGetConsignmentByID(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConsignmentRouter_HandleGetConsignments_RoleNotHeld(t *testing.T) {
+	r := NewRouter(NewService(nil, nil, nil, nil, nil, nil, nil), nil, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/consignments?role=cha", nil)
+	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou", RoleTrader))
+	w := httptest.NewRecorder()
+	r.HandleGetConsignments(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestConsignmentRouter_HandleGetConsignments_RoleDerivedFromIdP(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+	r := NewRouter(svc, nil, mockCompany)
+
+	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "cha-ou").Return(&company.Record{ID: "company-cha", OUHandle: "cha-ou", HasCHA: true}, nil)
+	// No role query parameter: a CHA-only user gets the CHA company view.
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" .* WHERE cha_company_id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req, _ := http.NewRequest("GET", "/api/v1/consignments", nil)
+	req = req.WithContext(withAuthContextOU(req.Context(), "cha", "cha-ou", RoleCHA))
+	w := httptest.NewRecorder()
+	r.HandleGetConsignments(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockCompany.AssertExpectations(t)
+}
+
+func TestConsignmentRouter_HandleStartConsignment_Validation(t *testing.T) {
+	svc := NewService(nil, nil, nil, nil, nil, nil, nil)
+	r := NewRouter(svc, nil, nil)
+
+	for name, body := range map[string]string{
+		"malformed":        `{`,
+		"no template":      `{"flow":"EXPORT"}`,
+		"reserved context": `{"flow":"EXPORT","templateId":"trade-export-v1","context":{"items":[]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/v1/consignments:start", bytes.NewBufferString(body))
+			req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou"))
+			w := httptest.NewRecorder()
+			r.HandleStartConsignment(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestConsignmentRouter_HandleStartConsignment_TemplateNotInFlow(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockUser := new(MockUserService)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, mockUser, nil, nil)
+	r := NewRouter(svc, nil, mockCompany)
+
+	mockUser.On("GetUser", "trader1").Return(&user.Record{ID: "trader1", OUHandle: "trader-ou"}, nil)
+	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "trader-ou").Return(&company.Record{ID: "trader-company", Data: []byte(`{}`)}, nil)
+	sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "workflow_template_map"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	req, _ := http.NewRequest("POST", "/api/v1/consignments:start", bytes.NewBufferString(`{"flow":"IMPORT","templateId":"trade-export-v1"}`))
+	req = req.WithContext(withAuthContextOU(req.Context(), "trader1", "trader-ou"))
+	w := httptest.NewRecorder()
+	r.HandleStartConsignment(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not available for the consignment flow")
+}
@@ -0,0 +1,166 @@
+package consignment
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/OpenNSW/nsw/backend/pkg/pagination"
+)
+
+// ListSort orders consignment listings. A leading '-' sorts newest first.
+type ListSort string
+
+const (
+	SortCreatedDesc  ListSort = "-createdAt"
+	SortCreatedAsc   ListSort = "createdAt"
+	SortUpdatedDesc  ListSort = "-updatedAt"
+	SortUpdatedAsc   ListSort = "updatedAt"
+	SortFinishedDesc ListSort = "-finishedAt"
+	SortFinishedAsc  ListSort = "finishedAt"
+)
+
+// sortColumns maps each sort to the timestamp column it orders by; ties are broken by ID.
+var sortColumns = map[ListSort]string{
+	SortCreatedDesc:  "created_at",
+	SortCreatedAsc:   "created_at",
+	SortUpdatedDesc:  "updated_at",
+	SortUpdatedAsc:   "updated_at",
+	SortFinishedDesc: "finished_at",
+	SortFinishedAsc:  "finished_at",
+}
+
+// ParseListSort reads a sort query value; empty means SortCreatedDesc.
+func ParseListSort(value string) (ListSort, error) {
+	if value == "" {
+		return SortCreatedDesc, nil
+	}
+	sort := ListSort(value)
+	if _, ok := sortColumns[sort]; !ok {
+		return "", fmt.Errorf("sort must be one of createdAt, updatedAt or finishedAt, optionally prefixed with '-'")
+	}
+	return sort, nil
+}
+
+func (s ListSort) column() string {
+	return sortColumns[s]
+}
+
+func (s ListSort) descending() bool {
+	return strings.HasPrefix(string(s), "-")
+}
+
+// orderBy is the ORDER BY clause of s, which the keyset indexes of migration 033 cover.
+// Columns are qualified because listings join task_progress, which has its own updated_at.
+func (s ListSort) orderBy() string {
+	dir := "ASC"
+	if s.descending() {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("consignments.%s %s, consignments.id %s", s.column(), dir, dir)
+}
+
+// sortKey is the value of the sort column for c.
+func (s ListSort) sortKey(c *Consignment) time.Time {
+	switch s.column() {
+	case "updated_at":
+		return c.UpdatedAt
+	case "finished_at":
+		if c.FinishedAt != nil {
+			return *c.FinishedAt
+		}
+		return time.Time{}
+	default:
+		return c.CreatedAt
+	}
+}
+
+// listCursor is the position after the last consignment of a page. Sort is kept so a
+// cursor cannot be replayed against a different ordering.
+type listCursor struct {
+	Sort ListSort  `json:"s"`
+	At   time.Time `json:"at"`
+	ID   string    `json:"id"`
+}
+
+func encodeListCursor(sort ListSort, last *Consignment) (string, error) {
+	return pagination.EncodeCursor(listCursor{Sort: sort, At: sort.sortKey(last), ID: last.ID})
+}
+
+func decodeListCursor(sort ListSort, cursor string) (*listCursor, error) {
+	var c listCursor
+	if err := pagination.DecodeCursor(cursor, &c); err != nil || c.Sort != sort || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// applyListFilters adds the state, flow and alert filters of filter to q, then its search
+// filters.
+func applyListFilters(q *gorm.DB, filter Filter) *gorm.DB {
+	if filter.State != nil {
+		q = q.Where("state = ?", *filter.State)
+	}
+	if filter.Flow != nil {
+		q = q.Where("flow = ?", *filter.Flow)
+	}
+	if filter.Alert != nil {
+		if *filter.Alert {
+			q = q.Where("state IN ?", []State{Failed, Stalled})
+		} else {
+			q = q.Where("state NOT IN ?", []State{Failed, Stalled})
+		}
+	}
+	return applySearch(q, filter)
+}
+
+// applySearch adds the search filters of filter to q.
+func applySearch(q *gorm.DB, filter Filter) *gorm.DB {
+	if filter.CHAID != nil {
+		q = q.Where("cha_id = ?", *filter.CHAID)
+	}
+	if filter.HSCode != nil {
+		// The HS code prefix is matched against hs_codes, then the items are probed by
+		// containment so the GIN index on items applies.
+		q = q.Where(`EXISTS (SELECT 1 FROM hs_codes h WHERE h.hs_code LIKE ? AND consignments.items @> jsonb_build_array(jsonb_build_object('hsCodeId', h.id)))`,
+			escapeLike(*filter.HSCode)+"%")
+	}
+	if filter.Query != nil {
+		// Consignment IDs are lower-case UUIDs.
+		prefix := escapeLike(strings.ToLower(*filter.Query)) + "%"
+		q = q.Where("(id LIKE ? OR lower(trader_reference) LIKE ?)", prefix, prefix)
+	}
+	if filter.CreatedFrom != nil {
+		q = q.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		q = q.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.FinishedFrom != nil {
+		q = q.Where("finished_at >= ?", *filter.FinishedFrom)
+	}
+	if filter.FinishedTo != nil {
+		q = q.Where("finished_at < ?", *filter.FinishedTo)
+	}
+	if filter.Sort.column() == "finished_at" {
+		// Only finished consignments have a position in this order.
+		q = q.Where("finished_at IS NOT NULL")
+	}
+	return q
+}
+
+// afterCursor restricts q to the consignments that follow cursor in sort order.
+func afterCursor(q *gorm.DB, sort ListSort, cursor *listCursor) *gorm.DB {
+	op := ">"
+	if sort.descending() {
+		op = "<"
+	}
+	return q.Where(fmt.Sprintf("(consignments.%s, consignments.id) %s (?, ?)", sort.column(), op), cursor.At, cursor.ID)
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,121 @@
+package consignment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/hscode"
+)
+
+func TestConsignmentService_ListConsignments_Search(t *testing.T) {
+	companyID := "company-1"
+	createdFrom := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hsCode, query, chaID := "0902", "PO_2026", "cha1"
+	limit := 2
+	first := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	second := first.Add(-time.Hour)
+
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, hscode.NewService(db), nil)
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" .* WHERE trader_company_id = \$1 `+
+		`AND cha_id = \$2 AND \(EXISTS \(SELECT 1 FROM hs_codes h WHERE h.hs_code LIKE \$3 .*\)\) `+
+		`AND \(\(id LIKE \$4 OR lower\(trader_reference\) LIKE \$5\)\) AND created_at >= \$6 `+
+		`ORDER BY consignments.updated_at DESC, consignments.id DESC LIMIT \$7`).
+		WithArgs(companyID, chaID, "0902%", `po\_2026%`, `po\_2026%`, createdFrom, limit).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "items", "trader_reference", "created_at", "updated_at"}).
+			AddRow("c-1", InProgress, []byte(`[]`), "PO_2026-7", first, first).
+			AddRow("c-2", InProgress, []byte(`[]`), "PO_2026-8", second, second))
+	sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "consignments" WHERE trader_company_id = \$1 AND cha_id = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	result, err := svc.ListConsignments(context.Background(), Filter{
+		TraderCompanyID: &companyID, CHAID: &chaID, HSCode: &hsCode, Query: &query,
+		CreatedFrom: &createdFrom, Sort: SortUpdatedDesc, Limit: &limit,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.Total)
+	require.Len(t, result.Items, 2)
+	assert.Equal(t, "PO_2026-7", result.Items[0].TraderReference)
+	require.NotEmpty(t, result.NextCursor)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+
+	t.Run("next page by cursor", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, hscode.NewService(db), nil)
+		sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" .* WHERE trader_company_id = \$1 `+
+			`AND \(consignments.updated_at, consignments.id\) < \(\$2, \$3\) `+
+			`ORDER BY consignments.updated_at DESC, consignments.id DESC LIMIT \$4`).
+			WithArgs(companyID, second, "c-2", limit).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "state", "items"}).AddRow("c-3", InProgress, []byte(`[]`)))
+
+		page, err := svc.ListConsignments(context.Background(), Filter{
+			TraderCompanyID: &companyID, Sort: SortUpdatedDesc, Cursor: result.NextCursor, Limit: &limit,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), page.Total)
+		assert.Empty(t, page.NextCursor)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("cursor of another sort", func(t *testing.T) {
+		_, err := svc.ListConsignments(context.Background(), Filter{
+			TraderCompanyID: &companyID, Sort: SortCreatedDesc, Cursor: result.NextCursor,
+		})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("finished order lists finished consignments only", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewService(db, nil, nil, nil, nil, hscode.NewService(db), nil)
+		sqlMock.ExpectQuery(`WHERE cha_company_id = \$1 AND finished_at IS NOT NULL ORDER BY consignments.finished_at ASC, consignments.id ASC`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := svc.ListConsignments(context.Background(), Filter{CHACompanyID: &companyID, Sort: SortFinishedAsc})
+		require.NoError(t, err)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestParseListFilters(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet,
+		"/api/v1/consignments?hsCode=0902&q=PO-7&chaId=cha1&createdFrom=2026-01-01&finishedTo=2026-02-01T12:00:00Z&sort=-finishedAt", nil)
+	var filter Filter
+	require.NoError(t, parseListFilters(req, &filter))
+	assert.Equal(t, "0902", *filter.HSCode)
+	assert.Equal(t, "PO-7", *filter.Query)
+	assert.Equal(t, "cha1", *filter.CHAID)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), *filter.CreatedFrom)
+	assert.Equal(t, time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC), *filter.FinishedTo)
+	assert.Equal(t, SortFinishedDesc, filter.Sort)
+
+	for name, query := range map[string]string{
+		"invalid sort":          "sort=state",
+		"invalid date":          "createdTo=yesterday",
+		"cursor with an offset": "cursor=abc&offset=50",
+	} {
+		t.Run(name, func(t *testing.T) {
+			offset := 50
+			filter := Filter{Offset: &offset}
+			if name != "cursor with an offset" {
+				filter.Offset = nil
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/consignments?"+query, nil)
+			assert.Error(t, parseListFilters(req, &filter))
+		})
+	}
+}
+
+func TestConsignmentRouter_HandleListAllConsignments_InvalidCursor(t *testing.T) {
+	db, _ := setupTestDB(t)
+	req, _ := http.NewRequest("GET", "/api/v1/admin/consignments?cursor=bm90LWEtY3Vyc29y", nil)
+	w := httptest.NewRecorder()
+	NewRouter(NewService(db, nil, nil, nil, nil, nil, nil), nil, nil).HandleListAllConsignments(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,18 +15,26 @@ import (
 	workflowmanager "github.com/OpenNSW/go-temporal-workflow"
 	tfstore "github.com/OpenNSW/nsw-task-flow/store"
 
+	"github.com/OpenNSW/nsw/backend/internal/authz"
 	"github.com/OpenNSW/nsw/backend/internal/hscode"
 	"github.com/OpenNSW/nsw/backend/internal/profile/cha"
 	"github.com/OpenNSW/nsw/backend/internal/profile/company"
 	"github.com/OpenNSW/nsw/backend/internal/profile/user"
+	taskstore "github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/service"
 	"github.com/OpenNSW/nsw/backend/pkg/pagination"
 )
 
-// TaskStore is the narrow interface needed from taskv2 package to load task records.
+// TaskStore is the narrow interface needed from taskv2 package to load task records,
+// to close them when a consignment is cancelled, to reopen failed ones on a retry and to
+// supersede completed ones on an amendment.
 type TaskStore interface {
 	GetAllTasks(ctx context.Context, parentWorkflowID string) []tfstore.TaskRecord
+	CancelTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error
+	RetryTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error
+	SupersedeTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error
 }
 
 // Service handles consignment-related operations.
@@ -43,6 +52,13 @@ type Service struct {
 	userService      user.Service
 	hsCodeService    *hscode.Service
 	taskStore        TaskStore
+	accessPolicy     *authz.ConsignmentPolicy
+	canceller        WorkflowCanceller
+	ogaNotifier      OGANotifier
+	supervisor       WorkflowSupervisor
+	activator        TaskActivator
+	signaller        WorkflowSignaller
+	importFiles      ImportFileStore
 }
 
 // NewService creates a new instance of Service.
@@ -63,6 +79,7 @@ func NewService(
 		userService:      userService,
 		hsCodeService:    hsCodeService,
 		taskStore:        taskStore,
+		accessPolicy:     &authz.ConsignmentPolicy{},
 	}
 }
 
@@ -177,16 +194,22 @@ func toCoreWorkflowDefinition(def workflowmanager.WorkflowDefinition) core.Workf
 
 // CompletionHandler is called by the workflow runtime when a workflow completes. It delegates to the appropriate domain-specific handler based on the workflow type.
 func (s *Service) CompletionHandler(workflowID string, finalContext map[string]any) error {
-	return s.OnWorkflowStatusChanged(context.Background(), s.db, workflowID, model.WorkflowStatusInProgress, model.WorkflowStatusCompleted, nil)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.OnWorkflowStatusChanged(context.Background(), tx, workflowID, model.WorkflowStatusInProgress, model.WorkflowStatusCompleted, nil)
+	})
 }
 
 // --- WorkflowEventHandler implementation ---
 
 // OnWorkflowStatusChanged handles workflow lifecycle state propagation to consignment domain state.
+// The parent runtime only reports completions; failures are found by CheckWorkflows, which
+// also records why the workflow failed.
 func (s *Service) OnWorkflowStatusChanged(_ context.Context, tx *gorm.DB, workflowID string, _ model.WorkflowStatus, toStatus model.WorkflowStatus, _ *model.Workflow) error {
 	switch toStatus {
 	case model.WorkflowStatusCompleted:
 		return s.markConsignmentAsFinished(tx, workflowID)
+	case model.WorkflowStatusFailed:
+		return s.recordWorkflowState(tx, workflowID, Failed, "workflow failed")
 	default:
 		return nil
 	}
@@ -194,8 +217,9 @@ func (s *Service) OnWorkflowStatusChanged(_ context.Context, tx *gorm.DB, workfl
 
 // CreateConsignmentShell creates a shell consignment (Stage 1: Trader selects a CHA company).
 // The trader's company is resolved from the trader user's OU handle. The specific CHA is not
-// assigned yet — that happens at Stage 2 (InitializeConsignmentByID).
-func (s *Service) CreateConsignmentShell(ctx context.Context, flow Flow, chaCompanyID string, traderID string) (*DetailDTO, error) {
+// assigned yet — that happens at Stage 2 (InitializeConsignmentByID). traderReference is the
+// trader's own, optional, reference number.
+func (s *Service) CreateConsignmentShell(ctx context.Context, flow Flow, chaCompanyID string, traderID string, traderReference string) (*DetailDTO, error) {
 	chaCompany, err := s.companyService.GetCompanyByID(ctx, chaCompanyID)
 	if err != nil {
 		return nil, fmt.Errorf("CHA company lookup failed: %w", err)
@@ -219,12 +243,18 @@ func (s *Service) CreateConsignmentShell(ctx context.Context, flow Flow, chaComp
 		Flow:            flow,
 		TraderID:        traderID,
 		TraderCompanyID: traderCompany.ID,
+		TraderReference: traderReference,
 		CHACompanyID:    &chaCompany.ID,
 		State:           Initialized,
 		Items:           []Item{},
 	}
-	if err := s.db.WithContext(ctx).Create(consignment).Error; err != nil {
-		return nil, fmt.Errorf("failed to create consignment: %w", err)
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(consignment).Error; err != nil {
+			return fmt.Errorf("failed to create consignment: %w", err)
+		}
+		return timeline.Append(ctx, tx, stateChanged(consignment, "", traderID, nil))
+	}); err != nil {
+		return nil, err
 	}
 	// Reload for response (no workflow nodes at stage 1)
 	if err := s.db.WithContext(ctx).First(consignment, "id = ?", consignment.ID).Error; err != nil {
@@ -239,9 +269,14 @@ func (s *Service) CreateConsignmentShell(ctx context.Context, flow Flow, chaComp
 
 // InitializeConsignmentByID runs Stage 2: a CHA from the consignment's CHA company picks the
 // consignment up, the HS codes are selected, and the workflow is started with the trader
-// company data as initial variables.
+// company data and the per-item context ("items") as initial variables. Each HS code becomes
+// one item; items whose HS codes map to the same workflow template share its sub-flow, and
+// the sub-flows of different templates are merged into one parent workflow (see
+// mergeSubFlows). principal must be allowed access to the consignment by the access policy;
+// otherwise ErrConsignmentNotFound is returned.
 func (s *Service) InitializeConsignmentByID(
 	ctx context.Context,
+	principal authz.Principal,
 	consignmentID string,
 	hsCodeIDs []string,
 	chaID string,
@@ -253,17 +288,18 @@ func (s *Service) InitializeConsignmentByID(
 
 	var consignment Consignment
 	if err := s.db.WithContext(ctx).First(&consignment, "id = ?", consignmentID).Error; err != nil {
-		return nil, fmt.Errorf("consignment not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrConsignmentNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
 	}
 
-	if consignment.State != Initialized {
-		return nil, fmt.Errorf("consignment must be in INITIALIZED (current state: %s)", consignment.State)
+	if err := s.authorizeAccess(ctx, principal, &consignment); err != nil {
+		return nil, err
 	}
 
-	// TODO: add support for collapsing multiple HS codes to one workflow.
-	// Currently, assumes that there is only one HS code selected.
-	if len(hsCodeIDs) > 1 {
-		return nil, fmt.Errorf("workflow manager currently supports only one HS code")
+	if consignment.State != Initialized {
+		return nil, fmt.Errorf("consignment must be in INITIALIZED (current state: %s)", consignment.State)
 	}
 
 	chaRecord, err := s.chaService.GetByID(ctx, chaID)
@@ -284,10 +320,14 @@ func (s *Service) InitializeConsignmentByID(
 	}
 	initialVars := map[string]any{"traderCompany": traderCompanyVars}
 
-	// Prepare items
+	// Prepare items, one per distinct HS code
 	items := make([]Item, 0, len(hsCodeIDs))
+	seen := make(map[string]bool, len(hsCodeIDs))
 	for _, hsCodeID := range hsCodeIDs {
-		items = append(items, Item{HSCodeID: hsCodeID})
+		if !seen[hsCodeID] {
+			seen[hsCodeID] = true
+			items = append(items, Item{HSCodeID: hsCodeID})
+		}
 	}
 
 	tx := s.db.WithContext(ctx).Begin()
@@ -297,35 +337,35 @@ func (s *Service) InitializeConsignmentByID(
 		}
 	}()
 
+	subFlows, err := s.resolveSubFlows(ctx, tx, consignment.Flow, items)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	def, err := mergeSubFlows(subFlows)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to merge workflow templates: %w", err)
+	}
+	initialVars["items"] = itemVars(items)
+
+	previousState := consignment.State
 	consignment.Items = items
 	consignment.State = InProgress
 	consignment.CHAID = &chaID
+	consignment.GlobalContext = initialVars
+	consignment.WorkflowDefinition = &def
 
 	if err := tx.Save(&consignment).Error; err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to update consignment: %w", err)
 	}
-
-	var mapping WorkflowTemplateMap
-	err = tx.Model(&WorkflowTemplateMap{}).
-		Where("hs_code_id = ? AND consignment_flow = ?", hsCodeIDs[0], consignment.Flow).
-		First(&mapping).Error
-
-	if err != nil {
+	if err := timeline.Append(ctx, tx, stateChanged(&consignment, previousState, principal.Subject(), nil)); err != nil {
 		tx.Rollback()
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("no workflow template found for HS code %s and flow %s", hsCodeIDs[0], consignment.Flow)
-		}
-		return nil, fmt.Errorf("failed to get workflow template: %w", err)
-	}
-
-	wt, err := s.templateProvider.GetWorkflowTemplateByIDV2(ctx, mapping.WorkflowTemplateID)
-	if err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to get workflow template from provider: %w", err)
+		return nil, err
 	}
 
-	if err := s.startWorkflow(ctx, consignment.ID, wt.WorkflowDefinition, initialVars); err != nil {
+	if err := s.startWorkflow(ctx, consignment.ID, def, initialVars); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to register workflow: %w", err)
 	}
@@ -357,16 +397,71 @@ func (s *Service) InitializeConsignmentByID(
 	return responseDTO, nil
 }
 
-// directStartExportWorkflowTemplateID is the top-level workflow started immediately by
-// CreateAndStartConsignment. CHA and HS code selection happen inside this workflow's own
-// tasks (trade_1_cha_selection, trade_2_hscode_selection) as workflow variables
-// (trade.cha_id, trade.hs_codes) rather than as an upfront trader/CHA handoff.
-const directStartExportWorkflowTemplateID = "trade-export-v1"
+// resolveSubFlows maps each item's HS code to its workflow template through
+// WorkflowTemplateMap and groups the items by template, in the order the
+// templates are first reached. Each item is stamped with its template and
+// sub-flow key. OGA tasks the templates have in common are
+// de-duplicated later, by mergeSubFlows.
+func (s *Service) resolveSubFlows(ctx context.Context, tx *gorm.DB, flow Flow, items []Item) ([]itemSubFlow, error) {
+	var subFlows []itemSubFlow
+	byTemplate := make(map[string]int)
+	for i := range items {
+		hsCodeID := items[i].HSCodeID
+		var mapping WorkflowTemplateMap
+		err := tx.Model(&WorkflowTemplateMap{}).
+			Where("hs_code_id = ? AND consignment_flow = ?", hsCodeID, flow).
+			First(&mapping).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w for HS code %s and flow %s", ErrNoWorkflowTemplate, hsCodeID, flow)
+			}
+			return nil, fmt.Errorf("failed to get workflow template: %w", err)
+		}
+
+		idx, ok := byTemplate[mapping.WorkflowTemplateID]
+		if !ok {
+			wt, err := s.templateProvider.GetWorkflowTemplateByIDV2(ctx, mapping.WorkflowTemplateID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get workflow template from provider: %w", err)
+			}
+			idx = len(subFlows)
+			byTemplate[mapping.WorkflowTemplateID] = idx
+			subFlows = append(subFlows, itemSubFlow{
+				Key:        fmt.Sprintf("flow%d", idx+1),
+				TemplateID: mapping.WorkflowTemplateID,
+				Definition: wt.WorkflowDefinition,
+			})
+		}
+		subFlows[idx].HSCodeIDs = append(subFlows[idx].HSCodeIDs, hsCodeID)
+		items[i].WorkflowTemplateID = mapping.WorkflowTemplateID
+		items[i].SubFlow = subFlows[idx].Key
+	}
+	return subFlows, nil
+}
 
-// CreateAndStartConsignment creates an export consignment and starts its workflow directly,
-// in one step — replacing the two-stage trader-creates-shell → CHA-claims-with-HS-code handoff
-// for flows whose entire CHA/HS-code selection now happens inside the workflow itself.
-func (s *Service) CreateAndStartConsignment(ctx context.Context, traderID string) (*DetailDTO, error) {
+// itemVars is the per-item context handed to the parent workflow as the
+// "items" variable.
+func itemVars(items []Item) []any {
+	vars := make([]any, len(items))
+	for i, item := range items {
+		vars[i] = map[string]any{
+			"hsCodeId":           item.HSCodeID,
+			"workflowTemplateId": item.WorkflowTemplateID,
+			"subFlow":            item.SubFlow,
+		}
+	}
+	return vars
+}
+
+// CreateAndStartConsignment creates a consignment and starts its workflow directly, in one
+// step — replacing the two-stage trader-creates-shell → CHA-claims-with-HS-code handoff for
+// flows whose CHA/HS-code selection happens inside the workflow itself (e.g. trade-export-v1,
+// whose tasks collect trade.cha_id and trade.hs_codes). req.Context is passed to the workflow
+// as its initial global variables alongside the trader company data; it may not set the
+// keys the workflow's nodes write (ErrContextKeyWorkflowOwned). Returns
+// ErrNoWorkflowTemplate, ErrTemplateNotInFlow or ErrTemplateNotForHSCode when no template
+// can be chosen.
+func (s *Service) CreateAndStartConsignment(ctx context.Context, traderID string, req StartConsignmentDTO) (*DetailDTO, error) {
 	traderUser, err := s.userService.GetUser(traderID)
 	if err != nil {
 		return nil, fmt.Errorf("trader user lookup failed: %w", err)
@@ -381,20 +476,40 @@ func (s *Service) CreateAndStartConsignment(ctx context.Context, traderID string
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal trader company: %w", err)
 	}
-	initialVars := map[string]any{"traderCompany": traderCompanyVars}
+	initialVars := make(map[string]any, len(req.Context)+2)
+	for k, v := range req.Context {
+		initialVars[k] = v
+	}
+	initialVars["traderCompany"] = traderCompanyVars
 
-	wt, err := s.templateProvider.GetWorkflowTemplateByIDV2(ctx, directStartExportWorkflowTemplateID)
+	templateID, err := s.resolveStartTemplate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := s.templateProvider.GetWorkflowTemplateByIDV2(ctx, templateID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workflow template: %w", err)
 	}
+	if err := checkStartContext(req.Context, wt.WorkflowDefinition); err != nil {
+		return nil, err
+	}
+
+	items := []Item{}
+	if req.HSCodeID != "" {
+		items = append(items, Item{HSCodeID: req.HSCodeID, WorkflowTemplateID: templateID})
+		initialVars["items"] = itemVars(items)
+	}
 
 	consignment := &Consignment{
-		ID:              uuid.NewString(),
-		Flow:            FlowExport,
-		TraderID:        traderID,
-		TraderCompanyID: traderCompany.ID,
-		State:           InProgress,
-		Items:           []Item{},
+		ID:                 uuid.NewString(),
+		Flow:               req.Flow,
+		TraderID:           traderID,
+		TraderCompanyID:    traderCompany.ID,
+		TraderReference:    req.TraderReference,
+		State:              InProgress,
+		Items:              items,
+		GlobalContext:      initialVars,
+		WorkflowDefinition: &wt.WorkflowDefinition,
 	}
 
 	tx := s.db.WithContext(ctx).Begin()
@@ -403,6 +518,9 @@ func (s *Service) CreateAndStartConsignment(ctx context.Context, traderID string
 	if err := tx.Create(consignment).Error; err != nil {
 		return nil, fmt.Errorf("failed to create consignment: %w", err)
 	}
+	if err := timeline.Append(ctx, tx, stateChanged(consignment, "", traderID, nil)); err != nil {
+		return nil, err
+	}
 
 	if err := s.startWorkflow(ctx, consignment.ID, wt.WorkflowDefinition, initialVars); err != nil {
 		return nil, fmt.Errorf("failed to register workflow: %w", err)
@@ -416,21 +534,95 @@ func (s *Service) CreateAndStartConsignment(ctx context.Context, traderID string
 		return nil, fmt.Errorf("failed to reload consignment: %w", err)
 	}
 
-	responseDTO, err := s.buildConsignmentDetailDTO(ctx, consignment, make(map[string]hscode.HSCode))
+	hsCodeMap, err := s.getHSCodeMap(ctx, consignment.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	responseDTO, err := s.buildConsignmentDetailDTO(ctx, consignment, hsCodeMap)
 	if err != nil {
 		return nil, err
 	}
 	return responseDTO, nil
 }
 
-// GetConsignmentByID retrieves a consignment by its ID from the database.
-func (s *Service) GetConsignmentByID(ctx context.Context, consignmentID string) (*DetailDTO, error) {
+// resolveStartTemplate picks the workflow template for a direct start: the template
+// WorkflowTemplateMap assigns to req.HSCodeID in req.Flow, or req.TemplateID once it is
+// confirmed to be mapped to req.Flow and, when both are given, to req.HSCodeID.
+func (s *Service) resolveStartTemplate(ctx context.Context, req StartConsignmentDTO) (string, error) {
+	query := s.db.WithContext(ctx).Model(&WorkflowTemplateMap{}).Where("consignment_flow = ?", req.Flow)
+	if req.TemplateID != "" && req.HSCodeID != "" {
+		var count int64
+		if err := query.Where("hs_code_id = ? AND workflow_template_id = ?", req.HSCodeID, req.TemplateID).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check workflow template: %w", err)
+		}
+		if count == 0 {
+			return "", fmt.Errorf("%w: %s is not mapped to HS code %s in flow %s", ErrTemplateNotForHSCode, req.TemplateID, req.HSCodeID, req.Flow)
+		}
+		return req.TemplateID, nil
+	}
+	if req.TemplateID != "" {
+		var count int64
+		if err := query.Where("workflow_template_id = ?", req.TemplateID).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check workflow template: %w", err)
+		}
+		if count == 0 {
+			return "", fmt.Errorf("%w: %s is not mapped to flow %s", ErrTemplateNotInFlow, req.TemplateID, req.Flow)
+		}
+		return req.TemplateID, nil
+	}
+
+	var mapping WorkflowTemplateMap
+	if err := query.Where("hs_code_id = ?", req.HSCodeID).First(&mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("%w for HS code %s and flow %s", ErrNoWorkflowTemplate, req.HSCodeID, req.Flow)
+		}
+		return "", fmt.Errorf("failed to get workflow template: %w", err)
+	}
+	return mapping.WorkflowTemplateID, nil
+}
+
+// checkStartContext returns ErrContextKeyWorkflowOwned for a key of vars that a node of def
+// writes, whole or as part of a dotted path: its value is the workflow's to set.
+func checkStartContext(vars map[string]any, def workflowmanager.WorkflowDefinition) error {
+	owned := func(key string) bool {
+		for given := range vars {
+			if key == given || strings.HasPrefix(key, given+".") || strings.HasPrefix(given, key+".") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, n := range def.Nodes {
+		for _, key := range n.OutputMapping {
+			if owned(key) {
+				return fmt.Errorf("%w: %s (node %s)", ErrContextKeyWorkflowOwned, key, n.ID)
+			}
+		}
+		if n.SplitTask != nil && n.SplitTask.ResultsVariable != "" && owned(n.SplitTask.ResultsVariable) {
+			return fmt.Errorf("%w: %s (node %s)", ErrContextKeyWorkflowOwned, n.SplitTask.ResultsVariable, n.ID)
+		}
+	}
+	return nil
+}
+
+// GetConsignmentByID retrieves a consignment by its ID from the database on behalf of
+// principal. Returns ErrConsignmentNotFound both when the consignment does not exist and
+// when the access policy denies principal, so callers cannot probe for IDs.
+func (s *Service) GetConsignmentByID(ctx context.Context, principal authz.Principal, consignmentID string) (*DetailDTO, error) {
 	var consignment Consignment
 	result := s.db.WithContext(ctx).First(&consignment, "id = ?", consignmentID)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
 		return nil, fmt.Errorf("failed to retrieve consignment with ID %s: %w", consignmentID, result.Error)
 	}
 
+	if err := s.authorizeAccess(ctx, principal, &consignment); err != nil {
+		return nil, err
+	}
+
 	// Confirm the workflow is reachable if one exists; node details now come
 	// from task records rather than this status snapshot.
 	if consignment.State != Initialized {
@@ -452,53 +644,153 @@ func (s *Service) GetConsignmentByID(ctx context.Context, consignmentID string)
 	return responseDTO, nil
 }
 
+// OwnerOUHandles returns the IdP OU handles of the companies that own a consignment: the
+// trader's company and, once selected at Stage 1, the CHA company. It backs task-level
+// authorization, where a caller is admitted only if its OU handle is one of these.
+// Returns ErrConsignmentNotFound if the consignment does not exist.
+func (s *Service) OwnerOUHandles(ctx context.Context, consignmentID string) ([]string, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).Select("id", "trader_company_id", "cha_company_id").
+		First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+
+	return s.ownerOUHandles(ctx, &consignment)
+}
+
+// AssigneeEmails returns the e-mail address of the CHA individually assigned to a
+// consignment, or none before one claims it. Like OwnerOUHandles it backs task-level
+// authorization. Returns ErrConsignmentNotFound if the consignment does not exist.
+func (s *Service) AssigneeEmails(ctx context.Context, consignmentID string) ([]string, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).Select("id", "cha_id").
+		First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+	if consignment.CHAID == nil || *consignment.CHAID == "" {
+		return nil, nil
+	}
+	chaRecord, err := s.chaService.GetByID(ctx, *consignment.CHAID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve assigned CHA of consignment %s: %w", consignmentID, err)
+	}
+	return []string{chaRecord.Email}, nil
+}
+
+// OwnerCompanyID returns the ID of the company with ouHandle, whose consignments, as
+// trader or as CHA, make up its task inbox. An OU handle without a company owns none
+// and gets an empty ID.
+func (s *Service) OwnerCompanyID(ctx context.Context, ouHandle string) (string, error) {
+	ownerCompany, err := s.companyService.GetCompanyByOUHandle(ctx, ouHandle)
+	if err != nil {
+		if errors.Is(err, company.ErrCompanyNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("company lookup failed: %w", err)
+	}
+	return ownerCompany.ID, nil
+}
+
+// PayerName returns the name of the trader's company, which pays a
+// consignment's fees and is named on its payment receipts. Returns
+// ErrConsignmentNotFound if the consignment does not exist.
+func (s *Service) PayerName(ctx context.Context, consignmentID string) (string, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).Select("id", "trader_company_id").
+		First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrConsignmentNotFound
+		}
+		return "", fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+
+	traderCompany, err := s.companyService.GetCompanyByID(ctx, consignment.TraderCompanyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve trader company %s: %w", consignment.TraderCompanyID, err)
+	}
+	return traderCompany.Name, nil
+}
+
 // ListConsignments returns consignments scoped to a company. For role=trader the caller passes
 // TraderCompanyID; for role=cha the caller passes CHACompanyID. Exactly one of the two must be set.
 // Scoping is company-based so a user sees all consignments belonging to their company, not only the
 // ones they personally created or were individually assigned.
 func (s *Service) ListConsignments(ctx context.Context, filter Filter) (*ListResult, error) {
-	var baseQuery *gorm.DB
+	baseQuery, err := s.companyQuery(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.listConsignmentsWithBaseQuery(ctx, baseQuery, filter)
+}
+
+// companyQuery selects the consignments of the company filter is scoped to: those of
+// CHACompanyID, else those of TraderCompanyID.
+func (s *Service) companyQuery(ctx context.Context, filter Filter) (*gorm.DB, error) {
 	if filter.CHACompanyID != nil {
-		baseQuery = s.db.WithContext(ctx).Model(&Consignment{}).Where("cha_company_id = ?", *filter.CHACompanyID)
+		return s.db.WithContext(ctx).Model(&Consignment{}).Where("cha_company_id = ?", *filter.CHACompanyID), nil
 	} else if filter.TraderCompanyID != nil {
-		baseQuery = s.db.WithContext(ctx).Model(&Consignment{}).Where("trader_company_id = ?", *filter.TraderCompanyID)
-	} else {
-		return nil, fmt.Errorf("either TraderCompanyID or CHACompanyID must be set in filter")
+		return s.db.WithContext(ctx).Model(&Consignment{}).Where("trader_company_id = ?", *filter.TraderCompanyID), nil
 	}
-	return s.listConsignmentsWithBaseQuery(ctx, baseQuery, filter)
+	return nil, fmt.Errorf("either TraderCompanyID or CHACompanyID must be set in filter")
+}
+
+// ListAllConsignments returns consignments across all companies for support staff, who
+// filter with Alert to find the ones stuck FAILED or STALLED. Company filters are ignored.
+func (s *Service) ListAllConsignments(ctx context.Context, filter Filter) (*ListResult, error) {
+	return s.listConsignmentsWithBaseQuery(ctx, s.db.WithContext(ctx).Model(&Consignment{}), filter)
 }
 
 // listConsignmentsWithBaseQuery runs the shared list logic (filters, count, pagination, DTOs).
+// A page fetched by Cursor is found by keyset rather than offset and is not counted.
 func (s *Service) listConsignmentsWithBaseQuery(ctx context.Context, baseQuery *gorm.DB, filter Filter) (*ListResult, error) {
 	// Apply pagination with defaults and limits
 	finalOffset, finalLimit := pagination.ResolvePaginationParams(filter.Offset, filter.Limit)
+	if filter.Sort == "" {
+		filter.Sort = SortCreatedDesc
+	}
+	var cursor *listCursor
+	if filter.Cursor != "" {
+		var err error
+		if cursor, err = decodeListCursor(filter.Sort, filter.Cursor); err != nil {
+			return nil, err
+		}
+		finalOffset = 0
+	}
 
 	// Each call returns a fresh GORM chain so LIMIT/OFFSET/ORDER on the list
 	// query cannot leak into the count query — consistent with hscode and
 	// profile/company services.
 	filteredQuery := func() *gorm.DB {
-		q := baseQuery
-		if filter.State != nil {
-			q = q.Where("state = ?", *filter.State)
-		}
-		if filter.Flow != nil {
-			q = q.Where("flow = ?", *filter.Flow)
-		}
-		return q
+		return applyListFilters(baseQuery.Session(&gorm.Session{}), filter)
 	}
 
+	// Progress comes from the task_progress projection in the same query; task records
+	// are not loaded for listings.
+	listQuery := filteredQuery()
+	if cursor != nil {
+		listQuery = afterCursor(listQuery, filter.Sort, cursor)
+	} else {
+		listQuery = listQuery.Offset(finalOffset)
+	}
 	var consignments []Consignment
-	// NOTE: We do NOT preload WorkflowNodes here to improve performance
-	if err := filteredQuery().
-		Offset(finalOffset).
+	if err := listQuery.
+		Joins("Progress").
 		Limit(finalLimit).
-		Order("created_at DESC").
+		Order(filter.Sort.orderBy()).
 		Find(&consignments).Error; err != nil {
 		return nil, fmt.Errorf("failed to retrieve consignments: %w", err)
 	}
 
 	var totalCount int64
-	if len(consignments) < finalLimit && finalOffset == 0 {
+	if cursor != nil {
+		totalCount = -1
+	} else if len(consignments) < finalLimit && finalOffset == 0 {
 		totalCount = int64(len(consignments))
 	} else {
 		if err := filteredQuery().Count(&totalCount).Error; err != nil {
@@ -511,53 +803,12 @@ func (s *Service) listConsignmentsWithBaseQuery(ctx context.Context, baseQuery *
 		return &result, nil
 	}
 
-	// Collect Consignment IDs to fetch workflow node counts
-	consignmentIDs := make([]string, len(consignments))
-	for i, c := range consignments {
-		consignmentIDs[i] = c.ID
-	}
-
-	// Fetch workflow node counts in batch (via workflow_id which equals consignment ID)
-	type NodeCounts struct {
-		WorkflowID string
-		Total      int
-		Completed  int
-	}
-
-	var nodeCounts []NodeCounts
-	err := s.db.WithContext(ctx).Model(&model.WorkflowNode{}).
-		Select("workflow_id, count(*) as total, count(case when state = ? then 1 end) as completed", model.WorkflowNodeStateCompleted).
-		Where("workflow_id IN ?", consignmentIDs).
-		Group("workflow_id").
-		Scan(&nodeCounts).Error
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch workflow node counts: %w", err)
-	}
-
-	// Map counts to consignment IDs (workflow_id == consignment_id) for easy lookup
-	countsMap := make(map[string]NodeCounts)
-	for _, nc := range nodeCounts {
-		countsMap[nc.WorkflowID] = nc
-	}
-
-	// Check which consignments have end nodes (via the workflows table)
-	type WorkflowEndNode struct {
-		ID        string
-		EndNodeID *string
-	}
-	var workflowEndNodes []WorkflowEndNode
-	err = s.db.WithContext(ctx).Model(&model.Workflow{}).
-		Select("id, end_node_id").
-		Where("id IN ?", consignmentIDs).
-		Scan(&workflowEndNodes).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch workflow end nodes: %w", err)
-	}
-	endNodeMap := make(map[string]bool)
-	for _, w := range workflowEndNodes {
-		if w.EndNodeID != nil {
-			endNodeMap[w.ID] = true
+	// A full page may have a successor; the cursor resumes after its last consignment.
+	nextCursor := ""
+	if len(consignments) == finalLimit {
+		var err error
+		if nextCursor, err = encodeListCursor(filter.Sort, &consignments[len(consignments)-1]); err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
 		}
 	}
 
@@ -575,14 +826,9 @@ func (s *Service) listConsignmentsWithBaseQuery(ctx context.Context, baseQuery *
 	var consignmentDTOs []SummaryDTO
 	for i := range consignments {
 		c := consignments[i]
-		counts := countsMap[c.ID]
-
-		// If the workflow has an EndNode, subtract it from the total count
-		// (since it's an internal implementation detail not shown to users)
-		if endNodeMap[c.ID] {
-			if counts.Total > 0 {
-				counts.Total -= 1
-			}
+		var progress taskstore.TaskProgress
+		if c.Progress != nil {
+			progress = *c.Progress
 		}
 
 		// Build Item Response DTOs
@@ -599,6 +845,10 @@ func (s *Service) listConsignmentsWithBaseQuery(ctx context.Context, baseQuery *
 		if c.CHACompanyID != nil {
 			chaCompanyID = *c.CHACompanyID
 		}
+		finishedAt := ""
+		if c.FinishedAt != nil {
+			finishedAt = c.FinishedAt.Format(time.RFC3339)
+		}
 
 		consignmentDTOs = append(consignmentDTOs, SummaryDTO{
 			ID:                         c.ID,
@@ -606,17 +856,23 @@ func (s *Service) listConsignmentsWithBaseQuery(ctx context.Context, baseQuery *
 			State:                      c.State,
 			TraderID:                   c.TraderID,
 			TraderCompanyID:            c.TraderCompanyID,
+			TraderReference:            c.TraderReference,
 			ChaCompanyID:               chaCompanyID,
 			ChaID:                      chaID,
 			Items:                      itemResponseDTOs,
 			CreatedAt:                  c.CreatedAt.Format(time.RFC3339),
 			UpdatedAt:                  c.UpdatedAt.Format(time.RFC3339),
-			WorkflowNodeCount:          counts.Total,
-			CompletedWorkflowNodeCount: counts.Completed,
+			FinishedAt:                 finishedAt,
+			WorkflowNodeCount:          progress.Total,
+			CompletedWorkflowNodeCount: progress.Completed,
+			Progress:                   progressDTO(progress),
+			Alert:                      c.State.NeedsAttention(),
+			FailureReason:              c.FailureReason,
 		})
 	}
 
 	result := pagination.NewPageResult(consignmentDTOs, totalCount, finalOffset, finalLimit)
+	result.NextCursor = nextCursor
 	return &result, nil
 }
 
@@ -626,11 +882,19 @@ func (s *Service) markConsignmentAsFinished(tx *gorm.DB, consignmentID string) e
 	if err := tx.First(&consignment, "id = ?", consignmentID).Error; err != nil {
 		return fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
 	}
+	if consignment.State == Cancelling || consignment.State == Cancelled {
+		// The workflow finished while the cancellation was in flight; the trader's
+		// withdrawal stands.
+		return nil
+	}
+	previousState := consignment.State
+	now := time.Now()
 	consignment.State = Finished
+	consignment.FinishedAt = &now
 	if err := tx.Save(&consignment).Error; err != nil {
 		return fmt.Errorf("failed to update consignment %s state to FINISHED: %w", consignmentID, err)
 	}
-	return nil
+	return timeline.Append(tx.Statement.Context, tx, stateChanged(&consignment, previousState, "", nil))
 }
 
 func (s *Service) getHSCodeMap(ctx context.Context, items []Item) (map[string]hscode.HSCode, error) {
@@ -671,10 +935,11 @@ func (s *Service) buildConsignmentDetailDTO(
 		return nil, err
 	}
 
-	nodeResponseDTOs, err := s.buildNodeDTOsFromTaskRecords(ctx, consignment.ID)
-	if err != nil {
-		return nil, err
+	if s.taskStore == nil {
+		return nil, fmt.Errorf("task store not initialized")
 	}
+	tasks := s.taskStore.GetAllTasks(ctx, consignment.ID)
+	nodeResponseDTOs := buildNodeDTOsFromTaskRecords(tasks, consignment.Items)
 
 	chaID := ""
 	if consignment.CHAID != nil {
@@ -684,6 +949,18 @@ func (s *Service) buildConsignmentDetailDTO(
 	if consignment.CHACompanyID != nil {
 		chaCompanyID = *consignment.CHACompanyID
 	}
+	cancelledAt := ""
+	if consignment.CancelledAt != nil {
+		cancelledAt = consignment.CancelledAt.Format(time.RFC3339)
+	}
+	failedAt := ""
+	if consignment.FailedAt != nil {
+		failedAt = consignment.FailedAt.Format(time.RFC3339)
+	}
+	finishedAt := ""
+	if consignment.FinishedAt != nil {
+		finishedAt = consignment.FinishedAt.Format(time.RFC3339)
+	}
 
 	return &DetailDTO{
 		ID:              consignment.ID,
@@ -691,29 +968,32 @@ func (s *Service) buildConsignmentDetailDTO(
 		State:           consignment.State,
 		TraderID:        consignment.TraderID,
 		TraderCompanyID: consignment.TraderCompanyID,
+		TraderReference: consignment.TraderReference,
 		ChaCompanyID:    chaCompanyID,
 		ChaID:           chaID,
 		Items:           itemResponseDTOs,
 		CreatedAt:       consignment.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:       consignment.UpdatedAt.Format(time.RFC3339),
 		WorkflowNodes:   nodeResponseDTOs,
+		CancelReason:    consignment.CancelReason,
+		CancelledAt:     cancelledAt,
+		FailureReason:   consignment.FailureReason,
+		FailedAt:        failedAt,
+		FinishedAt:      finishedAt,
+		Progress:        progressDTO(taskstore.ProgressOf(consignment.ID, tasks)),
+		GlobalContext:   consignment.GlobalContext,
 	}, nil
 }
 
-// buildNodeDTOsFromTaskRecords queries tasks via the TaskStore by root_workflow_id and converts each
-// non-SYSTEM record into a WorkflowNodeResponseDTO for the consignment detail response.
-// This replaces the direct database access: every task record—including those from child
-// workflows spawned by SPLIT_TASK—shares the same root_workflow_id (the consignment ID),
-// so a single exact-match query captures the complete task picture.
-func (s *Service) buildNodeDTOsFromTaskRecords(ctx context.Context, consignmentID string) ([]model.WorkflowNodeResponseDTO, error) {
-	if s.taskStore == nil {
-		return nil, fmt.Errorf("task store not initialized")
-	}
-	tasks := s.taskStore.GetAllTasks(ctx, consignmentID)
-
+// buildNodeDTOsFromTaskRecords converts each task record counted towards progress (every
+// record but SYSTEM tasks and tasks superseded by an amendment) into a WorkflowNodeResponseDTO for the consignment detail response.
+// Every task record—including those from child workflows spawned by SPLIT_TASK—shares the
+// same root_workflow_id (the consignment ID), so the records of a single exact-match query
+// give the complete task picture. Each node lists the HS codes of the items it works for.
+func buildNodeDTOsFromTaskRecords(tasks []tfstore.TaskRecord, items []Item) []model.WorkflowNodeResponseDTO {
 	dtos := make([]model.WorkflowNodeResponseDTO, 0, len(tasks))
 	for _, t := range tasks {
-		if t.TaskType == "SYSTEM" {
+		if !taskstore.Counts(t.TaskType, t.State) {
 			continue
 		}
 		var nodeState model.WorkflowNodeState
@@ -733,10 +1013,11 @@ func (s *Service) buildNodeDTOsFromTaskRecords(ctx context.Context, consignmentI
 				Name: taskDisplayName(t.ActiveTaskTemplateID, t.RenderConfig),
 				Type: t.TaskType,
 			},
-			State: nodeState,
+			State:     nodeState,
+			HSCodeIDs: taskHSCodeIDs(t, items),
 		})
 	}
-	return dtos, nil
+	return dtos
 }
 
 // taskDisplayName extracts the human-readable title from a task's render config workspace
@@ -790,6 +1071,8 @@ func (s *Service) buildConsignmentItemResponseDTOs(items []Item, hsCodeMap map[s
 				Description: hsCode.Description,
 				Category:    hsCode.Category,
 			},
+			WorkflowTemplateID: item.WorkflowTemplateID,
+			SubFlow:            item.SubFlow,
 		})
 	}
 	return itemResponseDTOs, nil
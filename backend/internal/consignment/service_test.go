@@ -19,6 +19,7 @@ import (
 	"github.com/OpenNSW/nsw/backend/internal/profile/cha"
 	"github.com/OpenNSW/nsw/backend/internal/profile/company"
 	"github.com/OpenNSW/nsw/backend/internal/profile/user"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
 )
 
@@ -144,12 +145,13 @@ func TestConsignmentService_CompletionHandler(t *testing.T) {
 	svc := NewService(db, nil, nil, nil, nil, nil, nil)
 	consignmentID := uuid.NewString()
 
+	sqlMock.ExpectBegin()
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
 		WithArgs(consignmentID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(consignmentID, "IN_PROGRESS"))
-	sqlMock.ExpectBegin()
 	sqlMock.ExpectExec(`UPDATE "consignments"`).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "IN_PROGRESS", "FINISHED")
 	sqlMock.ExpectCommit()
 
 	err := svc.CompletionHandler(consignmentID, nil)
@@ -161,7 +163,7 @@ func TestConsignmentService_CompletionHandler(t *testing.T) {
 
 func TestConsignmentService_InitializeConsignmentByID_NoHSCode(t *testing.T) {
 	svc := NewService(nil, nil, nil, nil, nil, nil, nil)
-	_, err := svc.InitializeConsignmentByID(context.Background(), "id", []string{}, "")
+	_, err := svc.InitializeConsignmentByID(context.Background(), nil, "id", []string{}, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "at least one HS code ID is required")
 }
@@ -174,38 +176,123 @@ func TestConsignmentService_InitializeConsignmentByID_NotFound(t *testing.T) {
 		WithArgs(id, 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{"hs1"}, "")
+	_, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{"hs1"}, "")
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	assert.ErrorIs(t, err, ErrConsignmentNotFound)
 }
 
 func TestConsignmentService_InitializeConsignmentByID_WrongState(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
-	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
 	id := uuid.NewString()
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
 		WithArgs(id, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(id, "IN_PROGRESS"))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id", "cha_company_id"}).AddRow(id, "IN_PROGRESS", "company-trader", "company-cha"))
+	expectOwnerCompanies(mockCompany, "company-trader", "company-cha")
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{"hs1"}, "")
+	_, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{"hs1"}, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "must be in INITIALIZED")
 }
 
-func TestConsignmentService_InitializeConsignmentByID_MultipleHSCodeError(t *testing.T) {
+func TestConsignmentService_InitializeConsignmentByID_MultipleHSCodes(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
-	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+	mockTP := new(MockTemplateProvider)
+	mockWM := new(MockWMV2)
+	mockCHA := new(MockCHAService)
+	mockCompany := new(MockCompanyService)
+	mockTaskStore := new(MockTaskStore)
+	svc := NewService(db, mockTP, mockCHA, mockCompany, nil, hscode.NewService(db), mockTaskStore)
+	require.NoError(t, svc.RegisterWorkflowManager(mockWM))
+
 	id := uuid.NewString()
+	chaID := "cha1"
+	chaCompanyID := "company-cha"
+	traderCompanyID := "company-trader"
+
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
 		WithArgs(id, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(id, "INITIALIZED"))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id", "trader_company_id"}).AddRow(id, "INITIALIZED", "EXPORT", chaCompanyID, traderCompanyID))
 
+	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, Data: []byte(`{}`)}, nil)
+
+	// hs-tea and hs-spice share the tea template, so they share its sub-flow.
 	sqlMock.ExpectBegin()
+	for _, m := range [][2]string{{"hs-tea", "wt-tea"}, {"hs-spice", "wt-tea"}, {"hs-fruit", "wt-fruit"}} {
+		sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map"`).
+			WithArgs(m[0], "EXPORT", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
+				AddRow(uuid.NewString(), m[0], "EXPORT", m[1]))
+	}
+	linear := func(id, task string) workflowManagerV2.WorkflowDefinition {
+		return workflowManagerV2.WorkflowDefinition{
+			ID: id,
+			Nodes: []workflowManagerV2.Node{
+				{ID: "start", Type: workflowManagerV2.NodeTypeStart},
+				{ID: task, Type: workflowManagerV2.NodeTypeTask, TaskTemplateID: task},
+				{ID: "end", Type: workflowManagerV2.NodeTypeEnd},
+			},
+			Edges: []workflowManagerV2.Edge{
+				{ID: "e1", SourceID: "start", TargetID: task},
+				{ID: "e2", SourceID: task, TargetID: "end"},
+			},
+		}
+	}
+	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, "wt-tea").Return(&model.WorkflowTemplateV2{WorkflowDefinition: linear("wt-tea", "tea_board")}, nil).Once()
+	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, "wt-fruit").Return(&model.WorkflowTemplateV2{WorkflowDefinition: linear("wt-fruit", "npqs")}, nil).Once()
 	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "INITIALIZED", "IN_PROGRESS")
+
+	var started workflowManagerV2.WorkflowDefinition
+	var startVars map[string]any
+	mockWM.On("StartWorkflow", mock.Anything, id, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			started = args.Get(2).(workflowManagerV2.WorkflowDefinition)
+			startVars = args.Get(3).(map[string]any)
+		}).Return(nil)
+	sqlMock.ExpectCommit()
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{"hs1", "hs2"}, "")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "supports only one HS code")
+	items := `[{"hsCodeId":"hs-tea","workflowTemplateId":"wt-tea","subFlow":"flow1"},` +
+		`{"hsCodeId":"hs-spice","workflowTemplateId":"wt-tea","subFlow":"flow1"},` +
+		`{"hsCodeId":"hs-fruit","workflowTemplateId":"wt-fruit","subFlow":"flow2"}]`
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WithArgs(id, id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id", "trader_company_id", "cha_id", "items", "created_at", "updated_at"}).
+			AddRow(id, "IN_PROGRESS", "EXPORT", chaCompanyID, traderCompanyID, chaID, []byte(items), time.Now(), time.Now()))
+	mockWM.On("GetStatus", mock.Anything, id).Return(&workflowManagerV2.WorkflowInstance{ID: id}, nil)
+	sqlMock.ExpectQuery(`SELECT \* FROM "hs_codes" WHERE id IN`).
+		WithArgs("hs-tea", "hs-spice", "hs-fruit").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code"}).
+			AddRow("hs-tea", "0902.10").AddRow("hs-spice", "0906.11").AddRow("hs-fruit", "0804.30"))
+	mockTaskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord{
+		{TaskID: "t1", TaskType: "FORM", ParentNodeID: "flow1__tea_board", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{TaskID: "t2", TaskType: "FORM", ParentWorkflowID: id + "--flow2__npqs--b1", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	})
+
+	result, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{"hs-tea", "hs-spice", "hs-fruit", "hs-tea"}, chaID)
+	require.NoError(t, err)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+	mockTP.AssertExpectations(t)
+
+	// One parent workflow: the two templates side by side between a split and a join.
+	assert.ElementsMatch(t, []string{"merged_start", "merged_split", "merged_join", "merged_end", "flow1__tea_board", "flow2__npqs"}, nodeIDs(started))
+	assert.Contains(t, started.Edges, workflowManagerV2.Edge{ID: "flow1__e1", SourceID: "merged_split", TargetID: "flow1__tea_board"})
+	assert.Contains(t, started.Edges, workflowManagerV2.Edge{ID: "flow2__e2", SourceID: "flow2__npqs", TargetID: "merged_join"})
+	assert.Equal(t, []any{
+		map[string]any{"hsCodeId": "hs-tea", "workflowTemplateId": "wt-tea", "subFlow": "flow1"},
+		map[string]any{"hsCodeId": "hs-spice", "workflowTemplateId": "wt-tea", "subFlow": "flow1"},
+		map[string]any{"hsCodeId": "hs-fruit", "workflowTemplateId": "wt-fruit", "subFlow": "flow2"},
+	}, startVars["items"])
+
+	require.Len(t, result.Items, 3)
+	assert.Equal(t, "flow2", result.Items[2].SubFlow)
+	require.Len(t, result.WorkflowNodes, 2)
+	assert.Equal(t, []string{"hs-tea", "hs-spice"}, result.WorkflowNodes[0].HSCodeIDs)
+	assert.Equal(t, []string{"hs-fruit"}, result.WorkflowNodes[1].HSCodeIDs)
 }
 
 func TestConsignmentService_InitializeConsignmentByID_NoTemplate(t *testing.T) {
@@ -224,17 +311,17 @@ func TestConsignmentService_InitializeConsignmentByID_NoTemplate(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id", "trader_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", chaCompanyID, traderCompanyID))
 
 	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
 	mockCompany.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, Data: []byte(`{}`)}, nil)
 
 	sqlMock.ExpectBegin()
-	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map"`).
 		WithArgs(hsID, "IMPORT", 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 	sqlMock.ExpectRollback()
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{hsID}, chaID)
+	_, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{hsID}, chaID)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no workflow template found")
 }
@@ -262,10 +349,10 @@ func TestConsignmentService_InitializeConsignmentByID_Success(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_id", "cha_company_id", "trader_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", traderID, chaCompanyID, traderCompanyID))
 
 	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
 	mockCompany.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, OUHandle: "trader-ou", Data: []byte(`{"br_no":"BR-1"}`)}, nil)
 
 	sqlMock.ExpectBegin()
-	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	wtID := uuid.NewString()
 	wfDef := workflowManagerV2.WorkflowDefinition{ID: "template1"}
@@ -273,6 +360,8 @@ func TestConsignmentService_InitializeConsignmentByID_Success(t *testing.T) {
 		WithArgs(hsID, "IMPORT", 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
 			AddRow(uuid.NewString(), hsID, "IMPORT", wtID))
+	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "INITIALIZED", "IN_PROGRESS")
 	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, wtID).Return(&model.WorkflowTemplateV2{
 		WorkflowDefinition: wfDef,
 	}, nil)
@@ -308,15 +397,17 @@ func TestConsignmentService_InitializeConsignmentByID_Success(t *testing.T) {
 	mockTaskStore.On("GetAllTasks", mock.Anything, id).Return([]tfstore.TaskRecord{
 		{TaskID: "node1", TaskType: "FORM", State: "COMPLETED", ActiveTaskTemplateID: "Task 1", CreatedAt: time.Now(), UpdatedAt: time.Now()},
 		{TaskID: "node2", TaskType: "FORM", State: "IN_PROGRESS", ActiveTaskTemplateID: "Task 2", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{TaskID: "node3", TaskType: "SYSTEM", State: "COMPLETED", CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	})
 
-	result, err := svc.InitializeConsignmentByID(context.Background(), id, []string{hsID}, chaID)
+	result, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{hsID}, chaID)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, id, result.ID)
 	assert.Len(t, result.WorkflowNodes, 2)
 	assert.Equal(t, "Task 1", result.WorkflowNodes[0].WorkflowNodeTemplate.Name)
 	assert.Equal(t, model.WorkflowNodeStateCompleted, result.WorkflowNodes[0].State)
+	assert.Equal(t, ProgressDTO{Total: 2, Completed: 1, InProgress: 1}, result.Progress)
 	mockCHA.AssertExpectations(t)
 	mockCompany.AssertExpectations(t)
 	mockTaskStore.AssertExpectations(t)
@@ -334,14 +425,32 @@ func TestConsignmentService_OnWorkflowStatusChanged(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
 	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "IN_PROGRESS", "FINISHED")
+	sqlMock.ExpectCommit()
 
 	err := svc.OnWorkflowStatusChanged(context.Background(), db, id, model.WorkflowStatusInProgress, model.WorkflowStatusCompleted, nil)
 	assert.NoError(t, err)
 
-	// Other status
+	// Failed
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1 .*FOR UPDATE`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(id, "IN_PROGRESS"))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(`UPDATE "consignments" SET .*"state"=\$\d+.*"failure_reason"=\$\d+,"failed_at"=\$\d+`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "IN_PROGRESS", "FAILED")
+	sqlMock.ExpectCommit()
+
 	err = svc.OnWorkflowStatusChanged(context.Background(), db, id, model.WorkflowStatusInProgress, model.WorkflowStatusFailed, nil)
 	assert.NoError(t, err)
 
+	// Other status
+	err = svc.OnWorkflowStatusChanged(context.Background(), db, id, model.WorkflowStatusCompleted, model.WorkflowStatusInProgress, nil)
+	assert.NoError(t, err)
+
 	assert.NoError(t, sqlMock.ExpectationsWereMet())
 }
 func TestConsignmentService_CreateConsignmentShell_Success(t *testing.T) {
@@ -363,6 +472,7 @@ func TestConsignmentService_CreateConsignmentShell_Success(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectExec(`INSERT INTO "consignments"`).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "", "INITIALIZED")
 	sqlMock.ExpectCommit()
 
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
@@ -372,7 +482,7 @@ func TestConsignmentService_CreateConsignmentShell_Success(t *testing.T) {
 
 	mockTaskStore.On("GetAllTasks", mock.Anything, consignmentID).Return(([]tfstore.TaskRecord)(nil))
 
-	result, err := svc.CreateConsignmentShell(ctx, FlowImport, chaCompanyID, traderID)
+	result, err := svc.CreateConsignmentShell(ctx, FlowImport, chaCompanyID, traderID, "")
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, consignmentID, result.ID)
@@ -389,7 +499,7 @@ func TestConsignmentService_CreateConsignmentShell_CompanyNotCHA(t *testing.T) {
 
 	mockCompany.On("GetCompanyByID", mock.Anything, "company-1").Return(&company.Record{ID: "company-1", HasCHA: false}, nil)
 
-	_, err := svc.CreateConsignmentShell(context.Background(), FlowImport, "company-1", "trader1")
+	_, err := svc.CreateConsignmentShell(context.Background(), FlowImport, "company-1", "trader1", "")
 	assert.ErrorIs(t, err, ErrCompanyNotCHA)
 }
 
@@ -397,7 +507,8 @@ func TestConsignmentService_GetConsignmentByID(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
 	mockWM := new(MockWMV2)
 	mockTaskStore := new(MockTaskStore)
-	svc := NewService(db, nil, nil, nil, nil, hscode.NewService(db), mockTaskStore)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, hscode.NewService(db), mockTaskStore)
 	require.NoError(t, svc.RegisterWorkflowManager(mockWM))
 
 	ctx := context.Background()
@@ -406,8 +517,9 @@ func TestConsignmentService_GetConsignmentByID(t *testing.T) {
 
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1 ORDER BY "consignments"."id" LIMIT \$2`).
 		WithArgs(consignmentID, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "flow", "trader_id", "state", "created_at", "updated_at", "items"}).
-			AddRow(consignmentID, "IMPORT", "trader1", "IN_PROGRESS", time.Now(), time.Now(), []byte(`[{"hsCodeId":"`+hsCodeID+`"}]`)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "flow", "trader_id", "trader_company_id", "state", "created_at", "updated_at", "items"}).
+			AddRow(consignmentID, "IMPORT", "trader1", "company-trader", "IN_PROGRESS", time.Now(), time.Now(), []byte(`[{"hsCodeId":"`+hsCodeID+`"}]`)))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
 
 	mockWM.On("GetStatus", ctx, consignmentID).Return((*workflowManagerV2.WorkflowInstance)(nil), nil)
 
@@ -418,7 +530,7 @@ func TestConsignmentService_GetConsignmentByID(t *testing.T) {
 
 	mockTaskStore.On("GetAllTasks", mock.Anything, consignmentID).Return(([]tfstore.TaskRecord)(nil))
 
-	result, err := svc.GetConsignmentByID(ctx, consignmentID)
+	result, err := svc.GetConsignmentByID(ctx, traderAccessor(), consignmentID)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, consignmentID, result.ID)
@@ -434,7 +546,7 @@ func TestConsignmentService_ListConsignments_TraderCompany_Empty(t *testing.T) {
 	ctx := context.Background()
 	companyID := "company-1"
 
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE trader_company_id = \$1`).
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" .* WHERE trader_company_id = \$1`).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 	result, err := svc.ListConsignments(ctx, Filter{TraderCompanyID: &companyID})
@@ -451,7 +563,7 @@ func TestConsignmentService_ListConsignments_TraderCompany_FindError(t *testing.
 	ctx := context.Background()
 	companyID := "company-1"
 
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments"`).
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments"`).
 		WillReturnError(errors.New("find error"))
 
 	result, err := svc.ListConsignments(ctx, Filter{TraderCompanyID: &companyID})
@@ -475,7 +587,7 @@ func TestConsignmentService_CreateConsignmentShell_CompanyNotFound(t *testing.T)
 	ctx := context.Background()
 	mockCompany.On("GetCompanyByID", ctx, "missing").Return(nil, company.ErrCompanyNotFound)
 
-	_, err := svc.CreateConsignmentShell(ctx, FlowImport, "missing", "trader1")
+	_, err := svc.CreateConsignmentShell(ctx, FlowImport, "missing", "trader1", "")
 	assert.ErrorIs(t, err, company.ErrCompanyNotFound)
 }
 
@@ -495,7 +607,7 @@ func TestConsignmentService_CreateConsignmentShell_InsertError(t *testing.T) {
 	sqlMock.ExpectExec(`INSERT INTO "consignments"`).WillReturnError(errors.New("insert failed"))
 	sqlMock.ExpectRollback()
 
-	_, err := svc.CreateConsignmentShell(ctx, FlowImport, chaCompanyID, traderID)
+	_, err := svc.CreateConsignmentShell(ctx, FlowImport, chaCompanyID, traderID, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create consignment")
 }
@@ -521,22 +633,24 @@ func TestConsignmentService_InitializeConsignmentByID_StartWorkflowError(t *test
 		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id", "trader_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", chaCompanyID, traderCompanyID))
 
 	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
 	mockCompany.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, Data: []byte(`{}`)}, nil)
 
 	sqlMock.ExpectBegin()
-	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map"`).
 		WithArgs(hsID, "IMPORT", 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
 			AddRow(uuid.NewString(), hsID, "IMPORT", wtID))
+	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "INITIALIZED", "IN_PROGRESS")
 	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, wtID).Return(&model.WorkflowTemplateV2{
 		WorkflowDefinition: workflowManagerV2.WorkflowDefinition{ID: "tmpl"},
 	}, nil)
 	mockWM.On("StartWorkflow", mock.Anything, id, workflowManagerV2.WorkflowDefinition{ID: "tmpl"}, mock.Anything).Return(errors.New("start failed"))
 	sqlMock.ExpectRollback()
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{hsID}, chaID)
+	_, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{hsID}, chaID)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to register workflow")
 }
@@ -560,10 +674,10 @@ func TestConsignmentService_InitializeConsignmentByID_TemplateProviderError(t *t
 		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id", "trader_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", chaCompanyID, traderCompanyID))
 
 	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: chaCompanyID}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, chaCompanyID).Return(&company.Record{ID: chaCompanyID, OUHandle: "cha-ou"}, nil)
 	mockCompany.On("GetCompanyByID", mock.Anything, traderCompanyID).Return(&company.Record{ID: traderCompanyID, Data: []byte(`{}`)}, nil)
 
 	sqlMock.ExpectBegin()
-	sqlMock.ExpectExec(`UPDATE "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map"`).
 		WithArgs(hsID, "IMPORT", 1).
@@ -572,7 +686,7 @@ func TestConsignmentService_InitializeConsignmentByID_TemplateProviderError(t *t
 	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, wtID).Return(nil, errors.New("provider error"))
 	sqlMock.ExpectRollback()
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{hsID}, chaID)
+	_, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{hsID}, chaID)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to get workflow template from provider")
 }
@@ -589,11 +703,12 @@ func TestConsignmentService_InitializeConsignmentByID_CHACompanyMismatch(t *test
 
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
 		WithArgs(id, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "cha_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", "company-A"))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_company_id", "cha_company_id"}).AddRow(id, "INITIALIZED", "IMPORT", "company-trader", "company-A"))
+	expectOwnerCompanies(mockCompany, "company-trader", "company-A")
 
 	mockCHA.On("GetByID", mock.Anything, chaID).Return(&cha.Record{ID: chaID, CompanyID: "company-B"}, nil)
 
-	_, err := svc.InitializeConsignmentByID(context.Background(), id, []string{hsID}, chaID)
+	_, err := svc.InitializeConsignmentByID(context.Background(), chaAccessor(), id, []string{hsID}, chaID)
 	assert.ErrorIs(t, err, ErrCHACompanyMismatch)
 }
 
@@ -613,16 +728,18 @@ func TestConsignmentService_MarkConsignmentAsFinished_NotFound(t *testing.T) {
 func TestConsignmentService_GetConsignmentByID_WMError(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
 	mockWM := new(MockWMV2)
-	svc := NewService(db, nil, nil, nil, nil, hscode.NewService(db), nil)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, hscode.NewService(db), nil)
 	require.NoError(t, svc.RegisterWorkflowManager(mockWM))
 
 	id := uuid.NewString()
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
 		WithArgs(id, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(id, "IN_PROGRESS"))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id"}).AddRow(id, "IN_PROGRESS", "company-trader"))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
 	mockWM.On("GetStatus", mock.Anything, id).Return((*workflowManagerV2.WorkflowInstance)(nil), errors.New("wm down"))
 
-	_, err := svc.GetConsignmentByID(context.Background(), id)
+	_, err := svc.GetConsignmentByID(context.Background(), traderAccessor(), id)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to get workflow details")
 }
@@ -631,16 +748,18 @@ func TestConsignmentService_GetConsignmentByID_Initialized_SkipsWM(t *testing.T)
 	db, sqlMock := setupTestDB(t)
 	// No WM registered — INITIALIZED path must NOT call it.
 	mockTaskStore := new(MockTaskStore)
-	svc := NewService(db, nil, nil, nil, nil, hscode.NewService(db), mockTaskStore)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, hscode.NewService(db), mockTaskStore)
 
 	id := uuid.NewString()
 	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
 		WithArgs(id, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "items"}).AddRow(id, "INITIALIZED", []byte("[]")))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "trader_company_id", "items"}).AddRow(id, "INITIALIZED", "company-trader", []byte("[]")))
+	expectOwnerCompanies(mockCompany, "company-trader", "")
 
 	mockTaskStore.On("GetAllTasks", mock.Anything, id).Return(([]tfstore.TaskRecord)(nil))
 
-	result, err := svc.GetConsignmentByID(context.Background(), id)
+	result, err := svc.GetConsignmentByID(context.Background(), traderAccessor(), id)
 	assert.NoError(t, err)
 	assert.Equal(t, Initialized, result.State)
 	mockTaskStore.AssertExpectations(t)
@@ -653,14 +772,11 @@ func TestConsignmentService_ListConsignments_WithItems(t *testing.T) {
 	consignmentID := uuid.NewString()
 	hsID := uuid.NewString()
 
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments"`).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "flow", "trader_id", "state", "items", "created_at", "updated_at"}).
-			AddRow(consignmentID, "IMPORT", traderID, "IN_PROGRESS", []byte(`[{"hsCodeId":"`+hsID+`"}]`), time.Now(), time.Now()))
-	sqlMock.ExpectQuery(`SELECT workflow_id`).
-		WillReturnRows(sqlmock.NewRows([]string{"workflow_id", "total", "completed"}).AddRow(consignmentID, 3, 1))
-	endNodeID := "end1"
-	sqlMock.ExpectQuery(`SELECT id, end_node_id FROM "workflows"`).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "end_node_id"}).AddRow(consignmentID, &endNodeID))
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" ON "consignments"."id" = "Progress"."root_workflow_id"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "flow", "trader_id", "state", "items", "created_at", "updated_at",
+			"Progress__root_workflow_id", "Progress__total", "Progress__completed", "Progress__in_progress", "Progress__awaiting_trader", "Progress__awaiting_oga"}).
+			AddRow(consignmentID, "IMPORT", traderID, "IN_PROGRESS", []byte(`[{"hsCodeId":"`+hsID+`"}]`), time.Now(), time.Now(),
+				consignmentID, 4, 1, 1, 1, 1))
 	sqlMock.ExpectQuery(`SELECT \* FROM "hs_codes" WHERE id IN`).
 		WithArgs(hsID).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code", "description", "category"}).
@@ -670,53 +786,39 @@ func TestConsignmentService_ListConsignments_WithItems(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), result.Total)
 	require.Len(t, result.Items, 1)
-	// End node subtracted: total was 3, becomes 2.
-	assert.Equal(t, 2, result.Items[0].WorkflowNodeCount)
+	assert.Equal(t, ProgressDTO{Total: 4, Completed: 1, InProgress: 1, AwaitingTrader: 1, AwaitingOGA: 1}, result.Items[0].Progress)
+	assert.Equal(t, 4, result.Items[0].WorkflowNodeCount)
 	assert.Equal(t, 1, result.Items[0].CompletedWorkflowNodeCount)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
 }
 
-func TestConsignmentService_ListConsignments_FindError(t *testing.T) {
-	db, sqlMock := setupTestDB(t)
-	svc := NewService(db, nil, nil, nil, nil, nil, nil)
-	traderID := "trader1"
-
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments"`).
-		WillReturnError(errors.New("find error"))
-
-	_, err := svc.ListConsignments(context.Background(), Filter{TraderCompanyID: &traderID})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to retrieve consignments")
-}
-
-func TestConsignmentService_ListConsignments_NodeCountError(t *testing.T) {
+func TestConsignmentService_ListConsignments_NoProgressYet(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
 	svc := NewService(db, nil, nil, nil, nil, nil, nil)
 	traderID := "trader1"
 
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments"`).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "items"}).AddRow(uuid.NewString(), []byte("[]")))
-	sqlMock.ExpectQuery(`SELECT workflow_id`).WillReturnError(errors.New("node count error"))
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "items", "Progress__root_workflow_id", "Progress__total"}).
+			AddRow(uuid.NewString(), "INITIALIZED", []byte("[]"), nil, nil))
 
-	_, err := svc.ListConsignments(context.Background(), Filter{TraderCompanyID: &traderID})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "node counts")
+	result, err := svc.ListConsignments(context.Background(), Filter{TraderCompanyID: &traderID})
+	require.NoError(t, err)
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, ProgressDTO{}, result.Items[0].Progress)
+	assert.Zero(t, result.Items[0].WorkflowNodeCount)
 }
 
-func TestConsignmentService_ListConsignments_EndNodeError(t *testing.T) {
+func TestConsignmentService_ListConsignments_FindError(t *testing.T) {
 	db, sqlMock := setupTestDB(t)
 	svc := NewService(db, nil, nil, nil, nil, nil, nil)
 	traderID := "trader1"
 
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments"`).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "items"}).AddRow(uuid.NewString(), []byte("[]")))
-	sqlMock.ExpectQuery(`SELECT workflow_id`).
-		WillReturnRows(sqlmock.NewRows([]string{"workflow_id", "total", "completed"}))
-	sqlMock.ExpectQuery(`SELECT id, end_node_id FROM "workflows"`).
-		WillReturnError(errors.New("end node error"))
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments"`).
+		WillReturnError(errors.New("find error"))
 
 	_, err := svc.ListConsignments(context.Background(), Filter{TraderCompanyID: &traderID})
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "end nodes")
+	assert.Contains(t, err.Error(), "failed to retrieve consignments")
 }
 
 func TestConsignmentService_ListConsignments_CHACompanyPath(t *testing.T) {
@@ -724,7 +826,7 @@ func TestConsignmentService_ListConsignments_CHACompanyPath(t *testing.T) {
 	svc := NewService(db, nil, nil, nil, nil, nil, nil)
 	companyID := "company-cha"
 
-	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE cha_company_id = \$1`).
+	sqlMock.ExpectQuery(`SELECT .* FROM "consignments" LEFT JOIN "task_progress" "Progress" .* WHERE cha_company_id = \$1`).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 	result, err := svc.ListConsignments(context.Background(), Filter{CHACompanyID: &companyID})
@@ -738,3 +840,242 @@ func TestConsignmentService_BuildItemResponseDTOs_MissingHSCode(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "HS code not found")
 }
+
+func TestConsignmentService_OwnerOUHandles(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+	id := uuid.NewString()
+
+	sqlMock.ExpectQuery(`SELECT "id","trader_company_id","cha_company_id" FROM "consignments"`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trader_company_id", "cha_company_id"}).AddRow(id, "trader-co", "cha-co"))
+	mockCompany.On("GetCompanyByID", mock.Anything, "trader-co").Return(&company.Record{ID: "trader-co", OUHandle: "trader-ou"}, nil)
+	mockCompany.On("GetCompanyByID", mock.Anything, "cha-co").Return(&company.Record{ID: "cha-co", OUHandle: "cha-ou"}, nil)
+
+	handles, err := svc.OwnerOUHandles(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"trader-ou", "cha-ou"}, handles)
+}
+
+func TestConsignmentService_AssigneeEmails(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCHA := new(MockCHAService)
+	svc := NewService(db, nil, mockCHA, nil, nil, nil, nil)
+	id := uuid.NewString()
+
+	sqlMock.ExpectQuery(`SELECT "id","cha_id" FROM "consignments"`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "cha_id"}).AddRow(id, "cha1"))
+	mockCHA.On("GetByID", mock.Anything, "cha1").Return(&cha.Record{ID: "cha1", Email: "agent@broker.test"}, nil)
+
+	emails, err := svc.AssigneeEmails(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"agent@broker.test"}, emails)
+
+	sqlMock.ExpectQuery(`SELECT "id","cha_id" FROM "consignments"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "cha_id"}).AddRow(id, nil))
+	emails, err = svc.AssigneeEmails(context.Background(), id)
+	require.NoError(t, err)
+	assert.Empty(t, emails, "unclaimed consignment")
+}
+
+func TestConsignmentService_OwnerCompanyID(t *testing.T) {
+	mockCompany := new(MockCompanyService)
+	svc := NewService(nil, nil, nil, mockCompany, nil, nil, nil)
+	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "cha-ou").Return(&company.Record{ID: "cha-co", OUHandle: "cha-ou"}, nil)
+	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "new-ou").Return(nil, company.ErrCompanyNotFound)
+
+	id, err := svc.OwnerCompanyID(context.Background(), "cha-ou")
+	require.NoError(t, err)
+	assert.Equal(t, "cha-co", id)
+
+	id, err = svc.OwnerCompanyID(context.Background(), "new-ou")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+}
+
+func TestConsignmentService_OwnerOUHandles_NoCHACompany(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+	id := uuid.NewString()
+
+	sqlMock.ExpectQuery(`SELECT "id","trader_company_id","cha_company_id" FROM "consignments"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trader_company_id", "cha_company_id"}).AddRow(id, "trader-co", nil))
+	mockCompany.On("GetCompanyByID", mock.Anything, "trader-co").Return(&company.Record{ID: "trader-co", OUHandle: "trader-ou"}, nil)
+
+	handles, err := svc.OwnerOUHandles(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"trader-ou"}, handles)
+}
+
+func TestConsignmentService_OwnerOUHandles_NotFound(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+
+	sqlMock.ExpectQuery(`SELECT "id","trader_company_id","cha_company_id" FROM "consignments"`).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := svc.OwnerOUHandles(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrConsignmentNotFound)
+}
+
+func TestConsignmentService_PayerName(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	mockCompany := new(MockCompanyService)
+	svc := NewService(db, nil, nil, mockCompany, nil, nil, nil)
+	id := uuid.NewString()
+
+	sqlMock.ExpectQuery(`SELECT "id","trader_company_id" FROM "consignments"`).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trader_company_id"}).AddRow(id, "trader-co"))
+	mockCompany.On("GetCompanyByID", mock.Anything, "trader-co").Return(&company.Record{ID: "trader-co", Name: "Ceylon Spice Exports"}, nil)
+
+	name, err := svc.PayerName(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, "Ceylon Spice Exports", name)
+}
+
+func TestConsignmentService_PayerName_NotFound(t *testing.T) {
+	db, sqlMock := setupTestDB(t)
+	svc := NewService(db, nil, nil, nil, nil, nil, nil)
+
+	sqlMock.ExpectQuery(`SELECT "id","trader_company_id" FROM "consignments"`).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := svc.PayerName(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrConsignmentNotFound)
+}
+
+func TestConsignmentService_CreateAndStartConsignment(t *testing.T) {
+	traderCompanyID := "company-trader"
+	setup := func(t *testing.T) (*Service, sqlmock.Sqlmock, *MockTemplateProvider, *MockWMV2) {
+		db, sqlMock := setupTestDB(t)
+		mockTP := new(MockTemplateProvider)
+		mockWM := new(MockWMV2)
+		mockUser := new(MockUserService)
+		mockCompany := new(MockCompanyService)
+		mockTaskStore := new(MockTaskStore)
+		svc := NewService(db, mockTP, nil, mockCompany, mockUser, hscode.NewService(db), mockTaskStore)
+		require.NoError(t, svc.RegisterWorkflowManager(mockWM))
+
+		mockUser.On("GetUser", "trader1").Return(&user.Record{ID: "trader1", OUHandle: "trader-ou"}, nil)
+		mockCompany.On("GetCompanyByOUHandle", mock.Anything, "trader-ou").Return(&company.Record{ID: traderCompanyID, OUHandle: "trader-ou", Data: []byte(`{}`)}, nil)
+		mockTaskStore.On("GetAllTasks", mock.Anything, mock.Anything).Return(([]tfstore.TaskRecord)(nil))
+		return svc, sqlMock, mockTP, mockWM
+	}
+	expectStarted := func(sqlMock sqlmock.Sqlmock, items string) {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`INSERT INTO "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectTimelineEvent(sqlMock, timeline.ConsignmentStateChanged, "", "IN_PROGRESS")
+		sqlMock.ExpectCommit()
+		sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_id", "trader_company_id", "items", "created_at", "updated_at"}).
+				AddRow("cons-1", "IN_PROGRESS", "EXPORT", "trader1", traderCompanyID, []byte(items), time.Now(), time.Now()))
+	}
+	wfDef := workflowManagerV2.WorkflowDefinition{ID: "trade-export-v1"}
+
+	t.Run("template by HS code", func(t *testing.T) {
+		svc, sqlMock, mockTP, mockWM := setup(t)
+		sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map" WHERE consignment_flow = \$1 AND hs_code_id = \$2`).
+			WithArgs("EXPORT", "hs-tea", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code_id", "consignment_flow", "workflow_template_id"}).
+				AddRow("map-1", "hs-tea", "EXPORT", "trade-export-v1"))
+		mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, "trade-export-v1").Return(&model.WorkflowTemplateV2{WorkflowDefinition: wfDef}, nil)
+		mockWM.On("StartWorkflow", mock.Anything, mock.Anything, wfDef, mock.MatchedBy(func(vars map[string]any) bool {
+			items, ok := vars["items"].([]any)
+			return ok && len(items) == 1 && vars["port"] == "CMB" && vars["traderCompany"] != nil
+		})).Return(nil)
+		expectStarted(sqlMock, `[{"hsCodeId":"hs-tea","workflowTemplateId":"trade-export-v1"}]`)
+		sqlMock.ExpectQuery(`SELECT \* FROM "hs_codes" WHERE id IN`).
+			WithArgs("hs-tea").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hs_code"}).AddRow("hs-tea", "0902.10"))
+
+		result, err := svc.CreateAndStartConsignment(context.Background(), "trader1", StartConsignmentDTO{
+			Flow: FlowExport, HSCodeID: "hs-tea", Context: map[string]any{"port": "CMB"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, InProgress, result.State)
+		require.Len(t, result.Items, 1)
+		assert.Equal(t, "0902.10", result.Items[0].HSCode.HSCode)
+		mockWM.AssertExpectations(t)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("explicit template", func(t *testing.T) {
+		svc, sqlMock, mockTP, mockWM := setup(t)
+		sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "workflow_template_map" WHERE consignment_flow = \$1 AND workflow_template_id = \$2`).
+			WithArgs("EXPORT", "trade-export-v1").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, "trade-export-v1").Return(&model.WorkflowTemplateV2{WorkflowDefinition: wfDef}, nil)
+		mockWM.On("StartWorkflow", mock.Anything, mock.Anything, wfDef, mock.MatchedBy(func(vars map[string]any) bool {
+			_, hasItems := vars["items"]
+			return !hasItems
+		})).Return(nil)
+		expectStarted(sqlMock, `[]`)
+
+		result, err := svc.CreateAndStartConsignment(context.Background(), "trader1", StartConsignmentDTO{Flow: FlowExport, TemplateID: "trade-export-v1"})
+		require.NoError(t, err)
+		assert.Equal(t, InProgress, result.State)
+		assert.Empty(t, result.Items)
+		mockWM.AssertExpectations(t)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("template not in flow", func(t *testing.T) {
+		svc, sqlMock, _, mockWM := setup(t)
+		sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "workflow_template_map"`).
+			WithArgs("IMPORT", "trade-export-v1").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		_, err := svc.CreateAndStartConsignment(context.Background(), "trader1", StartConsignmentDTO{Flow: FlowImport, TemplateID: "trade-export-v1"})
+		assert.ErrorIs(t, err, ErrTemplateNotInFlow)
+		mockWM.AssertNotCalled(t, "StartWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("template not mapped to the HS code", func(t *testing.T) {
+		svc, sqlMock, _, mockWM := setup(t)
+		sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "workflow_template_map" WHERE consignment_flow = \$1 AND \(hs_code_id = \$2 AND workflow_template_id = \$3\)`).
+			WithArgs("EXPORT", "hs-tea", "trade-export-v1").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		_, err := svc.CreateAndStartConsignment(context.Background(), "trader1", StartConsignmentDTO{
+			Flow: FlowExport, HSCodeID: "hs-tea", TemplateID: "trade-export-v1",
+		})
+		assert.ErrorIs(t, err, ErrTemplateNotForHSCode)
+		mockWM.AssertNotCalled(t, "StartWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("context key written by the workflow", func(t *testing.T) {
+		svc, sqlMock, mockTP, mockWM := setup(t)
+		mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, "trade-export-v1").Return(&model.WorkflowTemplateV2{
+			WorkflowDefinition: workflowManagerV2.WorkflowDefinition{ID: "trade-export-v1", Nodes: []workflowManagerV2.Node{
+				{ID: "node_review", OutputMapping: map[string]string{"outcome": "fcau.application_review_outcome"}},
+			}},
+		}, nil)
+
+		for _, vars := range []map[string]any{
+			{"fcau.application_review_outcome": "APPROVED"},
+			{"fcau": map[string]any{"application_review_outcome": "APPROVED"}},
+		} {
+			sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "workflow_template_map"`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			_, err := svc.CreateAndStartConsignment(context.Background(), "trader1", StartConsignmentDTO{
+				Flow: FlowExport, TemplateID: "trade-export-v1", Context: vars,
+			})
+			assert.ErrorIs(t, err, ErrContextKeyWorkflowOwned)
+		}
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+		mockWM.AssertNotCalled(t, "StartWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("HS code without a template", func(t *testing.T) {
+		svc, sqlMock, _, _ := setup(t)
+		sqlMock.ExpectQuery(`SELECT \* FROM "workflow_template_map"`).WillReturnError(gorm.ErrRecordNotFound)
+
+		_, err := svc.CreateAndStartConsignment(context.Background(), "trader1", StartConsignmentDTO{Flow: FlowExport, HSCodeID: "hs-unknown"})
+		assert.ErrorIs(t, err, ErrNoWorkflowTemplate)
+	})
+}
@@ -0,0 +1,108 @@
+//go:build integration
+
+package consignment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+
+	workflowManagerV2 "github.com/OpenNSW/go-temporal-workflow"
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/OpenNSW/nsw/backend/internal/hscode"
+	"github.com/OpenNSW/nsw/backend/internal/profile/company"
+	"github.com/OpenNSW/nsw/backend/internal/profile/user"
+	"github.com/OpenNSW/nsw/backend/internal/workflow"
+	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
+)
+
+// activations records the task nodes the parent workflow reaches.
+type activations chan workflowManagerV2.TaskPayload
+
+func (a activations) StartTask(payload workflowManagerV2.TaskPayload) (map[string]any, error) {
+	a <- payload
+	return nil, nil
+}
+
+// TestIntegration_CreateAndStartConsignment starts a consignment against a Temporal dev
+// server (downloaded by the SDK test suite on first run) and follows the parent workflow
+// to its first task. Run with: go test -tags integration -run Integration ./internal/consignment/
+func TestIntegration_CreateAndStartConsignment(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	server, err := testsuite.StartDevServer(ctx, testsuite.DevServerOptions{LogLevel: "error"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	reached := make(activations, 1)
+	runner, stop, err := workflow.WireParentRunner(server.Client(), reached, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = stop() })
+
+	db, sqlMock := setupTestDB(t)
+	mockTP := new(MockTemplateProvider)
+	mockUser := new(MockUserService)
+	mockCompany := new(MockCompanyService)
+	mockTaskStore := new(MockTaskStore)
+	svc := NewService(db, mockTP, nil, mockCompany, mockUser, hscode.NewService(db), mockTaskStore)
+	require.NoError(t, svc.RegisterWorkflowManager(runner))
+
+	mockUser.On("GetUser", "trader1").Return(&user.Record{ID: "trader1", OUHandle: "trader-ou"}, nil)
+	mockCompany.On("GetCompanyByOUHandle", mock.Anything, "trader-ou").Return(&company.Record{ID: "company-trader", OUHandle: "trader-ou", Data: []byte(`{}`)}, nil)
+	mockTaskStore.On("GetAllTasks", mock.Anything, mock.Anything).Return(([]tfstore.TaskRecord)(nil))
+
+	def := workflowManagerV2.WorkflowDefinition{
+		ID:      "trade-export-v1",
+		Name:    "General Information & Certificate Approvals",
+		Version: 1,
+		Nodes: []workflowManagerV2.Node{
+			{ID: "start", Type: workflowManagerV2.NodeTypeStart},
+			{ID: "cha_selection", Type: workflowManagerV2.NodeTypeTask, TaskTemplateID: "trade_1_cha_selection"},
+			{ID: "end", Type: workflowManagerV2.NodeTypeEnd},
+		},
+		Edges: []workflowManagerV2.Edge{
+			{ID: "e1", SourceID: "start", TargetID: "cha_selection"},
+			{ID: "e2", SourceID: "cha_selection", TargetID: "end"},
+		},
+	}
+	sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "workflow_template_map"`).
+		WithArgs("EXPORT", "trade-export-v1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mockTP.On("GetWorkflowTemplateByIDV2", mock.Anything, "trade-export-v1").Return(&model.WorkflowTemplateV2{WorkflowDefinition: def}, nil)
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(`INSERT INTO "consignments"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignments" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "flow", "trader_id", "trader_company_id", "items", "created_at", "updated_at"}).
+			AddRow("cons-1", "IN_PROGRESS", "EXPORT", "trader1", "company-trader", []byte(`[]`), time.Now(), time.Now()))
+
+	result, err := svc.CreateAndStartConsignment(ctx, "trader1", StartConsignmentDTO{
+		Flow:       FlowExport,
+		TemplateID: "trade-export-v1",
+		Context:    map[string]any{"port": "CMB"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, InProgress, result.State)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+
+	// The parent workflow runs under the new consignment's ID.
+	var payload workflowManagerV2.TaskPayload
+	select {
+	case payload = <-reached:
+	case <-ctx.Done():
+		t.Fatal("parent workflow never reached its first task")
+	}
+	assert.Equal(t, "trade_1_cha_selection", payload.TaskTemplateID)
+	require.NotEmpty(t, payload.WorkflowID)
+
+	desc, err := server.Client().DescribeWorkflowExecution(ctx, payload.WorkflowID, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Running", desc.GetWorkflowExecutionInfo().GetStatus().String())
+}
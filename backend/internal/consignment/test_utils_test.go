@@ -7,6 +7,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	workflowManagerV2 "github.com/OpenNSW/go-temporal-workflow"
 	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/driver/postgres"
@@ -72,6 +73,18 @@ func (m *MockTaskStore) GetAllTasks(ctx context.Context, parentWorkflowID string
 	return args.Get(0).([]tfstore.TaskRecord)
 }
 
+func (m *MockTaskStore) CancelTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error {
+	return m.Called(ctx, tx, taskIDs).Error(0)
+}
+
+func (m *MockTaskStore) RetryTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error {
+	return m.Called(ctx, tx, taskIDs).Error(0)
+}
+
+func (m *MockTaskStore) SupersedeTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error {
+	return m.Called(ctx, tx, taskIDs).Error(0)
+}
+
 // MockWMV2 implements workflowManagerV2.TemporalManager for testing.
 type MockWMV2 struct {
 	mock.Mock
@@ -120,3 +133,11 @@ func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
 
 	return db, sqlMock
 }
+
+// expectTimelineEvent expects an event of eventType, from state from to state to, to be
+// appended to the consignment_events log.
+func expectTimelineEvent(sqlMock sqlmock.Sqlmock, eventType timeline.Type, from, to string) {
+	sqlMock.ExpectQuery(`INSERT INTO "consignment_events"`).
+		WithArgs(sqlmock.AnyArg(), eventType, sqlmock.AnyArg(), sqlmock.AnyArg(), from, to, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
@@ -0,0 +1,74 @@
+package consignment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+	"github.com/OpenNSW/nsw/backend/pkg/pagination"
+)
+
+// stateChanged is the timeline event of consignment moving from state from to its current
+// state, by actor; an empty from marks its creation.
+func stateChanged(consignment *Consignment, from State, actor string, details map[string]any) timeline.Event {
+	return timeline.Event{
+		ConsignmentID: consignment.ID,
+		Type:          timeline.ConsignmentStateChanged,
+		Actor:         actor,
+		FromState:     string(from),
+		ToState:       string(consignment.State),
+		Details:       details,
+	}
+}
+
+// GetTimeline returns a page of the timeline of a consignment, oldest event first, on
+// behalf of principal.
+func (s *Service) GetTimeline(ctx context.Context, principal authz.Principal, consignmentID string, offset, limit *int) (*TimelineResult, error) {
+	consignment, err := s.timelineConsignment(ctx, consignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeAccess(ctx, principal, consignment); err != nil {
+		return nil, err
+	}
+	return s.listTimeline(ctx, consignment.ID, offset, limit)
+}
+
+// GetTimelineForSupport returns a page of the timeline of any consignment, for support
+// staff.
+func (s *Service) GetTimelineForSupport(ctx context.Context, consignmentID string, offset, limit *int) (*TimelineResult, error) {
+	consignment, err := s.timelineConsignment(ctx, consignmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.listTimeline(ctx, consignment.ID, offset, limit)
+}
+
+func (s *Service) timelineConsignment(ctx context.Context, consignmentID string) (*Consignment, error) {
+	var consignment Consignment
+	if err := s.db.WithContext(ctx).First(&consignment, "id = ?", consignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsignmentNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve consignment %s: %w", consignmentID, err)
+	}
+	return &consignment, nil
+}
+
+func (s *Service) listTimeline(ctx context.Context, consignmentID string, offset, limit *int) (*TimelineResult, error) {
+	finalOffset, finalLimit := pagination.ResolvePaginationParams(offset, limit)
+	events, total, err := timeline.List(ctx, s.db, consignmentID, finalOffset, finalLimit)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]timeline.EventDTO, len(events))
+	for i := range events {
+		dtos[i] = events[i].ToDTO()
+	}
+	result := pagination.NewPageResult(dtos, total, finalOffset, finalLimit)
+	return &result, nil
+}
@@ -0,0 +1,88 @@
+package consignment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+)
+
+func expectTimeline(sqlMock sqlmock.Sqlmock, id string, total int) {
+	sqlMock.ExpectQuery(`SELECT count\(\*\) FROM "consignment_events" WHERE consignment_id = \$1`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(total))
+	sqlMock.ExpectQuery(`SELECT \* FROM "consignment_events" WHERE consignment_id = \$1 ORDER BY id LIMIT \$2 OFFSET \$3`).
+		WithArgs(id, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "consignment_id", "type", "task_id", "actor", "from_state", "to_state", "details", "created_at"}).
+			AddRow(2, id, timeline.TaskActivated, "t-review", "", "", "QUEUED_EXTERNALLY", []byte(`{"nodeId":"node_review"}`), time.Now()).
+			AddRow(3, id, timeline.OGACallbackReceived, "t-review", "fcau-client", "", "", []byte(`{"serviceId":"fcau"}`), time.Now()))
+}
+
+func TestConsignmentService_GetTimeline(t *testing.T) {
+	const id = "cons-1"
+	offset, limit := 1, 2
+
+	t.Run("pages through the events", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		expectConsignment(sqlMock, id, InProgress)
+		expectTimeline(sqlMock, id, 5)
+
+		result, err := svc.GetTimeline(context.Background(), traderAccessor(), id, &offset, &limit)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), result.Total)
+		require.Len(t, result.Items, 2)
+		assert.Equal(t, timeline.TaskActivated, result.Items[0].Type)
+		assert.Equal(t, "fcau-client", result.Items[1].Actor)
+		assert.Equal(t, "fcau", result.Items[1].Details["serviceId"])
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("hidden from other companies", func(t *testing.T) {
+		svc, sqlMock, _, _ := amendService(t)
+		expectConsignment(sqlMock, id, InProgress)
+
+		other := NewUserAccessor("u9", "", "other-ou", []string{RoleTrader})
+		_, err := svc.GetTimeline(context.Background(), other, id, nil, nil)
+		assert.ErrorIs(t, err, ErrConsignmentNotFound)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func TestConsignmentRouter_HandleGetTimeline(t *testing.T) {
+	const id = "cons-1"
+	svc, sqlMock, _, _ := amendService(t)
+	expectConsignment(sqlMock, id, InProgress)
+	expectTimeline(sqlMock, id, 3)
+
+	req, _ := http.NewRequest("GET", "/api/v1/consignments/"+id+"/timeline?offset=1&limit=2", nil)
+	req.SetPathValue("id", id)
+	req = req.WithContext(withAuthContextOU(req.Context(), "cha-user", "cha-ou", RoleCHA))
+	w := httptest.NewRecorder()
+	NewRouter(svc, nil, nil).HandleGetTimeline(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"type":"OGA_CALLBACK_RECEIVED"`)
+	assert.Contains(t, w.Body.String(), `"total":3`)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+
+	t.Run("support sees any consignment", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		expectConsignment(sqlMock, id, Failed)
+		expectTimeline(sqlMock, id, 3)
+
+		req, _ := http.NewRequest("GET", "/api/v1/admin/consignments/"+id+"/timeline?offset=1&limit=2", nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		NewRouter(NewService(db, nil, nil, nil, nil, nil, nil), nil, nil).HandleGetTimelineForSupport(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,378 @@
+package consignment
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	workflowmanager "github.com/OpenNSW/go-temporal-workflow"
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+)
+
+// Node vocabulary of merged parent workflows, as used by the seeded templates.
+const (
+	nodeTypeGateway          = workflowmanager.NodeType("GATEWAY")
+	gatewayTypeParallelSplit = workflowmanager.GatewayType("PARALLEL_SPLIT")
+	gatewayTypeParallelJoin  = workflowmanager.GatewayType("PARALLEL_JOIN")
+	gatewayTypeExclusiveJoin = workflowmanager.GatewayType("EXCLUSIVE_JOIN")
+)
+
+// subFlowSeparator joins a sub-flow key to the template's own node ID in a
+// merged definition ("flow2__node_5_phyto"). "--" is avoided because it
+// separates the segments of SPLIT_TASK child workflow IDs.
+const subFlowSeparator = "__"
+
+// subFlowKeySeparator joins the keys of the sub-flows sharing a task node
+// ("flow1+flow3__node_5_phyto").
+const subFlowKeySeparator = "+"
+
+// itemSubFlow is one template's share of a consignment: the items whose HS
+// codes map to it. Items sharing a template share its OGA tasks, so a single
+// certificate covers all of them; tasks common to several templates are
+// shared when the sub-flows are merged.
+type itemSubFlow struct {
+	Key        string
+	TemplateID string
+	Definition workflowmanager.WorkflowDefinition
+	HSCodeIDs  []string
+}
+
+// mergeSubFlows builds the parent workflow for a consignment's sub-flows. A
+// single sub-flow runs its template unchanged. Several run side by side: each
+// template's nodes are namespaced with the sub-flow key, its START is replaced
+// by a shared PARALLEL_SPLIT and its END by a shared PARALLEL_JOIN. A template
+// reaching END along several edges, such as separate success and rejection
+// ends on exclusive branches, first merges them in its own EXCLUSIVE_JOIN, as
+// only one of them fires and the PARALLEL_JOIN waits for every incoming edge.
+//
+// An OGA task that several templates always run (see sharedTasks) becomes one
+// node for all of their items, so e.g. a single phytosanitary certificate
+// covers every plant HS code. It waits for each sub-flow to reach it and then
+// hands back to each. Sharing is dropped if it would order the tasks in a
+// cycle, as when two templates run the same two tasks in opposite order.
+func mergeSubFlows(subFlows []itemSubFlow) (workflowmanager.WorkflowDefinition, error) {
+	if len(subFlows) == 1 {
+		return subFlows[0].Definition, nil
+	}
+	merged, err := mergeDefinitions(subFlows, sharedTasks(subFlows))
+	if err != nil || !hasCycle(merged) {
+		return merged, err
+	}
+	return mergeDefinitions(subFlows, nil)
+}
+
+// mergeDefinitions lays out the sub-flows side by side, replacing each node
+// named in shared (sub-flow key -> node ID -> merged ID) by the merged node.
+func mergeDefinitions(subFlows []itemSubFlow, shared map[string]map[string]string) (workflowmanager.WorkflowDefinition, error) {
+
+	const (
+		startID = "merged_start"
+		splitID = "merged_split"
+		joinID  = "merged_join"
+		endID   = "merged_end"
+	)
+	ids := make([]string, len(subFlows))
+	for i, sf := range subFlows {
+		ids[i] = sf.TemplateID
+	}
+	merged := workflowmanager.WorkflowDefinition{
+		ID:      "merged:" + strings.Join(ids, "+"),
+		Name:    "Merged workflow",
+		Version: 1,
+		Nodes: []workflowmanager.Node{
+			{ID: startID, Type: workflowmanager.NodeTypeStart},
+			{ID: splitID, Type: nodeTypeGateway, GatewayType: gatewayTypeParallelSplit},
+			{ID: joinID, Type: nodeTypeGateway, GatewayType: gatewayTypeParallelJoin},
+			{ID: endID, Type: workflowmanager.NodeTypeEnd},
+		},
+		Edges: []workflowmanager.Edge{
+			{ID: "merged_e_start", SourceID: startID, TargetID: splitID},
+			{ID: "merged_e_end", SourceID: joinID, TargetID: endID},
+		},
+	}
+
+	added := make(map[string]bool)
+	for _, sf := range subFlows {
+		def := sf.Definition
+		starts, ends := make(map[string]bool), make(map[string]bool)
+		for _, n := range def.Nodes {
+			switch n.Type {
+			case workflowmanager.NodeTypeStart:
+				starts[n.ID] = true
+			case workflowmanager.NodeTypeEnd:
+				ends[n.ID] = true
+			default:
+				if id, ok := shared[sf.Key][n.ID]; ok {
+					if added[id] {
+						continue
+					}
+					added[id] = true
+					n.ID = id
+				} else {
+					n.ID = subFlowNodeID(sf.Key, n.ID)
+				}
+				merged.Nodes = append(merged.Nodes, n)
+			}
+		}
+		if len(starts) != 1 || len(ends) == 0 {
+			return workflowmanager.WorkflowDefinition{}, fmt.Errorf("workflow template %s must have one START and at least one END node to be merged", sf.TemplateID)
+		}
+
+		exitID := joinID
+		endEdges := 0
+		for _, e := range def.Edges {
+			if ends[e.TargetID] {
+				endEdges++
+			}
+		}
+		if endEdges > 1 {
+			exitID = joinID + "_" + sf.Key
+			merged.Nodes = append(merged.Nodes, workflowmanager.Node{ID: exitID, Type: nodeTypeGateway, GatewayType: gatewayTypeExclusiveJoin})
+			merged.Edges = append(merged.Edges, workflowmanager.Edge{ID: "merged_e_end_" + sf.Key, SourceID: exitID, TargetID: joinID})
+		}
+
+		nodeID := func(id string) string {
+			switch {
+			case starts[id]:
+				return splitID
+			case ends[id]:
+				return exitID
+			}
+			if sharedID, ok := shared[sf.Key][id]; ok {
+				return sharedID
+			}
+			return subFlowNodeID(sf.Key, id)
+		}
+		for _, e := range def.Edges {
+			e.ID = subFlowNodeID(sf.Key, e.ID)
+			e.SourceID, e.TargetID = nodeID(e.SourceID), nodeID(e.TargetID)
+			merged.Edges = append(merged.Edges, e)
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(added)) {
+		merged = joinSharedTask(merged, id)
+	}
+	return merged, nil
+}
+
+// joinSharedTask wires a shared task node into the merged definition. Edges
+// that now duplicate each other (the sub-flows reached the task the same way)
+// are kept once. If the task is still entered from several nodes, a
+// PARALLEL_JOIN waits for all of them; if it leads to several, a
+// PARALLEL_SPLIT starts all of them.
+func joinSharedTask(def workflowmanager.WorkflowDefinition, id string) workflowmanager.WorkflowDefinition {
+	var edges []workflowmanager.Edge
+	seen := make(map[[2]string]bool)
+	var sources, targets []string
+	for _, e := range def.Edges {
+		if e.TargetID != id && e.SourceID != id {
+			edges = append(edges, e)
+			continue
+		}
+		pair := [2]string{e.SourceID, e.TargetID}
+		if seen[pair] {
+			continue
+		}
+		seen[pair] = true
+		edges = append(edges, e)
+		if e.TargetID == id {
+			sources = append(sources, e.SourceID)
+		} else {
+			targets = append(targets, e.TargetID)
+		}
+	}
+	def.Edges = edges
+
+	if len(sources) > 1 {
+		gw := id + "_join"
+		def.Nodes = append(def.Nodes, workflowmanager.Node{ID: gw, Type: nodeTypeGateway, GatewayType: gatewayTypeParallelJoin})
+		for i := range def.Edges {
+			if def.Edges[i].TargetID == id {
+				def.Edges[i].TargetID = gw
+			}
+		}
+		def.Edges = append(def.Edges, workflowmanager.Edge{ID: gw + "_e", SourceID: gw, TargetID: id})
+	}
+	if len(targets) > 1 {
+		gw := id + "_split"
+		def.Nodes = append(def.Nodes, workflowmanager.Node{ID: gw, Type: nodeTypeGateway, GatewayType: gatewayTypeParallelSplit})
+		for i := range def.Edges {
+			if def.Edges[i].SourceID == id {
+				def.Edges[i].SourceID = gw
+			}
+		}
+		def.Edges = append(def.Edges, workflowmanager.Edge{ID: gw + "_e", SourceID: id, TargetID: gw})
+	}
+	return def
+}
+
+// sharedTasks picks the task nodes to merge across sub-flows: those whose task
+// template at least two sub-flows run exactly once and always, i.e. reached
+// from START through unconditional edges only. A task on a conditional branch
+// is never shared, since a sub-flow taking another branch would leave the
+// merged node waiting for it forever. The merged ID prefixes the first
+// sub-flow's node ID with every sharing sub-flow key ("flow1+flow3__node_5_phyto").
+//
+// The shared node keeps one input and output mapping, so a task is only
+// shared when every template maps it the same way; otherwise a template's
+// later conditions would read context keys the shared node never writes.
+func sharedTasks(subFlows []itemSubFlow) map[string]map[string]string {
+	type occurrence struct {
+		key  string
+		node workflowmanager.Node
+	}
+	byTemplate := make(map[string][]occurrence)
+	var order []string
+	for _, sf := range subFlows {
+		count := make(map[string]int)
+		for _, n := range sf.Definition.Nodes {
+			if n.Type != workflowmanager.NodeTypeTask || n.TaskTemplateID == "" {
+				continue
+			}
+			count[n.TaskTemplateID]++
+		}
+		certain := alwaysRun(sf.Definition)
+		for _, n := range sf.Definition.Nodes {
+			if n.Type != workflowmanager.NodeTypeTask || count[n.TaskTemplateID] != 1 || !certain[n.ID] {
+				continue
+			}
+			if _, ok := byTemplate[n.TaskTemplateID]; !ok {
+				order = append(order, n.TaskTemplateID)
+			}
+			byTemplate[n.TaskTemplateID] = append(byTemplate[n.TaskTemplateID], occurrence{sf.Key, n})
+		}
+	}
+
+	shared := make(map[string]map[string]string)
+	for _, templateID := range order {
+		occ := byTemplate[templateID]
+		if len(occ) < 2 || slices.ContainsFunc(occ[1:], func(o occurrence) bool { return !sameMappings(o.node, occ[0].node) }) {
+			continue
+		}
+		keys := make([]string, len(occ))
+		for i, o := range occ {
+			keys[i] = o.key
+		}
+		id := subFlowNodeID(strings.Join(keys, subFlowKeySeparator), occ[0].node.ID)
+		for _, o := range occ {
+			if shared[o.key] == nil {
+				shared[o.key] = make(map[string]string)
+			}
+			shared[o.key][o.node.ID] = id
+		}
+	}
+	return shared
+}
+
+// sameMappings reports whether two task nodes read and write the same
+// global context keys.
+func sameMappings(a, b workflowmanager.Node) bool {
+	return maps.Equal(a.InputMapping, b.InputMapping) && maps.Equal(a.OutputMapping, b.OutputMapping)
+}
+
+// alwaysRun returns the nodes of def that run on every path: START, and any
+// node whose incoming edges are all unconditional and come from such nodes.
+func alwaysRun(def workflowmanager.WorkflowDefinition) map[string]bool {
+	incoming := make(map[string][]workflowmanager.Edge)
+	for _, e := range def.Edges {
+		incoming[e.TargetID] = append(incoming[e.TargetID], e)
+	}
+	certain := make(map[string]bool)
+	for _, n := range def.Nodes {
+		if n.Type == workflowmanager.NodeTypeStart {
+			certain[n.ID] = true
+		}
+	}
+	// Iterate to a fixpoint; a node on a loop never becomes certain.
+	for changed := true; changed; {
+		changed = false
+		for _, n := range def.Nodes {
+			if certain[n.ID] || len(incoming[n.ID]) == 0 {
+				continue
+			}
+			ok := true
+			for _, e := range incoming[n.ID] {
+				if e.Condition != "" || !certain[e.SourceID] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				certain[n.ID] = true
+				changed = true
+			}
+		}
+	}
+	return certain
+}
+
+// hasCycle reports whether def's edges form a cycle.
+func hasCycle(def workflowmanager.WorkflowDefinition) bool {
+	next := make(map[string][]string)
+	for _, e := range def.Edges {
+		next[e.SourceID] = append(next[e.SourceID], e.TargetID)
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(string) bool
+	visit = func(id string) bool {
+		switch state[id] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[id] = visiting
+		for _, to := range next[id] {
+			if visit(to) {
+				return true
+			}
+		}
+		state[id] = done
+		return false
+	}
+	for _, n := range def.Nodes {
+		if visit(n.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func subFlowNodeID(key, nodeID string) string {
+	return key + subFlowSeparator + nodeID
+}
+
+// taskSubFlows returns the sub-flow keys of the parent workflow node a task
+// was started from (several for a shared task), or nil for a consignment
+// running a single, unmerged template. Tasks spawned by SPLIT_TASK carry the
+// node in their parent workflow ID ("{root}--{nodeID}--{branchID}").
+func taskSubFlows(t tfstore.TaskRecord) []string {
+	nodeID := t.ParentNodeID
+	if parts := strings.Split(t.ParentWorkflowID, "--"); len(parts) > 1 {
+		nodeID = parts[1]
+	}
+	keys, _, found := strings.Cut(nodeID, subFlowSeparator)
+	if !found {
+		return nil
+	}
+	return strings.Split(keys, subFlowKeySeparator)
+}
+
+// taskHSCodeIDs lists the HS codes of the items a task works for: the items
+// of its sub-flows, or every item when the consignment runs a single template.
+func taskHSCodeIDs(t tfstore.TaskRecord, items []Item) []string {
+	keys := taskSubFlows(t)
+	var ids []string
+	for _, item := range items {
+		if keys == nil || slices.Contains(keys, item.SubFlow) {
+			ids = append(ids, item.HSCodeID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,199 @@
+package consignment
+
+import (
+	"testing"
+
+	workflowManagerV2 "github.com/OpenNSW/go-temporal-workflow"
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSubFlows_SingleTemplateUnchanged(t *testing.T) {
+	def := workflowManagerV2.WorkflowDefinition{ID: "wt-1", Nodes: []workflowManagerV2.Node{{ID: "start", Type: workflowManagerV2.NodeTypeStart}}}
+	merged, err := mergeSubFlows([]itemSubFlow{{Key: "flow1", TemplateID: "wt-1", Definition: def}})
+	require.NoError(t, err)
+	assert.Equal(t, def, merged)
+}
+
+func TestMergeSubFlows_RejectsTemplateWithoutStart(t *testing.T) {
+	noStart := workflowManagerV2.WorkflowDefinition{Nodes: []workflowManagerV2.Node{{ID: "end", Type: workflowManagerV2.NodeTypeEnd}}}
+	_, err := mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-1", Definition: noStart},
+		{Key: "flow2", TemplateID: "wt-2", Definition: noStart},
+	})
+	assert.ErrorContains(t, err, "wt-1 must have one START")
+}
+
+// template builds a workflow template running tasks (node ID -> task
+// template ID) along edges between node IDs; "start" and "end" are implied.
+func template(id string, tasks map[string]string, edges ...workflowManagerV2.Edge) workflowManagerV2.WorkflowDefinition {
+	def := workflowManagerV2.WorkflowDefinition{
+		ID: id,
+		Nodes: []workflowManagerV2.Node{
+			{ID: "start", Type: workflowManagerV2.NodeTypeStart},
+			{ID: "end", Type: workflowManagerV2.NodeTypeEnd},
+		},
+		Edges: edges,
+	}
+	for nodeID, taskTemplateID := range tasks {
+		def.Nodes = append(def.Nodes, workflowManagerV2.Node{ID: nodeID, Type: workflowManagerV2.NodeTypeTask, TaskTemplateID: taskTemplateID})
+	}
+	return def
+}
+
+func edge(id, from, to string) workflowManagerV2.Edge {
+	return workflowManagerV2.Edge{ID: id, SourceID: from, TargetID: to}
+}
+
+func nodeIDs(def workflowManagerV2.WorkflowDefinition) []string {
+	ids := make([]string, len(def.Nodes))
+	for i, n := range def.Nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+func TestMergeSubFlows_SharesTaskAcrossTemplates(t *testing.T) {
+	// Plants go straight to the phytosanitary certificate; seeds are
+	// fumigated first. Both templates run the same certificate task.
+	plant := template("wt-plant", map[string]string{"node_5_phyto": "tt-phyto"},
+		edge("e1", "start", "node_5_phyto"), edge("e2", "node_5_phyto", "end"))
+	seed := template("wt-seed", map[string]string{"fumigation": "tt-fumigation", "phyto_cert": "tt-phyto"},
+		edge("s1", "start", "fumigation"), edge("s2", "fumigation", "phyto_cert"), edge("s3", "phyto_cert", "end"))
+
+	merged, err := mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-plant", Definition: plant},
+		{Key: "flow2", TemplateID: "wt-seed", Definition: seed},
+	})
+	require.NoError(t, err)
+
+	const phyto = "flow1+flow2__node_5_phyto"
+	assert.ElementsMatch(t, []string{"merged_start", "merged_split", "merged_join", "merged_end", phyto, "flow2__fumigation", phyto + "_join"}, nodeIDs(merged))
+	assert.ElementsMatch(t, []workflowManagerV2.Edge{
+		edge("merged_e_start", "merged_start", "merged_split"),
+		edge("merged_e_end", "merged_join", "merged_end"),
+		edge("flow1__e1", "merged_split", phyto+"_join"),
+		edge("flow2__s1", "merged_split", "flow2__fumigation"),
+		edge("flow2__s2", "flow2__fumigation", phyto+"_join"),
+		edge(phyto+"_join_e", phyto+"_join", phyto),
+		edge("flow1__e2", phyto, "merged_join"),
+	}, merged.Edges, "the certificate waits for both sub-flows and is issued once")
+}
+
+func TestMergeSubFlows_KeepsConditionalTasksApart(t *testing.T) {
+	inspected := template("wt-1", map[string]string{"inspect": "tt-inspect"},
+		workflowManagerV2.Edge{ID: "e1", SourceID: "start", TargetID: "inspect", Condition: "risk == 'high'"},
+		edge("e2", "start", "end"), edge("e3", "inspect", "end"))
+	always := template("wt-2", map[string]string{"inspect": "tt-inspect"},
+		edge("e1", "start", "inspect"), edge("e2", "inspect", "end"))
+
+	merged, err := mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-1", Definition: inspected},
+		{Key: "flow2", TemplateID: "wt-2", Definition: always},
+	})
+	require.NoError(t, err)
+	assert.Subset(t, nodeIDs(merged), []string{"flow1__inspect", "flow2__inspect"})
+}
+
+func TestMergeSubFlows_OppositeOrderIsNotShared(t *testing.T) {
+	ab := template("wt-1", map[string]string{"a": "tt-a", "b": "tt-b"},
+		edge("e1", "start", "a"), edge("e2", "a", "b"), edge("e3", "b", "end"))
+	ba := template("wt-2", map[string]string{"a": "tt-a", "b": "tt-b"},
+		edge("e1", "start", "b"), edge("e2", "b", "a"), edge("e3", "a", "end"))
+
+	merged, err := mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-1", Definition: ab},
+		{Key: "flow2", TemplateID: "wt-2", Definition: ba},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"merged_start", "merged_split", "merged_join", "merged_end", "flow1__a", "flow1__b", "flow2__a", "flow2__b"}, nodeIDs(merged),
+		"sharing both tasks would make each wait for the other")
+}
+
+func TestMergeSubFlows_JoinsExclusiveEndsPerSubFlow(t *testing.T) {
+	// Like the FCAU health certificate template: an approval and a rejection
+	// end on exclusive branches, and only one of them ever fires.
+	reviewed := workflowManagerV2.WorkflowDefinition{
+		ID: "wt-1",
+		Nodes: []workflowManagerV2.Node{
+			{ID: "start", Type: workflowManagerV2.NodeTypeStart},
+			{ID: "review", Type: workflowManagerV2.NodeTypeTask, TaskTemplateID: "tt-review"},
+			{ID: "end_success", Type: workflowManagerV2.NodeTypeEnd},
+			{ID: "end_rejected", Type: workflowManagerV2.NodeTypeEnd},
+		},
+		Edges: []workflowManagerV2.Edge{
+			edge("e1", "start", "review"),
+			{ID: "e2", SourceID: "review", TargetID: "end_success", Condition: "outcome == 'approve'"},
+			{ID: "e3", SourceID: "review", TargetID: "end_rejected", Condition: "outcome == 'reject'"},
+		},
+	}
+	plain := template("wt-2", map[string]string{"inspect": "tt-inspect"},
+		edge("e1", "start", "inspect"), edge("e2", "inspect", "end"))
+
+	merged, err := mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-1", Definition: reviewed},
+		{Key: "flow2", TemplateID: "wt-2", Definition: plain},
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, merged.Nodes, workflowManagerV2.Node{ID: "merged_join_flow1", Type: nodeTypeGateway, GatewayType: gatewayTypeExclusiveJoin})
+	var intoJoin []string
+	for _, e := range merged.Edges {
+		if e.TargetID == "merged_join" {
+			intoJoin = append(intoJoin, e.SourceID)
+		}
+	}
+	assert.ElementsMatch(t, []string{"merged_join_flow1", "flow2__inspect"}, intoJoin,
+		"the parallel join waits for one edge per sub-flow")
+	assert.Contains(t, merged.Edges, workflowManagerV2.Edge{ID: "flow1__e3", SourceID: "flow1__review", TargetID: "merged_join_flow1", Condition: "outcome == 'reject'"})
+}
+
+func TestMergeSubFlows_DifferentMappingsAreNotShared(t *testing.T) {
+	mapped := func(id, outcomeKey string) workflowManagerV2.WorkflowDefinition {
+		def := template(id, nil, edge("e1", "start", "phyto"), edge("e2", "phyto", "end"))
+		def.Nodes = append(def.Nodes, workflowManagerV2.Node{
+			ID: "phyto", Type: workflowManagerV2.NodeTypeTask, TaskTemplateID: "tt-phyto",
+			OutputMapping: map[string]string{"outcome": outcomeKey},
+		})
+		return def
+	}
+
+	merged, err := mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-plant", Definition: mapped("wt-plant", "plant.phyto_outcome")},
+		{Key: "flow2", TemplateID: "wt-seed", Definition: mapped("wt-seed", "seed.phyto_outcome")},
+	})
+	require.NoError(t, err)
+	assert.Subset(t, nodeIDs(merged), []string{"flow1__phyto", "flow2__phyto"},
+		"each template's conditions read the key its own node writes")
+
+	merged, err = mergeSubFlows([]itemSubFlow{
+		{Key: "flow1", TemplateID: "wt-plant", Definition: mapped("wt-plant", "phyto_outcome")},
+		{Key: "flow2", TemplateID: "wt-seed", Definition: mapped("wt-seed", "phyto_outcome")},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, nodeIDs(merged), "flow1+flow2__phyto")
+}
+
+func TestTaskHSCodeIDs(t *testing.T) {
+	items := []Item{
+		{HSCodeID: "hs-tea", SubFlow: "flow1"},
+		{HSCodeID: "hs-spice", SubFlow: "flow1"},
+		{HSCodeID: "hs-fruit", SubFlow: "flow2"},
+	}
+	cases := map[string]struct {
+		task tfstore.TaskRecord
+		want []string
+	}{
+		"parent node":       {tfstore.TaskRecord{ParentNodeID: "flow2__npqs"}, []string{"hs-fruit"}},
+		"split task child":  {tfstore.TaskRecord{ParentNodeID: "branch", ParentWorkflowID: "cons-1--flow1__tea_board--b1"}, []string{"hs-tea", "hs-spice"}},
+		"unmerged template": {tfstore.TaskRecord{ParentNodeID: "node_5_phyto"}, []string{"hs-tea", "hs-spice", "hs-fruit"}},
+		"unknown sub-flow":  {tfstore.TaskRecord{ParentNodeID: "flow9__npqs"}, nil},
+		"shared task":       {tfstore.TaskRecord{ParentNodeID: "flow1+flow2__phyto"}, []string{"hs-tea", "hs-spice", "hs-fruit"}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, taskHSCodeIDs(tc.task, items))
+		})
+	}
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_task_records_v2_root_workflow_id;
+
+ALTER TABLE task_records_v2
+    DROP COLUMN IF EXISTS root_workflow_id;
@@ -0,0 +1,12 @@
+-- root_workflow_id is the top-level consignment ID a task belongs to. SPLIT_TASK
+-- child workflows carry a mangled parent_workflow_id ("{root}--{nodeID}--{branchID}"),
+-- so the root is stored explicitly for consignment-wide task lookups and
+-- ownership-scoped authorization.
+ALTER TABLE task_records_v2
+    ADD COLUMN IF NOT EXISTS root_workflow_id TEXT NOT NULL DEFAULT '';
+
+UPDATE task_records_v2
+SET root_workflow_id = split_part(parent_workflow_id, '--', 1)
+WHERE root_workflow_id = '' AND parent_workflow_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_task_records_v2_root_workflow_id ON task_records_v2(root_workflow_id);
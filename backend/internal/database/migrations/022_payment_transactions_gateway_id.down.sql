@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_payment_tx_gateway_id;
+
+ALTER TABLE payment_transactions
+    DROP COLUMN IF EXISTS gateway_id;
@@ -0,0 +1,13 @@
+-- payment_transactions becomes gateway-aware: every transaction records the
+-- payment gateway (registry method ID) that owns it, so validation and webhook
+-- requests arriving on /api/v1/payments/{gatewayId}/... can be matched to it.
+ALTER TABLE payment_transactions
+    ADD COLUMN IF NOT EXISTS gateway_id VARCHAR(100) NOT NULL DEFAULT '';
+
+-- Rows written by the legacy payment service kept the selected method only in
+-- gateway_metadata.method_id; the legacy default method was lankapay.
+UPDATE payment_transactions
+SET gateway_id = COALESCE(NULLIF(gateway_metadata ->> 'method_id', ''), 'lankapay')
+WHERE gateway_id = '';
+
+CREATE INDEX IF NOT EXISTS idx_payment_tx_gateway_id ON payment_transactions (gateway_id);
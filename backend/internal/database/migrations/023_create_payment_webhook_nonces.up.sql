@@ -0,0 +1,13 @@
+-- Nonces of authenticated payment webhook deliveries. A delivery whose
+-- (gateway_id, nonce) is already present is a replay and is rejected. Rows
+-- are only needed until expires_at: past it the gateway timestamp falls
+-- outside the tolerance window and the delivery is rejected anyway.
+CREATE TABLE IF NOT EXISTS payment_webhook_nonces (
+    gateway_id  VARCHAR(100) NOT NULL,
+    nonce       VARCHAR(255) NOT NULL,
+    expires_at  TIMESTAMPTZ  NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (gateway_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_webhook_nonces_expires_at ON payment_webhook_nonces (expires_at);
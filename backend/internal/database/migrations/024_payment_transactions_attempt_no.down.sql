@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_payment_tx_task_attempt;
+
+ALTER TABLE payment_transactions
+    DROP COLUMN IF EXISTS attempt_no;
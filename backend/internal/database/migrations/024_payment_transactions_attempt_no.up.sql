@@ -0,0 +1,16 @@
+-- A task may make several payment attempts, each with its own reference.
+-- attempt_no numbers them per task; the highest is the live attempt.
+ALTER TABLE payment_transactions
+    ADD COLUMN IF NOT EXISTS attempt_no INTEGER NOT NULL DEFAULT 1;
+
+-- Number any tasks that already have more than one row in creation order.
+UPDATE payment_transactions pt
+SET attempt_no = numbered.attempt_no
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY task_id ORDER BY created_at, id) AS attempt_no
+    FROM payment_transactions
+) numbered
+WHERE pt.id = numbered.id AND pt.attempt_no <> numbered.attempt_no;
+
+-- Also rejects the loser of two concurrent retries on the same task.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_tx_task_attempt ON payment_transactions (task_id, attempt_no);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_payment_tx_gateway_status_updated;
+DROP TABLE IF EXISTS payment_reconciliation_items;
+DROP TABLE IF EXISTS payment_reconciliation_runs;
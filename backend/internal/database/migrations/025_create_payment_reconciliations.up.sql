@@ -0,0 +1,39 @@
+-- Reconciliation of gateway settlement files against payment_transactions.
+-- A run is one uploaded settlement file; each item classifies one reference
+-- as MATCHED, MISSING_IN_NSW, MISSING_AT_GATEWAY or AMOUNT_MISMATCH.
+CREATE TABLE IF NOT EXISTS payment_reconciliation_runs (
+    id                  text         NOT NULL PRIMARY KEY,
+    gateway_id          VARCHAR(100) NOT NULL,
+    file_name           VARCHAR(255) NOT NULL DEFAULT '',
+    period_from         TIMESTAMPTZ  NOT NULL,
+    period_to           TIMESTAMPTZ  NOT NULL,
+    matched             INTEGER      NOT NULL DEFAULT 0,
+    missing_in_nsw      INTEGER      NOT NULL DEFAULT 0,
+    missing_at_gateway  INTEGER      NOT NULL DEFAULT 0,
+    amount_mismatch     INTEGER      NOT NULL DEFAULT 0,
+    created_by          VARCHAR(255) NOT NULL DEFAULT '',
+    created_at          TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_recon_runs_gateway_created ON payment_reconciliation_runs (gateway_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS payment_reconciliation_items (
+    id                      text          NOT NULL PRIMARY KEY,
+    run_id                  text          NOT NULL REFERENCES payment_reconciliation_runs (id) ON DELETE CASCADE,
+    result                  VARCHAR(50)   NOT NULL,
+    reference_number        VARCHAR(255)  NOT NULL,
+    task_id                 VARCHAR(255)  NOT NULL DEFAULT '',
+    nsw_status              VARCHAR(50)   NOT NULL DEFAULT '',
+    nsw_amount              NUMERIC(15, 2),
+    nsw_currency            VARCHAR(10)   NOT NULL DEFAULT '',
+    gateway_transaction_id  VARCHAR(255)  NOT NULL DEFAULT '',
+    gateway_amount          NUMERIC(15, 2),
+    gateway_currency        VARCHAR(10)   NOT NULL DEFAULT '',
+    settlement_line         INTEGER       NOT NULL DEFAULT 0,
+    note                    TEXT          NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_recon_items_run_id ON payment_reconciliation_items (run_id);
+
+-- Paid transactions of a gateway in a period are the reconciliation baseline.
+CREATE INDEX IF NOT EXISTS idx_payment_tx_gateway_status_updated ON payment_transactions (gateway_id, status, updated_at);
@@ -0,0 +1,28 @@
+-- Refunds of paid payment_transactions. A transaction may be refunded in
+-- several partial refunds, at most one of them PENDING at a time.
+CREATE TABLE IF NOT EXISTS payment_refunds (
+    id                 text          NOT NULL PRIMARY KEY,
+    transaction_id     text          NOT NULL REFERENCES payment_transactions (id),
+    reference_number   VARCHAR(255)  NOT NULL,
+    gateway_id         VARCHAR(100)  NOT NULL,
+    task_id            VARCHAR(255)  NOT NULL DEFAULT '',
+    amount             NUMERIC(15, 2) NOT NULL,
+    currency           VARCHAR(10)   NOT NULL,
+    reason             TEXT          NOT NULL DEFAULT '',
+    status             VARCHAR(50)   NOT NULL,
+    prior_status       VARCHAR(50)   NOT NULL,
+    manual             BOOLEAN       NOT NULL DEFAULT false,
+    instructions       TEXT          NOT NULL DEFAULT '',
+    gateway_refund_id  VARCHAR(255)  NOT NULL DEFAULT '',
+    note               TEXT          NOT NULL DEFAULT '',
+    requested_by       VARCHAR(255)  NOT NULL DEFAULT '',
+    completed_by       VARCHAR(255)  NOT NULL DEFAULT '',
+    created_at         TIMESTAMPTZ   NOT NULL DEFAULT now(),
+    updated_at         TIMESTAMPTZ   NOT NULL DEFAULT now(),
+    completed_at       TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_refunds_transaction_status ON payment_refunds (transaction_id, status);
+
+-- Finance works the PENDING refunds queue oldest first.
+CREATE INDEX IF NOT EXISTS idx_payment_refunds_status_created ON payment_refunds (status, created_at);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS payment_line_items;
+
+-- Cart transactions cannot be represented without consignment_id.
+DELETE FROM payment_transactions WHERE consignment_id <> '';
+
+DROP INDEX IF EXISTS idx_payment_tx_cart_attempt;
+DROP INDEX IF EXISTS idx_payment_tx_task_attempt;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_tx_task_attempt ON payment_transactions (task_id, attempt_no);
+
+ALTER TABLE payment_transactions
+    DROP COLUMN IF EXISTS consignment_id;
@@ -0,0 +1,32 @@
+-- A consolidated (cart) transaction pays several PAYMENT tasks of one
+-- consignment under one reference. It has no task_id of its own and numbers
+-- its attempts per consignment instead.
+ALTER TABLE payment_transactions
+    ADD COLUMN IF NOT EXISTS consignment_id VARCHAR(255) NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_payment_tx_task_attempt;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_tx_task_attempt ON payment_transactions (task_id, attempt_no)
+    WHERE consignment_id = '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_tx_cart_attempt ON payment_transactions (consignment_id, attempt_no)
+    WHERE consignment_id <> '';
+
+-- One row per carted task fee. transaction_id is the consolidated transaction
+-- the item is checked out in or paid by, '' while OPEN.
+CREATE TABLE IF NOT EXISTS payment_line_items (
+    id              text           NOT NULL PRIMARY KEY,
+    consignment_id  VARCHAR(255)   NOT NULL,
+    task_id         VARCHAR(255)   NOT NULL,
+    task_code       VARCHAR(255)   NOT NULL DEFAULT '',
+    description     TEXT           NOT NULL DEFAULT '',
+    amount          NUMERIC(15, 2) NOT NULL,
+    currency        VARCHAR(10)    NOT NULL,
+    status          VARCHAR(50)    NOT NULL,
+    transaction_id  text           NOT NULL DEFAULT '',
+    notified_at     TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ    NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ    NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_line_items_task_id ON payment_line_items (task_id);
+CREATE INDEX IF NOT EXISTS idx_payment_line_items_consignment_status ON payment_line_items (consignment_id, status);
+CREATE INDEX IF NOT EXISTS idx_payment_line_items_transaction_id ON payment_line_items (transaction_id);
@@ -0,0 +1,2 @@
+ALTER TABLE payment_line_items DROP COLUMN IF EXISTS oga_name;
+DROP TABLE IF EXISTS payment_receipts;
@@ -0,0 +1,20 @@
+-- Official receipts issued for paid payment_transactions, one per transaction.
+-- The PDF itself lives in object storage under storage_key; verification_code
+-- is printed on it (and in its QR code) so a third party can confirm it.
+CREATE TABLE IF NOT EXISTS payment_receipts (
+    id                      text          NOT NULL PRIMARY KEY,
+    transaction_id          text          NOT NULL UNIQUE REFERENCES payment_transactions (id),
+    reference_number        VARCHAR(255)  NOT NULL,
+    verification_code       VARCHAR(64)   NOT NULL UNIQUE,
+    storage_key             TEXT          NOT NULL,
+    payer_name              TEXT          NOT NULL DEFAULT '',
+    oga_name                TEXT          NOT NULL DEFAULT '',
+    amount                  NUMERIC(15, 2) NOT NULL,
+    currency                VARCHAR(10)   NOT NULL,
+    gateway_transaction_id  VARCHAR(255)  NOT NULL DEFAULT '',
+    paid_at                 TIMESTAMPTZ   NOT NULL,
+    created_at              TIMESTAMPTZ   NOT NULL DEFAULT now()
+);
+
+-- The OGA collecting each carted fee, named per line on a cart's receipt.
+ALTER TABLE payment_line_items ADD COLUMN IF NOT EXISTS oga_name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+ALTER TABLE consignments DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE consignments DROP COLUMN IF EXISTS cancelled_by;
+ALTER TABLE consignments DROP COLUMN IF EXISTS cancel_reason;
+
+ALTER TABLE consignments DROP CONSTRAINT IF EXISTS consignments_state_check;
+ALTER TABLE consignments ADD CONSTRAINT consignments_state_check
+    CHECK ((state)::text = ANY (ARRAY['INITIALIZED'::character varying, 'IN_PROGRESS'::character varying, 'FINISHED'::character varying]));
@@ -0,0 +1,12 @@
+-- Consignments withdrawn by their trader. CANCELLED is terminal; the reason
+-- and the cancelling user are kept for the OGA notifications and the audit trail.
+ALTER TABLE consignments DROP CONSTRAINT IF EXISTS consignments_state_check;
+ALTER TABLE consignments ADD CONSTRAINT consignments_state_check
+    CHECK ((state)::text = ANY (ARRAY['INITIALIZED'::character varying, 'IN_PROGRESS'::character varying, 'FINISHED'::character varying, 'CANCELLED'::character varying]));
+
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS cancel_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS cancelled_by VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN consignments.cancel_reason IS 'Reason given by the trader when withdrawing the consignment';
+COMMENT ON COLUMN consignments.cancelled_by IS 'Trader user who cancelled the consignment';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_consignments_failed_at;
+ALTER TABLE consignments DROP COLUMN IF EXISTS failed_at;
+ALTER TABLE consignments DROP COLUMN IF EXISTS failure_reason;
+
+ALTER TABLE consignments DROP CONSTRAINT IF EXISTS consignments_state_check;
+ALTER TABLE consignments ADD CONSTRAINT consignments_state_check
+    CHECK ((state)::text = ANY (ARRAY['INITIALIZED'::character varying, 'IN_PROGRESS'::character varying, 'FINISHED'::character varying, 'CANCELLED'::character varying]));
@@ -0,0 +1,16 @@
+-- Consignments whose workflow can no longer progress. FAILED: the parent
+-- workflow failed, timed out or was terminated. STALLED: the parent workflow
+-- is running but waits on a task that failed. Both are cleared by a support
+-- retry, which puts the consignment back IN_PROGRESS.
+ALTER TABLE consignments DROP CONSTRAINT IF EXISTS consignments_state_check;
+ALTER TABLE consignments ADD CONSTRAINT consignments_state_check
+    CHECK ((state)::text = ANY (ARRAY['INITIALIZED'::character varying, 'IN_PROGRESS'::character varying, 'FINISHED'::character varying, 'CANCELLED'::character varying, 'FAILED'::character varying, 'STALLED'::character varying]));
+
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS failure_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS failed_at TIMESTAMPTZ;
+
+-- Operations list stuck consignments across all companies.
+CREATE INDEX IF NOT EXISTS idx_consignments_failed_at ON consignments (failed_at) WHERE state IN ('FAILED', 'STALLED');
+
+COMMENT ON COLUMN consignments.failure_reason IS 'Why the consignment''s workflow stopped progressing';
+COMMENT ON COLUMN consignments.failed_at IS 'When the consignment was found FAILED or STALLED';
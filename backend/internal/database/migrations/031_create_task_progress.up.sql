@@ -0,0 +1,28 @@
+-- task_progress projects task_records_v2 onto one row per root workflow (the
+-- consignment), so consignment listings read progress in the same query. The
+-- task store rewrites a row whenever a task of that workflow is saved; the
+-- buckets below must match taskv2/store.TaskProgress. SYSTEM tasks are not
+-- counted; FAILED and CANCELLED tasks count towards total only.
+CREATE TABLE IF NOT EXISTS task_progress (
+    root_workflow_id TEXT PRIMARY KEY,
+    total            INTEGER NOT NULL DEFAULT 0,
+    completed        INTEGER NOT NULL DEFAULT 0,
+    in_progress      INTEGER NOT NULL DEFAULT 0,
+    awaiting_trader  INTEGER NOT NULL DEFAULT 0,
+    awaiting_oga     INTEGER NOT NULL DEFAULT 0,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO task_progress (root_workflow_id, total, completed, in_progress, awaiting_trader, awaiting_oga)
+SELECT root_workflow_id,
+       count(*),
+       count(*) FILTER (WHERE state = 'COMPLETED'),
+       count(*) FILTER (WHERE state IS NULL OR state NOT IN ('COMPLETED', 'PENDING_USER', 'PENDING_PAYMENT', 'QUEUED_EXTERNALLY', 'FAILED', 'CANCELLED')),
+       count(*) FILTER (WHERE state IN ('PENDING_USER', 'PENDING_PAYMENT')),
+       count(*) FILTER (WHERE state = 'QUEUED_EXTERNALLY')
+FROM task_records_v2
+WHERE root_workflow_id <> '' AND task_type IS DISTINCT FROM 'SYSTEM'
+GROUP BY root_workflow_id
+ON CONFLICT (root_workflow_id) DO NOTHING;
+
+COMMENT ON TABLE task_progress IS 'Per-consignment task counts projected from task_records_v2';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS consignment_amendments;
+
+ALTER TABLE consignments DROP COLUMN IF EXISTS workflow_definition;
+ALTER TABLE consignments DROP COLUMN IF EXISTS global_context;
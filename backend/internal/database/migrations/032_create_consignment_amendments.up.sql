@@ -0,0 +1,28 @@
+-- Amendments let a trader correct the workflow's global context after the
+-- consignment has started. The consignment keeps its own copy of that context
+-- (the start variables plus what its tasks wrote through their output
+-- mappings) and of the parent workflow definition, whose input mappings tell
+-- which tasks consumed an amended key. Consignments started before this
+-- migration have neither and cannot be amended.
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS global_context JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS workflow_definition JSONB;
+
+COMMENT ON COLUMN consignments.global_context IS 'Global variables of the consignment''s workflow, as started, written by its tasks and amended';
+COMMENT ON COLUMN consignments.workflow_definition IS 'Parent workflow definition the consignment was started with';
+
+-- One row per amendment: the keys changed with their values before and after,
+-- and the completed tasks re-opened or sent back to their OGA because of it.
+CREATE TABLE IF NOT EXISTS consignment_amendments (
+    id              text          NOT NULL PRIMARY KEY,
+    consignment_id  text          NOT NULL REFERENCES consignments (id),
+    amended_by      VARCHAR(100)  NOT NULL,
+    reason          TEXT          NOT NULL DEFAULT '',
+    changes         JSONB         NOT NULL,
+    tasks           JSONB         NOT NULL DEFAULT '[]'::jsonb,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_consignment_amendments_consignment_id
+    ON consignment_amendments (consignment_id, created_at);
+
+COMMENT ON TABLE consignment_amendments IS 'History of global context amendments made to consignments after submission';
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_hs_codes_hs_code_pattern;
+DROP INDEX IF EXISTS idx_consignments_trader_reference;
+DROP INDEX IF EXISTS idx_consignments_id_pattern;
+DROP INDEX IF EXISTS idx_consignments_finished_at_id;
+DROP INDEX IF EXISTS idx_consignments_updated_at_id;
+DROP INDEX IF EXISTS idx_consignments_created_at_id;
+DROP INDEX IF EXISTS idx_consignments_cha_company_finished;
+DROP INDEX IF EXISTS idx_consignments_cha_company_updated;
+DROP INDEX IF EXISTS idx_consignments_cha_company_created;
+DROP INDEX IF EXISTS idx_consignments_trader_company_finished;
+DROP INDEX IF EXISTS idx_consignments_trader_company_updated;
+DROP INDEX IF EXISTS idx_consignments_trader_company_created;
+
+ALTER TABLE consignments DROP COLUMN IF EXISTS finished_at;
+ALTER TABLE consignments DROP COLUMN IF EXISTS trader_reference;
@@ -0,0 +1,29 @@
+-- Consignment search: the trader's own reference number, when the workflow
+-- finished, and the indexes behind the list filters and keyset pagination.
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS trader_reference VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE consignments ADD COLUMN IF NOT EXISTS finished_at TIMESTAMPTZ;
+
+-- Keyset pages are ordered by (sort column, id) within the trader or CHA
+-- company; support staff list across companies.
+CREATE INDEX IF NOT EXISTS idx_consignments_trader_company_created ON consignments (trader_company_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_consignments_trader_company_updated ON consignments (trader_company_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_consignments_trader_company_finished ON consignments (trader_company_id, finished_at, id) WHERE finished_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_consignments_cha_company_created ON consignments (cha_company_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_consignments_cha_company_updated ON consignments (cha_company_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_consignments_cha_company_finished ON consignments (cha_company_id, finished_at, id) WHERE finished_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_consignments_created_at_id ON consignments (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_consignments_updated_at_id ON consignments (updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_consignments_finished_at_id ON consignments (finished_at, id) WHERE finished_at IS NOT NULL;
+
+-- Free-text search matches prefixes of the ID and, case-insensitively, the
+-- trader reference; HS code filters match prefixes of the code.
+CREATE INDEX IF NOT EXISTS idx_consignments_id_pattern ON consignments (id text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_consignments_trader_reference ON consignments (lower(trader_reference) text_pattern_ops) WHERE trader_reference <> '';
+CREATE INDEX IF NOT EXISTS idx_hs_codes_hs_code_pattern ON hs_codes (hs_code text_pattern_ops);
+
+-- Consignments that finished before this migration keep their last update as
+-- the finish time.
+UPDATE consignments SET finished_at = updated_at WHERE state = 'FINISHED' AND finished_at IS NULL;
+
+COMMENT ON COLUMN consignments.trader_reference IS 'The trader''s own reference number for the consignment';
+COMMENT ON COLUMN consignments.finished_at IS 'When the consignment''s workflow completed';
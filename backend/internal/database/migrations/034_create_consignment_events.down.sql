@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS consignment_events_append_only ON consignment_events;
+DROP FUNCTION IF EXISTS reject_consignment_event_change();
+DROP TABLE IF EXISTS consignment_events;
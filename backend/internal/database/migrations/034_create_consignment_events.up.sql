@@ -0,0 +1,34 @@
+-- The consignment timeline: one row per thing that happened on a consignment
+-- (a task activated or changing state, a step submitted by the trader, an OGA
+-- callback, a payment status change, a consignment state change or an
+-- amendment), with who did it and when. Task events are written for every
+-- root workflow, so consignment_id carries no foreign key.
+CREATE TABLE IF NOT EXISTS consignment_events (
+    id              BIGSERIAL     PRIMARY KEY,
+    consignment_id  text          NOT NULL,
+    type            VARCHAR(50)   NOT NULL,
+    task_id         text          NOT NULL DEFAULT '',
+    actor           VARCHAR(100)  NOT NULL DEFAULT '',
+    from_state      VARCHAR(50)   NOT NULL DEFAULT '',
+    to_state        VARCHAR(50)   NOT NULL DEFAULT '',
+    details         JSONB,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_consignment_events_consignment_id
+    ON consignment_events (consignment_id, id);
+
+-- The log is append-only.
+CREATE OR REPLACE FUNCTION reject_consignment_event_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'consignment_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS consignment_events_append_only ON consignment_events;
+CREATE TRIGGER consignment_events_append_only
+    BEFORE UPDATE OR DELETE ON consignment_events
+    FOR EACH ROW EXECUTE FUNCTION reject_consignment_event_change();
+
+COMMENT ON TABLE consignment_events IS 'Append-only timeline of what happened on each consignment';
+COMMENT ON COLUMN consignment_events.actor IS 'User or machine client that caused the event; empty for the platform';
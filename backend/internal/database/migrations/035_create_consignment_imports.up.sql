@@ -0,0 +1,26 @@
+-- Bulk consignment imports: a CSV or XLSX file of consignment shells queued by a
+-- trader and run in the background. rows holds the outcome of every row of the
+-- file once the import has run.
+CREATE TABLE IF NOT EXISTS consignment_imports (
+    id                 text          PRIMARY KEY,
+    trader_id          text          NOT NULL,
+    trader_company_id  text          NOT NULL,
+    file_key           text          NOT NULL,
+    auto_start         BOOLEAN       NOT NULL DEFAULT false,
+    status             VARCHAR(20)   NOT NULL DEFAULT 'PENDING',
+    total_rows         INTEGER       NOT NULL DEFAULT 0,
+    created_count      INTEGER       NOT NULL DEFAULT 0,
+    started_count      INTEGER       NOT NULL DEFAULT 0,
+    failed_count       INTEGER       NOT NULL DEFAULT 0,
+    rows               JSONB,
+    error              text          NOT NULL DEFAULT '',
+    created_at         TIMESTAMPTZ   NOT NULL DEFAULT now(),
+    started_at         TIMESTAMPTZ,
+    finished_at        TIMESTAMPTZ,
+    CONSTRAINT chk_consignment_imports_status
+        CHECK (status IN ('PENDING', 'RUNNING', 'COMPLETED', 'FAILED'))
+);
+
+-- The importer claims the oldest pending job.
+CREATE INDEX IF NOT EXISTS idx_consignment_imports_status_created_at
+    ON consignment_imports (status, created_at);
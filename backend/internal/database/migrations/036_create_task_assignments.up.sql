@@ -0,0 +1,19 @@
+-- task_assignments records which OGA officer is handling an external review.
+-- Reviews are dispatched to an agency as a whole; an officer of that agency
+-- claims one from the agency's queue, or a supervisor assigns it. service_id
+-- is the agency the task was dispatched to; officer_id and assigned_by are
+-- officer identities asserted by the agency's system, which NSW does not
+-- manage.
+CREATE TABLE IF NOT EXISTS task_assignments (
+    task_id      TEXT         PRIMARY KEY REFERENCES task_records_v2 (task_id) ON DELETE CASCADE,
+    service_id   TEXT         NOT NULL,
+    officer_id   VARCHAR(100) NOT NULL,
+    assigned_by  VARCHAR(100) NOT NULL,
+    assigned_at  TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+-- Workload counts and officer queues group an agency's assignments by officer.
+CREATE INDEX IF NOT EXISTS idx_task_assignments_service_officer
+    ON task_assignments (service_id, officer_id);
+
+COMMENT ON TABLE task_assignments IS 'OGA officer assignments of externally reviewed tasks';
@@ -0,0 +1,5 @@
+UPDATE consignments SET state = 'CANCELLED' WHERE state = 'CANCELLING';
+
+ALTER TABLE consignments DROP CONSTRAINT IF EXISTS consignments_state_check;
+ALTER TABLE consignments ADD CONSTRAINT consignments_state_check
+    CHECK ((state)::text = ANY (ARRAY['INITIALIZED'::character varying, 'IN_PROGRESS'::character varying, 'FINISHED'::character varying, 'CANCELLED'::character varying, 'FAILED'::character varying, 'STALLED'::character varying]));
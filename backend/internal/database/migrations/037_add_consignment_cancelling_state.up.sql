@@ -0,0 +1,6 @@
+-- Consignments being withdrawn by their trader. CANCELLING is recorded before
+-- the consignment's workflows are cancelled and becomes CANCELLED once they
+-- are; a consignment left CANCELLING is finished by cancelling it again.
+ALTER TABLE consignments DROP CONSTRAINT IF EXISTS consignments_state_check;
+ALTER TABLE consignments ADD CONSTRAINT consignments_state_check
+    CHECK ((state)::text = ANY (ARRAY['INITIALIZED'::character varying, 'IN_PROGRESS'::character varying, 'FINISHED'::character varying, 'CANCELLING'::character varying, 'CANCELLED'::character varying, 'FAILED'::character varying, 'STALLED'::character varying]));
@@ -0,0 +1,2 @@
+ALTER TABLE task_assignments DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE task_assignments DROP COLUMN IF EXISTS completed_by;
@@ -0,0 +1,6 @@
+-- The officer who decided a review, recorded once the decision is applied. A
+-- review decided without being claimed is assigned to its deciding officer.
+ALTER TABLE task_assignments ADD COLUMN IF NOT EXISTS completed_by VARCHAR(100);
+ALTER TABLE task_assignments ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN task_assignments.completed_by IS 'Officer whose decision completed the review';
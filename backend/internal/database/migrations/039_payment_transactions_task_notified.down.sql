@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_payment_tx_pending_notification;
+
+ALTER TABLE payment_transactions
+    DROP COLUMN IF EXISTS task_notified_at;
@@ -0,0 +1,11 @@
+-- When the task step of a settled single-task payment was completed with its
+-- outcome. Settled payments left NULL are re-driven by the expiry sweeper;
+-- those settled before this column existed are taken as notified.
+ALTER TABLE payment_transactions
+    ADD COLUMN IF NOT EXISTS task_notified_at TIMESTAMPTZ;
+
+UPDATE payment_transactions SET task_notified_at = updated_at
+    WHERE consignment_id = '' AND status <> 'PENDING' AND task_notified_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_payment_tx_pending_notification ON payment_transactions (updated_at)
+    WHERE consignment_id = '' AND task_notified_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE payment_refunds
+    DROP COLUMN IF EXISTS gateway_error;
@@ -0,0 +1,4 @@
+-- The error of a refund's last gateway call whose outcome is unknown. Such a
+-- refund stays PENDING and is resent under the same ID by the next request.
+ALTER TABLE payment_refunds
+    ADD COLUMN IF NOT EXISTS gateway_error TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- The organisation each storage upload was prepared for, so that a service
+-- handed a file key (such as a bulk consignment import) can check that the
+-- file is the caller's.
+CREATE TABLE IF NOT EXISTS storage_uploads (
+    key        TEXT PRIMARY KEY,
+    ou_handle  TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -11,6 +11,27 @@ MIGRATION_DB_HOST="${MIGRATION_DB_HOST:-$DB_HOST}"
 MIGRATION_DB_HOST="${MIGRATION_DB_HOST//host.docker.internal/localhost}"
 
 DOWNS=(
+  "041_create_storage_uploads.down.sql"
+  "040_payment_refunds_gateway_error.down.sql"
+  "039_payment_transactions_task_notified.down.sql"
+  "038_task_assignments_completed_by.down.sql"
+  "037_add_consignment_cancelling_state.down.sql"
+  "036_create_task_assignments.down.sql"
+  "035_create_consignment_imports.down.sql"
+  "034_create_consignment_events.down.sql"
+  "033_add_consignment_search.down.sql"
+  "032_create_consignment_amendments.down.sql"
+  "031_create_task_progress.down.sql"
+  "030_add_consignment_failure_states.down.sql"
+  "029_add_consignment_cancellation.down.sql"
+  "028_create_payment_receipts.down.sql"
+  "027_create_payment_line_items.down.sql"
+  "026_create_payment_refunds.down.sql"
+  "025_create_payment_reconciliations.down.sql"
+  "024_payment_transactions_attempt_no.down.sql"
+  "023_create_payment_webhook_nonces.down.sql"
+  "022_payment_transactions_gateway_id.down.sql"
+  "021_task_records_v2_root_workflow_id.down.sql"
   "020_fcau_health_certificate_workflow_seed.down.sql"
   "019_create_task_records_v2.down.sql"
   "016_create_company_records.down.sql"
@@ -60,6 +60,27 @@ MIGRATIONS=(
     "016_create_company_records.up.sql"
     "019_create_task_records_v2.up.sql"
     "020_fcau_health_certificate_workflow_seed.up.sql"
+    "021_task_records_v2_root_workflow_id.up.sql"
+    "022_payment_transactions_gateway_id.up.sql"
+    "023_create_payment_webhook_nonces.up.sql"
+    "024_payment_transactions_attempt_no.up.sql"
+    "025_create_payment_reconciliations.up.sql"
+    "026_create_payment_refunds.up.sql"
+    "027_create_payment_line_items.up.sql"
+    "028_create_payment_receipts.up.sql"
+    "029_add_consignment_cancellation.up.sql"
+    "030_add_consignment_failure_states.up.sql"
+    "031_create_task_progress.up.sql"
+    "032_create_consignment_amendments.up.sql"
+    "033_add_consignment_search.up.sql"
+    "034_create_consignment_events.up.sql"
+    "035_create_consignment_imports.up.sql"
+    "036_create_task_assignments.up.sql"
+    "037_add_consignment_cancelling_state.up.sql"
+    "038_task_assignments_completed_by.up.sql"
+    "039_payment_transactions_task_notified.up.sql"
+    "040_payment_refunds_gateway_error.up.sql"
+    "041_create_storage_uploads.up.sql"
 )
 
 echo "Starting database migrations..."
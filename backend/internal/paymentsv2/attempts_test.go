@@ -0,0 +1,193 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func sessionGateway() *MockGateway {
+	gw := new(MockGateway)
+	gw.On("CreateSession", mock.Anything, mock.Anything).Return(&gateways.SessionResponse{SessionID: "sess"}, nil)
+	return gw
+}
+
+func TestCreateCheckoutSession_FirstAttempt(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewPaymentService(repo, &mockRegistry{gw: sessionGateway()})
+
+	resp, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.AttemptNo)
+	assert.Equal(t, 1, repo.txs[resp.ReferenceNumber].AttemptNo)
+}
+
+func TestCreateCheckoutSession_RetrySupersedesPendingAttempt(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewPaymentService(repo, &mockRegistry{gw: sessionGateway()})
+
+	first, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.NoError(t, err)
+	second, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.ReferenceNumber, second.ReferenceNumber)
+	assert.Equal(t, 2, second.AttemptNo)
+	assert.Equal(t, PaymentStatusSuperseded, repo.txs[first.ReferenceNumber].Status)
+	assert.Equal(t, PaymentStatusPending, repo.txs[second.ReferenceNumber].Status)
+
+	latest, err := svc.GetLatestAttempt(context.Background(), "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, second.ReferenceNumber, latest.ReferenceNumber)
+
+	attempts, err := svc.ListAttempts(context.Background(), "task-1")
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, first.ReferenceNumber, attempts[0].ReferenceNumber)
+}
+
+func TestCreateCheckoutSession_RetryAfterFailureKeepsHistory(t *testing.T) {
+	repo := newMockRepo()
+	expired := pendingTx()
+	expired.TaskID = "task-1"
+	expired.AttemptNo = 1
+	expired.Status = PaymentStatusExpired
+	repo.txs[expired.ReferenceNumber] = expired
+	svc := NewPaymentService(repo, &mockRegistry{gw: sessionGateway()})
+
+	resp, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.AttemptNo)
+	assert.Equal(t, PaymentStatusExpired, repo.txs[expired.ReferenceNumber].Status, "closed attempts keep their status")
+}
+
+func TestCreateCheckoutSession_AlreadyPaid(t *testing.T) {
+	repo := newMockRepo()
+	paid := pendingTx()
+	paid.TaskID = "task-1"
+	paid.AttemptNo = 1
+	paid.Status = PaymentStatusSuccess
+	repo.txs[paid.ReferenceNumber] = paid
+	gw := new(MockGateway)
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	_, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.ErrorIs(t, err, ErrAlreadyPaid)
+	assert.Len(t, repo.txs, 1)
+	gw.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+}
+
+func TestCreateCheckoutSession_GatewayErrorKeepsPredecessorPayable(t *testing.T) {
+	repo := newMockRepo()
+	pending := pendingTx()
+	pending.TaskID = "task-1"
+	pending.AttemptNo = 1
+	repo.txs[pending.ReferenceNumber] = pending
+	gw := new(MockGateway)
+	gw.On("CreateSession", mock.Anything, mock.Anything).Return(nil, errors.New("boom"))
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	_, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.Error(t, err)
+	require.Len(t, repo.txs, 2)
+	assert.Equal(t, PaymentStatusPending, repo.txs[pending.ReferenceNumber].Status, "the earlier attempt must not be superseded")
+
+	current, err := svc.GetLatestAttempt(context.Background(), "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, pending.ReferenceNumber, current.ReferenceNumber, "a failed attempt is never current")
+
+	vgw := validateGateway(pending.ReferenceNumber)
+	vgw.On("HandleValidateReference", mock.Anything, mock.Anything, true, mock.Anything).
+		Return(&gateways.ValidationResponse{HTTPStatus: 200}, nil)
+	_, err = NewPaymentService(repo, &mockRegistry{gw: vgw}).ValidateReference(context.Background(), "govpay", []byte(`{}`))
+	require.NoError(t, err)
+	vgw.AssertExpectations(t)
+}
+
+func TestCreateCheckoutSession_PredecessorPaidDuringSession(t *testing.T) {
+	repo := newMockRepo()
+	pending := pendingTx()
+	pending.TaskID = "task-1"
+	pending.AttemptNo = 1
+	repo.txs[pending.ReferenceNumber] = pending
+	gw := new(MockGateway)
+	gw.On("CreateSession", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { pending.Status = PaymentStatusSuccess }).
+		Return(&gateways.SessionResponse{SessionID: "sess"}, nil)
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	_, err := svc.CreateCheckoutSession(context.Background(), validCheckoutReq())
+	require.ErrorIs(t, err, ErrAlreadyPaid)
+	for _, tx := range repo.txs {
+		if tx.AttemptNo == 2 {
+			assert.Equal(t, PaymentStatusSuperseded, tx.Status, "the new reference must not stay payable")
+		}
+	}
+}
+
+func TestValidateReference_OnlyLatestAttemptPayable(t *testing.T) {
+	repo := newMockRepo()
+	// A PENDING row that is not the task's latest attempt, as if superseding
+	// it had been missed; it must still not be payable.
+	old := &PaymentTransaction{ReferenceNumber: "TNSWOLD", TaskID: "task-1", AttemptNo: 1, GatewayID: "govpay",
+		Status: PaymentStatusPending, ExpiryDate: time.Now().Add(time.Hour)}
+	current := &PaymentTransaction{ReferenceNumber: "TNSWNEW", TaskID: "task-1", AttemptNo: 2, GatewayID: "govpay",
+		Status: PaymentStatusPending, ExpiryDate: time.Now().Add(time.Hour)}
+	repo.txs[old.ReferenceNumber] = old
+	repo.txs[current.ReferenceNumber] = current
+
+	for ref, payable := range map[string]bool{"TNSWOLD": false, "TNSWNEW": true} {
+		t.Run(ref, func(t *testing.T) {
+			gw := validateGateway(ref)
+			gw.On("HandleValidateReference", mock.Anything, mock.Anything, payable, mock.Anything).
+				Return(&gateways.ValidationResponse{HTTPStatus: 200}, nil)
+			svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+			_, err := svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+			require.NoError(t, err)
+			gw.AssertExpectations(t)
+		})
+	}
+}
+
+func TestValidateReference_SupersededNotPayable(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.Status = PaymentStatusSuperseded
+	repo.txs[tx.ReferenceNumber] = tx
+	gw := validateGateway(tx.ReferenceNumber)
+	gw.On("HandleValidateReference", mock.Anything, mock.Anything, false, mock.Anything).
+		Return(&gateways.ValidationResponse{HTTPStatus: 200}, nil)
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	_, err := svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+	require.NoError(t, err)
+	gw.AssertExpectations(t)
+}
+
+func TestProcessWebhook_LateSuccessOnSupersededRequiresRefund(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.Status = PaymentStatusSuperseded
+	repo.txs[tx.ReferenceNumber] = tx
+	gw := webhookGateway(&gateways.WebhookPayload{
+		ReferenceNumber: tx.ReferenceNumber,
+		Status:          gateways.WebhookStatusSuccess,
+		Amount:          decimal.RequireFromString("1500.00"),
+		Currency:        "LKR",
+	})
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+	svc.SetTaskCompleter(tc)
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	assert.Equal(t, PaymentStatusRefundRequired, repo.txs[tx.ReferenceNumber].Status)
+	assert.Empty(t, tc.calls)
+}
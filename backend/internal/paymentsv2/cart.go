@@ -0,0 +1,377 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// cartCheckoutTTL is how long a consolidated reference stays payable.
+const cartCheckoutTTL = 24 * time.Hour
+
+// ErrCartEmpty indicates a cart checkout for a consignment with no open line
+// items.
+var ErrCartEmpty = errors.New("payment cart is empty")
+
+// ErrCartCurrencyMismatch indicates a cart whose open line items are in more
+// than one currency, which no single reference can pay.
+var ErrCartCurrencyMismatch = errors.New("payment cart mixes currencies")
+
+// LineItemStatus is the lifecycle state of a PaymentLineItem.
+type LineItemStatus string
+
+const (
+	// LineItemStatusOpen is a fee waiting in the cart.
+	LineItemStatusOpen LineItemStatus = "OPEN"
+	// LineItemStatusCheckedOut is a fee included in a pending consolidated
+	// transaction. It goes back to OPEN if that transaction fails, expires or
+	// is superseded.
+	LineItemStatusCheckedOut LineItemStatus = "CHECKED_OUT"
+	// LineItemStatusPaid is a fee settled by a consolidated transaction.
+	LineItemStatusPaid LineItemStatus = "PAID"
+)
+
+// PaymentLineItem is one PAYMENT task's fee in its consignment's payment cart.
+// A task has at most one line item.
+type PaymentLineItem struct {
+	ID            string          `json:"id" gorm:"type:text;not null;primaryKey"`
+	ConsignmentID string          `json:"consignment_id"`
+	TaskID        string          `json:"task_id" gorm:"uniqueIndex"`
+	TaskCode      string          `json:"task_code"`
+	Description   string          `json:"description"`
+	OGAName       string          `json:"oga_name,omitempty"` // The OGA collecting the fee, named on the receipt
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	Status        LineItemStatus  `json:"status"`
+	// TransactionID is the consolidated transaction the item is checked out
+	// in or paid by; empty while OPEN.
+	TransactionID string `json:"transaction_id,omitempty"`
+	// NotifiedAt is set once the task step has been completed after payment.
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName pins the table created by migration 027.
+func (PaymentLineItem) TableName() string { return "payment_line_items" }
+
+// AddToCartRequest puts a task's fee into its consignment's payment cart.
+type AddToCartRequest struct {
+	ConsignmentID string
+	TaskID        string
+	TaskCode      string
+	Description   string
+	OGAName       string
+	Amount        decimal.Decimal
+	Currency      string
+}
+
+func (r AddToCartRequest) validate() error {
+	if r.ConsignmentID == "" {
+		return errors.New("consignment_id is required")
+	}
+	if r.TaskID == "" {
+		return errors.New("task_id is required")
+	}
+	if !r.Amount.IsPositive() {
+		return errors.New("amount must be greater than zero")
+	}
+	if r.Currency == "" {
+		return errors.New("currency is required")
+	}
+	return nil
+}
+
+// Cart is a consignment's unpaid line items.
+type Cart struct {
+	ConsignmentID string            `json:"consignment_id"`
+	Items         []PaymentLineItem `json:"items"`
+	// Total and Currency are set when every item is in the same currency.
+	Total    decimal.Decimal `json:"total"`
+	Currency string          `json:"currency,omitempty"`
+	// Attempt is the cart's latest consolidated transaction, if it was ever
+	// checked out.
+	Attempt *PaymentTransaction `json:"attempt,omitempty"`
+}
+
+// CartCheckoutRequest pays a consignment's open line items under one reference.
+type CartCheckoutRequest struct {
+	ConsignmentID      string `json:"-"`
+	GatewayID          string `json:"gateway_id"`
+	SuccessRedirectURL string `json:"success_redirect_url,omitempty"`
+	CancelRedirectURL  string `json:"cancel_redirect_url,omitempty"`
+}
+
+func (s *paymentService) AddToCart(ctx context.Context, req AddToCartRequest) (*PaymentLineItem, error) {
+	if err := req.validate(); err != nil {
+		return nil, fmt.Errorf("invalid cart item: %w", err)
+	}
+
+	var item *PaymentLineItem
+	err := s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		existing, err := repo.GetLineItemByTaskIDForUpdate(ctx, req.TaskID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve line item: %w", err)
+		}
+		if existing == nil {
+			item = &PaymentLineItem{
+				ID:            uuid.NewString(),
+				ConsignmentID: req.ConsignmentID,
+				TaskID:        req.TaskID,
+				TaskCode:      req.TaskCode,
+				Description:   req.Description,
+				OGAName:       req.OGAName,
+				Amount:        req.Amount,
+				Currency:      req.Currency,
+				Status:        LineItemStatusOpen,
+			}
+			if err := repo.CreateLineItem(ctx, item); err != nil {
+				return fmt.Errorf("failed to save line item: %w", err)
+			}
+			return nil
+		}
+
+		item = existing
+		switch existing.Status {
+		case LineItemStatusPaid:
+			return fmt.Errorf("task %s: %w", req.TaskID, ErrAlreadyPaid)
+		case LineItemStatusCheckedOut:
+			// Already in a pending consolidated transaction; the step
+			// re-entering keeps waiting on it at the checked-out price.
+			return nil
+		}
+		// Still open: re-price it, as a re-entered single-task step would be.
+		existing.TaskCode = req.TaskCode
+		existing.Description = req.Description
+		existing.OGAName = req.OGAName
+		existing.Amount = req.Amount
+		existing.Currency = req.Currency
+		if err := repo.UpdateLineItem(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update line item: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *paymentService) GetCart(ctx context.Context, consignmentID string) (*Cart, error) {
+	items, err := s.repo.ListUnpaidLineItems(ctx, consignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list line items: %w", err)
+	}
+	attempt, err := s.repo.GetCartAttempt(ctx, consignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve latest cart attempt: %w", err)
+	}
+
+	cart := &Cart{ConsignmentID: consignmentID, Items: items, Attempt: attempt}
+	if total, currency, err := cartTotal(items); err == nil {
+		cart.Total, cart.Currency = total, currency
+	}
+	return cart, nil
+}
+
+// cartTotal sums items, which must share a currency.
+func cartTotal(items []PaymentLineItem) (decimal.Decimal, string, error) {
+	total := decimal.Zero
+	currency := ""
+	for _, item := range items {
+		if currency == "" {
+			currency = item.Currency
+		} else if item.Currency != currency {
+			return decimal.Zero, "", fmt.Errorf("%s and %s: %w", currency, item.Currency, ErrCartCurrencyMismatch)
+		}
+		total = total.Add(item.Amount)
+	}
+	return total, currency, nil
+}
+
+func (s *paymentService) CheckoutCart(ctx context.Context, req CartCheckoutRequest) (*CreateCheckoutResponse, error) {
+	if req.ConsignmentID == "" {
+		return nil, errors.New("invalid cart checkout: consignment_id is required")
+	}
+	method, err := s.GetMethod(ctx, req.GatewayID)
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := s.registry.Get(method.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gateway %s: %w", method.ID, err)
+	}
+	if err := checkRedirectURLs(gateway, req.SuccessRedirectURL, req.CancelRedirectURL); err != nil {
+		return nil, fmt.Errorf("invalid cart checkout: %w", err)
+	}
+	generatedRef, err := s.newReference(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tx := &PaymentTransaction{
+		ID:              uuid.NewString(),
+		ReferenceNumber: generatedRef,
+		ConsignmentID:   req.ConsignmentID,
+		AttemptNo:       1,
+		GatewayID:       method.ID,
+		Status:          PaymentStatusPending,
+		ExpiryDate:      now.Add(cartCheckoutTTL),
+	}
+	// As for single-task checkout, the transaction is written ahead of the
+	// gateway call. A pending earlier cart attempt is superseded and its items
+	// are checked out again under the new reference, together with any added
+	// since.
+	err = s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		latest, err := repo.GetCartAttemptForUpdate(ctx, req.ConsignmentID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve latest cart attempt: %w", err)
+		}
+		if latest != nil {
+			if latest.Status == PaymentStatusPending {
+				latest.Status = PaymentStatusSuperseded
+				if err := repo.Update(ctx, latest); err != nil {
+					return fmt.Errorf("failed to supersede attempt %s: %w", latest.ReferenceNumber, err)
+				}
+				if err := repo.ReleaseLineItems(ctx, latest.ID); err != nil {
+					return fmt.Errorf("failed to release line items of %s: %w", latest.ReferenceNumber, err)
+				}
+			}
+			tx.AttemptNo = latest.AttemptNo + 1
+		}
+
+		items, err := repo.ListOpenLineItemsForUpdate(ctx, req.ConsignmentID)
+		if err != nil {
+			return fmt.Errorf("failed to list open line items: %w", err)
+		}
+		if len(items) == 0 {
+			return fmt.Errorf("consignment %s: %w", req.ConsignmentID, ErrCartEmpty)
+		}
+		if tx.Amount, tx.Currency, err = cartTotal(items); err != nil {
+			return fmt.Errorf("consignment %s: %w", req.ConsignmentID, err)
+		}
+		tx.GatewayMetadata = withRedirectURLs(map[string]string{
+			"consignment_id": req.ConsignmentID,
+			"method_id":      method.ID,
+			"line_items":     strconv.Itoa(len(items)),
+		}, req.SuccessRedirectURL, req.CancelRedirectURL)
+
+		if err := repo.Create(ctx, tx); err != nil {
+			return fmt.Errorf("failed to persist transaction: %w", err)
+		}
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		if err := repo.CheckOutLineItems(ctx, ids, tx.ID); err != nil {
+			return fmt.Errorf("failed to check out line items: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessionResp, err := gateway.CreateSession(ctx, gateways.SessionRequest{
+		ReferenceNumber:    tx.ReferenceNumber,
+		Amount:             tx.Amount,
+		Currency:           tx.Currency,
+		SuccessRedirectURL: req.SuccessRedirectURL,
+		CancelRedirectURL:  req.CancelRedirectURL,
+		ExpiresAt:          tx.ExpiryDate,
+	})
+	if err != nil {
+		// Fail the attempt and put its items back in the cart for the next checkout.
+		ferr := s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+			tx.Status = PaymentStatusFailed
+			if err := repo.Update(ctx, tx); err != nil {
+				return err
+			}
+			return repo.ReleaseLineItems(ctx, tx.ID)
+		})
+		if ferr != nil {
+			slog.ErrorContext(ctx, "paymentsv2: failed to release cart after gateway error",
+				"reference", tx.ReferenceNumber, "error", ferr)
+		}
+		return nil, fmt.Errorf("gateway failed to create session: %w", err)
+	}
+
+	if sessionResp.SessionID != "" {
+		tx.SessionID = sessionResp.SessionID
+		if err := s.repo.Update(ctx, tx); err != nil {
+			return nil, fmt.Errorf("failed to persist session id: %w", err)
+		}
+	}
+
+	slog.InfoContext(ctx, "paymentsv2: cart checked out",
+		"consignmentId", req.ConsignmentID, "reference", tx.ReferenceNumber, "attempt", tx.AttemptNo, "amount", tx.Amount)
+	return &CreateCheckoutResponse{
+		ReferenceNumber: tx.ReferenceNumber,
+		AttemptNo:       tx.AttemptNo,
+		SessionID:       sessionResp.SessionID,
+		Type:            sessionResp.Type,
+		CheckoutURL:     sessionResp.CheckoutURL,
+		Instructions:    sessionResp.Instructions,
+		ExpiresIn:       int(tx.ExpiryDate.Sub(now).Seconds()),
+	}, nil
+}
+
+// completeCartSteps completes the PAYMENT step of every task a paid
+// consolidated transaction covers that has not been told yet. Each task is
+// marked as it is notified, so RedriveTaskSteps after a partial failure only
+// re-drives the rest.
+func (s *paymentService) completeCartSteps(ctx context.Context, tx *PaymentTransaction) error {
+	if s.taskCompleter == nil {
+		return nil
+	}
+	items, err := s.repo.ListLineItemsByTransaction(ctx, tx.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list line items of %s: %w", tx.ReferenceNumber, err)
+	}
+
+	var errs []error
+	for _, item := range items {
+		if item.NotifiedAt != nil {
+			continue
+		}
+		payload := map[string]any{"payment_status": "success", "reference_number": tx.ReferenceNumber}
+		if err := s.taskCompleter.CompleteTaskStep(ctx, item.TaskID, payload); err != nil {
+			slog.ErrorContext(ctx, "paymentsv2: failed to advance cart task step",
+				"reference", tx.ReferenceNumber, "taskId", item.TaskID, "error", err)
+			errs = append(errs, fmt.Errorf("failed to advance task step for %s: %w", item.TaskID, err))
+			continue
+		}
+		if err := s.repo.MarkLineItemNotified(ctx, item.ID, time.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("failed to record notification of %s: %w", item.TaskID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// redriveCartSteps completes the task steps of up to limit paid carts whose
+// webhook could not complete every task, for RedriveTaskSteps.
+func (s *paymentService) redriveCartSteps(ctx context.Context, limit int) (int, error) {
+	carts, err := s.repo.ListPaidCartsPendingNotification(ctx, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list paid carts pending notification: %w", err)
+	}
+
+	done := 0
+	var errs []error
+	for i := range carts {
+		if err := s.completeCartSteps(ctx, &carts[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		done++
+	}
+	return done, errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package paymentsv2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+)
+
+// TaskAuthorizer decides whether the caller on ctx may act on a task.
+// *authz.TaskPolicy satisfies it; errors are authz sentinels (or wrap them).
+type TaskAuthorizer interface {
+	AuthorizeTask(ctx context.Context, taskID string) error
+}
+
+// CartHandler serves a consignment's payment cart to traders. A cart holds the
+// fees of PAYMENT steps declared with "cart": true, so they can be paid under
+// one reference.
+type CartHandler struct {
+	service PaymentService
+	authz   TaskAuthorizer
+}
+
+// NewCartHandler creates a new handler. The caller may use a cart only if it
+// may act on every task in it.
+func NewCartHandler(service PaymentService, authorizer TaskAuthorizer) *CartHandler {
+	return &CartHandler{service: service, authz: authorizer}
+}
+
+// HandleGetCart handles GET /api/v1/payments/carts/{consignmentId}
+// Returns the unpaid line items, their total and the latest cart attempt.
+func (h *CartHandler) HandleGetCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := h.getCart(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cart); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// HandleCheckoutCart handles POST /api/v1/payments/carts/{consignmentId}/checkout
+// Body {"gateway_id": "...", "success_redirect_url": "...", "cancel_redirect_url": "..."}.
+// Responds 201 with the consolidated checkout session.
+func (h *CartHandler) HandleCheckoutCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := h.getCart(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB limit
+	var req CartCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.GatewayID == "" {
+		http.Error(w, "gateway_id is required", http.StatusBadRequest)
+		return
+	}
+	req.ConsignmentID = cart.ConsignmentID
+
+	resp, err := h.service.CheckoutCart(r.Context(), req)
+	switch {
+	case errors.Is(err, ErrMethodUnavailable):
+		http.Error(w, "payment method unavailable", http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrRedirectNotAllowed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrCartEmpty):
+		http.Error(w, "nothing to pay in the payment cart", http.StatusConflict)
+		return
+	case errors.Is(err, ErrCartCurrencyMismatch):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to check out payment cart", "consignmentId", cart.ConsignmentID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// getCart loads the cart named in the URL and authorizes the caller against
+// each of its tasks. A cart with nothing unpaid is reported as not found.
+func (h *CartHandler) getCart(w http.ResponseWriter, r *http.Request) (*Cart, bool) {
+	consignmentID := r.PathValue("consignmentId")
+	if consignmentID == "" {
+		http.Error(w, "consignment ID is required in URL", http.StatusBadRequest)
+		return nil, false
+	}
+
+	cart, err := h.service.GetCart(r.Context(), consignmentID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get payment cart", "consignmentId", consignmentID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(cart.Items) == 0 {
+		authz.WriteError(w, authz.ErrNotFound)
+		return nil, false
+	}
+
+	if h.authz == nil {
+		slog.ErrorContext(r.Context(), "payment cart authorizer is not configured", "consignmentId", consignmentID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	for _, item := range cart.Items {
+		if err := h.authz.AuthorizeTask(r.Context(), item.TaskID); err != nil {
+			authz.WriteError(w, err)
+			return nil, false
+		}
+	}
+	return cart, true
+}
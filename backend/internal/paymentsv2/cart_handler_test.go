@@ -0,0 +1,114 @@
+package paymentsv2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTaskAuthorizer denies the tasks in deny and records every check.
+type fakeTaskAuthorizer struct {
+	deny    map[string]error
+	checked []string
+}
+
+func (f *fakeTaskAuthorizer) AuthorizeTask(_ context.Context, taskID string) error {
+	f.checked = append(f.checked, taskID)
+	return f.deny[taskID]
+}
+
+func twoItemCart() *Cart {
+	return &Cart{
+		ConsignmentID: "cons-1",
+		Items: []PaymentLineItem{
+			{ID: "li-1", TaskID: "task-1", Amount: decimal.RequireFromString("250"), Currency: "LKR", Status: LineItemStatusOpen},
+			{ID: "li-2", TaskID: "task-2", Amount: decimal.RequireFromString("1500"), Currency: "LKR", Status: LineItemStatusOpen},
+		},
+		Total:    decimal.RequireFromString("1750"),
+		Currency: "LKR",
+	}
+}
+
+// serveCartAPI routes a request through a mux so PathValue("consignmentId") resolves.
+func serveCartAPI(svc PaymentService, authorizer TaskAuthorizer, method, target, body string) *httptest.ResponseRecorder {
+	h := NewCartHandler(svc, authorizer)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/payments/carts/{consignmentId}", h.HandleGetCart)
+	mux.HandleFunc("POST /api/v1/payments/carts/{consignmentId}/checkout", h.HandleCheckoutCart)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rr
+}
+
+func TestHandleGetCart(t *testing.T) {
+	authorizer := &fakeTaskAuthorizer{}
+	rr := serveCartAPI(&mockService{cart: twoItemCart()}, authorizer, http.MethodGet, "/api/v1/payments/carts/cons-1", "")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got Cart
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Len(t, got.Items, 2)
+	assert.Equal(t, "1750", got.Total.String())
+	assert.Equal(t, []string{"task-1", "task-2"}, authorizer.checked)
+}
+
+func TestHandleGetCart_Denied(t *testing.T) {
+	t.Run("empty cart is not found", func(t *testing.T) {
+		rr := serveCartAPI(&mockService{}, &fakeTaskAuthorizer{}, http.MethodGet, "/api/v1/payments/carts/cons-1", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("any task the caller may not act on forbids the cart", func(t *testing.T) {
+		authorizer := &fakeTaskAuthorizer{deny: map[string]error{"task-2": authz.ErrForbidden}}
+		rr := serveCartAPI(&mockService{cart: twoItemCart()}, authorizer, http.MethodGet, "/api/v1/payments/carts/cons-1", "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("missing authorizer fails closed", func(t *testing.T) {
+		rr := serveCartAPI(&mockService{cart: twoItemCart()}, nil, http.MethodGet, "/api/v1/payments/carts/cons-1", "")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestHandleCheckoutCart(t *testing.T) {
+	svc := &mockService{cart: twoItemCart(), checkoutResp: &CreateCheckoutResponse{ReferenceNumber: "TNSWCART1", AttemptNo: 1}}
+	rr := serveCartAPI(svc, &fakeTaskAuthorizer{}, http.MethodPost, "/api/v1/payments/carts/cons-1/checkout", `{"gateway_id":"govpay"}`)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"}, svc.checkoutReq)
+	var got CreateCheckoutResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, "TNSWCART1", got.ReferenceNumber)
+
+	rr = serveCartAPI(&mockService{cart: twoItemCart()}, &fakeTaskAuthorizer{}, http.MethodPost, "/api/v1/payments/carts/cons-1/checkout", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "gateway_id is required")
+}
+
+func TestHandleCheckoutCart_ErrorStatuses(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		code int
+	}{
+		"method unavailable": {err: fmt.Errorf("x: %w", ErrMethodUnavailable), code: http.StatusBadRequest},
+		"foreign redirect":   {err: fmt.Errorf("x: %w", ErrRedirectNotAllowed), code: http.StatusBadRequest},
+		"empty":              {err: fmt.Errorf("x: %w", ErrCartEmpty), code: http.StatusConflict},
+		"mixed currencies":   {err: fmt.Errorf("x: %w", ErrCartCurrencyMismatch), code: http.StatusUnprocessableEntity},
+		"other":              {err: fmt.Errorf("boom"), code: http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockService{cart: twoItemCart(), checkoutErr: tc.err}
+			rr := serveCartAPI(svc, &fakeTaskAuthorizer{}, http.MethodPost, "/api/v1/payments/carts/cons-1/checkout", `{"gateway_id":"govpay"}`)
+			assert.Equal(t, tc.code, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package paymentsv2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func cartItem(taskID, amount string) AddToCartRequest {
+	return AddToCartRequest{
+		ConsignmentID: "cons-1",
+		TaskID:        taskID,
+		TaskCode:      "FEE",
+		Description:   "Inspection fee",
+		Amount:        decimal.RequireFromString(amount),
+		Currency:      "LKR",
+	}
+}
+
+// cartService returns a service whose cart for cons-1 holds fees of 250 and
+// 1500 for task-1 and task-2, with sessions created by gw.
+func cartService(t *testing.T, gw gateways.PaymentGateway) (*paymentService, *mockRepo) {
+	t.Helper()
+	repo := newMockRepo()
+	infos := []GatewayInfo{{ID: "govpay", IsActive: true}}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw, infos: infos}).(*paymentService)
+	for _, req := range []AddToCartRequest{cartItem("task-1", "250"), cartItem("task-2", "1500")} {
+		_, err := svc.AddToCart(context.Background(), req)
+		require.NoError(t, err)
+	}
+	return svc, repo
+}
+
+// cartGateway is sessionGateway plus the flow type GetMethod looks up.
+func cartGateway() *MockGateway {
+	gw := new(MockGateway)
+	gw.On("GetFlowType").Return(gateways.FlowTypeInstruction)
+	gw.On("CreateSession", mock.Anything, mock.Anything).
+		Return(&gateways.SessionResponse{SessionID: "sess-1", Type: gateways.FlowTypeInstruction}, nil)
+	return gw
+}
+
+func TestAddToCart(t *testing.T) {
+	svc, repo := cartService(t, nil)
+	require.Len(t, repo.lineItems, 2)
+	assert.Equal(t, LineItemStatusOpen, repo.lineItems[0].Status)
+
+	t.Run("re-entering an open item re-prices it", func(t *testing.T) {
+		item, err := svc.AddToCart(context.Background(), cartItem("task-1", "300"))
+		require.NoError(t, err)
+		assert.Len(t, repo.lineItems, 2)
+		assert.True(t, item.Amount.Equal(decimal.RequireFromString("300")))
+	})
+
+	t.Run("paid item is rejected", func(t *testing.T) {
+		repo.lineItems[1].Status = LineItemStatusPaid
+		_, err := svc.AddToCart(context.Background(), cartItem("task-2", "1500"))
+		assert.ErrorIs(t, err, ErrAlreadyPaid)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		req := cartItem("task-3", "0")
+		_, err := svc.AddToCart(context.Background(), req)
+		assert.ErrorContains(t, err, "amount must be greater than zero")
+	})
+}
+
+func TestCheckoutCart_ConsolidatesOpenItems(t *testing.T) {
+	gw := cartGateway()
+	svc, repo := cartService(t, gw)
+
+	resp, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.AttemptNo)
+
+	tx := repo.txs[resp.ReferenceNumber]
+	require.NotNil(t, tx)
+	assert.Equal(t, "cons-1", tx.ConsignmentID)
+	assert.Empty(t, tx.TaskID)
+	assert.True(t, tx.Amount.Equal(decimal.RequireFromString("1750")), "amount %s", tx.Amount)
+	assert.Equal(t, "sess-1", tx.SessionID)
+	for _, item := range repo.lineItems {
+		assert.Equal(t, LineItemStatusCheckedOut, item.Status)
+		assert.Equal(t, tx.ID, item.TransactionID)
+	}
+	gw.AssertCalled(t, "CreateSession", mock.Anything,
+		mock.MatchedBy(func(r gateways.SessionRequest) bool { return r.Amount.Equal(tx.Amount) && r.Currency == "LKR" }))
+
+	t.Run("a new item supersedes the pending attempt", func(t *testing.T) {
+		_, err := svc.AddToCart(context.Background(), cartItem("task-3", "50"))
+		require.NoError(t, err)
+
+		again, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, again.AttemptNo)
+		assert.Equal(t, PaymentStatusSuperseded, tx.Status)
+		assert.True(t, repo.txs[again.ReferenceNumber].Amount.Equal(decimal.RequireFromString("1800")))
+		for _, item := range repo.lineItems {
+			assert.Equal(t, repo.txs[again.ReferenceNumber].ID, item.TransactionID)
+		}
+	})
+}
+
+func TestCheckoutCart_Errors(t *testing.T) {
+	t.Run("empty cart", func(t *testing.T) {
+		infos := []GatewayInfo{{ID: "govpay", IsActive: true}}
+		svc := NewPaymentService(newMockRepo(), &mockRegistry{gw: cartGateway(), infos: infos})
+		_, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+		assert.ErrorIs(t, err, ErrCartEmpty)
+	})
+
+	t.Run("mixed currencies", func(t *testing.T) {
+		svc, _ := cartService(t, cartGateway())
+		usd := cartItem("task-3", "10")
+		usd.Currency = "USD"
+		_, err := svc.AddToCart(context.Background(), usd)
+		require.NoError(t, err)
+
+		_, err = svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+		assert.ErrorIs(t, err, ErrCartCurrencyMismatch)
+	})
+
+	t.Run("gateway error puts the items back", func(t *testing.T) {
+		gw := new(MockGateway)
+		gw.On("GetFlowType").Return(gateways.FlowTypeInstruction)
+		gw.On("CreateSession", mock.Anything, mock.Anything).Return(nil, errors.New("gateway down"))
+		svc, repo := cartService(t, gw)
+
+		_, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+		require.Error(t, err)
+		require.Len(t, repo.txs, 1)
+		for _, tx := range repo.txs {
+			assert.Equal(t, PaymentStatusFailed, tx.Status)
+		}
+		for _, item := range repo.lineItems {
+			assert.Equal(t, LineItemStatusOpen, item.Status)
+			assert.Empty(t, item.TransactionID)
+		}
+	})
+}
+
+// checkedOutCart returns a service with cons-1's cart checked out, the
+// gateway reporting status for the consolidated reference on every webhook.
+func checkedOutCart(t *testing.T, status gateways.WebhookStatus) (*paymentService, *mockRepo, *PaymentTransaction) {
+	t.Helper()
+	gw := cartGateway()
+	svc, repo := cartService(t, gw)
+	resp, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+	require.NoError(t, err)
+
+	gw.On("VerifyWebhook", mock.Anything, mock.Anything).
+		Return(&gateways.WebhookAuth{Nonce: "n-1", ExpiresAt: time.Now().Add(time.Minute)}, nil)
+	gw.On("ParseWebhook", mock.Anything, mock.Anything, mock.Anything).Return(&gateways.WebhookPayload{
+		ReferenceNumber: resp.ReferenceNumber,
+		Status:          status,
+		Amount:          decimal.RequireFromString("1750"),
+		Currency:        "LKR",
+	}, nil)
+	return svc, repo, repo.txs[resp.ReferenceNumber]
+}
+
+func TestProcessWebhook_CartSuccessCompletesEveryTask(t *testing.T) {
+	svc, repo, tx := checkedOutCart(t, gateways.WebhookStatusSuccess)
+	tc := &mockTaskCompleter{errFor: map[string]error{"task-2": errors.New("workflow unavailable")}}
+	svc.SetTaskCompleter(tc)
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}),
+		"the payment is recorded; a task that could not be advanced is left to the re-drive sweep")
+	assert.Equal(t, PaymentStatusSuccess, tx.Status)
+	require.Len(t, tc.calls, 2)
+	for _, call := range tc.calls {
+		assert.Equal(t, "success", call.payload["payment_status"])
+		assert.Equal(t, tx.ReferenceNumber, call.payload["reference_number"])
+	}
+	for _, item := range repo.lineItems {
+		assert.Equal(t, LineItemStatusPaid, item.Status)
+	}
+	assert.NotNil(t, repo.lineItems[0].NotifiedAt)
+	assert.Nil(t, repo.lineItems[1].NotifiedAt)
+
+	// A redelivery under the same nonce is a replay and re-drives nothing.
+	tc.calls, tc.errFor = nil, nil
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
+	require.ErrorIs(t, err, ErrWebhookReplay)
+	assert.Empty(t, tc.calls)
+
+	// The sweep completes the remaining task, and only that one.
+	n, err := svc.RedriveTaskSteps(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, tc.calls, 1)
+	assert.Equal(t, "task-2", tc.calls[0].taskID)
+	assert.NotNil(t, repo.lineItems[1].NotifiedAt)
+
+	n, err = svc.RedriveTaskSteps(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, n, "a fully notified cart is not picked up again")
+	assert.Len(t, tc.calls, 1)
+}
+
+func TestRedriveTaskSteps_KeepsFailedTasksForNextSweep(t *testing.T) {
+	svc, repo, _ := checkedOutCart(t, gateways.WebhookStatusSuccess)
+	tc := &mockTaskCompleter{errFor: map[string]error{"task-1": errors.New("workflow unavailable"), "task-2": errors.New("workflow unavailable")}}
+	svc.SetTaskCompleter(tc)
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+
+	n, err := svc.RedriveTaskSteps(context.Background(), 10)
+	require.Error(t, err)
+	assert.Zero(t, n)
+	for _, item := range repo.lineItems {
+		assert.Nil(t, item.NotifiedAt)
+	}
+}
+
+func TestProcessWebhook_CartFailedReleasesItems(t *testing.T) {
+	svc, repo, tx := checkedOutCart(t, gateways.WebhookStatusFailed)
+	tc := &mockTaskCompleter{}
+	svc.SetTaskCompleter(tc)
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	assert.Equal(t, PaymentStatusFailed, tx.Status)
+	assert.Empty(t, tc.calls, "the tasks keep waiting on the cart")
+	for _, item := range repo.lineItems {
+		assert.Equal(t, LineItemStatusOpen, item.Status)
+	}
+}
+
+func TestExpireOverdue_ReleasesCartItems(t *testing.T) {
+	svc, repo, tx := checkedOutCart(t, gateways.WebhookStatusSuccess)
+	tc := &mockTaskCompleter{}
+	svc.SetTaskCompleter(tc)
+	tx.ExpiryDate = time.Now().Add(-time.Hour)
+
+	n, err := svc.ExpireOverdue(context.Background(), time.Now(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, n, "no task is told; the fees wait in the cart")
+	assert.Equal(t, PaymentStatusExpired, repo.txs[tx.ReferenceNumber].Status)
+	assert.Empty(t, tc.calls)
+	for _, item := range repo.lineItems {
+		assert.Equal(t, LineItemStatusOpen, item.Status)
+	}
+}
+
+func TestValidateReference_SupersededCartReference(t *testing.T) {
+	gw := cartGateway()
+	svc, repo := cartService(t, gw)
+	first, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+	require.NoError(t, err)
+	second, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+	require.NoError(t, err)
+	// Pretend the first attempt were still pending to prove the latest-attempt check.
+	repo.txs[first.ReferenceNumber].Status = PaymentStatusPending
+
+	for ref, payable := range map[string]bool{first.ReferenceNumber: false, second.ReferenceNumber: true} {
+		gw.On("ExtractReferenceNumber", mock.Anything, json.RawMessage(ref)).Return(ref, nil)
+		gw.On("HandleValidateReference", mock.Anything,
+			mock.MatchedBy(func(tx *gateways.ValidationTransaction) bool { return tx != nil && tx.ReferenceNumber == ref }),
+			payable, mock.Anything).
+			Return(&gateways.ValidationResponse{HTTPStatus: 200}, nil).Once()
+
+		_, err := svc.ValidateReference(context.Background(), "govpay", []byte(ref))
+		require.NoError(t, err)
+	}
+	gw.AssertExpectations(t)
+}
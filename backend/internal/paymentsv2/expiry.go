@@ -0,0 +1,190 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+)
+
+// expirySweepLockKey is the Postgres advisory lock that keeps concurrent
+// replicas from sweeping at the same time. The value is arbitrary but must not
+// be reused for another advisory lock.
+const expirySweepLockKey int64 = 0x4e5357_504159 // "NSW" "PAY"
+
+// refundAlerts counts late payments on expired or superseded references, keyed
+// by gateway ID.
+// Each one needs a manual or gateway-side refund. Published through expvar.
+var refundAlerts = expvar.NewMap("paymentsv2_refund_alerts")
+
+// ExpiryConfig configures the payment expiry sweeper.
+type ExpiryConfig struct {
+	// Interval between sweeps. Zero disables the sweeper.
+	Interval time.Duration
+	// Grace is how long past its ExpiryDate a PENDING transaction is left
+	// alone, so a webhook for a payment made just before expiry can still land.
+	Grace time.Duration
+	// BatchSize caps the transactions expired per sweep.
+	BatchSize int
+}
+
+func (s *paymentService) ExpireOverdue(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	if s.taskCompleter == nil {
+		return 0, errors.New("paymentsv2: task completer not set, refusing to expire transactions")
+	}
+
+	// Claim the overdue rows in one transaction. Rows are locked, so a webhook
+	// for one of them waits and then sees EXPIRED; rows a webhook already holds
+	// are skipped and picked up by a later sweep if still PENDING.
+	var expired []PaymentTransaction
+	err := s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		locked, err := repo.TryAdvisoryXactLock(ctx, expirySweepLockKey)
+		if err != nil {
+			return fmt.Errorf("failed to take expiry sweep lock: %w", err)
+		}
+		if !locked {
+			slog.DebugContext(ctx, "paymentsv2: expiry sweep already running elsewhere")
+			return nil
+		}
+
+		overdue, err := repo.ListOverduePendingForUpdate(ctx, cutoff, limit)
+		if err != nil {
+			return fmt.Errorf("failed to list overdue transactions: %w", err)
+		}
+		for i := range overdue {
+			overdue[i].Status = PaymentStatusExpired
+			if err := repo.Update(ctx, &overdue[i]); err != nil {
+				return fmt.Errorf("failed to expire transaction %s: %w", overdue[i].ReferenceNumber, err)
+			}
+			// An expired cart's items go back to the cart; its tasks keep waiting.
+			if overdue[i].consolidated() {
+				if err := repo.ReleaseLineItems(ctx, overdue[i].ID); err != nil {
+					return fmt.Errorf("failed to release line items of %s: %w", overdue[i].ReferenceNumber, err)
+				}
+			}
+		}
+		expired = overdue
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Notify tasks outside the transaction, as ProcessWebhook does.
+	notified := 0
+	var errs []error
+	for _, tx := range expired {
+		if tx.consolidated() {
+			continue
+		}
+		if err := s.notifyExpired(ctx, tx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		notified++
+	}
+	return notified, errors.Join(errs...)
+}
+
+// notifyExpired completes the task step of an expired transaction. If the task
+// engine refuses, the transaction is put back to PENDING so the next sweep
+// retries; the compare-and-set leaves it alone if a late webhook already
+// flagged it for refund.
+func (s *paymentService) notifyExpired(ctx context.Context, tx PaymentTransaction) error {
+	slog.InfoContext(ctx, "paymentsv2: payment expired, advancing task step", "reference", tx.ReferenceNumber, "taskId", tx.TaskID)
+	err := s.taskCompleter.CompleteTaskStep(ctx, tx.TaskID, map[string]any{"payment_status": "expired"})
+	if err == nil {
+		return nil
+	}
+
+	if _, rerr := s.repo.TransitionStatus(ctx, tx.ReferenceNumber, PaymentStatusExpired, PaymentStatusPending); rerr != nil {
+		slog.ErrorContext(ctx, "paymentsv2: failed to reopen transaction after task error",
+			"reference", tx.ReferenceNumber, "error", rerr)
+	}
+	return fmt.Errorf("failed to advance task step for expired %s: %w", tx.ReferenceNumber, err)
+}
+
+// raiseRefundAlert records a late payment on an expired or superseded reference.
+func raiseRefundAlert(ctx context.Context, gatewayID string, p *gateways.WebhookPayload) {
+	refundAlerts.Add(gatewayID, 1)
+	slog.ErrorContext(ctx, "paymentsv2: payment received for closed reference, refund required",
+		"gateway", gatewayID,
+		"reference", p.ReferenceNumber,
+		"gatewayTransactionId", p.GatewayTransactionID,
+		"amount", p.Amount.String(),
+		"currency", p.Currency)
+}
+
+// ExpirySweeper periodically expires overdue PENDING transactions and
+// re-drives the task steps of settled payments and paid carts. Every replica
+// may run one: the advisory lock taken by ExpireOverdue lets only one expiry
+// sweep at a time.
+type ExpirySweeper struct {
+	service PaymentService
+	cfg     ExpiryConfig
+	now     func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExpirySweeper creates a sweeper; call Start to run it.
+func NewExpirySweeper(service PaymentService, cfg ExpiryConfig) *ExpirySweeper {
+	return &ExpirySweeper{service: service, cfg: cfg, now: time.Now}
+}
+
+// Start runs the sweep loop in the background until Stop is called. It is a
+// no-op when the configured interval is zero.
+func (s *ExpirySweeper) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		slog.Info("paymentsv2: payment expiry sweeper disabled")
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweep(ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends the sweep loop and waits for an in-flight sweep to finish.
+func (s *ExpirySweeper) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *ExpirySweeper) sweep(ctx context.Context) {
+	cutoff := s.now().Add(-s.cfg.Grace)
+	n, err := s.service.ExpireOverdue(ctx, cutoff, s.cfg.BatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "paymentsv2: payment expiry sweep failed", "expired", n, "error", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "paymentsv2: expired overdue payments", "count", n)
+	}
+
+	redriven, err := s.service.RedriveTaskSteps(ctx, s.cfg.BatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "paymentsv2: payment task step re-drive failed", "completed", redriven, "error", err)
+		return
+	}
+	if redriven > 0 {
+		slog.InfoContext(ctx, "paymentsv2: re-drove settled payment task steps", "count", redriven)
+	}
+}
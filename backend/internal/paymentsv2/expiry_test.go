@@ -0,0 +1,185 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// overdueTx returns a PENDING transaction that expired an hour ago.
+func overdueTx(ref, taskID string) *PaymentTransaction {
+	tx := pendingTx()
+	tx.ReferenceNumber = ref
+	tx.TaskID = taskID
+	tx.ExpiryDate = time.Now().Add(-time.Hour)
+	return tx
+}
+
+func TestExpireOverdue_ExpiresAndNotifiesTasks(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = overdueTx("TNSW1", "task-1")
+	repo.txs["TNSW2"] = pendingTx() // not yet due
+	repo.txs["TNSW2"].ReferenceNumber = "TNSW2"
+	paid := overdueTx("TNSW3", "task-3")
+	paid.Status = PaymentStatusSuccess
+	repo.txs["TNSW3"] = paid
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{})
+	svc.SetTaskCompleter(tc)
+
+	n, err := svc.ExpireOverdue(context.Background(), time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, PaymentStatusExpired, repo.txs["TNSW1"].Status)
+	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW2"].Status)
+	assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSW3"].Status)
+	require.Len(t, tc.calls, 1)
+	assert.Equal(t, "task-1", tc.calls[0].taskID)
+	assert.Equal(t, "expired", tc.calls[0].payload["payment_status"])
+}
+
+func TestExpireOverdue_GraceViaCutoff(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = overdueTx("TNSW1", "task-1") // expired an hour ago
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{})
+	svc.SetTaskCompleter(tc)
+
+	n, err := svc.ExpireOverdue(context.Background(), time.Now().Add(-2*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status)
+}
+
+func TestExpireOverdue_LockHeldElsewhere(t *testing.T) {
+	repo := newMockRepo()
+	repo.lockHeld = true
+	repo.txs["TNSW1"] = overdueTx("TNSW1", "task-1")
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{})
+	svc.SetTaskCompleter(tc)
+
+	n, err := svc.ExpireOverdue(context.Background(), time.Now(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status)
+	assert.Empty(t, tc.calls)
+}
+
+func TestExpireOverdue_TaskErrorReopensTransaction(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = overdueTx("TNSW1", "task-1")
+	repo.txs["TNSW2"] = overdueTx("TNSW2", "task-2")
+	tc := &mockTaskCompleter{errFor: map[string]error{"task-1": errors.New("task engine down")}}
+	svc := NewPaymentService(repo, &mockRegistry{})
+	svc.SetTaskCompleter(tc)
+
+	n, err := svc.ExpireOverdue(context.Background(), time.Now(), 10)
+	require.Error(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status, "reopened so the next sweep retries")
+	assert.Equal(t, PaymentStatusExpired, repo.txs["TNSW2"].Status)
+}
+
+func TestExpireOverdue_RequiresTaskCompleter(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = overdueTx("TNSW1", "task-1")
+	svc := NewPaymentService(repo, &mockRegistry{})
+
+	_, err := svc.ExpireOverdue(context.Background(), time.Now(), 10)
+	require.Error(t, err)
+	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status)
+}
+
+func TestProcessWebhook_LateSuccessOnExpiredRequiresRefund(t *testing.T) {
+	repo := newMockRepo()
+	expired := pendingTx()
+	expired.Status = PaymentStatusExpired
+	repo.txs["TNSW1"] = expired
+	gw := webhookGateway(&gateways.WebhookPayload{
+		ReferenceNumber:      "TNSW1",
+		Status:               gateways.WebhookStatusSuccess,
+		Amount:               decimal.RequireFromString("1500.00"),
+		Currency:             "LKR",
+		GatewayTransactionID: "gw-tx-late",
+	})
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+	svc.SetTaskCompleter(tc)
+	before := refundAlertCount("govpay")
+
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
+	require.NoError(t, err, "acknowledged so the gateway stops retrying")
+	assert.Equal(t, PaymentStatusRefundRequired, repo.txs["TNSW1"].Status)
+	assert.Equal(t, "gw-tx-late", repo.txs["TNSW1"].GatewayMetadata["gateway_transaction_id"])
+	assert.Equal(t, "1500", repo.txs["TNSW1"].GatewayMetadata["paid_amount"])
+	assert.Empty(t, tc.calls, "the task already moved on and must not be advanced")
+	assert.Equal(t, before+1, refundAlertCount("govpay"))
+
+	// A redelivery of the same late payment is idempotent.
+	gw2 := webhookGateway(&gateways.WebhookPayload{ReferenceNumber: "TNSW1", Status: gateways.WebhookStatusSuccess})
+	repo.nonces = nil
+	svc = NewPaymentService(repo, &mockRegistry{gw: gw2})
+	svc.SetTaskCompleter(tc)
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	assert.Equal(t, before+1, refundAlertCount("govpay"))
+}
+
+func TestProcessWebhook_LateFailureOnExpiredIgnored(t *testing.T) {
+	repo := newMockRepo()
+	expired := pendingTx()
+	expired.Status = PaymentStatusExpired
+	repo.txs["TNSW1"] = expired
+	gw := webhookGateway(&gateways.WebhookPayload{ReferenceNumber: "TNSW1", Status: gateways.WebhookStatusFailed})
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+	svc.SetTaskCompleter(tc)
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	assert.Equal(t, PaymentStatusExpired, repo.txs["TNSW1"].Status)
+	assert.Empty(t, tc.calls)
+}
+
+func refundAlertCount(gatewayID string) int64 {
+	if v, ok := refundAlerts.Get(gatewayID).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestExpirySweeper_SweepsWithGraceCutoff(t *testing.T) {
+	svc := &mockService{}
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	sweeper := NewExpirySweeper(svc, ExpiryConfig{Interval: 5 * time.Millisecond, Grace: 15 * time.Minute, BatchSize: 50})
+	sweeper.now = func() time.Time { return now }
+
+	sweeper.Start(context.Background())
+	require.Eventually(t, func() bool {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		return len(svc.expireCutoffs) >= 2
+	}, time.Second, 5*time.Millisecond)
+	sweeper.Stop()
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	assert.Equal(t, now.Add(-15*time.Minute), svc.expireCutoffs[0])
+	assert.Equal(t, 50, svc.expireLimit)
+	require.NotEmpty(t, svc.redriveLimits, "each sweep also re-drives paid carts")
+	assert.Equal(t, 50, svc.redriveLimits[0])
+}
+
+func TestExpirySweeper_DisabledIsNoop(t *testing.T) {
+	svc := &mockService{}
+	sweeper := NewExpirySweeper(svc, ExpiryConfig{})
+	sweeper.Start(context.Background())
+	sweeper.Stop()
+	assert.Empty(t, svc.expireCutoffs)
+}
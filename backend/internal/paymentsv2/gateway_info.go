@@ -1,6 +1,10 @@
 package paymentsv2
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+)
 
 // RenderInfo contains UI-specific metadata for displaying a payment method.
 type RenderInfo struct {
@@ -9,6 +13,9 @@ type RenderInfo struct {
 	LogoURL      string `json:"logo_url"`
 	DisplayOrder int    `json:"display_order"`
 	PrimaryColor string `json:"primary_color,omitempty"`
+	// Template is a text/template rendered by the PAYMENT UI projector to show
+	// payment instructions (reference number, amount, checkout link).
+	Template string `json:"template,omitempty"`
 }
 
 // GatewayInfo is the aggregate DTO used for gateway discovery.
@@ -18,3 +25,10 @@ type GatewayInfo struct {
 	RenderInfo RenderInfo      `json:"render_info"`
 	Config     json.RawMessage `json:"config,omitempty"`
 }
+
+// PaymentMethod is an active, implemented gateway as seen by the task layer:
+// its UI-safe info plus the interaction type the gateway drives.
+type PaymentMethod struct {
+	GatewayInfo
+	Type gateways.InteractionType `json:"type"`
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -32,10 +33,16 @@ const (
 var ErrUnsupportedWebhookStatus = errors.New("unsupported webhook status")
 
 type SessionRequest struct {
+	// ReferenceNumber is the NSW reference of the transaction the session
+	// pays. Redirect gateways send it as their order ID so notifications and
+	// browser returns can be matched back to it.
+	ReferenceNumber    string          `json:"reference_number"`
 	Amount             decimal.Decimal `json:"amount"`
 	Currency           string          `json:"currency"`
 	SuccessRedirectURL string          `json:"success_redirect_url"`
 	CancelRedirectURL  string          `json:"cancel_redirect_url"`
+	// ExpiresAt is when the reference stops being payable.
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type SessionResponse struct {
@@ -58,6 +65,33 @@ type WebhookPayload struct {
 	Metadata             map[string]string `json:"metadata"`
 }
 
+// ValidationRejection says why a reference cannot be paid. Gateways relay it
+// to the bank or teller so the payer is told what is wrong with the reference
+// rather than a generic failure.
+type ValidationRejection string
+
+const (
+	// RejectionNotFound: no transaction carries the reference on this gateway.
+	// Gateways report it whenever they are handed a nil transaction.
+	RejectionNotFound ValidationRejection = "REFERENCE_NOT_FOUND"
+	// RejectionExpired: the reference outlived its expiry date.
+	RejectionExpired ValidationRejection = "REFERENCE_EXPIRED"
+	// RejectionCancelled: the attempt was closed (failed, or superseded by a
+	// newer attempt) and the payer must use the current reference.
+	RejectionCancelled ValidationRejection = "REFERENCE_CANCELLED"
+	// RejectionAlreadyPaid: the reference has already been settled.
+	RejectionAlreadyPaid ValidationRejection = "REFERENCE_ALREADY_PAID"
+)
+
+// ValidationLine is one fee making up a reference's amount. A single-task
+// payment has one line; a cart payment has one per carted fee.
+type ValidationLine struct {
+	TaskCode    string          `json:"task_code,omitempty"`
+	Description string          `json:"description"`
+	OGAName     string          `json:"oga_name,omitempty"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
 // ValidationTransaction represents a minimal view of a payment transaction for validation purposes.
 type ValidationTransaction struct {
 	ReferenceNumber string            `json:"reference_number"`
@@ -66,6 +100,22 @@ type ValidationTransaction struct {
 	Status          string            `json:"status"`
 	ExpiryDate      time.Time         `json:"expiry_date"`
 	Metadata        map[string]string `json:"metadata"`
+	// TraderName and OGAName name the paying company and the collecting
+	// agency. Both, and Breakdown, are only filled for a payable reference.
+	TraderName string           `json:"trader_name,omitempty"`
+	OGAName    string           `json:"oga_name,omitempty"`
+	Breakdown  []ValidationLine `json:"breakdown,omitempty"`
+	// Rejection is set whenever the reference is not payable.
+	Rejection ValidationRejection `json:"rejection,omitempty"`
+}
+
+// RejectionOf returns why tx is not payable, treating a nil transaction as an
+// unknown reference. It is empty for a payable transaction.
+func RejectionOf(tx *ValidationTransaction) ValidationRejection {
+	if tx == nil {
+		return RejectionNotFound
+	}
+	return tx.Rejection
 }
 
 // ValidationResponse represents a structured response for a validation request.
@@ -94,8 +144,21 @@ type PaymentGateway interface {
 	// tx is nil when no matching transaction exists (unknown reference or a
 	// mismatched gateway); isPayable is the domain decision (exists, owned by
 	// this gateway, pending, and not expired) the gateway should reflect back.
+	// When isPayable is false, RejectionOf(tx) gives the specific reason.
 	HandleValidateReference(ctx context.Context, tx *ValidationTransaction, isPayable bool, reqData json.RawMessage) (*ValidationResponse, error)
 
+	// VerifyWebhook authenticates a raw notification before it is parsed. It
+	// must return an error wrapping ErrWebhookUnauthorized for any delivery that
+	// cannot be proven to come from the gateway; most gateways delegate to an
+	// HMACVerifier built from their webhook_security config.
+	VerifyWebhook(ctx context.Context, req WebhookRequest) (*WebhookAuth, error)
+
 	// ParseWebhook processes raw gateway notifications into domain-neutral payloads.
 	ParseWebhook(ctx context.Context, body []byte, headers map[string][]string) (*WebhookPayload, error)
+
+	// ParseSettlement reads the gateway's settlement file into normalized
+	// records for reconciliation. It must return an error wrapping
+	// ErrSettlementFormat for a file it cannot read; most gateways delegate to
+	// ParseSettlementCSV with their column names.
+	ParseSettlement(ctx context.Context, r io.Reader) ([]SettlementRecord, error)
 }
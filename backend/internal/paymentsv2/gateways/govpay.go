@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	BaseURL string
+	BaseURL         string
+	WebhookSecurity WebhookSecurityConfig `json:"webhook_security"`
 }
 
 type GovPayReq struct {
@@ -29,10 +32,35 @@ type GovPayValidateResponse struct {
 	ServiceID     string `json:"serviceId"`
 	ServiceName   string `json:"serviceName"`
 	Message       string `json:"message"`
+	// ErrorCode is the ValidationRejection for a reference that cannot be paid.
+	ErrorCode string `json:"errorCode,omitempty"`
+	// The remaining fields populate the teller screen for a payable reference.
+	Amount     string                  `json:"amount,omitempty"`
+	Currency   string                  `json:"currency,omitempty"`
+	PayerName  string                  `json:"payerName,omitempty"`
+	OGAName    string                  `json:"ogaName,omitempty"`
+	ExpiryDate string                  `json:"expiryDate,omitempty"`
+	Breakdown  []GovPayValidateFeeLine `json:"breakdown,omitempty"`
+}
+
+// GovPayValidateFeeLine is one fee of a payable reference's amount.
+type GovPayValidateFeeLine struct {
+	Description string `json:"description"`
+	OGAName     string `json:"ogaName,omitempty"`
+	Amount      string `json:"amount"`
+}
+
+// govPayRejectionMessages are the teller-facing messages for each rejection.
+var govPayRejectionMessages = map[ValidationRejection]string{
+	RejectionNotFound:    "Reference number is invalid",
+	RejectionExpired:     "Reference number has expired",
+	RejectionCancelled:   "Reference number has been cancelled; use the latest reference issued",
+	RejectionAlreadyPaid: "Reference number is already paid",
 }
 
 type GovPayGateway struct {
-	cfg Config
+	cfg      Config
+	verifier *HMACVerifier
 }
 
 // NewGovPayGateway satisfies gateways.Factory: it constructs a fully configured
@@ -43,8 +71,14 @@ func NewGovPayGateway(cfg json.RawMessage) (PaymentGateway, error) {
 		return nil, err
 	}
 
+	verifier, err := NewHMACVerifier(config.WebhookSecurity)
+	if err != nil {
+		return nil, fmt.Errorf("govpay: %w", err)
+	}
+
 	return &GovPayGateway{
-		cfg: config,
+		cfg:      config,
+		verifier: verifier,
 	}, nil
 }
 
@@ -59,6 +93,37 @@ func (g *GovPayGateway) CreateSession(ctx context.Context, req SessionRequest) (
 	}, nil
 }
 
+func (g *GovPayGateway) VerifyWebhook(ctx context.Context, req WebhookRequest) (*WebhookAuth, error) {
+	return g.verifier.Verify(req)
+}
+
+// govPaySettlementColumns is the layout of GovPay's daily settlement CSV. The
+// transaction ID is the NSW reference the payer entered in their bank app.
+var govPaySettlementColumns = SettlementColumns{
+	ReferenceNumber:      "Transaction ID",
+	GatewayTransactionID: "Bank Reference",
+	Amount:               "Amount",
+	Currency:             "Currency",
+	SettledAt:            "Settlement Date",
+	TimeLayouts:          []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"},
+	DefaultCurrency:      "LKR",
+}
+
+func (g *GovPayGateway) ParseSettlement(ctx context.Context, r io.Reader) ([]SettlementRecord, error) {
+	return ParseSettlementCSV(r, govPaySettlementColumns)
+}
+
+// Refund satisfies Refunder. GovPay has no refund API, so every refund is
+// manual: finance returns the money to the payer's bank account and confirms
+// the refund in NSW.
+func (g *GovPayGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResponse, error) {
+	return &RefundResponse{
+		Manual: true,
+		Instructions: fmt.Sprintf("GovPay does not support online refunds. Transfer %s %s to the payer of reference %s (bank reference %s) and confirm the refund in NSW.",
+			req.Currency, req.Amount.StringFixed(2), req.ReferenceNumber, req.GatewayTransactionID),
+	}, nil
+}
+
 func (g *GovPayGateway) ParseWebhook(ctx context.Context, body []byte, headers map[string][]string) (*WebhookPayload, error) {
 	// Capture the raw status string (embedded field is shadowed for JSON decoding)
 	// so we can normalize GovPay's vocabulary instead of casting it blindly.
@@ -115,17 +180,33 @@ func (g *GovPayGateway) HandleValidateReference(ctx context.Context, tx *Validat
 		return nil, err
 	}
 
-	message := "Reference number is invalid, already settled, or expired"
-	if isPayable {
-		message = "Success"
-	}
-
 	resp := GovPayValidateResponse{
 		TransactionID: req.TransactionID,
 		SubInstID:     req.SubInstID,
 		ServiceID:     req.ServiceID,
 		ServiceName:   req.ServiceName,
-		Message:       message,
+	}
+	if isPayable && tx != nil {
+		resp.Message = "Success"
+		resp.Amount = tx.Amount.StringFixed(2)
+		resp.Currency = tx.Currency
+		resp.PayerName = tx.TraderName
+		resp.OGAName = tx.OGAName
+		resp.ExpiryDate = tx.ExpiryDate.UTC().Format(time.RFC3339)
+		for _, line := range tx.Breakdown {
+			resp.Breakdown = append(resp.Breakdown, GovPayValidateFeeLine{
+				Description: line.Description,
+				OGAName:     line.OGAName,
+				Amount:      line.Amount.StringFixed(2),
+			})
+		}
+	} else {
+		rejection := RejectionOf(tx)
+		if rejection == "" {
+			rejection = RejectionNotFound
+		}
+		resp.ErrorCode = string(rejection)
+		resp.Message = govPayRejectionMessages[rejection]
 	}
 
 	payload, err := json.Marshal(resp)
@@ -3,7 +3,10 @@ package gateways
 import (
 	"context"
 	"encoding/json"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -85,7 +88,50 @@ func TestGovPay_HandleValidateReference(t *testing.T) {
 		require.NoError(t, json.Unmarshal(resp.Payload, &out))
 		assert.NotEqual(t, "Success", out.Message)
 		assert.Equal(t, "abc", out.TransactionID) // still echoes the request fields
+		assert.Equal(t, "REFERENCE_NOT_FOUND", out.ErrorCode)
 	})
+
+	t.Run("payable reference describes the payment", func(t *testing.T) {
+		tx := &ValidationTransaction{
+			ReferenceNumber: "abc",
+			Amount:          decimal.RequireFromString("1750"),
+			Currency:        "LKR",
+			ExpiryDate:      time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC),
+			TraderName:      "Ceylon Spice Exports",
+			OGAName:         "CDA, FCAU",
+			Breakdown: []ValidationLine{
+				{Description: "Inspection fee", OGAName: "FCAU", Amount: decimal.RequireFromString("250")},
+				{Description: "Export levy", OGAName: "CDA", Amount: decimal.RequireFromString("1500")},
+			},
+		}
+		resp, err := g.HandleValidateReference(context.Background(), tx, true, reqData)
+		require.NoError(t, err)
+
+		var out GovPayValidateResponse
+		require.NoError(t, json.Unmarshal(resp.Payload, &out))
+		assert.Empty(t, out.ErrorCode)
+		assert.Equal(t, "1750.00", out.Amount)
+		assert.Equal(t, "Ceylon Spice Exports", out.PayerName)
+		assert.Equal(t, "CDA, FCAU", out.OGAName)
+		assert.Equal(t, "2026-10-18T09:00:00Z", out.ExpiryDate)
+		assert.Equal(t, []GovPayValidateFeeLine{
+			{Description: "Inspection fee", OGAName: "FCAU", Amount: "250.00"},
+			{Description: "Export levy", OGAName: "CDA", Amount: "1500.00"},
+		}, out.Breakdown)
+	})
+
+	for rejection, message := range govPayRejectionMessages {
+		t.Run(string(rejection), func(t *testing.T) {
+			resp, err := g.HandleValidateReference(context.Background(), &ValidationTransaction{ReferenceNumber: "abc", Rejection: rejection}, false, reqData)
+			require.NoError(t, err)
+
+			var out GovPayValidateResponse
+			require.NoError(t, json.Unmarshal(resp.Payload, &out))
+			assert.Equal(t, string(rejection), out.ErrorCode)
+			assert.Equal(t, message, out.Message)
+			assert.Empty(t, out.PayerName, "rejected references are not described")
+		})
+	}
 }
 
 func TestGovPay_ExtractReferenceNumber(t *testing.T) {
@@ -108,7 +154,7 @@ func TestGovPay_CreateSession(t *testing.T) {
 }
 
 func TestNewGovPayGateway(t *testing.T) {
-	gw, err := NewGovPayGateway([]byte(`{"BaseURL":"https://sandbox.govpay.lk"}`))
+	gw, err := NewGovPayGateway([]byte(`{"BaseURL":"https://sandbox.govpay.lk","webhook_security":{"secret":"s3cret"}}`))
 	require.NoError(t, err)
 	g, ok := gw.(*GovPayGateway)
 	require.True(t, ok)
@@ -116,6 +162,23 @@ func TestNewGovPayGateway(t *testing.T) {
 
 	_, err = NewGovPayGateway([]byte(`not json`))
 	require.Error(t, err)
+
+	// Signed webhooks are mandatory.
+	_, err = NewGovPayGateway([]byte(`{"BaseURL":"https://sandbox.govpay.lk"}`))
+	require.ErrorContains(t, err, "secret")
+}
+
+func TestGovPay_VerifyWebhook(t *testing.T) {
+	gw, err := NewGovPayGateway([]byte(`{"webhook_security":{"secret":"s3cret"}}`))
+	require.NoError(t, err)
+
+	body := []byte(`{"reference_number":"TNSW1","status":"paid"}`)
+	auth, err := gw.VerifyWebhook(context.Background(), signedRequest("s3cret", time.Now(), "nonce-1", body))
+	require.NoError(t, err)
+	assert.Equal(t, "nonce-1", auth.Nonce)
+
+	_, err = gw.VerifyWebhook(context.Background(), WebhookRequest{Body: body})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized)
 }
 
 func TestGovPay_ExtractReferenceNumber_InvalidJSON(t *testing.T) {
@@ -129,3 +192,65 @@ func TestGovPay_HandleValidateReference_InvalidJSON(t *testing.T) {
 	_, err := g.HandleValidateReference(context.Background(), nil, true, []byte(`not json`))
 	require.Error(t, err)
 }
+
+func TestGovPay_ParseSettlement(t *testing.T) {
+	f, err := os.Open("testdata/govpay_settlement.csv")
+	require.NoError(t, err)
+	defer f.Close()
+
+	records, err := (&GovPayGateway{}).ParseSettlement(context.Background(), f)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, SettlementRecord{
+		Line:                 2,
+		ReferenceNumber:      "TNSW00000001",
+		GatewayTransactionID: "BOC-778812",
+		Amount:               decimal.RequireFromString("1500.00"),
+		Currency:             "LKR",
+		SettledAt:            time.Date(2026, 10, 16, 9, 15, 2, 0, time.UTC),
+	}, records[0])
+	assert.Equal(t, "2250.5", records[1].Amount.String(), "thousands separator stripped")
+	assert.Equal(t, "LKR", records[1].Currency, "currency upper-cased")
+	assert.Equal(t, 5, records[2].Line, "blank line skipped but counted")
+	assert.Equal(t, "LKR", records[2].Currency, "blank currency defaults to LKR")
+	assert.True(t, records[2].SettledAt.Equal(time.Date(2026, 10, 16, 13, 10, 0, 0, time.UTC)))
+}
+
+func TestGovPay_ParseSettlement_Invalid(t *testing.T) {
+	f, err := os.Open("testdata/govpay_settlement_bad_amount.csv")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = (&GovPayGateway{}).ParseSettlement(context.Background(), f)
+	require.ErrorIs(t, err, ErrSettlementFormat)
+	assert.Contains(t, err.Error(), "line 3")
+
+	cases := map[string]string{
+		"empty":          "",
+		"missing column": "Transaction ID,Currency\nTNSW1,LKR\n",
+		"missing ref":    "Transaction ID,Amount\n,100\n",
+		"bad date":       "Transaction ID,Amount,Settlement Date\nTNSW1,100,16/10/2026\n",
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := (&GovPayGateway{}).ParseSettlement(context.Background(), strings.NewReader(data))
+			assert.ErrorIs(t, err, ErrSettlementFormat)
+		})
+	}
+}
+
+func TestGovPay_RefundIsManual(t *testing.T) {
+	resp, err := (&GovPayGateway{}).Refund(context.Background(), RefundRequest{
+		RefundID:             "rf-1",
+		ReferenceNumber:      "TNSW00000001",
+		GatewayTransactionID: "BOC-778812",
+		Amount:               decimal.RequireFromString("1500"),
+		Currency:             "LKR",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.Manual)
+	assert.False(t, resp.Completed)
+	assert.Contains(t, resp.Instructions, "LKR 1500.00")
+	assert.Contains(t, resp.Instructions, "BOC-778812")
+}
@@ -0,0 +1,437 @@
+package gateways
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// LankaPay request signing headers. Every call to the LankaPay API is signed
+// as hex(HMAC-SHA256(secret_key, timestamp + "." + body)).
+const (
+	lankaPayMerchantHeader  = "X-LankaPay-Merchant-Id"
+	lankaPayTimestampHeader = "X-LankaPay-Timestamp"
+	lankaPaySignatureHeader = "X-LankaPay-Signature"
+)
+
+const defaultLankaPayTimeout = 15 * time.Second
+
+// LankaPayConfig is the "config" block of a LankaPay payment method.
+type LankaPayConfig struct {
+	BaseURL    string `json:"base_url"`
+	MerchantID string `json:"merchant_id"`
+	// SecretKey signs API requests and the browser return parameters.
+	SecretKey string `json:"secret_key"`
+	// ReturnURL is where LankaPay sends the payer's browser, normally NSW's
+	// /api/v1/payments/{gatewayId}/return.
+	ReturnURL string `json:"return_url"`
+	// SuccessURL and CancelURL are the portal pages the return sends the
+	// payer on to when the checkout did not name its own. A checkout's own
+	// pages must be on the origin of one of them.
+	SuccessURL      string                `json:"success_url"`
+	CancelURL       string                `json:"cancel_url"`
+	TimeoutSeconds  int                   `json:"timeout_seconds,omitempty"`
+	WebhookSecurity WebhookSecurityConfig `json:"webhook_security"`
+}
+
+// LankaPayGateway drives LankaPay's hosted checkout. CreateSession registers
+// the NSW reference as the order ID and returns the payment page to redirect
+// the payer to. LankaPay reports the result server to server, signed with the
+// webhook_security secret, and sends the browser back to ReturnURL with
+// signed query parameters.
+type LankaPayGateway struct {
+	cfg      LankaPayConfig
+	verifier *HMACVerifier
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewLankaPayGateway satisfies gateways.Factory.
+func NewLankaPayGateway(raw json.RawMessage) (PaymentGateway, error) {
+	var cfg LankaPayConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.BaseURL == "":
+		return nil, errors.New("lankapay: base_url is required")
+	case cfg.MerchantID == "":
+		return nil, errors.New("lankapay: merchant_id is required")
+	case cfg.SecretKey == "":
+		return nil, errors.New("lankapay: secret_key is required")
+	case cfg.ReturnURL == "":
+		return nil, errors.New("lankapay: return_url is required")
+	}
+	if cfg.TimeoutSeconds < 0 {
+		return nil, errors.New("lankapay: timeout_seconds must not be negative")
+	}
+
+	verifier, err := NewHMACVerifier(cfg.WebhookSecurity)
+	if err != nil {
+		return nil, fmt.Errorf("lankapay: %w", err)
+	}
+
+	timeout := defaultLankaPayTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &LankaPayGateway{
+		cfg:      cfg,
+		verifier: verifier,
+		client:   &http.Client{Timeout: timeout},
+		now:      time.Now,
+	}, nil
+}
+
+func (g *LankaPayGateway) GetFlowType() InteractionType {
+	return FlowTypeRedirect
+}
+
+type lankaPaySessionRequest struct {
+	MerchantID string `json:"merchant_id"`
+	OrderID    string `json:"order_id"`
+	Amount     string `json:"amount"`
+	Currency   string `json:"currency"`
+	ReturnURL  string `json:"return_url"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+}
+
+type lankaPaySessionResponse struct {
+	SessionID  string `json:"session_id"`
+	PaymentURL string `json:"payment_url"`
+}
+
+func (g *LankaPayGateway) CreateSession(ctx context.Context, req SessionRequest) (*SessionResponse, error) {
+	if req.ReferenceNumber == "" {
+		return nil, errors.New("lankapay: reference number is required")
+	}
+	body := lankaPaySessionRequest{
+		MerchantID: g.cfg.MerchantID,
+		OrderID:    req.ReferenceNumber,
+		Amount:     req.Amount.StringFixed(2),
+		Currency:   req.Currency,
+		ReturnURL:  g.cfg.ReturnURL,
+	}
+	if !req.ExpiresAt.IsZero() {
+		body.ExpiresAt = req.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	var resp lankaPaySessionResponse
+	if err := g.call(ctx, "/v1/checkout/sessions", body, &resp); err != nil {
+		return nil, fmt.Errorf("lankapay: create session: %w", err)
+	}
+	if resp.SessionID == "" || resp.PaymentURL == "" {
+		return nil, errors.New("lankapay: create session: response has no session_id or payment_url")
+	}
+
+	return &SessionResponse{
+		SessionID:   resp.SessionID,
+		Type:        FlowTypeRedirect,
+		CheckoutURL: resp.PaymentURL,
+	}, nil
+}
+
+// ParseReturn satisfies ReturnHandler. LankaPay appends order_id, session_id
+// and status to ReturnURL and signs them as
+// hex(HMAC-SHA256(secret_key, "order_id=...&session_id=...&status=...")).
+func (g *LankaPayGateway) ParseReturn(ctx context.Context, query url.Values) (*ReturnResult, error) {
+	orderID, sessionID, rawStatus := query.Get("order_id"), query.Get("session_id"), query.Get("status")
+	if orderID == "" {
+		return nil, fmt.Errorf("%w: order_id is missing", ErrReturnUnauthorized)
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("%w: missing or invalid signature", ErrReturnUnauthorized)
+	}
+	if !hmac.Equal(signature, g.sign([]byte(lankaPayReturnMessage(orderID, sessionID, rawStatus)))) {
+		return nil, fmt.Errorf("%w: missing or invalid signature", ErrReturnUnauthorized)
+	}
+
+	status, err := mapLankaPayStatus(rawStatus)
+	if err != nil {
+		return nil, err
+	}
+	return &ReturnResult{ReferenceNumber: orderID, Status: status}, nil
+}
+
+func (g *LankaPayGateway) LandingPages() (successURL, cancelURL string) {
+	return g.cfg.SuccessURL, g.cfg.CancelURL
+}
+
+// lankaPayReturnMessage is the string LankaPay signs for a browser return.
+func lankaPayReturnMessage(orderID, sessionID, status string) string {
+	return "order_id=" + orderID + "&session_id=" + sessionID + "&status=" + status
+}
+
+func (g *LankaPayGateway) VerifyWebhook(ctx context.Context, req WebhookRequest) (*WebhookAuth, error) {
+	return g.verifier.Verify(req)
+}
+
+type lankaPayNotification struct {
+	MerchantID    string          `json:"merchant_id"`
+	OrderID       string          `json:"order_id"`
+	SessionID     string          `json:"session_id"`
+	TransactionID string          `json:"transaction_id"`
+	Status        string          `json:"status"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	PaymentMethod string          `json:"payment_method"`
+	PaidAt        string          `json:"paid_at"`
+}
+
+func (g *LankaPayGateway) ParseWebhook(ctx context.Context, body []byte, headers map[string][]string) (*WebhookPayload, error) {
+	var n lankaPayNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, err
+	}
+	if n.MerchantID != g.cfg.MerchantID {
+		return nil, fmt.Errorf("%w: notification for merchant %q", ErrWebhookUnauthorized, n.MerchantID)
+	}
+	status, err := mapLankaPayStatus(n.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookPayload{
+		ReferenceNumber:      n.OrderID,
+		SessionID:            n.SessionID,
+		GatewayTransactionID: n.TransactionID,
+		Status:               status,
+		Amount:               n.Amount,
+		Currency:             n.Currency,
+		PaymentMethod:        n.PaymentMethod,
+		Timestamp:            n.PaidAt,
+	}, nil
+}
+
+// mapLankaPayStatus normalizes LankaPay's status vocabulary. A payer who
+// cancels on the payment page is a failed attempt.
+func mapLankaPayStatus(raw string) (WebhookStatus, error) {
+	switch strings.ToUpper(strings.TrimSpace(raw)) {
+	case "APPROVED", "SUCCESS":
+		return WebhookStatusSuccess, nil
+	case "DECLINED", "FAILED", "CANCELLED":
+		return WebhookStatusFailed, nil
+	case "PENDING":
+		return WebhookStatusPending, nil
+	default:
+		return "", fmt.Errorf("lankapay status %q: %w", raw, ErrUnsupportedWebhookStatus)
+	}
+}
+
+// lankaPayOrderCheck is the order lookup LankaPay makes before charging a
+// card, when enabled for the merchant.
+type lankaPayOrderCheck struct {
+	OrderID string `json:"order_id"`
+}
+
+type lankaPayOrderCheckResponse struct {
+	OrderID    string                   `json:"order_id"`
+	Payable    bool                     `json:"payable"`
+	Reason     string                   `json:"reason,omitempty"`
+	Amount     string                   `json:"amount,omitempty"`
+	Currency   string                   `json:"currency,omitempty"`
+	PayerName  string                   `json:"payer_name,omitempty"`
+	MerchantOf string                   `json:"merchant_of,omitempty"`
+	Items      []lankaPayOrderCheckItem `json:"items,omitempty"`
+}
+
+type lankaPayOrderCheckItem struct {
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+}
+
+func (g *LankaPayGateway) ExtractReferenceNumber(ctx context.Context, reqData json.RawMessage) (string, error) {
+	var req lankaPayOrderCheck
+	if err := json.Unmarshal(reqData, &req); err != nil {
+		return "", err
+	}
+	if req.OrderID == "" {
+		return "", fmt.Errorf("order_id is missing in validation request")
+	}
+	return req.OrderID, nil
+}
+
+func (g *LankaPayGateway) HandleValidateReference(ctx context.Context, tx *ValidationTransaction, isPayable bool, reqData json.RawMessage) (*ValidationResponse, error) {
+	var req lankaPayOrderCheck
+	if err := json.Unmarshal(reqData, &req); err != nil {
+		return nil, err
+	}
+
+	resp := lankaPayOrderCheckResponse{OrderID: req.OrderID, Payable: isPayable && tx != nil}
+	if resp.Payable {
+		resp.Amount = tx.Amount.StringFixed(2)
+		resp.Currency = tx.Currency
+		resp.PayerName = tx.TraderName
+		resp.MerchantOf = tx.OGAName
+		for _, line := range tx.Breakdown {
+			resp.Items = append(resp.Items, lankaPayOrderCheckItem{Description: line.Description, Amount: line.Amount.StringFixed(2)})
+		}
+	} else {
+		rejection := RejectionOf(tx)
+		if rejection == "" {
+			rejection = RejectionNotFound
+		}
+		resp.Reason = string(rejection)
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ValidationResponse{Payload: payload, HTTPStatus: http.StatusOK}, nil
+}
+
+// lankaPaySettlementColumns is the layout of LankaPay's merchant settlement
+// report. The order ID is the NSW reference.
+var lankaPaySettlementColumns = SettlementColumns{
+	ReferenceNumber:      "Order ID",
+	GatewayTransactionID: "Transaction ID",
+	Amount:               "Amount",
+	Currency:             "Currency",
+	SettledAt:            "Settlement Date",
+	TimeLayouts:          []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"},
+	DefaultCurrency:      "LKR",
+}
+
+func (g *LankaPayGateway) ParseSettlement(ctx context.Context, r io.Reader) ([]SettlementRecord, error) {
+	return ParseSettlementCSV(r, lankaPaySettlementColumns)
+}
+
+type lankaPayRefundRequest struct {
+	MerchantID       string `json:"merchant_id"`
+	OrderID          string `json:"order_id"`
+	TransactionID    string `json:"transaction_id"`
+	Amount           string `json:"amount"`
+	Currency         string `json:"currency"`
+	Reason           string `json:"reason,omitempty"`
+	MerchantRefundID string `json:"merchant_refund_id"`
+}
+
+type lankaPayRefundResponse struct {
+	RefundID string `json:"refund_id"`
+	Status   string `json:"status"`
+}
+
+// Refund satisfies Refunder. Card refunds are usually completed at once; a
+// refund LankaPay accepts as PENDING is confirmed later by finance. A refund
+// LankaPay answers with a client error or as REJECTED or FAILED is rejected;
+// timeouts, server errors and unknown statuses leave the outcome unknown, and
+// merchant_refund_id keeps a resent request from refunding twice.
+func (g *LankaPayGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResponse, error) {
+	body := lankaPayRefundRequest{
+		MerchantID:       g.cfg.MerchantID,
+		OrderID:          req.ReferenceNumber,
+		TransactionID:    req.GatewayTransactionID,
+		Amount:           req.Amount.StringFixed(2),
+		Currency:         req.Currency,
+		Reason:           req.Reason,
+		MerchantRefundID: req.RefundID,
+	}
+
+	var resp lankaPayRefundResponse
+	if err := g.call(ctx, "/v1/refunds", body, &resp); err != nil {
+		var apiErr *lankaPayAPIError
+		if errors.As(err, &apiErr) && apiErr.rejected() {
+			return nil, fmt.Errorf("lankapay: refund: %w: %w", ErrRefundRejected, err)
+		}
+		return nil, fmt.Errorf("lankapay: refund: %w", err)
+	}
+	switch strings.ToUpper(resp.Status) {
+	case "COMPLETED":
+		return &RefundResponse{GatewayRefundID: resp.RefundID, Completed: true}, nil
+	case "PENDING":
+		return &RefundResponse{GatewayRefundID: resp.RefundID}, nil
+	case "REJECTED", "FAILED":
+		return nil, fmt.Errorf("lankapay: refund %s: %w: status %q", resp.RefundID, ErrRefundRejected, resp.Status)
+	default:
+		return nil, fmt.Errorf("lankapay: refund %s: status %q", resp.RefundID, resp.Status)
+	}
+}
+
+// call POSTs a signed JSON request to the LankaPay API and decodes the reply
+// into out.
+func (g *LankaPayGateway) call(ctx context.Context, path string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(g.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(lankaPayMerchantHeader, g.cfg.MerchantID)
+	req.Header.Set(lankaPayTimestampHeader, timestamp)
+	req.Header.Set(lankaPaySignatureHeader, hex.EncodeToString(g.sign([]byte(timestamp+"."), body)))
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		callErr := &lankaPayAPIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(raw, &apiErr) == nil {
+			callErr.Code, callErr.Message = apiErr.Error.Code, apiErr.Error.Message
+		}
+		return callErr
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// lankaPayAPIError is a non-2xx reply of the LankaPay API.
+type lankaPayAPIError struct {
+	StatusCode    int
+	Code, Message string
+}
+
+func (e *lankaPayAPIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("HTTP %d: %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// rejected reports whether LankaPay refused the request itself, rather than
+// failing or timing out while handling it.
+func (e *lankaPayAPIError) rejected() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+func (g *LankaPayGateway) sign(parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, []byte(g.cfg.SecretKey))
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
@@ -0,0 +1,305 @@
+package gateways
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testLankaPayKey      = "lp-secret"
+	testLankaPayHookKey  = "lp-webhook-secret"
+	testLankaPayMerchant = "M-100"
+)
+
+func hmacHex(key, msg string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lankaPayStub stands in for the LankaPay API. It checks every request is
+// signed by the merchant and hands the decoded body to handle.
+func lankaPayStub(t *testing.T, handle func(path string, body map[string]any) (int, string)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, testLankaPayMerchant, r.Header.Get("X-LankaPay-Merchant-Id"))
+		assert.Equal(t, hmacHex(testLankaPayKey, r.Header.Get("X-LankaPay-Timestamp")+"."+string(raw)), r.Header.Get("X-LankaPay-Signature"))
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(raw, &body))
+		status, reply := handle(r.URL.Path, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(reply))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestLankaPay(t *testing.T, baseURL string) *LankaPayGateway {
+	t.Helper()
+	cfg, err := json.Marshal(LankaPayConfig{
+		BaseURL:         baseURL,
+		MerchantID:      testLankaPayMerchant,
+		SecretKey:       testLankaPayKey,
+		ReturnURL:       "https://nsw.example/api/v1/payments/returns/lankapay",
+		SuccessURL:      "https://portal.example/payments/done",
+		CancelURL:       "https://portal.example/payments/cancelled",
+		WebhookSecurity: WebhookSecurityConfig{Secret: testLankaPayHookKey},
+	})
+	require.NoError(t, err)
+	gw, err := NewLankaPayGateway(cfg)
+	require.NoError(t, err)
+	return gw.(*LankaPayGateway)
+}
+
+func TestNewLankaPayGateway_RequiresConfig(t *testing.T) {
+	cases := map[string]string{
+		"base_url":         `{"merchant_id":"m","secret_key":"k","return_url":"r","webhook_security":{"secret":"s"}}`,
+		"merchant_id":      `{"base_url":"u","secret_key":"k","return_url":"r","webhook_security":{"secret":"s"}}`,
+		"secret_key":       `{"base_url":"u","merchant_id":"m","return_url":"r","webhook_security":{"secret":"s"}}`,
+		"return_url":       `{"base_url":"u","merchant_id":"m","secret_key":"k","webhook_security":{"secret":"s"}}`,
+		"webhook_security": `{"base_url":"u","merchant_id":"m","secret_key":"k","return_url":"r"}`,
+	}
+	for field, cfg := range cases {
+		t.Run(field, func(t *testing.T) {
+			_, err := NewLankaPayGateway(json.RawMessage(cfg))
+			assert.ErrorContains(t, err, field)
+		})
+	}
+}
+
+func TestLankaPay_CreateSession(t *testing.T) {
+	expires := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	srv := lankaPayStub(t, func(path string, body map[string]any) (int, string) {
+		assert.Equal(t, "/v1/checkout/sessions", path)
+		assert.Equal(t, map[string]any{
+			"merchant_id": testLankaPayMerchant,
+			"order_id":    "TNSW1",
+			"amount":      "1500.00",
+			"currency":    "LKR",
+			"return_url":  "https://nsw.example/api/v1/payments/returns/lankapay",
+			"expires_at":  "2026-10-18T09:00:00Z",
+		}, body)
+		return http.StatusCreated, `{"session_id":"cs_1","payment_url":"https://pay.lankapay.test/cs_1"}`
+	})
+	g := newTestLankaPay(t, srv.URL)
+	assert.Equal(t, FlowTypeRedirect, g.GetFlowType())
+
+	resp, err := g.CreateSession(context.Background(), SessionRequest{
+		ReferenceNumber: "TNSW1",
+		Amount:          decimal.RequireFromString("1500"),
+		Currency:        "LKR",
+		ExpiresAt:       expires,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &SessionResponse{SessionID: "cs_1", Type: FlowTypeRedirect, CheckoutURL: "https://pay.lankapay.test/cs_1"}, resp)
+}
+
+func TestLankaPay_CreateSession_Errors(t *testing.T) {
+	t.Run("API error is surfaced", func(t *testing.T) {
+		srv := lankaPayStub(t, func(string, map[string]any) (int, string) {
+			return http.StatusUnprocessableEntity, `{"error":{"code":"INVALID_AMOUNT","message":"amount below minimum"}}`
+		})
+		_, err := newTestLankaPay(t, srv.URL).CreateSession(context.Background(), SessionRequest{ReferenceNumber: "TNSW1", Amount: decimal.NewFromInt(1), Currency: "LKR"})
+		assert.ErrorContains(t, err, "HTTP 422: INVALID_AMOUNT: amount below minimum")
+	})
+
+	t.Run("response without a payment page", func(t *testing.T) {
+		srv := lankaPayStub(t, func(string, map[string]any) (int, string) { return http.StatusOK, `{"session_id":"cs_1"}` })
+		_, err := newTestLankaPay(t, srv.URL).CreateSession(context.Background(), SessionRequest{ReferenceNumber: "TNSW1", Amount: decimal.NewFromInt(1), Currency: "LKR"})
+		assert.ErrorContains(t, err, "payment_url")
+	})
+
+	t.Run("reference is required", func(t *testing.T) {
+		_, err := newTestLankaPay(t, "http://unused.invalid").CreateSession(context.Background(), SessionRequest{Amount: decimal.NewFromInt(1)})
+		assert.ErrorContains(t, err, "reference number is required")
+	})
+}
+
+func signedReturn(orderID, sessionID, status string) url.Values {
+	return url.Values{
+		"order_id":   {orderID},
+		"session_id": {sessionID},
+		"status":     {status},
+		"signature":  {hmacHex(testLankaPayKey, "order_id="+orderID+"&session_id="+sessionID+"&status="+status)},
+	}
+}
+
+func TestLankaPay_ParseReturn(t *testing.T) {
+	g := newTestLankaPay(t, "http://unused.invalid")
+
+	res, err := g.ParseReturn(context.Background(), signedReturn("TNSW1", "cs_1", "APPROVED"))
+	require.NoError(t, err)
+	assert.Equal(t, &ReturnResult{ReferenceNumber: "TNSW1", Status: WebhookStatusSuccess}, res)
+	successURL, cancelURL := g.LandingPages()
+	assert.Equal(t, "https://portal.example/payments/done", successURL)
+	assert.Equal(t, "https://portal.example/payments/cancelled", cancelURL)
+
+	res, err = g.ParseReturn(context.Background(), signedReturn("TNSW1", "cs_1", "CANCELLED"))
+	require.NoError(t, err)
+	assert.Equal(t, WebhookStatusFailed, res.Status)
+
+	tampered := signedReturn("TNSW1", "cs_1", "DECLINED")
+	tampered.Set("status", "APPROVED")
+	_, err = g.ParseReturn(context.Background(), tampered)
+	assert.ErrorIs(t, err, ErrReturnUnauthorized)
+
+	unsigned := signedReturn("TNSW1", "cs_1", "APPROVED")
+	unsigned.Del("signature")
+	_, err = g.ParseReturn(context.Background(), unsigned)
+	assert.ErrorIs(t, err, ErrReturnUnauthorized)
+}
+
+func TestLankaPay_Notification(t *testing.T) {
+	g := newTestLankaPay(t, "http://unused.invalid")
+	body := []byte(`{"merchant_id":"M-100","order_id":"TNSW1","session_id":"cs_1","transaction_id":"LP-778","status":"APPROVED","amount":"1500.00","currency":"LKR","payment_method":"VISA","paid_at":"2026-10-17T08:00:00Z"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string][]string{
+		DefaultTimestampHeader: {timestamp},
+		DefaultNonceHeader:     {"n-1"},
+		DefaultSignatureHeader: {hex.EncodeToString(SignWebhook([]byte(testLankaPayHookKey), timestamp, "n-1", body))},
+	}
+
+	auth, err := g.VerifyWebhook(context.Background(), WebhookRequest{Body: body, Headers: headers})
+	require.NoError(t, err)
+	assert.Equal(t, "n-1", auth.Nonce)
+
+	p, err := g.ParseWebhook(context.Background(), body, headers)
+	require.NoError(t, err)
+	assert.Equal(t, "TNSW1", p.ReferenceNumber)
+	assert.Equal(t, "LP-778", p.GatewayTransactionID)
+	assert.Equal(t, WebhookStatusSuccess, p.Status)
+	assert.Equal(t, "VISA", p.PaymentMethod)
+	assert.True(t, p.Amount.Equal(decimal.RequireFromString("1500")))
+
+	t.Run("signed with the API key instead of the webhook secret", func(t *testing.T) {
+		forged := map[string][]string{
+			DefaultTimestampHeader: {timestamp},
+			DefaultNonceHeader:     {"n-2"},
+			DefaultSignatureHeader: {hex.EncodeToString(SignWebhook([]byte(testLankaPayKey), timestamp, "n-2", body))},
+		}
+		_, err := g.VerifyWebhook(context.Background(), WebhookRequest{Body: body, Headers: forged})
+		assert.ErrorIs(t, err, ErrWebhookSignature)
+	})
+
+	t.Run("another merchant's notification", func(t *testing.T) {
+		_, err := g.ParseWebhook(context.Background(), []byte(strings.Replace(string(body), "M-100", "M-999", 1)), nil)
+		assert.ErrorIs(t, err, ErrWebhookUnauthorized)
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		_, err := g.ParseWebhook(context.Background(), []byte(`{"merchant_id":"M-100","status":"ON_HOLD"}`), nil)
+		assert.ErrorIs(t, err, ErrUnsupportedWebhookStatus)
+	})
+}
+
+func TestLankaPay_OrderCheck(t *testing.T) {
+	g := newTestLankaPay(t, "http://unused.invalid")
+	req := json.RawMessage(`{"order_id":"TNSW1"}`)
+
+	ref, err := g.ExtractReferenceNumber(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "TNSW1", ref)
+
+	resp, err := g.HandleValidateReference(context.Background(), &ValidationTransaction{ReferenceNumber: "TNSW1", Amount: decimal.NewFromInt(1500), Currency: "LKR"}, true, req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order_id":"TNSW1","payable":true,"amount":"1500.00","currency":"LKR"}`, string(resp.Payload))
+
+	resp, err = g.HandleValidateReference(context.Background(), &ValidationTransaction{
+		ReferenceNumber: "TNSW1", Amount: decimal.NewFromInt(1500), Currency: "LKR",
+		TraderName: "Ceylon Spice Exports", OGAName: "FCAU",
+		Breakdown: []ValidationLine{{Description: "Inspection fee", Amount: decimal.NewFromInt(1500)}},
+	}, true, req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order_id":"TNSW1","payable":true,"amount":"1500.00","currency":"LKR",
+		"payer_name":"Ceylon Spice Exports","merchant_of":"FCAU",
+		"items":[{"description":"Inspection fee","amount":"1500.00"}]}`, string(resp.Payload))
+
+	resp, err = g.HandleValidateReference(context.Background(), nil, false, req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order_id":"TNSW1","payable":false,"reason":"REFERENCE_NOT_FOUND"}`, string(resp.Payload))
+
+	resp, err = g.HandleValidateReference(context.Background(), &ValidationTransaction{ReferenceNumber: "TNSW1", Rejection: RejectionAlreadyPaid}, false, req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order_id":"TNSW1","payable":false,"reason":"REFERENCE_ALREADY_PAID"}`, string(resp.Payload))
+
+	_, err = g.ExtractReferenceNumber(context.Background(), json.RawMessage(`{}`))
+	assert.Error(t, err)
+}
+
+func TestLankaPay_Refund(t *testing.T) {
+	req := RefundRequest{
+		RefundID:             "rf-1",
+		ReferenceNumber:      "TNSW1",
+		GatewayTransactionID: "LP-778",
+		Amount:               decimal.RequireFromString("250"),
+		Currency:             "LKR",
+		Reason:               "duplicate payment",
+	}
+	cases := map[string]struct {
+		code     int
+		reply    string
+		want     *RefundResponse
+		wantErr  string
+		rejected bool
+	}{
+		"completed":   {reply: `{"refund_id":"LR-1","status":"COMPLETED"}`, want: &RefundResponse{GatewayRefundID: "LR-1", Completed: true}},
+		"pending":     {reply: `{"refund_id":"LR-1","status":"PENDING"}`, want: &RefundResponse{GatewayRefundID: "LR-1"}},
+		"rejected":    {reply: `{"refund_id":"LR-1","status":"REJECTED"}`, wantErr: `status "REJECTED"`, rejected: true},
+		"unknown":     {reply: `{"refund_id":"LR-1","status":"ON_HOLD"}`, wantErr: `status "ON_HOLD"`},
+		"declined":    {code: http.StatusUnprocessableEntity, reply: `{"error":{"code":"ALREADY_REFUNDED","message":"refunded"}}`, wantErr: "ALREADY_REFUNDED", rejected: true},
+		"unavailable": {code: http.StatusServiceUnavailable, reply: `{}`, wantErr: "HTTP 503"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := lankaPayStub(t, func(path string, body map[string]any) (int, string) {
+				assert.Equal(t, "/v1/refunds", path)
+				assert.Equal(t, "rf-1", body["merchant_refund_id"])
+				assert.Equal(t, "LP-778", body["transaction_id"])
+				assert.Equal(t, "250.00", body["amount"])
+				if tc.code != 0 {
+					return tc.code, tc.reply
+				}
+				return http.StatusOK, tc.reply
+			})
+			var refunder Refunder = newTestLankaPay(t, srv.URL)
+			got, err := refunder.Refund(context.Background(), req)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				assert.Equal(t, tc.rejected, errors.Is(err, ErrRefundRejected))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLankaPay_ParseSettlement(t *testing.T) {
+	csv := "Order ID,Transaction ID,Amount,Currency,Settlement Date\nTNSW1,LP-778,1500.00,LKR,2026-10-17\n"
+	records, err := newTestLankaPay(t, "http://unused.invalid").ParseSettlement(context.Background(), strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "TNSW1", records[0].ReferenceNumber)
+	assert.Equal(t, "LP-778", records[0].GatewayTransactionID)
+}
@@ -0,0 +1,49 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrRefundUnsupported indicates a gateway that cannot return money, not even
+// through a manual process.
+var ErrRefundUnsupported = errors.New("gateway does not support refunds")
+
+// ErrRefundRejected indicates a gateway that declined a refund outright, so no
+// money was returned.
+var ErrRefundRejected = errors.New("gateway rejected the refund")
+
+// RefundRequest asks a gateway to return all or part of a settled payment.
+type RefundRequest struct {
+	// RefundID is the NSW refund identifier; gateways that accept an
+	// idempotency key should pass it on.
+	RefundID             string          `json:"refund_id"`
+	ReferenceNumber      string          `json:"reference_number"`
+	GatewayTransactionID string          `json:"gateway_transaction_id"`
+	Amount               decimal.Decimal `json:"amount"`
+	Currency             string          `json:"currency"`
+	Reason               string          `json:"reason"`
+}
+
+// RefundResponse is a gateway's answer to a RefundRequest.
+type RefundResponse struct {
+	GatewayRefundID string `json:"gateway_refund_id,omitempty"`
+	// Completed reports the money was returned synchronously. Otherwise the
+	// refund stays pending until it is confirmed.
+	Completed bool `json:"completed"`
+	// Manual reports the gateway has no refund API: an officer must return the
+	// money out of band and confirm the refund in NSW.
+	Manual       bool   `json:"manual"`
+	Instructions string `json:"instructions,omitempty"`
+}
+
+// Refunder is the optional refund capability of a PaymentGateway. Gateways
+// that do not implement it cannot be refunded through NSW.
+type Refunder interface {
+	// Refund must return an error wrapping ErrRefundRejected when the gateway
+	// declines the refund. Any other error, such as a timeout, leaves the
+	// outcome unknown: the request is sent again with the same RefundID.
+	Refund(ctx context.Context, req RefundRequest) (*RefundResponse, error)
+}
@@ -0,0 +1,32 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// ErrReturnUnauthorized indicates a browser return whose parameters could not
+// be proven to come from the gateway.
+var ErrReturnUnauthorized = errors.New("payment return authentication failed")
+
+// ReturnResult is a verified browser return from a hosted checkout.
+type ReturnResult struct {
+	ReferenceNumber string
+	// Status is what the gateway told the browser. It only decides where the
+	// payer is sent next; the transaction is settled by the notification.
+	Status WebhookStatus
+}
+
+// ReturnHandler is the optional capability of a redirect gateway whose hosted
+// checkout sends the payer's browser back to NSW once they finish or abandon
+// the payment.
+type ReturnHandler interface {
+	// ParseReturn verifies the query string of a browser return. It must
+	// return an error wrapping ErrReturnUnauthorized when the parameters are
+	// not signed by the gateway.
+	ParseReturn(ctx context.Context, query url.Values) (*ReturnResult, error)
+	// LandingPages returns the gateway's configured pages for paid and failed
+	// checkouts. A checkout may name its own pages only on their origins.
+	LandingPages() (successURL, cancelURL string)
+}
@@ -0,0 +1,152 @@
+package gateways
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrSettlementFormat indicates a settlement file that could not be parsed:
+// a missing column, a malformed row, or a file that is not CSV at all.
+var ErrSettlementFormat = errors.New("invalid settlement file")
+
+// SettlementRecord is one payment a gateway reports as settled to NSW,
+// normalized from the gateway's settlement file.
+type SettlementRecord struct {
+	// Line is the 1-based line of the record in the source file.
+	Line                 int             `json:"line"`
+	ReferenceNumber      string          `json:"reference_number"`
+	GatewayTransactionID string          `json:"gateway_transaction_id"`
+	Amount               decimal.Decimal `json:"amount"`
+	Currency             string          `json:"currency"`
+	SettledAt            time.Time       `json:"settled_at"`
+}
+
+// SettlementColumns maps a gateway's CSV header names onto SettlementRecord
+// fields. Header matching is case-insensitive; GatewayTransactionID and
+// SettledAt are optional.
+type SettlementColumns struct {
+	ReferenceNumber      string
+	GatewayTransactionID string
+	Amount               string
+	Currency             string
+	SettledAt            string
+	// TimeLayouts are tried in order to parse SettledAt.
+	TimeLayouts []string
+	// DefaultCurrency is used when Currency is empty or the cell is blank.
+	DefaultCurrency string
+}
+
+// ParseSettlementCSV reads a headed CSV settlement file using cols. Blank lines
+// are skipped; any malformed row fails the whole file so a partial import can't
+// masquerade as a reconciled period.
+func ParseSettlementCSV(r io.Reader, cols SettlementColumns) ([]SettlementRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: empty file", ErrSettlementFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSettlementFormat, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff") // Excel exports lead with a BOM
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(name string, required bool) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := index[strings.ToLower(name)]
+		if !ok && required {
+			return -1, fmt.Errorf("%w: missing column %q", ErrSettlementFormat, name)
+		}
+		if !ok {
+			return -1, nil
+		}
+		return i, nil
+	}
+
+	refCol, err := column(cols.ReferenceNumber, true)
+	if err != nil {
+		return nil, err
+	}
+	amountCol, err := column(cols.Amount, true)
+	if err != nil {
+		return nil, err
+	}
+	currencyCol, _ := column(cols.Currency, false)
+	txnCol, _ := column(cols.GatewayTransactionID, false)
+	settledCol, _ := column(cols.SettledAt, false)
+	if currencyCol < 0 && cols.DefaultCurrency == "" {
+		return nil, fmt.Errorf("%w: missing column %q", ErrSettlementFormat, cols.Currency)
+	}
+
+	var records []SettlementRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSettlementFormat, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		cell := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		rec := SettlementRecord{
+			Line:                 line,
+			ReferenceNumber:      cell(refCol),
+			GatewayTransactionID: cell(txnCol),
+			Currency:             strings.ToUpper(cell(currencyCol)),
+		}
+		if rec.ReferenceNumber == "" {
+			return nil, fmt.Errorf("%w: line %d: missing reference", ErrSettlementFormat, line)
+		}
+		if rec.Currency == "" {
+			rec.Currency = cols.DefaultCurrency
+		}
+		// Settlement files often carry thousands separators ("1,500.00").
+		rec.Amount, err = decimal.NewFromString(strings.ReplaceAll(cell(amountCol), ",", ""))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: amount %q", ErrSettlementFormat, line, cell(amountCol))
+		}
+		if raw := cell(settledCol); raw != "" {
+			if rec.SettledAt, err = parseSettlementTime(raw, cols.TimeLayouts); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %w", ErrSettlementFormat, line, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func parseSettlementTime(raw string, layouts []string) (time.Time, error) {
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("settlement time %q", raw)
+}
@@ -0,0 +1,231 @@
+package gateways
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWebhookUnauthorized is the base error for a webhook that failed
+// authentication. Handlers map it to 401; the specific causes below wrap it.
+var ErrWebhookUnauthorized = errors.New("webhook authentication failed")
+
+var (
+	ErrWebhookSignature = fmt.Errorf("%w: missing or invalid signature", ErrWebhookUnauthorized)
+	ErrWebhookTimestamp = fmt.Errorf("%w: missing or stale timestamp", ErrWebhookUnauthorized)
+	ErrWebhookNonce     = fmt.Errorf("%w: missing nonce", ErrWebhookUnauthorized)
+	ErrWebhookSourceIP  = fmt.Errorf("%w: source address not allowed", ErrWebhookUnauthorized)
+)
+
+// Defaults applied when a gateway's webhook_security config leaves a field unset.
+const (
+	DefaultSignatureHeader  = "X-NSW-Signature"
+	DefaultTimestampHeader  = "X-NSW-Timestamp"
+	DefaultNonceHeader      = "X-NSW-Nonce"
+	DefaultWebhookTolerance = 5 * time.Minute
+)
+
+// WebhookRequest is an inbound gateway notification as received over HTTP.
+type WebhookRequest struct {
+	Body    []byte
+	Headers map[string][]string
+	// RemoteAddr is the IP of the directly connected peer.
+	RemoteAddr string
+}
+
+// WebhookAuth is the verified identity of a webhook delivery. The caller uses
+// Nonce for replay protection; it only needs remembering until ExpiresAt, after
+// which the timestamp check rejects the delivery on its own.
+type WebhookAuth struct {
+	Nonce     string
+	Timestamp time.Time
+	ExpiresAt time.Time
+}
+
+// WebhookSecurityConfig is the per-gateway "webhook_security" block of the
+// payment methods config.
+type WebhookSecurityConfig struct {
+	// Secret is the HMAC-SHA256 key shared with the gateway.
+	Secret          string `json:"secret"`
+	SignatureHeader string `json:"signature_header,omitempty"`
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+	NonceHeader     string `json:"nonce_header,omitempty"`
+	// ToleranceSeconds bounds the allowed clock skew between the gateway's
+	// timestamp and ours. Defaults to DefaultWebhookTolerance.
+	ToleranceSeconds int `json:"tolerance_seconds,omitempty"`
+	// AllowedIPs optionally restricts deliveries to these addresses or CIDR
+	// ranges. Empty allows any source.
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+	// ClientIPHeader names a header set by a trusted reverse proxy (e.g.
+	// X-Forwarded-For) to take the source address from instead of the peer.
+	// The last entry is used, as that is the one the nearest proxy appended.
+	ClientIPHeader string `json:"client_ip_header,omitempty"`
+}
+
+// HMACVerifier authenticates webhooks signed as
+//
+//	hex(HMAC-SHA256(secret, timestamp + "." + nonce + "." + body))
+//
+// over the raw request body. Binding the timestamp and nonce into the signed
+// message stops them from being swapped to dodge the tolerance or replay checks.
+type HMACVerifier struct {
+	secret          []byte
+	signatureHeader string
+	timestampHeader string
+	nonceHeader     string
+	tolerance       time.Duration
+	allowed         []netip.Prefix
+	clientIPHeader  string
+	now             func() time.Time
+}
+
+// NewHMACVerifier builds a verifier from a gateway's webhook_security config.
+// A secret is mandatory: gateways cannot opt out of signed webhooks.
+func NewHMACVerifier(cfg WebhookSecurityConfig) (*HMACVerifier, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("webhook_security.secret is required")
+	}
+	if cfg.ToleranceSeconds < 0 {
+		return nil, errors.New("webhook_security.tolerance_seconds must not be negative")
+	}
+
+	v := &HMACVerifier{
+		secret:          []byte(cfg.Secret),
+		signatureHeader: orDefault(cfg.SignatureHeader, DefaultSignatureHeader),
+		timestampHeader: orDefault(cfg.TimestampHeader, DefaultTimestampHeader),
+		nonceHeader:     orDefault(cfg.NonceHeader, DefaultNonceHeader),
+		tolerance:       DefaultWebhookTolerance,
+		clientIPHeader:  cfg.ClientIPHeader,
+		now:             time.Now,
+	}
+	if cfg.ToleranceSeconds > 0 {
+		v.tolerance = time.Duration(cfg.ToleranceSeconds) * time.Second
+	}
+
+	for _, entry := range cfg.AllowedIPs {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("webhook_security.allowed_ips: %w", err)
+		}
+		v.allowed = append(v.allowed, prefix)
+	}
+	return v, nil
+}
+
+// Verify checks the source address, timestamp and signature of req, in that
+// order, and returns the delivery's nonce for the caller's replay check.
+func (v *HMACVerifier) Verify(req WebhookRequest) (*WebhookAuth, error) {
+	if len(v.allowed) > 0 {
+		ip, ok := v.sourceIP(req)
+		if !ok || !v.ipAllowed(ip) {
+			return nil, ErrWebhookSourceIP
+		}
+	}
+
+	rawTimestamp := headerValue(req.Headers, v.timestampHeader)
+	seconds, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return nil, ErrWebhookTimestamp
+	}
+	timestamp := time.Unix(seconds, 0)
+	if skew := v.now().Sub(timestamp).Abs(); skew > v.tolerance {
+		return nil, ErrWebhookTimestamp
+	}
+
+	nonce := headerValue(req.Headers, v.nonceHeader)
+	if nonce == "" {
+		return nil, ErrWebhookNonce
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(headerValue(req.Headers, v.signatureHeader), "sha256="))
+	if err != nil || len(signature) == 0 {
+		return nil, ErrWebhookSignature
+	}
+	if !hmac.Equal(signature, SignWebhook(v.secret, rawTimestamp, nonce, req.Body)) {
+		return nil, ErrWebhookSignature
+	}
+
+	return &WebhookAuth{Nonce: nonce, Timestamp: timestamp, ExpiresAt: timestamp.Add(v.tolerance)}, nil
+}
+
+// SignWebhook computes the raw HMAC the verifier expects for a delivery.
+func SignWebhook(secret []byte, timestamp, nonce string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (v *HMACVerifier) sourceIP(req WebhookRequest) (netip.Addr, bool) {
+	raw := req.RemoteAddr
+	if v.clientIPHeader != "" {
+		var hops []string
+		for key, values := range req.Headers {
+			if strings.EqualFold(key, v.clientIPHeader) {
+				for _, value := range values {
+					hops = append(hops, strings.Split(value, ",")...)
+				}
+			}
+		}
+		if len(hops) == 0 {
+			return netip.Addr{}, false
+		}
+		raw = strings.TrimSpace(hops[len(hops)-1])
+	}
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+	ip, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+func (v *HMACVerifier) ipAllowed(ip netip.Addr) bool {
+	for _, prefix := range v.allowed {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		return netip.ParsePrefix(entry)
+	}
+	ip, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()), nil
+}
+
+// headerValue returns the first value of a header, matching the name
+// case-insensitively since callers may pass a raw map rather than http.Header.
+func headerValue(headers map[string][]string, name string) string {
+	for key, values := range headers {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+	}
+	return ""
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
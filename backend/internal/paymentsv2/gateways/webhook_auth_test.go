@@ -0,0 +1,212 @@
+package gateways
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedRequest builds a delivery signed with secret using the default headers.
+func signedRequest(secret string, at time.Time, nonce string, body []byte) WebhookRequest {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return WebhookRequest{
+		Body: body,
+		Headers: map[string][]string{
+			DefaultTimestampHeader: {ts},
+			DefaultNonceHeader:     {nonce},
+			DefaultSignatureHeader: {hex.EncodeToString(SignWebhook([]byte(secret), ts, nonce, body))},
+		},
+		RemoteAddr: "198.51.100.10:443",
+	}
+}
+
+func newTestVerifier(t *testing.T, cfg WebhookSecurityConfig, now time.Time) *HMACVerifier {
+	t.Helper()
+	v, err := NewHMACVerifier(cfg)
+	require.NoError(t, err)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestHMACVerifier_Verify(t *testing.T) {
+	now := time.Unix(1_760_000_000, 0)
+	body := []byte(`{"reference_number":"TNSW1","status":"paid"}`)
+	v := newTestVerifier(t, WebhookSecurityConfig{Secret: "s3cret", ToleranceSeconds: 60}, now)
+
+	t.Run("valid", func(t *testing.T) {
+		auth, err := v.Verify(signedRequest("s3cret", now.Add(-30*time.Second), "n-1", body))
+		require.NoError(t, err)
+		assert.Equal(t, "n-1", auth.Nonce)
+		assert.Equal(t, now.Add(-30*time.Second), auth.Timestamp)
+		assert.Equal(t, now.Add(30*time.Second), auth.ExpiresAt)
+	})
+
+	t.Run("sha256= prefix and lower-case header names", func(t *testing.T) {
+		req := signedRequest("s3cret", now, "n-2", body)
+		req.Headers = map[string][]string{
+			"x-nsw-timestamp": req.Headers[DefaultTimestampHeader],
+			"x-nsw-nonce":     req.Headers[DefaultNonceHeader],
+			"x-nsw-signature": {"sha256=" + req.Headers[DefaultSignatureHeader][0]},
+		}
+		_, err := v.Verify(req)
+		require.NoError(t, err)
+	})
+
+	failures := map[string]struct {
+		req  func() WebhookRequest
+		want error
+	}{
+		"unsigned": {
+			req: func() WebhookRequest {
+				req := signedRequest("s3cret", now, "n-1", body)
+				delete(req.Headers, DefaultSignatureHeader)
+				return req
+			},
+			want: ErrWebhookSignature,
+		},
+		"malformed signature": {
+			req: func() WebhookRequest {
+				req := signedRequest("s3cret", now, "n-1", body)
+				req.Headers[DefaultSignatureHeader] = []string{"not-hex"}
+				return req
+			},
+			want: ErrWebhookSignature,
+		},
+		"wrong secret": {
+			req:  func() WebhookRequest { return signedRequest("other", now, "n-1", body) },
+			want: ErrWebhookSignature,
+		},
+		"tampered body": {
+			req: func() WebhookRequest {
+				req := signedRequest("s3cret", now, "n-1", body)
+				req.Body = []byte(`{"reference_number":"TNSW1","status":"paid","amount":"1"}`)
+				return req
+			},
+			want: ErrWebhookSignature,
+		},
+		"nonce swapped after signing": {
+			req: func() WebhookRequest {
+				req := signedRequest("s3cret", now, "n-1", body)
+				req.Headers[DefaultNonceHeader] = []string{"n-fresh"}
+				return req
+			},
+			want: ErrWebhookSignature,
+		},
+		"timestamp swapped after signing": {
+			req: func() WebhookRequest {
+				req := signedRequest("s3cret", now.Add(-time.Hour), "n-1", body)
+				req.Headers[DefaultTimestampHeader] = []string{strconv.FormatInt(now.Unix(), 10)}
+				return req
+			},
+			want: ErrWebhookSignature,
+		},
+		"missing timestamp": {
+			req: func() WebhookRequest {
+				req := signedRequest("s3cret", now, "n-1", body)
+				delete(req.Headers, DefaultTimestampHeader)
+				return req
+			},
+			want: ErrWebhookTimestamp,
+		},
+		"stale timestamp": {
+			req:  func() WebhookRequest { return signedRequest("s3cret", now.Add(-2*time.Minute), "n-1", body) },
+			want: ErrWebhookTimestamp,
+		},
+		"future timestamp": {
+			req:  func() WebhookRequest { return signedRequest("s3cret", now.Add(2*time.Minute), "n-1", body) },
+			want: ErrWebhookTimestamp,
+		},
+		"missing nonce": {
+			req:  func() WebhookRequest { return signedRequest("s3cret", now, "", body) },
+			want: ErrWebhookNonce,
+		},
+	}
+	for name, tc := range failures {
+		t.Run(name, func(t *testing.T) {
+			_, err := v.Verify(tc.req())
+			require.ErrorIs(t, err, tc.want)
+			require.ErrorIs(t, err, ErrWebhookUnauthorized)
+		})
+	}
+}
+
+func TestHMACVerifier_AllowedIPs(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{}`)
+	v := newTestVerifier(t, WebhookSecurityConfig{
+		Secret:     "s3cret",
+		AllowedIPs: []string{"198.51.100.0/24", "2001:db8::1"},
+	}, now)
+
+	cases := map[string]struct {
+		remote string
+		ok     bool
+	}{
+		"in cidr":          {remote: "198.51.100.10:443", ok: true},
+		"exact ipv6":       {remote: "[2001:db8::1]:443", ok: true},
+		"ipv4-mapped ipv6": {remote: "[::ffff:198.51.100.20]:443", ok: true},
+		"outside":          {remote: "203.0.113.5:443", ok: false},
+		"unparseable":      {remote: "somewhere", ok: false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := signedRequest("s3cret", now, "n-1", body)
+			req.RemoteAddr = tc.remote
+			_, err := v.Verify(req)
+			if tc.ok {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrWebhookSourceIP)
+		})
+	}
+
+	t.Run("checked before the signature", func(t *testing.T) {
+		_, err := v.Verify(WebhookRequest{RemoteAddr: "203.0.113.5:443"})
+		require.ErrorIs(t, err, ErrWebhookSourceIP)
+	})
+}
+
+func TestHMACVerifier_ClientIPHeader(t *testing.T) {
+	now := time.Now()
+	v := newTestVerifier(t, WebhookSecurityConfig{
+		Secret:         "s3cret",
+		AllowedIPs:     []string{"198.51.100.10"},
+		ClientIPHeader: "X-Forwarded-For",
+	}, now)
+
+	req := signedRequest("s3cret", now, "n-1", []byte(`{}`))
+	req.RemoteAddr = "10.0.0.2:5000" // the proxy
+	req.Headers["X-Forwarded-For"] = []string{"203.0.113.5, 198.51.100.10"}
+	_, err := v.Verify(req)
+	require.NoError(t, err, "the proxy-appended (last) hop is the source")
+
+	req.Headers["X-Forwarded-For"] = []string{"198.51.100.10, 203.0.113.5"}
+	_, err = v.Verify(req)
+	require.ErrorIs(t, err, ErrWebhookSourceIP, "a client-supplied leading hop must not be trusted")
+
+	delete(req.Headers, "X-Forwarded-For")
+	_, err = v.Verify(req)
+	require.ErrorIs(t, err, ErrWebhookSourceIP)
+}
+
+func TestNewHMACVerifier_Config(t *testing.T) {
+	_, err := NewHMACVerifier(WebhookSecurityConfig{})
+	require.ErrorContains(t, err, "secret")
+
+	_, err = NewHMACVerifier(WebhookSecurityConfig{Secret: "s", ToleranceSeconds: -1})
+	require.Error(t, err)
+
+	_, err = NewHMACVerifier(WebhookSecurityConfig{Secret: "s", AllowedIPs: []string{"not-an-ip"}})
+	require.ErrorContains(t, err, "allowed_ips")
+
+	v, err := NewHMACVerifier(WebhookSecurityConfig{Secret: "s", SignatureHeader: "X-GovPay-Signature"})
+	require.NoError(t, err)
+	assert.Equal(t, "X-GovPay-Signature", v.signatureHeader)
+	assert.Equal(t, DefaultNonceHeader, v.nonceHeader)
+	assert.Equal(t, DefaultWebhookTolerance, v.tolerance)
+}
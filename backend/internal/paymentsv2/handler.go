@@ -1,14 +1,40 @@
 package paymentsv2
 
 import (
+	"encoding/json"
 	"errors"
+	"expvar"
 	"io"
 	"log/slog"
 	"net/http"
 
+	"github.com/OpenNSW/nsw/backend/internal/auth"
 	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
 )
 
+// webhookRejections counts webhooks refused as unauthenticated, keyed
+// "<gatewayId>:<reason>". Published through expvar.
+var webhookRejections = expvar.NewMap("paymentsv2_webhook_rejections")
+
+// webhookRejectionReason classifies an unauthorized webhook error for metrics.
+func webhookRejectionReason(err error) string {
+	switch {
+	case errors.Is(err, ErrWebhookReplay):
+		return "replay"
+	case errors.Is(err, gateways.ErrWebhookSignature):
+		return "signature"
+	case errors.Is(err, gateways.ErrWebhookTimestamp):
+		return "timestamp"
+	case errors.Is(err, gateways.ErrWebhookNonce):
+		return "nonce"
+	case errors.Is(err, gateways.ErrWebhookSourceIP):
+		return "source_ip"
+	default:
+		return "unauthorized"
+	}
+}
+
 // HTTPHandler handles public HTTP requests for the Payment Service.
 type HTTPHandler struct {
 	service PaymentService
@@ -19,6 +45,22 @@ func NewHTTPHandler(service PaymentService) *HTTPHandler {
 	return &HTTPHandler{service: service}
 }
 
+// HandleListMethods handles GET /api/v1/payments/methods
+// Returns the UI-safe render info of all active payment methods, in display order.
+func (h *HTTPHandler) HandleListMethods(w http.ResponseWriter, r *http.Request) {
+	methods, err := h.service.ListAvailableMethods(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list payment methods", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(methods); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
 // HandleValidateReference handles POST /api/v1/payments/:gatewayId/validate
 // Called by gateways to query if a reference number is valid and payable.
 func (h *HTTPHandler) HandleValidateReference(w http.ResponseWriter, r *http.Request) {
@@ -65,8 +107,21 @@ func (h *HTTPHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.service.ProcessWebhook(r.Context(), gatewayID, body, r.Header)
+	err = h.service.ProcessWebhook(r.Context(), gatewayID, gateways.WebhookRequest{
+		Body:       body,
+		Headers:    r.Header,
+		RemoteAddr: r.RemoteAddr,
+	})
 	if err != nil {
+		// Unsigned, forged, stale or replayed deliveries. The reason is counted
+		// and logged but not echoed, so callers learn nothing about which check failed.
+		if errors.Is(err, gateways.ErrWebhookUnauthorized) {
+			reason := webhookRejectionReason(err)
+			webhookRejections.Add(gatewayID+":"+reason, 1)
+			slog.WarnContext(r.Context(), "webhook rejected", "gateway", gatewayID, "reason", reason, "remote_addr", r.RemoteAddr, "error", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
 		// An unknown reference is permanent; respond 404 so the gateway stops
 		// retrying instead of hammering us forever. Everything else is treated
 		// as transient (500) so the gateway's retry can re-drive it.
@@ -96,3 +151,177 @@ func (h *HTTPHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"status": "accepted"}`))
 }
+
+// HandleReturn handles GET /api/v1/payments/returns/{gatewayId}
+// The payer's browser lands here from a redirect gateway's hosted checkout and
+// is sent on (303) to the portal page for the result.
+func (h *HTTPHandler) HandleReturn(w http.ResponseWriter, r *http.Request) {
+	gatewayID := r.PathValue("gatewayId")
+	if gatewayID == "" {
+		http.Error(w, "gateway ID is required in URL", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.service.HandleReturn(r.Context(), gatewayID, r.URL.Query())
+	switch {
+	case errors.Is(err, ErrReturnUnsupported), errors.Is(err, ErrTransactionNotFound):
+		http.Error(w, "unknown payment return", http.StatusNotFound)
+		return
+	case errors.Is(err, gateways.ErrReturnUnauthorized), errors.Is(err, gateways.ErrUnsupportedWebhookStatus):
+		slog.WarnContext(r.Context(), "payment return rejected", "gateway", gatewayID, "remote_addr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid payment return", http.StatusBadRequest)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "payment return failed", "gateway", gatewayID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// HandleVerifyReceipt handles GET /api/v1/payments/receipts/{code}/verify
+// Public: customs, banks and other third parties holding a receipt confirm it
+// from the code printed on it (or its QR code). valid is false once the
+// payment has been refunded in full.
+func (h *HTTPHandler) HandleVerifyReceipt(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		http.Error(w, "verification code is required in URL", http.StatusBadRequest)
+		return
+	}
+
+	verification, err := h.service.VerifyReceipt(r.Context(), code)
+	switch {
+	case errors.Is(err, ErrReceiptNotFound), errors.Is(err, ErrTransactionNotFound):
+		http.Error(w, "receipt not found", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "receipt verification failed", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verification); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// refundRequestBody is the body of HandleRequestRefund.
+type refundRequestBody struct {
+	// Amount to return; omitted or zero refunds everything not yet refunded.
+	Amount decimal.Decimal `json:"amount"`
+	Reason string          `json:"reason"`
+}
+
+// HandleRequestRefund handles POST /api/v1/admin/payments/{reference}/refunds
+// Lets an officer refund a paid transaction, e.g. a late payment flagged
+// REFUND_REQUIRED. Responds 201 with the refund.
+func (h *HTTPHandler) HandleRequestRefund(w http.ResponseWriter, r *http.Request) {
+	reference := r.PathValue("reference")
+	if reference == "" {
+		http.Error(w, "payment reference is required in URL", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB limit
+	var body refundRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := h.service.RequestRefund(r.Context(), RefundRequest{
+		ReferenceNumber: reference,
+		Amount:          body.Amount,
+		Reason:          body.Reason,
+		RequestedBy:     auth.GetAuthContext(r.Context()).Subject(),
+	})
+	if err != nil {
+		writeRefundError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(refund); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// HandleListRefunds handles GET /api/v1/admin/payments/refunds
+// Optional query parameter status (PENDING, SUCCEEDED, FAILED); finance uses
+// ?status=PENDING as its queue of manual refunds to carry out.
+func (h *HTTPHandler) HandleListRefunds(w http.ResponseWriter, r *http.Request) {
+	status := RefundStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", RefundStatusPending, RefundStatusSucceeded, RefundStatusFailed:
+	default:
+		http.Error(w, "unknown refund status", http.StatusBadRequest)
+		return
+	}
+
+	refunds, err := h.service.ListRefunds(r.Context(), status)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list refunds", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(refunds); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// HandleCompleteRefund handles POST /api/v1/admin/payments/refunds/{refundId}/complete
+// Body {"succeeded": true, "gateway_refund_id": "...", "note": "..."} confirms
+// (or, with succeeded false, abandons) a pending refund.
+func (h *HTTPHandler) HandleCompleteRefund(w http.ResponseWriter, r *http.Request) {
+	refundID := r.PathValue("refundId")
+	if refundID == "" {
+		http.Error(w, "refund ID is required in URL", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB limit
+	var result RefundResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	result.CompletedBy = auth.GetAuthContext(r.Context()).Subject()
+
+	refund, err := h.service.CompleteRefund(r.Context(), refundID, result)
+	if err != nil {
+		writeRefundError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(refund); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// writeRefundError maps refund errors onto HTTP statuses.
+func writeRefundError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrTransactionNotFound), errors.Is(err, ErrRefundNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidRefundAmount):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNotRefundable), errors.Is(err, ErrRefundInProgress), errors.Is(err, ErrRefundNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, gateways.ErrRefundUnsupported):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		slog.ErrorContext(r.Context(), "refund failed", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
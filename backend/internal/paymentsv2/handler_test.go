@@ -3,12 +3,19 @@ package paymentsv2
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,18 +25,107 @@ type mockService struct {
 	validateResp *gateways.ValidationResponse
 	validateErr  error
 	webhookErr   error
+	webhookReq   gateways.WebhookRequest
+	methods      []GatewayInfo
+	methodsErr   error
+
+	mu            sync.Mutex
+	expireCutoffs []time.Time
+	expireLimit   int
+	redriveLimits []int
+
+	refund        *Refund
+	refundErr     error
+	refundReq     RefundRequest
+	refundResult  RefundResult
+	refundsStatus RefundStatus
+
+	cart         *Cart
+	cartErr      error
+	checkoutReq  CartCheckoutRequest
+	checkoutResp *CreateCheckoutResponse
+	checkoutErr  error
+
+	returnQuery  url.Values
+	returnTarget string
+	returnErr    error
+
+	verification *ReceiptVerification
+	verifyCode   string
+	verifyErr    error
 }
 
-func (m *mockService) ListAvailableMethods(context.Context) ([]GatewayInfo, error) { return nil, nil }
+func (m *mockService) ListAvailableMethods(context.Context) ([]GatewayInfo, error) {
+	return m.methods, m.methodsErr
+}
+func (m *mockService) GetMethod(context.Context, string) (*PaymentMethod, error) { return nil, nil }
 func (m *mockService) CreateCheckoutSession(context.Context, CreateCheckoutRequest) (*CreateCheckoutResponse, error) {
 	return nil, nil
 }
+func (m *mockService) GetLatestAttempt(context.Context, string) (*PaymentTransaction, error) {
+	return nil, nil
+}
+func (m *mockService) ListAttempts(context.Context, string) ([]PaymentTransaction, error) {
+	return nil, nil
+}
 func (m *mockService) ValidateReference(context.Context, string, json.RawMessage) (*gateways.ValidationResponse, error) {
 	return m.validateResp, m.validateErr
 }
-func (m *mockService) ProcessWebhook(context.Context, string, []byte, map[string][]string) error {
+func (m *mockService) ProcessWebhook(_ context.Context, _ string, req gateways.WebhookRequest) error {
+	m.webhookReq = req
 	return m.webhookErr
 }
+func (m *mockService) RequestRefund(_ context.Context, req RefundRequest) (*Refund, error) {
+	m.refundReq = req
+	return m.refund, m.refundErr
+}
+func (m *mockService) CompleteRefund(_ context.Context, _ string, result RefundResult) (*Refund, error) {
+	m.refundResult = result
+	return m.refund, m.refundErr
+}
+func (m *mockService) ListRefunds(_ context.Context, status RefundStatus) ([]Refund, error) {
+	m.refundsStatus = status
+	return nil, m.refundErr
+}
+func (m *mockService) AddToCart(context.Context, AddToCartRequest) (*PaymentLineItem, error) {
+	return nil, nil
+}
+func (m *mockService) GetCart(_ context.Context, consignmentID string) (*Cart, error) {
+	if m.cart == nil {
+		return &Cart{ConsignmentID: consignmentID}, m.cartErr
+	}
+	return m.cart, m.cartErr
+}
+func (m *mockService) CheckoutCart(_ context.Context, req CartCheckoutRequest) (*CreateCheckoutResponse, error) {
+	m.checkoutReq = req
+	return m.checkoutResp, m.checkoutErr
+}
+func (m *mockService) HandleReturn(_ context.Context, _ string, query url.Values) (string, error) {
+	m.returnQuery = query
+	return m.returnTarget, m.returnErr
+}
+func (m *mockService) GetReceiptDownloadURL(context.Context, string) (string, error) {
+	return "", nil
+}
+func (m *mockService) VerifyReceipt(_ context.Context, code string) (*ReceiptVerification, error) {
+	m.verifyCode = code
+	return m.verification, m.verifyErr
+}
+func (m *mockService) SetReceipts(ReceiptConfig)      {}
+func (m *mockService) SetPartyResolver(PartyResolver) {}
+func (m *mockService) ExpireOverdue(_ context.Context, cutoff time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireCutoffs = append(m.expireCutoffs, cutoff)
+	m.expireLimit = limit
+	return 0, nil
+}
+func (m *mockService) RedriveTaskSteps(_ context.Context, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.redriveLimits = append(m.redriveLimits, limit)
+	return 0, nil
+}
 func (m *mockService) SetTaskCompleter(TaskCompleter) {}
 
 // serve routes a webhook POST through a mux so PathValue("gatewayId") resolves.
@@ -106,3 +202,194 @@ func TestHandleValidateReference_MissingGatewayID(t *testing.T) {
 	h.HandleValidateReference(rr, httptest.NewRequest(http.MethodPost, "/x", http.NoBody))
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
+
+func TestHandleListMethods(t *testing.T) {
+	svc := &mockService{methods: []GatewayInfo{{ID: "govpay", IsActive: true, RenderInfo: RenderInfo{DisplayName: "GovPay"}}}}
+	rr := httptest.NewRecorder()
+	NewHTTPHandler(svc).HandleListMethods(rr, httptest.NewRequest(http.MethodGet, "/api/v1/payments/methods", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got []GatewayInfo
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	require.Len(t, got, 1)
+	assert.Equal(t, "govpay", got[0].ID)
+}
+
+func TestHandleListMethods_ServiceErrorIs500(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewHTTPHandler(&mockService{methodsErr: fmt.Errorf("boom")}).HandleListMethods(rr, httptest.NewRequest(http.MethodGet, "/api/v1/payments/methods", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestHandleWebhook_UnauthorizedIs401AndCounted(t *testing.T) {
+	cases := map[string]struct {
+		err    error
+		reason string
+	}{
+		"signature": {err: fmt.Errorf("gateway govpay: %w", gateways.ErrWebhookSignature), reason: "signature"},
+		"timestamp": {err: fmt.Errorf("gateway govpay: %w", gateways.ErrWebhookTimestamp), reason: "timestamp"},
+		"nonce":     {err: fmt.Errorf("gateway govpay: %w", gateways.ErrWebhookNonce), reason: "nonce"},
+		"source ip": {err: fmt.Errorf("gateway govpay: %w", gateways.ErrWebhookSourceIP), reason: "source_ip"},
+		"replay":    {err: fmt.Errorf("gateway govpay: %w", ErrWebhookReplay), reason: "replay"},
+		"other":     {err: fmt.Errorf("%w: verifier broke", gateways.ErrWebhookUnauthorized), reason: "unauthorized"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			key := "govpay:" + tc.reason
+			before := rejectionCount(key)
+
+			rr := serveWebhook(&mockService{webhookErr: tc.err})
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Equal(t, "unauthorized\n", rr.Body.String(), "the failing check must not be disclosed")
+			assert.Equal(t, before+1, rejectionCount(key))
+		})
+	}
+}
+
+func rejectionCount(key string) int64 {
+	if v, ok := webhookRejections.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestHandleWebhook_PassesRawRequestToService(t *testing.T) {
+	svc := &mockService{}
+	h := NewHTTPHandler(svc)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/payments/{gatewayId}/webhook", h.HandleWebhook)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/govpay/webhook", strings.NewReader(`{"status":"paid"}`))
+	req.RemoteAddr = "203.0.113.7:4711"
+	req.Header.Set(gateways.DefaultSignatureHeader, "abc")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, `{"status":"paid"}`, string(svc.webhookReq.Body))
+	assert.Equal(t, "203.0.113.7:4711", svc.webhookReq.RemoteAddr)
+	assert.Equal(t, "abc", http.Header(svc.webhookReq.Headers).Get(gateways.DefaultSignatureHeader))
+}
+
+func serveRefundAPI(svc PaymentService, method, target, body string) *httptest.ResponseRecorder {
+	h := NewHTTPHandler(svc)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/admin/payments/{reference}/refunds", h.HandleRequestRefund)
+	mux.HandleFunc("GET /api/v1/admin/payments/refunds", h.HandleListRefunds)
+	mux.HandleFunc("POST /api/v1/admin/payments/refunds/{refundId}/complete", h.HandleCompleteRefund)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rr
+}
+
+func TestHandleRequestRefund(t *testing.T) {
+	svc := &mockService{refund: &Refund{ID: "rf-1", Status: RefundStatusPending, Manual: true}}
+	rr := serveRefundAPI(svc, http.MethodPost, "/api/v1/admin/payments/TNSW1/refunds", `{"amount":"250.00","reason":"duplicate payment"}`)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "TNSW1", svc.refundReq.ReferenceNumber)
+	assert.Equal(t, "250", svc.refundReq.Amount.String())
+	assert.Equal(t, "duplicate payment", svc.refundReq.Reason)
+	var got Refund
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, "rf-1", got.ID)
+
+	rr = serveRefundAPI(&mockService{}, http.MethodPost, "/api/v1/admin/payments/TNSW1/refunds", `{"amount":"250.00"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "reason is required")
+}
+
+func TestHandleRequestRefund_ErrorStatuses(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		code int
+	}{
+		"unknown reference": {err: fmt.Errorf("x: %w", ErrTransactionNotFound), code: http.StatusNotFound},
+		"bad amount":        {err: fmt.Errorf("x: %w", ErrInvalidRefundAmount), code: http.StatusBadRequest},
+		"not refundable":    {err: fmt.Errorf("x: %w", ErrNotRefundable), code: http.StatusConflict},
+		"in progress":       {err: fmt.Errorf("x: %w", ErrRefundInProgress), code: http.StatusConflict},
+		"unsupported":       {err: fmt.Errorf("x: %w", gateways.ErrRefundUnsupported), code: http.StatusUnprocessableEntity},
+		"other":             {err: fmt.Errorf("boom"), code: http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rr := serveRefundAPI(&mockService{refundErr: tc.err}, http.MethodPost, "/api/v1/admin/payments/TNSW1/refunds", `{"reason":"r"}`)
+			assert.Equal(t, tc.code, rr.Code)
+		})
+	}
+}
+
+func TestHandleCompleteRefund(t *testing.T) {
+	svc := &mockService{refund: &Refund{ID: "rf-1", Status: RefundStatusSucceeded}}
+	rr := serveRefundAPI(svc, http.MethodPost, "/api/v1/admin/payments/refunds/rf-1/complete", `{"succeeded":true,"gateway_refund_id":"TT-9"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, RefundResult{Succeeded: true, GatewayRefundID: "TT-9"}, svc.refundResult)
+
+	rr = serveRefundAPI(&mockService{refundErr: ErrRefundNotPending}, http.MethodPost, "/api/v1/admin/payments/refunds/rf-1/complete", `{}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr = serveRefundAPI(&mockService{refundErr: ErrRefundNotFound}, http.MethodPost, "/api/v1/admin/payments/refunds/rf-1/complete", `{}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleListRefunds_StatusFilter(t *testing.T) {
+	svc := &mockService{}
+	rr := serveRefundAPI(svc, http.MethodGet, "/api/v1/admin/payments/refunds?status=PENDING", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, RefundStatusPending, svc.refundsStatus)
+
+	rr = serveRefundAPI(svc, http.MethodGet, "/api/v1/admin/payments/refunds?status=LOST", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandleReturn(t *testing.T) {
+	serve := func(svc *mockService) *httptest.ResponseRecorder {
+		h := NewHTTPHandler(svc)
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/payments/returns/{gatewayId}", h.HandleReturn)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/payments/returns/lankapay?order_id=TNSW1&status=APPROVED&signature=ab", nil))
+		return rr
+	}
+
+	svc := &mockService{returnTarget: "https://portal.example/payments/done?reference=TNSW1&status=success"}
+	rr := serve(svc)
+	require.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, svc.returnTarget, rr.Header().Get("Location"))
+	assert.Equal(t, "TNSW1", svc.returnQuery.Get("order_id"))
+
+	cases := map[string]struct {
+		err  error
+		code int
+	}{
+		"forged":      {err: fmt.Errorf("x: %w", gateways.ErrReturnUnauthorized), code: http.StatusBadRequest},
+		"unsupported": {err: fmt.Errorf("x: %w", ErrReturnUnsupported), code: http.StatusNotFound},
+		"unknown":     {err: fmt.Errorf("x: %w", ErrTransactionNotFound), code: http.StatusNotFound},
+		"other":       {err: fmt.Errorf("boom"), code: http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.code, serve(&mockService{returnErr: tc.err}).Code)
+		})
+	}
+}
+
+func TestHandleVerifyReceipt(t *testing.T) {
+	serve := func(svc *mockService) *httptest.ResponseRecorder {
+		h := NewHTTPHandler(svc)
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/payments/receipts/{code}/verify", h.HandleVerifyReceipt)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/payments/receipts/ABCD2345EFGH6789/verify", nil))
+		return rr
+	}
+
+	svc := &mockService{verification: &ReceiptVerification{
+		Valid: true, ReferenceNumber: "TNSW1", Amount: decimal.RequireFromString("1500"), Currency: "LKR", Status: PaymentStatusSuccess,
+	}}
+	rr := serve(svc)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ABCD2345EFGH6789", svc.verifyCode)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, true, body["valid"])
+	assert.Equal(t, "TNSW1", body["reference_number"])
+
+	assert.Equal(t, http.StatusNotFound, serve(&mockService{verifyErr: fmt.Errorf("x: %w", ErrReceiptNotFound)}).Code)
+	assert.Equal(t, http.StatusInternalServerError, serve(&mockService{verifyErr: errors.New("boom")}).Code)
+}
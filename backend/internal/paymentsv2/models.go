@@ -6,6 +6,7 @@ import (
 
 	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
 	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
 type PaymentStatus string
@@ -14,25 +15,88 @@ const (
 	PaymentStatusPending PaymentStatus = "PENDING"
 	PaymentStatusSuccess PaymentStatus = "SUCCESS"
 	PaymentStatusFailed  PaymentStatus = "FAILED"
+	// PaymentStatusExpired marks a transaction left unpaid past its ExpiryDate.
+	// The owning task has been told the payment expired.
+	PaymentStatusExpired PaymentStatus = "EXPIRED"
+	// PaymentStatusRefundRequired marks an expired transaction the gateway
+	// later reported as paid. The task has already moved on, so the money has
+	// to be returned rather than the transaction reinstated.
+	PaymentStatusRefundRequired PaymentStatus = "REFUND_REQUIRED"
+	// PaymentStatusSuperseded marks a pending attempt replaced by a newer
+	// attempt on the same task. Its reference is no longer payable.
+	PaymentStatusSuperseded PaymentStatus = "SUPERSEDED"
+	// PaymentStatusRefundPending marks a paid transaction with a refund in
+	// flight. At most one refund is in flight per transaction.
+	PaymentStatusRefundPending PaymentStatus = "REFUND_PENDING"
+	// PaymentStatusRefunded marks a transaction whose whole amount has been
+	// returned, in one refund or several partial ones.
+	PaymentStatusRefunded PaymentStatus = "REFUNDED"
 )
 
+// closed reports whether a transaction's reference was withdrawn without being
+// paid (expired or superseded). The task no longer waits on it.
+func (s PaymentStatus) closed() bool {
+	return s == PaymentStatusExpired || s == PaymentStatusSuperseded
+}
+
+// paid reports whether the gateway collected the money for a transaction,
+// whether or not the task accepted it or it was later refunded. Keep in sync
+// with paidStatuses.
+func (s PaymentStatus) paid() bool {
+	switch s {
+	case PaymentStatusSuccess, PaymentStatusRefundRequired, PaymentStatusRefundPending, PaymentStatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
 // PaymentTransaction represents the internal state of a payment
 type PaymentTransaction struct {
 	ID              string            `json:"id" gorm:"type:text;not null;primaryKey"`
 	ReferenceNumber string            `json:"reference_number" gorm:"uniqueIndex"` // Generated by Payment Service
-	TaskID          string            `json:"task_id" gorm:"index"`                // Links back to the FSM Task Node
+	TaskID          string            `json:"task_id" gorm:"index"`                // Links back to the FSM Task Node; empty for a cart
+	ConsignmentID   string            `json:"consignment_id,omitempty"`            // Set only on consolidated (cart) transactions
+	AttemptNo       int               `json:"attempt_no"`                          // 1-based; the highest is the task's (or cart's) live attempt
 	GatewayID       string            `json:"gateway_id" gorm:"index"`             // e.g., "lankapay"
 	SessionID       string            `json:"session_id"`                          // Gateway-specific session identifier
 	Amount          decimal.Decimal   `json:"amount"`
 	Currency        string            `json:"currency"`       // "LKR" or foreign currency
-	Status          PaymentStatus     `json:"status"`         // PENDING, SUCCESS, FAILED, EXPIRED
+	Status          PaymentStatus     `json:"status"`         // PENDING, SUCCESS, FAILED, EXPIRED, SUPERSEDED, REFUND_REQUIRED, REFUND_PENDING, REFUNDED
 	PaymentMethod   string            `json:"payment_method"` // CC, BANK_TRANSFER (populated on webhook)
 	ExpiryDate      time.Time         `json:"expiry_date"`
 	GatewayMetadata map[string]string `json:"gateway_metadata" gorm:"serializer:json"`
+	TaskNotifiedAt  *time.Time        `json:"task_notified_at,omitempty" gorm:"<-:false"` // When the task step was completed with the outcome; single-task only, set through MarkTaskNotified
 	CreatedAt       time.Time         `json:"created_at"`
 	UpdatedAt       time.Time         `json:"updated_at"`
+
+	loadedStatus PaymentStatus // Status as last read or written, to detect a change on Update
+}
+
+// AfterFind remembers the status read, so Update can tell whether it changed.
+func (tx *PaymentTransaction) AfterFind(*gorm.DB) error {
+	tx.loadedStatus = tx.Status
+	return nil
+}
+
+// consolidated reports whether a transaction pays a consignment's cart of
+// line items rather than a single task.
+func (tx *PaymentTransaction) consolidated() bool {
+	return tx.ConsignmentID != ""
 }
 
+// WebhookNonce records an authenticated webhook delivery so a replay of it can
+// be detected. Rows are pruned once ExpiresAt has passed.
+type WebhookNonce struct {
+	GatewayID string    `gorm:"primaryKey"`
+	Nonce     string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TableName pins the table created by migration 023.
+func (WebhookNonce) TableName() string { return "payment_webhook_nonces" }
+
 // --------------------------------------------------------
 // Gateway Session API Contracts (Outbound to GovPay)
 // --------------------------------------------------------
@@ -72,6 +136,7 @@ func (r CreateCheckoutRequest) validate(now time.Time) error {
 // CreateCheckoutResponse is the expected reply from LankaPay.
 type CreateCheckoutResponse struct {
 	ReferenceNumber string                   `json:"reference_number"` // The generated NSW reference
+	AttemptNo       int                      `json:"attempt_no"`
 	SessionID       string                   `json:"session_id"`
 	Type            gateways.InteractionType `json:"type"`
 	CheckoutURL     string                   `json:"checkout_url,omitempty"` // The hosted URL to redirect the user to
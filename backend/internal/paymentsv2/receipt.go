@@ -0,0 +1,380 @@
+package paymentsv2
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/shopspring/decimal"
+	"github.com/skip2/go-qrcode"
+)
+
+// ErrReceiptNotFound indicates no receipt matches a task or verification code,
+// or that receipts are not configured.
+var ErrReceiptNotFound = errors.New("payment receipt not found")
+
+// Transaction metadata keys naming the parties printed on a receipt. Cart
+// transactions name their OGAs per line item instead.
+const (
+	metaConsignmentID = "consignment_id"
+	metaOGAName       = "oga_name"
+	metaTaskCode      = "task_code"
+)
+
+// PaymentReceipt is the official receipt issued for a paid transaction. The
+// PDF lives in storage under StorageKey; VerificationCode is printed on it so
+// anyone holding it can confirm it with NSW.
+type PaymentReceipt struct {
+	ID                   string          `json:"id" gorm:"type:text;not null;primaryKey"`
+	TransactionID        string          `json:"transaction_id" gorm:"uniqueIndex"`
+	ReferenceNumber      string          `json:"reference_number"`
+	VerificationCode     string          `json:"verification_code" gorm:"uniqueIndex"`
+	StorageKey           string          `json:"-"`
+	PayerName            string          `json:"payer_name"`
+	OGAName              string          `json:"oga_name"`
+	Amount               decimal.Decimal `json:"amount"`
+	Currency             string          `json:"currency"`
+	GatewayTransactionID string          `json:"gateway_transaction_id"`
+	PaidAt               time.Time       `json:"paid_at"`
+	CreatedAt            time.Time       `json:"created_at"`
+}
+
+// TableName pins the table created by migration 028.
+func (PaymentReceipt) TableName() string { return "payment_receipts" }
+
+// ReceiptVerification is what the public verify endpoint discloses about a
+// receipt: enough to match a printed copy, nothing about the payer beyond
+// what is printed on it.
+type ReceiptVerification struct {
+	Valid           bool            `json:"valid"`
+	ReferenceNumber string          `json:"reference_number"`
+	PayerName       string          `json:"payer_name"`
+	OGAName         string          `json:"oga_name"`
+	Amount          decimal.Decimal `json:"amount"`
+	Currency        string          `json:"currency"`
+	PaidAt          time.Time       `json:"paid_at"`
+	// Status is the transaction's current status. Valid is false once the
+	// payment has been refunded in full.
+	Status PaymentStatus `json:"status"`
+}
+
+// PayerDirectory names the party that paid for a consignment. It is satisfied
+// by the consignment service.
+type PayerDirectory interface {
+	PayerName(ctx context.Context, consignmentID string) (string, error)
+}
+
+// ReceiptConfig wires receipt issuance.
+type ReceiptConfig struct {
+	Storage storage.StorageDriver
+	// VerifyBaseURL is the public base URL of the API; each receipt's QR code
+	// links to its verify endpoint under it.
+	VerifyBaseURL string
+	// Payers may be nil, in which case receipts leave the payer blank.
+	Payers PayerDirectory
+}
+
+// receiptLine is one fee printed on a receipt.
+type receiptLine struct {
+	TaskID      string
+	TaskCode    string
+	Description string
+	OGAName     string
+	Amount      decimal.Decimal
+}
+
+func (s *paymentService) SetReceipts(cfg ReceiptConfig) {
+	s.receipts = &cfg
+}
+
+func (s *paymentService) GetReceiptDownloadURL(ctx context.Context, taskID string) (string, error) {
+	if s.receipts == nil {
+		return "", fmt.Errorf("task %s: %w", taskID, ErrReceiptNotFound)
+	}
+	tx, err := s.payingTransaction(ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	if tx == nil {
+		return "", fmt.Errorf("task %s: %w", taskID, ErrReceiptNotFound)
+	}
+	receipt, err := s.repo.GetReceiptByTransactionID(ctx, tx.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve receipt: %w", err)
+	}
+	// A paid transaction whose receipt failed to issue when it settled gets
+	// one on first request.
+	if receipt == nil && tx.Status == PaymentStatusSuccess {
+		if receipt, err = s.issueReceipt(ctx, tx); err != nil {
+			return "", err
+		}
+	}
+	if receipt == nil {
+		return "", fmt.Errorf("task %s: %w", taskID, ErrReceiptNotFound)
+	}
+	return s.receipts.Storage.GetDownloadURL(ctx, receipt.StorageKey)
+}
+
+// payingTransaction returns the transaction that paid, or is paying, a task's
+// fee: the cart transaction its paid line item settled in, or else its latest
+// single-task attempt. It returns nil if there is neither.
+func (s *paymentService) payingTransaction(ctx context.Context, taskID string) (*PaymentTransaction, error) {
+	item, err := s.repo.GetLineItemByTaskID(ctx, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve line item: %w", err)
+	}
+	if item != nil && item.Status == LineItemStatusPaid {
+		tx, err := s.repo.GetByID(ctx, item.TransactionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve cart transaction: %w", err)
+		}
+		return tx, nil
+	}
+	tx, err := currentAttempt(ctx, s.repo, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *paymentService) VerifyReceipt(ctx context.Context, code string) (*ReceiptVerification, error) {
+	receipt, err := s.repo.GetReceiptByVerificationCode(ctx, strings.ToUpper(code))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve receipt: %w", err)
+	}
+	if receipt == nil {
+		return nil, fmt.Errorf("code %s: %w", code, ErrReceiptNotFound)
+	}
+	tx, err := s.repo.GetByID(ctx, receipt.TransactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve transaction: %w", err)
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("reference %s: %w", receipt.ReferenceNumber, ErrTransactionNotFound)
+	}
+	return &ReceiptVerification{
+		Valid:           tx.Status.paid() && tx.Status != PaymentStatusRefunded,
+		ReferenceNumber: receipt.ReferenceNumber,
+		PayerName:       receipt.PayerName,
+		OGAName:         receipt.OGAName,
+		Amount:          receipt.Amount,
+		Currency:        receipt.Currency,
+		PaidAt:          receipt.PaidAt,
+		Status:          tx.Status,
+	}, nil
+}
+
+// issueReceiptAfterPayment issues tx's receipt once its webhook has been
+// applied. Failures only log: the payment stands, and the receipt is issued
+// on the next delivery or the first download instead.
+func (s *paymentService) issueReceiptAfterPayment(ctx context.Context, tx *PaymentTransaction) {
+	if s.receipts == nil {
+		return
+	}
+	existing, err := s.repo.GetReceiptByTransactionID(ctx, tx.ID)
+	if err == nil && existing != nil {
+		return
+	}
+	if err == nil {
+		_, err = s.issueReceipt(ctx, tx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "paymentsv2: failed to issue payment receipt", "reference", tx.ReferenceNumber, "error", err)
+	}
+}
+
+// issueReceipt renders and stores tx's receipt. Two racing issuers both
+// render one, but the unique transaction_id lets only the first be recorded;
+// the loser removes its file and returns the winner's receipt.
+func (s *paymentService) issueReceipt(ctx context.Context, tx *PaymentTransaction) (*PaymentReceipt, error) {
+	lines, err := s.receiptLines(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &PaymentReceipt{
+		ID:                   uuid.NewString(),
+		TransactionID:        tx.ID,
+		ReferenceNumber:      tx.ReferenceNumber,
+		VerificationCode:     generateVerificationCode(),
+		OGAName:              receiptOGAName(lines),
+		Amount:               tx.Amount,
+		Currency:             tx.Currency,
+		GatewayTransactionID: tx.GatewayMetadata["gateway_transaction_id"],
+		PaidAt:               paidAt(tx),
+	}
+	receipt.StorageKey = receipt.ID + ".pdf"
+	if consignmentID := tx.GatewayMetadata[metaConsignmentID]; consignmentID != "" && s.receipts.Payers != nil {
+		if receipt.PayerName, err = s.receipts.Payers.PayerName(ctx, consignmentID); err != nil {
+			return nil, fmt.Errorf("failed to resolve payer of consignment %s: %w", consignmentID, err)
+		}
+	}
+
+	pdf, err := renderReceiptPDF(receipt, lines, s.receiptVerifyURL(receipt.VerificationCode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render receipt for %s: %w", tx.ReferenceNumber, err)
+	}
+	if err := s.receipts.Storage.Save(ctx, receipt.StorageKey, bytes.NewReader(pdf), "application/pdf"); err != nil {
+		return nil, fmt.Errorf("failed to store receipt for %s: %w", tx.ReferenceNumber, err)
+	}
+
+	if err := s.repo.CreateReceipt(ctx, receipt); err != nil {
+		if derr := s.receipts.Storage.Delete(ctx, receipt.StorageKey); derr != nil {
+			slog.WarnContext(ctx, "paymentsv2: failed to remove unrecorded receipt", "key", receipt.StorageKey, "error", derr)
+		}
+		existing, gerr := s.repo.GetReceiptByTransactionID(ctx, tx.ID)
+		if gerr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("failed to record receipt for %s: %w", tx.ReferenceNumber, err)
+	}
+
+	slog.InfoContext(ctx, "paymentsv2: payment receipt issued", "reference", tx.ReferenceNumber, "receiptId", receipt.ID)
+	return receipt, nil
+}
+
+// receiptLines lists the fees a transaction paid: a cart's line items, or the
+// single task fee.
+func (s *paymentService) receiptLines(ctx context.Context, tx *PaymentTransaction) ([]receiptLine, error) {
+	if !tx.consolidated() {
+		description := tx.GatewayMetadata[metaTaskCode]
+		if description == "" {
+			description = "Payment"
+		}
+		return []receiptLine{{
+			TaskID:      tx.TaskID,
+			TaskCode:    tx.GatewayMetadata[metaTaskCode],
+			Description: description,
+			OGAName:     tx.GatewayMetadata[metaOGAName],
+			Amount:      tx.Amount,
+		}}, nil
+	}
+	items, err := s.repo.ListLineItemsByTransaction(ctx, tx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list line items of %s: %w", tx.ReferenceNumber, err)
+	}
+	lines := make([]receiptLine, len(items))
+	for i, item := range items {
+		description := item.Description
+		if description == "" {
+			description = item.TaskCode
+		}
+		lines[i] = receiptLine{TaskID: item.TaskID, TaskCode: item.TaskCode, Description: description, OGAName: item.OGAName, Amount: item.Amount}
+	}
+	return lines, nil
+}
+
+// receiptOGAName names every OGA the receipt's fees were paid to.
+func receiptOGAName(lines []receiptLine) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, l := range lines {
+		if l.OGAName != "" && !seen[l.OGAName] {
+			seen[l.OGAName] = true
+			names = append(names, l.OGAName)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// paidAt is when the gateway says the payment was made, or failing that when
+// the transaction was last updated.
+func paidAt(tx *PaymentTransaction) time.Time {
+	if ts, err := time.Parse(time.RFC3339, tx.GatewayMetadata["webhook_timestamp"]); err == nil {
+		return ts.UTC()
+	}
+	if !tx.UpdatedAt.IsZero() {
+		return tx.UpdatedAt.UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (s *paymentService) receiptVerifyURL(code string) string {
+	return strings.TrimRight(s.receipts.VerifyBaseURL, "/") + "/api/v1/payments/receipts/" + url.PathEscape(code) + "/verify"
+}
+
+// generateVerificationCode returns 16 random base32 characters (80 bits), so
+// codes can be neither guessed nor enumerated.
+func generateVerificationCode() string {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate random bytes: %v", err))
+	}
+	return base32.StdEncoding.EncodeToString(b)
+}
+
+// renderReceiptPDF lays out the receipt on a single A4 page with a QR code
+// linking to verifyURL.
+func renderReceiptPDF(r *PaymentReceipt, lines []receiptLine, verifyURL string) ([]byte, error) {
+	qr, err := qrcode.Encode(verifyURL, qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode verification QR code: %w", err)
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Payment Receipt "+r.ReferenceNumber, true)
+	pdf.SetCreator("National Single Window", true)
+	pdf.SetCreationDate(r.PaidAt)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, "National Single Window - Official Payment Receipt", "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "", 11)
+	for _, field := range [][2]string{
+		{"Reference", r.ReferenceNumber},
+		{"Payer", r.PayerName},
+		{"Paid to", r.OGAName},
+		{"Paid at", r.PaidAt.Format("2006-01-02 15:04:05 MST")},
+		{"Gateway transaction", r.GatewayTransactionID},
+		{"Verification code", r.VerificationCode},
+	} {
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(50, 7, field[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(0, 7, tr(field[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(90, 8, "Description", "B", 0, "L", false, 0, "")
+	pdf.CellFormat(60, 8, "OGA", "B", 0, "L", false, 0, "")
+	pdf.CellFormat(40, 8, "Amount ("+r.Currency+")", "B", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	for _, l := range lines {
+		pdf.CellFormat(90, 7, tr(l.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(60, 7, tr(l.OGAName), "", 0, "L", false, 0, "")
+		pdf.CellFormat(40, 7, l.Amount.StringFixed(2), "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(150, 8, "Total", "T", 0, "L", false, 0, "")
+	pdf.CellFormat(40, 8, r.Amount.StringFixed(2), "T", 1, "R", false, 0, "")
+	pdf.Ln(8)
+
+	y := pdf.GetY()
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("verify-qr", opts, bytes.NewReader(qr))
+	pdf.ImageOptions("verify-qr", 10, y, 40, 40, false, opts, 0, "")
+	pdf.SetXY(55, y+10)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.MultiCell(0, 5, "Scan the code or visit the address below to confirm this receipt with NSW:\n"+verifyURL, "", "L", false)
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
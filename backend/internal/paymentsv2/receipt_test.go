@@ -0,0 +1,234 @@
+package paymentsv2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memStorage is an in-memory storage.StorageDriver.
+type memStorage struct {
+	files   map[string][]byte
+	saveErr error
+}
+
+func (m *memStorage) Save(_ context.Context, key string, body io.Reader, _ string) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if m.files == nil {
+		m.files = map[string][]byte{}
+	}
+	m.files[key] = b
+	return nil
+}
+
+func (m *memStorage) Get(_ context.Context, key string) (io.ReadCloser, string, error) {
+	return io.NopCloser(bytes.NewReader(m.files[key])), "application/pdf", nil
+}
+
+func (m *memStorage) Delete(_ context.Context, key string) error {
+	delete(m.files, key)
+	return nil
+}
+
+func (m *memStorage) GetDownloadURL(_ context.Context, key string) (string, error) {
+	return "https://files.example/" + key, nil
+}
+
+func (m *memStorage) GetUploadURL(context.Context, string, string, int64) (string, error) {
+	return "", nil
+}
+
+type payerNames map[string]string
+
+func (p payerNames) PayerName(_ context.Context, consignmentID string) (string, error) {
+	name, ok := p[consignmentID]
+	if !ok {
+		return "", errors.New("consignment not found")
+	}
+	return name, nil
+}
+
+func receiptConfig(store *memStorage) ReceiptConfig {
+	return ReceiptConfig{
+		Storage:       store,
+		VerifyBaseURL: "https://nsw.example/",
+		Payers:        payerNames{"cons-1": "Ceylon Spice Exports"},
+	}
+}
+
+func paidWebhook(ref, amount string) *gateways.WebhookPayload {
+	return &gateways.WebhookPayload{
+		ReferenceNumber:      ref,
+		Status:               gateways.WebhookStatusSuccess,
+		Amount:               decimal.RequireFromString(amount),
+		Currency:             "LKR",
+		GatewayTransactionID: "gw-tx-1",
+		Timestamp:            "2026-10-01T09:30:00Z",
+	}
+}
+
+func TestProcessWebhook_IssuesReceipt(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.ID = "tx-1"
+	tx.GatewayMetadata = map[string]string{"task_id": "task-9", "task_code": "FCAU_FEE", "consignment_id": "cons-1", "oga_name": "FCAU"}
+	repo.txs["TNSW1"] = tx
+	store := &memStorage{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: webhookGateway(paidWebhook("TNSW1", "1500.00"))})
+	svc.SetReceipts(receiptConfig(store))
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+
+	receipt := repo.receipts["tx-1"]
+	require.NotNil(t, receipt)
+	assert.Equal(t, "TNSW1", receipt.ReferenceNumber)
+	assert.Equal(t, "Ceylon Spice Exports", receipt.PayerName)
+	assert.Equal(t, "FCAU", receipt.OGAName)
+	assert.Equal(t, "gw-tx-1", receipt.GatewayTransactionID)
+	assert.Equal(t, "2026-10-01T09:30:00Z", receipt.PaidAt.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Len(t, receipt.VerificationCode, 16)
+	assert.True(t, bytes.HasPrefix(store.files[receipt.StorageKey], []byte("%PDF")))
+
+	t.Run("redelivery keeps the receipt", func(t *testing.T) {
+		repo.nonces = nil
+		require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+		assert.Same(t, receipt, repo.receipts["tx-1"])
+		assert.Len(t, store.files, 1)
+	})
+}
+
+func TestProcessWebhook_ReceiptFailureKeepsPayment(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.ID = "tx-1"
+	repo.txs["TNSW1"] = tx
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: webhookGateway(paidWebhook("TNSW1", "1500.00"))})
+	svc.SetTaskCompleter(tc)
+	svc.SetReceipts(receiptConfig(&memStorage{saveErr: errors.New("bucket unavailable")}))
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	assert.Equal(t, PaymentStatusSuccess, tx.Status)
+	assert.Len(t, tc.calls, 1)
+	assert.Empty(t, repo.receipts)
+}
+
+func TestProcessWebhook_CartReceiptListsLineItems(t *testing.T) {
+	svc, repo, tx := checkedOutCart(t, gateways.WebhookStatusSuccess)
+	repo.lineItems[0].OGAName = "FCAU"
+	repo.lineItems[1].OGAName = "CDA"
+	svc.SetReceipts(receiptConfig(&memStorage{}))
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	receipt := repo.receipts[tx.ID]
+	require.NotNil(t, receipt)
+	assert.Equal(t, "CDA, FCAU", receipt.OGAName)
+	assert.Equal(t, "Ceylon Spice Exports", receipt.PayerName)
+	assert.True(t, receipt.Amount.Equal(decimal.RequireFromString("1750")))
+
+	lines, err := svc.receiptLines(context.Background(), tx)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "Inspection fee", lines[0].Description)
+}
+
+func TestGetReceiptDownloadURL(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.ID = "tx-1"
+	repo.txs["TNSW1"] = tx
+	store := &memStorage{}
+	svc := NewPaymentService(repo, &mockRegistry{})
+
+	_, err := svc.GetReceiptDownloadURL(context.Background(), "task-9")
+	assert.ErrorIs(t, err, ErrReceiptNotFound, "receipts not configured")
+
+	svc.SetReceipts(receiptConfig(store))
+	_, err = svc.GetReceiptDownloadURL(context.Background(), "task-9")
+	assert.ErrorIs(t, err, ErrReceiptNotFound, "pending payments have no receipt")
+
+	t.Run("a paid transaction missing its receipt gets one", func(t *testing.T) {
+		tx.Status = PaymentStatusSuccess
+		u, err := svc.GetReceiptDownloadURL(context.Background(), "task-9")
+		require.NoError(t, err)
+		receipt := repo.receipts["tx-1"]
+		require.NotNil(t, receipt)
+		assert.Equal(t, "https://files.example/"+receipt.StorageKey, u)
+	})
+
+	t.Run("cart fees resolve through their line item", func(t *testing.T) {
+		cartSvc, cartRepo, cartTx := checkedOutCart(t, gateways.WebhookStatusSuccess)
+		cartSvc.SetReceipts(receiptConfig(&memStorage{}))
+		require.NoError(t, cartSvc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+
+		u, err := cartSvc.GetReceiptDownloadURL(context.Background(), "task-2")
+		require.NoError(t, err)
+		assert.Equal(t, "https://files.example/"+cartRepo.receipts[cartTx.ID].StorageKey, u)
+	})
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.ID = "tx-1"
+	tx.Status = PaymentStatusSuccess
+	repo.txs["TNSW1"] = tx
+	svc := NewPaymentService(repo, &mockRegistry{})
+	svc.SetReceipts(receiptConfig(&memStorage{}))
+	_, err := svc.GetReceiptDownloadURL(context.Background(), "task-9")
+	require.NoError(t, err)
+	code := repo.receipts["tx-1"].VerificationCode
+
+	v, err := svc.VerifyReceipt(context.Background(), code)
+	require.NoError(t, err)
+	assert.True(t, v.Valid)
+	assert.Equal(t, "TNSW1", v.ReferenceNumber)
+	assert.True(t, v.Amount.Equal(decimal.RequireFromString("1500")))
+
+	t.Run("refunded payment no longer verifies as valid", func(t *testing.T) {
+		tx.Status = PaymentStatusRefunded
+		v, err := svc.VerifyReceipt(context.Background(), code)
+		require.NoError(t, err)
+		assert.False(t, v.Valid)
+		assert.Equal(t, PaymentStatusRefunded, v.Status)
+	})
+
+	_, err = svc.VerifyReceipt(context.Background(), "UNKNOWNCODE00000")
+	assert.ErrorIs(t, err, ErrReceiptNotFound)
+}
+
+func TestIssueReceipt_LosingRaceReturnsWinner(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.ID = "tx-1"
+	tx.Status = PaymentStatusSuccess
+	repo.txs["TNSW1"] = tx
+	store := &memStorage{}
+	svc := NewPaymentService(repo, &mockRegistry{}).(*paymentService)
+	svc.SetReceipts(receiptConfig(store))
+
+	winner, err := svc.issueReceipt(context.Background(), tx)
+	require.NoError(t, err)
+	got, err := svc.issueReceipt(context.Background(), tx)
+	require.NoError(t, err)
+	assert.Same(t, winner, got)
+	assert.Len(t, store.files, 1, "the loser's file is removed")
+}
+
+func TestReceiptVerifyURL(t *testing.T) {
+	svc := &paymentService{receipts: &ReceiptConfig{VerifyBaseURL: "https://nsw.example/"}}
+	assert.Equal(t, "https://nsw.example/api/v1/payments/receipts/ABCD/verify", svc.receiptVerifyURL("ABCD"))
+}
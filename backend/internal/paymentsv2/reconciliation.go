@@ -0,0 +1,275 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ErrReconciliationNotFound indicates no reconciliation run matches an ID.
+var ErrReconciliationNotFound = errors.New("reconciliation run not found")
+
+// ErrInvalidReconciliation indicates a reconciliation request that cannot be
+// run as given, e.g. an empty or inverted period.
+var ErrInvalidReconciliation = errors.New("invalid reconciliation request")
+
+// ReconciliationResult classifies one line of a reconciliation report.
+type ReconciliationResult string
+
+const (
+	// ReconciliationMatched: settled by the gateway and recorded as paid in
+	// NSW, for the same amount and currency.
+	ReconciliationMatched ReconciliationResult = "MATCHED"
+	// ReconciliationMissingInNSW: the gateway settled a reference NSW does not
+	// have as paid (unknown, still pending, failed or expired), or settled it
+	// more than once.
+	ReconciliationMissingInNSW ReconciliationResult = "MISSING_IN_NSW"
+	// ReconciliationMissingAtGateway: NSW recorded a payment in the period
+	// that the settlement file does not contain.
+	ReconciliationMissingAtGateway ReconciliationResult = "MISSING_AT_GATEWAY"
+	// ReconciliationAmountMismatch: both sides have the reference but disagree
+	// on amount or currency.
+	ReconciliationAmountMismatch ReconciliationResult = "AMOUNT_MISMATCH"
+)
+
+// ReconciliationRun is one settlement file checked against payment_transactions.
+type ReconciliationRun struct {
+	ID        string `json:"id" gorm:"type:text;not null;primaryKey"`
+	GatewayID string `json:"gateway_id"`
+	FileName  string `json:"file_name"`
+	// PeriodFrom and PeriodTo bound (half-open) the NSW payments expected in
+	// the file. Payments recorded outside it are still matched when the file
+	// lists them, but are not reported missing when it doesn't.
+	PeriodFrom       time.Time            `json:"period_from"`
+	PeriodTo         time.Time            `json:"period_to"`
+	Matched          int                  `json:"matched"`
+	MissingInNSW     int                  `json:"missing_in_nsw"`
+	MissingAtGateway int                  `json:"missing_at_gateway"`
+	AmountMismatch   int                  `json:"amount_mismatch"`
+	CreatedBy        string               `json:"created_by"`
+	CreatedAt        time.Time            `json:"created_at"`
+	Items            []ReconciliationItem `json:"items,omitempty" gorm:"foreignKey:RunID"`
+}
+
+// TableName pins the table created by migration 025.
+func (ReconciliationRun) TableName() string { return "payment_reconciliation_runs" }
+
+// ReconciliationItem is one classified reference of a run.
+type ReconciliationItem struct {
+	ID              string               `json:"id" gorm:"type:text;not null;primaryKey"`
+	RunID           string               `json:"run_id" gorm:"index"`
+	Result          ReconciliationResult `json:"result"`
+	ReferenceNumber string               `json:"reference_number"`
+	TaskID          string               `json:"task_id,omitempty"`
+	NSWStatus       PaymentStatus        `json:"nsw_status,omitempty"`
+	NSWAmount       decimal.NullDecimal  `json:"nsw_amount"`
+	NSWCurrency     string               `json:"nsw_currency,omitempty"`
+	// Gateway* are taken from the settlement file; SettlementLine is 0 for
+	// MISSING_AT_GATEWAY items.
+	GatewayTransactionID string              `json:"gateway_transaction_id,omitempty"`
+	GatewayAmount        decimal.NullDecimal `json:"gateway_amount"`
+	GatewayCurrency      string              `json:"gateway_currency,omitempty"`
+	SettlementLine       int                 `json:"settlement_line,omitempty"`
+	Note                 string              `json:"note,omitempty"`
+}
+
+// TableName pins the table created by migration 025.
+func (ReconciliationItem) TableName() string { return "payment_reconciliation_items" }
+
+// ReconcileRequest describes a settlement file to reconcile.
+type ReconcileRequest struct {
+	GatewayID string
+	FileName  string
+	From      time.Time
+	To        time.Time
+	CreatedBy string
+}
+
+// ReconciliationService checks gateway settlement files against the payments
+// NSW recorded, and keeps the resulting reports.
+type ReconciliationService interface {
+	// Reconcile parses file with the gateway's settlement parser, classifies
+	// every reference and persists the run. A file the gateway cannot parse
+	// fails with an error wrapping gateways.ErrSettlementFormat.
+	Reconcile(ctx context.Context, req ReconcileRequest, file io.Reader) (*ReconciliationRun, error)
+
+	// GetRun returns a run with its items, or ErrReconciliationNotFound.
+	GetRun(ctx context.Context, id string) (*ReconciliationRun, error)
+
+	// ListRuns returns the latest runs, newest first, without items. An empty
+	// gatewayID lists runs of every gateway.
+	ListRuns(ctx context.Context, gatewayID string, limit int) ([]ReconciliationRun, error)
+}
+
+type reconciliationService struct {
+	repo     ReconciliationRepository
+	registry GatewayRegistry
+}
+
+// NewReconciliationService creates a ReconciliationService.
+func NewReconciliationService(repo ReconciliationRepository, registry GatewayRegistry) ReconciliationService {
+	return &reconciliationService{repo: repo, registry: registry}
+}
+
+func (s *reconciliationService) Reconcile(ctx context.Context, req ReconcileRequest, file io.Reader) (*ReconciliationRun, error) {
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		return nil, fmt.Errorf("%w: period must satisfy from < to", ErrInvalidReconciliation)
+	}
+	gateway, err := s.registry.Get(req.GatewayID)
+	if err != nil {
+		return nil, fmt.Errorf("method %q: %w: %w", req.GatewayID, ErrMethodUnavailable, err)
+	}
+
+	records, err := gateway.ParseSettlement(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s settlement file: %w", req.GatewayID, err)
+	}
+
+	expected, err := s.repo.ListPaidByGateway(ctx, req.GatewayID, req.From, req.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paid transactions: %w", err)
+	}
+	// References the file settles outside the period are looked up directly,
+	// so a payment recorded just before the period still matches.
+	known := make(map[string]PaymentTransaction, len(expected))
+	for _, tx := range expected {
+		known[tx.ReferenceNumber] = tx
+	}
+	var others []string
+	for _, rec := range records {
+		if _, ok := known[rec.ReferenceNumber]; !ok {
+			others = append(others, rec.ReferenceNumber)
+		}
+	}
+	if len(others) > 0 {
+		found, err := s.repo.ListByReferenceNumbers(ctx, others)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up settled references: %w", err)
+		}
+		for _, tx := range found {
+			known[tx.ReferenceNumber] = tx
+		}
+	}
+
+	runID := uuid.NewString()
+	run := &ReconciliationRun{
+		ID:         runID,
+		GatewayID:  req.GatewayID,
+		FileName:   req.FileName,
+		PeriodFrom: req.From,
+		PeriodTo:   req.To,
+		CreatedBy:  req.CreatedBy,
+		CreatedAt:  time.Now(),
+		Items:      classifySettlement(req.GatewayID, records, expected, known),
+	}
+	for i := range run.Items {
+		run.Items[i].ID = uuid.NewString()
+		run.Items[i].RunID = runID
+		switch run.Items[i].Result {
+		case ReconciliationMatched:
+			run.Matched++
+		case ReconciliationMissingInNSW:
+			run.MissingInNSW++
+		case ReconciliationMissingAtGateway:
+			run.MissingAtGateway++
+		case ReconciliationAmountMismatch:
+			run.AmountMismatch++
+		}
+	}
+
+	if err := s.repo.CreateRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to save reconciliation run: %w", err)
+	}
+	slog.InfoContext(ctx, "payment reconciliation completed",
+		"runId", run.ID, "gateway", run.GatewayID, "file", run.FileName,
+		"matched", run.Matched, "missingInNsw", run.MissingInNSW,
+		"missingAtGateway", run.MissingAtGateway, "amountMismatch", run.AmountMismatch)
+	return run, nil
+}
+
+// classifySettlement classifies each record of gatewayID's settlement file
+// against known (every NSW transaction the file references, plus expected),
+// then reports the expected payments the file never mentioned. Items keep file
+// order, followed by the missing-at-gateway ones.
+func classifySettlement(gatewayID string, records []gateways.SettlementRecord, expected []PaymentTransaction, known map[string]PaymentTransaction) []ReconciliationItem {
+	items := make([]ReconciliationItem, 0, len(records))
+	seen := make(map[string]bool, len(records))
+	for _, rec := range records {
+		item := ReconciliationItem{
+			ReferenceNumber:      rec.ReferenceNumber,
+			GatewayTransactionID: rec.GatewayTransactionID,
+			GatewayAmount:        decimal.NewNullDecimal(rec.Amount),
+			GatewayCurrency:      rec.Currency,
+			SettlementLine:       rec.Line,
+		}
+		tx, ok := known[rec.ReferenceNumber]
+		if ok {
+			item.TaskID = tx.TaskID
+			item.NSWStatus = tx.Status
+			item.NSWAmount = decimal.NewNullDecimal(tx.Amount)
+			item.NSWCurrency = tx.Currency
+		}
+
+		switch {
+		case !ok:
+			item.Result = ReconciliationMissingInNSW
+			item.Note = "unknown reference"
+		case tx.GatewayID != gatewayID:
+			item.Result = ReconciliationMissingInNSW
+			item.Note = "recorded against gateway " + tx.GatewayID
+		case seen[rec.ReferenceNumber]:
+			item.Result = ReconciliationMissingInNSW
+			item.Note = "settled more than once"
+		case !tx.Status.paid():
+			item.Result = ReconciliationMissingInNSW
+			item.Note = "not recorded as paid"
+		case !tx.Amount.Equal(rec.Amount) || tx.Currency != rec.Currency:
+			item.Result = ReconciliationAmountMismatch
+		default:
+			item.Result = ReconciliationMatched
+		}
+		seen[rec.ReferenceNumber] = true
+		items = append(items, item)
+	}
+
+	for _, tx := range expected {
+		if seen[tx.ReferenceNumber] {
+			continue
+		}
+		items = append(items, ReconciliationItem{
+			Result:          ReconciliationMissingAtGateway,
+			ReferenceNumber: tx.ReferenceNumber,
+			TaskID:          tx.TaskID,
+			NSWStatus:       tx.Status,
+			NSWAmount:       decimal.NewNullDecimal(tx.Amount),
+			NSWCurrency:     tx.Currency,
+		})
+	}
+	return items
+}
+
+func (s *reconciliationService) GetRun(ctx context.Context, id string) (*ReconciliationRun, error) {
+	run, err := s.repo.GetRun(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve reconciliation run: %w", err)
+	}
+	if run == nil {
+		return nil, fmt.Errorf("run %s: %w", id, ErrReconciliationNotFound)
+	}
+	return run, nil
+}
+
+func (s *reconciliationService) ListRuns(ctx context.Context, gatewayID string, limit int) ([]ReconciliationRun, error) {
+	runs, err := s.repo.ListRuns(ctx, gatewayID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reconciliation runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,212 @@
+package paymentsv2
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/auth"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// maxSettlementFileSize bounds an uploaded settlement file (and the form
+	// around it).
+	maxSettlementFileSize = 20 << 20 // 20MB
+
+	defaultReconciliationListLimit = 50
+	maxReconciliationListLimit     = 200
+)
+
+// reconciliationCSVHeader is the header row of an exported report.
+var reconciliationCSVHeader = []string{
+	"result", "reference_number", "task_id", "nsw_status", "nsw_amount", "nsw_currency",
+	"gateway_transaction_id", "gateway_amount", "gateway_currency", "settlement_line", "note",
+}
+
+// ReconciliationHandler serves the authenticated reconciliation report API.
+type ReconciliationHandler struct {
+	service ReconciliationService
+}
+
+// NewReconciliationHandler creates a new handler.
+func NewReconciliationHandler(service ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{service: service}
+}
+
+// HandleReconcile handles POST /api/v1/admin/payments/reconciliations
+// Multipart form: gateway_id, from, to (RFC 3339 or YYYY-MM-DD) and the
+// settlement file as "file". Responds 201 with the run and its items.
+func (h *ReconciliationHandler) HandleReconcile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSettlementFileSize)
+	if err := r.ParseMultipartForm(maxSettlementFileSize); err != nil {
+		http.Error(w, "invalid multipart form or file too large", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	gatewayID := r.FormValue("gateway_id")
+	if gatewayID == "" {
+		http.Error(w, "gateway_id is required", http.StatusBadRequest)
+		return
+	}
+	from, err := parsePeriodBound(r.FormValue("from"))
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parsePeriodBound(r.FormValue("to"))
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	run, err := h.service.Reconcile(r.Context(), ReconcileRequest{
+		GatewayID: gatewayID,
+		FileName:  header.Filename,
+		From:      from,
+		To:        to,
+		CreatedBy: auth.GetAuthContext(r.Context()).Subject(),
+	}, file)
+	switch {
+	case errors.Is(err, ErrInvalidReconciliation), errors.Is(err, gateways.ErrSettlementFormat):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrMethodUnavailable):
+		http.Error(w, "unknown payment gateway", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to reconcile settlement file", "gateway", gatewayID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(run); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// parsePeriodBound accepts an RFC 3339 timestamp or a YYYY-MM-DD date (UTC midnight).
+func parsePeriodBound(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, errors.New("is required")
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or YYYY-MM-DD date", raw)
+}
+
+// HandleListRuns handles GET /api/v1/admin/payments/reconciliations
+// Optional query parameters: gateway_id, limit (default 50, max 200).
+func (h *ReconciliationHandler) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultReconciliationListLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxReconciliationListLimit)
+	}
+
+	runs, err := h.service.ListRuns(r.Context(), r.URL.Query().Get("gateway_id"), limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list reconciliation runs", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// HandleGetRun handles GET /api/v1/admin/payments/reconciliations/{runId}
+// Returns the run summary and all of its items.
+func (h *ReconciliationHandler) HandleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := h.getRun(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(run); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// HandleExportRun handles GET /api/v1/admin/payments/reconciliations/{runId}/export
+// Returns the run's items as a CSV attachment.
+func (h *ReconciliationHandler) HandleExportRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := h.getRun(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="reconciliation-%s.csv"`, run.ID))
+	cw := csv.NewWriter(w)
+	_ = cw.Write(reconciliationCSVHeader)
+	for _, item := range run.Items {
+		line := ""
+		if item.SettlementLine > 0 {
+			line = strconv.Itoa(item.SettlementLine)
+		}
+		_ = cw.Write([]string{
+			string(item.Result), item.ReferenceNumber, item.TaskID, string(item.NSWStatus),
+			formatNullAmount(item.NSWAmount), item.NSWCurrency,
+			item.GatewayTransactionID, formatNullAmount(item.GatewayAmount), item.GatewayCurrency,
+			line, item.Note,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+func (h *ReconciliationHandler) getRun(w http.ResponseWriter, r *http.Request) (*ReconciliationRun, bool) {
+	runID := r.PathValue("runId")
+	if runID == "" {
+		http.Error(w, "run ID is required in URL", http.StatusBadRequest)
+		return nil, false
+	}
+
+	run, err := h.service.GetRun(r.Context(), runID)
+	if errors.Is(err, ErrReconciliationNotFound) {
+		http.Error(w, "reconciliation run not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get reconciliation run", "runId", runID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return run, true
+}
+
+func formatNullAmount(d decimal.NullDecimal) string {
+	if !d.Valid {
+		return ""
+	}
+	return d.Decimal.StringFixed(2)
+}
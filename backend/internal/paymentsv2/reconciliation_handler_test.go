@@ -0,0 +1,129 @@
+package paymentsv2
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/OpenNSW/nsw/backend/internal/auth"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReconciliationMux(repo *mockReconRepo) *http.ServeMux {
+	h := NewReconciliationHandler(NewReconciliationService(repo, &mockRegistry{gw: &gateways.GovPayGateway{}}))
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/admin/payments/reconciliations", h.HandleReconcile)
+	mux.HandleFunc("GET /api/v1/admin/payments/reconciliations", h.HandleListRuns)
+	mux.HandleFunc("GET /api/v1/admin/payments/reconciliations/{runId}", h.HandleGetRun)
+	mux.HandleFunc("GET /api/v1/admin/payments/reconciliations/{runId}/export", h.HandleExportRun)
+	return mux
+}
+
+// uploadSettlement builds the multipart upload request; file is a testdata path
+// or "" to omit the file part.
+func uploadSettlement(t *testing.T, fields map[string]string, file string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(t, mw.WriteField(k, v))
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		part, err := mw.CreateFormFile("file", "settlement.csv")
+		require.NoError(t, err)
+		_, _ = part.Write(data)
+	}
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/payments/reconciliations", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	authCtx := &auth.AuthContext{User: &auth.UserContext{ID: "finance-1"}}
+	return req.WithContext(context.WithValue(req.Context(), auth.AuthContextKey, authCtx))
+}
+
+func TestReconciliationHandler_ReconcileAndExport(t *testing.T) {
+	mux := newReconciliationMux(settlementFixture())
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, uploadSettlement(t, map[string]string{
+		"gateway_id": "govpay", "from": "2026-10-16", "to": "2026-10-17",
+	}, "testdata/govpay_settlement_2026-10-16.csv"))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var run ReconciliationRun
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &run))
+	assert.Equal(t, "settlement.csv", run.FileName)
+	assert.Equal(t, "finance-1", run.CreatedBy)
+	assert.Equal(t, 3, run.Matched)
+	assert.Len(t, run.Items, 9)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/payments/reconciliations/"+run.ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"missing_at_gateway":1`)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/payments/reconciliations/"+run.ID+"/export", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "reconciliation-"+run.ID+".csv")
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 10)
+	assert.Equal(t, reconciliationCSVHeader, rows[0])
+	assert.Equal(t, []string{"AMOUNT_MISMATCH", "TNSWMISM0002", "task-TNSWMISM0002", "SUCCESS", "2000.00", "LKR", "BOC-1002", "2000.50", "LKR", "3", ""}, rows[2])
+	assert.Equal(t, []string{"MISSING_AT_GATEWAY", "TNSWGONE0003", "task-TNSWGONE0003", "SUCCESS", "750.00", "LKR", "", "", "", "", ""}, rows[9])
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/payments/reconciliations?gateway_id=govpay", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var runs []ReconciliationRun
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &runs))
+	require.Len(t, runs, 1)
+	assert.Empty(t, runs[0].Items, "list returns summaries only")
+}
+
+func TestReconciliationHandler_Errors(t *testing.T) {
+	fixture := "testdata/govpay_settlement_2026-10-16.csv"
+	cases := []struct {
+		name   string
+		fields map[string]string
+		file   string
+		want   int
+	}{
+		{"missing gateway", map[string]string{"from": "2026-10-16", "to": "2026-10-17"}, fixture, http.StatusBadRequest},
+		{"bad from", map[string]string{"gateway_id": "govpay", "from": "16/10/2026", "to": "2026-10-17"}, fixture, http.StatusBadRequest},
+		{"inverted period", map[string]string{"gateway_id": "govpay", "from": "2026-10-17", "to": "2026-10-16"}, fixture, http.StatusBadRequest},
+		{"missing file", map[string]string{"gateway_id": "govpay", "from": "2026-10-16", "to": "2026-10-17"}, "", http.StatusBadRequest},
+		{"malformed file", map[string]string{"gateway_id": "govpay", "from": "2026-10-16", "to": "2026-10-17"}, "gateways/testdata/govpay_settlement_bad_amount.csv", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newReconciliationMux(settlementFixture()).ServeHTTP(rec, uploadSettlement(t, tc.fields, tc.file))
+			assert.Equal(t, tc.want, rec.Code, rec.Body.String())
+		})
+	}
+
+	t.Run("unknown run", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newReconciliationMux(&mockReconRepo{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/payments/reconciliations/nope/export", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("bad limit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newReconciliationMux(&mockReconRepo{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/payments/reconciliations?limit=-1", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
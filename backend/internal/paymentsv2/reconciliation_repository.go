@@ -0,0 +1,100 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// paidStatuses are the statuses of a transaction the gateway collected money
+// for, whatever NSW did with it afterwards.
+var paidStatuses = []PaymentStatus{PaymentStatusSuccess, PaymentStatusRefundRequired, PaymentStatusRefundPending, PaymentStatusRefunded}
+
+// reconciliationItemBatch bounds the rows per INSERT when saving a run.
+const reconciliationItemBatch = 500
+
+// ReconciliationRepository persists reconciliation runs and reads the
+// transactions they are checked against.
+type ReconciliationRepository interface {
+	// ListPaidByGateway returns the gateway's paid transactions whose last
+	// update (the webhook that marked them paid) falls in [from, to).
+	ListPaidByGateway(ctx context.Context, gatewayID string, from, to time.Time) ([]PaymentTransaction, error)
+	// ListByReferenceNumbers returns the transactions with the given references,
+	// in any status and of any gateway. Unknown references are omitted.
+	ListByReferenceNumbers(ctx context.Context, referenceNumbers []string) ([]PaymentTransaction, error)
+	// CreateRun saves a run and its items in one transaction.
+	CreateRun(ctx context.Context, run *ReconciliationRun) error
+	// GetRun returns a run with its items in file order, followed by the
+	// missing-at-gateway ones, or nil if it does not exist.
+	GetRun(ctx context.Context, id string) (*ReconciliationRun, error)
+	// ListRuns returns up to limit runs, newest first, without items.
+	ListRuns(ctx context.Context, gatewayID string, limit int) ([]ReconciliationRun, error)
+}
+
+type reconciliationRepository struct {
+	db *gorm.DB
+}
+
+// NewReconciliationRepository creates a new instance of ReconciliationRepository.
+func NewReconciliationRepository(db *gorm.DB) ReconciliationRepository {
+	return &reconciliationRepository{db: db}
+}
+
+func (r *reconciliationRepository) ListPaidByGateway(ctx context.Context, gatewayID string, from, to time.Time) ([]PaymentTransaction, error) {
+	var txs []PaymentTransaction
+	err := r.db.WithContext(ctx).
+		Where("gateway_id = ? AND status IN ? AND updated_at >= ? AND updated_at < ?", gatewayID, paidStatuses, from, to).
+		Order("updated_at").
+		Find(&txs).Error
+	return txs, err
+}
+
+func (r *reconciliationRepository) ListByReferenceNumbers(ctx context.Context, referenceNumbers []string) ([]PaymentTransaction, error) {
+	var txs []PaymentTransaction
+	if len(referenceNumbers) == 0 {
+		return txs, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("reference_number IN ?", referenceNumbers).
+		Find(&txs).Error
+	return txs, err
+}
+
+func (r *reconciliationRepository) CreateRun(ctx context.Context, run *ReconciliationRun) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Items").Create(run).Error; err != nil {
+			return err
+		}
+		if len(run.Items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(run.Items, reconciliationItemBatch).Error
+	})
+}
+
+func (r *reconciliationRepository) GetRun(ctx context.Context, id string) (*ReconciliationRun, error) {
+	var run ReconciliationRun
+	err := r.db.WithContext(ctx).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("settlement_line = 0, settlement_line, reference_number") }).
+		Where("id = ?", id).
+		First(&run).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *reconciliationRepository) ListRuns(ctx context.Context, gatewayID string, limit int) ([]ReconciliationRun, error) {
+	var runs []ReconciliationRun
+	q := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if gatewayID != "" {
+		q = q.Where("gateway_id = ?", gatewayID)
+	}
+	err := q.Find(&runs).Error
+	return runs, err
+}
@@ -0,0 +1,104 @@
+package paymentsv2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconciliationRepository_ListPaidByGateway(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewReconciliationRepository(db)
+	from := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	rows := sqlmock.NewRows([]string{"id", "reference_number", "status"}).
+		AddRow("uuid-1", "TNSW1", PaymentStatusSuccess)
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE gateway_id = \$1 AND status IN \(\$2,\$3,\$4,\$5\) AND updated_at >= \$6 AND updated_at < \$7 ORDER BY updated_at`).
+		WithArgs("govpay", PaymentStatusSuccess, PaymentStatusRefundRequired, PaymentStatusRefundPending, PaymentStatusRefunded, from, to).
+		WillReturnRows(rows)
+
+	txs, err := repo.ListPaidByGateway(context.Background(), "govpay", from, to)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "TNSW1", txs[0].ReferenceNumber)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconciliationRepository_ListByReferenceNumbers(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewReconciliationRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE reference_number IN \(\$1,\$2\)`).
+		WithArgs("TNSW1", "TNSW2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reference_number"}).AddRow("uuid-1", "TNSW1"))
+
+	txs, err := repo.ListByReferenceNumbers(context.Background(), []string{"TNSW1", "TNSW2"})
+	require.NoError(t, err)
+	assert.Len(t, txs, 1)
+
+	txs, err = repo.ListByReferenceNumbers(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, txs, "no query for no references")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconciliationRepository_CreateRun(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewReconciliationRepository(db)
+
+	run := &ReconciliationRun{
+		ID:        "run-1",
+		GatewayID: "govpay",
+		Matched:   1,
+		CreatedAt: time.Now(),
+		Items: []ReconciliationItem{{
+			ID: "item-1", RunID: "run-1", Result: ReconciliationMatched, ReferenceNumber: "TNSW1",
+			NSWAmount: decimal.NewNullDecimal(decimal.NewFromInt(1500)), GatewayAmount: decimal.NewNullDecimal(decimal.NewFromInt(1500)),
+		}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "payment_reconciliation_runs"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO "payment_reconciliation_items"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.CreateRun(context.Background(), run))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconciliationRepository_GetRun(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewReconciliationRepository(db)
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM "payment_reconciliation_runs" WHERE id = \$1`).
+			WithArgs("run-1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "gateway_id"}).AddRow("run-1", "govpay"))
+		mock.ExpectQuery(`SELECT \* FROM "payment_reconciliation_items" WHERE "payment_reconciliation_items"."run_id" = \$1 ORDER BY settlement_line = 0, settlement_line, reference_number`).
+			WithArgs("run-1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "run_id", "result"}).AddRow("item-1", "run-1", ReconciliationMatched))
+
+		run, err := repo.GetRun(context.Background(), "run-1")
+		require.NoError(t, err)
+		require.NotNil(t, run)
+		require.Len(t, run.Items, 1)
+		assert.Equal(t, ReconciliationMatched, run.Items[0].Result)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM "payment_reconciliation_runs" WHERE id = \$1`).
+			WithArgs("missing", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		run, err := repo.GetRun(context.Background(), "missing")
+		require.NoError(t, err)
+		assert.Nil(t, run)
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
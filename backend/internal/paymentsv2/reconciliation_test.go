@@ -0,0 +1,228 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockReconRepo is an in-memory ReconciliationRepository. paid is what
+// ListPaidByGateway returns for the period; all is searched by reference.
+type mockReconRepo struct {
+	paid     []PaymentTransaction
+	all      []PaymentTransaction
+	runs     map[string]*ReconciliationRun
+	lookedUp []string
+	saveErr  error
+}
+
+func (m *mockReconRepo) ListPaidByGateway(context.Context, string, time.Time, time.Time) ([]PaymentTransaction, error) {
+	return m.paid, nil
+}
+
+func (m *mockReconRepo) ListByReferenceNumbers(_ context.Context, refs []string) ([]PaymentTransaction, error) {
+	m.lookedUp = append(m.lookedUp, refs...)
+	var out []PaymentTransaction
+	for _, tx := range m.all {
+		for _, ref := range refs {
+			if tx.ReferenceNumber == ref {
+				out = append(out, tx)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (m *mockReconRepo) CreateRun(_ context.Context, run *ReconciliationRun) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	if m.runs == nil {
+		m.runs = map[string]*ReconciliationRun{}
+	}
+	m.runs[run.ID] = run
+	return nil
+}
+
+func (m *mockReconRepo) GetRun(_ context.Context, id string) (*ReconciliationRun, error) {
+	return m.runs[id], nil
+}
+
+func (m *mockReconRepo) ListRuns(context.Context, string, int) ([]ReconciliationRun, error) {
+	var out []ReconciliationRun
+	for _, run := range m.runs {
+		summary := *run
+		summary.Items = nil
+		out = append(out, summary)
+	}
+	return out, nil
+}
+
+func paidTx(ref, amount, currency string, status PaymentStatus) PaymentTransaction {
+	return PaymentTransaction{
+		ReferenceNumber: ref,
+		TaskID:          "task-" + ref,
+		GatewayID:       "govpay",
+		Amount:          decimal.RequireFromString(amount),
+		Currency:        currency,
+		Status:          status,
+	}
+}
+
+// settlementFixture is the NSW side of testdata/govpay_settlement_2026-10-16.csv.
+func settlementFixture() *mockReconRepo {
+	inPeriod := []PaymentTransaction{
+		paidTx("TNSWMATCH001", "1500", "LKR", PaymentStatusSuccess),
+		paidTx("TNSWMISM0002", "2000", "LKR", PaymentStatusSuccess),
+		paidTx("TNSWGONE0003", "750", "LKR", PaymentStatusSuccess),
+		paidTx("TNSWLATE0004", "1200", "LKR", PaymentStatusRefundRequired),
+		paidTx("TNSWUSD00008", "100", "USD", PaymentStatusSuccess),
+	}
+	return &mockReconRepo{
+		paid: inPeriod,
+		all: append([]PaymentTransaction{
+			paidTx("TNSWPREV0005", "900", "LKR", PaymentStatusSuccess), // recorded the day before
+			paidTx("TNSWPEND0006", "500", "LKR", PaymentStatusPending),
+		}, inPeriod...),
+	}
+}
+
+func reconcileFixture(t *testing.T, repo *mockReconRepo) (*ReconciliationRun, error) {
+	t.Helper()
+	f, err := os.Open("testdata/govpay_settlement_2026-10-16.csv")
+	require.NoError(t, err)
+	defer f.Close()
+
+	svc := NewReconciliationService(repo, &mockRegistry{gw: &gateways.GovPayGateway{}})
+	return svc.Reconcile(context.Background(), ReconcileRequest{
+		GatewayID: "govpay",
+		FileName:  "govpay_settlement_2026-10-16.csv",
+		From:      time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		CreatedBy: "finance-1",
+	}, f)
+}
+
+func TestReconcile_ClassifiesSettlementFile(t *testing.T) {
+	repo := settlementFixture()
+	run, err := reconcileFixture(t, repo)
+	require.NoError(t, err)
+
+	got := make([]string, 0, len(run.Items))
+	for _, item := range run.Items {
+		got = append(got, item.ReferenceNumber+" "+string(item.Result)+" "+item.Note)
+	}
+	assert.Equal(t, []string{
+		"TNSWMATCH001 MATCHED ",
+		"TNSWMISM0002 AMOUNT_MISMATCH ",
+		"TNSWLATE0004 MATCHED ",
+		"TNSWPREV0005 MATCHED ",
+		"TNSWPEND0006 MISSING_IN_NSW not recorded as paid",
+		"TNSWUNKN0007 MISSING_IN_NSW unknown reference",
+		"TNSWMATCH001 MISSING_IN_NSW settled more than once",
+		"TNSWUSD00008 AMOUNT_MISMATCH ",
+		"TNSWGONE0003 MISSING_AT_GATEWAY ",
+	}, got)
+
+	assert.Equal(t, 3, run.Matched)
+	assert.Equal(t, 3, run.MissingInNSW)
+	assert.Equal(t, 1, run.MissingAtGateway)
+	assert.Equal(t, 2, run.AmountMismatch)
+	assert.Equal(t, "finance-1", run.CreatedBy)
+
+	mismatch := run.Items[1]
+	assert.Equal(t, "task-TNSWMISM0002", mismatch.TaskID)
+	assert.Equal(t, "2000", mismatch.NSWAmount.Decimal.String())
+	assert.Equal(t, "2000.5", mismatch.GatewayAmount.Decimal.String())
+	assert.Equal(t, "BOC-1002", mismatch.GatewayTransactionID)
+	assert.Equal(t, 3, mismatch.SettlementLine)
+
+	unknown := run.Items[5]
+	assert.False(t, unknown.NSWAmount.Valid)
+	missing := run.Items[8]
+	assert.False(t, missing.GatewayAmount.Valid)
+	assert.Zero(t, missing.SettlementLine)
+
+	assert.ElementsMatch(t, []string{"TNSWPREV0005", "TNSWPEND0006", "TNSWUNKN0007"}, repo.lookedUp,
+		"only references outside the period baseline are looked up")
+	require.Contains(t, repo.runs, run.ID, "run persisted")
+	for _, item := range run.Items {
+		assert.Equal(t, run.ID, item.RunID)
+		assert.NotEmpty(t, item.ID)
+	}
+}
+
+func TestReconcile_ReferenceOfAnotherGateway(t *testing.T) {
+	repo := settlementFixture()
+	for i, tx := range repo.all {
+		if tx.ReferenceNumber == "TNSWPREV0005" {
+			repo.all[i].GatewayID = "lankapay"
+		}
+	}
+	run, err := reconcileFixture(t, repo)
+	require.NoError(t, err)
+
+	item := run.Items[3]
+	assert.Equal(t, "TNSWPREV0005", item.ReferenceNumber)
+	assert.Equal(t, ReconciliationMissingInNSW, item.Result)
+	assert.Equal(t, "recorded against gateway lankapay", item.Note)
+	assert.Equal(t, 2, run.Matched)
+	assert.Equal(t, 4, run.MissingInNSW)
+}
+
+func TestReconcile_Errors(t *testing.T) {
+	period := ReconcileRequest{
+		GatewayID: "govpay",
+		From:      time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("inverted period", func(t *testing.T) {
+		svc := NewReconciliationService(&mockReconRepo{}, &mockRegistry{gw: &gateways.GovPayGateway{}})
+		req := period
+		req.From, req.To = req.To, req.From
+		_, err := svc.Reconcile(context.Background(), req, strings.NewReader(""))
+		assert.ErrorIs(t, err, ErrInvalidReconciliation)
+	})
+	t.Run("unknown gateway", func(t *testing.T) {
+		svc := NewReconciliationService(&mockReconRepo{}, &mockRegistry{getErr: errors.New("not found")})
+		_, err := svc.Reconcile(context.Background(), period, strings.NewReader(""))
+		assert.ErrorIs(t, err, ErrMethodUnavailable)
+	})
+	t.Run("malformed file", func(t *testing.T) {
+		repo := &mockReconRepo{}
+		svc := NewReconciliationService(repo, &mockRegistry{gw: &gateways.GovPayGateway{}})
+		_, err := svc.Reconcile(context.Background(), period, strings.NewReader("Transaction ID,Amount\nTNSW1,abc\n"))
+		assert.ErrorIs(t, err, gateways.ErrSettlementFormat)
+		assert.Empty(t, repo.runs, "nothing persisted")
+	})
+	t.Run("save failure", func(t *testing.T) {
+		repo := settlementFixture()
+		repo.saveErr = errors.New("db down")
+		_, err := reconcileFixture(t, repo)
+		assert.ErrorContains(t, err, "db down")
+	})
+}
+
+func TestReconciliation_GetRun(t *testing.T) {
+	repo := settlementFixture()
+	run, err := reconcileFixture(t, repo)
+	require.NoError(t, err)
+	svc := NewReconciliationService(repo, &mockRegistry{})
+
+	got, err := svc.GetRun(context.Background(), run.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Items, 9)
+
+	_, err = svc.GetRun(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrReconciliationNotFound)
+}
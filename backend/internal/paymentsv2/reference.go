@@ -0,0 +1,82 @@
+package paymentsv2
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+)
+
+// TaskParties names who a task's fee is between: the trader company paying it
+// and the OGA collecting it.
+type TaskParties struct {
+	TraderName string
+	OGAName    string
+}
+
+// PartyResolver resolves the parties of a task's fee. It is satisfied by
+// taskv2.PaymentPartyResolver, which walks task_records_v2 to the consignment
+// and its trader company, and the task template to the OGA's service.
+type PartyResolver interface {
+	ResolveTaskParties(ctx context.Context, taskID string) (*TaskParties, error)
+}
+
+func (s *paymentService) SetPartyResolver(resolver PartyResolver) {
+	s.parties = resolver
+}
+
+// validationRejection decides why tx cannot be paid at now, or returns "" if
+// its status and expiry allow payment. Whether it is still the latest attempt
+// is checked separately.
+func validationRejection(tx *PaymentTransaction, now time.Time) gateways.ValidationRejection {
+	switch {
+	case tx.Status.paid():
+		return gateways.RejectionAlreadyPaid
+	case tx.Status == PaymentStatusExpired:
+		return gateways.RejectionExpired
+	case tx.Status != PaymentStatusPending:
+		// Failed and superseded attempts are withdrawn; a new reference is needed.
+		return gateways.RejectionCancelled
+	case !now.Before(tx.ExpiryDate):
+		// Past its expiry date but not yet swept.
+		return gateways.RejectionExpired
+	default:
+		return ""
+	}
+}
+
+// describeReference fills in who a payable reference is between and the fees
+// making up its amount. Parties come from the resolver when one is wired; a
+// failure there is logged and falls back to the OGA recorded at checkout, so
+// the payer is never refused over a display name.
+func (s *paymentService) describeReference(ctx context.Context, tx *PaymentTransaction, v *gateways.ValidationTransaction) error {
+	lines, err := s.receiptLines(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if s.parties != nil {
+		for i := range lines {
+			parties, err := s.parties.ResolveTaskParties(ctx, lines[i].TaskID)
+			if err != nil {
+				slog.WarnContext(ctx, "paymentsv2: failed to resolve payment parties",
+					"reference", tx.ReferenceNumber, "taskId", lines[i].TaskID, "error", err)
+				continue
+			}
+			if v.TraderName == "" {
+				v.TraderName = parties.TraderName
+			}
+			if parties.OGAName != "" {
+				lines[i].OGAName = parties.OGAName
+			}
+		}
+	}
+
+	v.OGAName = receiptOGAName(lines)
+	v.Breakdown = make([]gateways.ValidationLine, len(lines))
+	for i, l := range lines {
+		v.Breakdown[i] = gateways.ValidationLine{TaskCode: l.TaskCode, Description: l.Description, OGAName: l.OGAName, Amount: l.Amount}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package paymentsv2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// taskParties is an in-memory PartyResolver keyed by task ID.
+type taskParties map[string]TaskParties
+
+func (p taskParties) ResolveTaskParties(_ context.Context, taskID string) (*TaskParties, error) {
+	parties, ok := p[taskID]
+	if !ok {
+		return nil, errors.New("task not found")
+	}
+	return &parties, nil
+}
+
+// capturingGateway records the ValidationTransaction and payability handed to
+// HandleValidateReference.
+func capturingGateway(ref string, got **gateways.ValidationTransaction, payable *bool) *MockGateway {
+	gw := validateGateway(ref)
+	gw.On("HandleValidateReference", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*got = args.Get(1).(*gateways.ValidationTransaction)
+			*payable = args.Bool(2)
+		}).
+		Return(&gateways.ValidationResponse{HTTPStatus: 200, Payload: []byte(`{}`)}, nil)
+	return gw
+}
+
+func TestValidateReference_Rejections(t *testing.T) {
+	cases := map[string]struct {
+		status PaymentStatus
+		expiry time.Duration
+		want   gateways.ValidationRejection
+	}{
+		"paid":                {status: PaymentStatusSuccess, expiry: time.Hour, want: gateways.RejectionAlreadyPaid},
+		"refunded":            {status: PaymentStatusRefunded, expiry: time.Hour, want: gateways.RejectionAlreadyPaid},
+		"paid after expiry":   {status: PaymentStatusRefundRequired, expiry: -time.Hour, want: gateways.RejectionAlreadyPaid},
+		"swept as expired":    {status: PaymentStatusExpired, expiry: -time.Hour, want: gateways.RejectionExpired},
+		"pending past expiry": {status: PaymentStatusPending, expiry: -time.Minute, want: gateways.RejectionExpired},
+		"superseded":          {status: PaymentStatusSuperseded, expiry: time.Hour, want: gateways.RejectionCancelled},
+		"failed":              {status: PaymentStatusFailed, expiry: time.Hour, want: gateways.RejectionCancelled},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := newMockRepo()
+			tx := pendingTx()
+			tx.Status = tc.status
+			tx.ExpiryDate = time.Now().Add(tc.expiry)
+			repo.txs["TNSW1"] = tx
+			var got *gateways.ValidationTransaction
+			var payable bool
+			svc := NewPaymentService(repo, &mockRegistry{gw: capturingGateway("TNSW1", &got, &payable)})
+			svc.SetPartyResolver(taskParties{"task-9": {TraderName: "Ceylon Spice Exports", OGAName: "FCAU"}})
+
+			_, err := svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+			require.NoError(t, err)
+			require.NotNil(t, got)
+			assert.False(t, payable)
+			assert.Equal(t, tc.want, got.Rejection)
+			assert.Empty(t, got.TraderName, "rejected references are not described")
+			assert.Empty(t, got.Breakdown)
+		})
+	}
+
+	t.Run("not the latest attempt", func(t *testing.T) {
+		repo := newMockRepo()
+		old := pendingTx()
+		repo.txs["TNSW1"] = old
+		latest := pendingTx()
+		latest.ReferenceNumber = "TNSW2"
+		latest.AttemptNo = 2
+		repo.txs["TNSW2"] = latest
+		var got *gateways.ValidationTransaction
+		var payable bool
+		svc := NewPaymentService(repo, &mockRegistry{gw: capturingGateway("TNSW1", &got, &payable)})
+
+		_, err := svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+		require.NoError(t, err)
+		assert.False(t, payable)
+		assert.Equal(t, gateways.RejectionCancelled, got.Rejection)
+	})
+}
+
+func TestValidateReference_DescribesPayableReference(t *testing.T) {
+	repo := newMockRepo()
+	tx := pendingTx()
+	tx.GatewayMetadata = map[string]string{"task_id": "task-9", "task_code": "FCAU_FEE", "oga_name": "FCAU"}
+	repo.txs["TNSW1"] = tx
+	var got *gateways.ValidationTransaction
+	var payable bool
+	svc := NewPaymentService(repo, &mockRegistry{gw: capturingGateway("TNSW1", &got, &payable)})
+	svc.SetPartyResolver(taskParties{"task-9": {TraderName: "Ceylon Spice Exports", OGAName: "Food Control Administration Unit"}})
+
+	_, err := svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+	require.NoError(t, err)
+	assert.True(t, payable)
+	assert.Empty(t, got.Rejection)
+	assert.Equal(t, "Ceylon Spice Exports", got.TraderName)
+	assert.Equal(t, "Food Control Administration Unit", got.OGAName)
+	require.Len(t, got.Breakdown, 1)
+	assert.Equal(t, "FCAU_FEE", got.Breakdown[0].TaskCode)
+	assert.True(t, got.Breakdown[0].Amount.Equal(decimal.RequireFromString("1500")))
+
+	t.Run("resolver failure keeps the OGA recorded at checkout", func(t *testing.T) {
+		svc.SetPartyResolver(taskParties{})
+		_, err := svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+		require.NoError(t, err)
+		assert.True(t, payable)
+		assert.Empty(t, got.TraderName)
+		assert.Equal(t, "FCAU", got.OGAName)
+	})
+}
+
+func TestValidateReference_CartBreakdown(t *testing.T) {
+	gw := cartGateway()
+	svc, _ := cartService(t, gw)
+	resp, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{ConsignmentID: "cons-1", GatewayID: "govpay"})
+	require.NoError(t, err)
+	svc.SetPartyResolver(taskParties{
+		"task-1": {TraderName: "Ceylon Spice Exports", OGAName: "FCAU"},
+		"task-2": {TraderName: "Ceylon Spice Exports", OGAName: "CDA"},
+	})
+
+	var got *gateways.ValidationTransaction
+	gw.On("ExtractReferenceNumber", mock.Anything, mock.Anything).Return(resp.ReferenceNumber, nil)
+	gw.On("HandleValidateReference", mock.Anything, mock.Anything, true, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(1).(*gateways.ValidationTransaction) }).
+		Return(&gateways.ValidationResponse{HTTPStatus: 200}, nil)
+
+	_, err = svc.ValidateReference(context.Background(), "govpay", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Ceylon Spice Exports", got.TraderName)
+	assert.Equal(t, "CDA, FCAU", got.OGAName)
+	require.Len(t, got.Breakdown, 2)
+	assert.Equal(t, "FCAU", got.Breakdown[0].OGAName)
+	assert.True(t, got.Breakdown[0].Amount.Equal(decimal.RequireFromString("250")))
+	assert.Equal(t, "CDA", got.Breakdown[1].OGAName)
+	assert.True(t, got.Breakdown[1].Amount.Equal(decimal.RequireFromString("1500")))
+}
+
+// The GovPay validation response for a reference read through the real
+// repository, from lookup to the teller-facing payload.
+func TestValidateReference_GovPayRepositoryBacked(t *testing.T) {
+	txColumns := []string{"id", "reference_number", "task_id", "attempt_no", "gateway_id", "amount", "currency", "status", "expiry_date", "gateway_metadata"}
+	txRow := func(status PaymentStatus, expiry time.Time) *sqlmock.Rows {
+		return sqlmock.NewRows(txColumns).AddRow("tx-1", "TNSW1", "task-9", 1, "govpay", "1500.00", "LKR", status, expiry,
+			[]byte(`{"task_code":"FCAU_FEE","oga_name":"FCAU"}`))
+	}
+	validate := func(t *testing.T, svc PaymentService) gateways.GovPayValidateResponse {
+		t.Helper()
+		resp, err := svc.ValidateReference(context.Background(), "govpay", json.RawMessage(`{"transactionId":"TNSW1","serviceId":"sv1"}`))
+		require.NoError(t, err)
+		var out gateways.GovPayValidateResponse
+		require.NoError(t, json.Unmarshal(resp.Payload, &out))
+		return out
+	}
+	parties := taskParties{"task-9": {TraderName: "Ceylon Spice Exports", OGAName: "Food Control Administration Unit"}}
+
+	t.Run("payable", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewPaymentService(NewPaymentRepository(db), &mockRegistry{gw: &gateways.GovPayGateway{}})
+		svc.SetPartyResolver(parties)
+		expiry := time.Now().Add(time.Hour)
+		sqlMock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE reference_number = \$1`).
+			WithArgs("TNSW1", 1).WillReturnRows(txRow(PaymentStatusPending, expiry))
+		sqlMock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE task_id = \$1 ORDER BY attempt_no`).
+			WithArgs("task-9").WillReturnRows(txRow(PaymentStatusPending, expiry))
+
+		out := validate(t, svc)
+		assert.Equal(t, "Success", out.Message)
+		assert.Empty(t, out.ErrorCode)
+		assert.Equal(t, "1500.00", out.Amount)
+		assert.Equal(t, "Ceylon Spice Exports", out.PayerName)
+		assert.Equal(t, "Food Control Administration Unit", out.OGAName)
+		assert.Equal(t, []gateways.GovPayValidateFeeLine{{Description: "FCAU_FEE", OGAName: "Food Control Administration Unit", Amount: "1500.00"}}, out.Breakdown)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("already paid", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewPaymentService(NewPaymentRepository(db), &mockRegistry{gw: &gateways.GovPayGateway{}})
+		svc.SetPartyResolver(parties)
+		sqlMock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE reference_number = \$1`).
+			WillReturnRows(txRow(PaymentStatusSuccess, time.Now().Add(time.Hour)))
+
+		out := validate(t, svc)
+		assert.Equal(t, "REFERENCE_ALREADY_PAID", out.ErrorCode)
+		assert.Empty(t, out.PayerName)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown reference", func(t *testing.T) {
+		db, sqlMock := setupTestDB(t)
+		svc := NewPaymentService(NewPaymentRepository(db), &mockRegistry{gw: &gateways.GovPayGateway{}})
+		sqlMock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE reference_number = \$1`).
+			WillReturnRows(sqlmock.NewRows(txColumns))
+
+		out := validate(t, svc)
+		assert.Equal(t, "REFERENCE_NOT_FOUND", out.ErrorCode)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
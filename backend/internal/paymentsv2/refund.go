@@ -0,0 +1,333 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotRefundable indicates a refund for a transaction that holds no money to
+// return: never paid, or already fully refunded.
+var ErrNotRefundable = errors.New("payment transaction is not refundable")
+
+// ErrRefundInProgress indicates a refund for a transaction that already has
+// one in flight.
+var ErrRefundInProgress = errors.New("a refund is already in progress")
+
+// ErrInvalidRefundAmount indicates a refund amount that is not positive or
+// exceeds what is left to refund.
+var ErrInvalidRefundAmount = errors.New("invalid refund amount")
+
+// ErrRefundNotFound indicates no refund matches an ID.
+var ErrRefundNotFound = errors.New("refund not found")
+
+// ErrRefundNotPending indicates an attempt to complete a refund that has
+// already succeeded or failed.
+var ErrRefundNotPending = errors.New("refund is not pending")
+
+// RefundStatus is the lifecycle state of a Refund.
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "PENDING"
+	RefundStatusSucceeded RefundStatus = "SUCCEEDED"
+	RefundStatusFailed    RefundStatus = "FAILED"
+)
+
+// Refund returns all or part of a paid PaymentTransaction.
+type Refund struct {
+	ID              string `json:"id" gorm:"type:text;not null;primaryKey"`
+	TransactionID   string `json:"transaction_id" gorm:"index"`
+	ReferenceNumber string `json:"reference_number"`
+	GatewayID       string `json:"gateway_id"`
+	// TaskID is the task whose REFUND step requested the refund and is told
+	// the outcome. Empty for refunds raised by an officer.
+	TaskID   string          `json:"task_id,omitempty"`
+	Amount   decimal.Decimal `json:"amount"`
+	Currency string          `json:"currency"`
+	Reason   string          `json:"reason"`
+	Status   RefundStatus    `json:"status"`
+	// PriorStatus is the transaction's status before the refund, restored when
+	// it fails or leaves part of the amount unrefunded.
+	PriorStatus     PaymentStatus `json:"prior_status"`
+	Manual          bool          `json:"manual"`
+	Instructions    string        `json:"instructions,omitempty"`
+	GatewayRefundID string        `json:"gateway_refund_id,omitempty"`
+	// GatewayError is the error of the last refund call whose outcome is
+	// unknown, such as a timeout. Such a refund is sent to the gateway again,
+	// under the same ID, by the next request to refund the transaction.
+	GatewayError string     `json:"gateway_error,omitempty"`
+	Note         string     `json:"note,omitempty"`
+	RequestedBy  string     `json:"requested_by,omitempty"`
+	CompletedBy  string     `json:"completed_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// TableName pins the table created by migration 026.
+func (Refund) TableName() string { return "payment_refunds" }
+
+// RefundRequest asks for a refund of a paid transaction.
+type RefundRequest struct {
+	ReferenceNumber string
+	// Amount to return; zero refunds everything not yet refunded.
+	Amount decimal.Decimal
+	Reason string
+	// TaskID, when set, is completed with refund_status once the refund
+	// settles asynchronously.
+	TaskID      string
+	RequestedBy string
+}
+
+// RefundResult confirms the outcome of a pending refund.
+type RefundResult struct {
+	Succeeded       bool   `json:"succeeded"`
+	GatewayRefundID string `json:"gateway_refund_id"`
+	Note            string `json:"note"`
+	CompletedBy     string `json:"-"`
+}
+
+func (s *paymentService) RequestRefund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	if req.Amount.IsNegative() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRefundAmount, req.Amount)
+	}
+
+	var (
+		refund       *Refund
+		refunder     gateways.Refunder
+		gatewayTxnID string
+		resumed      bool
+		resend       bool
+	)
+	// Write-ahead, as for checkout: the refund row and REFUND_PENDING are
+	// committed before the gateway is contacted, so a crash mid-call leaves a
+	// pending refund to confirm rather than money returned with no record.
+	err := s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		tx, err := repo.GetByReferenceNumberForUpdate(ctx, req.ReferenceNumber)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve transaction by reference: %w", err)
+		}
+		if tx == nil {
+			return fmt.Errorf("reference %s: %w", req.ReferenceNumber, ErrTransactionNotFound)
+		}
+
+		if tx.Status != PaymentStatusSuccess && tx.Status != PaymentStatusRefundRequired && tx.Status != PaymentStatusRefundPending {
+			return fmt.Errorf("reference %s in status %s: %w", tx.ReferenceNumber, tx.Status, ErrNotRefundable)
+		}
+
+		gateway, err := s.registry.Get(tx.GatewayID)
+		if err != nil {
+			return fmt.Errorf("failed to get gateway %s: %w", tx.GatewayID, err)
+		}
+		var ok bool
+		if refunder, ok = gateway.(gateways.Refunder); !ok {
+			return fmt.Errorf("gateway %s: %w", tx.GatewayID, gateways.ErrRefundUnsupported)
+		}
+		gatewayTxnID = tx.GatewayMetadata["gateway_transaction_id"]
+
+		if tx.Status == PaymentStatusRefundPending {
+			pending, err := repo.GetPendingRefund(ctx, tx.ID)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve pending refund: %w", err)
+			}
+			switch {
+			case pending == nil:
+			// A refund whose gateway call went unanswered may have returned the
+			// money, so it is sent again rather than a new one raised.
+			case pending.GatewayError != "":
+				refund, resend = pending, true
+				return nil
+			// The same task step re-entering resumes waiting on its refund.
+			case req.TaskID != "" && pending.TaskID == req.TaskID:
+				refund, resumed = pending, true
+				return nil
+			}
+			return fmt.Errorf("reference %s: %w", tx.ReferenceNumber, ErrRefundInProgress)
+		}
+
+		refunded, err := repo.SumSucceededRefunds(ctx, tx.ID)
+		if err != nil {
+			return fmt.Errorf("failed to total earlier refunds: %w", err)
+		}
+		remaining := tx.Amount.Sub(refunded)
+		amount := req.Amount
+		if amount.IsZero() {
+			amount = remaining
+		}
+		if !amount.IsPositive() || amount.GreaterThan(remaining) {
+			return fmt.Errorf("%w: %s of %s %s remaining", ErrInvalidRefundAmount, amount, remaining, tx.Currency)
+		}
+
+		refund = &Refund{
+			ID:              uuid.NewString(),
+			TransactionID:   tx.ID,
+			ReferenceNumber: tx.ReferenceNumber,
+			GatewayID:       tx.GatewayID,
+			TaskID:          req.TaskID,
+			Amount:          amount,
+			Currency:        tx.Currency,
+			Reason:          req.Reason,
+			Status:          RefundStatusPending,
+			PriorStatus:     tx.Status,
+			RequestedBy:     req.RequestedBy,
+		}
+		if err := repo.CreateRefund(ctx, refund); err != nil {
+			return fmt.Errorf("failed to save refund: %w", err)
+		}
+		tx.Status = PaymentStatusRefundPending
+		if err := repo.Update(ctx, tx); err != nil {
+			return fmt.Errorf("failed to mark transaction refund pending: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resumed {
+		return refund, nil
+	}
+
+	resp, err := refunder.Refund(ctx, gateways.RefundRequest{
+		RefundID:             refund.ID,
+		ReferenceNumber:      refund.ReferenceNumber,
+		GatewayTransactionID: gatewayTxnID,
+		Amount:               refund.Amount,
+		Currency:             refund.Currency,
+		Reason:               refund.Reason,
+	})
+	if errors.Is(err, gateways.ErrRefundRejected) {
+		// The gateway refused outright, so nothing is in flight: fail the refund
+		// and put the transaction back.
+		if _, ferr := s.finishRefund(ctx, refund.ID, RefundResult{Note: err.Error()}); ferr != nil {
+			slog.ErrorContext(ctx, "paymentsv2: failed to record refused refund", "refundId", refund.ID, "error", ferr)
+		}
+		return nil, fmt.Errorf("gateway %s refund failed: %w", refund.GatewayID, err)
+	}
+	if err != nil {
+		// The money may have been returned. The refund stays PENDING for
+		// CompleteRefund or reconciliation, and the next request resends it.
+		slog.WarnContext(ctx, "paymentsv2: refund outcome unknown, left pending",
+			"refundId", refund.ID, "reference", refund.ReferenceNumber, "resent", resend, "error", err)
+		refund.GatewayError = err.Error()
+		if uerr := s.repo.UpdateRefund(ctx, refund); uerr != nil {
+			return nil, fmt.Errorf("failed to save refund gateway error: %w", uerr)
+		}
+		return refund, nil
+	}
+
+	refund.GatewayError = ""
+	refund.Manual = resp.Manual
+	refund.Instructions = resp.Instructions
+	refund.GatewayRefundID = resp.GatewayRefundID
+	if err := s.repo.UpdateRefund(ctx, refund); err != nil {
+		return nil, fmt.Errorf("failed to save gateway refund response: %w", err)
+	}
+	if resp.Completed {
+		return s.finishRefund(ctx, refund.ID, RefundResult{Succeeded: true, GatewayRefundID: resp.GatewayRefundID})
+	}
+
+	slog.InfoContext(ctx, "paymentsv2: refund pending",
+		"refundId", refund.ID, "reference", refund.ReferenceNumber, "amount", refund.Amount, "manual", refund.Manual)
+	return refund, nil
+}
+
+func (s *paymentService) CompleteRefund(ctx context.Context, refundID string, result RefundResult) (*Refund, error) {
+	refund, err := s.finishRefund(ctx, refundID, result)
+	if err != nil {
+		return nil, err
+	}
+	if refund.TaskID == "" || s.taskCompleter == nil {
+		return refund, nil
+	}
+
+	status := "refunded"
+	if refund.Status == RefundStatusFailed {
+		status = "failed"
+	}
+	payload := map[string]any{"refund_status": status, "refund_id": refund.ID}
+	if err := s.taskCompleter.CompleteTaskStep(ctx, refund.TaskID, payload); err != nil {
+		// The refund outcome is persisted; the step is left suspended and
+		// needs to be completed by hand.
+		slog.ErrorContext(ctx, "paymentsv2: failed to advance refund task step", "taskId", refund.TaskID, "refundId", refund.ID, "error", err)
+		return nil, fmt.Errorf("failed to advance task step for %s: %w", refund.TaskID, err)
+	}
+	return refund, nil
+}
+
+// finishRefund moves a pending refund to SUCCEEDED or FAILED and updates its
+// transaction: REFUNDED once nothing is left to refund, otherwise back to the
+// status it had before.
+func (s *paymentService) finishRefund(ctx context.Context, refundID string, result RefundResult) (*Refund, error) {
+	var refund *Refund
+	err := s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		var err error
+		refund, err = repo.GetRefundForUpdate(ctx, refundID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve refund: %w", err)
+		}
+		if refund == nil {
+			return fmt.Errorf("refund %s: %w", refundID, ErrRefundNotFound)
+		}
+		if refund.Status != RefundStatusPending {
+			return fmt.Errorf("refund %s is %s: %w", refundID, refund.Status, ErrRefundNotPending)
+		}
+
+		tx, err := repo.GetByReferenceNumberForUpdate(ctx, refund.ReferenceNumber)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve transaction by reference: %w", err)
+		}
+		if tx == nil {
+			return fmt.Errorf("reference %s: %w", refund.ReferenceNumber, ErrTransactionNotFound)
+		}
+
+		tx.Status = refund.PriorStatus
+		refund.Status = RefundStatusFailed
+		if result.Succeeded {
+			refund.Status = RefundStatusSucceeded
+			refunded, err := repo.SumSucceededRefunds(ctx, tx.ID)
+			if err != nil {
+				return fmt.Errorf("failed to total earlier refunds: %w", err)
+			}
+			if refunded.Add(refund.Amount).GreaterThanOrEqual(tx.Amount) {
+				tx.Status = PaymentStatusRefunded
+			}
+		}
+		now := time.Now()
+		refund.CompletedAt = &now
+		refund.CompletedBy = result.CompletedBy
+		refund.Note = result.Note
+		if result.GatewayRefundID != "" {
+			refund.GatewayRefundID = result.GatewayRefundID
+		}
+
+		if err := repo.UpdateRefund(ctx, refund); err != nil {
+			return fmt.Errorf("failed to save refund: %w", err)
+		}
+		if err := repo.Update(ctx, tx); err != nil {
+			return fmt.Errorf("failed to update transaction status: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "paymentsv2: refund finished",
+		"refundId", refund.ID, "reference", refund.ReferenceNumber, "status", refund.Status)
+	return refund, nil
+}
+
+func (s *paymentService) ListRefunds(ctx context.Context, status RefundStatus) ([]Refund, error) {
+	refunds, err := s.repo.ListRefunds(ctx, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refunds: %w", err)
+	}
+	return refunds, nil
+}
@@ -0,0 +1,207 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// refundingGateway adds the Refunder capability to MockGateway.
+type refundingGateway struct {
+	*MockGateway
+	resp *gateways.RefundResponse
+	err  error
+	reqs []gateways.RefundRequest
+}
+
+func (g *refundingGateway) Refund(_ context.Context, req gateways.RefundRequest) (*gateways.RefundResponse, error) {
+	g.reqs = append(g.reqs, req)
+	return g.resp, g.err
+}
+
+func manualRefunds() *refundingGateway {
+	return &refundingGateway{MockGateway: new(MockGateway), resp: &gateways.RefundResponse{Manual: true, Instructions: "transfer by hand"}}
+}
+
+func paidRepo(status PaymentStatus) *mockRepo {
+	repo := newMockRepo()
+	repo.txs["TNSWPAID0001"] = &PaymentTransaction{
+		ID:              "tx-1",
+		ReferenceNumber: "TNSWPAID0001",
+		TaskID:          "task-1",
+		GatewayID:       "govpay",
+		Amount:          decimal.RequireFromString("1500.00"),
+		Currency:        "LKR",
+		Status:          status,
+		GatewayMetadata: map[string]string{"gateway_transaction_id": "BOC-1"},
+	}
+	return repo
+}
+
+func TestRequestRefund_ManualRefundWaitsForConfirmation(t *testing.T) {
+	repo := paidRepo(PaymentStatusSuccess)
+	gw := manualRefunds()
+	completer := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+	svc.SetTaskCompleter(completer)
+
+	refund, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", Reason: "rejected", TaskID: "task-1"})
+	require.NoError(t, err)
+	assert.Equal(t, RefundStatusPending, refund.Status)
+	assert.True(t, refund.Manual)
+	assert.Equal(t, "transfer by hand", refund.Instructions)
+	assert.Equal(t, "1500", refund.Amount.String(), "zero amount refunds everything")
+	assert.Equal(t, PaymentStatusRefundPending, repo.txs["TNSWPAID0001"].Status)
+	require.Len(t, gw.reqs, 1)
+	assert.Equal(t, "BOC-1", gw.reqs[0].GatewayTransactionID)
+	assert.Equal(t, refund.ID, gw.reqs[0].RefundID)
+
+	// Re-entry of the same step resumes the pending refund.
+	again, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", TaskID: "task-1"})
+	require.NoError(t, err)
+	assert.Equal(t, refund.ID, again.ID)
+	assert.Len(t, gw.reqs, 1, "gateway not called again")
+
+	_, err = svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+	assert.ErrorIs(t, err, ErrRefundInProgress)
+
+	done, err := svc.CompleteRefund(context.Background(), refund.ID, RefundResult{Succeeded: true, GatewayRefundID: "BANK-TT-9", CompletedBy: "finance-1"})
+	require.NoError(t, err)
+	assert.Equal(t, RefundStatusSucceeded, done.Status)
+	assert.Equal(t, "BANK-TT-9", done.GatewayRefundID)
+	assert.Equal(t, "finance-1", done.CompletedBy)
+	assert.NotNil(t, done.CompletedAt)
+	assert.Equal(t, PaymentStatusRefunded, repo.txs["TNSWPAID0001"].Status)
+	require.Len(t, completer.calls, 1)
+	assert.Equal(t, completeCall{taskID: "task-1", payload: map[string]any{"refund_status": "refunded", "refund_id": refund.ID}}, completer.calls[0])
+
+	_, err = svc.CompleteRefund(context.Background(), refund.ID, RefundResult{Succeeded: true})
+	assert.ErrorIs(t, err, ErrRefundNotPending)
+	_, err = svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+	assert.ErrorIs(t, err, ErrNotRefundable, "nothing left to refund")
+}
+
+func TestRequestRefund_PartialRefunds(t *testing.T) {
+	repo := paidRepo(PaymentStatusSuccess)
+	gw := &refundingGateway{MockGateway: new(MockGateway), resp: &gateways.RefundResponse{Completed: true, GatewayRefundID: "RF-1"}}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	first, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", Amount: decimal.RequireFromString("500")})
+	require.NoError(t, err)
+	assert.Equal(t, RefundStatusSucceeded, first.Status, "synchronous gateway refunds complete at once")
+	assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSWPAID0001"].Status, "partially refunded keeps its status")
+
+	_, err = svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", Amount: decimal.RequireFromString("1000.01")})
+	assert.ErrorIs(t, err, ErrInvalidRefundAmount, "more than what is left")
+
+	rest, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+	require.NoError(t, err)
+	assert.Equal(t, "1000", rest.Amount.String())
+	assert.Equal(t, PaymentStatusRefunded, repo.txs["TNSWPAID0001"].Status)
+}
+
+func TestRequestRefund_LatePaymentReturnsToRefundRequired(t *testing.T) {
+	repo := paidRepo(PaymentStatusRefundRequired)
+	svc := NewPaymentService(repo, &mockRegistry{gw: manualRefunds()})
+
+	refund, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", Amount: decimal.RequireFromString("100")})
+	require.NoError(t, err)
+	_, err = svc.CompleteRefund(context.Background(), refund.ID, RefundResult{Succeeded: true})
+	require.NoError(t, err)
+	assert.Equal(t, PaymentStatusRefundRequired, repo.txs["TNSWPAID0001"].Status, "the rest still needs refunding")
+}
+
+func TestRequestRefund_Errors(t *testing.T) {
+	t.Run("unknown reference", func(t *testing.T) {
+		svc := NewPaymentService(newMockRepo(), &mockRegistry{gw: manualRefunds()})
+		_, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWNOPE"})
+		assert.ErrorIs(t, err, ErrTransactionNotFound)
+	})
+	t.Run("unpaid", func(t *testing.T) {
+		svc := NewPaymentService(paidRepo(PaymentStatusPending), &mockRegistry{gw: manualRefunds()})
+		_, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+		assert.ErrorIs(t, err, ErrNotRefundable)
+	})
+	t.Run("gateway without refunds", func(t *testing.T) {
+		repo := paidRepo(PaymentStatusSuccess)
+		svc := NewPaymentService(repo, &mockRegistry{gw: new(MockGateway)})
+		_, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+		assert.ErrorIs(t, err, gateways.ErrRefundUnsupported)
+		assert.Empty(t, repo.refunds)
+		assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSWPAID0001"].Status)
+	})
+	t.Run("negative amount", func(t *testing.T) {
+		svc := NewPaymentService(paidRepo(PaymentStatusSuccess), &mockRegistry{gw: manualRefunds()})
+		_, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", Amount: decimal.NewFromInt(-1)})
+		assert.ErrorIs(t, err, ErrInvalidRefundAmount)
+	})
+	t.Run("gateway refuses", func(t *testing.T) {
+		repo := paidRepo(PaymentStatusSuccess)
+		gw := &refundingGateway{MockGateway: new(MockGateway), err: fmt.Errorf("card closed: %w", gateways.ErrRefundRejected)}
+		svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+		_, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+		require.ErrorIs(t, err, gateways.ErrRefundRejected)
+		require.Len(t, repo.refunds, 1)
+		for _, r := range repo.refunds {
+			assert.Equal(t, RefundStatusFailed, r.Status)
+			assert.Equal(t, "card closed: gateway rejected the refund", r.Note)
+		}
+		assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSWPAID0001"].Status, "transaction restored")
+	})
+}
+
+func TestRequestRefund_UnansweredRefundIsResent(t *testing.T) {
+	repo := paidRepo(PaymentStatusSuccess)
+	gw := &refundingGateway{MockGateway: new(MockGateway), err: errors.New("context deadline exceeded")}
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	refund, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+	require.NoError(t, err)
+	assert.Equal(t, RefundStatusPending, refund.Status, "the money may have been returned")
+	assert.Equal(t, "context deadline exceeded", refund.GatewayError)
+	assert.Equal(t, PaymentStatusRefundPending, repo.txs["TNSWPAID0001"].Status)
+
+	gw.err, gw.resp = nil, &gateways.RefundResponse{Completed: true, GatewayRefundID: "RF-1"}
+	done, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001"})
+	require.NoError(t, err)
+	assert.Equal(t, refund.ID, done.ID)
+	assert.Equal(t, RefundStatusSucceeded, done.Status)
+	assert.Empty(t, done.GatewayError)
+	assert.Len(t, repo.refunds, 1, "no second refund raised")
+	require.Len(t, gw.reqs, 2)
+	assert.Equal(t, gw.reqs[0].RefundID, gw.reqs[1].RefundID, "resent under the same ID")
+	assert.Equal(t, PaymentStatusRefunded, repo.txs["TNSWPAID0001"].Status)
+}
+
+func TestCompleteRefund_Failed(t *testing.T) {
+	repo := paidRepo(PaymentStatusSuccess)
+	completer := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{gw: manualRefunds()})
+	svc.SetTaskCompleter(completer)
+
+	refund, err := svc.RequestRefund(context.Background(), RefundRequest{ReferenceNumber: "TNSWPAID0001", TaskID: "task-1"})
+	require.NoError(t, err)
+	done, err := svc.CompleteRefund(context.Background(), refund.ID, RefundResult{Note: "payer account closed"})
+	require.NoError(t, err)
+	assert.Equal(t, RefundStatusFailed, done.Status)
+	assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSWPAID0001"].Status)
+	require.Len(t, completer.calls, 1)
+	assert.Equal(t, "failed", completer.calls[0].payload["refund_status"])
+
+	_, err = svc.CompleteRefund(context.Background(), "nope", RefundResult{})
+	assert.ErrorIs(t, err, ErrRefundNotFound)
+
+	pending, err := svc.ListRefunds(context.Background(), RefundStatusPending)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	all, err := svc.ListRefunds(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
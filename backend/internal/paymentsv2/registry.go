@@ -17,6 +17,9 @@ type GatewayRegistry interface {
 
 	// ListInfo returns the aggregated metadata for all supported gateways.
 	ListInfo() []GatewayInfo
+
+	// GetInfo returns the sanitized metadata of a single configured gateway.
+	GetInfo(id string) (GatewayInfo, bool)
 }
 
 type paymentRegistry struct {
@@ -77,6 +80,18 @@ func (r *paymentRegistry) Get(id string) (gateways.PaymentGateway, error) {
 	return gateway, nil
 }
 
+func (r *paymentRegistry) GetInfo(id string) (GatewayInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, ok := r.infos[id]
+	if !ok {
+		return GatewayInfo{}, false
+	}
+	info.Config = nil // Sanitize: config never leaves the registry
+	return info, true
+}
+
 func (r *paymentRegistry) ListInfo() []GatewayInfo {
 	r.mu.RLock()
 
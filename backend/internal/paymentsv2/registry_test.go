@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"os"
 	"testing"
 
@@ -44,6 +45,14 @@ func (m *MockGateway) HandleValidateReference(ctx context.Context, tx *gateways.
 	return args.Get(0).(*gateways.ValidationResponse), args.Error(1)
 }
 
+func (m *MockGateway) VerifyWebhook(ctx context.Context, req gateways.WebhookRequest) (*gateways.WebhookAuth, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*gateways.WebhookAuth), args.Error(1)
+}
+
 func (m *MockGateway) ParseWebhook(ctx context.Context, body []byte, headers map[string][]string) (*gateways.WebhookPayload, error) {
 	args := m.Called(ctx, body, headers)
 	if args.Get(0) == nil {
@@ -52,6 +61,14 @@ func (m *MockGateway) ParseWebhook(ctx context.Context, body []byte, headers map
 	return args.Get(0).(*gateways.WebhookPayload), args.Error(1)
 }
 
+func (m *MockGateway) ParseSettlement(ctx context.Context, r io.Reader) ([]gateways.SettlementRecord, error) {
+	args := m.Called(ctx, r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]gateways.SettlementRecord), args.Error(1)
+}
+
 func TestNewRegistry(t *testing.T) {
 	// Setup temporary config file
 	configContent := `{
@@ -171,6 +188,21 @@ func TestGet(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestGetInfo(t *testing.T) {
+	path := writeTempConfig(t, `{"version":"1.0","methods":[{"id":"gw1","is_active":true,"render_info":{"display_name":"GW 1","template":"ref {{ .ReferenceNumber }}"},"config":{"secret":"keep-away"}}]}`)
+	registry, err := NewRegistry(path, map[string]gateways.Factory{})
+	require.NoError(t, err)
+
+	info, ok := registry.GetInfo("gw1")
+	require.True(t, ok)
+	assert.Equal(t, "GW 1", info.RenderInfo.DisplayName)
+	assert.Equal(t, "ref {{ .ReferenceNumber }}", info.RenderInfo.Template)
+	assert.Nil(t, info.Config, "config must be sanitized")
+
+	_, ok = registry.GetInfo("missing")
+	assert.False(t, ok)
+}
+
 func writeTempConfig(t *testing.T, content string) string {
 	t.Helper()
 	f, err := os.CreateTemp(t.TempDir(), "pm-*.json")
@@ -3,21 +3,106 @@ package paymentsv2
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 )
 
 // PaymentRepository defines the interface for managing PaymentTransactions.
 type PaymentRepository interface {
 	Create(ctx context.Context, tx *PaymentTransaction) error
 	GetByReferenceNumber(ctx context.Context, referenceNumber string) (*PaymentTransaction, error)
+	// GetByID returns the transaction with the given ID, or nil if there is none.
+	GetByID(ctx context.Context, id string) (*PaymentTransaction, error)
 	// GetByReferenceNumberForUpdate reads a transaction while holding a row-level
 	// write lock (SELECT ... FOR UPDATE). Must be called inside RunInTransaction.
 	GetByReferenceNumberForUpdate(ctx context.Context, referenceNumber string) (*PaymentTransaction, error)
+	// GetByTaskID returns the latest payment attempt of a task, or nil if it has none.
 	GetByTaskID(ctx context.Context, taskID string) (*PaymentTransaction, error)
+	// GetByTaskIDForUpdate is GetByTaskID holding a row-level write lock on the
+	// latest attempt. Must be called inside RunInTransaction.
+	GetByTaskIDForUpdate(ctx context.Context, taskID string) (*PaymentTransaction, error)
+	// ListByTaskID returns every payment attempt of a task, oldest first.
+	ListByTaskID(ctx context.Context, taskID string) ([]PaymentTransaction, error)
 	Update(ctx context.Context, tx *PaymentTransaction) error
 	UpdateStatus(ctx context.Context, referenceNumber string, status PaymentStatus) error
+	// TransitionStatus moves a transaction from one status to another, returning
+	// false if it was no longer in the from status.
+	TransitionStatus(ctx context.Context, referenceNumber string, from, to PaymentStatus) (bool, error)
+	// ListOverduePendingForUpdate locks up to limit PENDING transactions whose
+	// ExpiryDate is before cutoff, skipping rows another transaction holds (e.g.
+	// an in-flight webhook). Must be called inside RunInTransaction.
+	ListOverduePendingForUpdate(ctx context.Context, cutoff time.Time, limit int) ([]PaymentTransaction, error)
+	// TryAdvisoryXactLock takes a transaction-scoped Postgres advisory lock
+	// without waiting, returning false if another session holds it. Must be
+	// called inside RunInTransaction.
+	TryAdvisoryXactLock(ctx context.Context, key int64) (bool, error)
+	// ClaimWebhookNonce records a webhook nonce for gatewayID. It returns false,
+	// without error, if the nonce was already claimed (a replayed delivery).
+	ClaimWebhookNonce(ctx context.Context, gatewayID, nonce string, expiresAt time.Time) (bool, error)
+	// DeleteExpiredWebhookNonces removes nonces whose ExpiresAt is before now.
+	DeleteExpiredWebhookNonces(ctx context.Context, now time.Time) error
+	CreateRefund(ctx context.Context, refund *Refund) error
+	UpdateRefund(ctx context.Context, refund *Refund) error
+	// GetRefundForUpdate reads a refund while holding a row-level write lock, or
+	// returns nil if it does not exist. Must be called inside RunInTransaction.
+	GetRefundForUpdate(ctx context.Context, id string) (*Refund, error)
+	// GetPendingRefund returns the transaction's in-flight refund, or nil.
+	GetPendingRefund(ctx context.Context, transactionID string) (*Refund, error)
+	// SumSucceededRefunds totals the transaction's succeeded refunds.
+	SumSucceededRefunds(ctx context.Context, transactionID string) (decimal.Decimal, error)
+	// ListRefunds returns refunds oldest first, optionally only those in status.
+	ListRefunds(ctx context.Context, status RefundStatus) ([]Refund, error)
+	// GetCartAttempt returns the latest consolidated attempt of a consignment's
+	// cart, or nil if it has none.
+	GetCartAttempt(ctx context.Context, consignmentID string) (*PaymentTransaction, error)
+	// GetCartAttemptForUpdate is GetCartAttempt holding a row-level write lock
+	// on the latest attempt. Must be called inside RunInTransaction.
+	GetCartAttemptForUpdate(ctx context.Context, consignmentID string) (*PaymentTransaction, error)
+	CreateLineItem(ctx context.Context, item *PaymentLineItem) error
+	UpdateLineItem(ctx context.Context, item *PaymentLineItem) error
+	// GetLineItemByTaskIDForUpdate reads a task's line item while holding a
+	// row-level write lock, or returns nil if it has none. Must be called inside
+	// RunInTransaction.
+	GetLineItemByTaskIDForUpdate(ctx context.Context, taskID string) (*PaymentLineItem, error)
+	// GetLineItemByTaskID returns a task's line item, or nil if it has none.
+	GetLineItemByTaskID(ctx context.Context, taskID string) (*PaymentLineItem, error)
+	// ListUnpaidLineItems returns a consignment's OPEN and CHECKED_OUT line
+	// items, oldest first.
+	ListUnpaidLineItems(ctx context.Context, consignmentID string) ([]PaymentLineItem, error)
+	// ListOpenLineItemsForUpdate locks a consignment's OPEN line items, oldest
+	// first. Must be called inside RunInTransaction.
+	ListOpenLineItemsForUpdate(ctx context.Context, consignmentID string) ([]PaymentLineItem, error)
+	// ListLineItemsByTransaction returns the line items a consolidated
+	// transaction covers.
+	ListLineItemsByTransaction(ctx context.Context, transactionID string) ([]PaymentLineItem, error)
+	// CheckOutLineItems moves the given line items to CHECKED_OUT under transactionID.
+	CheckOutLineItems(ctx context.Context, ids []string, transactionID string) error
+	// ReleaseLineItems moves the CHECKED_OUT line items of transactionID back to OPEN.
+	ReleaseLineItems(ctx context.Context, transactionID string) error
+	// MarkLineItemsPaid moves the line items of transactionID to PAID.
+	MarkLineItemsPaid(ctx context.Context, transactionID string) error
+	// MarkLineItemNotified records that a paid line item's task step was completed.
+	MarkLineItemNotified(ctx context.Context, id string, at time.Time) error
+	// ListPaidCartsPendingNotification returns up to limit SUCCESS cart
+	// transactions with a PAID line item whose task step has not been completed.
+	ListPaidCartsPendingNotification(ctx context.Context, limit int) ([]PaymentTransaction, error)
+	// MarkTaskNotified records that the task step of a single-task transaction
+	// was completed with its outcome.
+	MarkTaskNotified(ctx context.Context, id string, at time.Time) error
+	// ListSettledPendingNotification returns up to limit SUCCESS or FAILED
+	// single-task transactions whose task step has not been completed.
+	ListSettledPendingNotification(ctx context.Context, limit int) ([]PaymentTransaction, error)
+	// CreateReceipt records a receipt. It fails if the transaction already has one.
+	CreateReceipt(ctx context.Context, receipt *PaymentReceipt) error
+	// GetReceiptByTransactionID returns a transaction's receipt, or nil if it has none.
+	GetReceiptByTransactionID(ctx context.Context, transactionID string) (*PaymentReceipt, error)
+	// GetReceiptByVerificationCode returns the receipt printed with code, or nil.
+	GetReceiptByVerificationCode(ctx context.Context, code string) (*PaymentReceipt, error)
 	// RunInTransaction runs fn inside a DB transaction, passing a repository bound
 	// to that transaction. The transaction commits when fn returns nil and rolls
 	// back on error.
@@ -65,7 +150,10 @@ func (r *paymentRepository) GetByReferenceNumberForUpdate(ctx context.Context, r
 
 // Create inserts a new PaymentTransaction into the database.
 func (r *paymentRepository) Create(ctx context.Context, ptx *PaymentTransaction) error {
-	return r.db.WithContext(ctx).Create(ptx).Error
+	if err := r.db.WithContext(ctx).Create(ptx).Error; err != nil {
+		return err
+	}
+	return r.recordStatusChange(ctx, ptx, "")
 }
 
 // GetByReferenceNumber retrieves a PaymentTransaction by its reference number.
@@ -80,10 +168,32 @@ func (r *paymentRepository) GetByReferenceNumber(ctx context.Context, referenceN
 	return &ptx, nil
 }
 
-// GetByTaskID retrieves a PaymentTransaction by its associated TaskID.
+// GetByID retrieves a PaymentTransaction by its ID.
+func (r *paymentRepository) GetByID(ctx context.Context, id string) (*PaymentTransaction, error) {
+	var ptx PaymentTransaction
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&ptx).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ptx, nil
+}
+
+// GetByTaskID retrieves the latest payment attempt of a task.
 func (r *paymentRepository) GetByTaskID(ctx context.Context, taskID string) (*PaymentTransaction, error) {
+	return r.latestByTaskID(r.db.WithContext(ctx), taskID)
+}
+
+// GetByTaskIDForUpdate retrieves the latest payment attempt of a task while
+// holding a row-level write lock, so concurrent retries serialize on it.
+func (r *paymentRepository) GetByTaskIDForUpdate(ctx context.Context, taskID string) (*PaymentTransaction, error) {
+	return r.latestByTaskID(r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), taskID)
+}
+
+func (r *paymentRepository) latestByTaskID(db *gorm.DB, taskID string) (*PaymentTransaction, error) {
 	var ptx PaymentTransaction
-	if err := r.db.WithContext(ctx).Where("task_id = ?", taskID).First(&ptx).Error; err != nil {
+	if err := db.Where("task_id = ?", taskID).Order("attempt_no DESC").First(&ptx).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -92,12 +202,352 @@ func (r *paymentRepository) GetByTaskID(ctx context.Context, taskID string) (*Pa
 	return &ptx, nil
 }
 
+// ListByTaskID retrieves every payment attempt of a task in attempt order.
+func (r *paymentRepository) ListByTaskID(ctx context.Context, taskID string) ([]PaymentTransaction, error) {
+	var txs []PaymentTransaction
+	if err := r.db.WithContext(ctx).Where("task_id = ?", taskID).Order("attempt_no").Find(&txs).Error; err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
 // Update saves changes to an existing PaymentTransaction.
 func (r *paymentRepository) Update(ctx context.Context, ptx *PaymentTransaction) error {
-	return r.db.WithContext(ctx).Save(ptx).Error
+	if err := r.db.WithContext(ctx).Save(ptx).Error; err != nil {
+		return err
+	}
+	if ptx.Status == ptx.loadedStatus {
+		return nil
+	}
+	return r.recordStatusChange(ctx, ptx, ptx.loadedStatus)
 }
 
 // UpdateStatus updates only the status field of a PaymentTransaction.
 func (r *paymentRepository) UpdateStatus(ctx context.Context, referenceNumber string, status PaymentStatus) error {
-	return r.db.WithContext(ctx).Model(&PaymentTransaction{}).Where("reference_number = ?", referenceNumber).Updates(map[string]interface{}{"status": status}).Error
+	ptx, err := r.GetByReferenceNumberForUpdate(ctx, referenceNumber)
+	if err != nil || ptx == nil {
+		return err
+	}
+	if err := r.db.WithContext(ctx).Model(&PaymentTransaction{}).Where("reference_number = ?", referenceNumber).Updates(map[string]interface{}{"status": status}).Error; err != nil {
+		return err
+	}
+	if ptx.Status == status {
+		return nil
+	}
+	from := ptx.Status
+	ptx.Status = status
+	return r.recordStatusChange(ctx, ptx, from)
+}
+
+// ClaimWebhookNonce inserts the nonce, relying on the (gateway_id, nonce)
+// primary key to detect a replay. A concurrent claim of the same nonce blocks on
+// the key until the first transaction finishes, so exactly one delivery wins.
+func (r *paymentRepository) ClaimWebhookNonce(ctx context.Context, gatewayID, nonce string, expiresAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&WebhookNonce{GatewayID: gatewayID, Nonce: nonce, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpiredWebhookNonces prunes nonces that can no longer be replayed.
+func (r *paymentRepository) DeleteExpiredWebhookNonces(ctx context.Context, now time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&WebhookNonce{}).Error
+}
+
+// TransitionStatus is a compare-and-set on the status column.
+func (r *paymentRepository) TransitionStatus(ctx context.Context, referenceNumber string, from, to PaymentStatus) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&PaymentTransaction{}).
+		Where("reference_number = ? AND status = ?", referenceNumber, from).
+		Updates(map[string]interface{}{"status": to})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return false, nil
+	}
+	ptx, err := r.GetByReferenceNumber(ctx, referenceNumber)
+	if err != nil || ptx == nil {
+		return true, err
+	}
+	return true, r.recordStatusChange(ctx, ptx, from)
+}
+
+// recordStatusChange puts the move of ptx from status from to its current
+// status on the timeline of the consignment it pays for, if any.
+func (r *paymentRepository) recordStatusChange(ctx context.Context, ptx *PaymentTransaction, from PaymentStatus) error {
+	consignmentID := ptx.ConsignmentID
+	if consignmentID == "" {
+		consignmentID = ptx.GatewayMetadata[metaConsignmentID]
+	}
+	err := timeline.Append(ctx, r.db, timeline.Event{
+		ConsignmentID: consignmentID,
+		Type:          timeline.PaymentStatusChanged,
+		TaskID:        ptx.TaskID,
+		FromState:     string(from),
+		ToState:       string(ptx.Status),
+		Details:       map[string]any{"referenceNumber": ptx.ReferenceNumber, "attemptNo": ptx.AttemptNo},
+	})
+	if err != nil {
+		return err
+	}
+	ptx.loadedStatus = ptx.Status
+	return nil
+}
+
+// ListOverduePendingForUpdate selects overdue PENDING rows oldest first with
+// FOR UPDATE SKIP LOCKED, so a row a webhook is settling is left for the next sweep.
+func (r *paymentRepository) ListOverduePendingForUpdate(ctx context.Context, cutoff time.Time, limit int) ([]PaymentTransaction, error) {
+	var txs []PaymentTransaction
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND expiry_date < ?", PaymentStatusPending, cutoff).
+		Order("expiry_date").
+		Limit(limit).
+		Find(&txs).Error
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// TryAdvisoryXactLock wraps pg_try_advisory_xact_lock; the lock is released
+// when the surrounding transaction ends.
+func (r *paymentRepository) TryAdvisoryXactLock(ctx context.Context, key int64) (bool, error) {
+	var locked bool
+	if err := r.db.WithContext(ctx).Raw("SELECT pg_try_advisory_xact_lock(?)", key).Scan(&locked).Error; err != nil {
+		return false, err
+	}
+	return locked, nil
+}
+
+func (r *paymentRepository) CreateRefund(ctx context.Context, refund *Refund) error {
+	return r.db.WithContext(ctx).Create(refund).Error
+}
+
+func (r *paymentRepository) UpdateRefund(ctx context.Context, refund *Refund) error {
+	return r.db.WithContext(ctx).Save(refund).Error
+}
+
+func (r *paymentRepository) GetRefundForUpdate(ctx context.Context, id string) (*Refund, error) {
+	var refund Refund
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&refund).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *paymentRepository) GetPendingRefund(ctx context.Context, transactionID string) (*Refund, error) {
+	var refund Refund
+	err := r.db.WithContext(ctx).
+		Where("transaction_id = ? AND status = ?", transactionID, RefundStatusPending).
+		First(&refund).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *paymentRepository) SumSucceededRefunds(ctx context.Context, transactionID string) (decimal.Decimal, error) {
+	var total decimal.NullDecimal
+	err := r.db.WithContext(ctx).Model(&Refund{}).
+		Select("SUM(amount)").
+		Where("transaction_id = ? AND status = ?", transactionID, RefundStatusSucceeded).
+		Scan(&total).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !total.Valid {
+		return decimal.Zero, nil
+	}
+	return total.Decimal, nil
+}
+
+func (r *paymentRepository) ListRefunds(ctx context.Context, status RefundStatus) ([]Refund, error) {
+	var refunds []Refund
+	q := r.db.WithContext(ctx).Order("created_at")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Find(&refunds).Error
+	return refunds, err
+}
+
+// GetCartAttempt retrieves the latest consolidated attempt of a consignment.
+func (r *paymentRepository) GetCartAttempt(ctx context.Context, consignmentID string) (*PaymentTransaction, error) {
+	return r.latestCartAttempt(r.db.WithContext(ctx), consignmentID)
+}
+
+// GetCartAttemptForUpdate retrieves the latest consolidated attempt of a
+// consignment while holding a row-level write lock, so concurrent cart
+// checkouts serialize on it.
+func (r *paymentRepository) GetCartAttemptForUpdate(ctx context.Context, consignmentID string) (*PaymentTransaction, error) {
+	return r.latestCartAttempt(r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), consignmentID)
+}
+
+func (r *paymentRepository) latestCartAttempt(db *gorm.DB, consignmentID string) (*PaymentTransaction, error) {
+	var ptx PaymentTransaction
+	if err := db.Where("consignment_id = ?", consignmentID).Order("attempt_no DESC").First(&ptx).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ptx, nil
+}
+
+func (r *paymentRepository) CreateLineItem(ctx context.Context, item *PaymentLineItem) error {
+	return r.db.WithContext(ctx).Create(item).Error
+}
+
+func (r *paymentRepository) UpdateLineItem(ctx context.Context, item *PaymentLineItem) error {
+	return r.db.WithContext(ctx).Save(item).Error
+}
+
+func (r *paymentRepository) GetLineItemByTaskIDForUpdate(ctx context.Context, taskID string) (*PaymentLineItem, error) {
+	var item PaymentLineItem
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("task_id = ?", taskID).
+		First(&item).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *paymentRepository) GetLineItemByTaskID(ctx context.Context, taskID string) (*PaymentLineItem, error) {
+	var item PaymentLineItem
+	if err := r.db.WithContext(ctx).Where("task_id = ?", taskID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *paymentRepository) ListUnpaidLineItems(ctx context.Context, consignmentID string) ([]PaymentLineItem, error) {
+	var items []PaymentLineItem
+	err := r.db.WithContext(ctx).
+		Where("consignment_id = ? AND status <> ?", consignmentID, LineItemStatusPaid).
+		Order("created_at").
+		Find(&items).Error
+	return items, err
+}
+
+func (r *paymentRepository) ListOpenLineItemsForUpdate(ctx context.Context, consignmentID string) ([]PaymentLineItem, error) {
+	var items []PaymentLineItem
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("consignment_id = ? AND status = ?", consignmentID, LineItemStatusOpen).
+		Order("created_at").
+		Find(&items).Error
+	return items, err
+}
+
+func (r *paymentRepository) ListLineItemsByTransaction(ctx context.Context, transactionID string) ([]PaymentLineItem, error) {
+	var items []PaymentLineItem
+	err := r.db.WithContext(ctx).
+		Where("transaction_id = ?", transactionID).
+		Order("created_at").
+		Find(&items).Error
+	return items, err
+}
+
+func (r *paymentRepository) CheckOutLineItems(ctx context.Context, ids []string, transactionID string) error {
+	return r.db.WithContext(ctx).Model(&PaymentLineItem{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{"status": LineItemStatusCheckedOut, "transaction_id": transactionID}).Error
+}
+
+func (r *paymentRepository) ReleaseLineItems(ctx context.Context, transactionID string) error {
+	return r.db.WithContext(ctx).Model(&PaymentLineItem{}).
+		Where("transaction_id = ? AND status = ?", transactionID, LineItemStatusCheckedOut).
+		Updates(map[string]interface{}{"status": LineItemStatusOpen, "transaction_id": ""}).Error
+}
+
+func (r *paymentRepository) MarkLineItemsPaid(ctx context.Context, transactionID string) error {
+	return r.db.WithContext(ctx).Model(&PaymentLineItem{}).
+		Where("transaction_id = ?", transactionID).
+		Updates(map[string]interface{}{"status": LineItemStatusPaid}).Error
+}
+
+func (r *paymentRepository) MarkLineItemNotified(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&PaymentLineItem{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"notified_at": at}).Error
+}
+
+func (r *paymentRepository) ListPaidCartsPendingNotification(ctx context.Context, limit int) ([]PaymentTransaction, error) {
+	pending := r.db.Model(&PaymentLineItem{}).
+		Select("transaction_id").
+		Where("status = ? AND notified_at IS NULL", LineItemStatusPaid)
+	var txs []PaymentTransaction
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND consignment_id <> '' AND id IN (?)", PaymentStatusSuccess, pending).
+		Order("updated_at").
+		Limit(limit).
+		Find(&txs).Error
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func (r *paymentRepository) MarkTaskNotified(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&PaymentTransaction{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"task_notified_at": at}).Error
+}
+
+func (r *paymentRepository) ListSettledPendingNotification(ctx context.Context, limit int) ([]PaymentTransaction, error) {
+	var txs []PaymentTransaction
+	err := r.db.WithContext(ctx).
+		Where("status IN ? AND consignment_id = '' AND task_notified_at IS NULL", []PaymentStatus{PaymentStatusSuccess, PaymentStatusFailed}).
+		Order("updated_at").
+		Limit(limit).
+		Find(&txs).Error
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func (r *paymentRepository) CreateReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	return r.db.WithContext(ctx).Create(receipt).Error
+}
+
+func (r *paymentRepository) GetReceiptByTransactionID(ctx context.Context, transactionID string) (*PaymentReceipt, error) {
+	return r.findReceipt(ctx, "transaction_id = ?", transactionID)
+}
+
+func (r *paymentRepository) GetReceiptByVerificationCode(ctx context.Context, code string) (*PaymentReceipt, error) {
+	return r.findReceipt(ctx, "verification_code = ?", code)
+}
+
+func (r *paymentRepository) findReceipt(ctx context.Context, query string, arg string) (*PaymentReceipt, error) {
+	var receipt PaymentReceipt
+	if err := r.db.WithContext(ctx).Where(query, arg).First(&receipt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &receipt, nil
 }
@@ -164,6 +164,8 @@ func TestRepository_UpdateStatus(t *testing.T) {
 	db, mock := setupTestDB(t)
 	repo := NewPaymentRepository(db)
 
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE reference_number = \$1.*FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reference_number", "status"}).AddRow("uuid-1", "TNSW1", PaymentStatusPending))
 	mock.ExpectBegin()
 	mock.ExpectExec(`UPDATE "payment_transactions" SET "status"=\$1,"updated_at"=\$2 WHERE reference_number = \$3`).
 		WithArgs(PaymentStatusSuccess, sqlmock.AnyArg(), "TNSW1").
@@ -234,3 +236,273 @@ func TestRepository_GetByTaskID_DBError(t *testing.T) {
 	require.Error(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestRepository_ClaimWebhookNonce(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+	expiresAt := time.Now().Add(5 * time.Minute)
+
+	t.Run("first claim wins", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "payment_webhook_nonces" .* ON CONFLICT DO NOTHING`).
+			WithArgs("govpay", "n-1", expiresAt, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		claimed, err := repo.ClaimWebhookNonce(context.Background(), "govpay", "n-1", expiresAt)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+	})
+
+	t.Run("replay inserts nothing", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "payment_webhook_nonces" .* ON CONFLICT DO NOTHING`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		claimed, err := repo.ClaimWebhookNonce(context.Background(), "govpay", "n-1", expiresAt)
+		require.NoError(t, err)
+		assert.False(t, claimed)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "payment_webhook_nonces"`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		_, err := repo.ClaimWebhookNonce(context.Background(), "govpay", "n-2", expiresAt)
+		require.Error(t, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_DeleteExpiredWebhookNonces(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "payment_webhook_nonces" WHERE expires_at < \$1`).
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.DeleteExpiredWebhookNonces(context.Background(), now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_TransitionStatus(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "payment_transactions" SET "status"=\$1,"updated_at"=\$2 WHERE reference_number = \$3 AND status = \$4`).
+		WithArgs(PaymentStatusPending, sqlmock.AnyArg(), "TNSW1", PaymentStatusExpired).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE reference_number = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reference_number", "task_id", "status", "attempt_no", "gateway_metadata"}).
+			AddRow("uuid-1", "TNSW1", "task-1", PaymentStatusPending, 1, []byte(`{"consignment_id":"c-1"}`)))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "consignment_events"`).
+		WithArgs("c-1", "PAYMENT_STATUS_CHANGED", "task-1", "", "EXPIRED", "PENDING", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	ok, err := repo.TransitionStatus(context.Background(), "TNSW1", PaymentStatusExpired, PaymentStatusPending)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "payment_transactions" SET`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	ok, err = repo.TransitionStatus(context.Background(), "TNSW1", PaymentStatusExpired, PaymentStatusPending)
+	require.NoError(t, err)
+	assert.False(t, ok, "status had already moved on")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ListOverduePendingForUpdate(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+	cutoff := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "reference_number", "status"}).
+		AddRow("uuid-1", "TNSW1", PaymentStatusPending)
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE status = \$1 AND expiry_date < \$2 ORDER BY expiry_date LIMIT \$3 FOR UPDATE SKIP LOCKED`).
+		WithArgs(PaymentStatusPending, cutoff, 25).
+		WillReturnRows(rows)
+
+	txs, err := repo.ListOverduePendingForUpdate(context.Background(), cutoff, 25)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "TNSW1", txs[0].ReferenceNumber)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_TryAdvisoryXactLock(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(false))
+
+	locked, err := repo.TryAdvisoryXactLock(context.Background(), 42)
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_GetByTaskIDForUpdate_LatestAttempt(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE task_id = \$1 ORDER BY attempt_no DESC,"payment_transactions"."id" LIMIT \$2 FOR UPDATE`).
+		WithArgs("task-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "attempt_no"}).AddRow("uuid-2", "task-1", 2))
+
+	res, err := repo.GetByTaskIDForUpdate(context.Background(), "task-1")
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, 2, res.AttemptNo)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ListByTaskID(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE task_id = \$1 ORDER BY attempt_no`).
+		WithArgs("task-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "task_id", "attempt_no"}).
+			AddRow("uuid-1", "task-1", 1).
+			AddRow("uuid-2", "task-1", 2))
+
+	txs, err := repo.ListByTaskID(context.Background(), "task-1")
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.Equal(t, 1, txs[0].AttemptNo)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_SumSucceededRefunds(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT SUM\(amount\) FROM "payment_refunds" WHERE transaction_id = \$1 AND status = \$2`).
+		WithArgs("tx-1", RefundStatusSucceeded).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("250.50"))
+	total, err := repo.SumSucceededRefunds(context.Background(), "tx-1")
+	require.NoError(t, err)
+	assert.Equal(t, "250.5", total.String())
+
+	mock.ExpectQuery(`SELECT SUM\(amount\) FROM "payment_refunds"`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(nil))
+	total, err = repo.SumSucceededRefunds(context.Background(), "tx-2")
+	require.NoError(t, err)
+	assert.True(t, total.IsZero(), "no refunds sums to zero")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_GetPendingRefund(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_refunds" WHERE transaction_id = \$1 AND status = \$2`).
+		WithArgs("tx-1", RefundStatusPending, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "transaction_id", "status"}).AddRow("rf-1", "tx-1", RefundStatusPending))
+	refund, err := repo.GetPendingRefund(context.Background(), "tx-1")
+	require.NoError(t, err)
+	require.NotNil(t, refund)
+	assert.Equal(t, "rf-1", refund.ID)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_refunds"`).WillReturnError(gorm.ErrRecordNotFound)
+	refund, err = repo.GetPendingRefund(context.Background(), "tx-2")
+	require.NoError(t, err)
+	assert.Nil(t, refund)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_GetCartAttemptForUpdate(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE consignment_id = \$1 ORDER BY attempt_no DESC,"payment_transactions"."id" LIMIT \$2 FOR UPDATE`).
+		WithArgs("cons-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "consignment_id", "attempt_no"}).AddRow("uuid-3", "cons-1", 3))
+	res, err := repo.GetCartAttemptForUpdate(context.Background(), "cons-1")
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, 3, res.AttemptNo)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE consignment_id = \$1`).WillReturnError(gorm.ErrRecordNotFound)
+	res, err = repo.GetCartAttempt(context.Background(), "cons-2")
+	require.NoError(t, err)
+	assert.Nil(t, res, "a cart never checked out has no attempt")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ReleaseLineItems(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "payment_line_items" SET "status"=\$1,"transaction_id"=\$2,"updated_at"=\$3 WHERE transaction_id = \$4 AND status = \$5`).
+		WithArgs(LineItemStatusOpen, "", sqlmock.AnyArg(), "tx-1", LineItemStatusCheckedOut).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.ReleaseLineItems(context.Background(), "tx-1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ListPaidCartsPendingNotification(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE status = \$1 AND consignment_id <> '' AND id IN \(SELECT "transaction_id" FROM "payment_line_items" WHERE status = \$2 AND notified_at IS NULL\) ORDER BY updated_at LIMIT \$3`).
+		WithArgs(PaymentStatusSuccess, LineItemStatusPaid, 25).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reference_number", "consignment_id", "status"}).AddRow("tx-1", "TNSW1", "cons-1", PaymentStatusSuccess))
+
+	txs, err := repo.ListPaidCartsPendingNotification(context.Background(), 25)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "cons-1", txs[0].ConsignmentID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ListSettledPendingNotification(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_transactions" WHERE status IN \(\$1,\$2\) AND consignment_id = '' AND task_notified_at IS NULL ORDER BY updated_at LIMIT \$3`).
+		WithArgs(PaymentStatusSuccess, PaymentStatusFailed, 25).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reference_number", "task_id", "status"}).AddRow("tx-1", "TNSW1", "task-1", PaymentStatusSuccess))
+
+	txs, err := repo.ListSettledPendingNotification(context.Background(), 25)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "task-1", txs[0].TaskID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_GetReceiptByVerificationCode(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_receipts" WHERE verification_code = \$1 ORDER BY "payment_receipts"."id" LIMIT \$2`).
+		WithArgs("ABCD2345EFGH6789", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "transaction_id", "verification_code"}).AddRow("rc-1", "tx-1", "ABCD2345EFGH6789"))
+	receipt, err := repo.GetReceiptByVerificationCode(context.Background(), "ABCD2345EFGH6789")
+	require.NoError(t, err)
+	require.NotNil(t, receipt)
+	assert.Equal(t, "tx-1", receipt.TransactionID)
+
+	mock.ExpectQuery(`SELECT \* FROM "payment_receipts" WHERE transaction_id = \$1`).WillReturnError(gorm.ErrRecordNotFound)
+	receipt, err = repo.GetReceiptByTransactionID(context.Background(), "tx-2")
+	require.NoError(t, err)
+	assert.Nil(t, receipt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
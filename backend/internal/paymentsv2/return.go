@@ -0,0 +1,133 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"strings"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+)
+
+// ErrReturnUnsupported indicates a browser return for a gateway that is not
+// configured or has no hosted checkout to return from.
+var ErrReturnUnsupported = errors.New("payment method has no browser return")
+
+// ErrRedirectNotAllowed indicates a checkout redirect URL that is not on the
+// origin of one of the gateway's configured landing pages.
+var ErrRedirectNotAllowed = errors.New("redirect URL not allowed")
+
+// Transaction metadata keys remembering where a checkout asked for the payer
+// to be sent after a hosted checkout.
+const (
+	metaSuccessRedirectURL = "success_redirect_url"
+	metaCancelRedirectURL  = "cancel_redirect_url"
+)
+
+// withRedirectURLs returns meta plus the checkout's redirect URLs, copying it
+// rather than writing into the caller's map.
+func withRedirectURLs(meta map[string]string, successURL, cancelURL string) map[string]string {
+	if successURL == "" && cancelURL == "" {
+		return meta
+	}
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string, 2)
+	}
+	if successURL != "" {
+		out[metaSuccessRedirectURL] = successURL
+	}
+	if cancelURL != "" {
+		out[metaCancelRedirectURL] = cancelURL
+	}
+	return out
+}
+
+// checkRedirectURLs rejects redirect URLs a checkout asks for unless the
+// gateway returns the payer's browser and each URL is on the origin of one of
+// its landing pages. Empty URLs are always allowed.
+func checkRedirectURLs(gateway gateways.PaymentGateway, urls ...string) error {
+	var successURL, cancelURL string
+	if handler, ok := gateway.(gateways.ReturnHandler); ok {
+		successURL, cancelURL = handler.LandingPages()
+	}
+	for _, u := range urls {
+		if u != "" && !sameOrigin(u, successURL) && !sameOrigin(u, cancelURL) {
+			return fmt.Errorf("%q: %w", u, ErrRedirectNotAllowed)
+		}
+	}
+	return nil
+}
+
+// sameOrigin reports whether the absolute http(s) URL target has the scheme
+// and host of page.
+func sameOrigin(target, page string) bool {
+	t, err := url.Parse(target)
+	if err != nil || (t.Scheme != "https" && t.Scheme != "http") || t.Host == "" {
+		return false
+	}
+	p, err := url.Parse(page)
+	if err != nil || p.Host == "" {
+		return false
+	}
+	return strings.EqualFold(t.Scheme, p.Scheme) && strings.EqualFold(t.Host, p.Host)
+}
+
+func (s *paymentService) HandleReturn(ctx context.Context, gatewayID string, query url.Values) (string, error) {
+	gateway, err := s.registry.Get(gatewayID)
+	if err != nil {
+		return "", fmt.Errorf("gateway %s: %w", gatewayID, ErrReturnUnsupported)
+	}
+	handler, ok := gateway.(gateways.ReturnHandler)
+	if !ok {
+		return "", fmt.Errorf("gateway %s: %w", gatewayID, ErrReturnUnsupported)
+	}
+
+	result, err := handler.ParseReturn(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("gateway %s: %w", gatewayID, err)
+	}
+	tx, err := s.repo.GetByReferenceNumber(ctx, result.ReferenceNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve transaction by reference: %w", err)
+	}
+	if tx == nil || tx.GatewayID != gatewayID {
+		return "", fmt.Errorf("reference %s: %w", result.ReferenceNumber, ErrTransactionNotFound)
+	}
+
+	// Pending results land on the success page too: the notification may
+	// simply not have arrived yet. A page the checkout named is checked again,
+	// so a row written before the check existed cannot redirect off-site.
+	successURL, cancelURL := handler.LandingPages()
+	target, key := successURL, metaSuccessRedirectURL
+	if result.Status == gateways.WebhookStatusFailed {
+		target, key = cancelURL, metaCancelRedirectURL
+	}
+	if requested := tx.GatewayMetadata[key]; requested != "" {
+		if sameOrigin(requested, successURL) || sameOrigin(requested, cancelURL) {
+			target = requested
+		} else {
+			slog.WarnContext(ctx, "paymentsv2: ignoring redirect URL outside the gateway's landing pages",
+				"gateway", gatewayID, "reference", tx.ReferenceNumber, "url", requested)
+		}
+	}
+	if target == "" {
+		return "", fmt.Errorf("gateway %s: no page to return %s payments to", gatewayID, strings.ToLower(string(result.Status)))
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid return page %q: %w", target, err)
+	}
+	q := u.Query()
+	q.Set("reference", tx.ReferenceNumber)
+	q.Set("status", strings.ToLower(string(result.Status)))
+	u.RawQuery = q.Encode()
+
+	slog.InfoContext(ctx, "paymentsv2: payer returned from hosted checkout",
+		"gateway", gatewayID, "reference", tx.ReferenceNumber, "status", result.Status, "current_status", tx.Status)
+	return u.String(), nil
+}
@@ -0,0 +1,170 @@
+package paymentsv2
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// returningGateway is a redirect gateway whose returns parse to result.
+type returningGateway struct {
+	*MockGateway
+	result                *gateways.ReturnResult
+	err                   error
+	successURL, cancelURL string
+}
+
+func (g *returningGateway) ParseReturn(context.Context, url.Values) (*gateways.ReturnResult, error) {
+	return g.result, g.err
+}
+
+func (g *returningGateway) LandingPages() (string, string) {
+	return g.successURL, g.cancelURL
+}
+
+// withPortalPages returns gw as a redirect gateway landing on portal.example.
+func withPortalPages(gw *MockGateway) *returningGateway {
+	return &returningGateway{
+		MockGateway: gw,
+		successURL:  "https://portal.example/payments/done",
+		cancelURL:   "https://portal.example/payments/cancelled?lang=en",
+	}
+}
+
+func returnResult(status gateways.WebhookStatus) *returningGateway {
+	gw := withPortalPages(new(MockGateway))
+	gw.result = &gateways.ReturnResult{ReferenceNumber: "TNSW1", Status: status}
+	return gw
+}
+
+func TestHandleReturn_LandingPage(t *testing.T) {
+	cases := map[string]struct {
+		status   gateways.WebhookStatus
+		metadata map[string]string
+		want     string
+	}{
+		"success uses the gateway's page": {
+			status: gateways.WebhookStatusSuccess,
+			want:   "https://portal.example/payments/done?reference=TNSW1&status=success",
+		},
+		"pending lands on the success page": {
+			status: gateways.WebhookStatusPending,
+			want:   "https://portal.example/payments/done?reference=TNSW1&status=pending",
+		},
+		"failure keeps the cancel page's query": {
+			status: gateways.WebhookStatusFailed,
+			want:   "https://portal.example/payments/cancelled?lang=en&reference=TNSW1&status=failed",
+		},
+		"checkout's own page wins": {
+			status:   gateways.WebhookStatusSuccess,
+			metadata: withRedirectURLs(map[string]string{"task_id": "task-9"}, "https://portal.example/tasks/task-9", ""),
+			want:     "https://portal.example/tasks/task-9?reference=TNSW1&status=success",
+		},
+		"checkout's page off the portal is ignored": {
+			status:   gateways.WebhookStatusFailed,
+			metadata: withRedirectURLs(map[string]string{"task_id": "task-9"}, "", "https://attacker.example/phish"),
+			want:     "https://portal.example/payments/cancelled?lang=en&reference=TNSW1&status=failed",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := newMockRepo()
+			tx := pendingTx()
+			tx.GatewayMetadata = tc.metadata
+			repo.txs["TNSW1"] = tx
+			svc := NewPaymentService(repo, &mockRegistry{gw: returnResult(tc.status)})
+
+			got, err := svc.HandleReturn(context.Background(), "govpay", url.Values{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, PaymentStatusPending, tx.Status, "a browser return never settles the payment")
+		})
+	}
+}
+
+func TestHandleReturn_Errors(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = pendingTx()
+
+	_, err := NewPaymentService(repo, &mockRegistry{gw: new(MockGateway)}).HandleReturn(context.Background(), "govpay", url.Values{})
+	assert.ErrorIs(t, err, ErrReturnUnsupported, "instruction gateways have no return")
+
+	_, err = NewPaymentService(repo, &mockRegistry{getErr: errors.New("unknown")}).HandleReturn(context.Background(), "nope", url.Values{})
+	assert.ErrorIs(t, err, ErrReturnUnsupported)
+
+	forged := &returningGateway{MockGateway: new(MockGateway), err: gateways.ErrReturnUnauthorized}
+	_, err = NewPaymentService(repo, &mockRegistry{gw: forged}).HandleReturn(context.Background(), "govpay", url.Values{})
+	assert.ErrorIs(t, err, gateways.ErrReturnUnauthorized)
+
+	_, err = NewPaymentService(repo, &mockRegistry{gw: returnResult(gateways.WebhookStatusSuccess)}).HandleReturn(context.Background(), "lankapay", url.Values{})
+	assert.ErrorIs(t, err, ErrTransactionNotFound, "the reference belongs to another gateway")
+
+	noPages := returnResult(gateways.WebhookStatusSuccess)
+	noPages.successURL = ""
+	_, err = NewPaymentService(repo, &mockRegistry{gw: noPages}).HandleReturn(context.Background(), "govpay", url.Values{})
+	assert.ErrorContains(t, err, "no page to return success payments to")
+}
+
+func TestCreateCheckoutSession_RemembersRedirectURLs(t *testing.T) {
+	repo := newMockRepo()
+	gw := withPortalPages(sessionGateway())
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+	req := validCheckoutReq()
+	req.SuccessRedirectURL = "https://portal.example/tasks/task-1"
+
+	resp, err := svc.CreateCheckoutSession(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"task_id": "task-1", "success_redirect_url": "https://portal.example/tasks/task-1"},
+		repo.txs[resp.ReferenceNumber].GatewayMetadata)
+	assert.Equal(t, map[string]string{"task_id": "task-1"}, req.Metadata, "the caller's metadata is not modified")
+
+	sent := gw.Calls[0].Arguments.Get(1).(gateways.SessionRequest)
+	assert.Equal(t, resp.ReferenceNumber, sent.ReferenceNumber)
+	assert.Equal(t, req.ExpiresAt, sent.ExpiresAt)
+}
+
+func TestCheckout_RejectsRedirectURLsOffTheLandingPages(t *testing.T) {
+	cases := map[string]struct {
+		gw      gateways.PaymentGateway
+		url     string
+		allowed bool
+	}{
+		"same origin":       {gw: withPortalPages(sessionGateway()), url: "https://PORTAL.example/tasks/task-1", allowed: true},
+		"other host":        {gw: withPortalPages(sessionGateway()), url: "https://attacker.example/phish"},
+		"other scheme":      {gw: withPortalPages(sessionGateway()), url: "http://portal.example/tasks/task-1"},
+		"scheme-relative":   {gw: withPortalPages(sessionGateway()), url: "//attacker.example/phish"},
+		"javascript":        {gw: withPortalPages(sessionGateway()), url: "javascript:alert(1)"},
+		"no browser return": {gw: sessionGateway(), url: "https://portal.example/tasks/task-1"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := newMockRepo()
+			svc := NewPaymentService(repo, &mockRegistry{gw: tc.gw})
+			req := validCheckoutReq()
+			req.CancelRedirectURL = tc.url
+
+			_, err := svc.CreateCheckoutSession(context.Background(), req)
+			if tc.allowed {
+				require.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrRedirectNotAllowed)
+			assert.Empty(t, repo.txs, "nothing is written for a rejected checkout")
+		})
+	}
+
+	t.Run("cart", func(t *testing.T) {
+		gw := withPortalPages(cartGateway())
+		svc, repo := cartService(t, gw)
+		_, err := svc.CheckoutCart(context.Background(), CartCheckoutRequest{
+			ConsignmentID: "cons-1", GatewayID: "govpay", SuccessRedirectURL: "https://attacker.example/phish",
+		})
+		assert.ErrorIs(t, err, ErrRedirectNotAllowed)
+		assert.Empty(t, repo.txs)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"strings"
 	"time"
 
@@ -24,6 +25,19 @@ var ErrTransactionNotFound = errors.New("payment transaction not found")
 // suspicious, so it is never marked paid and the gateway should not retry.
 var ErrAmountMismatch = errors.New("webhook amount/currency mismatch")
 
+// ErrWebhookReplay indicates an authenticated webhook whose nonce was already
+// seen for the gateway. It wraps gateways.ErrWebhookUnauthorized so it is
+// refused like any other unauthenticated delivery.
+var ErrWebhookReplay = fmt.Errorf("%w: replayed delivery", gateways.ErrWebhookUnauthorized)
+
+// ErrAlreadyPaid indicates a checkout was requested for a task whose latest
+// payment attempt already succeeded.
+var ErrAlreadyPaid = errors.New("task payment already completed")
+
+// ErrMethodUnavailable indicates a payment method that is not configured,
+// inactive, or has no gateway implementation registered.
+var ErrMethodUnavailable = errors.New("payment method unavailable")
+
 // toDomainStatus maps a canonical gateway WebhookStatus onto the internal
 // PaymentStatus. It is total over the known statuses and rejects anything else
 // with gateways.ErrUnsupportedWebhookStatus so a bad value can't reach the DB.
@@ -51,14 +65,101 @@ type PaymentService interface {
 	// ListAvailableMethods returns the rendering information for all active payment gateways.
 	ListAvailableMethods(ctx context.Context) ([]GatewayInfo, error)
 
+	// GetMethod resolves an active payment method by ID. Returns
+	// ErrMethodUnavailable if it is unknown, inactive or not implemented.
+	GetMethod(ctx context.Context, id string) (*PaymentMethod, error)
+
 	// CreateCheckoutSession initializes a payment session and generates a ReferenceNumber.
+	// Each call opens a new attempt on the task; once the gateway session is
+	// open, a still-pending earlier attempt is superseded so its reference stops
+	// being payable. If the gateway fails, the earlier attempt stays current.
+	// Returns ErrAlreadyPaid if the task's current attempt succeeded.
 	CreateCheckoutSession(ctx context.Context, req CreateCheckoutRequest) (*CreateCheckoutResponse, error)
 
+	// GetLatestAttempt returns the task's current payment attempt, its latest
+	// attempt that did not fail, or nil if there is none.
+	GetLatestAttempt(ctx context.Context, taskID string) (*PaymentTransaction, error)
+
+	// ListAttempts returns every payment attempt of a task, oldest first.
+	ListAttempts(ctx context.Context, taskID string) ([]PaymentTransaction, error)
+
 	// ValidateReference is used for real-time validation requests from gateways.
 	ValidateReference(ctx context.Context, gatewayID string, rawBody json.RawMessage) (*gateways.ValidationResponse, error)
 
 	// ProcessWebhook handles asynchronous notifications from payment gateways.
-	ProcessWebhook(ctx context.Context, gatewayID string, body []byte, headers map[string][]string) error
+	// Deliveries that fail gateway verification or replay an earlier nonce are
+	// rejected with an error wrapping gateways.ErrWebhookUnauthorized.
+	ProcessWebhook(ctx context.Context, gatewayID string, req gateways.WebhookRequest) error
+
+	// ExpireOverdue moves up to limit PENDING transactions whose ExpiryDate is
+	// before cutoff to EXPIRED and completes their task step with
+	// payment_status "expired". An expired cart instead returns its items to
+	// the cart. Returns the number of tasks notified.
+	ExpireOverdue(ctx context.Context, cutoff time.Time, limit int) (int, error)
+
+	// RedriveTaskSteps completes the task steps of up to limit settled
+	// single-task payments and up to limit paid carts whose webhook could not
+	// complete them. Returns the number of payments and carts whose tasks are
+	// now all notified.
+	RedriveTaskSteps(ctx context.Context, limit int) (int, error)
+
+	// RequestRefund returns all or part of a paid transaction through its
+	// gateway's gateways.Refunder. The refund completes at once if the gateway
+	// refunds synchronously; otherwise it stays PENDING (and the transaction
+	// REFUND_PENDING) until CompleteRefund. It fails only if the gateway
+	// rejects it; when the gateway's answer is lost it stays PENDING and the
+	// next request resends it under the same ID. A second request from the
+	// same task while its refund is pending returns that refund.
+	RequestRefund(ctx context.Context, req RefundRequest) (*Refund, error)
+
+	// CompleteRefund records the outcome of a pending refund, e.g. a manual
+	// refund confirmed by finance, and completes the requesting task step with
+	// refund_status "refunded" or "failed".
+	CompleteRefund(ctx context.Context, refundID string, result RefundResult) (*Refund, error)
+
+	// ListRefunds returns refunds oldest first; an empty status lists all.
+	ListRefunds(ctx context.Context, status RefundStatus) ([]Refund, error)
+
+	// AddToCart puts a task's fee into its consignment's payment cart instead
+	// of opening a checkout for the task alone. Re-adding an open item
+	// re-prices it; an item already checked out is returned unchanged. Returns
+	// ErrAlreadyPaid if the item was paid.
+	AddToCart(ctx context.Context, req AddToCartRequest) (*PaymentLineItem, error)
+
+	// GetCart returns a consignment's unpaid line items and latest cart attempt.
+	GetCart(ctx context.Context, consignmentID string) (*Cart, error)
+
+	// CheckoutCart opens one consolidated transaction for all of a
+	// consignment's open line items, superseding a pending earlier one. When
+	// it is paid, every covered task step is completed. Returns ErrCartEmpty
+	// or ErrCartCurrencyMismatch if there is nothing, or nothing payable, to
+	// check out.
+	CheckoutCart(ctx context.Context, req CartCheckoutRequest) (*CreateCheckoutResponse, error)
+
+	// HandleReturn verifies a payer's browser coming back from a redirect
+	// gateway's hosted checkout and returns the page to send it on to. It
+	// does not settle the transaction; the gateway's notification does.
+	// Returns ErrReturnUnsupported for a gateway without browser returns.
+	HandleReturn(ctx context.Context, gatewayID string, query url.Values) (string, error)
+
+	// GetReceiptDownloadURL returns a time-limited download link for the
+	// receipt of the payment that settled a task's fee, alone or in its
+	// consignment's cart, issuing it first if it is missing. Returns
+	// ErrReceiptNotFound if the fee has not been paid.
+	GetReceiptDownloadURL(ctx context.Context, taskID string) (string, error)
+
+	// VerifyReceipt confirms a receipt from the verification code printed on
+	// it. Returns ErrReceiptNotFound for an unknown code.
+	VerifyReceipt(ctx context.Context, code string) (*ReceiptVerification, error)
+
+	// SetReceipts enables receipts, issued whenever a payment succeeds. Wired
+	// post-construction because storage is initialized after the service.
+	SetReceipts(cfg ReceiptConfig)
+
+	// SetPartyResolver enables naming the trader and OGA behind a reference
+	// during gateway validation. Wired post-construction to avoid an import
+	// cycle with taskv2.
+	SetPartyResolver(resolver PartyResolver)
 
 	// SetTaskCompleter injects the dependency used to advance the workflow when
 	// a payment settles. Wired post-construction to avoid an import cycle with taskv2.
@@ -69,6 +170,8 @@ type paymentService struct {
 	repo          PaymentRepository
 	registry      GatewayRegistry
 	taskCompleter TaskCompleter
+	receipts      *ReceiptConfig
+	parties       PartyResolver
 }
 
 // NewPaymentService initializes a new payment service.
@@ -87,11 +190,22 @@ func (s *paymentService) ListAvailableMethods(ctx context.Context) ([]GatewayInf
 	return s.registry.ListInfo(), nil
 }
 
+func (s *paymentService) GetMethod(ctx context.Context, id string) (*PaymentMethod, error) {
+	info, ok := s.registry.GetInfo(id)
+	if !ok || !info.IsActive {
+		return nil, fmt.Errorf("method %q: %w", id, ErrMethodUnavailable)
+	}
+	gateway, err := s.registry.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("method %q: %w: %w", id, ErrMethodUnavailable, err)
+	}
+	return &PaymentMethod{GatewayInfo: info, Type: gateway.GetFlowType()}, nil
+}
+
 const referenceCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 // generatePaymentReference returns a non-guessable NSW reference of the form
-// TNSWXXXXXXXX using crypto-grade randomness. Mirrors the generator in
-// internal/payments.
+// TNSWXXXXXXXX using crypto-grade randomness.
 func generatePaymentReference() string {
 	b := make([]byte, 8)
 	if _, err := rand.Read(b); err != nil {
@@ -103,6 +217,20 @@ func generatePaymentReference() string {
 	return fmt.Sprintf("TNSW%s", string(b))
 }
 
+// newReference generates an unused NSW reference, retrying on the rare collision.
+func (s *paymentService) newReference(ctx context.Context) (string, error) {
+	for {
+		candidate := generatePaymentReference()
+		existing, err := s.repo.GetByReferenceNumber(ctx, candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check existing reference number: %w", err)
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+}
+
 func (s *paymentService) CreateCheckoutSession(ctx context.Context, req CreateCheckoutRequest) (*CreateCheckoutResponse, error) {
 	now := time.Now()
 	if err := req.validate(now); err != nil {
@@ -113,21 +241,16 @@ func (s *paymentService) CreateCheckoutSession(ctx context.Context, req CreateCh
 	if err != nil {
 		return nil, fmt.Errorf("failed to get gateway %s: %w", req.GatewayID, err)
 	}
+	if err := checkRedirectURLs(gateway, req.SuccessRedirectURL, req.CancelRedirectURL); err != nil {
+		return nil, fmt.Errorf("invalid checkout request: %w", err)
+	}
 
 	taskID := req.Metadata["task_id"] // presence validated above
 
-	// 1. Generate a unique NSW ReferenceNumber, retrying on the rare collision.
-	var generatedRef string
-	for {
-		candidate := generatePaymentReference()
-		existing, err := s.repo.GetByReferenceNumber(ctx, candidate)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check existing reference number: %w", err)
-		}
-		if existing == nil {
-			generatedRef = candidate
-			break
-		}
+	// 1. Generate a unique NSW ReferenceNumber.
+	generatedRef, err := s.newReference(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	// 2. Write-ahead: persist a PENDING transaction BEFORE contacting the gateway.
@@ -137,28 +260,56 @@ func (s *paymentService) CreateCheckoutSession(ctx context.Context, req CreateCh
 		ID:              uuid.NewString(),
 		ReferenceNumber: generatedRef,
 		TaskID:          taskID,
+		AttemptNo:       1,
 		GatewayID:       req.GatewayID,
 		Amount:          req.Amount,
 		Currency:        req.Currency,
 		Status:          PaymentStatusPending,
 		ExpiryDate:      req.ExpiresAt,
-		GatewayMetadata: req.Metadata,
+		GatewayMetadata: withRedirectURLs(req.Metadata, req.SuccessRedirectURL, req.CancelRedirectURL),
 	}
-	if err := s.repo.Create(ctx, tx); err != nil {
-		return nil, fmt.Errorf("failed to persist transaction: %w", err)
+	// The new attempt is numbered under the latest attempt's row lock. Two racing
+	// first attempts both get number 1; the (task_id, attempt_no) unique index
+	// rejects the loser. A pending predecessor is left alone until the gateway
+	// session is open, so a gateway failure cannot leave the task unpayable.
+	err = s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		latest, err := repo.GetByTaskIDForUpdate(ctx, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve latest payment attempt: %w", err)
+		}
+		if latest != nil {
+			current, err := currentAttempt(ctx, repo, taskID)
+			if err != nil {
+				return err
+			}
+			if current != nil && current.Status == PaymentStatusSuccess {
+				return fmt.Errorf("task %s: %w", taskID, ErrAlreadyPaid)
+			}
+			tx.AttemptNo = latest.AttemptNo + 1
+		}
+		if err := repo.Create(ctx, tx); err != nil {
+			return fmt.Errorf("failed to persist transaction: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// 3. Initialize the session with the gateway.
 	sessionReq := gateways.SessionRequest{
+		ReferenceNumber:    generatedRef,
 		Amount:             req.Amount,
 		Currency:           req.Currency,
 		SuccessRedirectURL: req.SuccessRedirectURL,
 		CancelRedirectURL:  req.CancelRedirectURL,
+		ExpiresAt:          req.ExpiresAt,
 	}
 	sessionResp, err := gateway.CreateSession(ctx, sessionReq)
 	if err != nil {
 		// Don't leave the row dangling as PENDING; mark it FAILED so a later
 		// webhook or reconciliation can't treat an uninitialized session as payable.
+		// A failed attempt is never current, so a pending predecessor stays payable.
 		tx.Status = PaymentStatusFailed
 		if uerr := s.repo.Update(ctx, tx); uerr != nil {
 			slog.Error("paymentsv2: failed to mark transaction failed after gateway error",
@@ -167,16 +318,34 @@ func (s *paymentService) CreateCheckoutSession(ctx context.Context, req CreateCh
 		return nil, fmt.Errorf("gateway failed to create session: %w", err)
 	}
 
-	// 4. Persist the gateway-assigned session id.
-	if sessionResp.SessionID != "" {
+	// 4. Persist the gateway-assigned session id and supersede the earlier
+	// pending attempts in one step. If one of them was paid meanwhile, the new
+	// attempt is withdrawn instead.
+	alreadyPaid := false
+	err = s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		alreadyPaid, err = supersedePredecessors(ctx, repo, tx)
+		if err != nil {
+			return err
+		}
+		if alreadyPaid {
+			tx.Status = PaymentStatusSuperseded
+		}
 		tx.SessionID = sessionResp.SessionID
-		if err := s.repo.Update(ctx, tx); err != nil {
-			return nil, fmt.Errorf("failed to persist session id: %w", err)
+		if err := repo.Update(ctx, tx); err != nil {
+			return fmt.Errorf("failed to persist session id: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if alreadyPaid {
+		return nil, fmt.Errorf("task %s: %w", taskID, ErrAlreadyPaid)
 	}
 
 	return &CreateCheckoutResponse{
 		ReferenceNumber: generatedRef,
+		AttemptNo:       tx.AttemptNo,
 		SessionID:       sessionResp.SessionID,
 		Type:            sessionResp.Type,
 		CheckoutURL:     sessionResp.CheckoutURL,
@@ -185,6 +354,63 @@ func (s *paymentService) CreateCheckoutSession(ctx context.Context, req CreateCh
 	}, nil
 }
 
+// supersedePredecessors supersedes the pending attempts of tx's task numbered
+// before tx. It reports whether one of them has been paid instead.
+func supersedePredecessors(ctx context.Context, repo PaymentRepository, tx *PaymentTransaction) (bool, error) {
+	attempts, err := repo.ListByTaskID(ctx, tx.TaskID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list payment attempts: %w", err)
+	}
+	for _, attempt := range attempts {
+		if attempt.AttemptNo >= tx.AttemptNo {
+			continue
+		}
+		if attempt.Status == PaymentStatusPending {
+			superseded, err := repo.TransitionStatus(ctx, attempt.ReferenceNumber, PaymentStatusPending, PaymentStatusSuperseded)
+			if err != nil {
+				return false, fmt.Errorf("failed to supersede attempt %s: %w", attempt.ReferenceNumber, err)
+			}
+			if superseded {
+				continue
+			}
+			// Settled since it was listed; look at what it became.
+			latest, err := repo.GetByReferenceNumberForUpdate(ctx, attempt.ReferenceNumber)
+			if err != nil {
+				return false, fmt.Errorf("failed to reload attempt %s: %w", attempt.ReferenceNumber, err)
+			}
+			attempt = *latest
+		}
+		if attempt.Status == PaymentStatusSuccess {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// currentAttempt returns the latest attempt of taskID that did not fail, or nil
+// if there is none. A failed attempt never took the money, so the attempt
+// before it, if still pending, remains the one to pay.
+func currentAttempt(ctx context.Context, repo PaymentRepository, taskID string) (*PaymentTransaction, error) {
+	attempts, err := repo.ListByTaskID(ctx, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payment attempts: %w", err)
+	}
+	for i := len(attempts) - 1; i >= 0; i-- {
+		if attempts[i].Status != PaymentStatusFailed {
+			return &attempts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *paymentService) GetLatestAttempt(ctx context.Context, taskID string) (*PaymentTransaction, error) {
+	return currentAttempt(ctx, s.repo, taskID)
+}
+
+func (s *paymentService) ListAttempts(ctx context.Context, taskID string) ([]PaymentTransaction, error) {
+	return s.repo.ListByTaskID(ctx, taskID)
+}
+
 func (s *paymentService) ValidateReference(ctx context.Context, gatewayID string, rawBody json.RawMessage) (*gateways.ValidationResponse, error) {
 	slog.Info("validating incoming payment reference", "gateway", gatewayID)
 
@@ -223,9 +449,36 @@ func (s *paymentService) ValidateReference(ctx context.Context, gatewayID string
 				Status:          string(tx.Status),
 				ExpiryDate:      tx.ExpiryDate,
 				Metadata:        tx.GatewayMetadata,
+				Rejection:       validationRejection(tx, time.Now()),
 			}
-			// Payable = exists, owned by this gateway, still pending, not expired.
-			isPayable = tx.Status == PaymentStatusPending && time.Now().Before(tx.ExpiryDate)
+		}
+	}
+
+	// Only the task's current attempt may be paid. Superseded attempts are no
+	// longer PENDING, but the check stands on its own so an earlier reference
+	// can never be paid even if its row was left behind.
+	if validationTx != nil && validationTx.Rejection == "" {
+		var latest *PaymentTransaction
+		if tx.consolidated() {
+			latest, err = s.repo.GetCartAttempt(ctx, tx.ConsignmentID)
+		} else {
+			latest, err = currentAttempt(ctx, s.repo, tx.TaskID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve latest payment attempt: %w", err)
+		}
+		if latest == nil || latest.ReferenceNumber != tx.ReferenceNumber {
+			slog.Warn("validation for a superseded payment attempt", "reference", tx.ReferenceNumber, "taskId", tx.TaskID, "consignmentId", tx.ConsignmentID)
+			validationTx.Rejection = gateways.RejectionCancelled
+		}
+	}
+
+	// Payable = exists, owned by this gateway, still pending, not expired, and
+	// the latest attempt. Only then is the reference described to the payer.
+	if validationTx != nil && validationTx.Rejection == "" {
+		isPayable = true
+		if err := s.describeReference(ctx, tx, validationTx); err != nil {
+			return nil, fmt.Errorf("failed to describe payment reference: %w", err)
 		}
 	}
 
@@ -233,13 +486,23 @@ func (s *paymentService) ValidateReference(ctx context.Context, gatewayID string
 	return gateway.HandleValidateReference(ctx, validationTx, isPayable, rawBody)
 }
 
-func (s *paymentService) ProcessWebhook(ctx context.Context, gatewayID string, body []byte, headers map[string][]string) error {
+func (s *paymentService) ProcessWebhook(ctx context.Context, gatewayID string, req gateways.WebhookRequest) error {
 	gateway, err := s.registry.Get(gatewayID)
 	if err != nil {
 		return fmt.Errorf("failed to get gateway %s: %w", gatewayID, err)
 	}
 
-	gwPayload, err := gateway.ParseWebhook(ctx, body, headers)
+	// Authenticate before the body is even parsed. Whatever the gateway returns,
+	// a verification failure must surface as unauthorized.
+	auth, err := gateway.VerifyWebhook(ctx, req)
+	if err != nil {
+		if !errors.Is(err, gateways.ErrWebhookUnauthorized) {
+			err = fmt.Errorf("%w: %w", gateways.ErrWebhookUnauthorized, err)
+		}
+		return fmt.Errorf("gateway %s: %w", gatewayID, err)
+	}
+
+	gwPayload, err := gateway.ParseWebhook(ctx, req.Body, req.Headers)
 	if err != nil {
 		return fmt.Errorf("gateway failed to parse webhook: %w", err)
 	}
@@ -255,12 +518,23 @@ func (s *paymentService) ProcessWebhook(ctx context.Context, gatewayID string, b
 	// concurrent deliveries serialize on the record, so only the first one past
 	// PENDING updates it and earns the right to advance the workflow.
 	var (
-		advance     bool
-		advanceTask string
-		finalStatus PaymentStatus
+		advanceTx   *PaymentTransaction
+		refundAlert bool
+		paidCart    *PaymentTransaction
+		paidTx      *PaymentTransaction
 	)
 
 	err = s.repo.RunInTransaction(ctx, func(repo PaymentRepository) error {
+		// Claim the nonce in the same transaction: if processing fails the claim
+		// rolls back, so the gateway's retry of this delivery is not a replay.
+		claimed, err := repo.ClaimWebhookNonce(ctx, gatewayID, auth.Nonce, auth.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to record webhook nonce: %w", err)
+		}
+		if !claimed {
+			return fmt.Errorf("gateway %s nonce %s: %w", gatewayID, auth.Nonce, ErrWebhookReplay)
+		}
+
 		tx, err := repo.GetByReferenceNumberForUpdate(ctx, gwPayload.ReferenceNumber)
 		if err != nil {
 			return fmt.Errorf("failed to retrieve transaction by reference: %w", err)
@@ -270,9 +544,45 @@ func (s *paymentService) ProcessWebhook(ctx context.Context, gatewayID string, b
 		}
 
 		// Idempotency: a terminal status is already recorded (possibly by a
-		// concurrent delivery that committed first) — nothing more to do.
-		if tx.Status == PaymentStatusSuccess || tx.Status == PaymentStatusFailed {
+		// concurrent delivery that committed first, or since refunded) —
+		// nothing more to do.
+		if tx.Status.paid() || tx.Status == PaymentStatusFailed {
 			slog.Info("webhook ignored (idempotent)", "reference", tx.ReferenceNumber, "current_status", tx.Status)
+			// A redelivery also retries a receipt that failed to issue.
+			if tx.Status == PaymentStatusSuccess {
+				paidTx = tx
+			}
+			// A redelivery re-drives task steps an earlier one failed to complete.
+			switch {
+			case tx.consolidated() && tx.Status == PaymentStatusSuccess:
+				paidCart = tx
+			case !tx.consolidated() && tx.TaskNotifiedAt == nil && (tx.Status == PaymentStatusSuccess || tx.Status == PaymentStatusFailed):
+				advanceTx = tx
+			}
+			return nil
+		}
+
+		// Late webhook for an expired or superseded reference. The task has
+		// already moved on from this attempt, so it is never advanced from here:
+		// a late success is flagged for refund, anything else changes nothing.
+		if tx.Status.closed() {
+			if newStatus != PaymentStatusSuccess {
+				slog.Info("webhook ignored (reference closed)", "reference", tx.ReferenceNumber, "current_status", tx.Status, "status", newStatus)
+				return nil
+			}
+			tx.Status = PaymentStatusRefundRequired
+			tx.PaymentMethod = gwPayload.PaymentMethod
+			if tx.GatewayMetadata == nil {
+				tx.GatewayMetadata = make(map[string]string)
+			}
+			tx.GatewayMetadata["gateway_transaction_id"] = gwPayload.GatewayTransactionID
+			tx.GatewayMetadata["webhook_timestamp"] = gwPayload.Timestamp
+			tx.GatewayMetadata["paid_amount"] = gwPayload.Amount.String()
+			tx.GatewayMetadata["paid_currency"] = gwPayload.Currency
+			if err := repo.Update(ctx, tx); err != nil {
+				return fmt.Errorf("failed to flag transaction for refund: %w", err)
+			}
+			refundAlert = true
 			return nil
 		}
 
@@ -297,51 +607,129 @@ func (s *paymentService) ProcessWebhook(ctx context.Context, gatewayID string, b
 		if err := repo.Update(ctx, tx); err != nil {
 			return fmt.Errorf("failed to update transaction status: %w", err)
 		}
+		if tx.Status == PaymentStatusSuccess {
+			paidTx = tx
+		}
 
-		advance = true
-		advanceTask = tx.TaskID
-		finalStatus = tx.Status
+		// A cart settles all of its line items in this same transaction. A
+		// failed cart puts them back so the trader can check out again; its
+		// tasks stay waiting.
+		if tx.consolidated() {
+			switch tx.Status {
+			case PaymentStatusSuccess:
+				if err := repo.MarkLineItemsPaid(ctx, tx.ID); err != nil {
+					return fmt.Errorf("failed to mark line items paid: %w", err)
+				}
+				paidCart = tx
+			case PaymentStatusFailed:
+				if err := repo.ReleaseLineItems(ctx, tx.ID); err != nil {
+					return fmt.Errorf("failed to release line items: %w", err)
+				}
+			}
+			return nil
+		}
+
+		advanceTx = tx
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	// Best-effort pruning; a stale nonce row is harmless, so failures only log.
+	if err := s.repo.DeleteExpiredWebhookNonces(ctx, time.Now()); err != nil {
+		slog.WarnContext(ctx, "paymentsv2: failed to prune expired webhook nonces", "error", err)
+	}
+
+	if refundAlert {
+		raiseRefundAlert(ctx, gatewayID, gwPayload)
+		return nil
+	}
+
+	if paidTx != nil {
+		s.issueReceiptAfterPayment(ctx, paidTx)
+	}
+
+	if paidCart != nil {
+		slog.Info("processed cart webhook successfully", "reference", paidCart.ReferenceNumber, "consignmentId", paidCart.ConsignmentID)
+		// The payment is recorded and the nonce claimed, so a redelivery of this
+		// webhook would be rejected as a replay. Tasks not advanced here are left
+		// to RedriveTaskSteps rather than failing the delivery.
+		if err := s.completeCartSteps(ctx, paidCart); err != nil {
+			slog.WarnContext(ctx, "paymentsv2: cart task steps left for the re-drive sweep",
+				"reference", paidCart.ReferenceNumber, "error", err)
+		}
+		return nil
+	}
+
 	// Already terminal / nothing claimed — don't advance again.
-	if !advance {
+	if advanceTx == nil {
 		return nil
 	}
 
-	slog.Info("processed webhook successfully", "reference", gwPayload.ReferenceNumber, "status", finalStatus)
+	slog.Info("processed webhook successfully", "reference", gwPayload.ReferenceNumber, "status", advanceTx.Status)
 
 	// Advance the suspended workflow step OUTSIDE the transaction so the row lock
-	// is never held across the task-engine call. Only SUCCESS and FAILED map to a
-	// task signal; any other status leaves the task untouched so a non-terminal or
-	// unrecognized gateway status can't be misread as paid.
+	// is never held across the task-engine call. As for a cart, the nonce is
+	// already claimed, so a step the task engine refuses is left to a later
+	// delivery or RedriveTaskSteps rather than failing this one.
+	if err := s.completePaymentStep(ctx, advanceTx); err != nil {
+		slog.WarnContext(ctx, "paymentsv2: task step left for the re-drive sweep",
+			"reference", advanceTx.ReferenceNumber, "taskId", advanceTx.TaskID, "error", err)
+	}
+	return nil
+}
+
+// completePaymentStep completes the PAYMENT step of a settled single-task
+// transaction and records that the task was told, so that a redelivery or
+// RedriveTaskSteps only re-drives a step not yet completed. Only SUCCESS and
+// FAILED map to a task signal; any other status leaves the task untouched so a
+// non-terminal or unrecognized gateway status can't be misread as paid.
+func (s *paymentService) completePaymentStep(ctx context.Context, tx *PaymentTransaction) error {
 	if s.taskCompleter == nil {
 		return nil
 	}
 
 	var statusStr string
-	switch finalStatus {
+	switch tx.Status {
 	case PaymentStatusSuccess:
 		statusStr = "success"
 	case PaymentStatusFailed:
 		statusStr = "fail"
-	}
-	if statusStr == "" {
+	default:
 		slog.Warn("paymentsv2: non-terminal webhook status, not advancing task",
-			"reference", gwPayload.ReferenceNumber, "taskId", advanceTask, "status", finalStatus)
+			"reference", tx.ReferenceNumber, "taskId", tx.TaskID, "status", tx.Status)
 		return nil
 	}
 
-	slog.Info("paymentsv2: advancing task step", "taskId", advanceTask, "status", statusStr)
-	if err := s.taskCompleter.CompleteTaskStep(ctx, advanceTask, map[string]any{"payment_status": statusStr}); err != nil {
-		// The transaction is already persisted; log and let the gateway retry
-		// drive a re-attempt rather than masking the failure as success.
-		slog.Error("paymentsv2: failed to advance task step", "taskId", advanceTask, "error", err)
-		return fmt.Errorf("failed to advance task step for %s: %w", advanceTask, err)
+	slog.Info("paymentsv2: advancing task step", "taskId", tx.TaskID, "status", statusStr)
+	if err := s.taskCompleter.CompleteTaskStep(ctx, tx.TaskID, map[string]any{"payment_status": statusStr}); err != nil {
+		return fmt.Errorf("failed to advance task step for %s: %w", tx.TaskID, err)
+	}
+	if err := s.repo.MarkTaskNotified(ctx, tx.ID, time.Now()); err != nil {
+		return fmt.Errorf("failed to record notification of %s: %w", tx.TaskID, err)
 	}
-
 	return nil
 }
+
+func (s *paymentService) RedriveTaskSteps(ctx context.Context, limit int) (int, error) {
+	if s.taskCompleter == nil {
+		return 0, errors.New("paymentsv2: task completer not set, refusing to re-drive task steps")
+	}
+	settled, err := s.repo.ListSettledPendingNotification(ctx, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list settled payments pending notification: %w", err)
+	}
+
+	done := 0
+	var errs []error
+	for i := range settled {
+		if err := s.completePaymentStep(ctx, &settled[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		done++
+	}
+	carts, err := s.redriveCartSteps(ctx, limit)
+	return done + carts, errors.Join(append(errs, err)...)
+}
@@ -3,6 +3,8 @@ package paymentsv2
 import (
 	"context"
 	"errors"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -24,6 +26,13 @@ type mockRepo struct {
 	createErr error
 	getErr    error
 	updateErr error
+	claimErr  error
+
+	// lockHeld simulates another replica holding the expiry sweep lock.
+	lockHeld bool
+
+	// nonces holds claimed webhook nonces keyed "<gateway>/<nonce>".
+	nonces map[string]time.Time
 
 	// collide makes the first N GetByReferenceNumber calls report an existing
 	// row, used to exercise the reference-collision retry loop.
@@ -31,6 +40,16 @@ type mockRepo struct {
 
 	getCount    int
 	updateCount int
+
+	// refunds holds refunds keyed by ID.
+	refunds map[string]*Refund
+
+	// lineItems holds cart line items in insertion order.
+	lineItems []*PaymentLineItem
+
+	// receipts holds issued receipts keyed by transaction ID.
+	receipts   map[string]*PaymentReceipt
+	receiptErr error
 }
 
 func newMockRepo() *mockRepo { return &mockRepo{txs: map[string]*PaymentTransaction{}} }
@@ -62,15 +81,46 @@ func (m *mockRepo) GetByReferenceNumberForUpdate(ctx context.Context, ref string
 	return m.GetByReferenceNumber(ctx, ref)
 }
 
-func (m *mockRepo) GetByTaskID(_ context.Context, taskID string) (*PaymentTransaction, error) {
+func (m *mockRepo) GetByID(_ context.Context, id string) (*PaymentTransaction, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
 	for _, tx := range m.txs {
-		if tx.TaskID == taskID {
+		if tx.ID == id {
 			return tx, nil
 		}
 	}
 	return nil, nil
 }
 
+func (m *mockRepo) GetByTaskID(_ context.Context, taskID string) (*PaymentTransaction, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	var latest *PaymentTransaction
+	for _, tx := range m.txs {
+		if tx.TaskID == taskID && (latest == nil || tx.AttemptNo > latest.AttemptNo) {
+			latest = tx
+		}
+	}
+	return latest, nil
+}
+
+func (m *mockRepo) GetByTaskIDForUpdate(ctx context.Context, taskID string) (*PaymentTransaction, error) {
+	return m.GetByTaskID(ctx, taskID)
+}
+
+func (m *mockRepo) ListByTaskID(_ context.Context, taskID string) ([]PaymentTransaction, error) {
+	var out []PaymentTransaction
+	for _, tx := range m.txs {
+		if tx.TaskID == taskID {
+			out = append(out, *tx)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AttemptNo < out[j].AttemptNo })
+	return out, nil
+}
+
 func (m *mockRepo) Update(_ context.Context, tx *PaymentTransaction) error {
 	m.updateCount++
 	if m.updateErr != nil {
@@ -87,6 +137,260 @@ func (m *mockRepo) UpdateStatus(_ context.Context, ref string, status PaymentSta
 	return nil
 }
 
+func (m *mockRepo) TransitionStatus(_ context.Context, ref string, from, to PaymentStatus) (bool, error) {
+	tx, ok := m.txs[ref]
+	if !ok || tx.Status != from {
+		return false, nil
+	}
+	tx.Status = to
+	return true, nil
+}
+
+func (m *mockRepo) ListOverduePendingForUpdate(_ context.Context, cutoff time.Time, limit int) ([]PaymentTransaction, error) {
+	var out []PaymentTransaction
+	for _, tx := range m.txs {
+		if tx.Status == PaymentStatusPending && tx.ExpiryDate.Before(cutoff) && len(out) < limit {
+			out = append(out, *tx)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) TryAdvisoryXactLock(context.Context, int64) (bool, error) {
+	return !m.lockHeld, nil
+}
+
+func (m *mockRepo) ClaimWebhookNonce(_ context.Context, gatewayID, nonce string, expiresAt time.Time) (bool, error) {
+	if m.claimErr != nil {
+		return false, m.claimErr
+	}
+	key := gatewayID + "/" + nonce
+	if _, ok := m.nonces[key]; ok {
+		return false, nil
+	}
+	if m.nonces == nil {
+		m.nonces = map[string]time.Time{}
+	}
+	m.nonces[key] = expiresAt
+	return true, nil
+}
+
+func (m *mockRepo) DeleteExpiredWebhookNonces(_ context.Context, now time.Time) error {
+	for key, expiresAt := range m.nonces {
+		if expiresAt.Before(now) {
+			delete(m.nonces, key)
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) CreateRefund(_ context.Context, refund *Refund) error {
+	if m.refunds == nil {
+		m.refunds = map[string]*Refund{}
+	}
+	m.refunds[refund.ID] = refund
+	return nil
+}
+
+func (m *mockRepo) UpdateRefund(_ context.Context, refund *Refund) error {
+	m.refunds[refund.ID] = refund
+	return nil
+}
+
+func (m *mockRepo) GetRefundForUpdate(_ context.Context, id string) (*Refund, error) {
+	return m.refunds[id], nil
+}
+
+func (m *mockRepo) GetPendingRefund(_ context.Context, transactionID string) (*Refund, error) {
+	for _, r := range m.refunds {
+		if r.TransactionID == transactionID && r.Status == RefundStatusPending {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRepo) SumSucceededRefunds(_ context.Context, transactionID string) (decimal.Decimal, error) {
+	total := decimal.Zero
+	for _, r := range m.refunds {
+		if r.TransactionID == transactionID && r.Status == RefundStatusSucceeded {
+			total = total.Add(r.Amount)
+		}
+	}
+	return total, nil
+}
+
+func (m *mockRepo) ListRefunds(_ context.Context, status RefundStatus) ([]Refund, error) {
+	var out []Refund
+	for _, r := range m.refunds {
+		if status == "" || r.Status == status {
+			out = append(out, *r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *mockRepo) GetCartAttempt(_ context.Context, consignmentID string) (*PaymentTransaction, error) {
+	var latest *PaymentTransaction
+	for _, tx := range m.txs {
+		if tx.ConsignmentID == consignmentID && (latest == nil || tx.AttemptNo > latest.AttemptNo) {
+			latest = tx
+		}
+	}
+	return latest, nil
+}
+
+func (m *mockRepo) GetCartAttemptForUpdate(ctx context.Context, consignmentID string) (*PaymentTransaction, error) {
+	return m.GetCartAttempt(ctx, consignmentID)
+}
+
+func (m *mockRepo) CreateLineItem(_ context.Context, item *PaymentLineItem) error {
+	m.lineItems = append(m.lineItems, item)
+	return nil
+}
+
+func (m *mockRepo) UpdateLineItem(context.Context, *PaymentLineItem) error { return nil }
+
+func (m *mockRepo) GetLineItemByTaskIDForUpdate(_ context.Context, taskID string) (*PaymentLineItem, error) {
+	for _, item := range m.lineItems {
+		if item.TaskID == taskID {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRepo) GetLineItemByTaskID(ctx context.Context, taskID string) (*PaymentLineItem, error) {
+	return m.GetLineItemByTaskIDForUpdate(ctx, taskID)
+}
+
+func (m *mockRepo) CreateReceipt(_ context.Context, receipt *PaymentReceipt) error {
+	if m.receiptErr != nil {
+		return m.receiptErr
+	}
+	if m.receipts == nil {
+		m.receipts = map[string]*PaymentReceipt{}
+	}
+	if _, ok := m.receipts[receipt.TransactionID]; ok {
+		return errors.New("duplicate key value violates unique constraint")
+	}
+	m.receipts[receipt.TransactionID] = receipt
+	return nil
+}
+
+func (m *mockRepo) GetReceiptByTransactionID(_ context.Context, transactionID string) (*PaymentReceipt, error) {
+	return m.receipts[transactionID], nil
+}
+
+func (m *mockRepo) GetReceiptByVerificationCode(_ context.Context, code string) (*PaymentReceipt, error) {
+	for _, r := range m.receipts {
+		if r.VerificationCode == code {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRepo) listLineItems(match func(*PaymentLineItem) bool) []PaymentLineItem {
+	var out []PaymentLineItem
+	for _, item := range m.lineItems {
+		if match(item) {
+			out = append(out, *item)
+		}
+	}
+	return out
+}
+
+func (m *mockRepo) ListUnpaidLineItems(_ context.Context, consignmentID string) ([]PaymentLineItem, error) {
+	return m.listLineItems(func(item *PaymentLineItem) bool {
+		return item.ConsignmentID == consignmentID && item.Status != LineItemStatusPaid
+	}), nil
+}
+
+func (m *mockRepo) ListOpenLineItemsForUpdate(_ context.Context, consignmentID string) ([]PaymentLineItem, error) {
+	return m.listLineItems(func(item *PaymentLineItem) bool {
+		return item.ConsignmentID == consignmentID && item.Status == LineItemStatusOpen
+	}), nil
+}
+
+func (m *mockRepo) ListLineItemsByTransaction(_ context.Context, transactionID string) ([]PaymentLineItem, error) {
+	return m.listLineItems(func(item *PaymentLineItem) bool { return item.TransactionID == transactionID }), nil
+}
+
+func (m *mockRepo) CheckOutLineItems(_ context.Context, ids []string, transactionID string) error {
+	for _, item := range m.lineItems {
+		if slices.Contains(ids, item.ID) {
+			item.Status, item.TransactionID = LineItemStatusCheckedOut, transactionID
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) ReleaseLineItems(_ context.Context, transactionID string) error {
+	for _, item := range m.lineItems {
+		if item.TransactionID == transactionID && item.Status == LineItemStatusCheckedOut {
+			item.Status, item.TransactionID = LineItemStatusOpen, ""
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) MarkLineItemsPaid(_ context.Context, transactionID string) error {
+	for _, item := range m.lineItems {
+		if item.TransactionID == transactionID {
+			item.Status = LineItemStatusPaid
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) MarkLineItemNotified(_ context.Context, id string, at time.Time) error {
+	for _, item := range m.lineItems {
+		if item.ID == id {
+			item.NotifiedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) ListPaidCartsPendingNotification(_ context.Context, limit int) ([]PaymentTransaction, error) {
+	var out []PaymentTransaction
+	for _, tx := range m.txs {
+		if !tx.consolidated() || tx.Status != PaymentStatusSuccess || len(out) >= limit {
+			continue
+		}
+		if len(m.listLineItems(func(item *PaymentLineItem) bool {
+			return item.TransactionID == tx.ID && item.Status == LineItemStatusPaid && item.NotifiedAt == nil
+		})) > 0 {
+			out = append(out, *tx)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) MarkTaskNotified(_ context.Context, id string, at time.Time) error {
+	for _, tx := range m.txs {
+		if tx.ID == id {
+			tx.TaskNotifiedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) ListSettledPendingNotification(_ context.Context, limit int) ([]PaymentTransaction, error) {
+	var out []PaymentTransaction
+	for _, tx := range m.txs {
+		if tx.consolidated() || tx.TaskNotifiedAt != nil || len(out) >= limit {
+			continue
+		}
+		if tx.Status == PaymentStatusSuccess || tx.Status == PaymentStatusFailed {
+			out = append(out, *tx)
+		}
+	}
+	return out, nil
+}
+
 func (m *mockRepo) RunInTransaction(ctx context.Context, fn func(repo PaymentRepository) error) error {
 	return fn(m)
 }
@@ -109,6 +413,15 @@ func (m *mockRegistry) Get(string) (gateways.PaymentGateway, error) {
 
 func (m *mockRegistry) ListInfo() []GatewayInfo { return m.infos }
 
+func (m *mockRegistry) GetInfo(id string) (GatewayInfo, bool) {
+	for _, info := range m.infos {
+		if info.ID == id {
+			return info, true
+		}
+	}
+	return GatewayInfo{}, false
+}
+
 type completeCall struct {
 	taskID  string
 	payload map[string]any
@@ -117,10 +430,15 @@ type completeCall struct {
 type mockTaskCompleter struct {
 	calls []completeCall
 	err   error
+	// errFor fails only the listed tasks, overriding err.
+	errFor map[string]error
 }
 
 func (m *mockTaskCompleter) CompleteTaskStep(_ context.Context, taskID string, payload map[string]any) error {
 	m.calls = append(m.calls, completeCall{taskID: taskID, payload: payload})
+	if err, ok := m.errFor[taskID]; ok {
+		return err
+	}
 	return m.err
 }
 
@@ -330,6 +648,7 @@ func TestValidateReference_ExpiredNotPayable(t *testing.T) {
 
 func pendingTx() *PaymentTransaction {
 	return &PaymentTransaction{
+		ID:              "tx-9",
 		ReferenceNumber: "TNSW1",
 		TaskID:          "task-9",
 		GatewayID:       "govpay",
@@ -340,8 +659,12 @@ func pendingTx() *PaymentTransaction {
 	}
 }
 
+// webhookGateway returns a gateway that authenticates every delivery with
+// nonce "n-1" and parses it into p.
 func webhookGateway(p *gateways.WebhookPayload) *MockGateway {
 	gw := new(MockGateway)
+	gw.On("VerifyWebhook", mock.Anything, mock.Anything).
+		Return(&gateways.WebhookAuth{Nonce: "n-1", ExpiresAt: time.Now().Add(time.Minute)}, nil)
 	gw.On("ParseWebhook", mock.Anything, mock.Anything, mock.Anything).Return(p, nil)
 	return gw
 }
@@ -361,12 +684,13 @@ func TestProcessWebhook_SuccessAdvancesTask(t *testing.T) {
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 	svc.SetTaskCompleter(tc)
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.NoError(t, err)
 	assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSW1"].Status)
 	require.Len(t, tc.calls, 1)
 	assert.Equal(t, "task-9", tc.calls[0].taskID)
 	assert.Equal(t, "success", tc.calls[0].payload["payment_status"])
+	assert.NotNil(t, repo.txs["TNSW1"].TaskNotifiedAt)
 }
 
 func TestProcessWebhook_AmountMismatch(t *testing.T) {
@@ -382,7 +706,7 @@ func TestProcessWebhook_AmountMismatch(t *testing.T) {
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 	svc.SetTaskCompleter(tc)
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.ErrorIs(t, err, ErrAmountMismatch)
 	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status, "must not mark paid on mismatch")
 	assert.Empty(t, tc.calls)
@@ -399,7 +723,7 @@ func TestProcessWebhook_CurrencyMismatch(t *testing.T) {
 	})
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.ErrorIs(t, err, ErrAmountMismatch)
 	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status)
 }
@@ -415,7 +739,7 @@ func TestProcessWebhook_Failed(t *testing.T) {
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 	svc.SetTaskCompleter(tc)
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.NoError(t, err)
 	assert.Equal(t, PaymentStatusFailed, repo.txs["TNSW1"].Status)
 	require.Len(t, tc.calls, 1)
@@ -426,6 +750,8 @@ func TestProcessWebhook_Idempotent(t *testing.T) {
 	repo := newMockRepo()
 	settled := pendingTx()
 	settled.Status = PaymentStatusSuccess
+	notifiedAt := time.Now()
+	settled.TaskNotifiedAt = &notifiedAt
 	repo.txs["TNSW1"] = settled
 	gw := webhookGateway(&gateways.WebhookPayload{
 		ReferenceNumber: "TNSW1",
@@ -437,7 +763,7 @@ func TestProcessWebhook_Idempotent(t *testing.T) {
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 	svc.SetTaskCompleter(tc)
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.NoError(t, err)
 	assert.Empty(t, tc.calls, "already-terminal webhook must not advance the task again")
 }
@@ -447,7 +773,7 @@ func TestProcessWebhook_NotFound(t *testing.T) {
 	gw := webhookGateway(&gateways.WebhookPayload{ReferenceNumber: "NOPE", Status: gateways.WebhookStatusSuccess})
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.ErrorIs(t, err, ErrTransactionNotFound)
 }
 
@@ -460,7 +786,7 @@ func TestProcessWebhook_UnsupportedStatus(t *testing.T) {
 	})
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.ErrorIs(t, err, gateways.ErrUnsupportedWebhookStatus)
 	assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status)
 }
@@ -476,27 +802,64 @@ func TestProcessWebhook_NonTerminalDoesNotAdvance(t *testing.T) {
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 	svc.SetTaskCompleter(tc)
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.NoError(t, err)
 	assert.Empty(t, tc.calls, "a PENDING webhook must not advance the task")
 }
 
-func TestProcessWebhook_CompleterErrorPropagates(t *testing.T) {
+func TestProcessWebhook_FailedStepIsRedriven(t *testing.T) {
 	repo := newMockRepo()
 	repo.txs["TNSW1"] = pendingTx()
-	gw := webhookGateway(&gateways.WebhookPayload{
+	payload := &gateways.WebhookPayload{
 		ReferenceNumber: "TNSW1",
 		Status:          gateways.WebhookStatusSuccess,
 		Amount:          decimal.RequireFromString("1500.00"),
 		Currency:        "LKR",
-	})
+	}
 	tc := &mockTaskCompleter{err: errors.New("task engine down")}
-	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+	svc := NewPaymentService(repo, &mockRegistry{gw: webhookGateway(payload)})
 	svc.SetTaskCompleter(tc)
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
-	require.Error(t, err)
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}),
+		"the payment is recorded, so the delivery is not failed")
 	assert.Equal(t, PaymentStatusSuccess, repo.txs["TNSW1"].Status, "status is committed before the advance call")
+	assert.Nil(t, repo.txs["TNSW1"].TaskNotifiedAt)
+
+	// A fresh delivery of the same outcome, under a new nonce, completes the step.
+	tc.err = nil
+	redelivery := new(MockGateway)
+	redelivery.On("VerifyWebhook", mock.Anything, mock.Anything).
+		Return(&gateways.WebhookAuth{Nonce: "n-2", ExpiresAt: time.Now().Add(time.Minute)}, nil)
+	redelivery.On("ParseWebhook", mock.Anything, mock.Anything, mock.Anything).Return(payload, nil)
+	svc = NewPaymentService(repo, &mockRegistry{gw: redelivery})
+	svc.SetTaskCompleter(tc)
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	require.Len(t, tc.calls, 2)
+	assert.Equal(t, "success", tc.calls[1].payload["payment_status"])
+	assert.NotNil(t, repo.txs["TNSW1"].TaskNotifiedAt)
+
+	// Once told, neither the sweep nor another delivery advances the task again.
+	n, err := svc.RedriveTaskSteps(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, tc.calls, 2)
+}
+
+func TestRedriveTaskSteps_CompletesSettledPayment(t *testing.T) {
+	repo := newMockRepo()
+	failed := pendingTx()
+	failed.Status = PaymentStatusFailed
+	repo.txs["TNSW1"] = failed
+	tc := &mockTaskCompleter{}
+	svc := NewPaymentService(repo, &mockRegistry{})
+	svc.SetTaskCompleter(tc)
+
+	n, err := svc.RedriveTaskSteps(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, tc.calls, 1)
+	assert.Equal(t, "fail", tc.calls[0].payload["payment_status"])
+	assert.NotNil(t, repo.txs["TNSW1"].TaskNotifiedAt)
 }
 
 func TestListAvailableMethods(t *testing.T) {
@@ -508,6 +871,36 @@ func TestListAvailableMethods(t *testing.T) {
 	assert.Equal(t, infos, got)
 }
 
+func TestGetMethod(t *testing.T) {
+	gw := new(MockGateway)
+	gw.On("GetFlowType").Return(gateways.FlowTypeInstruction)
+	infos := []GatewayInfo{
+		{ID: "govpay", IsActive: true, RenderInfo: RenderInfo{Template: "ref {{ .ReferenceNumber }}"}},
+		{ID: "retired", IsActive: false},
+	}
+	svc := NewPaymentService(newMockRepo(), &mockRegistry{gw: gw, infos: infos})
+
+	method, err := svc.GetMethod(context.Background(), "govpay")
+	require.NoError(t, err)
+	assert.Equal(t, "govpay", method.ID)
+	assert.Equal(t, gateways.FlowTypeInstruction, method.Type)
+	assert.Equal(t, "ref {{ .ReferenceNumber }}", method.RenderInfo.Template)
+
+	_, err = svc.GetMethod(context.Background(), "retired")
+	assert.ErrorIs(t, err, ErrMethodUnavailable)
+
+	_, err = svc.GetMethod(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrMethodUnavailable)
+}
+
+func TestGetMethod_NoImplementation(t *testing.T) {
+	infos := []GatewayInfo{{ID: "lankapay", IsActive: true}}
+	svc := NewPaymentService(newMockRepo(), &mockRegistry{getErr: errors.New("not registered"), infos: infos})
+
+	_, err := svc.GetMethod(context.Background(), "lankapay")
+	assert.ErrorIs(t, err, ErrMethodUnavailable)
+}
+
 func TestCreateCheckoutSession_ReferenceLookupError(t *testing.T) {
 	repo := newMockRepo()
 	repo.getErr = errors.New("db down")
@@ -568,16 +961,17 @@ func TestValidateReference_RepoError(t *testing.T) {
 
 func TestProcessWebhook_GatewayNotFound(t *testing.T) {
 	svc := NewPaymentService(newMockRepo(), &mockRegistry{getErr: errors.New("nope")})
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.Error(t, err)
 }
 
 func TestProcessWebhook_ParseError(t *testing.T) {
 	gw := new(MockGateway)
+	gw.On("VerifyWebhook", mock.Anything, mock.Anything).Return(&gateways.WebhookAuth{Nonce: "n-1"}, nil)
 	gw.On("ParseWebhook", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("bad payload"))
 	svc := NewPaymentService(newMockRepo(), &mockRegistry{gw: gw})
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.Error(t, err)
 }
 
@@ -587,7 +981,7 @@ func TestProcessWebhook_RepoGetError(t *testing.T) {
 	gw := webhookGateway(&gateways.WebhookPayload{ReferenceNumber: "TNSW1", Status: gateways.WebhookStatusSuccess})
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.Error(t, err)
 }
 
@@ -603,6 +997,74 @@ func TestProcessWebhook_UpdateError(t *testing.T) {
 	})
 	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
 
-	err := svc.ProcessWebhook(context.Background(), "govpay", []byte(`{}`), nil)
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
 	require.Error(t, err)
 }
+
+func TestProcessWebhook_VerificationFailureIsUnauthorized(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want error
+	}{
+		"bad signature":       {err: gateways.ErrWebhookSignature, want: gateways.ErrWebhookSignature},
+		"non-auth error kept": {err: errors.New("verifier broke"), want: gateways.ErrWebhookUnauthorized},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := newMockRepo()
+			repo.txs["TNSW1"] = pendingTx()
+			gw := new(MockGateway)
+			gw.On("VerifyWebhook", mock.Anything, mock.Anything).Return(nil, tc.err)
+			tc2 := &mockTaskCompleter{}
+			svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+			svc.SetTaskCompleter(tc2)
+
+			err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
+			require.ErrorIs(t, err, tc.want)
+			require.ErrorIs(t, err, gateways.ErrWebhookUnauthorized)
+			gw.AssertNotCalled(t, "ParseWebhook", mock.Anything, mock.Anything, mock.Anything)
+			assert.Equal(t, PaymentStatusPending, repo.txs["TNSW1"].Status)
+			assert.Empty(t, tc2.calls)
+		})
+	}
+}
+
+func TestProcessWebhook_ReplayedNonceRejected(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = pendingTx()
+	gw := webhookGateway(&gateways.WebhookPayload{
+		ReferenceNumber: "TNSW1",
+		Status:          gateways.WebhookStatusPending,
+	})
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
+	require.ErrorIs(t, err, ErrWebhookReplay)
+	require.ErrorIs(t, err, gateways.ErrWebhookUnauthorized)
+}
+
+func TestProcessWebhook_NonceClaimError(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = pendingTx()
+	repo.claimErr = errors.New("db down")
+	gw := webhookGateway(&gateways.WebhookPayload{ReferenceNumber: "TNSW1", Status: gateways.WebhookStatusSuccess})
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	err := svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, gateways.ErrWebhookUnauthorized, "a storage failure must stay retryable")
+}
+
+func TestProcessWebhook_PrunesExpiredNonces(t *testing.T) {
+	repo := newMockRepo()
+	repo.txs["TNSW1"] = pendingTx()
+	repo.nonces = map[string]time.Time{"govpay/old": time.Now().Add(-time.Hour)}
+	gw := webhookGateway(&gateways.WebhookPayload{ReferenceNumber: "TNSW1", Status: gateways.WebhookStatusPending})
+	svc := NewPaymentService(repo, &mockRegistry{gw: gw})
+
+	require.NoError(t, svc.ProcessWebhook(context.Background(), "govpay", gateways.WebhookRequest{Body: []byte(`{}`)}))
+	assert.NotContains(t, repo.nonces, "govpay/old")
+	assert.Contains(t, repo.nonces, "govpay/n-1")
+}
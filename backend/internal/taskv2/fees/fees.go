@@ -0,0 +1,342 @@
+// Package fees computes PAYMENT subtask amounts from versioned fee tables.
+//
+// A fee table is a JSON file (*_fees.json) in a task config folder, loaded by
+// registry.LoadConfigsInto. It declares the step inputs it reads and their
+// types, and each line item carries an optional "when" condition and an
+// "amount" expression, both written in expr (https://expr-lang.org) over
+// those inputs, e.g.
+//
+//	"inputs": { "quantity": "number" },
+//	"items": [{ "code": "INSPECTION", "when": "quantity > 0", "amount": "quantity * 25" }]
+//
+// Several versions of one table may be loaded; the version in force at the
+// time of evaluation is the one with the latest effective_from not after it.
+package fees
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/shopspring/decimal"
+)
+
+// ErrTableNotFound indicates no version of a fee table is in force at the
+// requested time.
+var ErrTableNotFound = errors.New("fee table not found")
+
+// ErrEvaluation indicates a fee table could not be evaluated against the given
+// inputs, e.g. a referenced input is missing or an amount is negative.
+var ErrEvaluation = errors.New("fee evaluation failed")
+
+// InputType is the type of a fee table input.
+type InputType string
+
+const (
+	InputNumber InputType = "number"
+	InputString InputType = "string"
+	InputBool   InputType = "bool"
+)
+
+// zero returns the zero value expressions see for an input of type t, or nil
+// if t is not a known type.
+func (t InputType) zero() any {
+	switch t {
+	case InputNumber:
+		return float64(0)
+	case InputString:
+		return ""
+	case InputBool:
+		return false
+	default:
+		return nil
+	}
+}
+
+// convert converts an input value to type t. Numbers may be given as strings,
+// as form inputs often are.
+func (t InputType) convert(v any) (any, error) {
+	switch t {
+	case InputNumber:
+		d, err := toDecimal(v)
+		if err != nil {
+			return nil, err
+		}
+		return d.InexactFloat64(), nil
+	case InputString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case InputBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a %s, got %T", t, v)
+}
+
+// Table is one version of a fee table.
+type Table struct {
+	ID            string    `json:"id"`
+	Version       string    `json:"version"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	Currency      string    `json:"currency"`
+	// Inputs declares every step input the expressions read, by name. Rules
+	// are compiled against these types, so an undeclared or misspelled name
+	// fails at load time, and each declared input must be supplied.
+	Inputs map[string]InputType `json:"inputs"`
+	Items  []ItemRule           `json:"items"`
+
+	compiled []compiledItem
+}
+
+// ItemRule is one line item of a fee table.
+type ItemRule struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	// When is an optional boolean expression; the item is charged only when
+	// it holds. Empty means always.
+	When string `json:"when,omitempty"`
+	// Amount is a numeric expression for the item's charge.
+	Amount string `json:"amount"`
+}
+
+type compiledItem struct {
+	rule   ItemRule
+	when   *vm.Program
+	amount *vm.Program
+}
+
+// LineItem is one charged item of a Quote.
+type LineItem struct {
+	Code        string          `json:"code"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+// Quote is the computed fee of a table for one set of inputs.
+type Quote struct {
+	TableID  string          `json:"table_id"`
+	Version  string          `json:"version"`
+	Currency string          `json:"currency"`
+	Items    []LineItem      `json:"items"`
+	Total    decimal.Decimal `json:"total"`
+}
+
+// Parse decodes and compiles a fee table, so a malformed expression fails at
+// load time rather than when a trader reaches the payment step.
+func Parse(data []byte) (*Table, error) {
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if err := t.compile(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (t *Table) compile() error {
+	switch {
+	case t.ID == "":
+		return errors.New("missing id")
+	case t.Version == "":
+		return errors.New("missing version")
+	case t.EffectiveFrom.IsZero():
+		return errors.New("missing effective_from")
+	case t.Currency == "":
+		return errors.New("missing currency")
+	case len(t.Items) == 0:
+		return errors.New("no items")
+	}
+
+	env := make(map[string]any, len(t.Inputs))
+	for name, typ := range t.Inputs {
+		zero := typ.zero()
+		if zero == nil {
+			return fmt.Errorf("input %s: unknown type %q", name, typ)
+		}
+		env[name] = zero
+	}
+
+	seen := make(map[string]bool, len(t.Items))
+	t.compiled = make([]compiledItem, 0, len(t.Items))
+	for i, rule := range t.Items {
+		if rule.Code == "" {
+			return fmt.Errorf("item %d: missing code", i)
+		}
+		if seen[rule.Code] {
+			return fmt.Errorf("item %s: duplicate code", rule.Code)
+		}
+		seen[rule.Code] = true
+		if rule.Amount == "" {
+			return fmt.Errorf("item %s: missing amount", rule.Code)
+		}
+
+		item := compiledItem{rule: rule}
+		var err error
+		if rule.When != "" {
+			if item.when, err = expr.Compile(rule.When, expr.Env(env), expr.AsBool()); err != nil {
+				return fmt.Errorf("item %s: when: %w", rule.Code, err)
+			}
+		}
+		if item.amount, err = expr.Compile(rule.Amount, expr.Env(env)); err != nil {
+			return fmt.Errorf("item %s: amount: %w", rule.Code, err)
+		}
+		t.compiled = append(t.compiled, item)
+	}
+	return nil
+}
+
+// Evaluate computes the fee for inputs. Every declared input must be present;
+// others are ignored. Amounts are rounded to two decimal places per item.
+func (t *Table) Evaluate(inputs map[string]any) (*Quote, error) {
+	env := make(map[string]any, len(t.Inputs))
+	for name, typ := range t.Inputs {
+		v, ok := inputs[name]
+		if !ok || v == nil {
+			return nil, fmt.Errorf("%w: missing input %s", ErrEvaluation, name)
+		}
+		converted, err := typ.convert(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: input %s: %w", ErrEvaluation, name, err)
+		}
+		env[name] = converted
+	}
+
+	q := &Quote{TableID: t.ID, Version: t.Version, Currency: t.Currency, Items: []LineItem{}, Total: decimal.Zero}
+	for _, item := range t.compiled {
+		if item.when != nil {
+			out, err := expr.Run(item.when, env)
+			if err != nil {
+				return nil, fmt.Errorf("%w: item %s: when: %w", ErrEvaluation, item.rule.Code, err)
+			}
+			if ok, _ := out.(bool); !ok {
+				continue
+			}
+		}
+
+		out, err := expr.Run(item.amount, env)
+		if err != nil {
+			return nil, fmt.Errorf("%w: item %s: amount: %w", ErrEvaluation, item.rule.Code, err)
+		}
+		amount, err := toDecimal(out)
+		if err != nil {
+			return nil, fmt.Errorf("%w: item %s: amount: %w", ErrEvaluation, item.rule.Code, err)
+		}
+		if amount.IsNegative() {
+			return nil, fmt.Errorf("%w: item %s: negative amount %s", ErrEvaluation, item.rule.Code, amount)
+		}
+		amount = amount.Round(2)
+		q.Items = append(q.Items, LineItem{Code: item.rule.Code, Description: item.rule.Description, Amount: amount})
+		q.Total = q.Total.Add(amount)
+	}
+	return q, nil
+}
+
+// toDecimal converts an input or expression result to a decimal. Numeric
+// strings are accepted so amounts can come straight from string inputs.
+func toDecimal(v any) (decimal.Decimal, error) {
+	switch n := v.(type) {
+	case int:
+		return decimal.NewFromInt(int64(n)), nil
+	case int8:
+		return decimal.NewFromInt(int64(n)), nil
+	case int16:
+		return decimal.NewFromInt(int64(n)), nil
+	case int32:
+		return decimal.NewFromInt32(n), nil
+	case int64:
+		return decimal.NewFromInt(n), nil
+	case uint:
+		return decimal.NewFromUint64(uint64(n)), nil
+	case uint8:
+		return decimal.NewFromUint64(uint64(n)), nil
+	case uint16:
+		return decimal.NewFromUint64(uint64(n)), nil
+	case uint32:
+		return decimal.NewFromUint64(uint64(n)), nil
+	case uint64:
+		return decimal.NewFromUint64(n), nil
+	case float32:
+		return decimal.NewFromFloat32(n), nil
+	case float64:
+		return decimal.NewFromFloat(n), nil
+	case json.Number:
+		return decimal.NewFromString(n.String())
+	case string:
+		return decimal.NewFromString(n)
+	case decimal.Decimal:
+		return n, nil
+	default:
+		return decimal.Zero, fmt.Errorf("expected a number, got %T", v)
+	}
+}
+
+// Schedule holds every loaded version of every fee table. It is safe for
+// concurrent use.
+type Schedule struct {
+	mu     sync.RWMutex
+	tables map[string][]*Table // sorted by EffectiveFrom
+}
+
+// NewSchedule creates an empty schedule.
+func NewSchedule() *Schedule {
+	return &Schedule{tables: make(map[string][]*Table)}
+}
+
+// Register adds a compiled table version. Two versions of a table may not
+// share a version label or an effective_from.
+func (s *Schedule) Register(t *Table) error {
+	if t.compiled == nil {
+		return fmt.Errorf("fee table %s: not compiled, use Parse", t.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.tables[t.ID] {
+		if existing.Version == t.Version {
+			return fmt.Errorf("fee table %s: duplicate version %s", t.ID, t.Version)
+		}
+		if existing.EffectiveFrom.Equal(t.EffectiveFrom) {
+			return fmt.Errorf("fee table %s: versions %s and %s share effective_from", t.ID, existing.Version, t.Version)
+		}
+	}
+	versions := append(s.tables[t.ID], t)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].EffectiveFrom.Before(versions[j].EffectiveFrom) })
+	s.tables[t.ID] = versions
+	return nil
+}
+
+// Lookup returns the version of table id in force at at.
+func (s *Schedule) Lookup(id string, at time.Time) (*Table, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := s.tables[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].EffectiveFrom.After(at) {
+			return versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s at %s: %w", id, at.Format(time.RFC3339), ErrTableNotFound)
+}
+
+// Has reports whether any version of table id is loaded.
+func (s *Schedule) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tables[id]) > 0
+}
+
+// Quote evaluates the version of table id in force at at.
+func (s *Schedule) Quote(id string, at time.Time, inputs map[string]any) (*Quote, error) {
+	t, err := s.Lookup(id, at)
+	if err != nil {
+		return nil, err
+	}
+	return t.Evaluate(inputs)
+}
@@ -0,0 +1,173 @@
+package fees
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const teaExportFees = `{
+  "id": "tea_export_fee",
+  "version": "2026.1",
+  "effective_from": "2026-01-01T00:00:00Z",
+  "currency": "LKR",
+  "inputs": { "quantity": "number", "flow": "string", "hs_code": "string", "declared_value": "number" },
+  "items": [
+    { "code": "BASE", "description": "Application fee", "amount": "1500" },
+    { "code": "INSPECTION", "description": "Inspection per unit", "when": "quantity > 0", "amount": "quantity * 12.5" },
+    { "code": "VALUE_LEVY", "description": "Levy on declared value", "when": "flow == 'EXPORT' && hs_code startsWith '0902'", "amount": "declared_value * 0.001" }
+  ]
+}`
+
+func mustParse(t *testing.T, data string) *Table {
+	t.Helper()
+	table, err := Parse([]byte(data))
+	require.NoError(t, err)
+	return table
+}
+
+func TestEvaluate_LineItems(t *testing.T) {
+	table := mustParse(t, teaExportFees)
+
+	q, err := table.Evaluate(map[string]any{
+		"quantity":       40,
+		"flow":           "EXPORT",
+		"hs_code":        "0902.10",
+		"declared_value": 123456.789,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tea_export_fee", q.TableID)
+	assert.Equal(t, "2026.1", q.Version)
+	assert.Equal(t, "LKR", q.Currency)
+	require.Len(t, q.Items, 3)
+	assert.Equal(t, "500", q.Items[1].Amount.String())
+	assert.Equal(t, "123.46", q.Items[2].Amount.String(), "rounded to cents")
+	assert.True(t, q.Total.Equal(decimal.RequireFromString("2123.46")), "total %s", q.Total)
+}
+
+func TestEvaluate_ConditionsSkipItems(t *testing.T) {
+	table := mustParse(t, teaExportFees)
+
+	q, err := table.Evaluate(map[string]any{"quantity": 0, "flow": "IMPORT", "hs_code": "0902.10", "declared_value": 1000})
+	require.NoError(t, err)
+	require.Len(t, q.Items, 1)
+	assert.Equal(t, "BASE", q.Items[0].Code)
+	assert.Equal(t, "1500", q.Total.String())
+}
+
+func TestEvaluate_Errors(t *testing.T) {
+	t.Run("missing input", func(t *testing.T) {
+		table := mustParse(t, `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR",
+			"inputs":{"quantity":"number"},"items":[{"code":"PER_UNIT","amount":"quantity * 10"}]}`)
+		_, err := table.Evaluate(nil)
+		assert.ErrorIs(t, err, ErrEvaluation)
+		_, err = table.Evaluate(map[string]any{"quantity": nil})
+		assert.ErrorIs(t, err, ErrEvaluation)
+	})
+	t.Run("missing input of a skipped item", func(t *testing.T) {
+		table := mustParse(t, teaExportFees)
+		_, err := table.Evaluate(map[string]any{"quantity": 0, "flow": "IMPORT", "hs_code": "0902.10"})
+		assert.ErrorIs(t, err, ErrEvaluation, "a missing input must not silently skip an item")
+	})
+	t.Run("mistyped input", func(t *testing.T) {
+		table := mustParse(t, `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR",
+			"inputs":{"quantity":"number"},"items":[{"code":"PER_UNIT","amount":"quantity * 10"}]}`)
+		_, err := table.Evaluate(map[string]any{"quantity": "four"})
+		assert.ErrorIs(t, err, ErrEvaluation)
+	})
+	t.Run("negative amount", func(t *testing.T) {
+		table := mustParse(t, `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR",
+			"items":[{"code":"DISCOUNT","amount":"-5"}]}`)
+		_, err := table.Evaluate(nil)
+		assert.ErrorIs(t, err, ErrEvaluation)
+	})
+	t.Run("non-numeric amount", func(t *testing.T) {
+		table := mustParse(t, `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR",
+			"inputs":{"flow":"string"},"items":[{"code":"X","amount":"flow"}]}`)
+		_, err := table.Evaluate(map[string]any{"flow": "EXPORT"})
+		assert.ErrorIs(t, err, ErrEvaluation)
+	})
+	t.Run("numeric string amount", func(t *testing.T) {
+		table := mustParse(t, `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR",
+			"inputs":{"fee":"string"},"items":[{"code":"X","amount":"fee"}]}`)
+		q, err := table.Evaluate(map[string]any{"fee": "99.999"})
+		require.NoError(t, err)
+		assert.Equal(t, "100", q.Total.String())
+	})
+}
+
+func TestEvaluate_NumericInputKinds(t *testing.T) {
+	table := mustParse(t, `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR",
+		"inputs":{"quantity":"number"},"items":[{"code":"PER_UNIT","amount":"quantity * 2.5"}]}`)
+	for _, v := range []any{int32(4), uint8(4), int64(4), float32(4), json.Number("4"), "4", decimal.NewFromInt(4)} {
+		q, err := table.Evaluate(map[string]any{"quantity": v})
+		require.NoError(t, err, "%T", v)
+		assert.Equal(t, "10", q.Total.String(), "%T", v)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"bad json":          `{`,
+		"missing id":        `{"version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1"}]}`,
+		"missing version":   `{"id":"t","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1"}]}`,
+		"missing effective": `{"id":"t","version":"1","currency":"LKR","items":[{"code":"A","amount":"1"}]}`,
+		"missing currency":  `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","items":[{"code":"A","amount":"1"}]}`,
+		"no items":          `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[]}`,
+		"missing code":      `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"amount":"1"}]}`,
+		"duplicate code":    `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1"},{"code":"A","amount":"2"}]}`,
+		"missing amount":    `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A"}]}`,
+		"bad amount expr":   `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1 +"}]}`,
+		"non-bool when":     `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","when":"1 + 1","amount":"1"}]}`,
+		"undeclared input":  `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","inputs":{"quantity":"number"},"items":[{"code":"A","amount":"quantiy * 2"}]}`,
+		"unknown type":      `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","inputs":{"quantity":"integer"},"items":[{"code":"A","amount":"quantity"}]}`,
+		"mistyped rule":     `{"id":"t","version":"1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","inputs":{"flow":"string"},"items":[{"code":"A","when":"flow > 0","amount":"1"}]}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSchedule_Versions(t *testing.T) {
+	s := NewSchedule()
+	v1 := mustParse(t, `{"id":"t","version":"v1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"100"}]}`)
+	v2 := mustParse(t, `{"id":"t","version":"v2","effective_from":"2026-07-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"120"}]}`)
+	// Registration order does not matter.
+	require.NoError(t, s.Register(v2))
+	require.NoError(t, s.Register(v1))
+	assert.True(t, s.Has("t"))
+	assert.False(t, s.Has("other"))
+
+	q, err := s.Quote("t", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", q.Version)
+
+	q, err = s.Quote("t", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", q.Version, "effective_from is inclusive")
+
+	_, err = s.Quote("t", time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), nil)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	_, err = s.Quote("other", time.Now(), nil)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestSchedule_RegisterConflicts(t *testing.T) {
+	s := NewSchedule()
+	require.NoError(t, s.Register(mustParse(t, `{"id":"t","version":"v1","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1"}]}`)))
+
+	err := s.Register(mustParse(t, `{"id":"t","version":"v1","effective_from":"2026-02-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1"}]}`))
+	assert.ErrorContains(t, err, "duplicate version")
+
+	err = s.Register(mustParse(t, `{"id":"t","version":"v2","effective_from":"2026-01-01T00:00:00Z","currency":"LKR","items":[{"code":"A","amount":"1"}]}`))
+	assert.ErrorContains(t, err, "share effective_from")
+
+	assert.Error(t, s.Register(&Table{ID: "raw"}), "tables must come from Parse")
+}
@@ -0,0 +1,69 @@
+package fees
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// PreviewRequest describes a hypothetical consignment to price.
+type PreviewRequest struct {
+	// Inputs are the step inputs the table's expressions see, e.g.
+	// {"hs_code": "0902.10", "quantity": 40, "flow": "EXPORT"}.
+	Inputs map[string]any `json:"inputs"`
+	// At selects the table version in force at that time. Defaults to now.
+	At *time.Time `json:"at,omitempty"`
+}
+
+// HTTPHandler serves fee administration endpoints.
+type HTTPHandler struct {
+	schedule *Schedule
+	now      func() time.Time
+}
+
+// NewHTTPHandler creates a handler over schedule.
+func NewHTTPHandler(schedule *Schedule) *HTTPHandler {
+	return &HTTPHandler{schedule: schedule, now: time.Now}
+}
+
+// HandlePreview handles POST /api/v1/admin/fees/{tableId}/preview.
+// Returns the Quote the table would produce for the given inputs.
+func (h *HTTPHandler) HandlePreview(w http.ResponseWriter, r *http.Request) {
+	tableID := r.PathValue("tableId")
+	if tableID == "" {
+		http.Error(w, "table ID is required in URL", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB limit
+	var req PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	at := h.now()
+	if req.At != nil {
+		at = *req.At
+	}
+
+	quote, err := h.schedule.Quote(tableID, at, req.Inputs)
+	switch {
+	case errors.Is(err, ErrTableNotFound):
+		http.Error(w, "fee table not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrEvaluation):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to preview fee", "table", tableID, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(quote); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
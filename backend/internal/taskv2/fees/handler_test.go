@@ -0,0 +1,58 @@
+package fees
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func servePreview(t *testing.T, tableID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	s := NewSchedule()
+	require.NoError(t, s.Register(mustParse(t, teaExportFees)))
+	h := NewHTTPHandler(s)
+	h.now = func() time.Time { return time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/admin/fees/{tableId}/preview", h.HandlePreview)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/fees/"+tableID+"/preview", strings.NewReader(body)))
+	return rec
+}
+
+func TestHandlePreview(t *testing.T) {
+	rec := servePreview(t, "tea_export_fee", `{"inputs":{"quantity":4,"flow":"IMPORT","hs_code":"0902","declared_value":1000}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var q Quote
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &q))
+	assert.Equal(t, "2026.1", q.Version)
+	assert.Len(t, q.Items, 2)
+	assert.Equal(t, "1550", q.Total.String())
+}
+
+func TestHandlePreview_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		tableID string
+		body    string
+		want    int
+	}{
+		{"unknown table", "nope", `{"inputs":{}}`, http.StatusNotFound},
+		{"before first version", "tea_export_fee", `{"inputs":{},"at":"2025-01-01T00:00:00Z"}`, http.StatusNotFound},
+		{"bad body", "tea_export_fee", `{`, http.StatusBadRequest},
+		{"missing input", "tea_export_fee", `{"inputs":{}}`, http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := servePreview(t, tc.tableID, tc.body)
+			assert.Equal(t, tc.want, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -8,10 +8,15 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/OpenNSW/core/authn"
 	"github.com/OpenNSW/nsw-task-flow/orchestrator"
 	tfstore "github.com/OpenNSW/nsw-task-flow/store"
 
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
 	"github.com/OpenNSW/nsw/backend/internal/taskv2/renderer"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 )
 
 // TaskFetcher is the narrow surface HandleGetTask needs from the task store.
@@ -19,28 +24,57 @@ type TaskFetcher interface {
 	GetTask(ctx context.Context, taskID string) (tfstore.TaskRecord, bool)
 }
 
+// TaskAuthorizer decides whether the caller on ctx may act on a task.
+// *authz.TaskPolicy satisfies it; errors are authz sentinels (or wrap them)
+// and are rendered with authz.WriteError.
+type TaskAuthorizer interface {
+	AuthorizeTask(ctx context.Context, taskID string) error
+}
+
+// Outcomes of a submitted step, recorded with it on the timeline.
+const (
+	SubmissionApplied = "APPLIED"
+	SubmissionFailed  = "FAILED"
+)
+
+// EventRecorder appends consignment timeline events. *timeline.Recorder
+// satisfies it.
+type EventRecorder interface {
+	Record(ctx context.Context, events ...timeline.Event) error
+}
+
 type HTTPHandler struct {
 	Manager   *orchestrator.TaskManager
 	Store     TaskFetcher
 	Assembler *renderer.ZoneViewAssembler
+	Authz     TaskAuthorizer
+	// Events, when set, records submitted steps on the consignment timeline.
+	Events EventRecorder
+	// Inbox serves the task listing of HandleListTasks.
+	Inbox *Inbox
+	// Queue, when set, serves the agency review queue and enforces its
+	// assignments on OGA decisions.
+	Queue *ReviewQueue
 }
 
-func NewHTTPHandler(manager *orchestrator.TaskManager, store TaskFetcher, assembler *renderer.ZoneViewAssembler) *HTTPHandler {
-	return &HTTPHandler{Manager: manager, Store: store, Assembler: assembler}
+func NewHTTPHandler(manager *orchestrator.TaskManager, store TaskFetcher, assembler *renderer.ZoneViewAssembler, authorizer TaskAuthorizer) *HTTPHandler {
+	return &HTTPHandler{Manager: manager, Store: store, Assembler: assembler, Authz: authorizer}
 }
 
 // HandleGetTask returns the ZoneView payload for a single task.
 //
 //	GET /api/v1/tasks/{id}
 func (h *HTTPHandler) HandleGetTask(w http.ResponseWriter, r *http.Request) {
-	// TODO: retrieve the authenticated context and validate it against the
-	// task's ownership bounds before returning ZoneView.
 	taskID := r.PathValue("id")
 	if taskID == "" {
 		writeJSONError(w, http.StatusBadRequest, "task id is required")
 		return
 	}
 
+	if !h.authorizeTask(w, r, taskID) {
+		return
+	}
+
 	record, ok := h.Store.GetTask(r.Context(), taskID)
 	if !ok {
 		writeJSONError(w, http.StatusNotFound, "task not found")
@@ -62,8 +96,6 @@ func (h *HTTPHandler) HandleGetTask(w http.ResponseWriter, r *http.Request) {
 //	POST /api/v1/tasks/{id}
 //	body: arbitrary JSON object — passed through to the task plugin
 func (h *HTTPHandler) HandleCompleteTaskStep(w http.ResponseWriter, r *http.Request) {
-	// TODO: retrieve the authenticated context and validate it against the
-	// task's ownership bounds before completing the step.
 	taskID := r.PathValue("id")
 
 	var payload map[string]any
@@ -91,17 +123,124 @@ func (h *HTTPHandler) HandleCompleteTaskStep(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if !h.authorizeTask(w, r, taskID) {
+		return
+	}
+	submission, recordable := h.submissionEvent(r.Context(), taskID, payload)
 	payload = unwrapOGACallback(payload)
 
-	if err := h.Manager.CompleteTaskStep(r.Context(), taskID, payload); err != nil {
-		slog.Error("taskv2: failed to complete task step", "taskId", taskID, "error", err)
+	// The review queue checks the assignment before the step, refusing it
+	// without calling completeStep, and records the deciding officer after.
+	applied := false
+	var stepErr error
+	completeStep := func() error {
+		applied = true
+		stepErr = h.Manager.CompleteTaskStep(r.Context(), taskID, payload)
+		return stepErr
+	}
+	var err error
+	if h.Queue != nil {
+		err = h.Queue.Decide(r.Context(), taskID, completeStep)
+	} else {
+		err = completeStep()
+	}
+	if applied && recordable {
+		h.recordSubmission(r.Context(), submission, stepErr)
+	}
+	switch {
+	case !applied:
+		writeQueueError(w, "check assignment", err)
+		return
+	case stepErr != nil:
+		slog.Error("taskv2: failed to complete task step", "taskId", taskID, "error", stepErr)
 		writeJSONError(w, http.StatusInternalServerError, "An internal error occurred while processing the task")
 		return
+	case err != nil:
+		// The step is applied and cannot be taken back; only its officer is lost.
+		slog.Error("taskv2: deciding officer not recorded", "taskId", taskID, "error", err)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// authorizeTask enforces the task ownership policy for the caller. On denial
+// it writes the authz error response and returns false.
+func (h *HTTPHandler) authorizeTask(w http.ResponseWriter, r *http.Request, taskID string) bool {
+	if h.Authz == nil {
+		slog.Error("taskv2: task authorizer is not configured", "taskId", taskID)
+		writeJSONError(w, http.StatusInternalServerError, "An internal error occurred while authorizing the request")
+		return false
+	}
+	if err := h.Authz.AuthorizeTask(r.Context(), taskID); err != nil {
+		authz.WriteError(w, err)
+		return false
+	}
+	return true
+}
+
+// submissionEvent is the timeline event of a step submitted on taskID: an OGA
+// callback when it comes from a machine client or in the OGA envelope, and a
+// trader command otherwise. It is built from the task as it was before the step. ok is false
+// when there is nothing to record it with or no task to record it on.
+func (h *HTTPHandler) submissionEvent(ctx context.Context, taskID string, payload map[string]any) (event timeline.Event, ok bool) {
+	if h.Events == nil {
+		return timeline.Event{}, false
+	}
+	record, ok := h.Store.GetTask(ctx, taskID)
+	if !ok {
+		return timeline.Event{}, false
+	}
+	event = timeline.Event{
+		ConsignmentID: store.RootWorkflowID(record.ParentWorkflowID),
+		Type:          timeline.CommandSubmitted,
+		TaskID:        taskID,
+		Details:       map[string]any{},
+	}
+	authCtx := authn.GetAuthContext(ctx)
+	if authCtx != nil && authCtx.User != nil {
+		event.Actor = authCtx.User.ID
+	} else if authCtx != nil && authCtx.Client != nil {
+		event.Actor = authCtx.Client.ClientID
+	}
+	if (authCtx != nil && authCtx.User == nil && authCtx.Client != nil) || isOGACallback(payload) {
+		event.Type = timeline.OGACallbackReceived
+		if serviceID, ok := record.Data[plugins.DispatchedServiceIDKey].(string); ok {
+			event.Details["serviceId"] = serviceID
+		}
+		if envelope, ok := payload["payload"].(map[string]any); ok && envelope["action"] != nil {
+			event.Details["action"] = envelope["action"]
+		}
+	} else if action, ok := payload["action"].(string); ok {
+		event.Details["action"] = action
+	}
+	return event, true
+}
+
+// recordSubmission puts a submitted step on its consignment's timeline once
+// it has been applied, with its outcome: APPLIED, or FAILED when stepErr
+// reports the step was not. Failures are logged and never fail the request.
+func (h *HTTPHandler) recordSubmission(ctx context.Context, event timeline.Event, stepErr error) {
+	event.Details["outcome"] = SubmissionApplied
+	if stepErr != nil {
+		event.Details["outcome"] = SubmissionFailed
+	}
+	if err := h.Events.Record(ctx, event); err != nil {
+		slog.Error("taskv2: failed to record task step submission", "taskId", event.TaskID, "error", err)
+	}
+}
+
+// isOGACallback reports whether payload is OGA's legacy TaskResponse envelope.
+func isOGACallback(payload map[string]any) bool {
+	_, hasTaskID := payload["task_id"]
+	_, hasConsignmentID := payload["consignment_id"]
+	envelope, ok := payload["payload"].(map[string]any)
+	if !hasTaskID || !hasConsignmentID || !ok {
+		return false
+	}
+	_, ok = envelope["content"].(map[string]any)
+	return ok
+}
+
 // unwrapOGACallback detects OGA's legacy TaskResponse envelope and returns the
 // reviewer payload that the task plugin actually expects.
 //
@@ -116,23 +255,11 @@ func (h *HTTPHandler) HandleCompleteTaskStep(w http.ResponseWriter, r *http.Requ
 // payload directly to /api/v1/tasks/{id} (or to a dedicated /oga-callback
 // route that owns this translation).
 func unwrapOGACallback(payload map[string]any) map[string]any {
-	if payload == nil {
-		return payload
-	}
-	if _, hasTaskID := payload["task_id"]; !hasTaskID {
-		return payload
-	}
-	if _, hasConsignmentID := payload["consignment_id"]; !hasConsignmentID {
-		return payload
-	}
-	envelope, ok := payload["payload"].(map[string]any)
-	if !ok {
-		return payload
-	}
-	content, ok := envelope["content"].(map[string]any)
-	if !ok {
+	if !isOGACallback(payload) {
 		return payload
 	}
+	envelope := payload["payload"].(map[string]any)
+	content := envelope["content"].(map[string]any)
 	slog.Info("taskv2: unwrapped OGA callback envelope", "action", envelope["action"])
 	return content
 }
@@ -0,0 +1,35 @@
+package taskv2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
+)
+
+type recordedEvents []timeline.Event
+
+func (r *recordedEvents) Record(_ context.Context, events ...timeline.Event) error {
+	*r = append(*r, events...)
+	return nil
+}
+
+func TestRecordSubmission_RecordsTheOutcome(t *testing.T) {
+	events := &recordedEvents{}
+	h := &HTTPHandler{Events: events}
+	submission := func() timeline.Event {
+		return timeline.Event{ConsignmentID: "cons-1", Type: timeline.CommandSubmitted, TaskID: "task-1",
+			Details: map[string]any{"action": "SUBMIT"}}
+	}
+
+	h.recordSubmission(context.Background(), submission(), nil)
+	h.recordSubmission(context.Background(), submission(), errors.New("task is not awaiting input"))
+
+	require.Len(t, *events, 2)
+	assert.Equal(t, map[string]any{"action": "SUBMIT", "outcome": SubmissionApplied}, (*events)[0].Details)
+	assert.Equal(t, map[string]any{"action": "SUBMIT", "outcome": SubmissionFailed}, (*events)[1].Details)
+}
@@ -0,0 +1,231 @@
+package taskv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/pkg/pagination"
+)
+
+// Task types each audience acts on: traders and CHAs fill in forms and pay,
+// OGAs review.
+var (
+	traderTaskTypes = []string{plugins.TaskTypeUserInput, plugins.TaskTypePayment}
+	reviewTaskTypes = []string{plugins.TaskTypeExternalReview}
+)
+
+// errInvalidInboxFilter marks a filter the caller's audience cannot use.
+var errInvalidInboxFilter = errors.New("invalid task inbox filter")
+
+// TaskLister lists open tasks. *store.GormTaskStore satisfies it.
+type TaskLister interface {
+	ListTasks(ctx context.Context, q store.TaskQuery) ([]tfstore.TaskRecord, int64, error)
+}
+
+// TaskAudiences resolves the caller on ctx to the tasks it may act on.
+// *authz.TaskPolicy satisfies it; errors are authz sentinels.
+type TaskAudiences interface {
+	Audience(ctx context.Context) (authz.TaskAudience, error)
+}
+
+// OwnerCompanies resolves a trader or CHA OU handle to the company that owns
+// consignments. consignment.Service satisfies it.
+type OwnerCompanies interface {
+	OwnerCompanyID(ctx context.Context, ouHandle string) (string, error)
+}
+
+// CommandSource reports the commands legal in a task's current state.
+// *renderer.ZoneViewAssembler satisfies it.
+type CommandSource interface {
+	LegalCommands(record tfstore.TaskRecord) ([]string, error)
+}
+
+// InboxFilter narrows a task inbox. MinAge and MaxAge bound how long ago the
+// task was created; zero means unbounded.
+type InboxFilter struct {
+	States        []string
+	TaskTypes     []string
+	ConsignmentID string
+	MinAge        time.Duration
+	MaxAge        time.Duration
+	Offset        *int
+	Limit         *int
+}
+
+// InboxItem is one task of an inbox. AwaitingMe is set when the task waits on
+// the caller: a trader task with commands legal in its state, or a review
+// still queued with the caller's agency.
+type InboxItem struct {
+	TaskID        string    `json:"task_id"`
+	TaskType      string    `json:"task_type"`
+	State         string    `json:"state"`
+	ConsignmentID string    `json:"consignment_id"`
+	ServiceID     string    `json:"service_id,omitempty"`
+	AwaitingMe    bool      `json:"awaiting_me"`
+	LegalCommands []string  `json:"legal_commands"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Inbox lists the open tasks the caller can act on: for traders and CHAs the
+// USER_INPUT and PAYMENT tasks of their company's active consignments, for
+// OGA clients the EXTERNAL_REVIEW tasks dispatched to their agency.
+type Inbox struct {
+	tasks     TaskLister
+	audiences TaskAudiences
+	companies OwnerCompanies
+	commands  CommandSource
+}
+
+// NewInbox builds an Inbox.
+func NewInbox(tasks TaskLister, audiences TaskAudiences, companies OwnerCompanies, commands CommandSource) *Inbox {
+	return &Inbox{tasks: tasks, audiences: audiences, companies: companies, commands: commands}
+}
+
+// List returns a page of the caller's inbox, oldest task first. It returns an
+// authz sentinel when the caller has no audience and an error wrapping
+// errInvalidInboxFilter for a task type outside it.
+func (i *Inbox) List(ctx context.Context, filter InboxFilter) (pagination.Page[InboxItem], error) {
+	audience, err := i.audiences.Audience(ctx)
+	if err != nil {
+		return pagination.Page[InboxItem]{}, err
+	}
+	offset, limit := pagination.ResolvePaginationParams(filter.Offset, filter.Limit)
+	q := store.TaskQuery{
+		States:        filter.States,
+		ConsignmentID: filter.ConsignmentID,
+		Offset:        offset,
+		Limit:         limit,
+	}
+
+	allowed := reviewTaskTypes
+	if audience.OUHandle != "" {
+		allowed = traderTaskTypes
+		if q.OwnerCompanyID, err = i.companies.OwnerCompanyID(ctx, audience.OUHandle); err != nil {
+			return pagination.Page[InboxItem]{}, fmt.Errorf("resolve consignments of %s: %w", audience.OUHandle, err)
+		}
+	} else {
+		q.ServiceID = audience.ServiceID
+	}
+	q.TaskTypes = allowed
+	if len(filter.TaskTypes) > 0 {
+		for _, taskType := range filter.TaskTypes {
+			if !slices.Contains(allowed, taskType) {
+				return pagination.Page[InboxItem]{}, fmt.Errorf("%w: taskType must be one of %v", errInvalidInboxFilter, allowed)
+			}
+		}
+		q.TaskTypes = filter.TaskTypes
+	}
+	now := time.Now()
+	if filter.MinAge > 0 {
+		before := now.Add(-filter.MinAge)
+		q.CreatedBefore = &before
+	}
+	if filter.MaxAge > 0 {
+		after := now.Add(-filter.MaxAge)
+		q.CreatedAfter = &after
+	}
+
+	records, total, err := i.tasks.ListTasks(ctx, q)
+	if err != nil {
+		return pagination.Page[InboxItem]{}, err
+	}
+	items := make([]InboxItem, len(records))
+	for n, record := range records {
+		items[n] = i.item(record, audience)
+	}
+	return pagination.NewPageResult(items, total, offset, limit), nil
+}
+
+func (i *Inbox) item(record tfstore.TaskRecord, audience authz.TaskAudience) InboxItem {
+	commands, err := i.commands.LegalCommands(record)
+	if err != nil {
+		// A task whose render config cannot be read is still listed, with no
+		// commands, so it does not vanish from the inbox.
+		slog.Error("taskv2: failed to read legal commands", "taskId", record.TaskID, "error", err)
+	}
+	if commands == nil {
+		commands = []string{}
+	}
+	serviceID, _ := record.Data[plugins.DispatchedServiceIDKey].(string)
+	awaiting := len(commands) > 0
+	if audience.ServiceID != "" {
+		awaiting = record.State == plugins.StateQueuedExternally
+	}
+	return InboxItem{
+		TaskID:        record.TaskID,
+		TaskType:      record.TaskType,
+		State:         record.State,
+		ConsignmentID: store.RootWorkflowID(record.ParentWorkflowID),
+		ServiceID:     serviceID,
+		AwaitingMe:    awaiting,
+		LegalCommands: commands,
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
+	}
+}
+
+// HandleListTasks returns the caller's task inbox.
+//
+//	GET /api/v1/tasks?state=&taskType=&consignmentId=&minAge=&maxAge=&offset=&limit=
+//
+// state and taskType may be repeated; minAge and maxAge are durations such
+// as 36h.
+func (h *HTTPHandler) HandleListTasks(w http.ResponseWriter, r *http.Request) {
+	if h.Inbox == nil {
+		slog.Error("taskv2: task inbox is not configured")
+		writeJSONError(w, http.StatusInternalServerError, "An internal error occurred while listing tasks")
+		return
+	}
+	offset, limit, err := pagination.ParsePaginationParams(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := r.URL.Query()
+	filter := InboxFilter{
+		States:        query["state"],
+		TaskTypes:     query["taskType"],
+		ConsignmentID: query.Get("consignmentId"),
+		Offset:        offset,
+		Limit:         limit,
+	}
+	for _, p := range []struct {
+		name  string
+		field *time.Duration
+	}{{"minAge", &filter.MinAge}, {"maxAge", &filter.MaxAge}} {
+		value := query.Get(p.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			writeJSONError(w, http.StatusBadRequest, p.name+" must be a non-negative duration such as 36h")
+			return
+		}
+		*p.field = d
+	}
+
+	page, err := h.Inbox.List(r.Context(), filter)
+	switch {
+	case err == nil:
+		writeJSONResponse(w, http.StatusOK, page)
+	case errors.Is(err, errInvalidInboxFilter):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, authz.ErrUnauthenticated), errors.Is(err, authz.ErrForbidden):
+		authz.WriteError(w, err)
+	default:
+		slog.Error("taskv2: failed to list tasks", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "An internal error occurred while listing tasks")
+	}
+}
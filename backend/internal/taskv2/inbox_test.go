@@ -0,0 +1,133 @@
+package taskv2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/renderer"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/pkg/pagination"
+)
+
+type staticAudience struct {
+	audience authz.TaskAudience
+	err      error
+}
+
+func (s staticAudience) Audience(context.Context) (authz.TaskAudience, error) {
+	return s.audience, s.err
+}
+
+type ownerCompanies map[string]string
+
+func (o ownerCompanies) OwnerCompanyID(_ context.Context, ouHandle string) (string, error) {
+	return o[ouHandle], nil
+}
+
+var inboxColumns = []string{"task_id", "task_type", "state", "render_config", "parent_workflow_id", "root_workflow_id", "data", "created_at", "updated_at"}
+
+const userInputRenderConfig = `{"states":{"PENDING_USER":{"actions":[{"command":"SUBMIT"},{"command":"SAVE_DRAFT"}]},"SUBMITTED":{}}}`
+
+func newTestInbox(t *testing.T, audience authz.TaskAudience) (*HTTPHandler, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := setupTestDB(t)
+	inbox := NewInbox(store.NewGormTaskStore(db), staticAudience{audience: audience},
+		ownerCompanies{"trader-ou": "trader-co"}, renderer.NewZoneViewAssembler(nil))
+	return &HTTPHandler{Inbox: inbox}, mock
+}
+
+func listTasks(h *HTTPHandler, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks?"+query, nil)
+	w := httptest.NewRecorder()
+	h.HandleListTasks(w, req)
+	return w
+}
+
+func TestHandleListTasks(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("trader inbox", func(t *testing.T) {
+		h, mock := newTestInbox(t, authz.TaskAudience{OUHandle: "trader-ou"})
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "task_records_v2" JOIN consignments ON consignments.id = task_records_v2.root_workflow_id `+
+			`WHERE task_records_v2.state NOT IN \(\$1,\$2,\$3,\$4\) AND task_records_v2.task_type <> \$5 `+
+			`AND consignments.state IN \(\$6,\$7\) AND \(consignments.trader_company_id = \$8 OR consignments.cha_company_id = \$9\) `+
+			`AND task_records_v2.task_type IN \(\$10,\$11\) AND task_records_v2.created_at <= \$12`).
+			WithArgs("COMPLETED", store.StateFailed, store.StateCancelled, store.StateSuperseded, "SYSTEM",
+				"IN_PROGRESS", "STALLED", "trader-co", "trader-co", "USER_INPUT", "PAYMENT", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery(`SELECT task_records_v2.\* FROM "task_records_v2" JOIN consignments .* ` +
+			`ORDER BY task_records_v2.created_at, task_records_v2.task_id LIMIT \$13`).
+			WillReturnRows(sqlmock.NewRows(inboxColumns).
+				AddRow("task-1", "USER_INPUT", "PENDING_USER", []byte(userInputRenderConfig), "cons-1", "cons-1", []byte(`{}`), created, created).
+				AddRow("task-2", "USER_INPUT", "SUBMITTED", []byte(userInputRenderConfig), "cons-2--amend-1", "cons-2", nil, created, created))
+
+		w := listTasks(h, "minAge=24h")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var page pagination.Page[InboxItem]
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, int64(2), page.Total)
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, InboxItem{
+			TaskID: "task-1", TaskType: "USER_INPUT", State: "PENDING_USER", ConsignmentID: "cons-1",
+			AwaitingMe: true, LegalCommands: []string{"SAVE_DRAFT", "SUBMIT"}, CreatedAt: created, UpdatedAt: created,
+		}, page.Items[0])
+		assert.Equal(t, "cons-2", page.Items[1].ConsignmentID)
+		assert.False(t, page.Items[1].AwaitingMe)
+		assert.Empty(t, page.Items[1].LegalCommands)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("agency inbox", func(t *testing.T) {
+		h, mock := newTestInbox(t, authz.TaskAudience{ServiceID: "fcau"})
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "task_records_v2" WHERE .* AND task_records_v2.data->>'dispatched_service_id' = \$6 `+
+			`AND task_records_v2.task_type IN \(\$7\) AND task_records_v2.state IN \(\$8\) AND task_records_v2.root_workflow_id = \$9`).
+			WithArgs("COMPLETED", store.StateFailed, store.StateCancelled, store.StateSuperseded, "SYSTEM",
+				"fcau", "EXTERNAL_REVIEW", "QUEUED_EXTERNALLY", "cons-1").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(`SELECT task_records_v2.\* FROM "task_records_v2"`).
+			WillReturnRows(sqlmock.NewRows(inboxColumns).
+				AddRow("task-3", "EXTERNAL_REVIEW", "QUEUED_EXTERNALLY", nil, "cons-1", "cons-1",
+					[]byte(`{"dispatched_service_id":"fcau"}`), created, created))
+
+		w := listTasks(h, "state=QUEUED_EXTERNALLY&consignmentId=cons-1")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"service_id":"fcau","awaiting_me":true,"legal_commands":[]`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rejects a task type outside the audience", func(t *testing.T) {
+		h, _ := newTestInbox(t, authz.TaskAudience{OUHandle: "trader-ou"})
+		w := listTasks(h, "taskType=EXTERNAL_REVIEW")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("rejects a malformed age", func(t *testing.T) {
+		h, _ := newTestInbox(t, authz.TaskAudience{OUHandle: "trader-ou"})
+		w := listTasks(h, "maxAge=3d")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("OU handle without a company", func(t *testing.T) {
+		h, mock := newTestInbox(t, authz.TaskAudience{OUHandle: "new-ou"})
+		w := listTasks(h, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"items":[],"total":0,"offset":0,"limit":50}`, w.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("caller without an audience", func(t *testing.T) {
+		db, _ := setupTestDB(t)
+		h := &HTTPHandler{Inbox: NewInbox(store.NewGormTaskStore(db), staticAudience{err: authz.ErrForbidden}, nil, nil)}
+		w := listTasks(h, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,75 @@
+package taskv2
+
+import (
+	"context"
+	"fmt"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+// TaskOwnershipStore is the narrow surface OwnershipResolver needs from the
+// task store: the task record itself and the root workflow (consignment) it
+// was filed under in task_records_v2.
+type TaskOwnershipStore interface {
+	GetTask(ctx context.Context, taskID string) (tfstore.TaskRecord, bool)
+	GetRootWorkflowID(ctx context.Context, taskID string) (string, bool)
+}
+
+// ConsignmentOwners resolves the OU handles of the companies that own a
+// consignment and the e-mail addresses of its assigned CHA.
+// consignment.Service satisfies it.
+type ConsignmentOwners interface {
+	OwnerOUHandles(ctx context.Context, consignmentID string) ([]string, error)
+	AssigneeEmails(ctx context.Context, consignmentID string) ([]string, error)
+}
+
+// OwnershipResolver implements authz.TaskResolver on top of task_records_v2
+// and the consignment domain: task → root_workflow_id (the consignment ID) →
+// owning trader/CHA companies and assigned CHA, plus the service the task was
+// dispatched to.
+type OwnershipResolver struct {
+	store  TaskOwnershipStore
+	owners ConsignmentOwners
+}
+
+// NewOwnershipResolver builds an OwnershipResolver.
+func NewOwnershipResolver(store TaskOwnershipStore, owners ConsignmentOwners) *OwnershipResolver {
+	return &OwnershipResolver{store: store, owners: owners}
+}
+
+// ResolveTask loads the ownership view of taskID. It returns an error wrapping
+// authz.ErrNotFound when the task does not exist.
+func (r *OwnershipResolver) ResolveTask(ctx context.Context, taskID string) (*authz.TaskResource, error) {
+	record, ok := r.store.GetTask(ctx, taskID)
+	if !ok {
+		return nil, fmt.Errorf("task %s: %w", taskID, authz.ErrNotFound)
+	}
+	rootWorkflowID, ok := r.store.GetRootWorkflowID(ctx, taskID)
+	if !ok || rootWorkflowID == "" {
+		return nil, fmt.Errorf("task %s has no root workflow: %w", taskID, authz.ErrNotFound)
+	}
+
+	owners, err := r.owners.OwnerOUHandles(ctx, rootWorkflowID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve owners of task %s: %w", taskID, err)
+	}
+	assignees, err := r.owners.AssigneeEmails(ctx, rootWorkflowID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve assigned CHA of task %s: %w", taskID, err)
+	}
+
+	serviceID, _ := record.Data[plugins.DispatchedServiceIDKey].(string)
+
+	return &authz.TaskResource{
+		TaskID:              record.TaskID,
+		ConsignmentID:       rootWorkflowID,
+		OwnerOUHandles:      owners,
+		AssigneeEmails:      assignees,
+		DispatchedServiceID: serviceID,
+	}, nil
+}
+
+var _ authz.TaskResolver = (*OwnershipResolver)(nil)
@@ -0,0 +1,76 @@
+package taskv2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+// ConsignmentPayers resolves the trader company paying a consignment's fees.
+// consignment.Service satisfies it.
+type ConsignmentPayers interface {
+	PayerName(ctx context.Context, consignmentID string) (string, error)
+}
+
+// TemplateServices maps a subtask template to the remote service (the OGA) it
+// works for. registry.InMemRegistry satisfies it.
+type TemplateServices interface {
+	SubTaskServiceID(subTaskID string) (string, bool)
+}
+
+// ServiceNames names the organization behind a remote service.
+// remote.Manager satisfies it from services.json.
+type ServiceNames interface {
+	ServiceName(serviceID string) string
+}
+
+// PaymentPartyResolver implements paymentsv2.PartyResolver on top of
+// task_records_v2: task → root_workflow_id (the consignment) → trader company,
+// and task → active template → service_id → OGA name.
+type PaymentPartyResolver struct {
+	store     TaskOwnershipStore
+	payers    ConsignmentPayers
+	templates TemplateServices
+	services  ServiceNames
+}
+
+// NewPaymentPartyResolver builds a PaymentPartyResolver.
+func NewPaymentPartyResolver(store TaskOwnershipStore, payers ConsignmentPayers, templates TemplateServices, services ServiceNames) *PaymentPartyResolver {
+	return &PaymentPartyResolver{store: store, payers: payers, templates: templates, services: services}
+}
+
+// ResolveTaskParties names the trader paying taskID's fee and the OGA
+// collecting it. The OGA is the service of the task's active template, or
+// failing that the service the task was last dispatched to; it is named by its
+// services.json name, falling back to the service ID. OGAName is empty when
+// the task has no service.
+func (r *PaymentPartyResolver) ResolveTaskParties(ctx context.Context, taskID string) (*paymentsv2.TaskParties, error) {
+	record, ok := r.store.GetTask(ctx, taskID)
+	if !ok {
+		return nil, fmt.Errorf("task %s not found", taskID)
+	}
+	consignmentID, ok := r.store.GetRootWorkflowID(ctx, taskID)
+	if !ok || consignmentID == "" {
+		return nil, fmt.Errorf("task %s has no root workflow", taskID)
+	}
+
+	trader, err := r.payers.PayerName(ctx, consignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve trader of task %s: %w", taskID, err)
+	}
+
+	serviceID, _ := r.templates.SubTaskServiceID(record.ActiveTaskTemplateID)
+	if serviceID == "" {
+		serviceID, _ = record.Data[plugins.DispatchedServiceIDKey].(string)
+	}
+	ogaName := serviceID
+	if name := r.services.ServiceName(serviceID); serviceID != "" && name != "" {
+		ogaName = name
+	}
+
+	return &paymentsv2.TaskParties{TraderName: trader, OGAName: ogaName}, nil
+}
+
+var _ paymentsv2.PartyResolver = (*PaymentPartyResolver)(nil)
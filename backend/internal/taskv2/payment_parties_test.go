@@ -0,0 +1,116 @@
+package taskv2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/registry"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/pkg/remote"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm: %v", err)
+	}
+	return gormDB, mock
+}
+
+type payerNames map[string]string
+
+func (p payerNames) PayerName(_ context.Context, consignmentID string) (string, error) {
+	name, ok := p[consignmentID]
+	if !ok {
+		return "", errors.New("consignment not found")
+	}
+	return name, nil
+}
+
+func serviceDirectory(t *testing.T) *remote.Manager {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "services.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":"1.0","services":[
+		{"id":"fcau","name":"Food Control Administration Unit","url":"http://localhost:8082"},
+		{"id":"npqs","url":"http://localhost:8081"}]}`), 0o600))
+	m := remote.NewManager()
+	require.NoError(t, m.LoadServices(path))
+	return m
+}
+
+var taskRecordColumns = []string{"task_id", "active_task_template_id", "data", "root_workflow_id"}
+
+func expectTask(mock sqlmock.Sqlmock, taskID, templateID, data, consignmentID string) {
+	mock.ExpectQuery(`SELECT \* FROM "task_records_v2" WHERE task_id = \$1`).
+		WithArgs(taskID, 1).
+		WillReturnRows(sqlmock.NewRows(taskRecordColumns).AddRow(taskID, templateID, []byte(data), consignmentID))
+	mock.ExpectQuery(`SELECT "task_id","root_workflow_id" FROM "task_records_v2" WHERE task_id = \$1`).
+		WithArgs(taskID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"task_id", "root_workflow_id"}).AddRow(taskID, consignmentID))
+}
+
+func TestPaymentPartyResolver_ResolveTaskParties(t *testing.T) {
+	db, mock := setupTestDB(t)
+	reg := registry.NewInMemRegistry()
+	reg.RegisterSubTaskService("fcau_payment", "fcau")
+	reg.RegisterSubTaskService("npqs_payment", "npqs")
+	resolver := NewPaymentPartyResolver(store.NewGormTaskStore(db),
+		payerNames{"cons-1": "Ceylon Spice Exports"}, reg, serviceDirectory(t))
+
+	t.Run("named OGA from the template's service", func(t *testing.T) {
+		expectTask(mock, "task-1", "fcau_payment", `{}`, "cons-1")
+
+		parties, err := resolver.ResolveTaskParties(context.Background(), "task-1")
+		require.NoError(t, err)
+		assert.Equal(t, "Ceylon Spice Exports", parties.TraderName)
+		assert.Equal(t, "Food Control Administration Unit", parties.OGAName)
+	})
+
+	t.Run("unnamed service falls back to its ID", func(t *testing.T) {
+		expectTask(mock, "task-2", "npqs_payment", `{}`, "cons-1")
+
+		parties, err := resolver.ResolveTaskParties(context.Background(), "task-2")
+		require.NoError(t, err)
+		assert.Equal(t, "npqs", parties.OGAName)
+	})
+
+	t.Run("template without a service uses the dispatched service", func(t *testing.T) {
+		expectTask(mock, "task-3", "generic_payment", `{"dispatched_service_id":"fcau"}`, "cons-1")
+
+		parties, err := resolver.ResolveTaskParties(context.Background(), "task-3")
+		require.NoError(t, err)
+		assert.Equal(t, "Food Control Administration Unit", parties.OGAName)
+	})
+
+	t.Run("unknown consignment", func(t *testing.T) {
+		expectTask(mock, "task-4", "fcau_payment", `{}`, "cons-9")
+
+		_, err := resolver.ResolveTaskParties(context.Background(), "task-4")
+		assert.ErrorContains(t, err, "resolve trader of task task-4")
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM "task_records_v2"`).WillReturnError(gorm.ErrRecordNotFound)
+
+		_, err := resolver.ResolveTaskParties(context.Background(), "missing")
+		assert.ErrorContains(t, err, "task missing not found")
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -23,10 +23,26 @@ func NewExternalReviewPlugin(manager *remote.Manager, backendBaseURL string, dev
 	return &ExternalReviewPlugin{client: newDispatchHelper(manager, backendBaseURL, devMode)}
 }
 
+// DispatchedServiceIDKey is the task record Data key under which the
+// service_id of the last external review dispatch is recorded. Task
+// authorization reads it to restrict OGA machine clients to the tasks that
+// were sent to their service.
+const DispatchedServiceIDKey = "dispatched_service_id"
+
+// DispatchedCancelPathKey is the task record Data key under which the
+// service's cancel_path is recorded at dispatch. A consignment cancelled while
+// the review is outstanding is reported to the service at that path.
+const DispatchedCancelPathKey = "dispatched_cancel_path"
+
+// StateQueuedExternally is the task record state of a review that has been
+// dispatched and awaits the OGA's decision.
+const StateQueuedExternally = "QUEUED_EXTERNALLY"
+
 type externalReviewConfig struct {
-	ServiceID string `json:"service_id"`
-	Path      string `json:"path"`
-	TaskCode  string `json:"task_code,omitempty"`
+	ServiceID  string `json:"service_id"`
+	Path       string `json:"path"`
+	TaskCode   string `json:"task_code,omitempty"`
+	CancelPath string `json:"cancel_path,omitempty"`
 }
 
 // Execute persists the reviewer form ID + QUEUED_EXTERNALLY status, then
@@ -45,7 +61,14 @@ func (p *ExternalReviewPlugin) Execute(ctx pluginContext, configRaw json.RawMess
 		return fmt.Errorf("external_review: path is required")
 	}
 
-	ctx.Record.State = "QUEUED_EXTERNALLY"
+	ctx.Record.State = StateQueuedExternally
+	if ctx.Record.Data == nil {
+		ctx.Record.Data = make(map[string]any)
+	}
+	ctx.Record.Data[DispatchedServiceIDKey] = cfg.ServiceID
+	if cfg.CancelPath != "" {
+		ctx.Record.Data[DispatchedCancelPathKey] = cfg.CancelPath
+	}
 
 	// Convention: if input_mapping placed a value under the reserved key
 	// "submission", that value is the wire shape OGA sees. Otherwise the
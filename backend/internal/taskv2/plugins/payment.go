@@ -6,29 +6,52 @@ import (
 	"log/slog"
 	"time"
 
-	"github.com/OpenNSW/nsw/backend/internal/payments"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/fees"
 	"github.com/shopspring/decimal"
 )
 
+// RetryPaymentCommand is the command that abandons a task's pending payment
+// attempt and re-issues checkout under a fresh reference. Re-entering the step
+// after a failed or expired attempt retries without it.
+const RetryPaymentCommand = "retry_payment"
+
 // PaymentPlugin implements a custom generic_payment plugin for taskv2.
 // It initiates a checkout session with the payment service and transitions
-// the task record state to PENDING_PAYMENT.
+// the task record state to PENDING_PAYMENT. Each checkout is a new attempt on
+// the task; see RetryPaymentCommand.
+//
+// In cart mode the fee is instead added to the consignment's payment cart and
+// the task waits in PENDING_PAYMENT until the trader checks the cart out and
+// pays every carted fee under one reference.
 type PaymentPlugin struct {
-	paymentService payments.PaymentService
+	paymentService paymentsv2.PaymentService
+	feeSchedule    *fees.Schedule
 }
 
-// NewPaymentPlugin creates a new PaymentPlugin.
-func NewPaymentPlugin(paymentService payments.PaymentService) *PaymentPlugin {
+// NewPaymentPlugin creates a new PaymentPlugin. feeSchedule prices tasks that
+// name a fee_table; it may be nil if none do.
+func NewPaymentPlugin(paymentService paymentsv2.PaymentService, feeSchedule *fees.Schedule) *PaymentPlugin {
 	return &PaymentPlugin{
 		paymentService: paymentService,
+		feeSchedule:    feeSchedule,
 	}
 }
 
+// paymentConfig prices a task either from a fee table evaluated over the step
+// inputs (fee_table) or, for simple flat fees, from a fixed amount and currency.
 type paymentConfig struct {
 	TaskCode    string          `json:"task_code"`
 	ServiceName string          `json:"service_name"`
+	FeeTable    string          `json:"fee_table"`
 	Amount      decimal.Decimal `json:"amount"`
 	Currency    string          `json:"currency"`
+	// OrgName is the OGA collecting the fee, shown on the payment page and
+	// printed on the receipt.
+	OrgName string `json:"org_name"`
+	// Cart adds the fee to the consignment's payment cart instead of opening
+	// a checkout for this task alone.
+	Cart bool `json:"cart"`
 }
 
 func (p *PaymentPlugin) Execute(ctx pluginContext, configRaw json.RawMessage) error {
@@ -37,11 +60,17 @@ func (p *PaymentPlugin) Execute(ctx pluginContext, configRaw json.RawMessage) er
 		return fmt.Errorf("payment: failed to parse generic_payment config: %w", err)
 	}
 
-	if cfg.Amount.IsZero() {
-		return fmt.Errorf("payment: plugin_properties.amount is required and must be non-zero")
+	if cfg.FeeTable == "" {
+		if cfg.Amount.IsZero() {
+			return fmt.Errorf("payment: plugin_properties.amount is required and must be non-zero")
+		}
+		if cfg.Currency == "" {
+			return fmt.Errorf("payment: plugin_properties.currency is required")
+		}
 	}
-	if cfg.Currency == "" {
-		return fmt.Errorf("payment: plugin_properties.currency is required")
+
+	if cfg.Cart {
+		return p.addToCart(ctx, cfg)
 	}
 
 	// 1. Determine selected payment gateway
@@ -50,30 +79,51 @@ func (p *PaymentPlugin) Execute(ctx pluginContext, configRaw json.RawMessage) er
 		selectedMethod = "lankapay" // Default fallback
 	}
 
-	_, err := p.paymentService.GetPaymentMethod(selectedMethod)
+	_, err := p.paymentService.GetMethod(ctx.Context, selectedMethod)
 	if err != nil {
 		return fmt.Errorf("payment: failed to get payment method %q: %w", selectedMethod, err)
 	}
 
-	// 2. Transition task state to PENDING_PAYMENT
-	ctx.Record.State = "PENDING_PAYMENT"
+	// Re-entry while an attempt is still payable resumes waiting on it unless
+	// the caller explicitly asked for a new reference.
+	latest, err := p.paymentService.GetLatestAttempt(ctx.Context, ctx.Record.TaskID)
+	if err != nil {
+		return fmt.Errorf("payment: failed to get latest payment attempt: %w", err)
+	}
+	command, _ := ctx.Inputs["command"].(string)
+	if latest != nil && latest.Status == paymentsv2.PaymentStatusPending && command != RetryPaymentCommand {
+		slog.Info("taskv2 payment: attempt already pending, resuming",
+			"taskId", ctx.Record.TaskID, "referenceNumber", latest.ReferenceNumber, "attempt", latest.AttemptNo)
+		ctx.Record.State = "PENDING_PAYMENT"
+		return ErrSuspended
+	}
+
+	// 2. Price the task. Fee tables are evaluated on every attempt, so a retry
+	// after a fee change is charged the schedule then in force.
+	amount, currency, quote, err := p.price(cfg, ctx.Inputs)
+	if err != nil {
+		return err
+	}
 
-	amount := cfg.Amount
-	currency := cfg.Currency
+	// 3. Transition task state to PENDING_PAYMENT
+	ctx.Record.State = "PENDING_PAYMENT"
 
 	slog.Info("taskv2 payment: initiating checkout session",
 		"taskId", ctx.Record.TaskID, "taskCode", cfg.TaskCode, "amount", amount, "method", selectedMethod)
 
-	// 5. Create checkout session in payments.PaymentService to register transaction
-	resp, err := p.paymentService.CreateCheckoutSession(ctx.Context, payments.CreateCheckoutRequest{
-		ReferenceNumber: "", // Empty string instructs the service to generate a unique TNSW- reference
-		Amount:          amount,
-		Currency:        currency,
-		ExpiresAt:       time.Now().Add(24 * time.Hour), // Aligned with typical TTL
+	// 4. Create checkout session on the selected gateway; the service generates
+	// the unique TNSW reference and persists the transaction before the gateway call.
+	resp, err := p.paymentService.CreateCheckoutSession(ctx.Context, paymentsv2.CreateCheckoutRequest{
+		GatewayID: selectedMethod,
+		Amount:    amount,
+		Currency:  currency,
+		ExpiresAt: time.Now().Add(24 * time.Hour), // Aligned with typical TTL
 		Metadata: map[string]string{
-			"task_id":   ctx.Record.TaskID,
-			"task_code": cfg.TaskCode,
-			"method_id": selectedMethod,
+			"task_id":        ctx.Record.TaskID,
+			"task_code":      cfg.TaskCode,
+			"method_id":      selectedMethod,
+			"consignment_id": rootWorkflowID(ctx.Record.ParentWorkflowID),
+			"oga_name":       cfg.OrgName,
 		},
 	})
 	if err != nil {
@@ -81,9 +131,10 @@ func (p *PaymentPlugin) Execute(ctx pluginContext, configRaw json.RawMessage) er
 	}
 
 	slog.Info("taskv2 payment: checkout session registered",
-		"taskId", ctx.Record.TaskID, "sessionId", resp.SessionID, "referenceNumber", resp.ReferenceNumber, "method", selectedMethod)
+		"taskId", ctx.Record.TaskID, "sessionId", resp.SessionID, "referenceNumber", resp.ReferenceNumber,
+		"attempt", resp.AttemptNo, "method", selectedMethod)
 
-	// 6. Populate payment info under the active output namespace
+	// 5. Populate payment info under the active output namespace
 	if ctx.Record.ActiveOutputNamespace != "" {
 		if ctx.Record.Data == nil {
 			ctx.Record.Data = make(map[string]any)
@@ -95,19 +146,116 @@ func (p *PaymentPlugin) Execute(ctx pluginContext, configRaw json.RawMessage) er
 		}
 
 		pData := map[string]any{
+			"task_id":          ctx.Record.TaskID,
+			"attempt_no":       resp.AttemptNo,
 			"session_id":       resp.SessionID,
 			"reference_number": resp.ReferenceNumber,
 			"amount":           amount.String(),
 			"currency":         currency,
 			"selected_method":  selectedMethod,
 			"checkout_url":     resp.CheckoutURL,
+			"checkout_type":    string(resp.Type),
+			"instructions":     resp.Instructions,
 			"service_name":     serviceName,
 			"service_type":     cfg.TaskCode,
+			"org_name":         cfg.OrgName,
 		}
 
+		addQuote(pData, quote)
 		ctx.Record.Data[ctx.Record.ActiveOutputNamespace] = pData
 	}
 
 	// Suspend the workflow until LankaPay/webhook callback arrives
 	return ErrSuspended
 }
+
+// addToCart puts the task's fee into its consignment's payment cart and
+// suspends the task until the cart is paid. Re-entering the step re-prices an
+// item still in the cart and keeps waiting on one already checked out.
+func (p *PaymentPlugin) addToCart(ctx pluginContext, cfg paymentConfig) error {
+	amount, currency, quote, err := p.price(cfg, ctx.Inputs)
+	if err != nil {
+		return err
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "Payment"
+	}
+	consignmentID := rootWorkflowID(ctx.Record.ParentWorkflowID)
+	item, err := p.paymentService.AddToCart(ctx.Context, paymentsv2.AddToCartRequest{
+		ConsignmentID: consignmentID,
+		TaskID:        ctx.Record.TaskID,
+		TaskCode:      cfg.TaskCode,
+		Description:   serviceName,
+		OGAName:       cfg.OrgName,
+		Amount:        amount,
+		Currency:      currency,
+	})
+	if err != nil {
+		return fmt.Errorf("payment: failed to add fee to payment cart: %w", err)
+	}
+
+	slog.Info("taskv2 payment: fee added to payment cart",
+		"taskId", ctx.Record.TaskID, "consignmentId", consignmentID, "lineItemId", item.ID, "amount", item.Amount, "status", item.Status)
+	ctx.Record.State = "PENDING_PAYMENT"
+
+	if ctx.Record.ActiveOutputNamespace != "" {
+		if ctx.Record.Data == nil {
+			ctx.Record.Data = make(map[string]any)
+		}
+		pData := map[string]any{
+			"task_id":        ctx.Record.TaskID,
+			"cart":           true,
+			"consignment_id": consignmentID,
+			"line_item_id":   item.ID,
+			"amount":         item.Amount.String(),
+			"currency":       item.Currency,
+			"service_name":   serviceName,
+			"service_type":   cfg.TaskCode,
+			"org_name":       cfg.OrgName,
+		}
+		addQuote(pData, quote)
+		ctx.Record.Data[ctx.Record.ActiveOutputNamespace] = pData
+	}
+
+	// Suspend until the payment service completes the step for the paid cart.
+	return ErrSuspended
+}
+
+// price returns the task's fee: from its fee table, evaluated over inputs,
+// or the fixed amount and currency. quote is nil for a fixed fee.
+func (p *PaymentPlugin) price(cfg paymentConfig, inputs map[string]any) (decimal.Decimal, string, *fees.Quote, error) {
+	if cfg.FeeTable == "" {
+		return cfg.Amount, cfg.Currency, nil, nil
+	}
+	if p.feeSchedule == nil {
+		return decimal.Zero, "", nil, fmt.Errorf("payment: fee_table %q configured but no fee schedule loaded", cfg.FeeTable)
+	}
+	quote, err := p.feeSchedule.Quote(cfg.FeeTable, time.Now(), inputs)
+	if err != nil {
+		return decimal.Zero, "", nil, fmt.Errorf("payment: failed to compute fee: %w", err)
+	}
+	if !quote.Total.IsPositive() {
+		return decimal.Zero, "", nil, fmt.Errorf("payment: fee_table %q computed a zero fee", cfg.FeeTable)
+	}
+	return quote.Total, quote.Currency, quote, nil
+}
+
+// addQuote records a fee table quote's line items in the step output.
+func addQuote(pData map[string]any, quote *fees.Quote) {
+	if quote == nil {
+		return
+	}
+	breakdown := make([]map[string]any, 0, len(quote.Items))
+	for _, item := range quote.Items {
+		breakdown = append(breakdown, map[string]any{
+			"code":        item.Code,
+			"description": item.Description,
+			"amount":      item.Amount.StringFixed(2),
+		})
+	}
+	pData["fee_breakdown"] = breakdown
+	pData["fee_table"] = quote.TableID
+	pData["fee_table_version"] = quote.Version
+}
@@ -4,53 +4,122 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/OpenNSW/nsw-task-flow/store"
-	"github.com/OpenNSW/nsw/backend/internal/payments"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/fees"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockPaymentService struct {
-	createCheckoutSessionFunc func(ctx context.Context, req payments.CreateCheckoutRequest) (*payments.CreateCheckoutResponse, error)
-	getPaymentMethodFunc      func(id string) (*payments.PaymentMethod, error)
+	createCheckoutSessionFunc func(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error)
+	getMethodFunc             func(id string) (*paymentsv2.PaymentMethod, error)
+	latestAttempt             *paymentsv2.PaymentTransaction
+	requestRefundFunc         func(req paymentsv2.RefundRequest) (*paymentsv2.Refund, error)
+	addToCartFunc             func(req paymentsv2.AddToCartRequest) (*paymentsv2.PaymentLineItem, error)
 }
 
-func (m *mockPaymentService) CreateCheckoutSession(ctx context.Context, req payments.CreateCheckoutRequest) (*payments.CreateCheckoutResponse, error) {
+func (m *mockPaymentService) ListAvailableMethods(ctx context.Context) ([]paymentsv2.GatewayInfo, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) GetMethod(ctx context.Context, id string) (*paymentsv2.PaymentMethod, error) {
+	if m.getMethodFunc != nil {
+		return m.getMethodFunc(id)
+	}
+	return &paymentsv2.PaymentMethod{
+		GatewayInfo: paymentsv2.GatewayInfo{ID: id, IsActive: true, RenderInfo: paymentsv2.RenderInfo{Template: "# Mock Template"}},
+		Type:        gateways.FlowTypeRedirect,
+	}, nil
+}
+
+func (m *mockPaymentService) CreateCheckoutSession(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
 	if m.createCheckoutSessionFunc != nil {
 		return m.createCheckoutSessionFunc(ctx, req)
 	}
 	return nil, errors.New("unimplemented")
 }
 
-func (m *mockPaymentService) ValidateReference(ctx context.Context, req payments.ValidateReferenceRequest) (*payments.ValidateReferenceResponse, error) {
+func (m *mockPaymentService) GetLatestAttempt(ctx context.Context, taskID string) (*paymentsv2.PaymentTransaction, error) {
+	return m.latestAttempt, nil
+}
+
+func (m *mockPaymentService) ListAttempts(ctx context.Context, taskID string) ([]paymentsv2.PaymentTransaction, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) ValidateReference(ctx context.Context, gatewayID string, rawBody json.RawMessage) (*gateways.ValidationResponse, error) {
 	return nil, nil
 }
 
-func (m *mockPaymentService) ProcessWebhook(ctx context.Context, payload payments.WebhookPayload) error {
+func (m *mockPaymentService) ProcessWebhook(ctx context.Context, gatewayID string, req gateways.WebhookRequest) error {
 	return nil
 }
 
-func (m *mockPaymentService) SetTaskCompleter(completer payments.TaskCompleter) {}
+func (m *mockPaymentService) ExpireOverdue(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (m *mockPaymentService) RedriveTaskSteps(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
 
-func (m *mockPaymentService) GetPaymentMethod(id string) (*payments.PaymentMethod, error) {
-	if m.getPaymentMethodFunc != nil {
-		return m.getPaymentMethodFunc(id)
+func (m *mockPaymentService) RequestRefund(_ context.Context, req paymentsv2.RefundRequest) (*paymentsv2.Refund, error) {
+	if m.requestRefundFunc != nil {
+		return m.requestRefundFunc(req)
 	}
-	return &payments.PaymentMethod{
-		ID:         id,
-		IsActive:   true,
-		Type:       "REDIRECT",
-		GatewayURL: "https://sandbox.govpay.lk/checkout",
-		Template:   "# Mock Template",
-	}, nil
+	return nil, errors.New("unimplemented")
 }
 
+func (m *mockPaymentService) CompleteRefund(context.Context, string, paymentsv2.RefundResult) (*paymentsv2.Refund, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) ListRefunds(context.Context, paymentsv2.RefundStatus) ([]paymentsv2.Refund, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) AddToCart(_ context.Context, req paymentsv2.AddToCartRequest) (*paymentsv2.PaymentLineItem, error) {
+	if m.addToCartFunc != nil {
+		return m.addToCartFunc(req)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *mockPaymentService) GetCart(context.Context, string) (*paymentsv2.Cart, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) CheckoutCart(context.Context, paymentsv2.CartCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) HandleReturn(context.Context, string, url.Values) (string, error) {
+	return "", nil
+}
+
+func (m *mockPaymentService) GetReceiptDownloadURL(context.Context, string) (string, error) {
+	return "", nil
+}
+
+func (m *mockPaymentService) VerifyReceipt(context.Context, string) (*paymentsv2.ReceiptVerification, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) SetReceipts(paymentsv2.ReceiptConfig)      {}
+func (m *mockPaymentService) SetPartyResolver(paymentsv2.PartyResolver) {}
+
+func (m *mockPaymentService) SetTaskCompleter(completer paymentsv2.TaskCompleter) {}
+
 func TestPaymentPlugin_Execute(t *testing.T) {
 	// Setup
 	mockSvc := &mockPaymentService{}
-	plugin := NewPaymentPlugin(mockSvc)
+	plugin := NewPaymentPlugin(mockSvc, nil)
 
 	// Check config
 	configRaw := json.RawMessage(`{"task_code": "fcau_app_fee_payment_v1", "service_name": "Application Fee", "amount": "1500.00", "currency": "LKR"}`)
@@ -61,15 +130,16 @@ func TestPaymentPlugin_Execute(t *testing.T) {
 			ActiveOutputNamespace: "payment",
 		}
 
-		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req payments.CreateCheckoutRequest) (*payments.CreateCheckoutResponse, error) {
-			assert.Equal(t, "", req.ReferenceNumber)
+		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			assert.Equal(t, "lankapay", req.GatewayID)
 			assert.True(t, req.Amount.Equal(decimal.NewFromFloat(1500.00)))
 			assert.Equal(t, "LKR", req.Currency)
 			assert.Equal(t, "test-task-123", req.Metadata["task_id"])
 			assert.Equal(t, "fcau_app_fee_payment_v1", req.Metadata["task_code"])
 
-			return &payments.CreateCheckoutResponse{
+			return &paymentsv2.CreateCheckoutResponse{
 				SessionID:       "mock-session-123",
+				Type:            gateways.FlowTypeRedirect,
 				CheckoutURL:     "https://sandbox.govpay.lk/checkout/mock-session-123",
 				ReferenceNumber: "TNSW-MOCK123",
 			}, nil
@@ -93,6 +163,7 @@ func TestPaymentPlugin_Execute(t *testing.T) {
 		assert.Equal(t, "TNSW-MOCK123", paymentData["reference_number"])
 		assert.Equal(t, "1500", paymentData["amount"])
 		assert.Equal(t, "LKR", paymentData["currency"])
+		assert.Equal(t, "REDIRECT", paymentData["checkout_type"])
 	})
 
 	t.Run("successful execution with explicit reference number", func(t *testing.T) {
@@ -101,9 +172,8 @@ func TestPaymentPlugin_Execute(t *testing.T) {
 			ActiveOutputNamespace: "payment",
 		}
 
-		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req payments.CreateCheckoutRequest) (*payments.CreateCheckoutResponse, error) {
-			assert.Equal(t, "", req.ReferenceNumber)
-			return &payments.CreateCheckoutResponse{
+		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			return &paymentsv2.CreateCheckoutResponse{
 				SessionID:       "mock-session-999",
 				ReferenceNumber: "TNSW-MOCK999",
 			}, nil
@@ -127,20 +197,20 @@ func TestPaymentPlugin_Execute(t *testing.T) {
 			ActiveOutputNamespace: "payment",
 		}
 
-		mockSvc.getPaymentMethodFunc = func(id string) (*payments.PaymentMethod, error) {
+		mockSvc.getMethodFunc = func(id string) (*paymentsv2.PaymentMethod, error) {
 			assert.Equal(t, "govpay", id)
-			return &payments.PaymentMethod{
-				ID:       id,
-				IsActive: true,
-				Type:     "INFO",
-				Template: "Pay LKR {{ .Amount }} for {{ .ReferenceNumber }}",
+			return &paymentsv2.PaymentMethod{
+				GatewayInfo: paymentsv2.GatewayInfo{ID: id, IsActive: true, RenderInfo: paymentsv2.RenderInfo{Template: "Pay LKR {{ .Amount }} for {{ .ReferenceNumber }}"}},
+				Type:        gateways.FlowTypeInstruction,
 			}, nil
 		}
 
-		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req payments.CreateCheckoutRequest) (*payments.CreateCheckoutResponse, error) {
-			assert.Equal(t, "", req.ReferenceNumber)
-			return &payments.CreateCheckoutResponse{
+		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			assert.Equal(t, "govpay", req.GatewayID)
+			return &paymentsv2.CreateCheckoutResponse{
 				SessionID:       "mock-govpay-session",
+				Type:            gateways.FlowTypeInstruction,
+				Instructions:    "Pay using your bank app.",
 				ReferenceNumber: "TNSW-MOCKGOV",
 			}, nil
 		}
@@ -164,5 +234,182 @@ func TestPaymentPlugin_Execute(t *testing.T) {
 		assert.Equal(t, "Application Fee", paymentData["service_name"])
 		assert.Equal(t, "fcau_app_fee_payment_v1", paymentData["service_type"])
 		assert.Equal(t, "TNSW-MOCKGOV", paymentData["reference_number"])
+		assert.Equal(t, "Pay using your bank app.", paymentData["instructions"])
+	})
+
+	t.Run("unavailable method fails before checkout", func(t *testing.T) {
+		record := store.TaskRecord{TaskID: "test-task-123", ActiveOutputNamespace: "payment"}
+		mockSvc.getMethodFunc = func(id string) (*paymentsv2.PaymentMethod, error) {
+			return nil, paymentsv2.ErrMethodUnavailable
+		}
+		mockSvc.createCheckoutSessionFunc = func(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			t.Fatal("CreateCheckoutSession must not be called for an unavailable method")
+			return nil, nil
+		}
+
+		err := plugin.Execute(pluginContext{Context: context.Background(), Record: &record, Inputs: map[string]any{"selected_method": "retired"}}, configRaw)
+		assert.ErrorIs(t, err, paymentsv2.ErrMethodUnavailable)
+		assert.Empty(t, record.State)
+	})
+}
+
+func TestPaymentPlugin_Execute_Attempts(t *testing.T) {
+	configRaw := json.RawMessage(`{"task_code": "fcau_app_fee_payment_v1", "amount": "1500.00", "currency": "LKR"}`)
+	attempt := func(status paymentsv2.PaymentStatus) *paymentsv2.PaymentTransaction {
+		return &paymentsv2.PaymentTransaction{ReferenceNumber: "TNSWOLD00001", TaskID: "task-1", AttemptNo: 1, Status: status}
+	}
+	newAttempt := func(calls *int) func(context.Context, paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+		return func(context.Context, paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			*calls++
+			return &paymentsv2.CreateCheckoutResponse{ReferenceNumber: "TNSWNEW00002", AttemptNo: 2}, nil
+		}
+	}
+	run := func(svc *mockPaymentService, inputs map[string]any) (*store.TaskRecord, error) {
+		record := &store.TaskRecord{TaskID: "task-1", ActiveOutputNamespace: "payment"}
+		err := NewPaymentPlugin(svc, nil).Execute(pluginContext{Context: context.Background(), Record: record, Inputs: inputs}, configRaw)
+		return record, err
+	}
+
+	t.Run("re-entry with a pending attempt resumes it", func(t *testing.T) {
+		calls := 0
+		svc := &mockPaymentService{latestAttempt: attempt(paymentsv2.PaymentStatusPending)}
+		svc.createCheckoutSessionFunc = newAttempt(&calls)
+
+		record, err := run(svc, map[string]any{"selected_method": "govpay"})
+		assert.ErrorIs(t, err, ErrSuspended)
+		assert.Equal(t, "PENDING_PAYMENT", record.State)
+		assert.Zero(t, calls, "no new reference without retry_payment")
+	})
+
+	t.Run("retry_payment re-issues a pending attempt", func(t *testing.T) {
+		calls := 0
+		svc := &mockPaymentService{latestAttempt: attempt(paymentsv2.PaymentStatusPending)}
+		svc.createCheckoutSessionFunc = newAttempt(&calls)
+
+		record, err := run(svc, map[string]any{"selected_method": "govpay", "command": RetryPaymentCommand})
+		assert.ErrorIs(t, err, ErrSuspended)
+		assert.Equal(t, 1, calls)
+		paymentData := record.Data["payment"].(map[string]any)
+		assert.Equal(t, "TNSWNEW00002", paymentData["reference_number"])
+		assert.Equal(t, 2, paymentData["attempt_no"])
+		assert.Equal(t, "task-1", paymentData["task_id"])
 	})
+
+	for _, status := range []paymentsv2.PaymentStatus{paymentsv2.PaymentStatusFailed, paymentsv2.PaymentStatusExpired} {
+		t.Run("re-entry after "+string(status)+" starts a new attempt", func(t *testing.T) {
+			calls := 0
+			svc := &mockPaymentService{latestAttempt: attempt(status)}
+			svc.createCheckoutSessionFunc = newAttempt(&calls)
+
+			_, err := run(svc, map[string]any{"selected_method": "govpay"})
+			assert.ErrorIs(t, err, ErrSuspended)
+			assert.Equal(t, 1, calls)
+		})
+	}
+
+	t.Run("already paid task is refused", func(t *testing.T) {
+		svc := &mockPaymentService{latestAttempt: attempt(paymentsv2.PaymentStatusSuccess)}
+		svc.createCheckoutSessionFunc = func(context.Context, paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			return nil, paymentsv2.ErrAlreadyPaid
+		}
+
+		_, err := run(svc, map[string]any{"selected_method": "govpay", "command": RetryPaymentCommand})
+		assert.ErrorIs(t, err, paymentsv2.ErrAlreadyPaid)
+	})
+}
+
+func TestPaymentPlugin_Execute_FeeTable(t *testing.T) {
+	table, err := fees.Parse([]byte(`{
+		"id": "fcau_app_fee", "version": "2026.1", "effective_from": "2026-01-01T00:00:00Z", "currency": "LKR",
+		"inputs": { "quantity": "number" },
+		"items": [
+			{ "code": "BASE", "description": "Application fee", "amount": "1000" },
+			{ "code": "PER_UNIT", "description": "Per consignment unit", "when": "quantity > 0", "amount": "quantity * 12.5" }
+		]
+	}`))
+	assert.NoError(t, err)
+	schedule := fees.NewSchedule()
+	assert.NoError(t, schedule.Register(table))
+	configRaw := json.RawMessage(`{"task_code": "fcau_app_fee_payment_v1", "fee_table": "fcau_app_fee"}`)
+
+	t.Run("prices the task from the fee table", func(t *testing.T) {
+		var got paymentsv2.CreateCheckoutRequest
+		svc := &mockPaymentService{createCheckoutSessionFunc: func(_ context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			got = req
+			return &paymentsv2.CreateCheckoutResponse{ReferenceNumber: "TNSW00000001", AttemptNo: 1}, nil
+		}}
+		record := &store.TaskRecord{TaskID: "task-1", ActiveOutputNamespace: "payment"}
+
+		err := NewPaymentPlugin(svc, schedule).Execute(pluginContext{Context: context.Background(), Record: record, Inputs: map[string]any{"selected_method": "govpay", "quantity": 4}}, configRaw)
+		assert.ErrorIs(t, err, ErrSuspended)
+		assert.Equal(t, "1050", got.Amount.String())
+		assert.Equal(t, "LKR", got.Currency)
+
+		paymentData := record.Data["payment"].(map[string]any)
+		assert.Equal(t, "1050", paymentData["amount"])
+		assert.Equal(t, "fcau_app_fee", paymentData["fee_table"])
+		assert.Equal(t, "2026.1", paymentData["fee_table_version"])
+		assert.Equal(t, []map[string]any{
+			{"code": "BASE", "description": "Application fee", "amount": "1000.00"},
+			{"code": "PER_UNIT", "description": "Per consignment unit", "amount": "50.00"},
+		}, paymentData["fee_breakdown"])
+	})
+
+	t.Run("missing input or zero fee fails before checkout", func(t *testing.T) {
+		zeroTable, _ := fees.Parse([]byte(`{"id": "z", "version": "1", "effective_from": "2026-01-01T00:00:00Z", "currency": "LKR",
+			"inputs": { "quantity": "number" }, "items": [{ "code": "X", "amount": "quantity * 0" }]}`))
+		s := fees.NewSchedule()
+		assert.NoError(t, s.Register(zeroTable))
+
+		err := NewPaymentPlugin(&mockPaymentService{}, s).Execute(pluginContext{Context: context.Background(), Record: &store.TaskRecord{}, Inputs: map[string]any{"selected_method": "govpay"}}, json.RawMessage(`{"task_code": "t", "fee_table": "z"}`))
+		assert.ErrorIs(t, err, fees.ErrEvaluation)
+
+		err = NewPaymentPlugin(&mockPaymentService{}, s).Execute(pluginContext{Context: context.Background(), Record: &store.TaskRecord{}, Inputs: map[string]any{"selected_method": "govpay", "quantity": 3}}, json.RawMessage(`{"task_code": "t", "fee_table": "z"}`))
+		assert.ErrorContains(t, err, "zero fee")
+	})
+
+	t.Run("fee table without a schedule is rejected", func(t *testing.T) {
+		err := NewPaymentPlugin(&mockPaymentService{}, nil).Execute(pluginContext{Context: context.Background(), Record: &store.TaskRecord{}, Inputs: map[string]any{"selected_method": "govpay"}}, configRaw)
+		assert.ErrorContains(t, err, "no fee schedule")
+	})
+}
+
+func TestPaymentPlugin_Execute_Cart(t *testing.T) {
+	var got paymentsv2.AddToCartRequest
+	svc := &mockPaymentService{
+		addToCartFunc: func(req paymentsv2.AddToCartRequest) (*paymentsv2.PaymentLineItem, error) {
+			got = req
+			return &paymentsv2.PaymentLineItem{ID: "li-1", Amount: req.Amount, Currency: req.Currency, Status: paymentsv2.LineItemStatusOpen}, nil
+		},
+		createCheckoutSessionFunc: func(context.Context, paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+			t.Fatal("a carted fee must not open its own checkout")
+			return nil, nil
+		},
+	}
+	record := &store.TaskRecord{TaskID: "task-1", ParentWorkflowID: "CONS-1--node--b", ActiveOutputNamespace: "payment"}
+	configRaw := json.RawMessage(`{"task_code": "inspection_fee_v1", "service_name": "Inspection Fee", "amount": "250", "currency": "LKR", "cart": true}`)
+
+	err := NewPaymentPlugin(svc, nil).Execute(pluginContext{Context: context.Background(), Record: record, Inputs: map[string]any{}}, configRaw)
+	assert.ErrorIs(t, err, ErrSuspended)
+	assert.Equal(t, "PENDING_PAYMENT", record.State)
+	assert.Equal(t, paymentsv2.AddToCartRequest{
+		ConsignmentID: "CONS-1",
+		TaskID:        "task-1",
+		TaskCode:      "inspection_fee_v1",
+		Description:   "Inspection Fee",
+		Amount:        decimal.RequireFromString("250"),
+		Currency:      "LKR",
+	}, got)
+
+	paymentData := record.Data["payment"].(map[string]any)
+	assert.Equal(t, true, paymentData["cart"])
+	assert.Equal(t, "CONS-1", paymentData["consignment_id"])
+	assert.Equal(t, "li-1", paymentData["line_item_id"])
+	assert.Equal(t, "250", paymentData["amount"])
+
+	svc.addToCartFunc = func(paymentsv2.AddToCartRequest) (*paymentsv2.PaymentLineItem, error) {
+		return nil, paymentsv2.ErrAlreadyPaid
+	}
+	err = NewPaymentPlugin(svc, nil).Execute(pluginContext{Context: context.Background(), Record: &store.TaskRecord{TaskID: "task-1"}, Inputs: map[string]any{}}, configRaw)
+	assert.ErrorIs(t, err, paymentsv2.ErrAlreadyPaid)
 }
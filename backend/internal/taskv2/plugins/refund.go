@@ -0,0 +1,117 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/shopspring/decimal"
+)
+
+// RefundPlugin implements the REFUND task type. It refunds the payment taken
+// by the task's PAYMENT step, so a workflow can return the fee declaratively,
+// e.g. from the branch that handles an OGA rejection.
+//
+// A refund the gateway settles synchronously completes the step at once. A
+// pending one (always the case for manual GovPay refunds) parks the task in
+// PENDING_REFUND until the payment service completes the step with
+// refund_status "refunded" or "failed".
+type RefundPlugin struct {
+	paymentService paymentsv2.PaymentService
+}
+
+// NewRefundPlugin creates a new RefundPlugin.
+func NewRefundPlugin(paymentService paymentsv2.PaymentService) *RefundPlugin {
+	return &RefundPlugin{paymentService: paymentService}
+}
+
+// refundConfig is the plugin_properties of a REFUND subtask.
+type refundConfig struct {
+	// Reason is recorded on the refund; the step input "reason" is used when empty.
+	Reason string `json:"reason"`
+	// Amount refunds part of the payment; zero refunds all of what is left.
+	Amount decimal.Decimal `json:"amount"`
+}
+
+func (p *RefundPlugin) Execute(ctx pluginContext, configRaw json.RawMessage) error {
+	var cfg refundConfig
+	if len(configRaw) > 0 {
+		if err := json.Unmarshal(configRaw, &cfg); err != nil {
+			return fmt.Errorf("refund: failed to parse config: %w", err)
+		}
+	}
+	if cfg.Amount.IsNegative() {
+		return fmt.Errorf("refund: plugin_properties.amount must not be negative")
+	}
+	reason := cfg.Reason
+	if reason == "" {
+		reason, _ = ctx.Inputs["reason"].(string)
+	}
+	if reason == "" {
+		reason = "Refund requested by workflow"
+	}
+
+	latest, err := p.paymentService.GetLatestAttempt(ctx.Context, ctx.Record.TaskID)
+	if err != nil {
+		return fmt.Errorf("refund: failed to get latest payment attempt: %w", err)
+	}
+
+	// Nothing was paid (e.g. rejected before payment), or it was already
+	// returned: the step has nothing to do.
+	if latest == nil || (latest.Status != paymentsv2.PaymentStatusSuccess &&
+		latest.Status != paymentsv2.PaymentStatusRefundPending &&
+		latest.Status != paymentsv2.PaymentStatusRefunded) {
+		p.writeOutput(ctx, map[string]any{"refund_status": "not_required"})
+		return nil
+	}
+	if latest.Status == paymentsv2.PaymentStatusRefunded {
+		p.writeOutput(ctx, map[string]any{"refund_status": "refunded", "reference_number": latest.ReferenceNumber})
+		return nil
+	}
+
+	refund, err := p.paymentService.RequestRefund(ctx.Context, paymentsv2.RefundRequest{
+		ReferenceNumber: latest.ReferenceNumber,
+		Amount:          cfg.Amount,
+		Reason:          reason,
+		TaskID:          ctx.Record.TaskID,
+	})
+	if err != nil {
+		return fmt.Errorf("refund: failed to request refund: %w", err)
+	}
+
+	status := "pending"
+	if refund.Status == paymentsv2.RefundStatusSucceeded {
+		status = "refunded"
+	}
+	p.writeOutput(ctx, map[string]any{
+		"refund_id":        refund.ID,
+		"refund_status":    status,
+		"reference_number": refund.ReferenceNumber,
+		"amount":           refund.Amount.String(),
+		"currency":         refund.Currency,
+		"manual":           refund.Manual,
+		"instructions":     refund.Instructions,
+	})
+
+	if refund.Status == paymentsv2.RefundStatusSucceeded {
+		slog.Info("taskv2 refund: refunded", "taskId", ctx.Record.TaskID, "refundId", refund.ID)
+		return nil
+	}
+
+	slog.Info("taskv2 refund: waiting for refund to settle",
+		"taskId", ctx.Record.TaskID, "refundId", refund.ID, "manual", refund.Manual)
+	ctx.Record.State = "PENDING_REFUND"
+	return ErrSuspended
+}
+
+// writeOutput stores data under the active output namespace, if any.
+func (p *RefundPlugin) writeOutput(ctx pluginContext, data map[string]any) {
+	if ctx.Record.ActiveOutputNamespace == "" {
+		return
+	}
+	if ctx.Record.Data == nil {
+		ctx.Record.Data = make(map[string]any)
+	}
+	ctx.Record.Data[ctx.Record.ActiveOutputNamespace] = data
+}
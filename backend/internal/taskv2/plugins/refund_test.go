@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundPlugin_Execute(t *testing.T) {
+	newCtx := func(inputs map[string]any) (pluginContext, *store.TaskRecord) {
+		record := &store.TaskRecord{TaskID: "task-1", ActiveOutputNamespace: "refund"}
+		return pluginContext{Context: context.Background(), Record: record, Inputs: inputs}, record
+	}
+	paid := &paymentsv2.PaymentTransaction{ReferenceNumber: "TNSW1", Status: paymentsv2.PaymentStatusSuccess}
+
+	t.Run("nothing paid", func(t *testing.T) {
+		svc := &mockPaymentService{latestAttempt: &paymentsv2.PaymentTransaction{Status: paymentsv2.PaymentStatusExpired}}
+		ctx, record := newCtx(nil)
+		require.NoError(t, NewRefundPlugin(svc).Execute(ctx, nil))
+		assert.Equal(t, "not_required", record.Data["refund"].(map[string]any)["refund_status"])
+	})
+
+	t.Run("already refunded", func(t *testing.T) {
+		svc := &mockPaymentService{latestAttempt: &paymentsv2.PaymentTransaction{ReferenceNumber: "TNSW1", Status: paymentsv2.PaymentStatusRefunded}}
+		ctx, record := newCtx(nil)
+		require.NoError(t, NewRefundPlugin(svc).Execute(ctx, nil))
+		assert.Equal(t, "refunded", record.Data["refund"].(map[string]any)["refund_status"])
+	})
+
+	t.Run("pending refund suspends", func(t *testing.T) {
+		var got paymentsv2.RefundRequest
+		svc := &mockPaymentService{latestAttempt: paid, requestRefundFunc: func(req paymentsv2.RefundRequest) (*paymentsv2.Refund, error) {
+			got = req
+			return &paymentsv2.Refund{ID: "rf-1", ReferenceNumber: "TNSW1", Amount: decimal.NewFromInt(500), Currency: "LKR",
+				Status: paymentsv2.RefundStatusPending, Manual: true, Instructions: "transfer"}, nil
+		}}
+		ctx, record := newCtx(map[string]any{"reason": "rejected by OGA"})
+
+		err := NewRefundPlugin(svc).Execute(ctx, json.RawMessage(`{"amount": "500"}`))
+		assert.True(t, errors.Is(err, ErrSuspended))
+		assert.Equal(t, "PENDING_REFUND", record.State)
+		assert.Equal(t, paymentsv2.RefundRequest{ReferenceNumber: "TNSW1", Amount: decimal.NewFromInt(500), Reason: "rejected by OGA", TaskID: "task-1"}, got)
+
+		out := record.Data["refund"].(map[string]any)
+		assert.Equal(t, "rf-1", out["refund_id"])
+		assert.Equal(t, "pending", out["refund_status"])
+		assert.Equal(t, "500", out["amount"])
+		assert.Equal(t, true, out["manual"])
+	})
+
+	t.Run("synchronous refund completes", func(t *testing.T) {
+		svc := &mockPaymentService{latestAttempt: paid, requestRefundFunc: func(req paymentsv2.RefundRequest) (*paymentsv2.Refund, error) {
+			assert.Equal(t, "Refund requested by workflow", req.Reason)
+			return &paymentsv2.Refund{ID: "rf-2", Status: paymentsv2.RefundStatusSucceeded}, nil
+		}}
+		ctx, record := newCtx(nil)
+		require.NoError(t, NewRefundPlugin(svc).Execute(ctx, nil))
+		assert.Equal(t, "refunded", record.Data["refund"].(map[string]any)["refund_status"])
+	})
+
+	t.Run("refund error", func(t *testing.T) {
+		svc := &mockPaymentService{latestAttempt: paid, requestRefundFunc: func(paymentsv2.RefundRequest) (*paymentsv2.Refund, error) {
+			return nil, paymentsv2.ErrRefundInProgress
+		}}
+		ctx, _ := newCtx(nil)
+		err := NewRefundPlugin(svc).Execute(ctx, nil)
+		assert.ErrorIs(t, err, paymentsv2.ErrRefundInProgress)
+	})
+}
@@ -7,7 +7,8 @@ import (
 	"fmt"
 
 	flowplugins "github.com/OpenNSW/nsw-task-flow/plugins"
-	"github.com/OpenNSW/nsw/backend/internal/payments"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/fees"
 	"github.com/OpenNSW/nsw/backend/pkg/remote"
 )
 
@@ -19,6 +20,7 @@ const (
 	TaskTypePayment        = "PAYMENT"
 	TaskTypeAPICall        = "API_CALL"
 	TaskTypeNotification   = "NOTIFICATION"
+	TaskTypeRefund         = "REFUND"
 )
 
 // Register installs the taskv2 plugins on reg.
@@ -26,9 +28,11 @@ const (
 // EXTERNAL_REVIEW uses our local plugin (ExternalReviewPlugin) that resolves
 // targets via remote.Manager and posts the OGA submission envelope. Payment
 // uses our local plugin (PaymentPlugin) that initiates checkout sessions via
-// payments.PaymentService. NOTIFICATION uses NotificationPlugin which
-// dispatches SMS/email through notifications.Manager.
-func Register(reg *flowplugins.Registry, mgr *remote.Manager, paymentService payments.PaymentService, backendBaseURL string, devMode bool) error {
+// paymentsv2.PaymentService, pricing tasks from feeSchedule; REFUND
+// (RefundPlugin) returns that payment through the same service. NOTIFICATION
+// uses NotificationPlugin which dispatches SMS/email through
+// notifications.Manager.
+func Register(reg *flowplugins.Registry, mgr *remote.Manager, paymentService paymentsv2.PaymentService, feeSchedule *fees.Schedule, backendBaseURL string, devMode bool) error {
 	if reg == nil {
 		return fmt.Errorf("plugins: registry is nil")
 	}
@@ -42,7 +46,8 @@ func Register(reg *flowplugins.Registry, mgr *remote.Manager, paymentService pay
 	}{
 		{TaskTypeUserInput, flowplugins.NewUserInputPlugin()},
 		{TaskTypeExternalReview, NewExternalReviewPlugin(mgr, backendBaseURL, devMode)},
-		{TaskTypePayment, NewPaymentPlugin(paymentService)},
+		{TaskTypePayment, NewPaymentPlugin(paymentService, feeSchedule)},
+		{TaskTypeRefund, NewRefundPlugin(paymentService)},
 		{TaskTypeAPICall, flowplugins.NewAPICallPlugin(flowplugins.DefaultHTTPDispatcher)},
 	}
 
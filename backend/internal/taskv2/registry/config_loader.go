@@ -11,6 +11,8 @@ import (
 
 	engine "github.com/OpenNSW/go-temporal-workflow"
 	"github.com/OpenNSW/nsw-task-flow/orchestrator"
+
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/fees"
 )
 
 // LoadConfigsInto walks rootDir using a folder-as-task convention. Each
@@ -20,6 +22,7 @@ import (
 //	workflow.json or *_workflow.json → engine.WorkflowDefinition  (RegisterWorkflow)
 //	render.json                      → uiprojector blueprint + Task metadata (RegisterGeneric)
 //	*_jsonform.json                  → JSONForms schema           (RegisterGeneric)
+//	*_fees.json                      → fees.Table, one version    (RegisterFeeTable)
 //	anything else (userinput.json,
 //	  reviewerinput.json,
 //	  payment.json, …)               → orchestrator.SubTaskTemplate (RegisterSubTask)
@@ -34,8 +37,15 @@ import (
 //	    RenderConfigID: <render.json id>,
 //	}
 //
+// Subtasks are also mapped to the remote service (the OGA) they work for: a
+// subtask's own plugin_properties.service_id, or else the one service_id
+// declared by the folder's subtasks, so a folder's PAYMENT subtask is
+// attributed to the OGA that reviews the same task.
+//
 // Each task folder MUST contain exactly one workflow file and one render.json,
-// otherwise LoadConfigsInto returns an error.
+// otherwise LoadConfigsInto returns an error. Fee tables are compiled while
+// loading, so a bad expression, or a PAYMENT subtask naming a fee_table that
+// no folder provides, also fails the load.
 func LoadConfigsInto(reg *InMemRegistry, rootDir string) error {
 	if reg == nil {
 		return fmt.Errorf("config loader: registry is nil")
@@ -47,9 +57,10 @@ func LoadConfigsInto(reg *InMemRegistry, rootDir string) error {
 	}
 
 	taskFolders := 0
+	feeRefs := make(map[string]string) // fee table ID -> first subtask file naming it
 	for _, e := range entries {
 		if e.IsDir() {
-			if err := loadTaskFolder(reg, filepath.Join(rootDir, e.Name())); err != nil {
+			if err := loadTaskFolder(reg, filepath.Join(rootDir, e.Name()), feeRefs); err != nil {
 				return err
 			}
 			taskFolders++
@@ -81,6 +92,13 @@ func LoadConfigsInto(reg *InMemRegistry, rootDir string) error {
 	if taskFolders == 0 {
 		return fmt.Errorf("config loader: no task subfolders found under %s", rootDir)
 	}
+	// Fee tables may live in a different folder from the subtask using them,
+	// so references are only checked once everything is loaded.
+	for id, path := range feeRefs {
+		if !reg.FeeSchedule().Has(id) {
+			return fmt.Errorf("subtask %s: unknown fee_table %q", path, id)
+		}
+	}
 	slog.Info("config loader done", "root", rootDir, "task_folders", taskFolders)
 	return nil
 }
@@ -89,10 +107,12 @@ func LoadConfigsInto(reg *InMemRegistry, rootDir string) error {
 // within the folder (recursively, in case of nested subtask groupings),
 // registers each piece in reg, then synthesizes and registers the
 // TaskTemplate for the folder as a whole.
-func loadTaskFolder(reg *InMemRegistry, dir string) error {
+func loadTaskFolder(reg *InMemRegistry, dir string, feeRefs map[string]string) error {
 	var workflowID string
 	var renderID string
 	var taskType string
+	subtaskServices := make(map[string]string) // subtask ID -> its own service_id, if any
+	folderServices := make(map[string]bool)
 
 	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
@@ -149,6 +169,16 @@ func loadTaskFolder(reg *InMemRegistry, dir string) error {
 			taskType = probe.Type
 			slog.Info("registered render config", "id", probe.ID, "type", probe.Type, "path", path)
 
+		case strings.HasSuffix(name, "_fees.json"):
+			t, err := fees.Parse(data)
+			if err != nil {
+				return fmt.Errorf("fee table %s: %w", path, err)
+			}
+			if err := reg.RegisterFeeTable(t); err != nil {
+				return fmt.Errorf("fee table %s: %w", path, err)
+			}
+			slog.Info("registered fee table", "id", t.ID, "version", t.Version, "effective_from", t.EffectiveFrom, "path", path)
+
 		case strings.HasSuffix(name, "_jsonform.json"):
 			id, err := extractID(data)
 			if err != nil {
@@ -167,6 +197,16 @@ func loadTaskFolder(reg *InMemRegistry, dir string) error {
 			}
 			reg.RegisterSubTask(st)
 			slog.Info("registered subtask", "id", st.ID, "path", path)
+			if id := feeTableRef(data); id != "" {
+				if _, seen := feeRefs[id]; !seen {
+					feeRefs[id] = path
+				}
+			}
+			serviceID := serviceIDRef(data)
+			subtaskServices[st.ID] = serviceID
+			if serviceID != "" {
+				folderServices[serviceID] = true
+			}
 		}
 		return nil
 	})
@@ -181,6 +221,21 @@ func loadTaskFolder(reg *InMemRegistry, dir string) error {
 		return fmt.Errorf("task folder %s: render.json missing or has no id", dir)
 	}
 
+	var folderService string
+	if len(folderServices) == 1 {
+		for id := range folderServices {
+			folderService = id
+		}
+	}
+	for subtaskID, serviceID := range subtaskServices {
+		if serviceID == "" {
+			serviceID = folderService
+		}
+		if serviceID != "" {
+			reg.RegisterSubTaskService(subtaskID, serviceID)
+		}
+	}
+
 	reg.RegisterTask(orchestrator.TaskTemplate{
 		ID:             workflowID,
 		Type:           taskType,
@@ -204,3 +259,29 @@ func extractID(data []byte) (string, error) {
 	}
 	return probe.ID, nil
 }
+
+// feeTableRef returns the fee table a PAYMENT subtask prices itself with, if any.
+func feeTableRef(data []byte) string {
+	var probe struct {
+		PluginProperties struct {
+			FeeTable string `json:"fee_table"`
+		} `json:"plugin_properties"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return ""
+	}
+	return probe.PluginProperties.FeeTable
+}
+
+// serviceIDRef returns the remote service a subtask declares, if any.
+func serviceIDRef(data []byte) string {
+	var probe struct {
+		PluginProperties struct {
+			ServiceID string `json:"service_id"`
+		} `json:"plugin_properties"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return ""
+	}
+	return probe.PluginProperties.ServiceID
+}
@@ -6,6 +6,8 @@ import (
 
 	engine "github.com/OpenNSW/go-temporal-workflow"
 	"github.com/OpenNSW/nsw-task-flow/orchestrator"
+
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/fees"
 )
 
 // InMemRegistry is a basic in-memory implementation of orchestrator.TaskTemplateRegistry.
@@ -17,6 +19,8 @@ type InMemRegistry struct {
 	subtasks  map[string]orchestrator.SubTaskTemplate
 	workflows map[string]engine.WorkflowDefinition
 	generics  map[string]json.RawMessage
+	services  map[string]string // subtask template ID -> service_id
+	fees      *fees.Schedule
 }
 
 func NewInMemRegistry() *InMemRegistry {
@@ -25,6 +29,8 @@ func NewInMemRegistry() *InMemRegistry {
 		subtasks:  make(map[string]orchestrator.SubTaskTemplate),
 		workflows: make(map[string]engine.WorkflowDefinition),
 		generics:  make(map[string]json.RawMessage),
+		services:  make(map[string]string),
+		fees:      fees.NewSchedule(),
 	}
 }
 
@@ -52,6 +58,33 @@ func (r *InMemRegistry) RegisterGeneric(id string, data json.RawMessage) {
 	r.generics[id] = data
 }
 
+// RegisterSubTaskService records the remote service (the OGA) a subtask
+// template works for.
+func (r *InMemRegistry) RegisterSubTaskService(subTaskID, serviceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services[subTaskID] = serviceID
+}
+
+// SubTaskServiceID returns the service_id recorded for a subtask template.
+func (r *InMemRegistry) SubTaskServiceID(subTaskID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.services[subTaskID]
+	return id, ok
+}
+
+// RegisterFeeTable adds a version of a fee table to the registry's schedule.
+func (r *InMemRegistry) RegisterFeeTable(t *fees.Table) error {
+	return r.fees.Register(t)
+}
+
+// FeeSchedule returns the fee tables loaded alongside the task configs. The
+// schedule is shared, so tables registered later are visible through it.
+func (r *InMemRegistry) FeeSchedule() *fees.Schedule {
+	return r.fees
+}
+
 func (r *InMemRegistry) GetTaskTemplate(id string) (orchestrator.TaskTemplate, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
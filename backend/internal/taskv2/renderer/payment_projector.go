@@ -3,11 +3,16 @@ package renderer
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"text/template"
 
-	"github.com/OpenNSW/nsw/backend/internal/payments"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
 	"github.com/OpenNSW/nsw/backend/pkg/uiprojector"
 )
 
@@ -16,12 +21,12 @@ const ProjectorPayment uiprojector.ProjectorType = "PAYMENT"
 
 // PaymentProjector dynamically templates payment instructions from the payment service.
 type PaymentProjector struct {
-	paymentService payments.PaymentService
+	paymentService paymentsv2.PaymentService
 	tmplCache      sync.Map // map[methodID string]*template.Template
 }
 
 // NewPaymentProjector creates a new PaymentProjector.
-func NewPaymentProjector(paymentService payments.PaymentService) *PaymentProjector {
+func NewPaymentProjector(paymentService paymentsv2.PaymentService) *PaymentProjector {
 	return &PaymentProjector{
 		paymentService: paymentService,
 	}
@@ -33,6 +38,8 @@ func (p *PaymentProjector) Type() uiprojector.ProjectorType {
 }
 
 // Project resolves the selected payment method's instructions template and renders it.
+// Methods without a configured template fall back to the instructions the gateway
+// returned when the checkout session was created.
 // When the payment facts haven't been populated yet (entering PENDING_PAYMENT before
 // CreateCheckoutSession completes), Project returns a placeholder markdown projection
 // so the page still loads instead of 500ing.
@@ -48,12 +55,16 @@ func (p *PaymentProjector) Project(ctx context.Context, templateContent []byte,
 		return uiprojector.Projection{}, fmt.Errorf("payment_projector: expected map data, got %T", data)
 	}
 
+	if cart, _ := dataMap["cart"].(bool); cart {
+		return p.projectCartItem(ctx, dataMap)
+	}
+
 	selectedMethod, _ := dataMap["selected_method"].(string)
 	if selectedMethod == "" {
 		selectedMethod = "lankapay"
 	}
 
-	method, err := p.paymentService.GetPaymentMethod(selectedMethod)
+	method, err := p.paymentService.GetMethod(ctx, selectedMethod)
 	if err != nil {
 		return uiprojector.Projection{}, fmt.Errorf("payment_projector: get payment method %q: %w", selectedMethod, err)
 	}
@@ -62,7 +73,11 @@ func (p *PaymentProjector) Project(ctx context.Context, templateContent []byte,
 	if cached, ok := p.tmplCache.Load(selectedMethod); ok {
 		tmpl = cached.(*template.Template)
 	} else {
-		parsed, err := template.New("instructions").Parse(method.Template)
+		source := method.RenderInfo.Template
+		if source == "" {
+			source = "{{ .Instructions }}"
+		}
+		parsed, err := template.New("instructions").Parse(source)
 		if err != nil {
 			return uiprojector.Projection{}, fmt.Errorf("payment_projector: parse template: %w", err)
 		}
@@ -70,6 +85,21 @@ func (p *PaymentProjector) Project(ctx context.Context, templateContent []byte,
 		tmpl = parsed
 	}
 
+	// Earlier attempts of the task are listed under the instructions so the
+	// trader can tell which reference is current after a retry.
+	var attempts []paymentsv2.PaymentTransaction
+	if taskID, _ := dataMap["task_id"].(string); taskID != "" {
+		attempts, err = p.paymentService.ListAttempts(ctx, taskID)
+		if err != nil {
+			return uiprojector.Projection{}, fmt.Errorf("payment_projector: list payment attempts: %w", err)
+		}
+	}
+
+	breakdown, err := feeBreakdown(dataMap["fee_breakdown"])
+	if err != nil {
+		return uiprojector.Projection{}, fmt.Errorf("payment_projector: %w", err)
+	}
+
 	orgName, _ := dataMap["org_name"].(string)
 	tmplData := map[string]any{
 		"ReferenceNumber":  dataMap["reference_number"],
@@ -79,14 +109,25 @@ func (p *PaymentProjector) Project(ctx context.Context, templateContent []byte,
 		"ServiceName":      dataMap["service_name"],
 		"ServiceType":      dataMap["service_type"],
 		"OrganizationName": orgName,
+		"Instructions":     dataMap["instructions"],
+		"AttemptNo":        dataMap["attempt_no"],
+		"Attempts":         attempts,
+		"FeeBreakdown":     breakdown,
 	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, tmplData); err != nil {
 		return uiprojector.Projection{}, fmt.Errorf("payment_projector: execute template: %w", err)
 	}
+	currency, _ := dataMap["currency"].(string)
+	buf.WriteString(feeBreakdownTable(breakdown, currency))
+	buf.WriteString(attemptHistory(attempts))
+	if n := len(attempts); n > 0 && attempts[n-1].Status == paymentsv2.PaymentStatusSuccess {
+		taskID, _ := dataMap["task_id"].(string)
+		buf.WriteString(p.receiptLink(ctx, taskID))
+	}
 
-	if method.Type == "REDIRECT" {
+	if method.Type == gateways.FlowTypeRedirect {
 		checkoutURL, _ := dataMap["checkout_url"].(string)
 		return uiprojector.Projection{
 			Type: uiprojector.SectionType("REDIRECT"),
@@ -102,3 +143,140 @@ func (p *PaymentProjector) Project(ctx context.Context, templateContent []byte,
 		Content: buf.String(),
 	}, nil
 }
+
+var attemptStatusLabels = map[paymentsv2.PaymentStatus]string{
+	paymentsv2.PaymentStatusPending:        "Pending",
+	paymentsv2.PaymentStatusSuccess:        "Paid",
+	paymentsv2.PaymentStatusFailed:         "Failed",
+	paymentsv2.PaymentStatusExpired:        "Expired",
+	paymentsv2.PaymentStatusSuperseded:     "Replaced",
+	paymentsv2.PaymentStatusRefundRequired: "Paid late, refund pending",
+	paymentsv2.PaymentStatusRefundPending:  "Refund in progress",
+	paymentsv2.PaymentStatusRefunded:       "Refunded",
+}
+
+// attemptHistory renders every attempt but the latest as a markdown table, or
+// nothing when the task has had a single attempt.
+func attemptHistory(attempts []paymentsv2.PaymentTransaction) string {
+	if len(attempts) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n#### Previous payment attempts\n\n| Attempt | Reference | Method | Status |\n|---|---|---|---|\n")
+	for _, a := range attempts[:len(attempts)-1] {
+		label, ok := attemptStatusLabels[a.Status]
+		if !ok {
+			label = string(a.Status)
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s |\n", a.AttemptNo, a.ReferenceNumber, a.GatewayID, label)
+	}
+	return b.String()
+}
+
+// projectCartItem renders a fee the payment plugin added to its consignment's
+// payment cart. There is nothing to pay on the task itself, so it points the
+// trader at the cart and, once the cart is checked out, names the reference
+// that covers the fee.
+func (p *PaymentProjector) projectCartItem(ctx context.Context, dataMap map[string]any) (uiprojector.Projection, error) {
+	serviceName, _ := dataMap["service_name"].(string)
+	amount, _ := dataMap["amount"].(string)
+	currency, _ := dataMap["currency"].(string)
+	consignmentID, _ := dataMap["consignment_id"].(string)
+	lineItemID, _ := dataMap["line_item_id"].(string)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**: %s %s has been added to this consignment's payment cart. "+
+		"Pay it together with the consignment's other fees from the payment cart.", serviceName, currency, amount)
+
+	cart, err := p.paymentService.GetCart(ctx, consignmentID)
+	if err != nil {
+		return uiprojector.Projection{}, fmt.Errorf("payment_projector: get payment cart: %w", err)
+	}
+	paid := true
+	for _, item := range cart.Items {
+		if item.ID == lineItemID {
+			paid = false
+		}
+		if item.ID == lineItemID && item.Status == paymentsv2.LineItemStatusCheckedOut &&
+			cart.Attempt != nil && cart.Attempt.ID == item.TransactionID {
+			fmt.Fprintf(&b, "\n\nIt is included in the cart payment with reference **%s** (%s %s in total).",
+				cart.Attempt.ReferenceNumber, cart.Attempt.Currency, cart.Attempt.Amount.StringFixed(2))
+		}
+	}
+
+	breakdown, err := feeBreakdown(dataMap["fee_breakdown"])
+	if err != nil {
+		return uiprojector.Projection{}, fmt.Errorf("payment_projector: %w", err)
+	}
+	b.WriteString(feeBreakdownTable(breakdown, currency))
+	// Paid items leave the cart.
+	if paid {
+		taskID, _ := dataMap["task_id"].(string)
+		b.WriteString(p.receiptLink(ctx, taskID))
+	}
+
+	return uiprojector.Projection{
+		Type:    uiprojector.SectionTypeMarkdown,
+		Content: b.String(),
+	}, nil
+}
+
+// receiptLink renders a download link for the receipt of the payment that
+// settled the task's fee. A receipt that can't be fetched only drops the link,
+// so the page still renders.
+func (p *PaymentProjector) receiptLink(ctx context.Context, taskID string) string {
+	if taskID == "" {
+		return ""
+	}
+	u, err := p.paymentService.GetReceiptDownloadURL(ctx, taskID)
+	if err != nil {
+		if !errors.Is(err, paymentsv2.ErrReceiptNotFound) {
+			slog.WarnContext(ctx, "payment_projector: payment receipt unavailable", "taskId", taskID, "error", err)
+		}
+		return ""
+	}
+	return fmt.Sprintf("\n\n[Download payment receipt](%s)", u)
+}
+
+// feeLine is one line of the fee breakdown the payment plugin stores.
+type feeLine struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+}
+
+// feeBreakdown decodes the stored breakdown, which is a []map[string]any when
+// fresh from the plugin and a []any once it has round-tripped through the
+// task store.
+func feeBreakdown(v any) ([]feeLine, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode fee breakdown: %w", err)
+	}
+	var lines []feeLine
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return nil, fmt.Errorf("decode fee breakdown: %w", err)
+	}
+	return lines, nil
+}
+
+// feeBreakdownTable renders the fee line items as a markdown table, or nothing
+// for a flat fee.
+func feeBreakdownTable(lines []feeLine, currency string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\n#### Fee breakdown\n\n| Item | Amount (%s) |\n|---|---:|\n", currency)
+	for _, l := range lines {
+		label := l.Description
+		if label == "" {
+			label = l.Code
+		}
+		fmt.Fprintf(&b, "| %s | %s |\n", label, l.Amount)
+	}
+	return b.String()
+}
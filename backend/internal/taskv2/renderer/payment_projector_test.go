@@ -2,37 +2,119 @@ package renderer
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/OpenNSW/nsw/backend/internal/payments"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2"
+	"github.com/OpenNSW/nsw/backend/internal/paymentsv2/gateways"
 	"github.com/OpenNSW/nsw/backend/pkg/uiprojector"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockPaymentService struct {
-	getPaymentMethodFunc func(id string) (*payments.PaymentMethod, error)
+	getMethodFunc func(id string) (*paymentsv2.PaymentMethod, error)
+	attempts      map[string][]paymentsv2.PaymentTransaction
+	attemptsErr   error
+	carts         map[string]*paymentsv2.Cart
+	receiptURLs   map[string]string
 }
 
-func (m *mockPaymentService) CreateCheckoutSession(ctx context.Context, req payments.CreateCheckoutRequest) (*payments.CreateCheckoutResponse, error) {
+func (m *mockPaymentService) ListAvailableMethods(ctx context.Context) ([]paymentsv2.GatewayInfo, error) {
 	return nil, nil
 }
 
-func (m *mockPaymentService) ValidateReference(ctx context.Context, req payments.ValidateReferenceRequest) (*payments.ValidateReferenceResponse, error) {
+func (m *mockPaymentService) GetMethod(ctx context.Context, id string) (*paymentsv2.PaymentMethod, error) {
+	if m.getMethodFunc != nil {
+		return m.getMethodFunc(id)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *mockPaymentService) CreateCheckoutSession(ctx context.Context, req paymentsv2.CreateCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) GetLatestAttempt(ctx context.Context, taskID string) (*paymentsv2.PaymentTransaction, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) ListAttempts(ctx context.Context, taskID string) ([]paymentsv2.PaymentTransaction, error) {
+	return m.attempts[taskID], m.attemptsErr
+}
+
+func (m *mockPaymentService) ValidateReference(ctx context.Context, gatewayID string, rawBody json.RawMessage) (*gateways.ValidationResponse, error) {
 	return nil, nil
 }
 
-func (m *mockPaymentService) ProcessWebhook(ctx context.Context, payload payments.WebhookPayload) error {
+func (m *mockPaymentService) ProcessWebhook(ctx context.Context, gatewayID string, req gateways.WebhookRequest) error {
 	return nil
 }
 
-func (m *mockPaymentService) SetTaskCompleter(completer payments.TaskCompleter) {}
+func (m *mockPaymentService) ExpireOverdue(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (m *mockPaymentService) RedriveTaskSteps(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+func (m *mockPaymentService) RequestRefund(context.Context, paymentsv2.RefundRequest) (*paymentsv2.Refund, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) CompleteRefund(context.Context, string, paymentsv2.RefundResult) (*paymentsv2.Refund, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) ListRefunds(context.Context, paymentsv2.RefundStatus) ([]paymentsv2.Refund, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) AddToCart(context.Context, paymentsv2.AddToCartRequest) (*paymentsv2.PaymentLineItem, error) {
+	return nil, nil
+}
 
-func (m *mockPaymentService) GetPaymentMethod(id string) (*payments.PaymentMethod, error) {
-	if m.getPaymentMethodFunc != nil {
-		return m.getPaymentMethodFunc(id)
+func (m *mockPaymentService) GetCart(_ context.Context, consignmentID string) (*paymentsv2.Cart, error) {
+	if cart, ok := m.carts[consignmentID]; ok {
+		return cart, nil
+	}
+	return &paymentsv2.Cart{ConsignmentID: consignmentID}, nil
+}
+
+func (m *mockPaymentService) CheckoutCart(context.Context, paymentsv2.CartCheckoutRequest) (*paymentsv2.CreateCheckoutResponse, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) HandleReturn(context.Context, string, url.Values) (string, error) {
+	return "", nil
+}
+
+func (m *mockPaymentService) GetReceiptDownloadURL(_ context.Context, taskID string) (string, error) {
+	if u, ok := m.receiptURLs[taskID]; ok {
+		return u, nil
+	}
+	return "", paymentsv2.ErrReceiptNotFound
+}
+
+func (m *mockPaymentService) VerifyReceipt(context.Context, string) (*paymentsv2.ReceiptVerification, error) {
+	return nil, nil
+}
+
+func (m *mockPaymentService) SetReceipts(paymentsv2.ReceiptConfig)      {}
+func (m *mockPaymentService) SetPartyResolver(paymentsv2.PartyResolver) {}
+
+func (m *mockPaymentService) SetTaskCompleter(completer paymentsv2.TaskCompleter) {}
+
+func method(id string, flow gateways.InteractionType, tmpl string) *paymentsv2.PaymentMethod {
+	return &paymentsv2.PaymentMethod{
+		GatewayInfo: paymentsv2.GatewayInfo{ID: id, IsActive: true, RenderInfo: paymentsv2.RenderInfo{Template: tmpl}},
+		Type:        flow,
 	}
-	return nil, errors.New("unimplemented")
 }
 
 func TestPaymentProjector_Project(t *testing.T) {
@@ -40,13 +122,9 @@ func TestPaymentProjector_Project(t *testing.T) {
 	proj := NewPaymentProjector(mockSvc)
 
 	t.Run("renders lankapay redirect template", func(t *testing.T) {
-		mockSvc.getPaymentMethodFunc = func(id string) (*payments.PaymentMethod, error) {
+		mockSvc.getMethodFunc = func(id string) (*paymentsv2.PaymentMethod, error) {
 			assert.Equal(t, "lankapay", id)
-			return &payments.PaymentMethod{
-				ID:       id,
-				Type:     "REDIRECT",
-				Template: "LankaPay {{ .ServiceName }} ({{ .CheckoutURL }})",
-			}, nil
+			return method(id, gateways.FlowTypeRedirect, "LankaPay {{ .ServiceName }} ({{ .CheckoutURL }})"), nil
 		}
 
 		data := map[string]any{
@@ -65,8 +143,8 @@ func TestPaymentProjector_Project(t *testing.T) {
 	})
 
 	t.Run("returns placeholder when data is nil", func(t *testing.T) {
-		mockSvc.getPaymentMethodFunc = func(id string) (*payments.PaymentMethod, error) {
-			t.Fatalf("GetPaymentMethod should not be called when data is nil")
+		mockSvc.getMethodFunc = func(id string) (*paymentsv2.PaymentMethod, error) {
+			t.Fatalf("GetMethod should not be called when data is nil")
 			return nil, nil
 		}
 		out, err := proj.Project(context.Background(), nil, nil)
@@ -76,13 +154,9 @@ func TestPaymentProjector_Project(t *testing.T) {
 	})
 
 	t.Run("renders govpay offline template", func(t *testing.T) {
-		mockSvc.getPaymentMethodFunc = func(id string) (*payments.PaymentMethod, error) {
+		mockSvc.getMethodFunc = func(id string) (*paymentsv2.PaymentMethod, error) {
 			assert.Equal(t, "govpay", id)
-			return &payments.PaymentMethod{
-				ID:       id,
-				Type:     "INFO",
-				Template: "GovPay {{ .ReferenceNumber }} amount {{ .Amount }}",
-			}, nil
+			return method(id, gateways.FlowTypeInstruction, "GovPay {{ .ReferenceNumber }} amount {{ .Amount }}"), nil
 		}
 
 		data := map[string]any{
@@ -96,4 +170,155 @@ func TestPaymentProjector_Project(t *testing.T) {
 		assert.Equal(t, uiprojector.SectionTypeMarkdown, out.Type)
 		assert.Equal(t, "GovPay REF-999 amount 1500.00", out.Content)
 	})
+
+	t.Run("falls back to gateway instructions without a template", func(t *testing.T) {
+		fresh := NewPaymentProjector(&mockPaymentService{getMethodFunc: func(id string) (*paymentsv2.PaymentMethod, error) {
+			return method(id, gateways.FlowTypeInstruction, ""), nil
+		}})
+		out, err := fresh.Project(context.Background(), nil, map[string]any{
+			"selected_method": "govpay",
+			"instructions":    "Enter the reference in your bank app.",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uiprojector.SectionTypeMarkdown, out.Type)
+		assert.Equal(t, "Enter the reference in your bank app.", out.Content)
+	})
+
+	t.Run("lists earlier attempts after a retry", func(t *testing.T) {
+		fresh := NewPaymentProjector(&mockPaymentService{
+			getMethodFunc: func(id string) (*paymentsv2.PaymentMethod, error) {
+				return method(id, gateways.FlowTypeInstruction, "Pay {{ .ReferenceNumber }} (attempt {{ .AttemptNo }})"), nil
+			},
+			attempts: map[string][]paymentsv2.PaymentTransaction{"task-1": {
+				{AttemptNo: 1, ReferenceNumber: "TNSWAAAA1111", GatewayID: "govpay", Status: paymentsv2.PaymentStatusExpired},
+				{AttemptNo: 2, ReferenceNumber: "TNSWBBBB2222", GatewayID: "govpay", Status: paymentsv2.PaymentStatusSuperseded},
+				{AttemptNo: 3, ReferenceNumber: "TNSWCCCC3333", GatewayID: "govpay", Status: paymentsv2.PaymentStatusPending},
+			}},
+		})
+		out, err := fresh.Project(context.Background(), nil, map[string]any{
+			"selected_method":  "govpay",
+			"task_id":          "task-1",
+			"attempt_no":       3,
+			"reference_number": "TNSWCCCC3333",
+		})
+		assert.NoError(t, err)
+		content, _ := out.Content.(string)
+		assert.True(t, strings.HasPrefix(content, "Pay TNSWCCCC3333 (attempt 3)"))
+		assert.Contains(t, content, "| 1 | TNSWAAAA1111 | govpay | Expired |")
+		assert.Contains(t, content, "| 2 | TNSWBBBB2222 | govpay | Replaced |")
+		assert.NotContains(t, content, "| 3 |", "the current attempt is not history")
+	})
+
+	t.Run("single attempt renders no history", func(t *testing.T) {
+		fresh := NewPaymentProjector(&mockPaymentService{
+			getMethodFunc: func(id string) (*paymentsv2.PaymentMethod, error) {
+				return method(id, gateways.FlowTypeInstruction, "Pay {{ .ReferenceNumber }}"), nil
+			},
+			attempts: map[string][]paymentsv2.PaymentTransaction{"task-1": {
+				{AttemptNo: 1, ReferenceNumber: "TNSWAAAA1111", Status: paymentsv2.PaymentStatusPending},
+			}},
+		})
+		out, err := fresh.Project(context.Background(), nil, map[string]any{
+			"selected_method": "govpay", "task_id": "task-1", "reference_number": "TNSWAAAA1111",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Pay TNSWAAAA1111", out.Content)
+	})
+
+	t.Run("renders the fee breakdown", func(t *testing.T) {
+		fresh := NewPaymentProjector(&mockPaymentService{getMethodFunc: func(id string) (*paymentsv2.PaymentMethod, error) {
+			return method(id, gateways.FlowTypeInstruction, "Pay {{ .Amount }}{{ range .FeeBreakdown }} [{{ .Code }}]{{ end }}"), nil
+		}})
+		// As read back from the task store: plain []any of map[string]any.
+		out, err := fresh.Project(context.Background(), nil, map[string]any{
+			"selected_method": "govpay",
+			"amount":          "1750",
+			"currency":        "LKR",
+			"fee_breakdown": []any{
+				map[string]any{"code": "BASE", "description": "Application fee", "amount": "1500.00"},
+				map[string]any{"code": "INSPECTION", "amount": "250.00"},
+			},
+		})
+		assert.NoError(t, err)
+		content, _ := out.Content.(string)
+		assert.True(t, strings.HasPrefix(content, "Pay 1750 [BASE] [INSPECTION]"))
+		assert.Contains(t, content, "| Item | Amount (LKR) |")
+		assert.Contains(t, content, "| Application fee | 1500.00 |")
+		assert.Contains(t, content, "| INSPECTION | 250.00 |", "falls back to the code without a description")
+	})
+
+	t.Run("paid attempt links its receipt", func(t *testing.T) {
+		fresh := NewPaymentProjector(&mockPaymentService{
+			getMethodFunc: func(id string) (*paymentsv2.PaymentMethod, error) {
+				return method(id, gateways.FlowTypeInstruction, "Paid {{ .ReferenceNumber }}"), nil
+			},
+			attempts: map[string][]paymentsv2.PaymentTransaction{"task-1": {
+				{AttemptNo: 1, ReferenceNumber: "TNSWAAAA1111", Status: paymentsv2.PaymentStatusSuccess},
+			}},
+			receiptURLs: map[string]string{"task-1": "https://files.example/rc-1.pdf"},
+		})
+		out, err := fresh.Project(context.Background(), nil, map[string]any{
+			"selected_method": "govpay", "task_id": "task-1", "reference_number": "TNSWAAAA1111",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Paid TNSWAAAA1111\n\n[Download payment receipt](https://files.example/rc-1.pdf)", out.Content)
+	})
+
+	t.Run("attempt lookup error fails the projection", func(t *testing.T) {
+		fresh := NewPaymentProjector(&mockPaymentService{
+			getMethodFunc: func(id string) (*paymentsv2.PaymentMethod, error) {
+				return method(id, gateways.FlowTypeInstruction, "x"), nil
+			},
+			attemptsErr: errors.New("db down"),
+		})
+		_, err := fresh.Project(context.Background(), nil, map[string]any{"selected_method": "govpay", "task_id": "task-1"})
+		assert.Error(t, err)
+	})
+}
+
+func TestPaymentProjector_CartItem(t *testing.T) {
+	data := map[string]any{
+		"cart":           true,
+		"consignment_id": "cons-1",
+		"line_item_id":   "li-1",
+		"service_name":   "Inspection Fee",
+		"amount":         "250",
+		"currency":       "LKR",
+	}
+
+	t.Run("open item points at the cart", func(t *testing.T) {
+		proj := NewPaymentProjector(&mockPaymentService{getMethodFunc: func(string) (*paymentsv2.PaymentMethod, error) {
+			t.Fatalf("a carted fee has no payment method of its own")
+			return nil, nil
+		}})
+		out, err := proj.Project(context.Background(), nil, data)
+		assert.NoError(t, err)
+		assert.Equal(t, uiprojector.SectionTypeMarkdown, out.Type)
+		assert.Equal(t, "**Inspection Fee**: LKR 250 has been added to this consignment's payment cart. "+
+			"Pay it together with the consignment's other fees from the payment cart.", out.Content)
+	})
+
+	t.Run("checked-out item names the cart reference", func(t *testing.T) {
+		attempt := &paymentsv2.PaymentTransaction{ID: "tx-9", ReferenceNumber: "TNSWCART0001", Amount: decimal.RequireFromString("1750"), Currency: "LKR"}
+		proj := NewPaymentProjector(&mockPaymentService{carts: map[string]*paymentsv2.Cart{"cons-1": {
+			ConsignmentID: "cons-1",
+			Items:         []paymentsv2.PaymentLineItem{{ID: "li-1", Status: paymentsv2.LineItemStatusCheckedOut, TransactionID: "tx-9"}},
+			Attempt:       attempt,
+		}}})
+		out, err := proj.Project(context.Background(), nil, data)
+		assert.NoError(t, err)
+		assert.Contains(t, out.Content, "reference **TNSWCART0001** (LKR 1750.00 in total)")
+		assert.NotContains(t, out.Content, "receipt")
+	})
+
+	t.Run("paid item links the cart receipt", func(t *testing.T) {
+		paid := map[string]any{"task_id": "task-1"}
+		for k, v := range data {
+			paid[k] = v
+		}
+		proj := NewPaymentProjector(&mockPaymentService{receiptURLs: map[string]string{"task-1": "https://files.example/rc-9.pdf"}})
+		out, err := proj.Project(context.Background(), nil, paid)
+		assert.NoError(t, err)
+		assert.Contains(t, out.Content, "[Download payment receipt](https://files.example/rc-9.pdf)")
+	})
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 
 	tfrenderer "github.com/OpenNSW/nsw-task-flow/renderer"
 	"github.com/OpenNSW/nsw-task-flow/store"
@@ -54,6 +56,22 @@ func (a *ZoneViewAssembler) Assemble(ctx context.Context, record store.TaskRecor
 	}, nil
 }
 
+// LegalCommands returns the commands legal in record's current state, sorted,
+// from the same state-level action list Assemble filters handles by. It reads
+// the render config only and does not render the view, so task listings can
+// classify many records cheaply.
+func (a *ZoneViewAssembler) LegalCommands(record store.TaskRecord) ([]string, error) {
+	var cfg TaskTemplateConfig
+	if len(record.RenderConfig) > 0 {
+		if err := json.Unmarshal(record.RenderConfig, &cfg); err != nil {
+			return nil, fmt.Errorf("zone assembler: decode trader-app layering: %w", err)
+		}
+	}
+	commands := slices.Collect(maps.Keys(legalCommands(cfg.States[record.State].Actions)))
+	slices.Sort(commands)
+	return commands, nil
+}
+
 // mergeView decorates each slot in the projector-produced view with the
 // section's role and the subset of its handles whose command/action is legal
 // in the current state. A slot present in the view but missing from
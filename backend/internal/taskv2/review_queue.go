@@ -0,0 +1,341 @@
+package taskv2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	tfstore "github.com/OpenNSW/nsw-task-flow/store"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+	"github.com/OpenNSW/nsw/backend/pkg/pagination"
+)
+
+var (
+	// errNoAssignee is returned when a reassignment names no officer.
+	errNoAssignee = errors.New("officerId is required")
+	// errTaskNotQueued is returned when assigning a task that is not an
+	// external review awaiting the agency's decision.
+	errTaskNotQueued = errors.New("task is not queued for review")
+)
+
+// AssignmentStore is the surface ReviewQueue needs from the task store.
+// *store.GormTaskStore satisfies it.
+type AssignmentStore interface {
+	TaskLister
+	GetTask(ctx context.Context, taskID string) (tfstore.TaskRecord, bool)
+	ClaimTask(ctx context.Context, taskID, serviceID, officerID string) error
+	UnclaimTask(ctx context.Context, taskID, officerID string) error
+	AssignTask(ctx context.Context, a store.TaskAssignment) error
+	GetAssignments(ctx context.Context, taskIDs []string) (map[string]store.TaskAssignment, error)
+	DecideTask(ctx context.Context, taskID, serviceID, officerID string, decide func() error) error
+	Workload(ctx context.Context, serviceID string) ([]store.OfficerWorkload, error)
+}
+
+// QueueFilter narrows an agency's review queue to the reviews an officer
+// holds (AssigneeID) or to those nobody holds (Unassigned).
+type QueueFilter struct {
+	AssigneeID string
+	Unassigned bool
+	Offset     *int
+	Limit      *int
+}
+
+// QueueItem is one review of an agency's queue and the officer holding it,
+// if any.
+type QueueItem struct {
+	TaskID        string                `json:"task_id"`
+	ConsignmentID string                `json:"consignment_id"`
+	State         string                `json:"state"`
+	Assignment    *store.TaskAssignment `json:"assignment,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+}
+
+// ReviewQueue is the work queue of an agency's officers: the EXTERNAL_REVIEW
+// tasks dispatched to the agency that await its decision, which officers
+// claim and give up and supervisors assign. Callers are agency machine
+// clients; everyone else is refused. An officer is the authenticated client
+// it calls with, so an agency gives each officer its own client mapped to
+// the agency's service.
+type ReviewQueue struct {
+	store     AssignmentStore
+	audiences TaskAudiences
+}
+
+// NewReviewQueue builds a ReviewQueue.
+func NewReviewQueue(store AssignmentStore, audiences TaskAudiences) *ReviewQueue {
+	return &ReviewQueue{store: store, audiences: audiences}
+}
+
+// agency returns the caller on ctx: the officer and the service it reviews
+// for.
+func (q *ReviewQueue) agency(ctx context.Context) (authz.TaskAudience, error) {
+	audience, err := q.audiences.Audience(ctx)
+	if err != nil {
+		return authz.TaskAudience{}, err
+	}
+	if audience.ServiceID == "" {
+		return authz.TaskAudience{}, authz.ErrForbidden
+	}
+	return audience, nil
+}
+
+// List returns a page of the caller's agency queue, oldest review first.
+func (q *ReviewQueue) List(ctx context.Context, filter QueueFilter) (pagination.Page[QueueItem], error) {
+	caller, err := q.agency(ctx)
+	if err != nil {
+		return pagination.Page[QueueItem]{}, err
+	}
+	offset, limit := pagination.ResolvePaginationParams(filter.Offset, filter.Limit)
+	records, total, err := q.store.ListTasks(ctx, store.TaskQuery{
+		ServiceID:  caller.ServiceID,
+		AssigneeID: filter.AssigneeID,
+		Unassigned: filter.Unassigned,
+		TaskTypes:  reviewTaskTypes,
+		States:     []string{plugins.StateQueuedExternally},
+		Offset:     offset,
+		Limit:      limit,
+	})
+	if err != nil {
+		return pagination.Page[QueueItem]{}, err
+	}
+	taskIDs := make([]string, len(records))
+	for i, record := range records {
+		taskIDs[i] = record.TaskID
+	}
+	assignments, err := q.store.GetAssignments(ctx, taskIDs)
+	if err != nil {
+		return pagination.Page[QueueItem]{}, err
+	}
+
+	items := make([]QueueItem, len(records))
+	for i, record := range records {
+		items[i] = QueueItem{
+			TaskID:        record.TaskID,
+			ConsignmentID: store.RootWorkflowID(record.ParentWorkflowID),
+			State:         record.State,
+			CreatedAt:     record.CreatedAt,
+			UpdatedAt:     record.UpdatedAt,
+		}
+		if a, ok := assignments[record.TaskID]; ok {
+			items[i].Assignment = &a
+		}
+	}
+	return pagination.NewPageResult(items, total, offset, limit), nil
+}
+
+// Workload returns the number of queued reviews each officer of the caller's
+// agency holds.
+func (q *ReviewQueue) Workload(ctx context.Context) ([]store.OfficerWorkload, error) {
+	caller, err := q.agency(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return q.store.Workload(ctx, caller.ServiceID)
+}
+
+// Claim assigns taskID to the calling officer, who must not take it from
+// another officer.
+func (q *ReviewQueue) Claim(ctx context.Context, taskID string) error {
+	caller, err := q.queuedReview(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	return q.store.ClaimTask(ctx, taskID, caller.ServiceID, caller.Subject)
+}
+
+// Unclaim returns taskID, held by the calling officer, to the queue.
+func (q *ReviewQueue) Unclaim(ctx context.Context, taskID string) error {
+	caller, err := q.agency(ctx)
+	if err != nil {
+		return err
+	}
+	return q.store.UnclaimTask(ctx, taskID, caller.Subject)
+}
+
+// Assign reassigns taskID to officerID on behalf of the calling supervisor.
+// The agency's system decides who may supervise; NSW records who did.
+func (q *ReviewQueue) Assign(ctx context.Context, taskID, officerID string) error {
+	if officerID == "" {
+		return errNoAssignee
+	}
+	caller, err := q.queuedReview(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	return q.store.AssignTask(ctx, store.TaskAssignment{
+		TaskID:     taskID,
+		ServiceID:  caller.ServiceID,
+		OfficerID:  officerID,
+		AssignedBy: caller.Subject,
+	})
+}
+
+// queuedReview checks that the caller may assign taskID: a review dispatched
+// to the caller's agency and awaiting its decision. It returns the caller.
+func (q *ReviewQueue) queuedReview(ctx context.Context, taskID string) (authz.TaskAudience, error) {
+	caller, err := q.agency(ctx)
+	if err != nil {
+		return authz.TaskAudience{}, err
+	}
+	record, ok := q.store.GetTask(ctx, taskID)
+	if !ok {
+		return authz.TaskAudience{}, fmt.Errorf("task %s: %w", taskID, authz.ErrNotFound)
+	}
+	if dispatched, _ := record.Data[plugins.DispatchedServiceIDKey].(string); dispatched != caller.ServiceID {
+		return authz.TaskAudience{}, authz.ErrForbidden
+	}
+	if record.TaskType != plugins.TaskTypeExternalReview || record.State != plugins.StateQueuedExternally {
+		return authz.TaskAudience{}, errTaskNotQueued
+	}
+	return caller, nil
+}
+
+// Decide applies decide, the step an agency posts on taskID, under the
+// review's assignment: a review an officer holds may only be decided by that
+// officer, and the officer whose decision succeeds is recorded with it.
+// Other tasks, and steps submitted by anyone but an agency, are applied as
+// they come.
+func (q *ReviewQueue) Decide(ctx context.Context, taskID string, decide func() error) error {
+	caller, err := q.agency(ctx)
+	if err != nil {
+		return decide()
+	}
+	record, ok := q.store.GetTask(ctx, taskID)
+	if !ok || record.TaskType != plugins.TaskTypeExternalReview {
+		return decide()
+	}
+	return q.store.DecideTask(ctx, taskID, caller.ServiceID, caller.Subject, decide)
+}
+
+// HandleListQueue returns the caller's agency review queue.
+//
+//	GET /api/v1/review-queue?assignee=&unassigned=&offset=&limit=
+func (h *HTTPHandler) HandleListQueue(w http.ResponseWriter, r *http.Request) {
+	if !h.queueConfigured(w) {
+		return
+	}
+	offset, limit, err := pagination.ParsePaginationParams(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter := QueueFilter{AssigneeID: r.URL.Query().Get("assignee"), Offset: offset, Limit: limit}
+	if value := r.URL.Query().Get("unassigned"); value != "" {
+		if filter.Unassigned, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "unassigned must be true or false")
+			return
+		}
+	}
+	if filter.Unassigned && filter.AssigneeID != "" {
+		writeJSONError(w, http.StatusBadRequest, "assignee and unassigned cannot be combined")
+		return
+	}
+
+	page, err := h.Queue.List(r.Context(), filter)
+	if err != nil {
+		writeQueueError(w, "list review queue", err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, page)
+}
+
+// HandleGetWorkload returns the queued reviews held by each officer of the
+// caller's agency.
+//
+//	GET /api/v1/review-queue/workload
+func (h *HTTPHandler) HandleGetWorkload(w http.ResponseWriter, r *http.Request) {
+	if !h.queueConfigured(w) {
+		return
+	}
+	workload, err := h.Queue.Workload(r.Context())
+	if err != nil {
+		writeQueueError(w, "count workload", err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]any{"items": workload})
+}
+
+// HandleClaimTask assigns a queued review to the calling officer.
+//
+//	POST /api/v1/tasks/{id}/claim
+func (h *HTTPHandler) HandleClaimTask(w http.ResponseWriter, r *http.Request) {
+	if !h.queueConfigured(w) || !h.authorizeTask(w, r, r.PathValue("id")) {
+		return
+	}
+	if err := h.Queue.Claim(r.Context(), r.PathValue("id")); err != nil {
+		writeQueueError(w, "claim task", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUnclaimTask returns a review the calling officer holds to the queue.
+//
+//	POST /api/v1/tasks/{id}/unclaim
+func (h *HTTPHandler) HandleUnclaimTask(w http.ResponseWriter, r *http.Request) {
+	if !h.queueConfigured(w) || !h.authorizeTask(w, r, r.PathValue("id")) {
+		return
+	}
+	if err := h.Queue.Unclaim(r.Context(), r.PathValue("id")); err != nil {
+		writeQueueError(w, "unclaim task", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAssignTask reassigns a queued review on behalf of the calling
+// supervisor.
+//
+//	PUT /api/v1/tasks/{id}/assignment
+//	body: {"officerId": "..."}
+func (h *HTTPHandler) HandleAssignTask(w http.ResponseWriter, r *http.Request) {
+	if !h.queueConfigured(w) || !h.authorizeTask(w, r, r.PathValue("id")) {
+		return
+	}
+	var body struct {
+		OfficerID string `json:"officerId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if err := h.Queue.Assign(r.Context(), r.PathValue("id"), body.OfficerID); err != nil {
+		writeQueueError(w, "assign task", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) queueConfigured(w http.ResponseWriter) bool {
+	if h.Queue == nil {
+		slog.Error("taskv2: review queue is not configured")
+		writeJSONError(w, http.StatusInternalServerError, "An internal error occurred while processing the request")
+		return false
+	}
+	return true
+}
+
+// writeQueueError renders an error of a ReviewQueue operation.
+func writeQueueError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, errNoAssignee):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errTaskNotQueued), errors.Is(err, store.ErrTaskClaimed), errors.Is(err, store.ErrNotAssignee),
+		errors.Is(err, store.ErrTaskDeciding):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, authz.ErrUnauthenticated), errors.Is(err, authz.ErrForbidden), errors.Is(err, authz.ErrNotFound):
+		authz.WriteError(w, err)
+	default:
+		slog.Error("taskv2: review queue operation failed", "op", op, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "An internal error occurred while processing the request")
+	}
+}
@@ -0,0 +1,184 @@
+package taskv2
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OpenNSW/nsw/backend/internal/authz"
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/store"
+)
+
+type allowAllTasks struct{}
+
+func (allowAllTasks) AuthorizeTask(context.Context, string) error { return nil }
+
+var assignmentColumns = []string{"task_id", "service_id", "officer_id", "assigned_by", "assigned_at"}
+
+func newTestQueue(t *testing.T, audience authz.TaskAudience) (*HTTPHandler, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := setupTestDB(t)
+	taskStore := store.NewGormTaskStore(db)
+	return &HTTPHandler{
+		Store: taskStore,
+		Authz: allowAllTasks{},
+		Queue: NewReviewQueue(taskStore, staticAudience{audience: audience}),
+	}, mock
+}
+
+func expectReviewTask(mock sqlmock.Sqlmock, taskID, state string) {
+	mock.ExpectQuery(`SELECT \* FROM "task_records_v2" WHERE task_id = \$1`).
+		WithArgs(taskID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"task_id", "task_type", "state", "data"}).
+			AddRow(taskID, "EXTERNAL_REVIEW", state, []byte(`{"dispatched_service_id":"fcau"}`)))
+}
+
+func queueRequest(h http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	req.SetPathValue("id", "task-1")
+	w := httptest.NewRecorder()
+	h(w, req)
+	return w
+}
+
+func TestHandleClaimTask(t *testing.T) {
+	fcau := authz.TaskAudience{ServiceID: "fcau", Subject: "officer-a"}
+
+	t.Run("claims an unassigned review", func(t *testing.T) {
+		h, mock := newTestQueue(t, fcau)
+		expectReviewTask(mock, "task-1", "QUEUED_EXTERNALLY")
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "task_assignments" .* ON CONFLICT DO NOTHING`).
+			WithArgs("task-1", "fcau", "officer-a", "officer-a", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w := queueRequest(h.HandleClaimTask, http.MethodPost, "/api/v1/tasks/task-1/claim", "")
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuses a review another officer holds", func(t *testing.T) {
+		h, mock := newTestQueue(t, fcau)
+		expectReviewTask(mock, "task-1", "QUEUED_EXTERNALLY")
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "task_assignments"`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT "task_id","officer_id" FROM "task_assignments" WHERE task_id = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"task_id", "officer_id"}).AddRow("task-1", "officer-b"))
+		mock.ExpectRollback()
+
+		w := queueRequest(h.HandleClaimTask, http.MethodPost, "/api/v1/tasks/task-1/claim", "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuses a decided review", func(t *testing.T) {
+		h, mock := newTestQueue(t, fcau)
+		expectReviewTask(mock, "task-1", "COMPLETED")
+		w := queueRequest(h.HandleClaimTask, http.MethodPost, "/api/v1/tasks/task-1/claim", "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("refuses traders", func(t *testing.T) {
+		h, _ := newTestQueue(t, authz.TaskAudience{OUHandle: "trader-ou"})
+		w := queueRequest(h.HandleClaimTask, http.MethodPost, "/api/v1/tasks/task-1/claim", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestHandleUnclaimTask(t *testing.T) {
+	h, mock := newTestQueue(t, authz.TaskAudience{ServiceID: "fcau", Subject: "officer-a"})
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "task_assignments" WHERE task_id = \$1 AND officer_id = \$2 AND completed_by IS NULL`).
+		WithArgs("task-1", "officer-a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	w := queueRequest(h.HandleUnclaimTask, http.MethodPost, "/api/v1/tasks/task-1/unclaim", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleAssignTask(t *testing.T) {
+	h, mock := newTestQueue(t, authz.TaskAudience{ServiceID: "fcau", Subject: "supervisor-1"})
+	expectReviewTask(mock, "task-1", "QUEUED_EXTERNALLY")
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "task_assignments" .* ON CONFLICT \("task_id"\) DO UPDATE SET "officer_id"="excluded"."officer_id"`).
+		WithArgs("task-1", "fcau", "officer-b", "supervisor-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := queueRequest(h.HandleAssignTask, http.MethodPut, "/api/v1/tasks/task-1/assignment", `{"officerId":"officer-b"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	w = queueRequest(h.HandleAssignTask, http.MethodPut, "/api/v1/tasks/task-1/assignment", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleListQueue(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	h, mock := newTestQueue(t, authz.TaskAudience{ServiceID: "fcau"})
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "task_records_v2" WHERE .* AND task_records_v2.data->>'dispatched_service_id' = \$6 `+
+		`AND task_records_v2.task_id IN \(SELECT task_id FROM task_assignments WHERE officer_id = \$7\) `+
+		`AND task_records_v2.task_type IN \(\$8\) AND task_records_v2.state IN \(\$9\)`).
+		WithArgs("COMPLETED", store.StateFailed, store.StateCancelled, store.StateSuperseded, "SYSTEM",
+			"fcau", "officer-a", "EXTERNAL_REVIEW", "QUEUED_EXTERNALLY").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT task_records_v2.\* FROM "task_records_v2"`).
+		WillReturnRows(sqlmock.NewRows(inboxColumns).
+			AddRow("task-1", "EXTERNAL_REVIEW", "QUEUED_EXTERNALLY", nil, "cons-1", "cons-1", nil, created, created))
+	mock.ExpectQuery(`SELECT \* FROM "task_assignments" WHERE task_id IN \(\$1\)`).
+		WithArgs("task-1").
+		WillReturnRows(sqlmock.NewRows(assignmentColumns).AddRow("task-1", "fcau", "officer-a", "officer-a", created))
+
+	w := queueRequest(h.HandleListQueue, http.MethodGet, "/api/v1/review-queue?assignee=officer-a", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"consignment_id":"cons-1","state":"QUEUED_EXTERNALLY","assignment":{"task_id":"task-1","service_id":"fcau","officer_id":"officer-a"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	w = queueRequest(h.HandleListQueue, http.MethodGet, "/api/v1/review-queue?assignee=officer-a&unassigned=true", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleGetWorkload(t *testing.T) {
+	assigned := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	h, mock := newTestQueue(t, authz.TaskAudience{ServiceID: "fcau"})
+	mock.ExpectQuery(`SELECT task_assignments.officer_id, count\(\*\) AS assigned, .* FROM "task_assignments" `+
+		`JOIN task_records_v2 ON .* WHERE task_assignments.service_id = \$1 AND task_records_v2.state = \$2 GROUP BY "task_assignments"."officer_id"`).
+		WithArgs("fcau", "QUEUED_EXTERNALLY").
+		WillReturnRows(sqlmock.NewRows([]string{"officer_id", "assigned", "oldest_assigned"}).
+			AddRow("officer-a", 3, assigned).AddRow("officer-b", 1, assigned))
+
+	w := queueRequest(h.HandleGetWorkload, http.MethodGet, "/api/v1/review-queue/workload", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"items":[
+		{"officer_id":"officer-a","assigned":3,"oldest_assigned_at":"2026-03-01T09:00:00Z"},
+		{"officer_id":"officer-b","assigned":1,"oldest_assigned_at":"2026-03-01T09:00:00Z"}]}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleCompleteTaskStep_EnforcesAssignment(t *testing.T) {
+	h, mock := newTestQueue(t, authz.TaskAudience{ServiceID: "fcau", Subject: "officer-a"})
+	expectReviewTask(mock, "task-1", "QUEUED_EXTERNALLY")
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "task_assignments" .* ON CONFLICT DO NOTHING`).
+		WithArgs("task-1", "fcau", "officer-a", "officer-a", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT "task_id","officer_id" FROM "task_assignments" WHERE task_id = \$1 .* FOR UPDATE`).
+		WithArgs("task-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"task_id", "officer_id"}).AddRow("task-1", "officer-b"))
+	mock.ExpectRollback()
+
+	w := queueRequest(h.HandleCompleteTaskStep, http.MethodPost, "/api/v1/tasks/task-1", `{"decision":"APPROVED"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "assigned to another officer")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+var (
+	// ErrTaskClaimed is returned when claiming a task another officer holds.
+	ErrTaskClaimed = errors.New("task is assigned to another officer")
+	// ErrNotAssignee is returned when an officer gives up a task they do not
+	// hold, or one whose decision is being applied.
+	ErrNotAssignee = errors.New("task is not assigned to the officer")
+	// ErrTaskDeciding is returned when reassigning a task whose decision is
+	// being applied.
+	ErrTaskDeciding = errors.New("task decision is in progress")
+)
+
+// TaskAssignment is the officer handling an external review on behalf of the
+// agency (service) it was dispatched to. AssignedBy is the officer itself for
+// a claim and the supervisor for an assignment. CompletedBy is the officer
+// whose decision is being applied, and CompletedAt is set once it completed
+// the review.
+type TaskAssignment struct {
+	TaskID      string     `gorm:"primaryKey;column:task_id;type:text" json:"task_id"`
+	ServiceID   string     `gorm:"column:service_id;type:text;not null" json:"service_id"`
+	OfficerID   string     `gorm:"column:officer_id;type:varchar(100);not null" json:"officer_id"`
+	AssignedBy  string     `gorm:"column:assigned_by;type:varchar(100);not null" json:"assigned_by"`
+	AssignedAt  time.Time  `gorm:"column:assigned_at;type:timestamptz;not null;autoCreateTime" json:"assigned_at"`
+	CompletedBy *string    `gorm:"column:completed_by;type:varchar(100);<-:update" json:"completed_by,omitempty"`
+	CompletedAt *time.Time `gorm:"column:completed_at;type:timestamptz;<-:update" json:"completed_at,omitempty"`
+}
+
+func (TaskAssignment) TableName() string {
+	return "task_assignments"
+}
+
+// OfficerWorkload is the number of reviews an officer holds that still await
+// the agency's decision, and when the longest-held was assigned.
+type OfficerWorkload struct {
+	OfficerID      string    `gorm:"column:officer_id" json:"officer_id"`
+	Assigned       int       `gorm:"column:assigned" json:"assigned"`
+	OldestAssigned time.Time `gorm:"column:oldest_assigned" json:"oldest_assigned_at"`
+}
+
+// ClaimTask assigns taskID to officerID unless another officer holds it, in
+// which case it returns ErrTaskClaimed. Claiming a task the officer already
+// holds succeeds.
+func (s *GormTaskStore) ClaimTask(ctx context.Context, taskID, serviceID, officerID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&TaskAssignment{
+			TaskID:     taskID,
+			ServiceID:  serviceID,
+			OfficerID:  officerID,
+			AssignedBy: officerID,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("claim task %s: %w", taskID, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		var held TaskAssignment
+		if err := tx.Select("task_id", "officer_id").First(&held, "task_id = ?", taskID).Error; err != nil {
+			return fmt.Errorf("claim task %s: %w", taskID, err)
+		}
+		if held.OfficerID != officerID {
+			return ErrTaskClaimed
+		}
+		return nil
+	})
+}
+
+// UnclaimTask returns taskID to its agency's queue. It returns ErrNotAssignee
+// unless officerID holds the task and no decision on it is being applied.
+func (s *GormTaskStore) UnclaimTask(ctx context.Context, taskID, officerID string) error {
+	result := s.db.WithContext(ctx).
+		Where("task_id = ? AND officer_id = ? AND completed_by IS NULL", taskID, officerID).
+		Delete(&TaskAssignment{})
+	if result.Error != nil {
+		return fmt.Errorf("unclaim task %s: %w", taskID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotAssignee
+	}
+	return nil
+}
+
+// AssignTask assigns a task to a.OfficerID whether or not another officer
+// holds it, for supervisors redistributing work. A task whose decision is
+// being applied is refused with ErrTaskDeciding.
+func (s *GormTaskStore) AssignTask(ctx context.Context, a TaskAssignment) error {
+	a.AssignedAt = time.Now()
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}},
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "task_assignments.completed_by IS NULL"}}},
+		DoUpdates: clause.AssignmentColumns([]string{"officer_id", "assigned_by", "assigned_at"}),
+	}).Create(&a)
+	if result.Error != nil {
+		return fmt.Errorf("assign task %s: %w", a.TaskID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskDeciding
+	}
+	return nil
+}
+
+// DecideTask applies decide, officerID's decision on taskID for the agency
+// serviceID. A short transaction first claims the review for the officer, or
+// refuses it with ErrTaskClaimed if another officer holds it, and marks the
+// officer as deciding it, so that it cannot change hands until the decision
+// is settled. decide then runs outside any transaction: once it succeeds the
+// decision is recorded as complete, and if it fails the mark is cleared.
+// decide's error is returned as is.
+func (s *GormTaskStore) DecideTask(ctx context.Context, taskID, serviceID, officerID string, decide func() error) error {
+	if err := s.markDecision(ctx, taskID, serviceID, officerID); err != nil {
+		return err
+	}
+	if err := decide(); err != nil {
+		if cerr := s.db.WithContext(ctx).Model(&TaskAssignment{}).
+			Where("task_id = ? AND completed_by = ? AND completed_at IS NULL", taskID, officerID).
+			Update("completed_by", nil).Error; cerr != nil {
+			slog.Error("taskv2 store: DecideTask failed to clear the decision mark", "taskId", taskID, "officerId", officerID, "error", cerr)
+		}
+		return err
+	}
+	if err := s.db.WithContext(ctx).Model(&TaskAssignment{}).
+		Where("task_id = ? AND completed_by = ?", taskID, officerID).
+		Update("completed_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("record decision of task %s: %w", taskID, err)
+	}
+	return nil
+}
+
+// markDecision claims taskID for officerID and marks the officer as deciding
+// it, holding the assignment's lock while it checks who holds the review.
+func (s *GormTaskStore) markDecision(ctx context.Context, taskID, serviceID, officerID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&TaskAssignment{
+			TaskID:     taskID,
+			ServiceID:  serviceID,
+			OfficerID:  officerID,
+			AssignedBy: officerID,
+		}).Error; err != nil {
+			return fmt.Errorf("decide task %s: %w", taskID, err)
+		}
+		var held TaskAssignment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("task_id", "officer_id").
+			First(&held, "task_id = ?", taskID).Error; err != nil {
+			return fmt.Errorf("decide task %s: %w", taskID, err)
+		}
+		if held.OfficerID != officerID {
+			return ErrTaskClaimed
+		}
+		if err := tx.Model(&TaskAssignment{}).Where("task_id = ?", taskID).
+			Update("completed_by", officerID).Error; err != nil {
+			return fmt.Errorf("decide task %s: %w", taskID, err)
+		}
+		return nil
+	})
+}
+
+// GetAssignments returns the assignments of those of taskIDs that are
+// assigned, by task ID.
+func (s *GormTaskStore) GetAssignments(ctx context.Context, taskIDs []string) (map[string]TaskAssignment, error) {
+	assignments := make(map[string]TaskAssignment, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return assignments, nil
+	}
+	var rows []TaskAssignment
+	if err := s.db.WithContext(ctx).Where("task_id IN ?", taskIDs).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("load task assignments: %w", err)
+	}
+	for _, a := range rows {
+		assignments[a.TaskID] = a
+	}
+	return assignments, nil
+}
+
+// Workload counts, per officer of serviceID, the assigned reviews still queued
+// with the agency. Officers holding none are not listed.
+func (s *GormTaskStore) Workload(ctx context.Context, serviceID string) ([]OfficerWorkload, error) {
+	workload := []OfficerWorkload{}
+	if err := s.db.WithContext(ctx).Model(&TaskAssignment{}).
+		Select("task_assignments.officer_id, count(*) AS assigned, min(task_assignments.assigned_at) AS oldest_assigned").
+		Joins("JOIN task_records_v2 ON task_records_v2.task_id = task_assignments.task_id").
+		Where("task_assignments.service_id = ? AND task_records_v2.state = ?", serviceID, plugins.StateQueuedExternally).
+		Group("task_assignments.officer_id").
+		Order("task_assignments.officer_id").
+		Scan(&workload).Error; err != nil {
+		return nil, fmt.Errorf("count workload of %s: %w", serviceID, err)
+	}
+	return workload, nil
+}
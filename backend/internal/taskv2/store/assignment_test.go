@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecideTask(t *testing.T) {
+	expectMarked := func(mock sqlmock.Sqlmock, officerID string) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO "task_assignments" .* ON CONFLICT DO NOTHING`).
+			WithArgs("task-1", "fcau", "officer-a", "officer-a", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT "task_id","officer_id" FROM "task_assignments" WHERE task_id = \$1 .* FOR UPDATE`).
+			WillReturnRows(sqlmock.NewRows([]string{"task_id", "officer_id"}).AddRow("task-1", officerID))
+		if officerID != "officer-a" {
+			mock.ExpectRollback()
+			return
+		}
+		mock.ExpectExec(`UPDATE "task_assignments" SET "completed_by"=\$1 WHERE task_id = \$2`).
+			WithArgs("officer-a", "task-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	t.Run("decides outside the claim and records the officer", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		expectMarked(mock, "officer-a")
+
+		err := NewGormTaskStore(db).DecideTask(context.Background(), "task-1", "fcau", "officer-a", func() error {
+			// The claim is committed before the step runs.
+			assert.NoError(t, mock.ExpectationsWereMet())
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE "task_assignments" SET "completed_at"=\$1 WHERE task_id = \$2 AND completed_by = \$3`).
+				WithArgs(sqlmock.AnyArg(), "task-1", "officer-a").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a failed decision clears the mark", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		expectMarked(mock, "officer-a")
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "task_assignments" SET "completed_by"=\$1 WHERE task_id = \$2 AND completed_by = \$3 AND completed_at IS NULL`).
+			WithArgs(nil, "task-1", "officer-a").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		stepErr := errors.New("task is not awaiting a decision")
+		err := NewGormTaskStore(db).DecideTask(context.Background(), "task-1", "fcau", "officer-a", func() error {
+			return stepErr
+		})
+		assert.ErrorIs(t, err, stepErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a review another officer holds is not decided", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		expectMarked(mock, "officer-b")
+
+		err := NewGormTaskStore(db).DecideTask(context.Background(), "task-1", "fcau", "officer-a", func() error {
+			t.Fatal("decided a review held by another officer")
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrTaskClaimed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAssignTask_RefusesReviewBeingDecided(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "task_assignments" .* ON CONFLICT \("task_id"\) DO UPDATE SET .* WHERE task_assignments.completed_by IS NULL`).
+		WithArgs("task-1", "fcau", "officer-b", "supervisor-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := NewGormTaskStore(db).AssignTask(context.Background(), TaskAssignment{
+		TaskID: "task-1", ServiceID: "fcau", OfficerID: "officer-b", AssignedBy: "supervisor-1",
+	})
+	assert.ErrorIs(t, err, ErrTaskDeciding)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/OpenNSW/nsw-task-flow/store"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+
+	"github.com/OpenNSW/nsw/backend/internal/timeline"
 )
 
 type GormTaskStore struct {
@@ -22,9 +26,39 @@ func (s *GormTaskStore) SaveTask(ctx context.Context, record store.TaskRecord) {
 	model := FromDomain(record)
 	// Upstream store.Store.SaveTask returns no error (nsw-task-flow treats
 	// persistence as best-effort), so the only observability we have for a
-	// failed upsert is a log line.
-	// Explicit DoUpdates so the conflict path doesn't clobber created_at.
-	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+	// failed upsert is a log line. The task and the progress of its
+	// consignment are saved together, so task_progress never lags a committed
+	// task. The timeline event is appended after the task commits: losing an
+	// event must not lose the task state the workflow goes on from.
+	var events []timeline.Event
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var previous TaskRecordModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("task_id", "state").
+			First(&previous, "task_id = ?", model.TaskID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := upsertTask(tx, &model); err != nil {
+			return err
+		}
+		events = taskEvents(model, previous.TaskID != "", previous.State)
+		return refreshProgress(ctx, tx, model.RootWorkflowID)
+	}); err != nil {
+		slog.Error("taskv2 store: SaveTask upsert failed",
+			"taskId", record.TaskID, "rootWorkflowId", model.RootWorkflowID, "error", err)
+		return
+	}
+	if err := timeline.Append(ctx, s.db, events...); err != nil {
+		slog.Error("taskv2 store: SaveTask timeline event not recorded",
+			"taskId", record.TaskID, "rootWorkflowId", model.RootWorkflowID, "error", err)
+	}
+}
+
+// upsertTask inserts or updates model. Explicit DoUpdates so the conflict path
+// doesn't clobber created_at.
+func upsertTask(tx *gorm.DB, model *TaskRecordModel) error {
+	return tx.Clauses(clause.OnConflict{
 		Columns: []clause.Column{{Name: "task_id"}},
 		DoUpdates: clause.AssignmentColumns([]string{
 			"task_type",
@@ -41,9 +75,35 @@ func (s *GormTaskStore) SaveTask(ctx context.Context, record store.TaskRecord) {
 			"data",
 			"updated_at",
 		}),
-	}).Create(&model).Error; err != nil {
-		slog.Error("taskv2 store: SaveTask upsert failed",
-			"taskId", record.TaskID, "error", err)
+	}).Create(model).Error
+}
+
+// taskEvents are the timeline events of saving model over a record that
+// existed (or not) in previousState: its activation, or its change of state.
+// SYSTEM tasks are not shown to users and stay off the timeline.
+func taskEvents(model TaskRecordModel, existed bool, previousState string) []timeline.Event {
+	if model.TaskType == systemTaskType {
+		return nil
+	}
+	switch {
+	case !existed:
+		return []timeline.Event{{
+			ConsignmentID: model.RootWorkflowID,
+			Type:          timeline.TaskActivated,
+			TaskID:        model.TaskID,
+			ToState:       model.State,
+			Details:       map[string]any{"nodeId": model.ParentNodeID, "taskTemplateId": model.ActiveTaskTemplateID},
+		}}
+	case previousState != model.State:
+		return []timeline.Event{{
+			ConsignmentID: model.RootWorkflowID,
+			Type:          timeline.TaskStateChanged,
+			TaskID:        model.TaskID,
+			FromState:     previousState,
+			ToState:       model.State,
+		}}
+	default:
+		return nil
 	}
 }
 
@@ -86,3 +146,79 @@ func (s *GormTaskStore) GetAllTasks(ctx context.Context, parentWorkflowID string
 	}
 	return records
 }
+
+// GetRootWorkflowID returns the root_workflow_id (the owning consignment ID)
+// recorded for taskID.
+func (s *GormTaskStore) GetRootWorkflowID(ctx context.Context, taskID string) (string, bool) {
+	var model TaskRecordModel
+	if err := s.db.WithContext(ctx).Select("task_id", "root_workflow_id").First(&model, "task_id = ?", taskID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("taskv2 store: GetRootWorkflowID db error", "taskId", taskID, "error", err)
+		}
+		return "", false
+	}
+	return model.RootWorkflowID, true
+}
+
+// CancelTasks sets the state of taskIDs to CANCELLED. It runs on tx when one
+// is given, so the caller can cancel tasks atomically with its own changes.
+func (s *GormTaskStore) CancelTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error {
+	return s.setState(ctx, tx, taskIDs, StateCancelled)
+}
+
+// RetryTasks sets the state of taskIDs to RETRYING, on tx when one is given.
+func (s *GormTaskStore) RetryTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error {
+	return s.setState(ctx, tx, taskIDs, StateRetrying)
+}
+
+// SupersedeTasks sets the state of taskIDs to SUPERSEDED, on tx when one is
+// given.
+func (s *GormTaskStore) SupersedeTasks(ctx context.Context, tx *gorm.DB, taskIDs []string) error {
+	return s.setState(ctx, tx, taskIDs, StateSuperseded)
+}
+
+// setState moves taskIDs to state and refreshes the progress of their root
+// workflows, on tx when one is given and otherwise in a transaction of its own.
+func (s *GormTaskStore) setState(ctx context.Context, tx *gorm.DB, taskIDs []string, state string) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	if tx == nil {
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return s.setState(ctx, tx, taskIDs, state)
+		})
+	}
+	var tasks []TaskRecordModel
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("task_id", "task_type", "state", "root_workflow_id").
+		Where("task_id IN ?", taskIDs).
+		Order("task_id").
+		Find(&tasks).Error; err != nil {
+		return err
+	}
+	if err := tx.WithContext(ctx).Model(&TaskRecordModel{}).
+		Where("task_id IN ?", taskIDs).
+		Updates(map[string]any{"state": state, "updated_at": time.Now()}).Error; err != nil {
+		return err
+	}
+
+	var events []timeline.Event
+	var roots []string
+	for _, t := range tasks {
+		if !slices.Contains(roots, t.RootWorkflowID) {
+			roots = append(roots, t.RootWorkflowID)
+		}
+		previousState := t.State
+		t.State = state
+		events = append(events, taskEvents(t, true, previousState)...)
+	}
+	if err := timeline.Append(ctx, tx, events...); err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if err := refreshProgress(ctx, tx, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveTask(t *testing.T) {
+	record := store.TaskRecord{TaskID: "task-1", TaskType: "FORM", State: "COMPLETED", ParentWorkflowID: "cons-1"}
+
+	t.Run("task and progress commit together, then the event", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT "task_id","state" FROM "task_records_v2" WHERE task_id = \$1 .* FOR UPDATE`).
+			WillReturnRows(sqlmock.NewRows([]string{"task_id", "state"}).AddRow("task-1", "PENDING_USER"))
+		mock.ExpectExec(`INSERT INTO "task_records_v2" .* ON CONFLICT \("task_id"\) DO UPDATE`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectProgressRefresh(mock, "cons-1", sqlmock.NewRows([]string{"task_type", "state"}).AddRow("FORM", "COMPLETED"), 1)
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO "consignment_events"`).
+			WithArgs("cons-1", "TASK_STATE_CHANGED", "task-1", "", "PENDING_USER", "COMPLETED", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectCommit()
+
+		NewGormTaskStore(db).SaveTask(context.Background(), record)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a failed event keeps the task", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT "task_id","state" FROM "task_records_v2"`).
+			WillReturnRows(sqlmock.NewRows([]string{"task_id", "state"}).AddRow("task-1", "PENDING_USER"))
+		mock.ExpectExec(`INSERT INTO "task_records_v2"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectProgressRefresh(mock, "cons-1", sqlmock.NewRows([]string{"task_type", "state"}).AddRow("FORM", "COMPLETED"), 1)
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO "consignment_events"`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		NewGormTaskStore(db).SaveTask(context.Background(), record)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a failed refresh rolls the task back", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT "task_id","state" FROM "task_records_v2"`).
+			WillReturnRows(sqlmock.NewRows([]string{"task_id", "state"}).AddRow("task-1", "COMPLETED"))
+		mock.ExpectExec(`INSERT INTO "task_records_v2"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		NewGormTaskStore(db).SaveTask(context.Background(), record)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
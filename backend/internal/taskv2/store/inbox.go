@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/OpenNSW/nsw-task-flow/store"
+
+	"github.com/OpenNSW/nsw/backend/internal/taskv2/plugins"
+)
+
+// closedStates are the task record states in which a task is no longer with
+// anyone; they are left out of task listings.
+var closedStates = []string{"COMPLETED", StateFailed, StateCancelled, StateSuperseded}
+
+// activeConsignmentStates are the consignment states whose tasks a trader's
+// inbox lists: consignment.InProgress and consignment.Stalled.
+var activeConsignmentStates = []string{"IN_PROGRESS", "STALLED"}
+
+// TaskQuery selects open tasks for a task listing. OwnerCompanyID or
+// ServiceID scopes the query to the tasks of the active consignments a
+// company owns, as trader or as CHA, or to the tasks dispatched to a
+// service; a query scoped to neither matches nothing. Empty filters match
+// everything within the scope. AssigneeID and Unassigned select the reviews
+// an officer holds and those no officer holds.
+type TaskQuery struct {
+	OwnerCompanyID string
+	ServiceID      string
+	AssigneeID     string
+	Unassigned     bool
+	TaskTypes      []string
+	States         []string
+	ConsignmentID  string
+	CreatedBefore  *time.Time
+	CreatedAfter   *time.Time
+	Offset         int
+	Limit          int
+}
+
+// ListTasks returns a page of the open tasks matching q, oldest first, and
+// the number of tasks matching q in total. Closed and SYSTEM tasks are never
+// listed. A company's tasks are found by joining their consignments.
+func (s *GormTaskStore) ListTasks(ctx context.Context, q TaskQuery) ([]store.TaskRecord, int64, error) {
+	if q.OwnerCompanyID == "" && q.ServiceID == "" {
+		return []store.TaskRecord{}, 0, nil
+	}
+	query := s.db.WithContext(ctx).Model(&TaskRecordModel{}).
+		Where("task_records_v2.state NOT IN ?", closedStates).
+		Where("task_records_v2.task_type <> ?", systemTaskType)
+	if q.OwnerCompanyID != "" {
+		query = query.Joins("JOIN consignments ON consignments.id = task_records_v2.root_workflow_id").
+			Where("consignments.state IN ?", activeConsignmentStates).
+			Where("consignments.trader_company_id = ? OR consignments.cha_company_id = ?", q.OwnerCompanyID, q.OwnerCompanyID)
+	}
+	if q.ServiceID != "" {
+		query = query.Where("task_records_v2.data->>'"+plugins.DispatchedServiceIDKey+"' = ?", q.ServiceID)
+	}
+	if q.AssigneeID != "" {
+		query = query.Where("task_records_v2.task_id IN (SELECT task_id FROM task_assignments WHERE officer_id = ?)", q.AssigneeID)
+	}
+	if q.Unassigned {
+		query = query.Where("task_records_v2.task_id NOT IN (SELECT task_id FROM task_assignments)")
+	}
+	if len(q.TaskTypes) > 0 {
+		query = query.Where("task_records_v2.task_type IN ?", q.TaskTypes)
+	}
+	if len(q.States) > 0 {
+		query = query.Where("task_records_v2.state IN ?", q.States)
+	}
+	if q.ConsignmentID != "" {
+		query = query.Where("task_records_v2.root_workflow_id = ?", q.ConsignmentID)
+	}
+	if q.CreatedBefore != nil {
+		query = query.Where("task_records_v2.created_at <= ?", *q.CreatedBefore)
+	}
+	if q.CreatedAfter != nil {
+		query = query.Where("task_records_v2.created_at >= ?", *q.CreatedAfter)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("count tasks: %w", err)
+	}
+	var models []TaskRecordModel
+	if err := query.Select("task_records_v2.*").
+		Order("task_records_v2.created_at, task_records_v2.task_id").
+		Offset(q.Offset).Limit(q.Limit).Find(&models).Error; err != nil {
+		return nil, 0, fmt.Errorf("list tasks: %w", err)
+	}
+
+	records := make([]store.TaskRecord, len(models))
+	for i, m := range models {
+		records[i] = m.ToDomain()
+	}
+	return records, total, nil
+}
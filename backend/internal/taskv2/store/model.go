@@ -9,6 +9,21 @@ import (
 	"github.com/OpenNSW/nsw-task-flow/store"
 )
 
+// Task record states set outside the plugins.
+const (
+	// StateCancelled is the state of a task closed because its consignment was
+	// cancelled.
+	StateCancelled = "CANCELLED"
+	// StateFailed is the state nsw-task-flow gives a task whose workflow failed.
+	StateFailed = "FAILED"
+	// StateRetrying is the state of a failed task whose workflow support staff
+	// have reset; the plugin sets the next state as the task runs again.
+	StateRetrying = "RETRYING"
+	// StateSuperseded is the state of a completed task re-opened by a
+	// consignment amendment; a new task for the same node replaces it.
+	StateSuperseded = "SUPERSEDED"
+)
+
 // TaskRecordModel is the GORM-compatible model for nsw-task-flow's TaskRecord.
 type TaskRecordModel struct {
 	TaskID                string          `gorm:"primaryKey;column:task_id;type:text"`
@@ -68,26 +83,13 @@ func FromDomain(r store.TaskRecord) TaskRecordModel {
 	if err != nil {
 		slog.Error("taskv2 store: FromDomain failed to marshal Data", "taskId", r.TaskID, "error", err)
 	}
-	// root_workflow_id is the top-level consignment ID — the first segment of
-	// parent_workflow_id before any "--" separator introduced by SPLIT_TASK
-	// child workflow IDs (format: "{root}--{nodeID}--{branchID}").
-	//
-	// TODO: this is a stop-gap string-parsing derivation (duplicated in
-	// internal/taskv2/plugins/external_review.go's rootWorkflowID). Replace
-	// both once the engine threads a RootWorkflowID through
-	// TaskPayload/TaskRecord natively (propagated via SPLIT_TASK /
-	// dynamic_split.go childVars) so we can copy r.RootWorkflowID directly.
-	rootWorkflowID := r.ParentWorkflowID
-	if idx := strings.Index(r.ParentWorkflowID, "--"); idx != -1 {
-		rootWorkflowID = r.ParentWorkflowID[:idx]
-	}
 	return TaskRecordModel{
 		TaskID:                r.TaskID,
 		TaskType:              r.TaskType,
 		State:                 r.State,
 		RenderConfig:          r.RenderConfig,
 		ParentWorkflowID:      r.ParentWorkflowID,
-		RootWorkflowID:        rootWorkflowID,
+		RootWorkflowID:        RootWorkflowID(r.ParentWorkflowID),
 		ParentRunID:           r.ParentRunID,
 		ParentNodeID:          r.ParentNodeID,
 		TaskWorkflowID:        r.TaskWorkflowID,
@@ -98,3 +100,19 @@ func FromDomain(r store.TaskRecord) TaskRecordModel {
 		Data:                  dataBytes,
 	}
 }
+
+// RootWorkflowID returns the top-level consignment ID of a task whose parent
+// workflow is parentWorkflowID — the first segment before any "--" separator
+// introduced by SPLIT_TASK child workflow IDs (format: "{root}--{nodeID}--{branchID}").
+//
+// TODO: this is a stop-gap string-parsing derivation (duplicated in
+// internal/taskv2/plugins/external_review.go's rootWorkflowID). Replace
+// both once the engine threads a RootWorkflowID through
+// TaskPayload/TaskRecord natively (propagated via SPLIT_TASK /
+// dynamic_split.go childVars) so we can copy r.RootWorkflowID directly.
+func RootWorkflowID(parentWorkflowID string) string {
+	if idx := strings.Index(parentWorkflowID, "--"); idx != -1 {
+		return parentWorkflowID[:idx]
+	}
+	return parentWorkflowID
+}
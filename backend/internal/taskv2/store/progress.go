@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/OpenNSW/nsw-task-flow/store"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Task record states that place a task with a party. PENDING_USER and
+// PENDING_PAYMENT wait on the trader; QUEUED_EXTERNALLY is an external review
+// dispatched to an OGA (plugins.StateQueuedExternally).
+var (
+	awaitingTraderStates = map[string]bool{"PENDING_USER": true, "PENDING_PAYMENT": true}
+	awaitingOGAStates    = map[string]bool{"QUEUED_EXTERNALLY": true}
+)
+
+// systemTaskType marks tasks run by the platform itself; they are not shown
+// to users and not counted towards progress.
+const systemTaskType = "SYSTEM"
+
+// TaskProgress is the task_progress projection: the tasks of one root workflow
+// (a consignment) counted by where they stand. It is rewritten from
+// task_records_v2 whenever one of those tasks is saved, so listings can read
+// progress without loading task records. Tasks that failed or were cancelled
+// count towards Total only; superseded tasks are not counted, their
+// replacements are.
+type TaskProgress struct {
+	RootWorkflowID string    `gorm:"primaryKey;column:root_workflow_id;type:text"`
+	Total          int       `gorm:"column:total;not null"`
+	Completed      int       `gorm:"column:completed;not null"`
+	InProgress     int       `gorm:"column:in_progress;not null"`
+	AwaitingTrader int       `gorm:"column:awaiting_trader;not null"`
+	AwaitingOGA    int       `gorm:"column:awaiting_oga;not null"`
+	UpdatedAt      time.Time `gorm:"column:updated_at;type:timestamptz;not null;autoUpdateTime"`
+}
+
+func (TaskProgress) TableName() string {
+	return "task_progress"
+}
+
+// Counts reports whether a task of taskType in state counts towards progress,
+// which excludes SYSTEM tasks and tasks superseded by an amendment.
+func Counts(taskType, state string) bool {
+	return taskType != systemTaskType && state != StateSuperseded
+}
+
+func (p *TaskProgress) add(taskType, state string) {
+	if !Counts(taskType, state) {
+		return
+	}
+	p.Total++
+	switch {
+	case state == "COMPLETED":
+		p.Completed++
+	case awaitingTraderStates[state]:
+		p.AwaitingTrader++
+	case awaitingOGAStates[state]:
+		p.AwaitingOGA++
+	case state != StateFailed && state != StateCancelled:
+		p.InProgress++
+	}
+}
+
+// ProgressOf counts records, the tasks of rootWorkflowID, as the projection
+// does.
+func ProgressOf(rootWorkflowID string, records []store.TaskRecord) TaskProgress {
+	p := TaskProgress{RootWorkflowID: rootWorkflowID}
+	for _, r := range records {
+		p.add(r.TaskType, r.State)
+	}
+	return p
+}
+
+// refreshProgress rewrites the task_progress row of rootWorkflowID from its
+// task records. It must run on a transaction: the advisory lock it takes
+// serializes refreshes of the same root workflow, so the last one to commit
+// has counted every task saved before it.
+func refreshProgress(ctx context.Context, tx *gorm.DB, rootWorkflowID string) error {
+	if rootWorkflowID == "" {
+		return nil
+	}
+	if err := tx.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(hashtext(?))", rootWorkflowID).Error; err != nil {
+		return fmt.Errorf("lock progress of %s: %w", rootWorkflowID, err)
+	}
+
+	var tasks []TaskRecordModel
+	if err := tx.WithContext(ctx).Select("task_type", "state").
+		Where("root_workflow_id = ?", rootWorkflowID).
+		Find(&tasks).Error; err != nil {
+		return fmt.Errorf("load tasks of %s: %w", rootWorkflowID, err)
+	}
+	p := TaskProgress{RootWorkflowID: rootWorkflowID}
+	for _, t := range tasks {
+		p.add(t.TaskType, t.State)
+	}
+
+	if err := tx.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "root_workflow_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"total", "completed", "in_progress", "awaiting_trader", "awaiting_oga", "updated_at"}),
+	}).Create(&p).Error; err != nil {
+		return fmt.Errorf("save progress of %s: %w", rootWorkflowID, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/OpenNSW/nsw-task-flow/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open gorm: %v", err)
+	}
+	return gormDB, mock
+}
+
+// expectProgressRefresh expects refreshProgress of rootWorkflowID to count
+// the tasks in rows and save total tasks.
+func expectProgressRefresh(mock sqlmock.Sqlmock, rootWorkflowID string, rows *sqlmock.Rows, total int) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).
+		WithArgs(rootWorkflowID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT "task_type","state" FROM "task_records_v2" WHERE root_workflow_id = \$1`).
+		WithArgs(rootWorkflowID).
+		WillReturnRows(rows)
+	mock.ExpectExec(`INSERT INTO "task_progress" .* ON CONFLICT \("root_workflow_id"\) DO UPDATE SET "total"="excluded"."total",.*"awaiting_oga"="excluded"."awaiting_oga"`).
+		WithArgs(rootWorkflowID, total, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestProgressOf(t *testing.T) {
+	records := []store.TaskRecord{
+		{TaskType: "FORM", State: "COMPLETED"},
+		{TaskType: "FORM", State: "PENDING_USER"},
+		{TaskType: "PAYMENT", State: "PENDING_PAYMENT"},
+		{TaskType: "EXTERNAL_REVIEW", State: "QUEUED_EXTERNALLY"},
+		{TaskType: "FORM", State: "IN_PROGRESS"},
+		{TaskType: "FORM", State: StateRetrying},
+		{TaskType: "FORM", State: StateFailed},
+		{TaskType: "FORM", State: StateCancelled},
+		{TaskType: "FORM", State: StateSuperseded},
+		{TaskType: "SYSTEM", State: "IN_PROGRESS"},
+	}
+
+	assert.Equal(t, TaskProgress{
+		RootWorkflowID: "cons-1",
+		Total:          8,
+		Completed:      1,
+		InProgress:     2,
+		AwaitingTrader: 2,
+		AwaitingOGA:    1,
+	}, ProgressOf("cons-1", records))
+}
+
+func TestCounts(t *testing.T) {
+	assert.True(t, Counts("FORM", "COMPLETED"))
+	assert.False(t, Counts("SYSTEM", "COMPLETED"))
+	assert.False(t, Counts("FORM", StateSuperseded))
+}
+
+func TestRefreshProgress(t *testing.T) {
+	t.Run("counts the tasks of the root workflow under its lock", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		mock.ExpectBegin()
+		expectProgressRefresh(mock, "cons-1", sqlmock.NewRows([]string{"task_type", "state"}).
+			AddRow("FORM", "COMPLETED").
+			AddRow("FORM", "PENDING_USER").
+			AddRow("EXTERNAL_REVIEW", "QUEUED_EXTERNALLY").
+			AddRow("SYSTEM", "IN_PROGRESS").
+			AddRow("FORM", StateSuperseded), 3)
+		mock.ExpectCommit()
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return refreshProgress(context.Background(), tx, "cons-1")
+		})
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("tasks outside a consignment have no progress", func(t *testing.T) {
+		db, mock := setupTestDB(t)
+		require.NoError(t, refreshProgress(context.Background(), db, ""))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestTaskProgressBackfill runs the 031 migration and checks that its
+// backfill counts the same buckets as TaskProgress.add.
+func TestTaskProgressBackfill(t *testing.T) {
+	migration, err := os.ReadFile("../../database/migrations/031_create_task_progress.up.sql")
+	require.NoError(t, err)
+
+	db, mock := setupTestDB(t)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS task_progress .* ` +
+		`INSERT INTO task_progress \(root_workflow_id, total, completed, in_progress, awaiting_trader, awaiting_oga\) SELECT .* ` +
+		`FROM task_records_v2 WHERE root_workflow_id <> '' AND task_type IS DISTINCT FROM 'SYSTEM' ` +
+		`GROUP BY root_workflow_id ON CONFLICT \(root_workflow_id\) DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	require.NoError(t, db.Exec(string(migration)).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// The FILTERs of completed, in_progress, awaiting_trader and awaiting_oga.
+	filters := regexp.MustCompile(`FILTER \(WHERE (.*)\),?\n`).FindAllStringSubmatch(string(migration), -1)
+	require.Len(t, filters, 4)
+	completed, inProgress, awaitingTrader, awaitingOGA := filters[0][1], filters[1][1], filters[2][1], filters[3][1]
+
+	assert.Equal(t, "state = 'COMPLETED'", completed)
+	for state := range awaitingTraderStates {
+		assert.Contains(t, awaitingTrader, "'"+state+"'")
+		assert.Contains(t, inProgress, "'"+state+"'", "in_progress must exclude %s", state)
+	}
+	for state := range awaitingOGAStates {
+		assert.Contains(t, awaitingOGA, "'"+state+"'")
+		assert.Contains(t, inProgress, "'"+state+"'", "in_progress must exclude %s", state)
+	}
+	for _, state := range []string{"COMPLETED", StateFailed, StateCancelled} {
+		assert.Contains(t, inProgress, "'"+state+"'", "in_progress must exclude %s", state)
+	}
+}
@@ -0,0 +1,133 @@
+// Package timeline keeps the consignment_events log: an append-only record of
+// what happened on a consignment, who did it and when. The payment handlers
+// and the consignment service append to it in the transaction making the
+// change where there is one; the task store and task handler append once the
+// change is committed, so a lost event never loses task state. The
+// consignment service pages through it for the timeline endpoint.
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Type is the kind of event.
+type Type string
+
+const (
+	// TaskActivated: a task was created for a workflow node.
+	TaskActivated Type = "TASK_ACTIVATED"
+	// TaskStateChanged: a task moved from FromState to ToState.
+	TaskStateChanged Type = "TASK_STATE_CHANGED"
+	// CommandSubmitted: a user submitted a step of a task.
+	CommandSubmitted Type = "COMMAND_SUBMITTED"
+	// OGACallbackReceived: an OGA posted its decision on a task dispatched to it.
+	OGACallbackReceived Type = "OGA_CALLBACK_RECEIVED"
+	// PaymentStatusChanged: a payment transaction moved from FromState to ToState.
+	PaymentStatusChanged Type = "PAYMENT_STATUS_CHANGED"
+	// ConsignmentStateChanged: the consignment moved from FromState to ToState.
+	ConsignmentStateChanged Type = "CONSIGNMENT_STATE_CHANGED"
+	// ConsignmentAmended: the trader amended the consignment's global context.
+	ConsignmentAmended Type = "CONSIGNMENT_AMENDED"
+)
+
+// Event is one entry of a consignment's timeline. Rows are never updated or
+// deleted; the database rejects both.
+type Event struct {
+	ID            int64          `gorm:"column:id;primaryKey;autoIncrement"`
+	ConsignmentID string         `gorm:"type:text;column:consignment_id;not null"`
+	Type          Type           `gorm:"type:varchar(50);column:type;not null"`
+	TaskID        string         `gorm:"type:text;column:task_id;not null;default:''"`       // Task concerned, if any
+	Actor         string         `gorm:"type:varchar(100);column:actor;not null;default:''"` // User or machine client; empty for the platform
+	FromState     string         `gorm:"type:varchar(50);column:from_state;not null;default:''"`
+	ToState       string         `gorm:"type:varchar(50);column:to_state;not null;default:''"`
+	Details       map[string]any `gorm:"type:jsonb;column:details;serializer:json"`
+	CreatedAt     time.Time      `gorm:"type:timestamptz;column:created_at;not null;autoCreateTime"`
+}
+
+func (Event) TableName() string {
+	return "consignment_events"
+}
+
+// Append writes events on db, which should be the transaction making the
+// change they record. Events without a consignment are dropped: tasks and
+// payments outside a consignment have no timeline.
+func Append(ctx context.Context, db *gorm.DB, events ...Event) error {
+	var rows []Event
+	for _, e := range events {
+		if e.ConsignmentID != "" {
+			rows = append(rows, e)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := db.WithContext(ctx).Create(&rows).Error; err != nil {
+		return fmt.Errorf("failed to append %s event to consignment %s: %w", rows[0].Type, rows[0].ConsignmentID, err)
+	}
+	return nil
+}
+
+// Recorder appends events outside a transaction, for writers that do not
+// own the change they record.
+type Recorder struct {
+	db *gorm.DB
+}
+
+// NewRecorder creates a recorder writing to db.
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+// Record appends events.
+func (r *Recorder) Record(ctx context.Context, events ...Event) error {
+	return Append(ctx, r.db, events...)
+}
+
+// List returns a page of the events of consignmentID, oldest first, and the
+// number of events in all.
+func List(ctx context.Context, db *gorm.DB, consignmentID string, offset, limit int) ([]Event, int64, error) {
+	var total int64
+	if err := db.WithContext(ctx).Model(&Event{}).Where("consignment_id = ?", consignmentID).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count events of consignment %s: %w", consignmentID, err)
+	}
+	var events []Event
+	if err := db.WithContext(ctx).
+		Where("consignment_id = ?", consignmentID).
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list events of consignment %s: %w", consignmentID, err)
+	}
+	return events, total, nil
+}
+
+// EventDTO is an event in timeline responses.
+type EventDTO struct {
+	ID        int64          `json:"id"`
+	Type      Type           `json:"type"`
+	TaskID    string         `json:"taskId,omitempty"`
+	Actor     string         `json:"actor,omitempty"`
+	FromState string         `json:"fromState,omitempty"`
+	ToState   string         `json:"toState,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt string         `json:"createdAt"`
+}
+
+// ToDTO converts e for a response.
+func (e *Event) ToDTO() EventDTO {
+	return EventDTO{
+		ID:        e.ID,
+		Type:      e.Type,
+		TaskID:    e.TaskID,
+		Actor:     e.Actor,
+		FromState: e.FromState,
+		ToState:   e.ToState,
+		Details:   e.Details,
+		CreatedAt: e.CreatedAt.Format(time.RFC3339),
+	}
+}
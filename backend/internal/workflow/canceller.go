@@ -0,0 +1,34 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+)
+
+// Canceller requests cancellation of workflows on the shared Temporal client,
+// whichever queue they run on: parent workflows, their SPLIT_TASK children and
+// the per-task (micro) workflows alike.
+type Canceller struct {
+	client client.Client
+}
+
+// NewCanceller builds a Canceller on c.
+func NewCanceller(c client.Client) *Canceller {
+	return &Canceller{client: c}
+}
+
+// CancelWorkflow requests cancellation of the latest run of workflowID. A
+// workflow that has already closed (or never existed) is treated as
+// cancelled, so callers may retry a partially applied cancellation.
+func (k *Canceller) CancelWorkflow(ctx context.Context, workflowID string) error {
+	err := k.client.CancelWorkflow(ctx, workflowID, "")
+	var notFound *serviceerror.NotFound
+	if err == nil || errors.As(err, &notFound) {
+		return nil
+	}
+	return fmt.Errorf("workflow: cancel %s: %w", workflowID, err)
+}
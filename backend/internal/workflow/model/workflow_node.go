@@ -56,6 +56,7 @@ type WorkflowNodeResponseDTO struct {
 	State                WorkflowNodeState               `json:"state"`                   // State of the workflow node
 	ExtendedState        *string                         `json:"extendedState,omitempty"` // Optional extended state information (e.g., error details)
 	Outcome              *string                         `json:"outcome,omitempty"`       // Outcome sub-state when COMPLETED
+	HSCodeIDs            []string                        `json:"hsCodeIds,omitempty"`     // HS codes of the consignment items the node works for
 }
 
 // WorkflowNodeTemplateResponseDTO represents workflow node template details in the response.
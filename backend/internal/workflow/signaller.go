@@ -0,0 +1,52 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+)
+
+// TaskRevisedSignal is the signal a parent workflow receives when a task at a
+// node it has already completed is run again, such as an OGA re-review after
+// an amendment. It carries a TaskRevision.
+const TaskRevisedSignal = "TASK_REVISED"
+
+// TaskRevision is the payload of TaskRevisedSignal: the node whose task was
+// run again and the outputs of the new run.
+type TaskRevision struct {
+	NodeID  string         `json:"nodeId"`
+	Outputs map[string]any `json:"outputs"`
+}
+
+// Signaller delivers signals to parent workflows on the shared Temporal
+// client.
+type Signaller struct {
+	client client.Client
+}
+
+// NewSignaller builds a Signaller on c.
+func NewSignaller(c client.Client) *Signaller {
+	return &Signaller{client: c}
+}
+
+// SignalTaskRevised sends TaskRevisedSignal to the latest run of workflowID.
+// A workflow that has already closed can no longer act on the revision; that
+// is logged and not treated as an error, so the task completion is not
+// retried forever.
+func (s *Signaller) SignalTaskRevised(ctx context.Context, workflowID, nodeID string, outputs map[string]any) error {
+	err := s.client.SignalWorkflow(ctx, workflowID, "", TaskRevisedSignal, TaskRevision{NodeID: nodeID, Outputs: outputs})
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		slog.WarnContext(ctx, "revised task outcome arrived after its workflow closed",
+			"workflowId", workflowID, "nodeId", nodeID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("workflow: signal %s: %w", workflowID, err)
+	}
+	return nil
+}
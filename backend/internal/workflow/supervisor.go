@@ -0,0 +1,127 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+
+	"github.com/OpenNSW/nsw/backend/internal/workflow/model"
+)
+
+// ErrNothingToReset is returned by ResetWorkflow for a run that has not yet
+// completed a workflow task, so there is no good point to resume from.
+var ErrNothingToReset = errors.New("workflow has no completed workflow task to reset to")
+
+// Supervisor reports on and repairs workflows on the shared Temporal client.
+// Like Canceller it works on any queue: parent workflows and task workflows
+// alike.
+type Supervisor struct {
+	client    client.Client
+	namespace string
+}
+
+// NewSupervisor builds a Supervisor on c. namespace must be the namespace c
+// is connected to; resets are addressed to it explicitly.
+func NewSupervisor(c client.Client, namespace string) *Supervisor {
+	return &Supervisor{client: c, namespace: namespace}
+}
+
+// DescribeWorkflow reports the status of the latest run of workflowID. A run
+// that closed without completing (failed, timed out, terminated or cancelled)
+// is reported as model.WorkflowStatusFailed along with why it closed.
+func (s *Supervisor) DescribeWorkflow(ctx context.Context, workflowID string) (model.WorkflowStatus, string, error) {
+	resp, err := s.client.DescribeWorkflowExecution(ctx, workflowID, "")
+	if err != nil {
+		return "", "", fmt.Errorf("workflow: describe %s: %w", workflowID, err)
+	}
+	switch resp.GetWorkflowExecutionInfo().GetStatus() {
+	case enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, enumspb.WORKFLOW_EXECUTION_STATUS_CONTINUED_AS_NEW:
+		return model.WorkflowStatusInProgress, "", nil
+	case enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED:
+		return model.WorkflowStatusCompleted, "", nil
+	}
+
+	reason, err := s.closeReason(ctx, workflowID)
+	if err != nil {
+		return "", "", err
+	}
+	return model.WorkflowStatusFailed, reason, nil
+}
+
+// closeReason describes the close event of the latest run of workflowID.
+func (s *Supervisor) closeReason(ctx context.Context, workflowID string) (string, error) {
+	iter := s.client.GetWorkflowHistory(ctx, workflowID, "", false, enumspb.HISTORY_EVENT_FILTER_TYPE_CLOSE_EVENT)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			return "", fmt.Errorf("workflow: read close event of %s: %w", workflowID, err)
+		}
+		if reason := describeCloseEvent(event); reason != "" {
+			return reason, nil
+		}
+	}
+	return "workflow closed without completing", nil
+}
+
+func describeCloseEvent(event *historypb.HistoryEvent) string {
+	switch event.GetEventType() {
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED:
+		return "workflow failed: " + event.GetWorkflowExecutionFailedEventAttributes().GetFailure().GetMessage()
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT:
+		return "workflow timed out"
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED:
+		if reason := event.GetWorkflowExecutionTerminatedEventAttributes().GetReason(); reason != "" {
+			return "workflow terminated: " + reason
+		}
+		return "workflow terminated"
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED:
+		return "workflow cancelled"
+	default:
+		return ""
+	}
+}
+
+// ResetWorkflow starts a new run of workflowID from the last workflow task its
+// latest run completed, discarding whatever failed after it; activities
+// scheduled from that point are executed again. The latest run is terminated
+// if it is still open. Each call starts another run, so it is not idempotent.
+func (s *Supervisor) ResetWorkflow(ctx context.Context, workflowID, reason string) error {
+	lastGood, err := s.lastCompletedWorkflowTask(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.ResetWorkflowExecution(ctx, &workflowservice.ResetWorkflowExecutionRequest{
+		Namespace:                 s.namespace,
+		WorkflowExecution:         &commonpb.WorkflowExecution{WorkflowId: workflowID},
+		Reason:                    reason,
+		WorkflowTaskFinishEventId: lastGood,
+	})
+	if err != nil {
+		return fmt.Errorf("workflow: reset %s: %w", workflowID, err)
+	}
+	return nil
+}
+
+func (s *Supervisor) lastCompletedWorkflowTask(ctx context.Context, workflowID string) (int64, error) {
+	var lastGood int64
+	iter := s.client.GetWorkflowHistory(ctx, workflowID, "", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			return 0, fmt.Errorf("workflow: read history of %s: %w", workflowID, err)
+		}
+		if event.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED {
+			lastGood = event.GetEventId()
+		}
+	}
+	if lastGood == 0 {
+		return 0, fmt.Errorf("workflow: reset %s: %w", workflowID, ErrNothingToReset)
+	}
+	return lastGood, nil
+}
@@ -0,0 +1,56 @@
+package workflow
+
+import (
+	"testing"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	failurepb "go.temporal.io/api/failure/v1"
+	historypb "go.temporal.io/api/history/v1"
+)
+
+func TestDescribeCloseEvent(t *testing.T) {
+	cases := map[string]struct {
+		event *historypb.HistoryEvent
+		want  string
+	}{
+		"failed": {
+			event: &historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED,
+				Attributes: &historypb.HistoryEvent_WorkflowExecutionFailedEventAttributes{
+					WorkflowExecutionFailedEventAttributes: &historypb.WorkflowExecutionFailedEventAttributes{
+						Failure: &failurepb.Failure{Message: "node node_5 has no outgoing edge"},
+					},
+				},
+			},
+			want: "workflow failed: node node_5 has no outgoing edge",
+		},
+		"timed out": {
+			event: &historypb.HistoryEvent{EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT},
+			want:  "workflow timed out",
+		},
+		"terminated with a reason": {
+			event: &historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED,
+				Attributes: &historypb.HistoryEvent_WorkflowExecutionTerminatedEventAttributes{
+					WorkflowExecutionTerminatedEventAttributes: &historypb.WorkflowExecutionTerminatedEventAttributes{Reason: "stuck since upgrade"},
+				},
+			},
+			want: "workflow terminated: stuck since upgrade",
+		},
+		"terminated": {
+			event: &historypb.HistoryEvent{EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED},
+			want:  "workflow terminated",
+		},
+		"not a close event": {
+			event: &historypb.HistoryEvent{EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED},
+			want:  "",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := describeCloseEvent(tc.event); got != tc.want {
+				t.Errorf("describeCloseEvent() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
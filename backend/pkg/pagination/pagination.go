@@ -10,11 +10,14 @@ const pageSizeDefault = 50
 const pageSizeMax = 100
 
 // Page is the standard pagination envelope returned by all list endpoints.
+// Endpoints that support keyset pagination also set NextCursor when another page may
+// follow; pages fetched by cursor are not counted and report a Total of -1.
 type Page[T any] struct {
-	Items  []T   `json:"items"`
-	Total  int64 `json:"total"`
-	Offset int   `json:"offset"`
-	Limit  int   `json:"limit"`
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Offset     int    `json:"offset"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // NewPageResult constructs a Page from items and pagination metadata, ensuring Items is never nil.
@@ -107,3 +107,26 @@ func intPtrEq(got, want *int) bool {
 		return *got == *want
 	}
 }
+
+func TestCursor(t *testing.T) {
+	type position struct {
+		At string `json:"at"`
+		ID string `json:"id"`
+	}
+	cursor, err := EncodeCursor(position{At: "2026-01-02T03:04:05Z", ID: "c-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got position
+	if err := DecodeCursor(cursor, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.At != "2026-01-02T03:04:05Z" || got.ID != "c-1" {
+		t.Fatalf("unexpected position: %+v", got)
+	}
+
+	if err := DecodeCursor("not a cursor!", &got); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
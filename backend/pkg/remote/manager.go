@@ -19,7 +19,10 @@ type AuthConfig struct {
 }
 
 type ServiceConfig struct {
-	ID      string      `json:"id"`
+	ID string `json:"id"`
+	// Name is the display name of the organization behind the service, e.g.
+	// the OGA a payment is collected for.
+	Name    string      `json:"name,omitempty"`
 	URL     string      `json:"url"`
 	Timeout string      `json:"timeout"`
 	Auth    *AuthConfig `json:"auth,omitempty"`
@@ -218,3 +221,11 @@ func (m *Manager) ListServices() []string {
 	}
 	return ids
 }
+
+// ServiceName returns the display name configured for a service, or "" if the
+// service is unknown or unnamed.
+func (m *Manager) ServiceName(id string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.configs[id].Name
+}
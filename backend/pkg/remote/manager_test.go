@@ -211,3 +211,13 @@ func TestManager_Call_Integration(t *testing.T) {
 	err := manager.Call(context.Background(), "test", Request{Method: "GET", Path: "/"}, nil)
 	assert.NoError(t, err)
 }
+
+func TestManager_ServiceName(t *testing.T) {
+	manager := NewManager()
+	manager.configs["fcau"] = ServiceConfig{ID: "fcau", Name: "Food Control Administration Unit", URL: "http://local"}
+	manager.configs["npqs"] = ServiceConfig{ID: "npqs", URL: "http://local"}
+
+	assert.Equal(t, "Food Control Administration Unit", manager.ServiceName("fcau"))
+	assert.Empty(t, manager.ServiceName("npqs"))
+	assert.Empty(t, manager.ServiceName("unknown"))
+}
@@ -28,6 +28,9 @@ var allowedContentTypes = map[string]struct{}{
 	"image/png":       {},
 	"image/gif":       {},
 	"image/webp":      {},
+	// Bulk consignment import files.
+	"text/csv": {},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": {},
 }
 
 func isAllowedContentType(ct string) bool {
@@ -2,18 +2,26 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"path/filepath"
 
+	"github.com/OpenNSW/nsw/backend/internal/auth"
 	"github.com/OpenNSW/nsw/backend/pkg/storage/drivers"
 	"github.com/google/uuid"
 )
 
+// ErrUploadNotRecorded is returned for a key no upload was recorded for.
+var ErrUploadNotRecorded = errors.New("upload not recorded")
+
 // Service coordinates file storage operations and manages metadata
 type Service struct {
 	Driver StorageDriver
+	// Uploads, when set, records the organisation of the user preparing each
+	// upload.
+	Uploads UploadRegistry
 }
 
 func NewService(driver StorageDriver) *Service {
@@ -36,6 +44,12 @@ func (s *Service) Upload(ctx context.Context, filename string, size int64, mime
 		return nil, fmt.Errorf("failed to generate upload URL: %w", err)
 	}
 
+	if ouHandle := auth.GetAuthContext(ctx).OUHandle(); s.Uploads != nil && ouHandle != "" {
+		if err := s.Uploads.RecordUpload(ctx, key, ouHandle); err != nil {
+			return nil, fmt.Errorf("failed to record upload: %w", err)
+		}
+	}
+
 	metadata := &FileMetadata{
 		ID:        id,
 		Name:      filename,
@@ -54,6 +68,15 @@ func (s *Service) Download(ctx context.Context, key string) (io.ReadCloser, stri
 	return s.Driver.Get(ctx, key)
 }
 
+// UploadOwner returns the OU handle of the organisation key was uploaded for,
+// or ErrUploadNotRecorded.
+func (s *Service) UploadOwner(ctx context.Context, key string) (string, error) {
+	if s.Uploads == nil {
+		return "", ErrUploadNotRecorded
+	}
+	return s.Uploads.UploadOwner(ctx, key)
+}
+
 // GetDownloadURL generates a time-limited or presigned URL for the given key
 func (s *Service) GetDownloadURL(ctx context.Context, key string) (string, error) {
 	return s.Driver.GetDownloadURL(ctx, key)
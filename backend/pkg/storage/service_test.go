@@ -6,6 +6,8 @@ import (
 	"errors"
 	"io"
 	"testing"
+
+	"github.com/OpenNSW/nsw/backend/internal/auth"
 )
 
 // MockDriver implements StorageDriver for testing
@@ -77,6 +79,42 @@ func TestUploadService(t *testing.T) {
 	}
 }
 
+// mapUploads is an in-memory UploadRegistry.
+type mapUploads map[string]string
+
+func (m mapUploads) RecordUpload(_ context.Context, key, ouHandle string) error {
+	m[key] = ouHandle
+	return nil
+}
+
+func (m mapUploads) UploadOwner(_ context.Context, key string) (string, error) {
+	owner, ok := m[key]
+	if !ok {
+		return "", ErrUploadNotRecorded
+	}
+	return owner, nil
+}
+
+func TestUploadService_RecordsOwner(t *testing.T) {
+	uploads := mapUploads{}
+	service := NewService(&MockDriver{})
+	service.Uploads = uploads
+
+	ctx := withAuthContext(context.Background(), &auth.AuthContext{User: &auth.UserContext{ID: "trader-1", OUHandle: "trader-ou"}})
+	metadata, err := service.Upload(ctx, "batch.csv", 512, "text/csv")
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	owner, err := service.UploadOwner(context.Background(), metadata.Key)
+	if err != nil || owner != "trader-ou" {
+		t.Errorf("expected owner trader-ou, got %q (%v)", owner, err)
+	}
+	if _, err := service.UploadOwner(context.Background(), "unknown.csv"); !errors.Is(err, ErrUploadNotRecorded) {
+		t.Errorf("expected ErrUploadNotRecorded, got %v", err)
+	}
+}
+
 func TestUploadService_Download(t *testing.T) {
 	mock := &MockDriver{
 		SavedBody: []byte("test content"),
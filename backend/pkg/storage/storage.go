@@ -22,3 +22,14 @@ type StorageDriver interface {
 	// GetUploadURL returns a presigned URL for uploading a file directly to storage
 	GetUploadURL(ctx context.Context, key string, contentType string, maxSizeBytes int64) (string, error)
 }
+
+// UploadRegistry remembers the organisation each upload was prepared for, so
+// that a service handed a key can check it belongs to the caller.
+type UploadRegistry interface {
+	// RecordUpload records that key was prepared for the organisation ouHandle.
+	RecordUpload(ctx context.Context, key, ouHandle string) error
+
+	// UploadOwner returns the organisation key was prepared for, or
+	// ErrUploadNotRecorded.
+	UploadOwner(ctx context.Context, key string) (string, error)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadRecord is the organisation an upload was prepared for.
+type UploadRecord struct {
+	Key       string    `gorm:"type:text;column:key;primaryKey"`
+	OUHandle  string    `gorm:"type:text;column:ou_handle;not null"`
+	CreatedAt time.Time `gorm:"type:timestamptz;column:created_at;not null;autoCreateTime"`
+}
+
+func (UploadRecord) TableName() string {
+	return "storage_uploads"
+}
+
+// GormUploadRegistry is an UploadRegistry backed by the storage_uploads table.
+type GormUploadRegistry struct {
+	db *gorm.DB
+}
+
+// NewGormUploadRegistry creates an UploadRegistry on db.
+func NewGormUploadRegistry(db *gorm.DB) *GormUploadRegistry {
+	return &GormUploadRegistry{db: db}
+}
+
+func (r *GormUploadRegistry) RecordUpload(ctx context.Context, key, ouHandle string) error {
+	return r.db.WithContext(ctx).Create(&UploadRecord{Key: key, OUHandle: ouHandle}).Error
+}
+
+func (r *GormUploadRegistry) UploadOwner(ctx context.Context, key string) (string, error) {
+	var record UploadRecord
+	if err := r.db.WithContext(ctx).First(&record, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrUploadNotRecorded
+		}
+		return "", fmt.Errorf("failed to look up upload %s: %w", key, err)
+	}
+	return record.OUHandle, nil
+}
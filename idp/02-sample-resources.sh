@@ -28,6 +28,7 @@ NPQS_M2M_CLIENT_SECRET="${M2M_NPQS_SECRET:-${M2M_CLIENT_SECRET}}"
 FCAU_M2M_CLIENT_SECRET="${M2M_FCAU_SECRET:-${M2M_CLIENT_SECRET}}"
 IRD_M2M_CLIENT_SECRET="${M2M_IRD_SECRET:-${M2M_CLIENT_SECRET}}"
 CDA_M2M_CLIENT_SECRET="${M2M_CDA_SECRET:-${M2M_CLIENT_SECRET}}"
+OPS_M2M_CLIENT_SECRET="${M2M_OPS_SECRET:-${M2M_CLIENT_SECRET}}"
 
 # ----------------------------------------------------------------------------
 # OAuth2 resource servers & scope sets
@@ -51,10 +52,14 @@ AGENCY_API_IDENTIFIER="AGENCY_API"
 # consignments, drive their task steps, read reference data, upload documents.
 TRADER_NSW_SCOPES='"nsw:consignment:read", "nsw:consignment:write", "nsw:task:read", "nsw:task:write", "nsw:hscode:read", "nsw:company:read", "nsw:cha:read", "nsw:storage:read", "nsw:storage:write"'
 
-# External OGA systems (M2M client_credentials -> NSW_API): push task outcomes
-# and read the consignment context for their processing,
-# and read/write storage for document exchange.
-M2M_NSW_SCOPES='"nsw:task:write", "nsw:consignment:read", "nsw:storage:read", "nsw:storage:write"'
+# External OGA systems (M2M client_credentials -> NSW_API): push task outcomes,
+# read and assign their officers' review queue, read the consignment context
+# for their processing, and read/write storage for document exchange.
+M2M_NSW_SCOPES='"nsw:task:read", "nsw:task:write", "nsw:consignment:read", "nsw:storage:read", "nsw:storage:write"'
+
+# NSW operations staff (back-office tooling via the NSW_OPS M2M client ->
+# NSW_API): the /api/v1/admin endpoints.
+OPS_NSW_SCOPES='"nsw:consignment:support", "nsw:fee:preview", "nsw:payment:reconcile", "nsw:payment:refund"'
 
 # Government reviewers (OGA portal SPA users via *PortalApp -> AGENCY_API):
 # review trader applications and read/write supporting documents.
@@ -723,6 +728,7 @@ NSW_RS_ID=$(create_resource_server "NSW API" "${NSW_API_IDENTIFIER}" "${DEFAULT_
 NSW_ROOT_RES_ID=$(create_resource "$NSW_RS_ID" "nsw" "NSW API")
 RID=$(create_resource "$NSW_RS_ID" "consignment" "Consignment" "$NSW_ROOT_RES_ID")
 create_action "$NSW_RS_ID" "$RID" "read" "Read"; create_action "$NSW_RS_ID" "$RID" "write" "Write"
+create_action "$NSW_RS_ID" "$RID" "support" "Support"
 RID=$(create_resource "$NSW_RS_ID" "task" "Task" "$NSW_ROOT_RES_ID")
 create_action "$NSW_RS_ID" "$RID" "read" "Read"; create_action "$NSW_RS_ID" "$RID" "write" "Write"
 RID=$(create_resource "$NSW_RS_ID" "hscode" "HS Code" "$NSW_ROOT_RES_ID")
@@ -733,6 +739,11 @@ RID=$(create_resource "$NSW_RS_ID" "cha" "CHA" "$NSW_ROOT_RES_ID")
 create_action "$NSW_RS_ID" "$RID" "read" "Read"
 RID=$(create_resource "$NSW_RS_ID" "storage" "Storage" "$NSW_ROOT_RES_ID")
 create_action "$NSW_RS_ID" "$RID" "read" "Read"; create_action "$NSW_RS_ID" "$RID" "write" "Write"; create_action "$NSW_RS_ID" "$RID" "delete" "Delete"
+RID=$(create_resource "$NSW_RS_ID" "fee" "Fee" "$NSW_ROOT_RES_ID")
+create_action "$NSW_RS_ID" "$RID" "preview" "Preview"
+RID=$(create_resource "$NSW_RS_ID" "payment" "Payment" "$NSW_ROOT_RES_ID")
+create_action "$NSW_RS_ID" "$RID" "reconcile" "Reconcile"
+create_action "$NSW_RS_ID" "$RID" "refund" "Refund"
 log_info "NSW_API resource server ID: $NSW_RS_ID"
 echo ""
 
@@ -791,6 +802,46 @@ fi
 log_info "AgencyM2M role ID: $AGENCY_M2M_ROLE_ID"
 echo ""
 
+# ============================================================================
+# Create NSWOperations Role (granted to the NSW_OPS back-office client)
+# ============================================================================
+# Carries the admin scopes, which no trader or agency role grants.
+
+log_info "Creating NSWOperations role (NSW_API admin permissions)..."
+read -r -d '' NSW_OPS_ROLE_PAYLOAD <<JSON || true
+{
+    "name": "NSWOperations",
+    "description": "Role for NSW operations staff tooling calling the NSW admin API",
+    "ouId": "${DEFAULT_OU_ID}",
+    "permissions": [
+        {
+            "resourceServerId": "${NSW_RS_ID}",
+            "permissions": [ ${OPS_NSW_SCOPES} ]
+        }
+    ]
+}
+JSON
+RESPONSE=$(api_call POST "/roles" "${NSW_OPS_ROLE_PAYLOAD}")
+HTTP_CODE="${RESPONSE: -3}"
+BODY="${RESPONSE%???}"
+if [[ "$HTTP_CODE" == "201" ]] || [[ "$HTTP_CODE" == "200" ]]; then
+    log_success "NSWOperations role created successfully"
+    NSW_OPS_ROLE_ID=$(extract_first_id "$BODY")
+elif [[ "$HTTP_CODE" == "409" ]]; then
+    log_warning "NSWOperations role already exists, retrieving ID..."
+    NSW_OPS_ROLE_ID=$(get_role_id_by_name "NSWOperations" "$DEFAULT_OU_ID")
+else
+    log_error "Failed to create NSWOperations role (HTTP $HTTP_CODE)"
+    echo "Response: $BODY"
+    exit 1
+fi
+if [[ -z "$NSW_OPS_ROLE_ID" ]]; then
+    log_error "Could not determine NSWOperations role ID"
+    exit 1
+fi
+log_info "NSWOperations role ID: $NSW_OPS_ROLE_ID"
+echo ""
+
 # ============================================================================
 # Create Private Sector Organization Unit
 # ============================================================================
@@ -1705,6 +1756,10 @@ create_m2m_application "CDA_TO_NSW_M2M" "Machine-to-machine integration for CDA
 CDA_TO_NSW_M2M_APP_ID="$CREATED_M2M_APP_ID"
 assign_role_to_app "$AGENCY_M2M_ROLE_ID" "$CDA_TO_NSW_M2M_APP_ID" "AgencyM2M" "CDA_TO_NSW_M2M"
 
+create_m2m_application "NSW_OPS_M2M" "Machine-to-machine integration for NSW operations tooling" "NSW_OPS" "${OPS_M2M_CLIENT_SECRET}" "${DEFAULT_OU_ID_FOR_M2M}" "${OPS_NSW_SCOPES}"
+NSW_OPS_M2M_APP_ID="$CREATED_M2M_APP_ID"
+assign_role_to_app "$NSW_OPS_ROLE_ID" "$NSW_OPS_M2M_APP_ID" "NSWOperations" "NSW_OPS_M2M"
+
 echo ""
 
 # ============================================================================
@@ -1728,12 +1783,12 @@ log_info "gomesh in groups: Traders"
 log_info "naresh (EDWARD PVT LTD) in groups: CHA"
 log_info "Government users: npqs_user, fcau_user, ird_user, cda_user"
 log_info "App client IDs: TRADER_PORTAL_APP, OGA_PORTAL_APP_NPQS, OGA_PORTAL_APP_FCAU, OGA_PORTAL_APP_IRD, OGA_PORTAL_APP_CDA"
-log_info "M2M client IDs: NPQS_TO_NSW, FCAU_TO_NSW, IRD_TO_NSW, CDA_TO_NSW"
+log_info "M2M client IDs: NPQS_TO_NSW, FCAU_TO_NSW, IRD_TO_NSW, CDA_TO_NSW, NSW_OPS"
 log_info "M2M auth method: client_secret_basic"
 echo ""
 log_info "Resource servers (token audiences):"
-log_info "  NSW_API    -> TraderApp users (Trader/CHA roles) + *_TO_NSW M2M clients (AgencyM2M role on app)"
+log_info "  NSW_API    -> TraderApp users (Trader/CHA roles) + *_TO_NSW M2M clients (AgencyM2M role on app) + NSW_OPS (NSWOperations role on app)"
 log_info "  AGENCY_API -> OGA portal users (OGA Reviewers group / OGA Reviewer role)"
-log_info "NSW_API scopes: nsw:{consignment,task,storage}:{read,write,delete}, nsw:{hscode,company,cha}:read"
+log_info "NSW_API scopes: nsw:{consignment,task,storage}:{read,write,delete}, nsw:{hscode,company,cha}:read, nsw:consignment:support, nsw:fee:preview, nsw:payment:{reconcile,refund}"
 log_info "AGENCY_API scopes: agency:application:{read,review,feedback}, agency:consignment:read, agency:storage:{read,write}"
 echo ""
@@ -51,6 +51,14 @@ export interface ConsignmentItem {
   hsCode: HSCodeDetails
 }
 
+export interface ConsignmentProgress {
+  total: number
+  completed: number
+  inProgress: number
+  awaitingTrader: number
+  awaitingOga: number
+}
+
 export interface ConsignmentSummary {
   id: string
   flow: TradeFlow
@@ -62,6 +70,7 @@ export interface ConsignmentSummary {
   updatedAt: string
   workflowNodeCount: number
   completedWorkflowNodeCount: number
+  progress: ConsignmentProgress
 }
 
 export interface ConsignmentDetail {
@@ -75,6 +84,7 @@ export interface ConsignmentDetail {
   createdAt: string
   updatedAt: string
   workflowNodes: WorkflowNode[]
+  progress: ConsignmentProgress
 }
 
 // Deprecated: Use ConsignmentDetail or ConsignmentSummary